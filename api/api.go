@@ -0,0 +1,182 @@
+package api
+
+// File api.go re-exports the stable parts of package 'controller', and the error codes Controllables report through.
+
+import (
+	"context"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+//
+// Controllables
+//
+
+// Controllable is the interface of states run by a Controller.
+type Controllable = controller.Controllable
+
+// ResponseCb is the type of the callbacks through which Controllables reply and broadcast.
+type ResponseCb = controller.ResponseCb
+
+// Snapshotter is the interface of Controllables that can take snapshots of their dumps.
+type Snapshotter = controller.Snapshotter
+
+// Prioritiser is the interface of Controllables that give their requests different priorities.
+type Prioritiser = controller.Prioritiser
+
+// Priority is the type of request priorities.
+type Priority = controller.Priority
+
+const (
+	// PriorityBulk is the priority of requests that may take a while, or come in large numbers.
+	PriorityBulk = controller.PriorityBulk
+	// PriorityNormal is the priority of most requests.
+	PriorityNormal = controller.PriorityNormal
+	// PriorityOperator is the priority of requests a presenter is waiting on.
+	PriorityOperator = controller.PriorityOperator
+)
+
+// SessionAware is the interface of Controllables that keep state private to each session.
+type SessionAware = controller.SessionAware
+
+// Session identifies one client's connection to a Controller.
+type Session = controller.Session
+
+// Wrapper is the interface of Controllables that wrap another state, whose optional interfaces the Controller uses.
+type Wrapper = controller.Wrapper
+
+// BifrostParser is the interface of Controllables that can be spoken to over Bifrost.
+type BifrostParser = controller.BifrostParser
+
+// BroadcastCoalescer is the interface of BifrostParsers whose broadcasts may supersede each other.
+type BroadcastCoalescer = controller.BroadcastCoalescer
+
+// BroadcastRegioner is the interface of BifrostParsers whose broadcasts may describe single items, for folding into
+// regions.
+type BroadcastRegioner = controller.BroadcastRegioner
+
+// BroadcastClassifier is the interface of BifrostParsers that sort their broadcasts into classes, so that clients
+// only get the classes their capabilities ask for.
+type BroadcastClassifier = controller.BroadcastClassifier
+
+// BroadcastClass is the class of a broadcast.
+type BroadcastClass = controller.BroadcastClass
+
+const (
+	// BroadcastCore is the class of broadcasts every client gets.
+	BroadcastCore = controller.BroadcastCore
+	// BroadcastMeta is the class of broadcasts about the details of the state.
+	BroadcastMeta = controller.BroadcastMeta
+	// BroadcastStatus is the class of broadcasts about how the server is doing.
+	BroadcastStatus = controller.BroadcastStatus
+)
+
+//
+// Running Controllables
+//
+
+// Controller runs a Controllable, handling requests from its Clients one at a time.
+type Controller = controller.Controller
+
+// Client is a handle through which requests go to a Controller.
+type Client = controller.Client
+
+// Request is a request to a Controller.
+type Request = controller.Request
+
+// RequestOrigin identifies where a request came from.
+type RequestOrigin = controller.RequestOrigin
+
+// Response is a response from a Controller.
+type Response = controller.Response
+
+// Observer is a registration of a function that sees each broadcast a Controller sends, made by
+// Controller.RegisterObserver.
+type Observer = controller.Observer
+
+// ObserverBuffer is the number of broadcasts an observer can fall behind by before it starts missing them.
+const ObserverBuffer = controller.ObserverBuffer
+
+// DoneResponse is the response that ends the replies to each request, carrying its error, if any.
+type DoneResponse = controller.DoneResponse
+
+// DumpRequest asks a Controller for a dump of its state.
+type DumpRequest = controller.DumpRequest
+
+// RoleRequest asks a Controller for the role of its state.
+type RoleRequest = controller.RoleRequest
+
+// NewController makes a Controller running s, and the first Client connected to it.
+func NewController(s Controllable) (*Controller, *Client) {
+	return controller.NewController(s)
+}
+
+// ProcessRepliesUntilAck calls cb with each reply from reply until the DoneResponse, returning the first error.
+func ProcessRepliesUntilAck(reply <-chan Response, cb func(Response) error) error {
+	return controller.ProcessRepliesUntilAck(reply, cb)
+}
+
+// ProgressResponse reports how far a long request has got, ahead of its acknowledgement.
+type ProgressResponse = controller.ProgressResponse
+
+// Progress reports the progress of a request through its reply callback.
+type Progress = controller.Progress
+
+// NewProgress makes a Progress for a request, replying through replyCb, that takes total steps and does what note
+// says.
+func NewProgress(replyCb ResponseCb, note string, total int) *Progress {
+	return controller.NewProgress(replyCb, note, total)
+}
+
+// Motd is a message of the day, shared between the Bifrost adapters of a server.
+type Motd = controller.Motd
+
+// NewMotd makes a Motd whose message starts out as text.
+func NewMotd(text string) *Motd {
+	return controller.NewMotd(text)
+}
+
+// ParseMotdMessage tries to parse m as a 'MOTD' message, returning its text.
+func ParseMotdMessage(m *message.Message) (string, error) {
+	return controller.ParseMotdMessage(m)
+}
+
+//
+// Request contexts
+//
+
+// Identity is who a client logged in as.
+type Identity = auth.Identity
+
+// IdentityFrom gets who made a request with context ctx, and whether they are known at all.
+func IdentityFrom(ctx context.Context) (Identity, bool) {
+	return controller.IdentityFrom(ctx)
+}
+
+// NamespaceFrom gets the path of mount points through which a request with context ctx came.
+func NamespaceFrom(ctx context.Context) string {
+	return controller.NamespaceFrom(ctx)
+}
+
+//
+// Errors
+//
+
+// WithCode gets a copy of err that reports the error code code to Bifrost clients.
+func WithCode(code string, err error) error {
+	return bifrost.WithCode(code, err)
+}
+
+// CodeOf gets the code of the first error in err's chain that has one, or 'error' if none do.
+func CodeOf(err error) string {
+	return bifrost.CodeOf(err)
+}
+
+// UnknownWord gets the error BifrostParsers return for words they don't understand.
+func UnknownWord(word string) error {
+	return controller.UnknownWord(word)
+}
@@ -0,0 +1,62 @@
+package api_test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/api"
+)
+
+// legacyState is a LegacyControllable that is also a Snapshotter.
+type legacyState struct{}
+
+func (legacyState) RoleName() string {
+	return "legacy"
+}
+
+func (legacyState) Dump(dumpCb api.ResponseCb) {
+	dumpCb("dumped")
+}
+
+func (legacyState) HandleRequest(replyCb, _ api.ResponseCb, rbody interface{}) error {
+	replyCb(rbody)
+	return nil
+}
+
+func (legacyState) Snapshot() []interface{} {
+	return []interface{}{"snapshotted"}
+}
+
+// TestFromLegacy checks that a LegacyControllable runs under a Controller, which still finds its optional interfaces.
+func TestFromLegacy(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctl, cli := api.NewController(api.FromLegacy(legacyState{}))
+	go ctl.Run(ctx)
+
+	send := func(body interface{}) []interface{} {
+		t.Helper()
+		var got []interface{}
+		ok, err := cli.SendAndProcessReplies(ctx, "t", body, func(rs api.Response) error {
+			got = append(got, rs.Body)
+			return nil
+		})
+		if !ok || err != nil {
+			t.Fatalf("request %v failed: sent %v, error %v", body, ok, err)
+		}
+		return got
+	}
+
+	if got, want := send("echo"), []interface{}{"echo"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("request: got %v, want %v", got, want)
+	}
+	if got, want := send(api.DumpRequest{}), []interface{}{"snapshotted"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("dump: got %v, want %v", got, want)
+	}
+
+	if err := cli.Shutdown(ctx); err != nil {
+		t.Errorf("error shutting down: %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+// Package api is the stable face of yaps, for people building their own Controllables to run under it.
+//
+// The packages behind it, chiefly 'controller', change shape as yaps grows: types move between files and packages,
+// and interfaces gain parameters.
+// Everything here keeps its name and meaning across minor versions of Version; when what lies behind it changes,
+// this package absorbs the change, and anything that can no longer be kept as it was stays on as a deprecated shim
+// until the next major version.
+// Anything not re-exported here, such as the Bifrost adapter, the watchdog and the net server, may change at any time.
+package api
+
+// Version is the version of this package's API.
+// The major version changes when anything here goes away, and the minor version when anything is added.
+const Version = "1.5.0"
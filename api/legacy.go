@@ -0,0 +1,53 @@
+package api
+
+// File legacy.go contains shims for Controllables written against older shapes of the API.
+
+import "context"
+
+// LegacyControllable is the interface Controllables had before requests carried contexts.
+//
+// Deprecated: implement Controllable, whose HandleRequest also takes the request's context.
+type LegacyControllable interface {
+	// RoleName gives the Bifrost role name of this LegacyControllable.
+	RoleName() string
+
+	// Dump dumps out the LegacyControllable's public state, calling dumpCb for each dump response.
+	Dump(dumpCb ResponseCb)
+
+	// HandleRequest handles a request with body rbody, reply callback replyCb, and broadcast callback bcastCb.
+	HandleRequest(replyCb ResponseCb, bcastCb ResponseCb, rbody interface{}) error
+}
+
+// FromLegacy adapts s into a Controllable that ignores each request's context.
+// The Controller still finds any optional interfaces, such as BifrostParser, that s implements.
+//
+// Deprecated: implement Controllable directly.
+func FromLegacy(s LegacyControllable) Controllable {
+	return legacyControllable{s: s}
+}
+
+// legacyControllable adapts a LegacyControllable into a Controllable.
+type legacyControllable struct {
+	// s is the LegacyControllable being adapted.
+	s LegacyControllable
+}
+
+// RoleName gives the role name of the adapted LegacyControllable.
+func (l legacyControllable) RoleName() string {
+	return l.s.RoleName()
+}
+
+// Dump dumps the adapted LegacyControllable.
+func (l legacyControllable) Dump(dumpCb ResponseCb) {
+	l.s.Dump(dumpCb)
+}
+
+// HandleRequest passes a request, without its context, to the adapted LegacyControllable.
+func (l legacyControllable) HandleRequest(_ context.Context, replyCb ResponseCb, bcastCb ResponseCb, rbody interface{}) error {
+	return l.s.HandleRequest(replyCb, bcastCb, rbody)
+}
+
+// Unwrap gets the adapted LegacyControllable, so that the Controller can find its optional interfaces.
+func (l legacyControllable) Unwrap() interface{} {
+	return l.s
+}
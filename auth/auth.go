@@ -0,0 +1,85 @@
+// Package auth contains the providers yaps uses to find out who its clients are.
+//
+// A Provider turns the credentials a client logs in with into an Identity: a user name, and the groups the user is in.
+// Stations without a directory can list tokens in the config (Static); stations with one can check passwords against
+// LDAP (LDAP), or accept tokens issued by an OpenID Connect provider (OIDC).
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// CodeDenied is the error code of failed logins.
+const CodeDenied = "denied"
+
+// ErrDenied is the error returned when credentials don't identify anyone.
+// Providers wrap it, but don't say why: clients shouldn't learn which half of their credentials was wrong.
+var ErrDenied = bifrost.WithCode(CodeDenied, errors.New("login denied"))
+
+// Identity is who a client turned out to be.
+type Identity struct {
+	// User is the user's name.
+	User string
+	// Groups holds the names of the groups the user is in.
+	Groups []string
+}
+
+// InGroup checks whether id is in the group group.
+func (id Identity) InGroup(group string) bool {
+	for _, g := range id.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+// Credentials holds what a client offers when logging in.
+// Clients offer either a user name and password, or a token.
+type Credentials struct {
+	// User is the user name, if logging in with a password.
+	User string
+	// Password is the password, if logging in with a password.
+	Password string
+	// Token is the token, if logging in with a token.
+	Token string
+}
+
+// Provider is the interface of things that can check credentials.
+//
+// Providers may take a while, and talk to the network; Authenticate must be safe to call from many goroutines at
+// once.
+type Provider interface {
+	// Authenticate checks creds, returning the Identity they prove or an error wrapping ErrDenied.
+	// Other errors mean that the provider couldn't find out.
+	Authenticate(ctx context.Context, creds Credentials) (Identity, error)
+}
+
+// Static is a Provider that knows a fixed set of tokens.
+// It maps each token to the Identity it proves.
+type Static map[string]Identity
+
+// Authenticate checks that creds holds one of the tokens in s.
+func (s Static) Authenticate(_ context.Context, creds Credentials) (Identity, error) {
+	if creds.Token == "" {
+		return Identity{}, ErrDenied
+	}
+	// Compare against every token, so that how long this takes says nothing about which tokens exist.
+	var (
+		id    Identity
+		found bool
+	)
+	for tok, tid := range s {
+		if subtle.ConstantTimeCompare([]byte(tok), []byte(creds.Token)) == 1 {
+			id, found = tid, true
+		}
+	}
+	if !found {
+		return Identity{}, ErrDenied
+	}
+	return id, nil
+}
@@ -0,0 +1,139 @@
+package auth_test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/auth"
+)
+
+// TestStatic_Authenticate checks that a static provider accepts exactly its own tokens.
+func TestStatic_Authenticate(t *testing.T) {
+	p := auth.Static{"sesame": {User: "ali", Groups: []string{"presenters"}}}
+
+	id, err := p.Authenticate(context.Background(), auth.Credentials{Token: "sesame"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if want := (auth.Identity{User: "ali", Groups: []string{"presenters"}}); !reflect.DeepEqual(id, want) {
+		t.Errorf("got %v, want %v", id, want)
+	}
+
+	for _, creds := range []auth.Credentials{{Token: "open"}, {}, {User: "ali", Password: "sesame"}} {
+		if _, err := p.Authenticate(context.Background(), creds); !errors.Is(err, auth.ErrDenied) {
+			t.Errorf("%v: got error %v, want denial", creds, err)
+		}
+	}
+}
+
+// TestOIDC_Authenticate checks that an OIDC provider accepts in-date tokens signed with the issuer's keys for its
+// audience, and nothing else.
+func TestOIDC_Authenticate(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("couldn't make key:", err)
+	}
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal("couldn't make key:", err)
+	}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			_ = json.NewEncoder(w).Encode(map[string]string{"jwks_uri": srv.URL + "/keys"})
+		case "/keys":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+				"kid": "k1",
+				"kty": "RSA",
+				"use": "sig",
+				"n":   b64(key.N.Bytes()),
+				"e":   b64(big.NewInt(int64(key.E)).Bytes()),
+			}}})
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	p := &auth.OIDC{Issuer: srv.URL, Audience: "yaps", Client: srv.Client()}
+	now := time.Now()
+	claims := func(change func(map[string]interface{})) map[string]interface{} {
+		c := map[string]interface{}{
+			"iss":    srv.URL,
+			"aud":    []string{"yaps", "other"},
+			"sub":    "u123",
+			"exp":    now.Add(time.Hour).Unix(),
+			"groups": []string{"presenters", "engineers"},
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+
+	id, err := p.Authenticate(context.Background(), auth.Credentials{Token: sign(t, key, "RS256", "k1", claims(nil))})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if want := (auth.Identity{User: "u123", Groups: []string{"presenters", "engineers"}}); !reflect.DeepEqual(id, want) {
+		t.Errorf("got %v, want %v", id, want)
+	}
+
+	bad := map[string]string{
+		"wrong key":      sign(t, other, "RS256", "k1", claims(nil)),
+		"unknown key":    sign(t, key, "RS256", "k2", claims(nil)),
+		"no algorithm":   sign(t, key, "none", "k1", claims(nil)),
+		"wrong issuer":   sign(t, key, "RS256", "k1", claims(func(c map[string]interface{}) { c["iss"] = "https://evil" })),
+		"wrong audience": sign(t, key, "RS256", "k1", claims(func(c map[string]interface{}) { c["aud"] = "other" })),
+		"expired":        sign(t, key, "RS256", "k1", claims(func(c map[string]interface{}) { c["exp"] = now.Add(-time.Hour).Unix() })),
+		"not yet valid":  sign(t, key, "RS256", "k1", claims(func(c map[string]interface{}) { c["nbf"] = now.Add(time.Hour).Unix() })),
+		"no expiry":      sign(t, key, "RS256", "k1", claims(func(c map[string]interface{}) { delete(c, "exp") })),
+		"garbage":        "not.a.token",
+	}
+	for name, tok := range bad {
+		if _, err := p.Authenticate(context.Background(), auth.Credentials{Token: tok}); !errors.Is(err, auth.ErrDenied) {
+			t.Errorf("%s: got error %v, want denial", name, err)
+		}
+	}
+}
+
+// b64 encodes bs in unpadded base64url, as JWTs do.
+func b64(bs []byte) string {
+	return base64.RawURLEncoding.EncodeToString(bs)
+}
+
+// sign makes a JWT with claims, claiming to be signed with alg and key kid, but signed by RS256 with key.
+func sign(t *testing.T, key *rsa.PrivateKey, alg, kid string, claims map[string]interface{}) string {
+	t.Helper()
+
+	hdr, err := json.Marshal(map[string]string{"alg": alg, "kid": kid})
+	if err != nil {
+		t.Fatal("couldn't marshal header:", err)
+	}
+	body, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal("couldn't marshal claims:", err)
+	}
+	signed := b64(hdr) + "." + b64(body)
+
+	digest := sha256.Sum256([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal("couldn't sign:", err)
+	}
+	return signed + "." + b64(sig)
+}
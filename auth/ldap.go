@@ -0,0 +1,155 @@
+package auth
+
+// File ldap.go contains LDAP, a Provider that checks user names and passwords against an LDAP directory.
+//
+// LDAP logs in ('binds') to the directory as the user, so it needs no credentials of its own; once bound, it searches
+// for the groups the user is in.
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	// DefaultGroupFilter is the group filter LDAP uses if none is given.
+	DefaultGroupFilter = "(member=%s)"
+	// DefaultGroupAttr is the group name attribute LDAP uses if none is given.
+	DefaultGroupAttr = "cn"
+	// defaultLDAPTimeout is how long LDAP waits for the directory if its context has no deadline.
+	defaultLDAPTimeout = 10 * time.Second
+)
+
+// LDAP is a Provider that checks user names and passwords against an LDAP directory.
+type LDAP struct {
+	// URL is the URL of the directory, for example "ldaps://ldap.example.com".
+	URL string
+	// StartTLS toggles whether LDAP upgrades an 'ldap://' connection to TLS before sending any password.
+	StartTLS bool
+	// TLS configures TLS for 'ldaps://' URLs and StartTLS; if nil, the system's defaults are used.
+	TLS *tls.Config
+	// UserDN is the template of user DNs, with %s standing for the user name, for example
+	// "uid=%s,ou=people,dc=example,dc=com".
+	UserDN string
+	// GroupBase is the DN under which LDAP searches for the user's groups; if empty, users have no groups.
+	GroupBase string
+	// GroupFilter is the filter matching the user's groups, with %s standing for the user's DN.
+	// If empty, it is DefaultGroupFilter.
+	GroupFilter string
+	// GroupAttr is the attribute holding each group's name.
+	// If empty, it is DefaultGroupAttr.
+	GroupAttr string
+}
+
+// Authenticate checks creds' user name and password by binding to the directory as the user.
+func (p LDAP) Authenticate(ctx context.Context, creds Credentials) (Identity, error) {
+	// An empty password makes an 'unauthenticated bind', which many directories allow for anyone.
+	if creds.User == "" || creds.Password == "" {
+		return Identity{}, ErrDenied
+	}
+
+	conn, err := p.dial(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	defer conn.Close()
+
+	dn := fmt.Sprintf(p.UserDN, ldap.EscapeDN(creds.User))
+	if err := conn.Bind(dn, creds.Password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return Identity{}, ErrDenied
+		}
+		return Identity{}, fmt.Errorf("couldn't bind to LDAP: %w", err)
+	}
+
+	groups, err := p.groups(conn, dn)
+	if err != nil {
+		return Identity{}, err
+	}
+	return Identity{User: creds.User, Groups: groups}, nil
+}
+
+// dial connects to the directory, upgrading to TLS if need be.
+// Operations on the connection time out at ctx's deadline, if it has one.
+func (p LDAP) dial(ctx context.Context) (*ldap.Conn, error) {
+	timeout := defaultLDAPTimeout
+	if dl, ok := ctx.Deadline(); ok {
+		timeout = time.Until(dl)
+	}
+
+	conn, err := ldap.DialURL(p.URL, ldap.DialWithTLSConfig(p.TLS))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect to LDAP: %w", err)
+	}
+	conn.SetTimeout(timeout)
+
+	if p.StartTLS {
+		cfg := p.TLS
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		if cfg.ServerName == "" {
+			cfg = cfg.Clone()
+			cfg.ServerName = ldapHost(p.URL)
+		}
+		if err := conn.StartTLS(cfg); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("couldn't start TLS with LDAP: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// ldapHost gets the host name part of the LDAP URL u.
+func ldapHost(u string) string {
+	pu, err := url.Parse(u)
+	if err != nil {
+		return ""
+	}
+	return pu.Hostname()
+}
+
+// groups gets the names of the groups containing the user with DN dn, over conn.
+func (p LDAP) groups(conn *ldap.Conn, dn string) ([]string, error) {
+	if p.GroupBase == "" {
+		return nil, nil
+	}
+	filter := p.GroupFilter
+	if filter == "" {
+		filter = DefaultGroupFilter
+	}
+	attr := p.GroupAttr
+	if attr == "" {
+		attr = DefaultGroupAttr
+	}
+
+	rq := ldap.NewSearchRequest(p.GroupBase, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 0, 0, false,
+		fmt.Sprintf(filter, ldap.EscapeFilter(dn)), []string{attr}, nil)
+	rs, err := conn.Search(rq)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't search LDAP for groups: %w", err)
+	}
+
+	var groups []string
+	for _, e := range rs.Entries {
+		groups = append(groups, e.GetAttributeValues(attr)...)
+	}
+	return groups, nil
+}
+
+// Check checks that p is complete enough to use.
+func (p LDAP) Check() error {
+	if p.URL == "" {
+		return errors.New("LDAP needs a URL")
+	}
+	if !strings.Contains(p.UserDN, "%s") {
+		return errors.New("LDAP needs a user DN template with %s for the user name")
+	}
+	return nil
+}
@@ -0,0 +1,370 @@
+package auth
+
+// File oidc.go contains OIDC, a Provider that accepts ID tokens issued by an OpenID Connect provider.
+//
+// yaps never takes part in the OpenID Connect flow itself: clients log in however the provider likes, and pass yaps
+// the signed ID token they get back.
+// OIDC checks the token's signature against the provider's published keys, which it finds through the provider's
+// discovery document, and checks that the token is meant for yaps and still in date.
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // for RS256 and ES256
+	_ "crypto/sha512" // for RS384, RS512, and ES384
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultUserClaim is the claim OIDC takes user names from if none is given.
+	DefaultUserClaim = "preferred_username"
+	// DefaultGroupsClaim is the claim OIDC takes groups from if none is given.
+	DefaultGroupsClaim = "groups"
+
+	// oidcLeeway is how far OIDC lets clocks disagree when checking whether tokens are in date.
+	oidcLeeway = time.Minute
+	// oidcRefetchInterval is the shortest time OIDC leaves between fetches of the provider's keys.
+	oidcRefetchInterval = time.Minute
+)
+
+// OIDC is a Provider that accepts ID tokens issued by an OpenID Connect provider.
+// Once used, it must not be copied.
+type OIDC struct {
+	// Issuer is the provider's issuer URL, for example "https://accounts.example.com".
+	Issuer string
+	// Audience is the client ID the provider issues yaps' tokens to; tokens for anyone else are refused.
+	Audience string
+	// UserClaim is the claim holding the user name; if the token doesn't have it, the 'sub' claim is used.
+	// If empty, it is DefaultUserClaim.
+	UserClaim string
+	// GroupsClaim is the claim holding the user's groups.
+	// If empty, it is DefaultGroupsClaim.
+	GroupsClaim string
+	// Client is the HTTP client used to fetch the provider's keys; if nil, http.DefaultClient is used.
+	Client *http.Client
+
+	// mu guards the fields below.
+	mu sync.Mutex
+	// keys maps key IDs to the provider's public keys.
+	keys map[string]crypto.PublicKey
+	// fetched is when keys was last fetched.
+	fetched time.Time
+}
+
+// Authenticate checks that creds holds an ID token from the provider, meant for yaps, and in date.
+func (p *OIDC) Authenticate(ctx context.Context, creds Credentials) (Identity, error) {
+	parts := strings.Split(creds.Token, ".")
+	if len(parts) != 3 {
+		return Identity{}, ErrDenied
+	}
+
+	var hdr struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &hdr); err != nil {
+		return Identity{}, ErrDenied
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Identity{}, ErrDenied
+	}
+
+	key, err := p.key(ctx, hdr.Kid)
+	if err != nil {
+		return Identity{}, err
+	}
+	if !verify(hdr.Alg, key, parts[0]+"."+parts[1], sig) {
+		return Identity{}, ErrDenied
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Identity{}, ErrDenied
+	}
+	if !p.acceptable(claims, time.Now()) {
+		return Identity{}, ErrDenied
+	}
+	return p.identity(claims)
+}
+
+// decodeSegment decodes the JSON in the token segment seg into v.
+func decodeSegment(seg string, v interface{}) error {
+	bs, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(bs, v)
+}
+
+// acceptable checks that claims were issued by the provider to yaps, and are in date at time now.
+func (p *OIDC) acceptable(claims map[string]interface{}, now time.Time) bool {
+	if iss, _ := claims["iss"].(string); iss != p.Issuer {
+		return false
+	}
+	if !hasAudience(claims["aud"], p.Audience) {
+		return false
+	}
+
+	exp, ok := claims["exp"].(float64)
+	if !ok || !now.Add(-oidcLeeway).Before(time.Unix(int64(exp), 0)) {
+		return false
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(oidcLeeway).Before(time.Unix(int64(nbf), 0)) {
+		return false
+	}
+	return true
+}
+
+// hasAudience checks whether the 'aud' claim aud, which may be a string or an array, contains want.
+func hasAudience(aud interface{}, want string) bool {
+	switch a := aud.(type) {
+	case string:
+		return a == want
+	case []interface{}:
+		for _, x := range a {
+			if x == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// identity gets the Identity described by claims.
+func (p *OIDC) identity(claims map[string]interface{}) (Identity, error) {
+	uclaim := p.UserClaim
+	if uclaim == "" {
+		uclaim = DefaultUserClaim
+	}
+	user, _ := claims[uclaim].(string)
+	if user == "" {
+		user, _ = claims["sub"].(string)
+	}
+	if user == "" {
+		return Identity{}, ErrDenied
+	}
+
+	gclaim := p.GroupsClaim
+	if gclaim == "" {
+		gclaim = DefaultGroupsClaim
+	}
+	var groups []string
+	switch g := claims[gclaim].(type) {
+	case string:
+		groups = []string{g}
+	case []interface{}:
+		for _, x := range g {
+			if s, ok := x.(string); ok {
+				groups = append(groups, s)
+			}
+		}
+	}
+	return Identity{User: user, Groups: groups}, nil
+}
+
+// verify checks that sig is a signature of signed under key, with the JWS algorithm alg.
+func verify(alg string, key crypto.PublicKey, signed string, sig []byte) bool {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		// This includes 'none'.
+		return false
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") && rsa.VerifyPKCS1v15(k, hash, digest, sig) == nil
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(sig) != 2*size {
+			return false
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		return ecdsa.Verify(k, digest, r, s)
+	default:
+		return false
+	}
+}
+
+// key gets the provider's key with ID kid, fetching the provider's keys if it doesn't know it.
+func (p *OIDC) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	// Unknown keys are usually forged, but may be new; don't let forgeries make us hammer the provider.
+	if time.Since(p.fetched) < oidcRefetchInterval {
+		return nil, ErrDenied
+	}
+
+	keys, err := p.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.keys = keys
+	p.fetched = time.Now()
+
+	if key, ok := p.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrDenied
+}
+
+// jwk is a JSON Web Key, as published by the provider.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	// N and E are the modulus and exponent of RSA keys.
+	N string `json:"n"`
+	E string `json:"e"`
+	// Crv, X, and Y are the curve and point of EC keys.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// fetchKeys fetches the provider's signing keys, through its discovery document.
+func (p *OIDC) fetchKeys(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	var disco struct {
+		JWKSURI string `json:"jwks_uri"`
+	}
+	if err := p.getJSON(ctx, strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", &disco); err != nil {
+		return nil, err
+	}
+	if disco.JWKSURI == "" {
+		return nil, errors.New("OIDC discovery document has no jwks_uri")
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := p.getJSON(ctx, disco.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		// Skip keys we can't use, rather than failing: the provider may have others we can.
+		if key, err := k.publicKey(); err == nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// getJSON fetches the JSON document at url into v.
+func (p *OIDC) getJSON(ctx context.Context, url string, v interface{}) error {
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	rs, err := client.Do(rq)
+	if err != nil {
+		return fmt.Errorf("couldn't fetch %s: %w", url, err)
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		return fmt.Errorf("couldn't fetch %s: %s", url, rs.Status)
+	}
+	if err := json.NewDecoder(rs.Body).Decode(v); err != nil {
+		return fmt.Errorf("couldn't read %s: %w", url, err)
+	}
+	return nil
+}
+
+// publicKey gets the public key k describes.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("RSA exponent too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, errors.New("EC point not on curve")
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// decodeBigInt decodes the base64url big-endian integer s.
+func decodeBigInt(s string) (*big.Int, error) {
+	bs, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bs), nil
+}
+
+// Check checks that p is complete enough to use.
+func (p *OIDC) Check() error {
+	if p.Issuer == "" {
+		return errors.New("OIDC needs an issuer URL")
+	}
+	if p.Audience == "" {
+		return errors.New("OIDC needs an audience (the client ID yaps' tokens are issued to)")
+	}
+	return nil
+}
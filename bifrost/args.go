@@ -0,0 +1,156 @@
+// Package bifrost contains helpers for working with Bifrost messages that the bifrost-go library doesn't provide.
+package bifrost
+
+// File args.go contains Validator, which checks and converts message arguments.
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ArityError is the error returned when a message has the wrong number of arguments.
+type ArityError struct {
+	// Got is the number of arguments the message had.
+	Got int
+	// Min is the minimum number of arguments the message may have.
+	Min int
+	// Max is the maximum number of arguments the message may have.
+	Max int
+}
+
+// Error gets the error message of an ArityError.
+func (e ArityError) Error() string {
+	if e.Min == e.Max {
+		return fmt.Sprintf("bad arity: got %d arguments, want %d", e.Got, e.Max)
+	}
+	return fmt.Sprintf("bad arity: got %d arguments, want %d to %d", e.Got, e.Min, e.Max)
+}
+
+// ArgError is the error returned when a single message argument is invalid.
+type ArgError struct {
+	// Pos is the position of the argument, counting from 0.
+	Pos int
+	// Arg is the argument itself.
+	Arg string
+	// Err is the reason the argument is invalid.
+	Err error
+}
+
+// Error gets the error message of an ArgError.
+// Positions in the message count from 1, as they would in a Bifrost client.
+func (e ArgError) Error() string {
+	return fmt.Sprintf("bad argument %d (%q): %s", e.Pos+1, e.Arg, e.Err)
+}
+
+// Unwrap gets the reason the argument is invalid.
+func (e ArgError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	// ErrNotInt is the reason given for arguments that should be, but aren't, integers.
+	ErrNotInt = errors.New("not an integer")
+	// ErrNotUint is the reason given for arguments that should be, but aren't, unsigned integers.
+	ErrNotUint = errors.New("not an unsigned integer")
+	// ErrEmptyHash is the reason given for empty item hashes.
+	ErrEmptyHash = errors.New("hash is empty")
+)
+
+// Validator checks and converts the arguments of a Bifrost message.
+// Its methods each declare one argument, converting it into a destination if it is present and valid;
+// they chain, and the first error is kept for Err to return.
+type Validator struct {
+	// args is the list of arguments being validated.
+	args []string
+	// min is the number of required arguments declared so far.
+	min int
+	// max is the number of arguments declared so far.
+	max int
+	// optional is true if arguments declared from now on are optional.
+	optional bool
+	// err is the first argument error found, if any.
+	err error
+}
+
+// Args starts validating the message arguments args.
+func Args(args []string) *Validator {
+	return &Validator{args: args}
+}
+
+// Optional marks the arguments declared after it as optional.
+// Optional arguments missing from the message leave their destinations untouched.
+func (v *Validator) Optional() *Validator {
+	v.optional = true
+	return v
+}
+
+// Func declares argument i, converting it with f.
+// Any error f returns becomes the reason in an ArgError.
+func (v *Validator) Func(i int, f func(string) error) *Validator {
+	if v.max < i+1 {
+		v.max = i + 1
+	}
+	if !v.optional && v.min < i+1 {
+		v.min = i + 1
+	}
+
+	if v.err != nil || len(v.args) <= i {
+		return v
+	}
+	if err := f(v.args[i]); err != nil {
+		v.err = ArgError{Pos: i, Arg: v.args[i], Err: err}
+	}
+	return v
+}
+
+// Int declares argument i as an integer, converting it into dst.
+func (v *Validator) Int(i int, dst *int) *Validator {
+	return v.Func(i, func(s string) error {
+		x, err := strconv.Atoi(s)
+		if err != nil {
+			return ErrNotInt
+		}
+		*dst = x
+		return nil
+	})
+}
+
+// Uint declares argument i as an unsigned integer, converting it into dst.
+func (v *Validator) Uint(i int, dst *uint64) *Validator {
+	return v.Func(i, func(s string) error {
+		x, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			return ErrNotUint
+		}
+		*dst = x
+		return nil
+	})
+}
+
+// Hash declares argument i as an item hash, copying it into dst.
+func (v *Validator) Hash(i int, dst *string) *Validator {
+	return v.Func(i, func(s string) error {
+		if s == "" {
+			return ErrEmptyHash
+		}
+		*dst = s
+		return nil
+	})
+}
+
+// String declares argument i as a string, copying it into dst.
+func (v *Validator) String(i int, dst *string) *Validator {
+	return v.Func(i, func(s string) error {
+		*dst = s
+		return nil
+	})
+}
+
+// Err checks the number of arguments against those declared, then returns the first error found, if any.
+func (v *Validator) Err() error {
+	if n := len(v.args); n < v.min || v.max < n {
+		return ArityError{Got: n, Min: v.min, Max: v.max}
+	}
+	return v.err
+}
@@ -0,0 +1,72 @@
+package bifrost_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+func ExampleArgs() {
+	var (
+		index int
+		hash  string
+		note  string
+	)
+	err := bifrost.Args([]string{"3", "abc"}).
+		Int(0, &index).
+		Hash(1, &hash).
+		Optional().
+		String(2, &note).
+		Err()
+	fmt.Println(index, hash, err)
+
+	err = bifrost.Args([]string{"three", "abc"}).Int(0, &index).Hash(1, &hash).Err()
+	fmt.Println(err)
+
+	err = bifrost.Args([]string{"3"}).Int(0, &index).Hash(1, &hash).Err()
+	fmt.Println(err)
+
+	// Output:
+	// 3 abc <nil>
+	// bad argument 1 ("three"): not an integer
+	// bad arity: got 1 arguments, want 2
+}
+
+// TestArgs_Errors checks the errors Validator returns for various malformed arguments.
+func TestArgs_Errors(t *testing.T) {
+	var (
+		i int
+		u uint64
+		s string
+	)
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"ok", bifrost.Args([]string{"1", "2"}).Int(0, &i).Uint(1, &u).Err(), nil},
+		{"too many", bifrost.Args([]string{"1", "2"}).Int(0, &i).Err(), bifrost.ArityError{Got: 2, Min: 1, Max: 1}},
+		{"all optional", bifrost.Args(nil).Optional().Int(0, &i).Int(1, &i).Err(), nil},
+		{"optional range", bifrost.Args([]string{"1", "2", "3"}).Int(0, &i).Optional().Int(1, &i).Err(), bifrost.ArityError{Got: 3, Min: 1, Max: 2}},
+		{"negative uint", bifrost.Args([]string{"-1"}).Uint(0, &u).Err(), bifrost.ArgError{Pos: 0, Arg: "-1", Err: bifrost.ErrNotUint}},
+		{"empty hash", bifrost.Args([]string{"x", ""}).String(0, &s).Hash(1, &s).Err(), bifrost.ArgError{Pos: 1, Arg: "", Err: bifrost.ErrEmptyHash}},
+		{"arity first", bifrost.Args([]string{"x"}).Int(0, &i).Int(1, &i).Err(), bifrost.ArityError{Got: 1, Min: 2, Max: 2}},
+	}
+
+	for _, c := range cases {
+		if c.err != c.want {
+			t.Errorf("%s: got error %v, want %v", c.name, c.err, c.want)
+		}
+	}
+}
+
+// TestArgError_Unwrap checks that argument errors expose their reasons.
+func TestArgError_Unwrap(t *testing.T) {
+	var i int
+	err := bifrost.Args([]string{"x"}).Int(0, &i).Err()
+	if !errors.Is(err, bifrost.ErrNotInt) {
+		t.Errorf("got %v, want an error wrapping %v", err, bifrost.ErrNotInt)
+	}
+}
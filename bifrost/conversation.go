@@ -0,0 +1,226 @@
+package bifrost
+
+// File conversation.go contains conversations: the replies to one request to a Bifrost server, picked out by tag
+// from everything else the server sends, up to the request's ACK.
+//
+// Whatever reads from the server hands each message to a Router, which passes it to the Conversation with its tag, or
+// back to the reader if it has none (as with broadcasts).
+// Code with only one request in flight at a time can use Converse, which does the reading itself.
+
+import (
+	"context"
+	"errors"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+)
+
+// ErrHungUp is the error returned when a conversation ends without its request being acknowledged.
+var ErrHungUp = errors.New("hung up before the request was acknowledged")
+
+// AckError is the error returned when a conversation's request is acknowledged with WHAT or FAIL.
+type AckError struct {
+	// Ack is the acknowledgement.
+	Ack core.AckResponse
+}
+
+// Error gets the acknowledgement's status and description.
+func (e AckError) Error() string {
+	return e.Ack.Status.String() + " " + e.Ack.Description
+}
+
+// Blame blames the client for WHATs, and the server for FAILs.
+func (e AckError) Blame() core.Blame {
+	if e.Ack.Status == core.StatusWhat {
+		return core.BlameClient
+	}
+	return core.BlameServer
+}
+
+// Conversation is the replies to one request.
+type Conversation struct {
+	// replies carries the replies, other than the ACK; it closes once the conversation is over.
+	replies chan message.Message
+	// ack is the ACK, or nil if the conversation ended without one.
+	// It is only safe to read once replies closes.
+	ack *core.AckResponse
+	// err is the error, if any, in parsing the ACK, or in receiving the replies.
+	err error
+}
+
+// NewConversation makes a Conversation, which gets its replies once added to a Router.
+func NewConversation() *Conversation {
+	return &Conversation{replies: make(chan message.Message)}
+}
+
+// Replies gets the channel of replies, other than the ACK, which closes once the conversation is over.
+// Whoever holds the Conversation must read it until then, or use Each.
+func (c *Conversation) Replies() <-chan message.Message {
+	return c.replies
+}
+
+// Err gets why the conversation failed, or nil if the request was acknowledged with OK.
+// It is only meaningful once Replies has closed: it is ErrHungUp if there was no ACK, and an AckError if the ACK
+// wasn't OK.
+func (c *Conversation) Err() error {
+	switch {
+	case c.err != nil:
+		return c.err
+	case c.ack == nil:
+		return ErrHungUp
+	case c.ack.Status != core.StatusOk:
+		return AckError{Ack: *c.ack}
+	default:
+		return nil
+	}
+}
+
+// Ack gets the request's ACK, or nil if the conversation ended without one.
+// It is only meaningful once Replies has closed.
+func (c *Conversation) Ack() *core.AckResponse {
+	return c.ack
+}
+
+// Each calls f, if not nil, on each reply until the conversation is over, then returns Err.
+func (c *Conversation) Each(f func(message.Message)) error {
+	for m := range c.replies {
+		if f != nil {
+			f(m)
+		}
+	}
+	return c.Err()
+}
+
+// Collect gets every reply, then returns them along with Err.
+func (c *Conversation) Collect() ([]message.Message, error) {
+	var replies []message.Message
+	err := c.Each(func(m message.Message) { replies = append(replies, m) })
+	return replies, err
+}
+
+// HangUp ends the conversation without an ACK, as when the request couldn't be sent.
+// Only whatever would otherwise route the conversation's replies may call it, and only once.
+func (c *Conversation) HangUp() {
+	close(c.replies)
+}
+
+// finish ends the conversation with the ACK m.
+func (c *Conversation) finish(m message.Message) {
+	c.ack, c.err = core.ParseAckResponse(&m)
+	close(c.replies)
+}
+
+// Router passes messages from a Bifrost server to the Conversations they belong to.
+// Only the goroutine reading from the server should use it.
+type Router struct {
+	// convs maps the tag of each request in flight to its Conversation.
+	convs map[string]*Conversation
+}
+
+// NewRouter makes a Router with no Conversations.
+func NewRouter() *Router {
+	return &Router{convs: make(map[string]*Conversation)}
+}
+
+// Add makes c the Conversation for the request with tag tag, until its ACK.
+func (r *Router) Add(tag string, c *Conversation) {
+	r.convs[tag] = c
+}
+
+// Route passes m to the Conversation for its tag, ending it if m is its ACK, and returns true; if there isn't one, it
+// returns false, and m is the caller's to deal with.
+// If ctx ends while the Conversation's holder isn't reading, Route ends the Conversation without an ACK.
+func (r *Router) Route(ctx context.Context, m message.Message) bool {
+	c, ok := r.convs[m.Tag()]
+	if !ok {
+		return false
+	}
+	if m.Word() == core.RsAck {
+		delete(r.convs, m.Tag())
+		c.finish(m)
+		return true
+	}
+	select {
+	case c.replies <- m:
+	case <-ctx.Done():
+		delete(r.convs, m.Tag())
+		c.HangUp()
+	}
+	return true
+}
+
+// HangUp ends every Conversation still waiting for its ACK, as when the connection drops.
+func (r *Router) HangUp() {
+	for tag, c := range r.convs {
+		delete(r.convs, tag)
+		c.HangUp()
+	}
+}
+
+// Receiver is the interface of sources of Bifrost messages.
+type Receiver interface {
+	// Recv receives the next message, failing if the source has hung up or ctx ends.
+	Recv(ctx context.Context) (*message.Message, error)
+}
+
+// ChanReceiver is a Receiver reading a channel, such as a comm.Endpoint's Rx; closing the channel hangs up.
+type ChanReceiver <-chan message.Message
+
+// Recv receives the next message from c.
+func (c ChanReceiver) Recv(ctx context.Context) (*message.Message, error) {
+	select {
+	case m, ok := <-c:
+		if !ok {
+			return nil, ErrHungUp
+		}
+		return &m, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// ReaderReceiver is a Receiver reading lines from a message.Reader.
+// It can't be interrupted by ctx, so whatever it reads from should have a deadline.
+type ReaderReceiver struct {
+	// R is the reader.
+	R *message.Reader
+}
+
+// Recv reads and parses the next line from r.
+func (r ReaderReceiver) Recv(context.Context) (*message.Message, error) {
+	line, err := r.R.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	return message.NewFromLine(line)
+}
+
+// Converse follows the conversation with tag tag, reading from rx until its ACK arrives, rx fails, or ctx ends.
+// Messages with other tags, such as broadcasts, go to other, which may be nil to ignore them.
+// If rx fails, the conversation's Err is rx's error.
+// The request should already have been sent, and nothing else should read rx until the conversation is over.
+func Converse(ctx context.Context, rx Receiver, tag string, other func(message.Message)) *Conversation {
+	c := NewConversation()
+	r := NewRouter()
+	r.Add(tag, c)
+	go func() {
+		defer r.HangUp()
+		for {
+			m, err := rx.Recv(ctx)
+			if err != nil {
+				c.err = err
+				return
+			}
+			if r.Route(ctx, *m) {
+				if m.Word() == core.RsAck {
+					return
+				}
+				continue
+			}
+			if other != nil {
+				other(*m)
+			}
+		}
+	}()
+	return c
+}
@@ -0,0 +1,94 @@
+package bifrost_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// TestConverse checks that Converse picks out one tag's replies, up to its ACK, from interleaved broadcasts and other
+// conversations.
+func TestConverse(t *testing.T) {
+	rx := make(chan message.Message, 6)
+	rx <- *message.New("!", "MOTD").AddArgs("hello")
+	rx <- *message.New("t1", "FLOADL").AddArgs("0", "a", "/a.mp3")
+	rx <- *message.New("t2", "FLOADL").AddArgs("1", "b", "/b.mp3")
+	rx <- *message.New("t1", "FLOADL").AddArgs("1", "b", "/b.mp3")
+	rx <- *message.New("t1", "ACK").AddArgs("OK", "success")
+	rx <- *message.New("t1", "FLOADL").AddArgs("2", "c", "/c.mp3")
+
+	var others []string
+	conv := bifrost.Converse(context.Background(), bifrost.ChanReceiver(rx), "t1", func(m message.Message) {
+		others = append(others, m.Tag())
+	})
+	replies, err := conv.Collect()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(replies) != 2 || replies[0].Args()[1] != "a" || replies[1].Args()[1] != "b" {
+		t.Errorf("got replies %v, want a and b", replies)
+	}
+	if len(others) != 2 || others[0] != "!" || others[1] != "t2" {
+		t.Errorf("got other tags %v, want ! and t2", others)
+	}
+	if len(rx) != 1 {
+		t.Errorf("conversation read %d messages past its ACK", 1-len(rx))
+	}
+}
+
+// TestConverse_Fail checks that a conversation acknowledged with WHAT fails with an AckError.
+func TestConverse_Fail(t *testing.T) {
+	rx := make(chan message.Message, 1)
+	rx <- *message.New("t1", "ACK").AddArgs("WHAT", "bad index")
+
+	err := bifrost.Converse(context.Background(), bifrost.ChanReceiver(rx), "t1", nil).Each(nil)
+	var aerr bifrost.AckError
+	if !errors.As(err, &aerr) {
+		t.Fatalf("got error %v, want an AckError", err)
+	}
+	if aerr.Ack.Description != "bad index" {
+		t.Errorf("got description %q, want %q", aerr.Ack.Description, "bad index")
+	}
+}
+
+// TestConverse_HungUp checks that a conversation whose connection drops before its ACK fails with ErrHungUp.
+func TestConverse_HungUp(t *testing.T) {
+	rx := make(chan message.Message, 1)
+	rx <- *message.New("t1", "FLOADL").AddArgs("0", "a", "/a.mp3")
+	close(rx)
+
+	replies, err := bifrost.Converse(context.Background(), bifrost.ChanReceiver(rx), "t1", nil).Collect()
+	if !errors.Is(err, bifrost.ErrHungUp) {
+		t.Errorf("got error %v, want ErrHungUp", err)
+	}
+	if len(replies) != 1 {
+		t.Errorf("got %d replies, want 1", len(replies))
+	}
+}
+
+// TestRouter_HangUp checks that hanging up a Router ends the conversations still waiting for their ACKs.
+func TestRouter_HangUp(t *testing.T) {
+	r := bifrost.NewRouter()
+	c1, c2 := bifrost.NewConversation(), bifrost.NewConversation()
+	r.Add("t1", c1)
+	r.Add("t2", c2)
+
+	if !r.Route(context.Background(), *message.New("t1", "ACK").AddArgs("OK", "success")) {
+		t.Fatal("t1's ACK wasn't routed")
+	}
+	if r.Route(context.Background(), *message.New("t3", "ACK").AddArgs("OK", "success")) {
+		t.Error("t3's ACK was routed, but t3 has no conversation")
+	}
+	r.HangUp()
+
+	if err := c1.Each(nil); err != nil {
+		t.Errorf("t1: got error %v, want none", err)
+	}
+	if err := c2.Each(nil); !errors.Is(err, bifrost.ErrHungUp) {
+		t.Errorf("t2: got error %v, want ErrHungUp", err)
+	}
+}
@@ -0,0 +1,91 @@
+package bifrost
+
+// File encoding.go contains checks on the character encoding of messages.
+// Bifrost messages are UTF-8; the bifrost-go tokeniser and packer pass bytes through as they are,
+// so these checks stop malformed sequences from one client reaching every other client in a broadcast.
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+	"golang.org/x/text/unicode/norm"
+)
+
+// EncodingError is the error returned when part of a message isn't valid UTF-8.
+type EncodingError struct {
+	// Pos is the position of the offending argument, counting from 0, or -1 if it is the word.
+	Pos int
+	// Offset is the byte offset of the first invalid sequence in the offending word or argument.
+	Offset int
+}
+
+// Error gets the error message of an EncodingError.
+func (e EncodingError) Error() string {
+	if e.Pos < 0 {
+		return fmt.Sprintf("word is not valid UTF-8 (at byte %d)", e.Offset)
+	}
+	return fmt.Sprintf("argument %d is not valid UTF-8 (at byte %d)", e.Pos+1, e.Offset)
+}
+
+// CheckEncoding checks that m's word and arguments are valid UTF-8, returning an EncodingError if not.
+func CheckEncoding(m message.Message) error {
+	if off := invalidOffset(m.Word()); 0 <= off {
+		return EncodingError{Pos: -1, Offset: off}
+	}
+	for i, a := range m.Args() {
+		if off := invalidOffset(a); 0 <= off {
+			return EncodingError{Pos: i, Offset: off}
+		}
+	}
+	return nil
+}
+
+// invalidOffset gets the byte offset of the first invalid UTF-8 sequence in s, or -1 if there isn't one.
+func invalidOffset(s string) int {
+	for i, r := range s {
+		if r == utf8.RuneError {
+			if _, size := utf8.DecodeRuneInString(s[i:]); size == 1 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Normalise puts m's arguments into Unicode Normalisation Form C, so that visually identical text compares equal.
+// m should already have passed CheckEncoding.
+func Normalise(m message.Message) message.Message {
+	return mapArgs(m, func(a string) string {
+		if norm.NFC.IsNormalString(a) {
+			return a
+		}
+		return norm.NFC.String(a)
+	})
+}
+
+// Sanitise replaces any invalid UTF-8 sequences in m's tag, word, and arguments with the Unicode replacement character.
+func Sanitise(m message.Message) message.Message {
+	if utf8.ValidString(m.Tag()) && utf8.ValidString(m.Word()) && CheckEncoding(m) == nil {
+		return m
+	}
+
+	fix := func(s string) string {
+		return strings.ToValidUTF8(s, string(utf8.RuneError))
+	}
+	out := message.New(fix(m.Tag()), fix(m.Word()))
+	for _, a := range m.Args() {
+		out.AddArgs(fix(a))
+	}
+	return *out
+}
+
+// mapArgs creates a copy of m with f applied to each argument.
+func mapArgs(m message.Message, f func(string) string) message.Message {
+	out := message.New(m.Tag(), m.Word())
+	for _, a := range m.Args() {
+		out.AddArgs(f(a))
+	}
+	return *out
+}
@@ -0,0 +1,40 @@
+package bifrost_test
+
+import (
+	"testing"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// TestCheckEncoding checks that invalid UTF-8 is found and located.
+func TestCheckEncoding(t *testing.T) {
+	ok := message.New("t1", "note").AddArgs("café")
+	if err := bifrost.CheckEncoding(*ok); err != nil {
+		t.Error("unexpected error on valid message:", err)
+	}
+
+	bad := message.New("t1", "inote").AddArgs("0", "abc", "caf\xe9")
+	want := bifrost.EncodingError{Pos: 2, Offset: 3}
+	if err := bifrost.CheckEncoding(*bad); err != want {
+		t.Errorf("got %v, want %v", err, want)
+	}
+}
+
+// TestNormalise checks that arguments are put into NFC.
+func TestNormalise(t *testing.T) {
+	// 'e' followed by a combining acute accent.
+	m := bifrost.Normalise(*message.New("t1", "note").AddArgs("café"))
+	if got := m.Args()[0]; got != "café" {
+		t.Errorf("got %q, want %q", got, "café")
+	}
+}
+
+// TestSanitise checks that invalid sequences are replaced.
+func TestSanitise(t *testing.T) {
+	m := bifrost.Sanitise(*message.New("!", "NOTE").AddArgs("caf\xe9"))
+	if got := m.Args()[0]; got != "caf�" {
+		t.Errorf("got %q, want %q", got, "caf�")
+	}
+}
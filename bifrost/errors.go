@@ -0,0 +1,78 @@
+package bifrost
+
+// File errors.go contains machine-readable error codes, which let clients react to errors without parsing English.
+
+import "errors"
+
+// Coder is the interface of errors that have a machine-readable code.
+type Coder interface {
+	// Code gets the error's code: a short, stable, lowercase word.
+	Code() string
+}
+
+const (
+	// CodeError is the code of errors that don't have a more specific one.
+	CodeError = "error"
+	// CodeArity is the code of ArityErrors.
+	CodeArity = "arity"
+	// CodeArg is the code of ArgErrors.
+	CodeArg = "arg"
+	// CodeEncoding is the code of EncodingErrors.
+	CodeEncoding = "encoding"
+	// CodeSegment is the code of errors in segmenting or reassembling messages.
+	CodeSegment = "segment"
+	// CodeUnknownWord is the code of errors for messages with words the receiver doesn't understand.
+	CodeUnknownWord = "unknown-word"
+)
+
+// CodeOf gets the code of the first error in err's chain that has one, or CodeError if none do.
+func CodeOf(err error) string {
+	var c Coder
+	if errors.As(err, &c) {
+		return c.Code()
+	}
+	return CodeError
+}
+
+// WithCode wraps err so that it has the code code.
+func WithCode(code string, err error) error {
+	return codedError{code: code, err: err}
+}
+
+// codedError is an error wrapped with a code.
+type codedError struct {
+	// code is the error's code.
+	code string
+	// err is the wrapped error.
+	err error
+}
+
+// Error gets the error message of the wrapped error.
+func (e codedError) Error() string {
+	return e.err.Error()
+}
+
+// Code gets the error's code.
+func (e codedError) Code() string {
+	return e.code
+}
+
+// Unwrap gets the wrapped error.
+func (e codedError) Unwrap() error {
+	return e.err
+}
+
+// Code gets the code of an ArityError.
+func (ArityError) Code() string {
+	return CodeArity
+}
+
+// Code gets the code of an ArgError.
+func (ArgError) Code() string {
+	return CodeArg
+}
+
+// Code gets the code of an EncodingError.
+func (EncodingError) Code() string {
+	return CodeEncoding
+}
@@ -0,0 +1,45 @@
+package bifrost_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// TestCodeOf checks that errors get the codes of the first coded errors in their chains.
+func TestCodeOf(t *testing.T) {
+	base := errors.New("oops")
+	cases := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"plain", base, bifrost.CodeError},
+		{"arity", bifrost.ArityError{Got: 1, Min: 2, Max: 2}, bifrost.CodeArity},
+		{"arg", bifrost.ArgError{Pos: 0, Arg: "x", Err: bifrost.ErrNotInt}, bifrost.CodeArg},
+		{"encoding", bifrost.EncodingError{Pos: -1}, bifrost.CodeEncoding},
+		{"segment", bifrost.ErrBadSegment, bifrost.CodeSegment},
+		{"wrapped", fmt.Errorf("context: %w", bifrost.WithCode("custom", base)), "custom"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := bifrost.CodeOf(c.err); got != c.want {
+				t.Errorf("got %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+// TestWithCode checks that coded errors keep their wrapped errors' messages and identities.
+func TestWithCode(t *testing.T) {
+	base := errors.New("oops")
+	err := bifrost.WithCode("custom", base)
+	if err.Error() != base.Error() {
+		t.Errorf("got message %q, want %q", err.Error(), base.Error())
+	}
+	if !errors.Is(err, base) {
+		t.Error("coded error doesn't wrap its error")
+	}
+}
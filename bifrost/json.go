@@ -0,0 +1,78 @@
+package bifrost
+
+// File json.go contains the JSON rendering of Bifrost messages, for scripts that would rather not tokenise lines.
+//
+// Each message becomes one object holding its tag, word, and arguments, as sent.
+// Messages that a ResponseDecoder understands also carry their decoded body, with the name of its type (see
+// MarshalBody), so that scripts get typed fields (numbers as numbers, and so on) without knowing each word's argument
+// order.
+// ACKs are always decoded.
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+)
+
+// ResponseDecoder is the type of functions that decode a message into a typed response body, such as
+// list.ParseBifrostResponse.
+type ResponseDecoder func(m message.Message) (interface{}, error)
+
+// JSONMessage is the JSON representation of a Bifrost message.
+type JSONMessage struct {
+	// Tag is the message's tag.
+	Tag string `json:"tag"`
+	// Word is the message's word.
+	Word string `json:"word"`
+	// Args holds the message's arguments, as sent.
+	Args []string `json:"args"`
+	// Type is the name of the Go type of Body, if the message was decoded.
+	Type string `json:"type,omitempty"`
+	// Body is the decoded body of the message, if it was decoded.
+	Body interface{} `json:"body,omitempty"`
+}
+
+// AckBody is the decoded body of an ACK in a JSONMessage.
+type AckBody struct {
+	// Status is the ACK's status: OK, WHAT, or FAIL.
+	Status string
+	// Description describes the outcome; for failures, it is in the client's error mode.
+	Description string
+}
+
+// ToJSON gets the JSON representation of m, decoding it with decode if it isn't nil.
+func ToJSON(m message.Message, decode ResponseDecoder) JSONMessage {
+	args := m.Args()
+	if args == nil {
+		args = []string{}
+	}
+	jm := JSONMessage{Tag: m.Tag(), Word: m.Word(), Args: args}
+
+	var (
+		body interface{}
+		err  error
+	)
+	switch {
+	case m.Word() == core.RsAck:
+		var ack *core.AckResponse
+		if ack, err = core.ParseAckResponse(&m); err == nil {
+			body = AckBody{Status: ack.Status.String(), Description: ack.Description}
+		}
+	case decode != nil:
+		body, err = decode(m)
+	default:
+		return jm
+	}
+	if err == nil && body != nil {
+		jm.Type, jm.Body = MarshalBody(body)
+	}
+	return jm
+}
+
+// typeName gets the name of the type of v, without its package.
+func typeName(v interface{}) string {
+	name := fmt.Sprintf("%T", v)
+	return name[strings.LastIndex(name, ".")+1:]
+}
@@ -0,0 +1,97 @@
+package bifrost_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// TestToJSON checks that messages render as JSON with their decoded bodies, where there are any.
+func TestToJSON(t *testing.T) {
+	cases := []struct {
+		name   string
+		m      *message.Message
+		decode bifrost.ResponseDecoder
+		want   string
+	}{
+		{
+			"undecoded",
+			message.New("!", "OHAI").AddArgs("bifrost-0.0.0", "yaps"),
+			nil,
+			`{"tag":"!","word":"OHAI","args":["bifrost-0.0.0","yaps"]}`,
+		},
+		{
+			"ack",
+			message.New("t1", "ACK").AddArgs("WHAT", "bad index"),
+			nil,
+			`{"tag":"t1","word":"ACK","args":["WHAT","bad index"],"type":"AckBody","body":{"Status":"WHAT","Description":"bad index"}}`,
+		},
+		{
+			"item",
+			message.New("!", "FLOADL").AddArgs("0", "abc", "/music/a.mp3"),
+			list.ParseBifrostResponse,
+			`{"tag":"!","word":"FLOADL","args":["0","abc","/music/a.mp3"],"type":"ItemResponse","body":{"Index":0,"Item":{"Hash":"abc","Type":"track","Payload":"/music/a.mp3"}}}`,
+		},
+		{
+			"automode",
+			message.New("!", "AUTO").AddArgs("shuffle"),
+			list.ParseBifrostResponse,
+			`{"tag":"!","word":"AUTO","args":["shuffle"],"type":"AutoModeResponse","body":{"AutoMode":"shuffle"}}`,
+		},
+		{
+			"registered",
+			message.New("!", "DRIFT").AddArgs("1500"),
+			list.ParseBifrostResponse,
+			`{"tag":"!","word":"DRIFT","args":["1500"],"type":"DriftResponse","body":{"Drift":"1.5s"}}`,
+		},
+		{
+			"unknown to decoder",
+			message.New("!", "MOTD").AddArgs("hello"),
+			list.ParseBifrostResponse,
+			`{"tag":"!","word":"MOTD","args":["hello"]}`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			bs, err := json.Marshal(bifrost.ToJSON(*c.m, c.decode))
+			if err != nil {
+				t.Fatalf("marshal failed: %v", err)
+			}
+			if got := string(bs); got != c.want {
+				t.Errorf("got %s, want %s", got, c.want)
+			}
+		})
+	}
+}
+
+// TestMarshalBody checks that registered bodies marshal through their registered representations, and others as
+// themselves.
+func TestMarshalBody(t *testing.T) {
+	cases := []struct {
+		name  string
+		rbody interface{}
+		want  string
+	}{
+		{"done", controller.DoneResponse{}, `DoneResponse {}`},
+		{"failed", controller.DoneResponse{Err: errors.New("oops")}, `DoneResponse {"Error":"oops"}`},
+		{"unregistered", list.SelectResponse{Index: 1, Hash: "abc"}, `SelectResponse {"Index":1,"Hash":"abc"}`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			name, v := bifrost.MarshalBody(c.rbody)
+			bs, err := json.Marshal(v)
+			if err != nil {
+				t.Fatalf("marshal failed: %v", err)
+			}
+			if got := name + " " + string(bs); got != c.want {
+				t.Errorf("got %s, want %s", got, c.want)
+			}
+		})
+	}
+}
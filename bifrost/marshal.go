@@ -0,0 +1,69 @@
+package bifrost
+
+// File marshal.go contains the registry of JSON representations of response bodies.
+//
+// Everything that shows response bodies outside Bifrost, such as ToJSON, goes through the registry, so each body type
+// needs registering once, in the package that defines it, rather than once per output.
+// Most bodies marshal well as they are, and need no registration; those that don't (durations that would come out as
+// nanoseconds, errors that would come out as empty objects, and so on) register a function giving a representation
+// that does.
+// There are no protobuf representations, as nothing in yaps speaks protobuf yet.
+
+import (
+	"reflect"
+	"sync"
+)
+
+// Marshaller is the type of functions that turn a response body into the value that encoding/json marshals in its
+// place.
+type Marshaller func(rbody interface{}) interface{}
+
+// registration is the registered name and representation of a response body type.
+type registration struct {
+	// name is the name of the type in JSON output.
+	name string
+	// marshal, if not nil, gets the JSON representation of a body of the type.
+	marshal Marshaller
+}
+
+var (
+	// registryMu guards registry.
+	registryMu sync.RWMutex
+	// registry maps response body types to their registrations.
+	registry = make(map[reflect.Type]registration)
+)
+
+// RegisterJSON registers name as the JSON name of response bodies of type T, and marshal as the function giving their
+// JSON representation; if marshal is nil, bodies represent themselves.
+// It panics if T is already registered, as that is a programming error.
+func RegisterJSON[T any](name string, marshal func(T) interface{}) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+
+	reg := registration{name: name}
+	if marshal != nil {
+		reg.marshal = func(rbody interface{}) interface{} { return marshal(rbody.(T)) }
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, ok := registry[t]; ok {
+		panic("bifrost: JSON registered twice for type " + t.String())
+	}
+	registry[t] = reg
+}
+
+// MarshalBody gets the JSON name and representation of the response body rbody.
+// Unregistered bodies are named after their Go types, without packages, and represent themselves.
+func MarshalBody(rbody interface{}) (name string, v interface{}) {
+	registryMu.RLock()
+	reg, ok := registry[reflect.TypeOf(rbody)]
+	registryMu.RUnlock()
+
+	if !ok {
+		return typeName(rbody), rbody
+	}
+	if reg.marshal == nil {
+		return reg.name, rbody
+	}
+	return reg.name, reg.marshal(rbody)
+}
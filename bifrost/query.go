@@ -0,0 +1,243 @@
+package bifrost
+
+// File query.go contains QueryOptions, the paging, sorting, and filtering options shared by requests that return a
+// series of results, such as 'rdump', 'find', 'history', and 'clients'.
+//
+// Options go at the end of a request, after its own arguments, as 'key=value' arguments in any order:
+//
+//	offset=N          skips the first N results;
+//	limit=N           sends at most N results;
+//	sort=FIELD        sorts by FIELD, or in descending order with sort=-FIELD;
+//	filter=FIELD:TEXT keeps results whose FIELD is TEXT, ignoring case;
+//	filter=FIELD~TEXT keeps results whose FIELD contains TEXT, ignoring case.
+//
+// A request may have many filters, and results must pass all of them.
+// Filtering happens first, then sorting, then paging.
+// Each request documents the fields it can sort and filter on.
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	// QueryOffset is the key of the offset query option.
+	QueryOffset = "offset"
+	// QueryLimit is the key of the limit query option.
+	QueryLimit = "limit"
+	// QuerySort is the key of the sort query option.
+	QuerySort = "sort"
+	// QueryFilter is the key of the filter query option.
+	QueryFilter = "filter"
+)
+
+var (
+	// ErrNegative is the reason given for query options that should be, but aren't, non-negative.
+	ErrNegative = errors.New("must not be negative")
+	// ErrUnknownField is the reason given for query options naming a field the request doesn't have.
+	ErrUnknownField = errors.New("unknown field")
+	// ErrBadFilter is the reason given for filters that are neither FIELD:TEXT nor FIELD~TEXT.
+	ErrBadFilter = errors.New("filter must be FIELD:TEXT or FIELD~TEXT")
+)
+
+// QueryOptions holds the options common to requests that return a series of results.
+// The zero QueryOptions sends every result, in the request's natural order.
+type QueryOptions struct {
+	// Offset is the number of results to skip.
+	Offset int
+	// Limit is the maximum number of results to send; 0 means no limit.
+	Limit int
+	// Sort is the field to sort results by; empty means the request's natural order.
+	Sort string
+	// Descending is true if results sort in descending order of Sort.
+	Descending bool
+	// Filters are the filters results must pass.
+	Filters []Filter
+}
+
+// Filter is one filter in a QueryOptions.
+type Filter struct {
+	// Field is the field the filter looks at.
+	Field string
+	// Text is the text the filter looks for, ignoring case.
+	Text string
+	// Contains is true if the field need only contain Text, rather than be it.
+	Contains bool
+}
+
+// String gets the argument form of f, without the 'filter=' key.
+func (f Filter) String() string {
+	op := ":"
+	if f.Contains {
+		op = "~"
+	}
+	return f.Field + op + f.Text
+}
+
+// Matches checks whether the field value v passes f.
+func (f Filter) Matches(v string) bool {
+	if f.Contains {
+		return strings.Contains(strings.ToLower(v), strings.ToLower(f.Text))
+	}
+	return strings.EqualFold(v, f.Text)
+}
+
+// SplitQuery splits any query options off the end of the message arguments args, given that the results can be
+// sorted and filtered by fields.
+// It returns the arguments before the options, and the options.
+func SplitQuery(args []string, fields ...string) ([]string, QueryOptions, error) {
+	var q QueryOptions
+
+	n := len(args)
+	for 0 < n && isQueryOption(args[n-1]) {
+		n--
+	}
+
+	for i := n; i < len(args); i++ {
+		if err := q.parseOption(args[i], fields); err != nil {
+			return nil, QueryOptions{}, ArgError{Pos: i, Arg: args[i], Err: err}
+		}
+	}
+	return args[:n], q, nil
+}
+
+// isQueryOption checks whether arg looks like a query option.
+func isQueryOption(arg string) bool {
+	key, _, ok := strings.Cut(arg, "=")
+	if !ok {
+		return false
+	}
+	switch key {
+	case QueryOffset, QueryLimit, QuerySort, QueryFilter:
+		return true
+	default:
+		return false
+	}
+}
+
+// parseOption parses the query option arg into q, checking any field it names against fields.
+func (q *QueryOptions) parseOption(arg string, fields []string) error {
+	key, val, _ := strings.Cut(arg, "=")
+	switch key {
+	case QueryOffset:
+		return parseCount(val, &q.Offset)
+	case QueryLimit:
+		return parseCount(val, &q.Limit)
+	case QuerySort:
+		q.Descending = strings.HasPrefix(val, "-")
+		q.Sort = strings.TrimPrefix(val, "-")
+		return checkField(q.Sort, fields)
+	default:
+		i := strings.IndexAny(val, ":~")
+		if i <= 0 {
+			return ErrBadFilter
+		}
+		f := Filter{Field: val[:i], Text: val[i+1:], Contains: val[i] == '~'}
+		q.Filters = append(q.Filters, f)
+		return checkField(f.Field, fields)
+	}
+}
+
+// parseCount parses the non-negative integer s into dst.
+func parseCount(s string, dst *int) error {
+	x, err := strconv.Atoi(s)
+	if err != nil {
+		return ErrNotInt
+	}
+	if x < 0 {
+		return ErrNegative
+	}
+	*dst = x
+	return nil
+}
+
+// checkField checks that field is one of fields.
+func checkField(field string, fields []string) error {
+	for _, f := range fields {
+		if f == field {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrUnknownField, field)
+}
+
+// Args gets the message arguments that stand for q, in the order SplitQuery reads them.
+func (q QueryOptions) Args() []string {
+	var args []string
+	for _, f := range q.Filters {
+		args = append(args, QueryFilter+"="+f.String())
+	}
+	if q.Sort != "" {
+		s := q.Sort
+		if q.Descending {
+			s = "-" + s
+		}
+		args = append(args, QuerySort+"="+s)
+	}
+	if q.Offset != 0 {
+		args = append(args, QueryOffset+"="+strconv.Itoa(q.Offset))
+	}
+	if q.Limit != 0 {
+		args = append(args, QueryLimit+"="+strconv.Itoa(q.Limit))
+	}
+	return args
+}
+
+// Queryable is the interface of results that QueryOptions can sort and filter.
+type Queryable interface {
+	// QueryField gets the value of the field called name, as it would appear in a message.
+	QueryField(name string) string
+}
+
+// ApplyQuery filters, sorts, and pages rs according to q, returning the results to send.
+// Fields that are both integers sort numerically; others sort as strings.
+func ApplyQuery[T Queryable](q QueryOptions, rs []T) []T {
+	out := make([]T, 0, len(rs))
+	for _, r := range rs {
+		if q.passes(r) {
+			out = append(out, r)
+		}
+	}
+
+	if q.Sort != "" {
+		sort.SliceStable(out, func(i, j int) bool {
+			a, b := out[i].QueryField(q.Sort), out[j].QueryField(q.Sort)
+			if q.Descending {
+				a, b = b, a
+			}
+			return lessField(a, b)
+		})
+	}
+
+	if len(out) <= q.Offset {
+		return nil
+	}
+	out = out[q.Offset:]
+	if 0 < q.Limit && q.Limit < len(out) {
+		out = out[:q.Limit]
+	}
+	return out
+}
+
+// passes checks whether r passes every filter in q.
+func (q QueryOptions) passes(r Queryable) bool {
+	for _, f := range q.Filters {
+		if !f.Matches(r.QueryField(f.Field)) {
+			return false
+		}
+	}
+	return true
+}
+
+// lessField checks whether field value a sorts before field value b.
+func lessField(a, b string) bool {
+	x, xerr := strconv.ParseInt(a, 10, 64)
+	y, yerr := strconv.ParseInt(b, 10, 64)
+	if xerr == nil && yerr == nil {
+		return x < y
+	}
+	return a < b
+}
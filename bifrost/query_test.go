@@ -0,0 +1,90 @@
+package bifrost_test
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// track is a result with a name and a length, for testing queries.
+type track struct {
+	name   string
+	length int
+}
+
+func (t track) QueryField(name string) string {
+	switch name {
+	case "name":
+		return t.name
+	case "length":
+		return strconv.Itoa(t.length)
+	default:
+		return ""
+	}
+}
+
+func ExampleApplyQuery() {
+	args, opts, err := bifrost.SplitQuery([]string{"0", "10", "filter=name~a", "sort=-length", "limit=2"}, "name", "length")
+	fmt.Println(args, err)
+
+	ts := []track{{"alpha", 9}, {"beta", 10}, {"gamma", 100}, {"delta", 50}, {"epsilon", 70}}
+	fmt.Println(bifrost.ApplyQuery(opts, ts))
+
+	// Output:
+	// [0 10] <nil>
+	// [{gamma 100} {delta 50}]
+}
+
+// TestSplitQuery_Errors checks that malformed query options are rejected with the position of the bad argument.
+func TestSplitQuery_Errors(t *testing.T) {
+	cases := map[string]struct {
+		args []string
+		want error
+	}{
+		"bad offset":    {[]string{"x", "offset=one"}, bifrost.ErrNotInt},
+		"negative":      {[]string{"x", "limit=-1"}, bifrost.ErrNegative},
+		"unknown sort":  {[]string{"x", "sort=colour"}, bifrost.ErrUnknownField},
+		"unknown field": {[]string{"x", "filter=colour:red"}, bifrost.ErrUnknownField},
+		"bad filter":    {[]string{"x", "filter=name"}, bifrost.ErrBadFilter},
+	}
+	for name, c := range cases {
+		_, _, err := bifrost.SplitQuery(c.args, "name", "length")
+		var aerr bifrost.ArgError
+		if !errors.As(err, &aerr) || aerr.Pos != 1 || !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want an argument 2 error of %v", name, err, c.want)
+		}
+	}
+}
+
+// TestQueryOptions_Args checks that query options survive a round trip through message arguments.
+func TestQueryOptions_Args(t *testing.T) {
+	want := bifrost.QueryOptions{
+		Offset:     3,
+		Limit:      5,
+		Sort:       "length",
+		Descending: true,
+		Filters:    []bifrost.Filter{{Field: "name", Text: "a"}, {Field: "name", Text: "b", Contains: true}},
+	}
+	args, got, err := bifrost.SplitQuery(append([]string{"x"}, want.Args()...), "name", "length")
+	if err != nil {
+		t.Fatal("couldn't split query:", err)
+	}
+	if !reflect.DeepEqual(args, []string{"x"}) || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v and %+v, want [x] and %+v", args, got, want)
+	}
+}
+
+// TestApplyQuery_Paging checks that paging past the results sends none.
+func TestApplyQuery_Paging(t *testing.T) {
+	ts := []track{{"alpha", 9}, {"beta", 10}}
+	if got := bifrost.ApplyQuery(bifrost.QueryOptions{Offset: 2}, ts); len(got) != 0 {
+		t.Errorf("offset at end: got %v, want nothing", got)
+	}
+	if got := bifrost.ApplyQuery(bifrost.QueryOptions{Offset: 1, Limit: 5}, ts); !reflect.DeepEqual(got, ts[1:]) {
+		t.Errorf("offset 1: got %v, want %v", got, ts[1:])
+	}
+}
@@ -0,0 +1,170 @@
+package bifrost
+
+// File segment.go contains segmentation of long messages into several shorter lines.
+//
+// A segmented message is sent as one or more segment messages, each with the original message's tag:
+//
+//	tag SEG more <chunk>
+//	...
+//	tag SEG last <chunk>
+//
+// Concatenating the chunks gives the original message's packed line, without its trailing newline.
+// Clients send segmented requests in the same way, using the word 'seg'.
+// Servers only segment their messages once a client asks them to with 'segsize <max>'.
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+)
+
+const (
+	// RsSeg is the word of segment responses.
+	RsSeg = "SEG"
+	// RqSeg is the word of segment requests.
+	RqSeg = "seg"
+	// RqSegSize is the word of requests setting the longest line a client wants to receive.
+	RqSegSize = "segsize"
+	// SegMore is the segment flag for segments with more to follow.
+	SegMore = "more"
+	// SegLast is the segment flag for the final segment of a message.
+	SegLast = "last"
+
+	// MinSegmentSize is the smallest line length that segmentation supports.
+	MinSegmentSize = 64
+	// MaxReassembledSize is the largest message, in bytes, that a Reassembler will rebuild.
+	MaxReassembledSize = 1 << 20
+)
+
+var (
+	// ErrSegmentSizeTooSmall is the error returned when asked to segment into lines shorter than MinSegmentSize.
+	ErrSegmentSizeTooSmall = WithCode(CodeSegment, fmt.Errorf("segment size must be at least %d", MinSegmentSize))
+	// ErrReassembledTooLarge is the error returned when a segmented message grows past MaxReassembledSize.
+	ErrReassembledTooLarge = WithCode(CodeSegment, fmt.Errorf("segmented message is larger than %d bytes", MaxReassembledSize))
+	// ErrBadSegment is the error returned when a segment message isn't well-formed.
+	ErrBadSegment = WithCode(CodeSegment, errors.New("bad segment"))
+	// ErrSegmentTagMismatch is the error returned when a segment's tag isn't that of the segmented message in progress.
+	ErrSegmentTagMismatch = WithCode(CodeSegment, errors.New("segment tag doesn't match the segmented message in progress"))
+)
+
+// Segment packs m and, if the packed line is longer than max bytes including its newline,
+// splits it into segment messages whose lines are each no longer than max.
+// Messages that already fit come back unchanged, as the only element.
+func Segment(m message.Message, max int) ([]message.Message, error) {
+	packed, err := m.Pack()
+	if err != nil {
+		return nil, err
+	}
+	if len(packed) <= max {
+		return []message.Message{m}, nil
+	}
+	if max < MinSegmentSize {
+		return nil, ErrSegmentSizeTooSmall
+	}
+
+	line := bytes.TrimSuffix(packed, []byte("\n"))
+	var segs []message.Message
+	for 0 < len(line) {
+		seg, n, err := nextSegment(m.Tag(), line, max)
+		if err != nil {
+			return nil, err
+		}
+		segs = append(segs, seg)
+		line = line[n:]
+	}
+	return segs, nil
+}
+
+// nextSegment makes the segment message, with tag tag, carrying as much of the start of line as fits in max bytes.
+// It returns the segment and the number of bytes of line it carries.
+func nextSegment(tag string, line []byte, max int) (message.Message, int, error) {
+	// The chunk can't be longer than the segment, so that's a good first guess.
+	n := max
+	for {
+		n = runeBoundary(line, n)
+		if n == 0 {
+			return message.Message{}, 0, ErrSegmentSizeTooSmall
+		}
+
+		flag := SegMore
+		if n == len(line) {
+			flag = SegLast
+		}
+		seg := message.New(tag, RsSeg).AddArgs(flag, string(line[:n]))
+
+		packed, err := seg.Pack()
+		if err != nil {
+			return message.Message{}, 0, err
+		}
+		if len(packed) <= max {
+			return *seg, n, nil
+		}
+		// Quoting may expand the chunk, so shrink it in proportion and try again.
+		if shrunk := n * max / len(packed); shrunk < n {
+			n = shrunk
+		} else {
+			n--
+		}
+	}
+}
+
+// runeBoundary gets the largest index, no greater than n, that doesn't split a UTF-8 sequence in b.
+func runeBoundary(b []byte, n int) int {
+	if n <= 0 {
+		return 0
+	}
+	if len(b) <= n {
+		return len(b)
+	}
+	for 0 < n && !utf8.RuneStart(b[n]) {
+		n--
+	}
+	return n
+}
+
+// Reassembler rebuilds segmented messages from their segments.
+// It rebuilds one message at a time, so a message's segments can't be interleaved with those of another.
+// The zero Reassembler is ready to use.
+type Reassembler struct {
+	// buf holds the chunks received so far.
+	buf bytes.Buffer
+	// tag is the tag of the message being reassembled, if buf isn't empty.
+	tag string
+}
+
+// Add adds the segment message seg, with arguments flag and chunk.
+// Once it has the last segment of a message, it returns that message; otherwise, it returns nil.
+// On error, any partially reassembled message is discarded.
+func (r *Reassembler) Add(seg message.Message) (*message.Message, error) {
+	args := seg.Args()
+	if len(args) != 2 || (args[0] != SegMore && args[0] != SegLast) {
+		r.buf.Reset()
+		return nil, ErrBadSegment
+	}
+	if MaxReassembledSize < r.buf.Len()+len(args[1]) {
+		r.buf.Reset()
+		return nil, ErrReassembledTooLarge
+	}
+	if 0 < r.buf.Len() && seg.Tag() != r.tag {
+		r.buf.Reset()
+		return nil, ErrSegmentTagMismatch
+	}
+
+	r.tag = seg.Tag()
+	r.buf.WriteString(args[1])
+	if args[0] == SegMore {
+		return nil, nil
+	}
+
+	r.buf.WriteByte('\n')
+	defer r.buf.Reset()
+
+	_, lineok, line := message.NewTokeniser().TokeniseBytes(r.buf.Bytes())
+	if !lineok {
+		return nil, ErrBadSegment
+	}
+	return message.NewFromLine(line)
+}
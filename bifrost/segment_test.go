@@ -0,0 +1,83 @@
+package bifrost_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// TestSegment_RoundTrip checks that segmenting and reassembling a long message gives back the original.
+func TestSegment_RoundTrip(t *testing.T) {
+	long := strings.Repeat("a quite long path with 'quotes' and ünïcödé/", 40) + strings.Repeat("'", 100)
+	m := message.New("t1", "floadl").AddArgs("0", "abc", long)
+
+	const max = 80
+	segs, err := bifrost.Segment(*m, max)
+	if err != nil {
+		t.Fatal("unexpected error segmenting:", err)
+	}
+	if len(segs) < 2 {
+		t.Fatalf("got %d segments, want several", len(segs))
+	}
+
+	var r bifrost.Reassembler
+	var got *message.Message
+	for i, s := range segs {
+		packed, err := s.Pack()
+		if err != nil {
+			t.Fatal("unexpected error packing segment:", err)
+		}
+		if max < len(packed) {
+			t.Errorf("segment %d is %d bytes, want at most %d", i, len(packed), max)
+		}
+		if s.Tag() != "t1" {
+			t.Errorf("segment %d has tag %q, want t1", i, s.Tag())
+		}
+
+		if got, err = r.Add(s); err != nil {
+			t.Fatal("unexpected error reassembling:", err)
+		}
+		if (got != nil) != (i == len(segs)-1) {
+			t.Errorf("segment %d: got message %v early or late", i, got)
+		}
+	}
+
+	if got == nil || got.String() != m.String() {
+		t.Errorf("reassembled %v, want %v", got, m)
+	}
+}
+
+// TestSegment_Short checks that messages that fit aren't segmented.
+func TestSegment_Short(t *testing.T) {
+	m := message.New("t1", "sel").AddArgs("0", "abc")
+	segs, err := bifrost.Segment(*m, bifrost.MinSegmentSize)
+	if err != nil {
+		t.Fatal("unexpected error segmenting:", err)
+	}
+	if len(segs) != 1 || segs[0].String() != m.String() {
+		t.Errorf("got %v, want just %v", segs, m)
+	}
+}
+
+// TestReassembler_Add_tagMismatch checks that a Reassembler refuses a segment from another message part-way through
+// one, and then starts afresh.
+func TestReassembler_Add_tagMismatch(t *testing.T) {
+	var r bifrost.Reassembler
+	if _, err := r.Add(*message.New("t1", bifrost.RqSeg).AddArgs(bifrost.SegMore, "t1 floa")); err != nil {
+		t.Fatal("unexpected error adding first segment:", err)
+	}
+	if _, err := r.Add(*message.New("t2", bifrost.RqSeg).AddArgs(bifrost.SegLast, "dl 0 abc x")); err != bifrost.ErrSegmentTagMismatch {
+		t.Errorf("segment with another tag: got error %v, want %v", err, bifrost.ErrSegmentTagMismatch)
+	}
+
+	got, err := r.Add(*message.New("t3", bifrost.RqSeg).AddArgs(bifrost.SegLast, "t3 sel 0 abc"))
+	if err != nil {
+		t.Fatal("unexpected error after mismatch:", err)
+	}
+	if want := message.New("t3", "sel").AddArgs("0", "abc"); got == nil || got.String() != want.String() {
+		t.Errorf("after mismatch, reassembled %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+// File doc.go contains the Markdown documentation generator.
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// GenerateDoc generates Markdown documentation for protocol p.
+func GenerateDoc(p *Protocol) []byte {
+	var out bytes.Buffer
+
+	fmt.Fprintf(&out, "# `%s` protocol\n\n", p.Role)
+	fmt.Fprintf(&out, "<!-- Code generated by bifrostgen; DO NOT EDIT. -->\n\n")
+	fmt.Fprintf(&out, "This file lists the Bifrost messages specific to the `%s` role.\n", p.Role)
+	fmt.Fprintf(&out, "Optional arguments are in brackets; arguments may be `-` where noted.\n\n")
+
+	fmt.Fprintf(&out, "## Requests\n\n")
+	for _, m := range p.Requests {
+		genMessageDoc(&out, m)
+	}
+
+	fmt.Fprintf(&out, "## Responses\n\n")
+	for _, m := range p.Responses {
+		if m.Word != "" {
+			genMessageDoc(&out, m)
+		}
+	}
+
+	return out.Bytes()
+}
+
+// genMessageDoc writes the documentation for message m to out.
+func genMessageDoc(out *bytes.Buffer, m Message) {
+	usage := []string{m.Word}
+	for _, a := range m.Args {
+		name := strings.ToLower(a.Name)
+		if a.Optional {
+			name = "[" + name + "]"
+		}
+		usage = append(usage, name)
+	}
+	if m.Versioned {
+		usage = append(usage, "[version]")
+	}
+	if len(m.Query) != 0 {
+		usage = append(usage, "[option=value...]")
+	}
+
+	fmt.Fprintf(out, "### `%s`\n\n%s\n\n", strings.Join(usage, " "), m.Doc)
+	if len(m.Replies) != 0 {
+		fmt.Fprintf(out, "Replies with `%s`.\n\n", strings.Join(m.Replies, "`, `"))
+	}
+	if len(m.Args) == 0 && !m.Versioned && len(m.Query) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "| Argument | Type | Description |\n|---|---|---|\n")
+	for _, a := range m.Args {
+		doc := a.Doc
+		if a.Zero != "" {
+			doc += fmt.Sprintf(" `%s` for none.", a.Zero)
+		}
+		fmt.Fprintf(out, "| %s | %s | %s |\n", strings.ToLower(a.Name), argTypes[a.Type].doc, doc)
+	}
+	if m.Versioned {
+		fmt.Fprintf(out, "| version | %s | If given, the request fails unless the list is at this version. |\n", argTypes["uint"].doc)
+	}
+	if len(m.Query) != 0 {
+		fmt.Fprintf(out, "| option=value | query options | Any of `offset=N`, `limit=N`, `sort=[-]FIELD`, `filter=FIELD:TEXT`, and `filter=FIELD~TEXT`, on the fields `%s`. |\n", strings.Join(m.Query, "`, `"))
+	}
+	fmt.Fprintln(out)
+}
@@ -0,0 +1,346 @@
+package main
+
+// File gen.go contains the Go code generator.
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+)
+
+// GenerateGo generates the Go parsers, emitters, and dispatchers for protocol p.
+func GenerateGo(p *Protocol) ([]byte, error) {
+	var body bytes.Buffer
+	g := &goGen{w: &body, imports: map[string]bool{"fmt": true}}
+
+	g.genWords(p)
+	g.genRequestDispatch(p)
+	g.genVersionedArity(p)
+	g.genResponseDispatch(p)
+	g.genEmitDispatch(p)
+	g.genSchema(p)
+
+	for _, m := range p.Requests {
+		if !m.Custom {
+			g.genParser(parserName(m.Word, "Message"), "rq", m)
+		}
+	}
+	for _, m := range p.Responses {
+		if !m.Custom && m.Word != "" {
+			g.genParser(parserName(m.Word, "Response"), "r", m)
+		}
+	}
+	for _, m := range p.Responses {
+		if !m.Custom {
+			g.genEmitter(m)
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintln(&out, "// Code generated by bifrostgen; DO NOT EDIT.")
+	fmt.Fprintln(&out)
+	fmt.Fprintf(&out, "package %s\n\n", p.Package)
+	g.genImports(&out)
+	out.Write(body.Bytes())
+
+	return format.Source(out.Bytes())
+}
+
+// goGen holds the state of a Go code generator.
+type goGen struct {
+	// w is the writer receiving the generated declarations.
+	w *bytes.Buffer
+	// imports is the set of packages the generated declarations use.
+	imports map[string]bool
+}
+
+// printf writes formatted output to the generator.
+func (g *goGen) printf(format string, args ...interface{}) {
+	fmt.Fprintf(g.w, format, args...)
+}
+
+// localPrefix is the import path prefix of yaps's own packages.
+const localPrefix = "github.com/MattWindsor91/yaps/"
+
+// genImports writes the import block for the packages g has used.
+// Like the rest of yaps, it groups standard, third-party, and yaps imports separately.
+func (g *goGen) genImports(out *bytes.Buffer) {
+	groups := make([][]string, 3)
+	for imp := range g.imports {
+		switch {
+		case strings.HasPrefix(imp, localPrefix):
+			groups[2] = append(groups[2], imp)
+		case strings.Contains(imp, "."):
+			groups[1] = append(groups[1], imp)
+		default:
+			groups[0] = append(groups[0], imp)
+		}
+	}
+
+	fmt.Fprintln(out, "import (")
+	sep := false
+	for _, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		if sep {
+			fmt.Fprintln(out)
+		}
+		sep = true
+
+		sort.Strings(group)
+		for _, imp := range group {
+			fmt.Fprintf(out, "\t%q\n", imp)
+		}
+	}
+	fmt.Fprintln(out, ")")
+	fmt.Fprintln(out)
+}
+
+// genWords generates the constants naming the request and response words, which the rest of the generated code, and
+// hand-written code, use instead of spelling words out.
+func (g *goGen) genWords(p *Protocol) {
+	g.printf("// Words of the %s requests.\n", p.Role)
+	g.printf("const (\n")
+	for _, m := range p.Requests {
+		g.printf("// %s is the word of '%s' requests.\n%s = %q\n", wordName("Rq", m.Word), m.Word, wordName("Rq", m.Word), m.Word)
+	}
+	g.printf(")\n\n")
+	g.printf("// Words of the %s responses.\n", p.Role)
+	g.printf("const (\n")
+	for _, m := range p.Responses {
+		if m.Word != "" {
+			g.printf("// %s is the word of '%s' responses.\n%s = %q\n", wordName("Rs", m.Word), m.Word, wordName("Rs", m.Word), m.Word)
+		}
+	}
+	g.printf(")\n\n")
+}
+
+// genRequestDispatch generates parseRequest, which dispatches request words to their parsers.
+func (g *goGen) genRequestDispatch(p *Protocol) {
+	g.imports[localPrefix+"controller"] = true
+
+	g.printf("// parseRequest parses a %s request message with word word and arguments args.\n", p.Role)
+	g.printf("func parseRequest(word string, args []string) (interface{}, error) {\n")
+	g.printf("switch word {\n")
+	for _, m := range p.Requests {
+		g.printf("case %s:\nreturn %s(args)\n", wordName("Rq", m.Word), parserName(m.Word, "Message"))
+	}
+	g.printf("default:\nreturn nil, controller.UnknownWord(word)\n}\n}\n\n")
+}
+
+// genVersionedArity generates versionedArity, which maps words that may take a version to their arity without one.
+func (g *goGen) genVersionedArity(p *Protocol) {
+	g.printf("// versionedArity maps each word that changes a %s to its arity without a version.\n", p.Role)
+	g.printf("// These words may take the %s version as an extra, final argument; see VersionedRequest.\n", p.Role)
+	g.printf("var versionedArity = map[string]int{\n")
+	for _, m := range p.Requests {
+		if m.Versioned {
+			_, max := m.arity()
+			g.printf("%s: %d,\n", wordName("Rq", m.Word), max)
+		}
+	}
+	g.printf("}\n\n")
+}
+
+// genResponseDispatch generates parseResponse, which dispatches response words to their parsers.
+func (g *goGen) genResponseDispatch(p *Protocol) {
+	g.imports[localPrefix+"bifrost"] = true
+
+	g.printf("// parseResponse parses a %s response message with word word and arguments args.\n", p.Role)
+	g.printf("func parseResponse(word string, args []string) (interface{}, error) {\n")
+	g.printf("switch word {\n")
+	for _, m := range p.Responses {
+		if m.Word != "" {
+			g.printf("case %s:\nreturn %s(args)\n", wordName("Rs", m.Word), parserName(m.Word, "Response"))
+		}
+	}
+	g.printf("default:\nreturn nil, bifrost.WithCode(bifrost.CodeUnknownWord, fmt.Errorf(\"unknown %s response word: %%s\", word))\n}\n}\n\n", p.Role)
+}
+
+// genEmitDispatch generates emitResponse, which dispatches response bodies to their emitters.
+func (g *goGen) genEmitDispatch(p *Protocol) {
+	g.imports["github.com/UniversityRadioYork/bifrost-go/message"] = true
+
+	g.printf("// emitResponse converts a %s response body rbody into messages with tag tag, sending them to msgTx.\n", p.Role)
+	g.printf("func emitResponse(tag string, rbody interface{}, msgTx chan<- message.Message) error {\n")
+	g.printf("switch r := rbody.(type) {\n")
+	seen := map[string]bool{}
+	for _, m := range p.Responses {
+		if seen[m.Type] {
+			continue
+		}
+		seen[m.Type] = true
+		g.printf("case %s:\nreturn %s(tag, r, msgTx)\n", m.Type, emitterName(m.Type))
+	}
+	g.printf("default:\nreturn fmt.Errorf(\"response with no message equivalent: %%v\", r)\n}\n}\n\n")
+}
+
+// genSchema generates bifrostSchema, which describes the messages for 'describe'.
+func (g *goGen) genSchema(p *Protocol) {
+	g.printf("// bifrostSchema describes the %s requests and responses, for 'describe'.\n", p.Role)
+	g.printf("var bifrostSchema = controller.Schema{\n")
+	g.printf("Role: %q,\n", p.Role)
+	g.printf("Requests: []controller.WordSchema{\n")
+	for _, m := range p.Requests {
+		g.genWordSchema("Rq", m)
+	}
+	g.printf("},\nResponses: []controller.WordSchema{\n")
+	for _, m := range p.Responses {
+		if m.Word != "" {
+			g.genWordSchema("Rs", m)
+		}
+	}
+	g.printf("},\n}\n\n")
+}
+
+// genWordSchema generates the schema of message m, whose word constant has prefix prefix ("Rq" or "Rs").
+func (g *goGen) genWordSchema(prefix string, m Message) {
+	g.printf("{\nWord: %s,\nDoc: %q,\n", wordName(prefix, m.Word), m.Doc)
+	if len(m.Args) != 0 {
+		g.printf("Args: []controller.ArgSchema{\n")
+		for _, a := range m.Args {
+			g.printf("{Name: %q, Type: %q, Doc: %q", a.Name, a.Type, a.Doc)
+			if a.Optional {
+				g.printf(", Optional: true")
+			}
+			g.printf("},\n")
+		}
+		g.printf("},\n")
+	}
+	if m.Versioned {
+		g.printf("Versioned: true,\n")
+	}
+	if len(m.Replies) != 0 {
+		g.printf("Replies: []string{")
+		for i, r := range m.Replies {
+			if i != 0 {
+				g.printf(", ")
+			}
+			g.printf("%s", wordName("Rs", r))
+		}
+		g.printf("},\n")
+	}
+	g.printf("},\n")
+}
+
+// genParser generates a parser called name for message m, building its result in a variable called v.
+func (g *goGen) genParser(name, v string, m Message) {
+	g.imports[localPrefix+"bifrost"] = true
+
+	g.printf("// %s tries to parse %s '%s' message.\n", name, article(m.Word), m.Word)
+	g.printf("func %s(args []string) (interface{}, error) {\n", name)
+	g.printf("var %s %s\n", v, m.Type)
+	if len(m.Query) == 0 {
+		g.printf("err := bifrost.Args(args).\n")
+	} else {
+		g.printf("args, opts, err := bifrost.SplitQuery(args")
+		for _, f := range m.Query {
+			g.printf(", %q", f)
+		}
+		g.printf(")\nif err != nil {\nreturn nil, err\n}\n")
+		g.printf("%s.Options = opts\n", v)
+		g.printf("err = bifrost.Args(args).\n")
+	}
+
+	optional := false
+	for i, a := range m.Args {
+		if a.Optional && !optional {
+			g.printf("Optional().\n")
+			optional = true
+		}
+		g.genArgParse(v, i, a)
+	}
+
+	g.printf("Err()\nif err != nil {\nreturn nil, err\n}\n")
+	g.printf("return %s, nil\n}\n\n", v)
+}
+
+// genArgParse generates a Validator method call parsing argument i, a, into a field of v.
+func (g *goGen) genArgParse(v string, i int, a Arg) {
+	t := argTypes[a.Type]
+	field := v + "." + a.Name
+
+	if t.method != "" && a.Zero == "" {
+		g.printf("%s(%d, &%s).\n", t.method, i, field)
+		return
+	}
+
+	g.use(t)
+	g.printf("Func(%d, func(s string) (err error) {\n", i)
+	if a.Zero != "" {
+		g.printf("if s != %q {\n", a.Zero)
+	}
+	if t.parse == "" {
+		g.printf("%s = s\n", field)
+	} else {
+		g.printf("%s, err = %s\n", field, fmt.Sprintf(t.parse, "s"))
+	}
+	if a.Zero != "" {
+		g.printf("}\n")
+	}
+	g.printf("return err\n}).\n")
+}
+
+// genEmitter generates an emitter for response m.
+func (g *goGen) genEmitter(m Message) {
+	name := emitterName(m.Type)
+	g.printf("// %s handles converting a %s r into messages for tag t.\n", name, m.Type)
+	g.printf("func %s(t string, r %s, msgTx chan<- message.Message) error {\n", name, m.Type)
+
+	if len(m.Args) == 0 {
+		g.printf("msgTx <- *message.New(t, %s)\nreturn nil\n}\n\n", wordName("Rs", m.Word))
+		return
+	}
+
+	g.printf("args := make([]string, %d)\n", len(m.Args))
+	for i, a := range m.Args {
+		t := argTypes[a.Type]
+		g.use(t)
+
+		field := "r." + a.Name
+		formatted := fmt.Sprintf(t.format, field)
+		if a.Zero == "" {
+			g.printf("args[%d] = %s\n", i, formatted)
+			continue
+		}
+		g.printf("args[%d] = %q\n", i, a.Zero)
+		g.printf("if !(%s) {\nargs[%d] = %s\n}\n", fmt.Sprintf(t.isZero, field), i, formatted)
+	}
+	g.printf("msgTx <- *message.New(t, %s).AddArgs(args...)\nreturn nil\n}\n\n", wordName("Rs", m.Word))
+}
+
+// use records that the generated code uses the conversions of t.
+func (g *goGen) use(t argType) {
+	if t.imports != "" {
+		g.imports[t.imports] = true
+	}
+}
+
+// wordName gets the name of the constant for the word word, with prefix prefix ("Rq" for requests, "Rs" for
+// responses).
+func wordName(prefix, word string) string {
+	w := strings.ToLower(word)
+	return prefix + strings.ToUpper(w[:1]) + w[1:]
+}
+
+// parserName gets the name of the parser for a message with word word and kind kind ("Message" or "Response").
+func parserName(word, kind string) string {
+	w := strings.ToLower(word)
+	return "parse" + strings.ToUpper(w[:1]) + w[1:] + kind
+}
+
+// emitterName gets the name of the emitter for a response with type typ.
+func emitterName(typ string) string {
+	return "handle" + strings.TrimSuffix(typ, "Response")
+}
+
+// article gets the indefinite article to use before word.
+func article(word string) string {
+	if strings.ContainsRune("aeiouAEIOU", rune(word[0])) {
+		return "an"
+	}
+	return "a"
+}
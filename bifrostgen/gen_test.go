@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestGenerate_UpToDate checks that the checked-in list bindings match list/protocol.json.
+// If it fails, run 'go generate ./...'.
+func TestGenerate_UpToDate(t *testing.T) {
+	p, err := ReadProtocol("../list/protocol.json")
+	if err != nil {
+		t.Fatal("couldn't read protocol:", err)
+	}
+
+	src, err := GenerateGo(p)
+	if err != nil {
+		t.Fatal("couldn't generate code:", err)
+	}
+
+	cases := map[string][]byte{
+		"../list/bifrost_gen.go": src,
+		"../list/PROTOCOL.md":    GenerateDoc(p),
+	}
+	for path, want := range cases {
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("couldn't read %s: %v", path, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is out of date with list/protocol.json", path)
+		}
+	}
+}
+
+// TestReadProtocol_Invalid checks that definitions the generator can't handle are rejected.
+func TestReadProtocol_Invalid(t *testing.T) {
+	cases := map[string]Message{
+		"no type":            {Word: "foo"},
+		"unknown arg type":   {Word: "foo", Type: "Foo", Args: []Arg{{Name: "X", Type: "complex"}}},
+		"required after opt": {Word: "foo", Type: "Foo", Args: []Arg{{Name: "X", Type: "int", Optional: true}, {Name: "Y", Type: "int"}}},
+		"versioned query":    {Word: "foo", Type: "Foo", Versioned: true, Query: []string{"x"}},
+	}
+	for name, m := range cases {
+		if err := m.check(); err == nil {
+			t.Errorf("%s: message checked without error", name)
+		}
+	}
+}
+
+// TestReadProtocol_UnknownReply checks that requests can't reply with responses the protocol doesn't define.
+func TestReadProtocol_UnknownReply(t *testing.T) {
+	p := Protocol{
+		Requests:  []Message{{Word: "foo", Type: "FooRequest", Replies: []string{"BAR"}}},
+		Responses: []Message{{Word: "FOO", Type: "FooResponse"}, {Type: "BarResponse"}},
+	}
+	if err := p.check(); err == nil {
+		t.Error("protocol with unknown reply checked without error")
+	}
+	p.Requests[0].Replies = []string{"FOO"}
+	if err := p.check(); err != nil {
+		t.Error("unexpected error:", err)
+	}
+}
+
+// TestReadProtocol_DuplicateWord checks that no word can be defined twice, as each becomes a constant.
+func TestReadProtocol_DuplicateWord(t *testing.T) {
+	p := Protocol{
+		Requests:  []Message{{Word: "foo", Type: "FooRequest"}, {Word: "foo", Type: "OtherFooRequest"}},
+		Responses: []Message{{Word: "FOO", Type: "FooResponse"}},
+	}
+	if err := p.check(); err == nil {
+		t.Error("protocol with duplicate request checked without error")
+	}
+	p.Requests = p.Requests[:1]
+	p.Responses = append(p.Responses, Message{Word: "FOO", Type: "OtherFooResponse"})
+	if err := p.check(); err == nil {
+		t.Error("protocol with duplicate response checked without error")
+	}
+}
@@ -0,0 +1,39 @@
+// Command bifrostgen generates Bifrost parsers, emitters, and documentation from a protocol definition.
+//
+// Usage:
+//
+//	bifrostgen -go bifrost_gen.go -doc PROTOCOL.md protocol.json
+//
+// It is normally run through 'go generate'.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+)
+
+func main() {
+	goOut := flag.String("go", "bifrost_gen.go", "file to write generated Go code to")
+	docOut := flag.String("doc", "PROTOCOL.md", "file to write generated documentation to")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: bifrostgen [-go file] [-doc file] protocol.json")
+	}
+
+	p, err := ReadProtocol(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	src, err := GenerateGo(p)
+	if err != nil {
+		log.Fatal("couldn't generate code:", err)
+	}
+	if err := os.WriteFile(*goOut, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	if err := os.WriteFile(*docOut, GenerateDoc(p), 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+// File protocol.go contains the types of protocol definitions.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Protocol is the definition of the Bifrost messages understood and sent by one role.
+type Protocol struct {
+	// Role is the name of the role, such as 'list'.
+	Role string `json:"role"`
+	// Package is the name of the Go package implementing the role.
+	Package string `json:"package"`
+	// Requests is the list of request messages the role understands.
+	Requests []Message `json:"requests"`
+	// Responses is the list of response messages the role sends.
+	Responses []Message `json:"responses"`
+}
+
+// Message is the definition of one Bifrost message.
+type Message struct {
+	// Word is the message word.
+	// Responses without a word are sent as other messages, and only get an emitter entry.
+	Word string `json:"word"`
+	// Type is the name of the Go struct the message corresponds to.
+	Type string `json:"type"`
+	// Doc is a description of the message.
+	Doc string `json:"doc"`
+	// Custom is true if the message's parser and emitter are written by hand.
+	// Custom messages still need Args, for documentation.
+	Custom bool `json:"custom"`
+	// Versioned is true if the request may take the list version as an extra, final argument.
+	Versioned bool `json:"versioned"`
+	// Query, if non-empty, lists the fields the request's results can be sorted and filtered on.
+	// Such requests may take query options (see bifrost.QueryOptions) after their arguments, into a field called Options.
+	Query []string `json:"query"`
+	// Args is the list of message arguments, in order.
+	Args []Arg `json:"args"`
+	// Replies, for requests, lists the words of the responses the request replies with, other than the ACK.
+	Replies []string `json:"replies"`
+}
+
+// Arg is the definition of one argument of a Bifrost message.
+type Arg struct {
+	// Name is the name of the struct field the argument corresponds to.
+	Name string `json:"name"`
+	// Type is the argument type; see argTypes.
+	Type string `json:"type"`
+	// Doc is a description of the argument.
+	Doc string `json:"doc"`
+	// Zero, if non-empty, is the string that stands in for the zero value of the argument.
+	Zero string `json:"zero"`
+	// Optional is true if the argument may be left off the end of the message.
+	Optional bool `json:"optional"`
+}
+
+// ReadProtocol reads a protocol definition from the JSON file at path.
+func ReadProtocol(path string) (*Protocol, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Protocol
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, err
+	}
+	if err := p.check(); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, nil
+}
+
+// check checks p for errors the generator can't recover from.
+func (p *Protocol) check() error {
+	for _, ms := range [][]Message{p.Requests, p.Responses} {
+		for _, m := range ms {
+			if err := m.check(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Each word becomes a constant, so no word may be defined twice.
+	for kind, ms := range map[string][]Message{"request": p.Requests, "response": p.Responses} {
+		seen := map[string]bool{}
+		for _, m := range ms {
+			if m.Word != "" && seen[m.Word] {
+				return fmt.Errorf("%s %q is defined more than once", kind, m.Word)
+			}
+			seen[m.Word] = true
+		}
+	}
+
+	words := map[string]bool{}
+	for _, m := range p.Responses {
+		words[m.Word] = m.Word != ""
+	}
+	for _, m := range p.Requests {
+		for _, r := range m.Replies {
+			if !words[r] {
+				return fmt.Errorf("message %q replies with unknown response %q", m.Word, r)
+			}
+		}
+	}
+	return nil
+}
+
+// check checks m for errors the generator can't recover from.
+func (m *Message) check() error {
+	if m.Type == "" {
+		return fmt.Errorf("message %q has no type", m.Word)
+	}
+	if m.Versioned && len(m.Query) != 0 {
+		// The version is found by counting arguments, which query options would throw off.
+		return fmt.Errorf("message %q is versioned, so can't take query options", m.Word)
+	}
+
+	optional := false
+	for _, a := range m.Args {
+		if _, ok := argTypes[a.Type]; !ok {
+			return fmt.Errorf("message %q: argument %s has unknown type %q", m.Word, a.Name, a.Type)
+		}
+		if optional && !a.Optional {
+			return fmt.Errorf("message %q: required argument %s follows an optional one", m.Word, a.Name)
+		}
+		optional = a.Optional
+	}
+	return nil
+}
+
+// arity gets the minimum and maximum number of arguments m takes.
+func (m *Message) arity() (min, max int) {
+	for _, a := range m.Args {
+		if !a.Optional {
+			min++
+		}
+	}
+	return min, len(m.Args)
+}
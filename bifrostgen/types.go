@@ -0,0 +1,91 @@
+package main
+
+// File types.go contains the argument types the generator understands.
+
+// argType describes how to convert one type of argument between Go and Bifrost.
+// Each string is a format string taking a single Go expression.
+type argType struct {
+	// method is the bifrost.Validator method that parses the type, if there is one.
+	method string
+	// parse converts a string expression to a (value, error) pair; if empty, the string is used as is.
+	parse string
+	// format converts a value expression to a string.
+	format string
+	// isZero checks whether a value expression is the zero value.
+	isZero string
+	// imports is the package, if any, the conversions use.
+	// Parsing through method doesn't count.
+	imports string
+	// doc describes the type in generated documentation.
+	doc string
+}
+
+// argTypes maps the argument type names allowed in protocol definitions to their conversions.
+var argTypes = map[string]argType{
+	"automode": {
+		parse:  "ParseAutoMode(%s)",
+		format: "%s.String()",
+		isZero: "%s == AutoOff",
+		doc:    "automode name",
+	},
+	"bool": {
+		parse:   "strconv.ParseBool(%s)",
+		format:  "strconv.FormatBool(%s)",
+		isZero:  "!%s",
+		imports: "strconv",
+		doc:     "true or false",
+	},
+	"duration": {
+		parse:  "parseMilliseconds(%s)",
+		format: "formatMilliseconds(%s)",
+		isZero: "%s == 0",
+		doc:    "milliseconds",
+	},
+	"hash": {
+		method: "Hash",
+		format: "%s",
+		isZero: `%s == ""`,
+		doc:    "hash",
+	},
+	"int": {
+		method:  "Int",
+		parse:   "strconv.Atoi(%s)",
+		format:  "strconv.Itoa(%s)",
+		isZero:  "%s == 0",
+		imports: "strconv",
+		doc:     "integer",
+	},
+	"markup": {
+		parse:  "ParseMarkup(%s)",
+		format: "%s.String()",
+		isZero: "%s == MarkupPlain",
+		doc:    "markup name: plain or markdown",
+	},
+	"severity": {
+		parse:  "ParseAlertSeverity(%s)",
+		format: "%s.String()",
+		isZero: "%s == AlertInfo",
+		doc:    "alert severity: info, warning, error, or critical",
+	},
+	"string": {
+		method: "String",
+		format: "%s",
+		isZero: `%s == ""`,
+		doc:    "string",
+	},
+	"time": {
+		parse:   "time.Parse(time.RFC3339, %s)",
+		format:  "%s.Format(time.RFC3339)",
+		isZero:  "%s.IsZero()",
+		imports: "time",
+		doc:     "RFC 3339 time",
+	},
+	"uint": {
+		method:  "Uint",
+		parse:   "strconv.ParseUint(%s, 10, 64)",
+		format:  "strconv.FormatUint(%s, 10)",
+		isZero:  "%s == 0",
+		imports: "strconv",
+		doc:     "unsigned integer",
+	},
+}
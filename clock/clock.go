@@ -0,0 +1,78 @@
+// Package clock contains Clock, where yaps's time-dependent features, such as expiry, maintenance, idle timeouts and
+// play history, get the time from.
+//
+// yaps itself uses Real, the system clock; tests can use a Mock instead, which only moves when told to, so that they
+// don't depend on how fast the machine running them is.
+package clock
+
+import "time"
+
+// Clock is the interface of sources of the current time, and of timers and tickers that follow it.
+type Clock interface {
+	// Now gets the current time.
+	Now() time.Time
+	// NewTimer makes a Timer that fires once d has passed.
+	NewTimer(d time.Duration) Timer
+	// NewTicker makes a Ticker that fires every d, which must be positive.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is the interface of timers made by a Clock; it works like time.Timer.
+type Timer interface {
+	// C gets the channel on which the timer sends the time when it fires.
+	C() <-chan time.Time
+	// Stop stops the timer, returning false if it had already fired or been stopped.
+	Stop() bool
+	// Reset makes the timer fire once d has passed, returning false if it had already fired or been stopped.
+	// As with time.Timer, it should only be called on timers that have been stopped, or have fired and been drained.
+	Reset(d time.Duration) bool
+}
+
+// Ticker is the interface of tickers made by a Clock; it works like time.Ticker.
+type Ticker interface {
+	// C gets the channel on which the ticker sends the time at each tick.
+	C() <-chan time.Time
+	// Stop stops the ticker.
+	Stop()
+}
+
+// Real is the Clock that tells the time by the system clock.
+var Real Clock = realClock{}
+
+// realClock is the type of Real.
+type realClock struct{}
+
+// Now gets the system time.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer makes a time.Timer.
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+// NewTicker makes a time.Ticker.
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+// realTimer adapts a time.Timer into a Timer.
+type realTimer struct {
+	*time.Timer
+}
+
+// C gets the timer's channel.
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+// realTicker adapts a time.Ticker into a Ticker.
+type realTicker struct {
+	*time.Ticker
+}
+
+// C gets the ticker's channel.
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
@@ -0,0 +1,53 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/clock"
+)
+
+// TestMock checks that a Mock's timers and tickers fire only when its time is moved past them.
+func TestMock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	m := clock.NewMock(start)
+
+	timer := m.NewTimer(time.Minute)
+	ticker := m.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+	m.BlockUntil(2)
+
+	m.Advance(30 * time.Second)
+	select {
+	case <-timer.C():
+		t.Fatal("timer fired early")
+	default:
+	}
+	if got := <-ticker.C(); !got.Equal(start.Add(30 * time.Second)) {
+		t.Errorf("tick: got %v, want %v", got, start.Add(30*time.Second))
+	}
+
+	m.Advance(30 * time.Second)
+	if got := <-timer.C(); !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("timer: got %v, want %v", got, start.Add(time.Minute))
+	}
+	if timer.Stop() {
+		t.Error("stopping a fired timer: got true, want false")
+	}
+
+	if timer.Reset(time.Second) {
+		t.Error("resetting a fired timer: got true, want false")
+	}
+	if !timer.Stop() {
+		t.Error("stopping a reset timer: got false, want true")
+	}
+	m.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Error("stopped timer fired")
+	default:
+	}
+	if want := start.Add(time.Hour + time.Minute); !m.Now().Equal(want) {
+		t.Errorf("now: got %v, want %v", m.Now(), want)
+	}
+}
@@ -0,0 +1,182 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Mock is a Clock whose time only moves when told to, for tests.
+// Its timers and tickers fire as Set or Advance moves the time past them; like the real ones, a ticker that can't send
+// because nobody has taken its last tick drops the new one.
+// It is safe to use from many goroutines.
+type Mock struct {
+	// mu guards everything below.
+	mu sync.Mutex
+	// changed is signalled whenever the set of waiters changes.
+	changed *sync.Cond
+	// now is the current time.
+	now time.Time
+	// waiters holds the timers and tickers yet to fire.
+	waiters map[*mockWaiter]struct{}
+}
+
+// NewMock makes a Mock whose time starts at start.
+func NewMock(start time.Time) *Mock {
+	m := &Mock{now: start, waiters: make(map[*mockWaiter]struct{})}
+	m.changed = sync.NewCond(&m.mu)
+	return m
+}
+
+// Now gets m's current time.
+func (m *Mock) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+// Advance moves m's time on by d, firing any timers and tickers due by then.
+func (m *Mock) Advance(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(m.now.Add(d))
+}
+
+// Set moves m's time to t, firing any timers and tickers due by then.
+func (m *Mock) Set(t time.Time) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(t)
+}
+
+// set moves m's time to t, with m.mu held.
+func (m *Mock) set(t time.Time) {
+	m.now = t
+	for w := range m.waiters {
+		if t.Before(w.at) {
+			continue
+		}
+		w.fire(t)
+		if w.period == 0 {
+			delete(m.waiters, w)
+			continue
+		}
+		for !t.Before(w.at) {
+			w.at = w.at.Add(w.period)
+		}
+	}
+	m.changed.Broadcast()
+}
+
+// BlockUntil waits until m has n timers and tickers waiting to fire, so that a test can be sure whatever it is
+// testing has set its timers before moving the time on.
+func (m *Mock) BlockUntil(n int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for len(m.waiters) != n {
+		m.changed.Wait()
+	}
+}
+
+// NewTimer makes a Timer that fires once m's time has moved on by d.
+func (m *Mock) NewTimer(d time.Duration) Timer {
+	w := &mockWaiter{m: m, c: make(chan time.Time, 1)}
+	w.reset(d)
+	return mockTimer{w}
+}
+
+// NewTicker makes a Ticker that fires each time m's time moves on by d.
+func (m *Mock) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	w := &mockWaiter{m: m, c: make(chan time.Time, 1), period: d}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.add(w, d)
+	return mockTicker{w}
+}
+
+// add sets w to fire once m's time has moved on by d, with m.mu held; if d isn't positive, w fires at once.
+func (m *Mock) add(w *mockWaiter, d time.Duration) {
+	if d <= 0 {
+		w.fire(m.now)
+		return
+	}
+	w.at = m.now.Add(d)
+	m.waiters[w] = struct{}{}
+	m.changed.Broadcast()
+}
+
+// remove stops w, with m.mu held, returning whether it was waiting to fire.
+func (m *Mock) remove(w *mockWaiter) bool {
+	_, ok := m.waiters[w]
+	delete(m.waiters, w)
+	m.changed.Broadcast()
+	return ok
+}
+
+// mockWaiter is a timer or ticker made by a Mock.
+type mockWaiter struct {
+	// m is the Mock that made the waiter.
+	m *Mock
+	// c is the channel on which the waiter fires.
+	c chan time.Time
+	// at is when the waiter next fires.
+	at time.Time
+	// period is the interval between ticks, or 0 if the waiter is a timer.
+	period time.Duration
+}
+
+// fire sends t on w's channel, unless the last time sent is still there.
+func (w *mockWaiter) fire(t time.Time) {
+	select {
+	case w.c <- t:
+	default:
+	}
+}
+
+// C gets w's channel.
+func (w *mockWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+// stop stops w, returning whether it was waiting to fire.
+func (w *mockWaiter) stop() bool {
+	w.m.mu.Lock()
+	defer w.m.mu.Unlock()
+	return w.m.remove(w)
+}
+
+// reset makes w fire once its Mock's time has moved on by d, returning whether it was waiting to fire.
+func (w *mockWaiter) reset(d time.Duration) bool {
+	w.m.mu.Lock()
+	defer w.m.mu.Unlock()
+	ok := w.m.remove(w)
+	w.m.add(w, d)
+	return ok
+}
+
+// mockTimer adapts a mockWaiter into a Timer.
+type mockTimer struct {
+	*mockWaiter
+}
+
+// Stop stops the timer, returning whether it was waiting to fire.
+func (t mockTimer) Stop() bool {
+	return t.stop()
+}
+
+// Reset makes the timer fire once its Mock's time has moved on by d, returning whether it was waiting to fire.
+func (t mockTimer) Reset(d time.Duration) bool {
+	return t.reset(d)
+}
+
+// mockTicker adapts a mockWaiter into a Ticker.
+type mockTicker struct {
+	*mockWaiter
+}
+
+// Stop stops the ticker.
+func (t mockTicker) Stop() {
+	t.stop()
+}
@@ -0,0 +1,78 @@
+package main
+
+// File clone.go contains the 'clone' subcommand.
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/store"
+)
+
+// clonePrefix marks clone sources and destinations that are lists in storage, rather than template files.
+const clonePrefix = "list:"
+
+// runClone copies the running order of a list in storage, or of a template file, into a new list or template file.
+// Lists made this way get fresh hashes, unless asked otherwise, so that they don't share play counts and history
+// with the list or template they came from.
+func runClone(args []string) error {
+	fs := flag.NewFlagSet("clone", flag.ContinueOnError)
+	storage := fs.String("store", "", "storage spec (for example 'sqlite:yaps.db') holding the 'list:' source or destination")
+	keep := fs.Bool("keep-hashes", false, "give a destination list the source's hashes, instead of fresh ones")
+	force := fs.Bool("force", false, "replace a destination list that already exists")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("usage: clone [flags] (list:name | template.json) (list:name | template.json)")
+	}
+	from, to := fs.Arg(0), fs.Arg(1)
+
+	var s store.Storage
+	if strings.HasPrefix(from, clonePrefix) || strings.HasPrefix(to, clonePrefix) {
+		var err error
+		if s, err = store.Open(*storage); err != nil {
+			return err
+		}
+		defer s.Close()
+	}
+
+	t, err := loadCloneSource(s, from)
+	if err != nil {
+		return err
+	}
+
+	name, ok := strings.CutPrefix(to, clonePrefix)
+	if !ok {
+		return store.SaveTemplate(to, t)
+	}
+	if _, exists, err := s.LoadList(name); err != nil {
+		return err
+	} else if exists && !*force {
+		return fmt.Errorf("list %q already exists (use -force to replace it)", name)
+	}
+	l, err := t.Instantiate(!*keep)
+	if err != nil {
+		return err
+	}
+	return s.SaveList(name, l.State())
+}
+
+// loadCloneSource gets the template of the clone source from, which is either a list in s or a template file.
+func loadCloneSource(s store.Storage, from string) (list.Template, error) {
+	name, ok := strings.CutPrefix(from, clonePrefix)
+	if !ok {
+		return store.LoadTemplate(from)
+	}
+	st, exists, err := s.LoadList(name)
+	if err != nil {
+		return list.Template{}, err
+	}
+	if !exists {
+		return list.Template{}, fmt.Errorf("no list %q", name)
+	}
+	return st.Template(), nil
+}
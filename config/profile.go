@@ -0,0 +1,105 @@
+package config
+
+// File profile.go contains config profiles, which layer per-environment overlays on top of a base config.
+//
+// A profile, such as 'production', names an overlay next to the base config: yaps.toml with the profile
+// 'production' is overlaid by yaps.production.toml.
+// Overlays merge into the base as follows:
+//
+//   - settings the overlay gives replace those in the base;
+//   - tables, such as [Net], merge setting by setting, so an overlay need only give the settings that differ;
+//   - arrays, including arrays of tables such as [[Lists]], are replaced wholesale, so an overlay giving any
+//     [[Lists]] must give every list in full;
+//   - settings the overlay doesn't give keep their values from the base.
+//
+// Secret references are resolved once every layer is in, so an overlay can change which secrets file to use.
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// ProfileEnv is the environment variable that, if set, names the profile yaps runs with.
+const ProfileEnv = "YAPS_PROFILE"
+
+// OverlayPath gets the path of the overlay for profile on top of the base config cfile, for example
+// yaps.production.toml for yaps.toml and 'production'.
+func OverlayPath(cfile, profile string) string {
+	ext := filepath.Ext(cfile)
+	return strings.TrimSuffix(cfile, ext) + "." + profile + ext
+}
+
+// ParseProfile reads a TOML config from cfile, overlaid with that of profile (see OverlayPath); an empty profile
+// means no overlay.
+// The overlay must exist if profile isn't empty, to catch misspelt profiles.
+func ParseProfile(cfile, profile string) (Config, error) {
+	layers := []string{cfile}
+	if profile != "" {
+		layers = append(layers, OverlayPath(cfile, profile))
+	}
+	return ParseLayers(layers...)
+}
+
+// ParseLayers reads a TOML config from each of cfiles in turn, each overlaying the ones before it.
+// Settings yaps doesn't understand, such as misspelt ones, are errors in any layer.
+func ParseLayers(cfiles ...string) (Config, error) {
+	var conf Config
+	for _, cfile := range cfiles {
+		if err := overlay(&conf, cfile); err != nil {
+			return Config{}, err
+		}
+	}
+	if err := conf.Secrets.Resolve(&conf); err != nil {
+		return Config{}, err
+	}
+	return conf, nil
+}
+
+// overlay merges the TOML config in cfile into conf.
+func overlay(conf *Config, cfile string) error {
+	text, err := os.ReadFile(cfile)
+	if err != nil {
+		return err
+	}
+
+	// Decoding straight into conf would merge arrays element by element, so first find the arrays cfile gives, and
+	// empty them in conf.
+	var layer Config
+	md, err := toml.Decode(string(text), &layer)
+	if err != nil {
+		return fmt.Errorf("%s: %w", cfile, err)
+	}
+	if err := checkUnknown(md, reflect.TypeOf(layer)); err != nil {
+		return fmt.Errorf("%s: %w", cfile, err)
+	}
+	for _, k := range md.Keys() {
+		clearArray(reflect.ValueOf(conf).Elem(), k)
+	}
+
+	_, err = toml.Decode(string(text), conf)
+	return err
+}
+
+// clearArray empties the array, if any, that holds the setting at key in the config struct v.
+func clearArray(v reflect.Value, key toml.Key) {
+	for _, part := range key {
+		f, ok := fieldByKey(v.Type(), part)
+		if !ok {
+			return
+		}
+		v = v.FieldByIndex(f.Index)
+		switch v.Kind() {
+		case reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+			return
+		case reflect.Struct:
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/config"
+)
+
+// TestOverlayPath checks that overlays sit next to their base config.
+func TestOverlayPath(t *testing.T) {
+	cases := map[string]string{
+		"yaps.toml":           "yaps.production.toml",
+		"/etc/yaps/yaps.toml": "/etc/yaps/yaps.production.toml",
+		"yaps":                "yaps.production",
+	}
+	for in, want := range cases {
+		if got := config.OverlayPath(in, "production"); got != want {
+			t.Errorf("OverlayPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+// TestParseProfile checks the merge semantics of overlays.
+func TestParseProfile(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, "yaps.toml")
+	writeConfig(t, base, `
+[Net]
+enabled = true
+host = "localhost:1350"
+coalesce = "50ms"
+
+[[Lists]]
+name = "main"
+player = "localhost:1351"
+dedupe = true
+
+[[Lists]]
+name = "spare"
+`)
+	writeConfig(t, filepath.Join(dir, "yaps.production.toml"), `
+[Net]
+host = "0.0.0.0:1350"
+
+[[Lists]]
+name = "live"
+`)
+
+	conf, err := config.ParseProfile(base, "")
+	if err != nil {
+		t.Fatalf("base didn't parse: %v", err)
+	}
+	if conf.Net.Host != "localhost:1350" || len(conf.Lists) != 2 {
+		t.Errorf("without a profile, got %+v", conf)
+	}
+
+	conf, err = config.ParseProfile(base, "production")
+	if err != nil {
+		t.Fatalf("overlay didn't parse: %v", err)
+	}
+	if conf.Net.Host != "0.0.0.0:1350" {
+		t.Errorf("overlay didn't replace host: got %q", conf.Net.Host)
+	}
+	if !conf.Net.Enabled || conf.Net.Coalesce != 50*time.Millisecond {
+		t.Errorf("overlay didn't keep the rest of [Net]: got %+v", conf.Net)
+	}
+	if len(conf.Lists) != 1 || conf.Lists[0].Name != "live" || conf.Lists[0].Player != "" || conf.Lists[0].Dedupe {
+		t.Errorf("overlay didn't replace [[Lists]] wholesale: got %+v", conf.Lists)
+	}
+
+	if _, err := config.ParseProfile(base, "staging"); err == nil {
+		t.Error("a profile with no overlay parsed without error")
+	}
+
+	writeConfig(t, filepath.Join(dir, "yaps.typo.toml"), "[Net]\nhots = \"x\"\n")
+	_, err = config.ParseProfile(base, "typo")
+	if err == nil || !strings.Contains(err.Error(), "yaps.typo.toml") {
+		t.Errorf("an unknown setting in an overlay gave error %v, want it to name the overlay", err)
+	}
+}
+
+// writeConfig writes text to the config file path.
+func writeConfig(t *testing.T, path, text string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
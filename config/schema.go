@@ -0,0 +1,190 @@
+package config
+
+// File schema.go contains the config schema: the settings yaps understands, and what each one does.
+//
+// The schema comes from the config structs themselves, and their doc comments (by way of 'configgen'), so it can't
+// drift from the code.
+// It catches settings yaps doesn't understand, such as typos, which TOML would otherwise ignore, and generates the
+// commented example config that 'yaps config example' prints.
+
+//go:generate go run ../configgen -o schema_gen.go config.go secrets.go
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// maxSuggestDistance is the furthest, in edits, that a setting yaps understands may be from an unknown one for yaps
+// to suggest it.
+const maxSuggestDistance = 2
+
+// durationType is the type of settings holding durations, which TOML gives as strings such as "5s".
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Example generates an example config, with every setting at its zero value and commented with what it does.
+// Arrays of tables within tables, such as tokens and rules, are commented out, as empty entries would do harm.
+func Example() []byte {
+	var out bytes.Buffer
+	fmt.Fprintln(&out, "# Example yaps config, generated by 'yaps config example'.")
+	fmt.Fprintln(&out, "# Every setting is at its zero value; see the comments for what that means.")
+	writeTable(&out, reflect.TypeOf(Config{}), nil, "")
+	return out.Bytes()
+}
+
+// writeTable writes the settings of the config struct t, which is at path, to out, starting each line with prefix.
+// Settings come first, then sub-tables, as TOML needs.
+func writeTable(out *bytes.Buffer, t reflect.Type, path []string, prefix string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if isTable(f.Type) {
+			continue
+		}
+		writeDoc(out, docs[t.Name()+"."+f.Name])
+		fmt.Fprintf(out, "%s%s = %s\n", prefix, strings.ToLower(f.Name), zeroValue(f.Type))
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !isTable(f.Type) {
+			continue
+		}
+
+		ft, header, fprefix := f.Type, "[%s]", prefix
+		if ft.Kind() == reflect.Slice {
+			ft, header = ft.Elem(), "[[%s]]"
+			if len(path) != 0 {
+				fprefix = "#"
+			}
+		}
+		doc, ok := docs[t.Name()+"."+f.Name]
+		if !ok {
+			doc = docs[ft.Name()]
+		}
+
+		fpath := append(append([]string(nil), path...), f.Name)
+		fmt.Fprintln(out)
+		writeDoc(out, doc)
+		fmt.Fprintf(out, "%s"+header+"\n", fprefix, strings.Join(fpath, "."))
+		writeTable(out, ft, fpath, fprefix)
+	}
+}
+
+// writeDoc writes doc to out as TOML comments.
+func writeDoc(out *bytes.Buffer, doc string) {
+	if doc == "" {
+		return
+	}
+	for _, line := range strings.Split(doc, "\n") {
+		fmt.Fprintln(out, strings.TrimRight("# "+line, " "))
+	}
+}
+
+// isTable checks whether settings of type t are TOML tables, or arrays of them.
+func isTable(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	return t.Kind() == reflect.Struct
+}
+
+// zeroValue gets the zero value of settings of type t, in TOML.
+func zeroValue(t reflect.Type) string {
+	switch {
+	case t == durationType:
+		return `"0s"`
+	case t.Kind() == reflect.String:
+		return `""`
+	case t.Kind() == reflect.Bool:
+		return "false"
+	case t.Kind() == reflect.Slice:
+		return "[]"
+	default:
+		return "0"
+	}
+}
+
+// checkUnknown fails if md, from decoding into a config struct of type t, has settings t doesn't understand.
+func checkUnknown(md toml.MetaData, t reflect.Type) error {
+	undec := md.Undecoded()
+	if len(undec) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, len(undec))
+	for i, k := range undec {
+		msgs[i] = k.String()
+		if s := suggest(t, k); s != "" {
+			msgs[i] += fmt.Sprintf(" (did you mean %s?)", s)
+		}
+	}
+	return fmt.Errorf("unknown settings: %s", strings.Join(msgs, ", "))
+}
+
+// suggest finds the setting, next to the unknown setting at key in a config struct of type t, that key most likely
+// meant, or returns "" if there is none close enough.
+func suggest(t reflect.Type, key toml.Key) string {
+	for _, part := range key[:len(key)-1] {
+		f, ok := fieldByKey(t, part)
+		if !ok {
+			return ""
+		}
+		if t = f.Type; t.Kind() == reflect.Slice {
+			t = t.Elem()
+		}
+		if t.Kind() != reflect.Struct {
+			return ""
+		}
+	}
+
+	unknown := strings.ToLower(key[len(key)-1])
+	best, bestDist := "", maxSuggestDistance+1
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.ToLower(t.Field(i).Name)
+		if d := editDistance(unknown, name); d < bestDist {
+			best, bestDist = name, d
+		}
+	}
+	return best
+}
+
+// fieldByKey finds the field of the config struct t that the TOML key key decodes into.
+func fieldByKey(t reflect.Type, key string) (reflect.StructField, bool) {
+	return t.FieldByNameFunc(func(name string) bool { return strings.EqualFold(name, key) })
+}
+
+// editDistance gets the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min3(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// min3 gets the least of a, b, and c.
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,60 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/config"
+)
+
+// TestExample checks that the example config parses, and documents every setting.
+func TestExample(t *testing.T) {
+	ex := config.Example()
+	path := filepath.Join(t.TempDir(), "yaps.toml")
+	if err := os.WriteFile(path, ex, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.Parse(path); err != nil {
+		t.Fatalf("example didn't parse: %v", err)
+	}
+
+	// Every setting is preceded by its doc comment.
+	lines := strings.Split(string(ex), "\n")
+	for i, l := range lines {
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		if i == 0 || !strings.HasPrefix(lines[i-1], "#") {
+			t.Errorf("line %d, %q, is undocumented", i+1, l)
+		}
+	}
+}
+
+// TestParse_Unknown checks that settings yaps doesn't understand are errors, with suggestions for typos.
+func TestParse_Unknown(t *testing.T) {
+	cases := map[string]string{
+		"[Net]\nenbled = true\n":                      "Net.enbled (did you mean enabled?)",
+		"[[Lists]]\n[Lists.Dial]\ntiemout = \"5s\"\n": "Lists.Dial.tiemout (did you mean timeout?)",
+		"[Net]\nfrobnicate = true\n":                  "Net.frobnicate",
+	}
+	for in, want := range cases {
+		path := filepath.Join(t.TempDir(), "yaps.toml")
+		if err := os.WriteFile(path, []byte(in), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := config.Parse(path)
+		if err == nil {
+			t.Errorf("%q parsed without error", in)
+			continue
+		}
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("%q: got error %q, want it to mention %q", in, err, want)
+		}
+	}
+
+	if _, err := config.Parse("../yaps.toml"); err != nil {
+		t.Errorf("the shipped config didn't parse: %v", err)
+	}
+}
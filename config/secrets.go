@@ -0,0 +1,247 @@
+package config
+
+// File secrets.go contains support for keeping credentials out of yaps.toml.
+//
+// Any setting of type Secret may, instead of the credential itself, hold a reference to it:
+// - '${env:NAME}' is the value of the environment variable NAME;
+// - '${secret:NAME}' is the entry NAME in the secrets file, sealed with NaCl secretbox under the secrets key.
+// References are resolved when the config is loaded, so yaps.toml can be committed without leaking anything.
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// DefaultSecretsKeyEnv is the environment variable holding the secrets key if Secrets doesn't say where it is.
+const DefaultSecretsKeyEnv = "YAPS_SECRETS_KEY"
+
+// secretsNonceSize is the size of the nonce at the start of each sealed secret.
+const secretsNonceSize = 24
+
+// Secret is the type of settings holding credentials, which may be references to the environment or secrets file.
+type Secret string
+
+// Secrets is the configuration struct for resolving references to secrets.
+type Secrets struct {
+	// File is a TOML file mapping secret names to sealed secrets, as made by 'yaps seal-secret'.
+	// If empty, '${secret:NAME}' references can't be used.
+	File string
+	// KeyFile is a file holding the secrets key, in base64, as made by 'yaps secrets-keygen'.
+	// If empty, the key is read from KeyEnv.
+	KeyFile string
+	// KeyEnv is the environment variable holding the secrets key, in base64, if KeyFile is empty.
+	// If empty, it is YAPS_SECRETS_KEY.
+	KeyEnv string
+}
+
+// Resolve replaces every reference in the Secret settings anywhere in *v, which should be a pointer to a config
+// struct, with the secret it refers to.
+// Settings that aren't references stay as they are.
+func (s Secrets) Resolve(v interface{}) error {
+	var sealed map[string]string
+	return walkSecrets(reflect.ValueOf(v).Elem(), func(sec *Secret) error {
+		kind, name, ok := parseReference(string(*sec))
+		if !ok {
+			return nil
+		}
+
+		switch kind {
+		case "env":
+			val, ok := os.LookupEnv(name)
+			if !ok {
+				return fmt.Errorf("secret ${env:%s}: environment variable not set", name)
+			}
+			*sec = Secret(val)
+		case "secret":
+			if sealed == nil {
+				var err error
+				if sealed, err = s.load(); err != nil {
+					return err
+				}
+			}
+			val, err := s.open(sealed, name)
+			if err != nil {
+				return fmt.Errorf("secret ${secret:%s}: %w", name, err)
+			}
+			*sec = Secret(val)
+		default:
+			return fmt.Errorf("secret reference %q: unknown kind %q", *sec, kind)
+		}
+		return nil
+	})
+}
+
+// parseReference splits s into the kind and name of a '${kind:name}' reference, if it is one.
+func parseReference(s string) (kind, name string, ok bool) {
+	if !strings.HasPrefix(s, "${") || !strings.HasSuffix(s, "}") {
+		return "", "", false
+	}
+	return strings.Cut(s[2:len(s)-1], ":")
+}
+
+// redacted is what Redacted puts in place of each secret.
+const redacted = "<redacted>"
+
+// Redacted gets c as TOML, with every Secret setting that isn't empty replaced by '<redacted>', so that it can be
+// shown to people who mustn't see the credentials.
+func (c Config) Redacted() ([]byte, error) {
+	// Round-tripping through TOML makes a deep copy, so that redacting doesn't touch c's slices.
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(c); err != nil {
+		return nil, err
+	}
+	var cp Config
+	if _, err := toml.Decode(buf.String(), &cp); err != nil {
+		return nil, err
+	}
+	_ = walkSecrets(reflect.ValueOf(&cp).Elem(), func(sec *Secret) error {
+		if *sec != "" {
+			*sec = redacted
+		}
+		return nil
+	})
+
+	buf.Reset()
+	if err := toml.NewEncoder(&buf).Encode(cp); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// walkSecrets calls f on every Secret reachable through the structs and slices in v.
+func walkSecrets(v reflect.Value, f func(*Secret) error) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			if err := walkSecrets(v.Field(i), f); err != nil {
+				return err
+			}
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := walkSecrets(v.Index(i), f); err != nil {
+				return err
+			}
+		}
+	case reflect.String:
+		if !v.CanAddr() || !v.Addr().CanInterface() {
+			return nil
+		}
+		if sec, ok := v.Addr().Interface().(*Secret); ok {
+			return f(sec)
+		}
+	}
+	return nil
+}
+
+// load reads the sealed secrets from the secrets file.
+func (s Secrets) load() (map[string]string, error) {
+	if s.File == "" {
+		return nil, errors.New("${secret:...} references need a secrets file")
+	}
+	sealed := make(map[string]string)
+	if _, err := toml.DecodeFile(s.File, &sealed); err != nil {
+		return nil, fmt.Errorf("couldn't read secrets file: %w", err)
+	}
+	return sealed, nil
+}
+
+// open unseals the secret called name in sealed.
+func (s Secrets) open(sealed map[string]string, name string) (string, error) {
+	box, ok := sealed[name]
+	if !ok {
+		return "", errors.New("not in the secrets file")
+	}
+	key, err := s.Key()
+	if err != nil {
+		return "", err
+	}
+	return OpenSecret(key, box)
+}
+
+// Key gets the secrets key, from KeyFile or KeyEnv.
+func (s Secrets) Key() (*[32]byte, error) {
+	var text string
+	if s.KeyFile != "" {
+		bs, err := os.ReadFile(s.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read secrets key: %w", err)
+		}
+		text = string(bs)
+	} else {
+		env := s.KeyEnv
+		if env == "" {
+			env = DefaultSecretsKeyEnv
+		}
+		var ok bool
+		if text, ok = os.LookupEnv(env); !ok {
+			return nil, fmt.Errorf("no secrets key: set KeyFile, or the environment variable %s", env)
+		}
+	}
+	return ParseSecretsKey(text)
+}
+
+// NewSecretsKey makes a new random secrets key.
+func NewSecretsKey() (*[32]byte, error) {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+// FormatSecretsKey formats key as base64, for a key file or environment variable.
+func FormatSecretsKey(key *[32]byte) string {
+	return base64.StdEncoding.EncodeToString(key[:])
+}
+
+// ParseSecretsKey parses a secrets key formatted by FormatSecretsKey, ignoring surrounding whitespace.
+func ParseSecretsKey(text string) (*[32]byte, error) {
+	bs, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return nil, fmt.Errorf("bad secrets key: %w", err)
+	}
+	var key [32]byte
+	if len(bs) != len(key) {
+		return nil, fmt.Errorf("bad secrets key: got %d bytes, want %d", len(bs), len(key))
+	}
+	copy(key[:], bs)
+	return &key, nil
+}
+
+// SealSecret seals value under key, for the secrets file.
+func SealSecret(key *[32]byte, value string) (string, error) {
+	var nonce [secretsNonceSize]byte
+	if _, err := rand.Read(nonce[:]); err != nil {
+		return "", err
+	}
+	box := secretbox.Seal(nonce[:], []byte(value), &nonce, key)
+	return base64.StdEncoding.EncodeToString(box), nil
+}
+
+// OpenSecret unseals a secret sealed by SealSecret under key.
+func OpenSecret(key *[32]byte, sealed string) (string, error) {
+	bs, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", fmt.Errorf("bad sealed secret: %w", err)
+	}
+	if len(bs) < secretsNonceSize {
+		return "", errors.New("bad sealed secret: too short")
+	}
+	var nonce [secretsNonceSize]byte
+	copy(nonce[:], bs)
+	val, ok := secretbox.Open(nil, bs[secretsNonceSize:], &nonce, key)
+	if !ok {
+		return "", errors.New("couldn't unseal secret: wrong key, or tampered with")
+	}
+	return string(val), nil
+}
@@ -0,0 +1,93 @@
+package config_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/config"
+)
+
+// TestSecrets_Resolve checks that references to the environment and the secrets file resolve, wherever they are.
+func TestSecrets_Resolve(t *testing.T) {
+	key, err := config.NewSecretsKey()
+	if err != nil {
+		t.Fatal("couldn't make key:", err)
+	}
+	sealed, err := config.SealSecret(key, "hunter2")
+	if err != nil {
+		t.Fatal("couldn't seal secret:", err)
+	}
+
+	dir := t.TempDir()
+	sfile := filepath.Join(dir, "secrets.toml")
+	if err := os.WriteFile(sfile, []byte(fmt.Sprintf("icecast = %q\n", sealed)), 0o600); err != nil {
+		t.Fatal("couldn't write secrets file:", err)
+	}
+	t.Setenv("YAPS_TEST_KEY", config.FormatSecretsKey(key))
+	t.Setenv("YAPS_TEST_PROXY", "socks5://u:p@proxy:1080")
+
+	secrets := config.Secrets{File: sfile, KeyEnv: "YAPS_TEST_KEY"}
+	conf := config.Config{
+		Icy:   config.Icy{User: "${env:YAPS_TEST_PROXY}", Password: "${secret:icecast}"},
+		Lists: []config.List{{Dial: config.Dial{Proxy: "${env:YAPS_TEST_PROXY}"}, Store: "memory"}},
+	}
+	if err := secrets.Resolve(&conf); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if got, want := conf.Icy.Password, config.Secret("hunter2"); got != want {
+		t.Errorf("password: got %q, want %q", got, want)
+	}
+	if got, want := conf.Lists[0].Dial.Proxy, config.Secret("socks5://u:p@proxy:1080"); got != want {
+		t.Errorf("proxy: got %q, want %q", got, want)
+	}
+	// Only Secret settings are resolved.
+	if got, want := conf.Icy.User, "${env:YAPS_TEST_PROXY}"; got != want {
+		t.Errorf("user: got %q, want %q", got, want)
+	}
+	if got, want := conf.Lists[0].Store, config.Secret("memory"); got != want {
+		t.Errorf("store: got %q, want %q", got, want)
+	}
+
+	for _, ref := range []config.Secret{"${env:YAPS_TEST_UNSET}", "${secret:missing}", "${vault:x}"} {
+		icy := config.Icy{Password: ref}
+		if err := secrets.Resolve(&icy); err == nil {
+			t.Errorf("%s: no error", ref)
+		}
+	}
+
+	other, err := config.NewSecretsKey()
+	if err != nil {
+		t.Fatal("couldn't make key:", err)
+	}
+	if _, err := config.OpenSecret(other, sealed); err == nil {
+		t.Error("opening with the wrong key: no error")
+	}
+}
+
+// TestConfig_Redacted checks that redacting a config hides every secret, and leaves the config itself alone.
+func TestConfig_Redacted(t *testing.T) {
+	conf := config.Config{
+		Icy:   config.Icy{User: "source", Password: "hunter2"},
+		Lists: []config.List{{Store: "sqlite:yaps.db", Dial: config.Dial{Proxy: "socks5://u:p@proxy:1080"}}},
+		Auth:  config.Auth{Tokens: []config.Token{{Token: "sesame"}}},
+	}
+	text, err := conf.Redacted()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for _, secret := range []string{"hunter2", "sqlite:yaps.db", "u:p@proxy", "sesame"} {
+		if strings.Contains(string(text), secret) {
+			t.Errorf("redacted config contains %q:\n%s", secret, text)
+		}
+	}
+	if !strings.Contains(string(text), `"source"`) {
+		t.Errorf("redacted config lost a setting that isn't secret:\n%s", text)
+	}
+	if conf.Lists[0].Dial.Proxy != "socks5://u:p@proxy:1080" || conf.Auth.Tokens[0].Token != "sesame" {
+		t.Errorf("redacting changed the config itself: %+v", conf)
+	}
+}
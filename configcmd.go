@@ -0,0 +1,56 @@
+package main
+
+// File configcmd.go contains the 'config' subcommand, for working with yaps.toml.
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/MattWindsor91/yaps/config"
+)
+
+// configUsage is the usage message of the 'config' subcommand.
+const configUsage = "usage: config (example > yaps.toml | check [-profile name] [yaps.toml])"
+
+// runConfig either prints a commented example config, or checks a config, and its overlay for a profile, for
+// mistakes.
+func runConfig(args []string) error {
+	if len(args) == 0 {
+		return errors.New(configUsage)
+	}
+
+	switch args[0] {
+	case "example":
+		if len(args) != 1 {
+			return errors.New(configUsage)
+		}
+		_, err := os.Stdout.Write(config.Example())
+		return err
+	case "check":
+		fs := flag.NewFlagSet("config check", flag.ContinueOnError)
+		profile := fs.String("profile", os.Getenv(config.ProfileEnv), "profile whose overlay to check along with the config")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		cfile := "yaps.toml"
+		switch fs.NArg() {
+		case 0:
+		case 1:
+			cfile = fs.Arg(0)
+		default:
+			return errors.New(configUsage)
+		}
+		if _, err := config.ParseProfile(cfile, *profile); err != nil {
+			return err
+		}
+		if *profile != "" {
+			cfile += " with profile " + *profile
+		}
+		fmt.Println(cfile, "is OK")
+		return nil
+	default:
+		return errors.New(configUsage)
+	}
+}
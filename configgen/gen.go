@@ -0,0 +1,92 @@
+package main
+
+// File gen.go contains the Go code generator.
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GenerateDocs generates a map from each struct type declared in the Go files at paths, and each of its documented
+// fields as '<struct>.<field>', to its doc comment.
+func GenerateDocs(paths []string) ([]byte, error) {
+	docs := make(map[string]string)
+	pkg := ""
+	fset := token.NewFileSet()
+	for _, path := range paths {
+		f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if pkg != "" && f.Name.Name != pkg {
+			return nil, fmt.Errorf("%s is in package %s, not %s", filepath.Base(path), f.Name.Name, pkg)
+		}
+		pkg = f.Name.Name
+		collectDocs(f, docs)
+	}
+
+	keys := make([]string, 0, len(docs))
+	for k := range docs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var out bytes.Buffer
+	fmt.Fprintln(&out, "// Code generated by configgen; DO NOT EDIT.")
+	fmt.Fprintln(&out)
+	fmt.Fprintf(&out, "package %s\n\n", pkg)
+	fmt.Fprintln(&out, "// docs maps each config struct, and each of its fields as '<struct>.<field>', to its doc comment.")
+	fmt.Fprintln(&out, "var docs = map[string]string{")
+	for _, k := range keys {
+		fmt.Fprintf(&out, "\t%q: %q,\n", k, docs[k])
+	}
+	fmt.Fprintln(&out, "}")
+
+	return format.Source(out.Bytes())
+}
+
+// collectDocs adds the doc comments of the struct types, and their fields, declared in f to docs.
+func collectDocs(f *ast.File, docs map[string]string) {
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			st, ok := ts.Type.(*ast.StructType)
+			if !ok {
+				continue
+			}
+
+			doc := ts.Doc
+			if doc == nil {
+				doc = gd.Doc
+			}
+			if text := docText(doc); text != "" {
+				docs[ts.Name.Name] = text
+			}
+			for _, field := range st.Fields.List {
+				text := docText(field.Doc)
+				if text == "" {
+					continue
+				}
+				for _, name := range field.Names {
+					docs[ts.Name.Name+"."+name.Name] = text
+				}
+			}
+		}
+	}
+}
+
+// docText gets the text of doc, without comment markers or a trailing newline.
+func docText(doc *ast.CommentGroup) string {
+	return strings.TrimSpace(doc.Text())
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// TestGenerate_UpToDate checks that the checked-in config schema docs match the config structs.
+// If it fails, run 'go generate ./...'.
+func TestGenerate_UpToDate(t *testing.T) {
+	src, err := GenerateDocs([]string{"../config/config.go", "../config/secrets.go"})
+	if err != nil {
+		t.Fatal("couldn't generate code:", err)
+	}
+
+	got, err := os.ReadFile("../config/schema_gen.go")
+	if err != nil {
+		t.Fatal("couldn't read schema docs:", err)
+	}
+	if !bytes.Equal(got, src) {
+		t.Error("config/schema_gen.go is out of date with the config structs")
+	}
+}
@@ -0,0 +1,30 @@
+// Command configgen generates the config schema's documentation from the doc comments of the config structs.
+//
+// Usage:
+//
+//	configgen -o schema_gen.go config.go secrets.go
+//
+// It is normally run through 'go generate'.
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+)
+
+func main() {
+	out := flag.String("o", "schema_gen.go", "file to write generated Go code to")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		log.Fatal("usage: configgen [-o file] file.go...")
+	}
+
+	src, err := GenerateDocs(flag.Args())
+	if err != nil {
+		log.Fatal("couldn't generate code:", err)
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		log.Fatal(err)
+	}
+}
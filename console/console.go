@@ -4,13 +4,17 @@ package console
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
+	"sync/atomic"
 
 	"github.com/UniversityRadioYork/bifrost-go/message"
 
+	"github.com/MattWindsor91/yaps/bifrost"
 	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
 	"github.com/UniversityRadioYork/bifrost-go/comm"
 	"github.com/chzyer/readline"
 )
@@ -20,10 +24,20 @@ const (
 	// (Must include trailing space)
 	promptNormal   = "$ "
 	promptContinue = "> "
+	promptDryRun   = "(dry run) $ "
 	// Console response prefixes
 	// (Must _not_ include trailing space)
-	prefixMessage = "[R]"
-	prefixError   = "[!]"
+	prefixMessage  = "[R]"
+	prefixError    = "[!]"
+	prefixProgress = "[%]"
+	prefixMotd     = "[*]"
+	prefixKey      = "[K]"
+
+	// progressWidth is the width, in characters, of progress bars.
+	progressWidth = 20
+
+	// maxPresses is the number of key presses that may wait to be sent before more are dropped.
+	maxPresses = 16
 )
 
 // Console provides a readline-style console for sending Bifrost messages to a controller.
@@ -34,26 +48,65 @@ type Console struct {
 	tok     *message.Tokeniser
 	rl      *readline.Instance
 	txrun   bool
+
+	// decode, if not nil, decodes responses into typed bodies for JSON output.
+	decode bifrost.ResponseDecoder
+	// jsonOut is true if the Console prints responses as JSON objects, one per line, instead of Bifrost lines.
+	// It is toggled by the transmitter loop and read by the receiver loop.
+	jsonOut atomic.Bool
+
+	// dryRun is true if the Console sends requests as dry runs, which check them without carrying them out.
+	// It is toggled by the transmitter loop and read by it and the key loop.
+	dryRun atomic.Bool
+
+	// keys maps the runes of bound keys to their bindings.
+	keys map[rune]*binding
+	// presses carries the presses of bound keys from readline to the key loop.
+	presses chan keyPress
 }
 
 // New creates a new Console.
 // This can fail if the underlying console library fails, or if the Client
 // doesn't support Bifrost.
 func New(ctx context.Context, client *controller.Client) (*Console, error) {
-	rl, err := readline.New(promptNormal)
-	if err != nil {
-		return nil, err
-	}
-
 	bf, bfc := controller.NewBifrost(client)
-
-	return &Console{
+	c := Console{
 		client:  client,
 		bf:      bf,
 		bclient: bfc,
 		tok:     message.NewTokeniser(),
-		rl:      rl,
-	}, nil
+		presses: make(chan keyPress, maxPresses),
+	}
+
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:              promptNormal,
+		Stdin:               readline.NewCancelableStdin(keyDecoder{r: readline.Stdin}),
+		FuncFilterInputRune: c.filterKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.rl = rl
+	return &c, nil
+}
+
+// SetMotd sets the message of the day the Console shows when it starts; nil, the default, means there is none.
+// It must be called before Run.
+func (c *Console) SetMotd(m *controller.Motd) {
+	c.bf.SetMotd(m)
+}
+
+// SetDecoder sets the function the Console uses to decode responses in JSON output; nil, the default, means JSON output
+// only decodes ACKs.
+// It must be called before Run.
+func (c *Console) SetDecoder(d bifrost.ResponseDecoder) {
+	c.decode = d
+}
+
+// SetJSON sets whether the Console starts out printing responses as JSON; '/json' toggles it later.
+// It must be called before Run.
+func (c *Console) SetJSON(on bool) {
+	c.jsonOut.Store(on)
 }
 
 // Close cleans up a Console after it's done.
@@ -78,6 +131,7 @@ func (c *Console) Run(ctx context.Context) error {
 		c.runTx(ctx)
 		// See above
 	}()
+	go c.runKeys(ctx)
 	go func() {
 		c.runRx()
 		err = c.Close()
@@ -94,6 +148,23 @@ func (c *Console) runRx() {
 	// We don't have to check c.bclient.Done here:
 	// client always drops both Rx and Done when shutting down.
 	for m := range c.bclient.Rx {
+		if c.jsonOut.Load() {
+			c.outputJSON(m)
+			continue
+		}
+		if m.Word() == controller.RsProgress {
+			if p, err := controller.ParseProgressResponse(&m); err == nil {
+				c.outputProgress(m.Tag(), p)
+				continue
+			}
+		}
+		if m.Word() == controller.RsMotd {
+			if text, err := controller.ParseMotdMessage(&m); err == nil {
+				c.outputMotd(text)
+				continue
+			}
+		}
+
 		mbytes, err := m.Pack()
 		if err != nil {
 			c.outputError(err)
@@ -119,9 +190,12 @@ func (c *Console) runTx(ctx context.Context) {
 		}
 
 		needMore := c.handleRawLine(ctx, lineToTerminatedBytes(line))
-		if needMore {
+		switch {
+		case needMore:
 			c.rl.SetPrompt(promptContinue)
-		} else {
+		case c.dryRun.Load():
+			c.rl.SetPrompt(promptDryRun)
+		default:
 			c.rl.SetPrompt(promptNormal)
 		}
 	}
@@ -180,6 +254,7 @@ func (c *Console) handleLine(ctx context.Context, line []string) (bool, error) {
 // handleBifrostLine interprets a line (word array) as a tagless Bifrost
 // message.
 // The line should have been tokenised using Bifrost tokenisation rules.
+// In dry run mode, the message goes as a dry run of the line.
 //
 // Returns whether the upstream client is still taking messages, and any errors
 // arising from processing the line.
@@ -189,10 +264,11 @@ func (c *Console) handleBifrostLine(ctx context.Context, line []string) (bool, e
 		return true, err
 	}
 
-	tline := make([]string, len(line)+1)
-	tline[0] = tag
-	copy(tline[1:], line)
-	return c.txLine(ctx, tline)
+	tline := []string{tag}
+	if c.dryRun.Load() {
+		tline = append(tline, list.RqDryrun)
+	}
+	return c.txLine(ctx, append(tline, line...))
 }
 
 func (c *Console) txLine(ctx context.Context, line []string) (bool, error) {
@@ -214,6 +290,14 @@ func (c *Console) handleSpecialCommand(ctx context.Context, scword string, args
 	case "tag":
 		// Send message with specific tag
 		return c.txLine(ctx, args)
+	case "find":
+		return c.handleFind(ctx, args)
+	case "describe":
+		return c.handleDescribe(ctx, args)
+	case "json":
+		return true, c.handleJSON(args)
+	case "dryrun":
+		return true, c.handleDryRun(args)
 	default:
 		return true, fmt.Errorf("unknown sc")
 	}
@@ -221,14 +305,88 @@ func (c *Console) handleSpecialCommand(ctx context.Context, scword string, args
 
 // handleQuit handles a quit message.
 func (c *Console) handleQuit(ctx context.Context, args []string) error {
-	if 0 != len(args) {
-		return fmt.Errorf("bad arity")
+	if err := bifrost.Args(args).Err(); err != nil {
+		return err
 	}
 
 	c.txrun = false
 	return c.client.Shutdown(ctx)
 }
 
+// handleFind handles a find message, which searches the list for a query, optionally in a given field.
+// Matches come back as FOUND replies.
+func (c *Console) handleFind(ctx context.Context, args []string) (bool, error) {
+	var query, field string
+	if err := bifrost.Args(args).String(0, &query).Optional().String(1, &field).Err(); err != nil {
+		return true, err
+	}
+
+	line := []string{list.RqFind, query}
+	if field != "" {
+		line = append(line, field)
+	}
+	return c.handleBifrostLine(ctx, line)
+}
+
+// handleDescribe handles a describe message, which asks the server to describe its requests and responses, or just
+// one word.
+// It never goes as a dry run, as the server's adapter answers it rather than its state.
+func (c *Console) handleDescribe(ctx context.Context, args []string) (bool, error) {
+	var word string
+	if err := bifrost.Args(args).Optional().String(0, &word).Err(); err != nil {
+		return true, err
+	}
+
+	tag, err := message.NewTag()
+	if err != nil {
+		return true, err
+	}
+	line := []string{tag, controller.RqDescribe}
+	if word != "" {
+		line = append(line, word)
+	}
+	return c.txLine(ctx, line)
+}
+
+// handleJSON handles a json message, which switches JSON output on or off, or toggles it if given no argument.
+func (c *Console) handleJSON(args []string) error {
+	on, err := parseToggle(args, c.jsonOut.Load())
+	if err != nil {
+		return err
+	}
+	c.jsonOut.Store(on)
+	return nil
+}
+
+// parseToggle parses the arguments args of a special command that switches a mode, currently cur, on or off, or
+// toggles it if given no argument.
+func parseToggle(args []string, cur bool) (bool, error) {
+	var mode string
+	if err := bifrost.Args(args).Optional().String(0, &mode).Err(); err != nil {
+		return false, err
+	}
+	switch mode {
+	case "":
+		return !cur, nil
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	default:
+		return false, fmt.Errorf("mode must be on or off, not %q", mode)
+	}
+}
+
+// handleDryRun handles a dryrun message, which switches dry run mode on or off, or toggles it if given no argument.
+func (c *Console) handleDryRun(args []string) error {
+	on, err := parseToggle(args, c.dryRun.Load())
+	if err != nil {
+		return err
+	}
+	c.dryRun.Store(on)
+	return nil
+}
+
 // parseSpecialCommand tries to interpret word as a special command.
 // If word is a special command, it returns the word less the special-command prefix, and true.
 // Else, it returns an undefined string, and false.
@@ -253,6 +411,40 @@ func (c *Console) outputMessage(mbytes []byte) error {
 	return err
 }
 
+// outputJSON prints m to stdout as a JSON object on one line.
+func (c *Console) outputJSON(m message.Message) {
+	bs, err := json.Marshal(bifrost.ToJSON(m, c.decode))
+	if err != nil {
+		c.outputError(err)
+		return
+	}
+	if _, err := fmt.Fprintf(c.rl.Stdout(), "%s\n", bs); err != nil {
+		c.outputError(err)
+	}
+}
+
+// outputProgress prints the progress report p, for the request with tag tag, to stdout as a progress bar.
+func (c *Console) outputProgress(tag string, p controller.ProgressResponse) {
+	pc := p.Percent
+	if pc < 0 {
+		pc = 0
+	} else if 100 < pc {
+		pc = 100
+	}
+	filled := pc * progressWidth / 100
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", progressWidth-filled)
+	if _, err := fmt.Fprintf(c.rl.Stdout(), "%s %s [%s] %3d%% %s\n", prefixProgress, tag, bar, p.Percent, p.Note); err != nil {
+		c.outputError(err)
+	}
+}
+
+// outputMotd prints the message of the day text to stdout.
+func (c *Console) outputMotd(text string) {
+	if _, err := fmt.Fprintln(c.rl.Stdout(), prefixMotd, "message of the day:", text); err != nil {
+		c.outputError(err)
+	}
+}
+
 // outputError prints an error e to stderr.
 func (c *Console) outputError(e error) {
 	if _, err := fmt.Fprintln(c.rl.Stderr(), prefixError, e.Error()); err != nil {
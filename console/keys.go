@@ -0,0 +1,203 @@
+package console
+
+// File keys.go contains key bindings, which send console input at a single keystroke.
+//
+// readline drops the escape sequences of function keys, so the Console reads stdin through a keyDecoder, which turns
+// each into a rune from the Unicode private use area before readline sees it.
+// Bound keys never reach the line being edited: their input goes out on its own, as if typed on a line of its own.
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/config"
+)
+
+// functionKeyBase is the rune standing for F1; F2 to F12 follow it.
+const functionKeyBase = '\uE000'
+
+// functionKeySeqs maps the escape sequences xterm-like terminals send for function keys to their numbers.
+var functionKeySeqs = map[string]int{
+	"\x1bOP": 1, "\x1bOQ": 2, "\x1bOR": 3, "\x1bOS": 4,
+	"\x1b[11~": 1, "\x1b[12~": 2, "\x1b[13~": 3, "\x1b[14~": 4,
+	"\x1b[15~": 5, "\x1b[17~": 6, "\x1b[18~": 7, "\x1b[19~": 8,
+	"\x1b[20~": 9, "\x1b[21~": 10, "\x1b[23~": 11, "\x1b[24~": 12,
+}
+
+// isFunctionKey checks whether r stands for a function key.
+func isFunctionKey(r rune) bool {
+	return functionKeyBase <= r && r < functionKeyBase+12
+}
+
+// parseKey gets the rune readline sees for the key called name, such as "F5" or "ctrl-g".
+func parseKey(name string) (rune, error) {
+	lname := strings.ToLower(name)
+	if f, ok := strings.CutPrefix(lname, "f"); ok {
+		if n, err := strconv.Atoi(f); err == nil && 1 <= n && n <= 12 && strconv.Itoa(n) == f {
+			return functionKeyBase + rune(n-1), nil
+		}
+	}
+	if c, ok := strings.CutPrefix(lname, "ctrl-"); ok && len(c) == 1 && 'a' <= c[0] && c[0] <= 'z' {
+		// Control keys arrive as the control characters 1 (ctrl-a) to 26 (ctrl-z).
+		return rune(c[0]-'a') + 1, nil
+	}
+	return 0, fmt.Errorf("unknown key %q: want F1 to F12, or ctrl-a to ctrl-z", name)
+}
+
+// keyDecoder reads from r, turning the escape sequences of function keys into the runes that stand for them.
+// It assumes a terminal sends each key's sequence in one piece, so it never holds back input waiting for the rest.
+type keyDecoder struct {
+	r io.Reader
+}
+
+// Read reads from d's reader into p, decoding function keys.
+// No sequence is shorter than the rune it turns into, so the decoded input always fits into p.
+func (d keyDecoder) Read(p []byte) (int, error) {
+	n, err := d.r.Read(p)
+	if bytes.IndexByte(p[:n], '\x1b') == -1 {
+		return n, err
+	}
+	return copy(p, decodeKeys(p[:n])), err
+}
+
+// decodeKeys turns the function key sequences in bs into the runes that stand for them.
+func decodeKeys(bs []byte) []byte {
+	var out bytes.Buffer
+	for 0 < len(bs) {
+		if bs[0] == '\x1b' {
+			if n, seq, ok := matchFunctionKey(bs); ok {
+				out.WriteRune(functionKeyBase + rune(n-1))
+				bs = bs[len(seq):]
+				continue
+			}
+		}
+		out.WriteByte(bs[0])
+		bs = bs[1:]
+	}
+	return out.Bytes()
+}
+
+// matchFunctionKey gets the number and sequence of the function key at the start of bs, if there is one.
+func matchFunctionKey(bs []byte) (int, string, bool) {
+	for seq, n := range functionKeySeqs {
+		if bytes.HasPrefix(bs, []byte(seq)) {
+			return n, seq, true
+		}
+	}
+	return 0, "", false
+}
+
+// binding is a key bound to console input.
+type binding struct {
+	// name is the name of the key, as configured.
+	name string
+	// send is the input the key sends, one entry per press in turn.
+	send []string
+	// next is the index in send of the entry the next press sends.
+	next int
+}
+
+// press gets the entry b sends for a press, and moves on to the next.
+func (b *binding) press() string {
+	s := b.send[b.next]
+	b.next = (b.next + 1) % len(b.send)
+	return s
+}
+
+// keyPress is one press of a bound key.
+type keyPress struct {
+	// name is the name of the key.
+	name string
+	// input is the console input the press sends.
+	input string
+}
+
+// SetKeys binds keys to the console input they send; see config.Key.
+// It must be called before Run.
+func (c *Console) SetKeys(keys []config.Key) error {
+	c.keys = make(map[rune]*binding, len(keys))
+	for _, k := range keys {
+		r, err := parseKey(k.Key)
+		if err != nil {
+			return err
+		}
+		if len(k.Send) == 0 {
+			return fmt.Errorf("key %s sends nothing", k.Key)
+		}
+		if _, ok := c.keys[r]; ok {
+			return fmt.Errorf("key %s is bound twice", k.Key)
+		}
+		c.keys[r] = &binding{name: k.Key, send: k.Send}
+	}
+	return nil
+}
+
+// filterKey is readline's input filter, which takes bound keys out of the input and queues their input to send.
+// It runs on readline's goroutine, which is the only one to touch the bindings once the Console is running.
+func (c *Console) filterKey(r rune) (rune, bool) {
+	b, ok := c.keys[r]
+	if !ok {
+		// Function keys nobody bound mean nothing to readline either.
+		return r, !isFunctionKey(r)
+	}
+	select {
+	case c.presses <- keyPress{name: b.name, input: b.press()}:
+	default:
+		c.outputError(fmt.Errorf("key %s: too many presses waiting to be sent", b.name))
+	}
+	return r, false
+}
+
+// runKeys sends the input of each key press until ctx ends.
+func (c *Console) runKeys(ctx context.Context) {
+	for {
+		select {
+		case p := <-c.presses:
+			c.handleKeyPress(ctx, p)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// handleKeyPress sends the input of key press p, line by line.
+func (c *Console) handleKeyPress(ctx context.Context, p keyPress) {
+	c.outputKey(p)
+	for _, line := range keyLines(p.input) {
+		if _, err := c.handleLine(ctx, line); err != nil {
+			c.outputError(err)
+		}
+	}
+}
+
+// keyLines tokenises the input of a key press into lines.
+// The input goes through its own tokeniser, so that it doesn't mix with anything half-typed.
+func keyLines(input string) [][]string {
+	tok := message.NewTokeniser()
+	bs := []byte(input + "\n")
+	var lines [][]string
+	for 0 < len(bs) {
+		n, lineok, line := tok.TokeniseBytes(bs)
+		if !lineok {
+			break
+		}
+		bs = bs[n:]
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// outputKey prints the input the key press p sends to stdout.
+func (c *Console) outputKey(p keyPress) {
+	for _, l := range strings.Split(p.input, "\n") {
+		if _, err := fmt.Fprintln(c.rl.Stdout(), prefixKey, p.name+":", l); err != nil {
+			c.outputError(err)
+		}
+	}
+}
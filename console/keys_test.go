@@ -0,0 +1,155 @@
+package console
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/config"
+)
+
+// Test_parseKey checks that parseKey knows F1 to F12 and ctrl-a to ctrl-z, in any case, and nothing else.
+func Test_parseKey(t *testing.T) {
+	cases := []struct {
+		name string
+		want rune
+		ok   bool
+	}{
+		{"F1", functionKeyBase, true},
+		{"f5", functionKeyBase + 4, true},
+		{"F12", functionKeyBase + 11, true},
+		{"ctrl-a", 1, true},
+		{"Ctrl-G", 7, true},
+		{"CTRL-Z", 26, true},
+		{"F0", 0, false},
+		{"F13", 0, false},
+		{"F01", 0, false},
+		{"F", 0, false},
+		{"F+1", 0, false},
+		{"ctrl-", 0, false},
+		{"ctrl-1", 0, false},
+		{"ctrl-ab", 0, false},
+		{"alt-a", 0, false},
+		{"a", 0, false},
+		{"", 0, false},
+	}
+	for _, c := range cases {
+		got, err := parseKey(c.name)
+		switch {
+		case c.ok && err != nil:
+			t.Errorf("%q: unexpected error: %v", c.name, err)
+		case c.ok && got != c.want:
+			t.Errorf("%q: got %U, want %U", c.name, got, c.want)
+		case !c.ok && err == nil:
+			t.Errorf("%q: got %U, want an error", c.name, got)
+		}
+	}
+}
+
+// Test_decodeKeys checks that decodeKeys turns the sequences of function keys, and nothing else, into their runes.
+func Test_decodeKeys(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"abc", "abc"},
+		{"\x1bOP", string(functionKeyBase)},
+		{"\x1b[11~", string(functionKeyBase)},
+		{"a\x1b[24~b", "a" + string(functionKeyBase+11) + "b"},
+		{"\x1bOQ\x1b[15~", string(functionKeyBase+1) + string(functionKeyBase+4)},
+		// Arrow keys are readline's to handle.
+		{"\x1b[A", "\x1b[A"},
+		{"\x1b", "\x1b"},
+	}
+	for _, c := range cases {
+		if got := string(decodeKeys([]byte(c.in))); got != c.want {
+			t.Errorf("%q: got %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+// TestConsole_SetKeys checks that SetKeys refuses unknown keys, keys that send nothing, and keys bound twice, even
+// under different spellings.
+func TestConsole_SetKeys(t *testing.T) {
+	cases := []struct {
+		name string
+		keys []config.Key
+		err  string
+	}{
+		{"none", nil, ""},
+		{"distinct", []config.Key{{Key: "F1", Send: []string{"auto next"}}, {Key: "ctrl-a", Send: []string{"auto off"}}}, ""},
+		{"unknown", []config.Key{{Key: "F13", Send: []string{"auto next"}}}, "unknown key"},
+		{"empty", []config.Key{{Key: "F1"}}, "sends nothing"},
+		{"twice", []config.Key{{Key: "F1", Send: []string{"a"}}, {Key: "F1", Send: []string{"b"}}}, "bound twice"},
+		{"twice in other case", []config.Key{{Key: "ctrl-a", Send: []string{"a"}}, {Key: "CTRL-A", Send: []string{"b"}}}, "bound twice"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			err := new(Console).SetKeys(c.keys)
+			switch {
+			case c.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)):
+				t.Errorf("got error %v, want one mentioning %q", err, c.err)
+			}
+		})
+	}
+}
+
+// TestConsole_filterKey checks that bound keys queue their entries in turn, cycling round, and never reach readline,
+// while unbound function keys are dropped and other keys pass through.
+func TestConsole_filterKey(t *testing.T) {
+	c := &Console{presses: make(chan keyPress, maxPresses)}
+	if err := c.SetKeys([]config.Key{
+		{Key: "F2", Send: []string{"auto next", "auto off"}},
+		{Key: "ctrl-r", Send: []string{"dump"}},
+	}); err != nil {
+		t.Fatal("unexpected error binding keys:", err)
+	}
+
+	press := func(r rune) {
+		t.Helper()
+		if _, ok := c.filterKey(r); ok {
+			t.Errorf("%U: bound key reached readline", r)
+		}
+	}
+	press(functionKeyBase + 1)
+	press(18)
+	press(functionKeyBase + 1)
+	press(functionKeyBase + 1)
+
+	var got []string
+	for len(c.presses) != 0 {
+		p := <-c.presses
+		got = append(got, p.name+": "+p.input)
+	}
+	want := []string{"F2: auto next", "ctrl-r: dump", "F2: auto off", "F2: auto next"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("presses: got %q, want %q", got, want)
+	}
+
+	if _, ok := c.filterKey(functionKeyBase + 2); ok {
+		t.Error("unbound function key reached readline")
+	}
+	if r, ok := c.filterKey('x'); !ok || r != 'x' {
+		t.Errorf("unbound key: got %q, %v; want 'x', true", r, ok)
+	}
+}
+
+// Test_keyLines checks that the input of a key press splits into lines, each tokenised on its own.
+func Test_keyLines(t *testing.T) {
+	cases := []struct {
+		input string
+		want  [][]string
+	}{
+		{"auto next", [][]string{{"auto", "next"}}},
+		{"auto next\nsel 0 abc", [][]string{{"auto", "next"}, {"sel", "0", "abc"}}},
+		{"note 'on air now'", [][]string{{"note", "on air now"}}},
+		// An unbalanced quote leaves the line unfinished, so none of it is sent.
+		{"note 'oops\nauto off", nil},
+	}
+	for _, c := range cases {
+		if got := keyLines(c.input); fmt.Sprintf("%q", got) != fmt.Sprintf("%q", c.want) {
+			t.Errorf("%q: got %q, want %q", c.input, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package controller
+
+// File admin.go contains the checks on requests only admins may make, such as changing the message of the day.
+//
+// When a check fails, the error says which group the request needed and who the client is, so that whoever runs the
+// server can see why without reading its logs; the adapter also tells its denial hook, if it has one, so that the
+// server can log the decision.
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/auth"
+)
+
+// NotAdminError is the error returned when a client outside an admin group makes a request only its members may make.
+// It matches ErrNotAdmin with errors.Is.
+type NotAdminError struct {
+	// Group is the group the request needed.
+	Group string
+	// Identity is who the client logged in as, or nil if it didn't.
+	Identity *auth.Identity
+}
+
+// Error gets the error message of a NotAdminError.
+func (e NotAdminError) Error() string {
+	msg := fmt.Sprintf("only members of group %q may do that", e.Group)
+	switch {
+	case e.Identity == nil:
+		return msg + "; you aren't logged in"
+	case len(e.Identity.Groups) == 0:
+		return fmt.Sprintf("%s; you are %q, in no groups", msg, e.Identity.User)
+	default:
+		return fmt.Sprintf("%s; you are %q, in groups %s", msg, e.Identity.User, strings.Join(e.Identity.Groups, ", "))
+	}
+}
+
+// Code gets the error code of a NotAdminError.
+func (NotAdminError) Code() string {
+	return auth.CodeDenied
+}
+
+// Is checks whether target is ErrNotAdmin.
+func (NotAdminError) Is(target error) bool {
+	return target == ErrNotAdmin
+}
+
+// CheckAdmin checks whether a client that logged in as id, or not at all if id is nil, is in the admin group group;
+// an empty group means that anyone is.
+func CheckAdmin(id *auth.Identity, group string) error {
+	if group == "" || (id != nil && id.InGroup(group)) {
+		return nil
+	}
+	return NotAdminError{Group: group, Identity: id}
+}
+
+// DeniedRequest describes a request refused because the client wasn't an admin.
+type DeniedRequest struct {
+	// Word is the request's word.
+	Word string
+	// Tag is the request's tag.
+	Tag string
+	// Err is the error the request was refused with.
+	Err NotAdminError
+}
+
+// SetDeniedRequestHook sets a function the adapter calls, on its own goroutine, for each request refused because the
+// client wasn't an admin; nil, the default, means it calls nothing.
+// The hook mustn't block for long, as the adapter waits for it.
+// It must be called before Run.
+func (b *Bifrost) SetDeniedRequestHook(hook func(DeniedRequest)) {
+	b.deniedHook = hook
+}
+
+// checkDenied calls the denied-request hook if the request with word word and tag tag failed with err for want of
+// being an admin.
+func (b *Bifrost) checkDenied(word, tag string, err error) {
+	var e NotAdminError
+	if b.deniedHook == nil || !errors.As(err, &e) {
+		return
+	}
+	b.deniedHook(DeniedRequest{Word: word, Tag: tag, Err: e})
+}
+
+// deny refuses the request rq, which failed the admin check with err.
+func (b *Bifrost) deny(rq message.Message, err error) {
+	b.checkDenied(rq.Word(), rq.Tag(), err)
+	b.respond(*b.errorToMessage(rq.Tag(), err))
+}
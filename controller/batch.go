@@ -0,0 +1,142 @@
+package controller
+
+// File batch.go contains the Bifrost adapter's handling of 'batch' requests.
+//
+// 'batch <line>...' carries several requests in one message, each argument being a request line without its tag, such
+// as 'batch "sel 0 abc" "auto next"'.
+// The adapter unpacks the requests and handles them in order, each once the one before it has been acknowledged, with
+// the tags '<tag>.1', '<tag>.2', and so on; each gets its own replies and ACK under its own tag.
+// The adapter reads nothing else from the client until it has handled every request in the batch.
+// Once every request in the batch has been acknowledged, the batch itself gets a summary, 'BATCH <count> <ok>
+// <failed>', and then 'ACK OK success'.
+// This saves clients on slow links a round trip per request, but isn't a transaction: the requests in a batch are
+// checked and carried out one by one, and each failure leaves those before it done.
+// Batches can't hold segments or other batches, and their requests pass through the adapter's word filter as usual.
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+const (
+	// RqBatch is the word of requests carrying several requests at once.
+	RqBatch = "batch"
+	// RsBatch is the word of the summaries sent once every request in a batch is acknowledged.
+	RsBatch = "BATCH"
+
+	// MaxBatch is the most requests a batch may carry.
+	MaxBatch = 64
+)
+
+// batch tracks a batch whose requests haven't all been acknowledged.
+type batch struct {
+	// tag is the batch's own tag.
+	tag string
+	// left is the number of the batch's requests not yet acknowledged.
+	left int
+	// ok and failed count the batch's requests acknowledged with and without success.
+	ok, failed int
+}
+
+// handleBatch handles a request rq carrying several requests, queueing them for Run to handle in turn.
+// Run handles them one per turn of its loop, so that it can take the Controller's replies to each as they come.
+func (b *Bifrost) handleBatch(rq message.Message) {
+	rqs, err := parseBatch(rq)
+	if err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return
+	}
+
+	bt := &batch{tag: rq.Tag(), left: len(rqs)}
+	if b.batches == nil {
+		b.batches = make(map[string]*batch)
+	}
+	for _, sub := range rqs {
+		b.batches[sub.Tag()] = bt
+	}
+	b.batched = append(b.batched, rqs...)
+}
+
+// nextBatched gets a channel that is ready if there are batched requests waiting to be handled, and the last one
+// handled has been acknowledged, and nil otherwise.
+func (b *Bifrost) nextBatched() <-chan struct{} {
+	if len(b.batched) == 0 || b.batchBusy {
+		return nil
+	}
+	return batchReady
+}
+
+// batchReady is always ready, for nextBatched.
+var batchReady = func() chan struct{} {
+	c := make(chan struct{})
+	close(c)
+	return c
+}()
+
+// handleBatched handles the oldest batched request waiting to be handled.
+// It returns whether the client can still handle requests.
+func (b *Bifrost) handleBatched(ctx context.Context) bool {
+	sub := b.batched[0]
+	b.batched = b.batched[1:]
+	b.batchBusy = true
+
+	switch sub.Word() {
+	case RqBatch, bifrost.RqSeg:
+		b.respond(*b.errorToMessage(sub.Tag(), bifrost.WithCode(bifrost.CodeArg, fmt.Errorf("%s is not allowed in a batch", sub.Word()))))
+		return true
+	default:
+		return b.handleRequest(ctx, sub)
+	}
+}
+
+// parseBatch unpacks the requests carried by the batch request rq, tagging each with the batch's tag and its position.
+func parseBatch(rq message.Message) ([]message.Message, error) {
+	args := rq.Args()
+	if len(args) == 0 || MaxBatch < len(args) {
+		return nil, bifrost.ArityError{Got: len(args), Min: 1, Max: MaxBatch}
+	}
+
+	rqs := make([]message.Message, len(args))
+	for i, a := range args {
+		_, lineok, line := message.NewTokeniser().TokeniseBytes([]byte(a + "\n"))
+		if !lineok || len(line) == 0 {
+			return nil, bifrost.ArgError{Pos: i, Arg: a, Err: fmt.Errorf("not a request line")}
+		}
+		m, err := message.NewFromLine(append([]string{rq.Tag() + "." + strconv.Itoa(i+1)}, line...))
+		if err != nil {
+			return nil, bifrost.ArgError{Pos: i, Arg: a, Err: err}
+		}
+		rqs[i] = *m
+	}
+	return rqs, nil
+}
+
+// countBatched counts the ACK m towards the batch it belongs to, if any, summarising and acknowledging the batch once
+// it has every ACK.
+func (b *Bifrost) countBatched(m message.Message) {
+	bt, ok := b.batches[m.Tag()]
+	if !ok {
+		return
+	}
+	delete(b.batches, m.Tag())
+	b.batchBusy = false
+
+	if args := m.Args(); len(args) != 0 && args[0] == "OK" {
+		bt.ok++
+	} else {
+		bt.failed++
+	}
+	bt.left--
+	if bt.left != 0 {
+		return
+	}
+	count := bt.ok + bt.failed
+	b.respond(*message.New(bt.tag, RsBatch).AddArgs(strconv.Itoa(count), strconv.Itoa(bt.ok), strconv.Itoa(bt.failed)))
+	b.respond(*message.New(bt.tag, core.RsAck).AddArgs("OK", "success"))
+}
@@ -1,24 +1,43 @@
 package controller
 
-// File comm/bifrost.go provides types and functions for creating bridges between Controllers and the Bifrost protocol.
+// File bifrost.go provides types and functions for creating bridges between Controllers and the Bifrost protocol.
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/UniversityRadioYork/bifrost-go/core"
 
 	"github.com/UniversityRadioYork/bifrost-go/comm"
 	"github.com/UniversityRadioYork/bifrost-go/message"
-)
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 
-// sversion is the Baps3D semantic server version.
-const sversion = "yaps-0.0.0"
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/version"
+)
 
 // UnknownWord returns an error for when a Bifrost parser doesn't understand the
 // word w.
 func UnknownWord(w string) error {
-	return fmt.Errorf("unknown word: %s", w)
+	return bifrost.WithCode(bifrost.CodeUnknownWord, fmt.Errorf("unknown word: %s", w))
+}
+
+// BifrostParser is the interface of Controllable states that can be spoken to over Bifrost.
+//
+// A BifrostParser's methods run on Bifrost adapter goroutines, not the Controller goroutine,
+// so they must not touch the state's mutable parts.
+type BifrostParser interface {
+	// ParseBifrostRequest parses the request word word, with arguments args, into a request body.
+	ParseBifrostRequest(word string, args []string) (interface{}, error)
+
+	// EmitBifrostResponse converts the response body rbody, with tag tag, into messages sent down msgTx.
+	EmitBifrostResponse(tag string, rbody interface{}, msgTx chan<- message.Message) error
 }
 
 // Bifrost is the type of adapters from Controller clients to Bifrost.
@@ -32,6 +51,129 @@ type Bifrost struct {
 
 	// reply is the channel this adapter uses to service replies to requests it sends to the client.
 	reply chan Response
+
+	// parser is the Controller state's Bifrost parser, or nil if the state can't speak Bifrost.
+	// It is fetched from the Controller when the adapter starts running.
+	parser BifrostParser
+
+	// tx is the channel of outgoing messages, which pass through segmentation on their way to bifrost.
+	tx chan message.Message
+
+	// dropped counts the broadcasts dropped because tx was full; see sendbuf.go.
+	dropped atomic.Int64
+
+	// droppedHook, if not nil, is called for each dropped broadcast.
+	droppedHook func()
+
+	// lagging is true while the client is lagging behind tx.
+	// It is set by the adapter goroutine and cleared by the forwarding goroutine.
+	lagging atomic.Bool
+
+	// notices is the channel of messages sent to the client from outside the Controller; see Announce.
+	notices chan message.Message
+
+	// segSize is the longest line, in bytes, the client has asked us to send; 0 means no limit.
+	// It is set by the adapter goroutine and read by the forwarding goroutine.
+	segSize atomic.Int64
+
+	// reassembler rebuilds segmented requests from the client.
+	reassembler bifrost.Reassembler
+
+	// normalise is true if request arguments should be put into Unicode Normalisation Form C.
+	normalise bool
+
+	// errMode is the error mode the client has chosen; the empty string is the same as ErrModeProse.
+	errMode string
+
+	// errLocale is the locale tag the client wants error descriptions in, if any.
+	errLocale string
+
+	// lastSeq is the sequence number of the last broadcast stamped for the client, or 0 if none has been.
+	lastSeq uint64
+
+	// coalescer holds broadcasts waiting to be coalesced.
+	coalescer coalescer
+
+	// regionThreshold is the most item broadcasts sent as they are in one flush; 0 means never fold them.
+	regionThreshold int
+
+	// auth is the provider that checks logins, or nil if clients don't log in.
+	auth auth.Provider
+
+	// identity is who the client logged in as, or nil if it hasn't.
+	// It is set by the adapter goroutine, and may be read by the server.
+	identity atomic.Pointer[auth.Identity]
+
+	// loginHook, if not nil, is called whenever the client logs in.
+	loginHook func(auth.Identity)
+
+	// loggingIn is true while the client's login is being checked.
+	loggingIn bool
+
+	// logins carries the results of checking logins back to the adapter goroutine.
+	logins chan loginResult
+
+	// requestTimeout is how long each request may wait to be handled, or 0 if there is no limit.
+	requestTimeout time.Duration
+
+	// inflight maps the tags of requests sent to the Controller, and not yet acknowledged, to the requests, in the
+	// order they were sent.
+	inflight map[string][]inflightRequest
+
+	// slowThreshold is how long a request may take to be acknowledged before the adapter reports it as slow, or 0 if
+	// it never does.
+	slowThreshold time.Duration
+
+	// slowHook, if not nil, is called for each slow request.
+	slowHook func(SlowRequest)
+
+	// motd is the message of the day, or nil if there is none.
+	motd *Motd
+
+	// tunables, if not nil, are the tunables admins may get and change with 'tune'.
+	tunables *Tunables
+
+	// listClients, if not nil, describes every connection to the server, for 'clients' requests.
+	listClients ClientLister
+
+	// deniedHook, if not nil, is called for each request refused because the client wasn't an admin.
+	deniedHook func(DeniedRequest)
+
+	// clientAdmins is the group whose members may make 'clients' requests, or empty if anyone may.
+	clientAdmins string
+
+	// dialect, if not nil, translates between the dialect the client speaks and the current protocol.
+	dialect *dialectState
+
+	// words, if not nil, restricts the request words the adapter accepts.
+	words *WordFilter
+
+	// batches maps the tags of batched requests not yet acknowledged to their batches; see batch.go.
+	batches map[string]*batch
+
+	// batched holds the batched requests waiting to be handled, in order.
+	batched []message.Message
+
+	// batchBusy is true while a batched request is waiting to be acknowledged.
+	batchBusy bool
+
+	// caps is the set of capabilities the client has declared, or nil if it hasn't; see caps.go.
+	caps *capabilities
+
+	// display is true once the client has declared itself a read-only display.
+	// It is set by the adapter goroutine and read by the server.
+	display atomic.Bool
+
+	// drain closes when the adapter is told to drain; see Drain.
+	drain chan struct{}
+	// drainOnce makes sure drain only closes once.
+	drainOnce sync.Once
+	// draining is true once the adapter has started draining.
+	draining bool
+	// drained closes once the adapter has drained, or stopped.
+	drained chan struct{}
+	// drainedOnce makes sure drained only closes once.
+	drainedOnce sync.Once
 }
 
 // NewBifrost wraps client inside a Bifrost adapter with parsing and emitting
@@ -43,52 +185,128 @@ func NewBifrost(client *Client) (*Bifrost, *comm.Endpoint) {
 	pubEnd, privEnd := comm.NewEndpointPair()
 
 	bif := Bifrost{
-		client:  client,
-		bifrost: privEnd,
-		reply:   reply,
+		client:   client,
+		bifrost:  privEnd,
+		reply:    reply,
+		tx:       make(chan message.Message),
+		notices:  make(chan message.Message, maxNotices),
+		logins:   make(chan loginResult, 1),
+		inflight: make(map[string][]inflightRequest),
+		drain:    make(chan struct{}),
+		drained:  make(chan struct{}),
 	}
 
 	return &bif, pubEnd
 }
 
+// SetNormalise sets whether the adapter NFC-normalises the arguments of incoming requests.
+// It must be called before Run.
+func (b *Bifrost) SetNormalise(normalise bool) {
+	b.normalise = normalise
+}
+
+// SetRequestTimeout sets how long each request may wait to be handled before it fails with CodeTimeout; 0, the
+// default, means there is no limit.
+// It must be called before Run.
+func (b *Bifrost) SetRequestTimeout(timeout time.Duration) {
+	b.requestTimeout = timeout
+}
+
+// respond sends m to the client, counting it towards its batch if it acknowledges a batched request.
 func (b *Bifrost) respond(m message.Message) {
-	b.bifrost.Tx <- m
+	b.tx <- m
+	if m.Word() == core.RsAck {
+		b.countBatched(m)
+	}
 }
 
-func (b *Bifrost) close() {
-	close(b.bifrost.Tx)
+// maxNotices is the number of announcements that can wait to be sent before Announce starts dropping them.
+const maxNotices = 8
+
+// Announce sends m straight to the client, bypassing the Controller; it is safe to call from any goroutine.
+// This is for news about the Controller itself, such as it being wedged, that can't wait for it to broadcast.
+// Announce never blocks: it drops m if too many announcements are already waiting, returning false.
+func (b *Bifrost) Announce(m message.Message) bool {
+	select {
+	case b.notices <- m:
+		return true
+	default:
+		return false
+	}
 }
 
 // Run runs the main body of the Bifrost adapter.
 // It will immediately send the new client responses to the response channel.
 func (b *Bifrost) Run(ctx context.Context) {
-	defer b.close()
+	forwarded := make(chan struct{})
+	go func() {
+		b.forward()
+		close(forwarded)
+	}()
+	defer func() {
+		b.releaseAll()
+		close(b.tx)
+		<-forwarded
+		b.markDrained()
+	}()
 
 	if !b.handleNewClientResponses(ctx) {
 		return
 	}
 
+	drain := b.drain
 	for {
+		// Batched requests go ahead of anything else the client sends, so that they are handled in order.
+		rx := b.bifrost.Rx
+		if len(b.batched) != 0 {
+			rx = nil
+		}
+
 		// Closing the message channel is how the client tells us it has disconnected.
 		// Closing the response channel, or refusing a message,
 		// tells us the controller has shut down.
 		// Either way, we need to close.
 
 		select {
-		case rq, ok := <-b.bifrost.Rx:
+		case rq, ok := <-rx:
 			if !ok || !b.handleRequest(ctx, rq) {
 				return
 			}
+		case <-b.nextBatched():
+			if !b.handleBatched(ctx) {
+				return
+			}
 		case rs := <-b.reply:
+			if ack, ok := rs.Body.(DoneResponse); ok {
+				b.release(bifrostTagOf(rs), ack.Err)
+			}
 			b.handleResponseForwardingError(rs)
+			b.checkDrained()
+		case lr := <-b.logins:
+			if !b.handleLoginResult(ctx, lr) {
+				return
+			}
+			b.checkDrained()
+		case <-drain:
+			drain = nil
+			b.startDraining()
 		case rs, ok := <-b.client.Rx:
 			// No need to check b.client.Done:
 			// if the controller shuts down, it pull both this
 			// channel and Done at the same time.
 			if !ok {
+				b.flushCoalesced()
 				return
 			}
-			b.handleResponseForwardingError(rs)
+			// Clients that haven't logged in mustn't hear about the state.
+			if !b.authenticated() || b.shed(rs) {
+				continue
+			}
+			if rs, ok := b.tailor(rs); ok {
+				b.handleResponseCoalescing(rs)
+			}
+		case <-b.coalescer.expired():
+			b.flushCoalesced()
 		}
 	}
 }
@@ -101,15 +319,153 @@ func (b *Bifrost) Run(ctx context.Context) {
 // It returns whether the client is still able to handle
 // requests.
 func (b *Bifrost) handleRequest(ctx context.Context, rq message.Message) bool {
+	// Segmentation is a property of the connection, so the Controller never sees it.
+	// Segments may split characters, so their encoding is checked once they're reassembled.
+	if rq.Word() == bifrost.RqSeg {
+		return b.handleSegment(ctx, rq)
+	}
+	rq = b.dialect.request(rq)
+	if !b.words.Accepts(rq.Word()) {
+		b.respond(*b.errorToMessage(rq.Tag(), WordForbiddenError(rq.Word())))
+		return true
+	}
+
+	if err := bifrost.CheckEncoding(rq); err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return true
+	}
+	if b.normalise {
+		rq = bifrost.Normalise(rq)
+	}
+
+	switch rq.Word() {
+	case bifrost.RqSegSize:
+		b.handleSegSize(rq)
+		return true
+	case RqErrMode:
+		b.handleErrMode(rq)
+		return true
+	case RqCaps:
+		b.handleCaps(rq)
+		return true
+	case RqTime:
+		b.handleTime(rq)
+		return true
+	case RqVersion:
+		b.handleVersion(rq)
+		return true
+	case RqDescribe:
+		b.handleDescribe(rq)
+		return true
+	case RqLogin:
+		b.handleLogin(ctx, rq)
+		return true
+	}
+
+	if !b.authenticated() {
+		b.respond(*b.errorToMessage(rq.Tag(), ErrUnauthenticated))
+		return true
+	}
+	switch rq.Word() {
+	case RqCancel:
+		// Cancellation acts on the adapter's record of in-flight requests, so the Controller never sees it.
+		b.handleCancel(rq)
+		return true
+	case RqMotd:
+		b.handleMotd(rq)
+		return true
+	case RqDisplay:
+		b.handleDisplay(rq)
+		return true
+	case RqClients:
+		b.handleClients(rq)
+		return true
+	case RqTune:
+		b.handleTune(rq)
+		return true
+	case RqBatch:
+		b.handleBatch(rq)
+		return true
+	}
+
+	if b.checkDraining() {
+		b.respond(*b.errorToMessage(rq.Tag(), ErrShuttingDown))
+		return true
+	}
 	request, err := b.fromMessage(rq)
 	if err != nil {
-		b.respond(*errorToMessage(rq.Tag(), err))
+		b.respond(*b.errorToMessage(rq.Tag(), err))
 		return true
 	}
+	request.Origin.Ctx = b.requestContext(ctx, rq)
 
 	return b.client.Send(ctx, *request)
 }
 
+// inflightRequest is a request sent to the Controller, and not yet acknowledged.
+type inflightRequest struct {
+	// word is the request's word.
+	word string
+	// start is when the adapter read the request.
+	start time.Time
+	// cancel releases the request's context.
+	cancel context.CancelFunc
+	// span is the request's span in the adapter.
+	span trace.Span
+}
+
+// requestContext makes the context of the request rq, sent while the connection has context ctx.
+// It carries who the client logged in as, if anyone, the request timeout, if any, and the request's span; it ends when
+// the request is acknowledged, or the connection closes.
+func (b *Bifrost) requestContext(ctx context.Context, rq message.Message) context.Context {
+	if id := b.identity.Load(); id != nil {
+		ctx = WithIdentity(ctx, *id)
+	}
+	ctx, span := startSpan(ctx, "bifrost "+rq.Word(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(tagAttr(rq.Tag()), attribute.String("bifrost.word", rq.Word())))
+
+	var cancel context.CancelFunc
+	if b.requestTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, b.requestTimeout)
+	} else {
+		ctx, cancel = context.WithCancel(ctx)
+	}
+	b.inflight[rq.Tag()] = append(b.inflight[rq.Tag()], inflightRequest{
+		word: rq.Word(), start: time.Now(), cancel: cancel, span: span,
+	})
+	return ctx
+}
+
+// release releases the context, and ends the span, of the oldest request with tag tag that hasn't been acknowledged,
+// if there is one, reporting it if it was slow; the request failed with err if not nil.
+func (b *Bifrost) release(tag string, err error) {
+	rqs := b.inflight[tag]
+	if len(rqs) == 0 {
+		return
+	}
+	rqs[0].cancel()
+	endSpan(rqs[0].span, err)
+	b.checkSlow(tag, rqs[0], err)
+	b.checkDenied(rqs[0].word, tag, err)
+	if len(rqs) == 1 {
+		delete(b.inflight, tag)
+		return
+	}
+	b.inflight[tag] = rqs[1:]
+}
+
+// releaseAll releases the contexts, and ends the spans, of every request that hasn't been acknowledged.
+func (b *Bifrost) releaseAll() {
+	for tag, rqs := range b.inflight {
+		for _, rq := range rqs {
+			rq.cancel()
+			endSpan(rq.span, errUnacknowledged)
+		}
+		delete(b.inflight, tag)
+	}
+}
+
 // fromMessage tries to parse a message as a controller request.
 func (b *Bifrost) fromMessage(m message.Message) (*Request, error) {
 	rbody, err := b.bodyFromMessage(m)
@@ -124,10 +480,13 @@ func (b *Bifrost) fromMessage(m message.Message) (*Request, error) {
 func (b *Bifrost) bodyFromMessage(m message.Message) (interface{}, error) {
 	// Standard requests first.
 	switch m.Word() {
-	case "dump":
+	case RqDump:
 		return parseDumpMessage(m.Args())
 	default:
-		return comm.ParseMessage(&m)
+		if b.parser == nil {
+			return nil, UnknownWord(m.Word())
+		}
+		return b.parser.ParseBifrostRequest(m.Word(), m.Args())
 	}
 }
 
@@ -151,8 +510,8 @@ func makeRequest(rbody interface{}, tag string, rch chan<- Response) *Request {
 
 // parseDumpMessage tries to parse a 'dump' message.
 func parseDumpMessage(args []string) (interface{}, error) {
-	if len(args) != 0 {
-		return nil, fmt.Errorf("bad arity")
+	if err := bifrost.Args(args).Err(); err != nil {
+		return nil, err
 	}
 
 	return DumpRequest{}, nil
@@ -172,22 +531,54 @@ func (b *Bifrost) handleNewClientResponses(ctx context.Context) bool {
 
 	// We don't use b.reply here, because we want to suppress ACK.
 	ncreply := make(chan Response)
+	if !b.fetchParser(ctx, ncreply) {
+		return false
+	}
 	if !b.client.Send(ctx, *makeRequest(RoleRequest{}, message.TagBcast, ncreply)) {
 		return false
 	}
 	if ProcessRepliesUntilAck(ncreply, b.handleResponse) != nil {
 		return false
 	}
+	b.sendMotd()
+	// Clients that need to log in get the dump once they have; see handleLoginResult.
+	if !b.authenticated() {
+		return true
+	}
 	if !b.client.Send(ctx, *makeRequest(DumpRequest{}, message.TagBcast, ncreply)) {
 		return false
 	}
-	return ProcessRepliesUntilAck(ncreply, b.handleResponse) == nil
+	if err := ProcessRepliesUntilAck(ncreply, b.handleResponse); err != nil {
+		if !isFailure(err) {
+			return false
+		}
+		// A broken state shouldn't stop clients connecting, if only to find out that it's broken.
+		b.respond(*b.errorToMessage(message.TagBcast, err))
+	}
+	return true
+}
+
+// fetchParser asks the Controller for its state's BifrostParser, using reply for replies.
+// It returns false if the Controller went away midway through.
+func (b *Bifrost) fetchParser(ctx context.Context, reply chan Response) bool {
+	if !b.client.Send(ctx, *makeRequest(bifrostParserRequest{}, message.TagBcast, reply)) {
+		return false
+	}
+	cb := func(r Response) error {
+		if pr, ok := r.Body.(bifrostParserResponse); ok {
+			b.parser = pr.Parser
+		}
+		return nil
+	}
+	err := ProcessRepliesUntilAck(reply, cb)
+	// States that can't parse Bifrost still get the standard requests.
+	return err == nil || errors.Is(err, ErrControllerCannotSpeakBifrost)
 }
 
 func (b *Bifrost) sendOhai() {
 	ohai := core.OhaiResponse{
 		ProtocolVer: core.ThisProtocolVer,
-		ServerVer:   sversion,
+		ServerVer:   version.Get().Server(),
 	}
 	b.respond(*ohai.Message(message.TagBcast))
 }
@@ -196,13 +587,14 @@ func (b *Bifrost) sendOhai() {
 // the error as a // message.
 func (b *Bifrost) handleResponseForwardingError(rs Response) {
 	if err := b.handleResponse(rs); err != nil {
-		b.respond(*errorToMessage(bifrostTagOf(rs), err))
+		b.respond(*b.errorToMessage(bifrostTagOf(rs), err))
 	}
 }
 
 // handleResponse handles a controller response rs.
 func (b *Bifrost) handleResponse(rs Response) error {
 	tag := bifrostTagOf(rs)
+	b.stampSeq(rs)
 
 	switch r := rs.Body.(type) {
 	case DoneResponse:
@@ -210,10 +602,13 @@ func (b *Bifrost) handleResponse(rs Response) error {
 	case core.IamaResponse:
 		return b.handleRole(tag, r)
 	case comm.Messager:
-		b.bifrost.Send(context.Background(), *r.Message(tag))
+		b.respond(*r.Message(tag))
 		return nil
 	default:
-		return fmt.Errorf("can't turn %v into a message", r)
+		if b.parser == nil {
+			return fmt.Errorf("can't turn %v into a message", r)
+		}
+		return b.parser.EmitBifrostResponse(tag, r, b.tx)
 	}
 }
 
@@ -246,9 +641,3 @@ func (b *Bifrost) handleRole(t string, r core.IamaResponse) error {
 	b.respond(*((&r).Message(t)))
 	return nil
 }
-
-// errorToMessage converts the error e to a Bifrost message sent to tag t.
-func errorToMessage(t string, e error) *message.Message {
-	// TODO(@MattWindsor91): figure out whether e is a WHAT or a FAIL.
-	return message.New(t, core.RsAck).AddArgs("WHAT", e.Error())
-}
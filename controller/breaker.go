@@ -0,0 +1,254 @@
+package controller
+
+// File breaker.go contains circuit breakers on mount points, which stop a sick mount from tying up the Controller and
+// its clients.
+//
+// A breaker watches the outcomes of the requests forwarded to its mount.
+// Once too many fail in a row, or too many of the most recent fail, the breaker opens: the mount is degraded, and
+// requests to it fail at once with the code 'degraded', without being forwarded.
+// Requests the mount doesn't take, or acknowledge, within the breaker's timeout count as failures; requests that fail
+// through the client's own fault don't count at all.
+// While open, the breaker pings the mount every so often, and closes as soon as the mount answers a ping in time.
+// A ping only shows that the mount is answering at all; if its requests still fail, they soon open the breaker again.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+const (
+	// CodeDegraded is the error code of MountDegradedErrors.
+	CodeDegraded = "degraded"
+
+	// DefaultProbeInterval is how often a breaker pings a degraded mount, if not told otherwise.
+	DefaultProbeInterval = 5 * time.Second
+)
+
+// MountDegradedError is the error returned, without forwarding, for requests to a mount whose breaker is open.
+type MountDegradedError struct {
+	// MountPoint is the name of the degraded mount point.
+	MountPoint string
+}
+
+// Error gets the error message of a MountDegradedError.
+func (e MountDegradedError) Error() string {
+	return fmt.Sprintf("mount point %s is degraded, and not taking requests", e.MountPoint)
+}
+
+// Code gets the error code of a MountDegradedError.
+func (MountDegradedError) Code() string {
+	return CodeDegraded
+}
+
+// Blame blames the server for a MountDegradedError.
+func (MountDegradedError) Blame() core.Blame {
+	return core.BlameServer
+}
+
+// BreakerConfig configures the circuit breaker on a mount point.
+type BreakerConfig struct {
+	// Failures is how many forwarded requests in a row may fail before the breaker opens; 0 means any number.
+	Failures int
+	// Window is how many of the most recent forwarded requests ErrorRate looks at; 0 means the breaker doesn't look
+	// at the error rate.
+	Window int
+	// ErrorRate is the fraction, from 0 to 1, of the last Window requests that must fail before the breaker opens.
+	// The breaker doesn't look at the error rate until Window requests have been forwarded.
+	ErrorRate float64
+	// Timeout is how long the mount has to take and acknowledge each request, and each probe; 0 means no limit.
+	Timeout time.Duration
+	// ProbeInterval is how often the breaker pings the mount while open; 0 means DefaultProbeInterval.
+	ProbeInterval time.Duration
+}
+
+// breaker is the state of the circuit breaker on a mount point.
+// Its outcomes come from both the Controller and its relays, so it has its own lock.
+type breaker struct {
+	// cfg is the breaker's configuration.
+	cfg BreakerConfig
+
+	// mu guards the fields below.
+	mu sync.Mutex
+	// open is true while the mount is degraded.
+	open bool
+	// streak is the number of requests in a row that have failed.
+	streak int
+	// recent records whether each of the last cfg.Window requests failed, as a ring buffer.
+	recent []bool
+	// nrecent is the number of requests recorded in recent, up to cfg.Window.
+	nrecent int
+	// next is the index in recent of the next request to record.
+	next int
+}
+
+// SetMountBreaker puts a circuit breaker configured by cfg on the mount point name, which must already be mounted.
+// It must be called before Run.
+func (c *Controller) SetMountBreaker(name string, cfg BreakerConfig) {
+	if c.breakers == nil {
+		c.breakers = make(map[string]*breaker)
+	}
+	c.breakers[name] = &breaker{cfg: cfg, recent: make([]bool, cfg.Window)}
+}
+
+// isOpen gets whether b is open, and so its mount degraded.
+// A nil breaker is never open.
+func (b *breaker) isOpen() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+// timeout gets how long b gives its mount to take and acknowledge each request, or 0 for no limit.
+func (b *breaker) timeout() time.Duration {
+	if b == nil {
+		return 0
+	}
+	return b.cfg.Timeout
+}
+
+// record records the outcome of a forwarded request, which failed with err if not nil.
+// It returns true if this outcome opened b, in which case the caller must start probing the mount.
+func (b *breaker) record(err error) bool {
+	if b == nil {
+		return false
+	}
+	failed := countsAgainstMount(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if failed {
+		b.streak++
+	} else {
+		b.streak = 0
+	}
+	nfailed := 0
+	if 0 < b.cfg.Window {
+		b.recent[b.next] = failed
+		b.next = (b.next + 1) % b.cfg.Window
+		if b.nrecent < b.cfg.Window {
+			b.nrecent++
+		}
+		for _, f := range b.recent[:b.nrecent] {
+			if f {
+				nfailed++
+			}
+		}
+	}
+
+	if b.open || !failed {
+		return false
+	}
+	tooMany := 0 < b.cfg.Failures && b.cfg.Failures <= b.streak
+	tooOften := b.nrecent == b.cfg.Window && 0 < b.cfg.Window &&
+		b.cfg.ErrorRate <= float64(nfailed)/float64(b.cfg.Window)
+	b.open = tooMany || tooOften
+	return b.open
+}
+
+// close closes b, forgetting its history, once its mount has recovered.
+func (b *breaker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.open = false
+	b.streak = 0
+	b.nrecent = 0
+	b.next = 0
+}
+
+// probeInterval gets how often b pings its mount while open.
+func (b *breaker) probeInterval() time.Duration {
+	if b.cfg.ProbeInterval <= 0 {
+		return DefaultProbeInterval
+	}
+	return b.cfg.ProbeInterval
+}
+
+// countsAgainstMount gets whether a forwarded request failing with err is a sign that the mount is unwell.
+// Requests that fail through the client's fault, or because the client gave up on them, don't count.
+func countsAgainstMount(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	var b core.Blameable
+	return !errors.As(err, &b) || b.Blame() != core.BlameClient
+}
+
+// tripMount reports that the breaker on the mount point name has opened, and starts probing the mount.
+func (c *Controller) tripMount(ctx context.Context, name string, b *breaker) {
+	c.log.Printf("mount point %s is failing; degrading it until it recovers\n", name)
+	mountMetrics.Add(name+".trips", 1)
+	go c.probeMount(ctx, name, b)
+}
+
+// probeMount pings the mount point name every so often, closing its breaker b once the mount answers in time.
+func (c *Controller) probeMount(ctx context.Context, name string, b *breaker) {
+	ticker := time.NewTicker(b.probeInterval())
+	defer ticker.Stop()
+
+	m := c.mounts[name]
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		if err := pingMount(ctx, &m, b.timeout()); err != nil {
+			continue
+		}
+		b.close()
+		c.log.Printf("mount point %s has recovered\n", name)
+		return
+	}
+}
+
+// pingMount pings the mount behind m, giving it timeout (if not 0) to answer.
+func pingMount(ctx context.Context, m *Client, timeout time.Duration) error {
+	if 0 < timeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	replies := make(chan Response)
+	if !m.Send(ctx, Request{Origin: RequestOrigin{ReplyTx: replies, Ctx: ctx}, Body: pingRequest{}}) {
+		return contextError(ctx.Err())
+	}
+	for {
+		select {
+		case rs := <-replies:
+			if ack, ok := rs.Body.(DoneResponse); ok {
+				return ack.Err
+			}
+		case <-ctx.Done():
+			// The mount still has to send its acknowledgement somewhere.
+			go drainUntilAck(replies)
+			return contextError(ctx.Err())
+		}
+	}
+}
+
+// drainUntilAck throws away replies until the acknowledgement, so that a mount that answers late doesn't block.
+func drainUntilAck(replies <-chan Response) {
+	for rs := range replies {
+		if _, ok := rs.Body.(DoneResponse); ok {
+			return
+		}
+	}
+}
+
+// mountTimeoutError gets the error for a request that the mount point name didn't take, or answer, within timeout.
+func mountTimeoutError(name string, timeout time.Duration) error {
+	return bifrost.WithCode(CodeTimeout, fmt.Errorf("mount point %s didn't answer within %s", name, timeout))
+}
@@ -0,0 +1,52 @@
+package controller
+
+// File cancel.go contains the Bifrost adapter's handling of 'cancel' requests.
+//
+// 'cancel <tag>' cancels the contexts of the client's unacknowledged requests with tag <tag>.
+// Requests still waiting to be handled are never handled, and Controllables give up on long requests, such as big
+// searches and dumps, as soon as they notice; either way, the request is acknowledged with 'ACK WHAT cancelled',
+// whatever the error mode, so that clients can tell cancellation from failure.
+// The 'cancel' itself is acknowledged straight away, and fails only if there is nothing with that tag to cancel.
+// Requests already done when the cancellation arrives are unaffected.
+
+import (
+	"errors"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// RqCancel is the word of requests to cancel in-flight requests.
+const RqCancel = "cancel"
+
+// ErrNotInFlight is the error returned when a client cancels a tag with no unacknowledged requests.
+var ErrNotInFlight = errors.New("no request with that tag is in flight")
+
+// handleCancel handles a request rq to cancel in-flight requests.
+func (b *Bifrost) handleCancel(rq message.Message) {
+	var tag string
+	err := bifrost.Args(rq.Args()).String(0, &tag).Err()
+	if err == nil {
+		err = b.cancel(tag)
+	}
+	if err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return
+	}
+	b.respond(*message.New(rq.Tag(), core.RsAck).AddArgs("OK", "success"))
+}
+
+// cancel cancels the contexts of every unacknowledged request with tag tag.
+// Their contexts are released, and forgotten, when they are acknowledged.
+func (b *Bifrost) cancel(tag string) error {
+	rqs := b.inflight[tag]
+	if len(rqs) == 0 {
+		return ErrNotInFlight
+	}
+	for _, rq := range rqs {
+		rq.cancel()
+	}
+	return nil
+}
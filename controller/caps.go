@@ -0,0 +1,124 @@
+package controller
+
+// File caps.go contains the Bifrost adapter's handling of client capabilities, which tailor the broadcasts each client
+// gets to what it can use, rather than sending every client the same full stream.
+//
+// Clients declare what they can do with 'caps <capability>...', usually straight after the handshake:
+//
+//	meta     -- the client shows item details, such as notes and categories, and wants to hear when they change
+//	diff     -- the client applies changes to single items itself; without it, such changes arrive as region
+//	            broadcasts (see region.go) naming the items to fetch again
+//	minimal  -- the client only wants broadcasts about the state itself, not about how the server is doing
+//	seq      -- the client wants each broadcast stamped with its sequence number (see seq.go)
+//
+// A client that never sends 'caps' gets every broadcast, as before capabilities existed.
+// The adapter replies with 'CAPS' listing the capabilities it understood, ignoring any others, so that newer clients
+// can declare capabilities older servers don't have.
+// Capabilities only tailor broadcasts: replies, such as dumps, are always in full.
+
+import (
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+)
+
+const (
+	// RqCaps is the word of requests declaring the client's capabilities.
+	RqCaps = "caps"
+	// RsCaps is the word of replies listing the capabilities the adapter understood.
+	RsCaps = "CAPS"
+
+	// CapMeta is the capability of clients that want broadcasts in BroadcastMeta.
+	CapMeta = "meta"
+	// CapDiff is the capability of clients that apply changes to single items themselves.
+	CapDiff = "diff"
+	// CapMinimal is the capability of clients that don't want broadcasts in BroadcastStatus.
+	CapMinimal = "minimal"
+)
+
+// BroadcastClass is the class of a broadcast, by which the adapter decides which clients get it.
+type BroadcastClass int
+
+const (
+	// BroadcastCore is the class of broadcasts about the state's shape and its most important parts, such as which
+	// item is selected; every client gets them.
+	BroadcastCore BroadcastClass = iota
+	// BroadcastMeta is the class of broadcasts about the details of the state, such as item notes.
+	BroadcastMeta
+	// BroadcastStatus is the class of broadcasts about how the server is doing, rather than the state itself, such as
+	// alerts.
+	BroadcastStatus
+)
+
+// BroadcastClassifier is the interface of BifrostParsers that sort their broadcasts into classes.
+// Broadcasts of parsers that don't are all in BroadcastCore.
+type BroadcastClassifier interface {
+	// BroadcastClass gets the class of broadcast body rbody.
+	BroadcastClass(rbody interface{}) BroadcastClass
+}
+
+// capabilities is the set of capabilities a client has declared.
+type capabilities struct {
+	// meta, diff, minimal and seq are set if the client declared CapMeta, CapDiff, CapMinimal and CapSeq
+	// respectively.
+	meta, diff, minimal, seq bool
+}
+
+// handleCaps handles a request rq declaring the client's capabilities.
+func (b *Bifrost) handleCaps(rq message.Message) {
+	var (
+		caps capabilities
+		// known holds the capabilities understood, each once, in the order declared.
+		known []string
+	)
+	for _, c := range rq.Args() {
+		var flag *bool
+		switch c {
+		case CapMeta:
+			flag = &caps.meta
+		case CapDiff:
+			flag = &caps.diff
+		case CapMinimal:
+			flag = &caps.minimal
+		case CapSeq:
+			flag = &caps.seq
+		default:
+			continue
+		}
+		if !*flag {
+			*flag = true
+			known = append(known, c)
+		}
+	}
+
+	b.caps = &caps
+	b.respond(*message.New(rq.Tag(), RsCaps).AddArgs(known...))
+	b.respond(*message.New(rq.Tag(), core.RsAck).AddArgs("OK", "success"))
+}
+
+// tailor gets the form in which the client gets broadcast rs, given its capabilities, and false if it doesn't get rs
+// at all.
+func (b *Bifrost) tailor(rs Response) (Response, bool) {
+	if b.caps == nil || !rs.Broadcast {
+		return rs, true
+	}
+
+	class := BroadcastCore
+	if bc, ok := b.parser.(BroadcastClassifier); ok {
+		class = bc.BroadcastClass(rs.Body)
+	}
+	switch {
+	case class == BroadcastMeta && !b.caps.meta:
+		return rs, false
+	case class == BroadcastStatus && b.caps.minimal:
+		return rs, false
+	}
+
+	if !b.caps.diff {
+		if br, ok := b.parser.(BroadcastRegioner); ok {
+			if idx, ok := br.BroadcastIndex(rs.Body); ok {
+				return Response{Broadcast: true, Body: br.RegionBroadcast(idx, 1), Seq: rs.Seq}, true
+			}
+		}
+	}
+	return rs, true
+}
@@ -48,12 +48,36 @@ func (c *Client) Send(ctx context.Context, r Request) bool {
 //
 // If Copy returns an error, then the Controller shut down during the copy.
 func (c *Client) Copy(ctx context.Context) (*Client, error) {
-	var ncli *Client
+	return c.copy(ctx, newClientRequest{}, nil)
+}
+
+// CopyWithDump is like Copy, but also feeds the Controller's dump into dumpCb before returning.
+// The dump is taken at the same point the new Client starts receiving broadcasts, so the first broadcast on its Rx is
+// the first change the dump doesn't already include: the new Client neither misses nor repeats any change.
+//
+// If dumpCb returns an error, CopyWithDump hangs up the new Client and returns the error.
+func (c *Client) CopyWithDump(ctx context.Context, dumpCb func(Response) error) (*Client, error) {
+	return c.copy(ctx, newClientRequest{Dump: true}, dumpCb)
+}
+
+// copy sends the new client request b, feeding any replies other than the new client into dumpCb.
+func (c *Client) copy(ctx context.Context, b newClientRequest, dumpCb func(Response) error) (*Client, error) {
+	var (
+		ncli    *Client
+		dumpErr error
+	)
 
 	cb := func(r Response) error {
 		b, ok := r.Body.(newClientResponse)
 		if !ok {
-			return fmt.Errorf("got an unexpected response")
+			if dumpCb == nil {
+				return fmt.Errorf("got an unexpected response")
+			}
+			// We still need the new client, even if dumpCb fails, so that we can hang it up.
+			if dumpErr == nil {
+				dumpErr = dumpCb(r)
+			}
+			return nil
 		}
 		if ncli != nil {
 			return fmt.Errorf("got a duplicate client response")
@@ -66,7 +90,7 @@ func (c *Client) Copy(ctx context.Context) (*Client, error) {
 		return nil
 	}
 
-	alive, err := c.SendAndProcessReplies(ctx, "", newClientRequest{}, cb)
+	alive, err := c.SendAndProcessReplies(ctx, "", b, cb)
 	if !alive {
 		return nil, ErrControllerShutDown
 	}
@@ -76,10 +100,23 @@ func (c *Client) Copy(ctx context.Context) (*Client, error) {
 	if ncli == nil {
 		return nil, fmt.Errorf("didn't get a new client")
 	}
+	if dumpErr != nil {
+		ncli.hangUp()
+		return nil, dumpErr
+	}
 
 	return ncli, nil
 }
 
+// hangUp disconnects c from its Controller, draining its broadcasts until the Controller notices.
+func (c *Client) hangUp() {
+	close(c.Tx)
+	go func() {
+		for range c.Rx {
+		}
+	}()
+}
+
 // Shutdown asks a Client to shut down its Controller.
 // This is equivalent to sending a ShutdownRequest through the Client,
 // but handles the various bits of paperwork.
@@ -138,6 +175,30 @@ func (c *Client) SendAndProcessReplies(ctx context.Context, tag string, body int
 	return true, ProcessRepliesUntilAck(reply, cb)
 }
 
+// Call sends a request with body body, and waits for it to be acknowledged, ignoring any other replies.
+// It returns the request's error, or ErrControllerShutDown if the request couldn't be sent, as the Controller shut
+// down or ctx ended first.
+func (c *Client) Call(ctx context.Context, body interface{}) error {
+	_, err := c.CallReplies(ctx, body)
+	return err
+}
+
+// CallReplies sends a request with body body, and waits for it to be acknowledged, returning the bodies of the other
+// replies in the order they came.
+// It returns the request's error, or ErrControllerShutDown if the request couldn't be sent, as the Controller shut
+// down or ctx ended first.
+func (c *Client) CallReplies(ctx context.Context, body interface{}) ([]interface{}, error) {
+	var rbodies []interface{}
+	alive, err := c.SendAndProcessReplies(ctx, "", body, func(r Response) error {
+		rbodies = append(rbodies, r.Body)
+		return nil
+	})
+	if !alive {
+		return nil, ErrControllerShutDown
+	}
+	return rbodies, err
+}
+
 // coclient is the type of internal client handles.
 type coclient struct {
 	// tx is the status update send channel.
@@ -145,6 +206,9 @@ type coclient struct {
 
 	// rx is the request receiver channel.
 	rx <-chan Request
+
+	// session is the client's session.
+	session Session
 }
 
 // Close does the disconnection part of a client hangup.
@@ -0,0 +1,134 @@
+package controller
+
+// File clients.go contains the Bifrost adapter's handling of 'clients' requests, which list the server's connections
+// for admins tracking down misbehaving clients.
+//
+// The reply is one
+// 'CLIENT <name> <user> <bytes-in> <bytes-out> <messages-in> <messages-out> <throttled> <queued> <dropped>' per
+// connection, where the user is '-' for clients that haven't logged in, 'throttled' counts the times the connection
+// was held back by its bandwidth cap, and 'queued' and 'dropped' are the messages waiting in its send buffer and the
+// broadcasts dropped when it was full (see sendbuf.go).
+// Query options (see bifrost.QueryOptions) can sort and filter the connections by the fields in clientFields.
+// The adapter only knows about its own connection, so the server lists the others through a ClientLister.
+
+import (
+	"strconv"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+const (
+	// RqClients is the word of requests for the server's connections.
+	RqClients = "clients"
+	// RsClient is the word of messages describing one of the server's connections.
+	RsClient = "CLIENT"
+)
+
+// ClientStats describes one of a server's connections, and the traffic over it.
+type ClientStats struct {
+	// Name names the connection, usually by its remote address.
+	Name string
+	// User is who the client logged in as, or empty if it hasn't.
+	User string
+	// BytesIn and BytesOut count the bytes the client has sent and been sent.
+	BytesIn, BytesOut int64
+	// MessagesIn and MessagesOut count the messages the client has sent and been sent.
+	MessagesIn, MessagesOut int64
+	// Throttled counts the times the connection was held back by its bandwidth cap.
+	Throttled int64
+	// Queued is the number of messages waiting in the connection's send buffer.
+	Queued int64
+	// Dropped counts the broadcasts dropped because the connection's send buffer was full.
+	Dropped int64
+}
+
+// Message converts ClientStats into a Bifrost message with tag tag.
+func (c ClientStats) Message(tag string) *message.Message {
+	user := c.User
+	if user == "" {
+		user = "-"
+	}
+	return message.New(tag, RsClient).AddArgs(
+		c.Name,
+		user,
+		strconv.FormatInt(c.BytesIn, 10),
+		strconv.FormatInt(c.BytesOut, 10),
+		strconv.FormatInt(c.MessagesIn, 10),
+		strconv.FormatInt(c.MessagesOut, 10),
+		strconv.FormatInt(c.Throttled, 10),
+		strconv.FormatInt(c.Queued, 10),
+		strconv.FormatInt(c.Dropped, 10),
+	)
+}
+
+// clientFields are the fields by which 'clients' requests may sort and filter connections.
+var clientFields = []string{
+	"name", "user", "bytesin", "bytesout", "messagesin", "messagesout", "throttled", "queued", "dropped",
+}
+
+// QueryField gets the field called name of c, for sorting and filtering; see clientFields.
+func (c ClientStats) QueryField(name string) string {
+	switch name {
+	case "name":
+		return c.Name
+	case "user":
+		return c.User
+	case "bytesin":
+		return strconv.FormatInt(c.BytesIn, 10)
+	case "bytesout":
+		return strconv.FormatInt(c.BytesOut, 10)
+	case "messagesin":
+		return strconv.FormatInt(c.MessagesIn, 10)
+	case "messagesout":
+		return strconv.FormatInt(c.MessagesOut, 10)
+	case "throttled":
+		return strconv.FormatInt(c.Throttled, 10)
+	case "queued":
+		return strconv.FormatInt(c.Queued, 10)
+	case "dropped":
+		return strconv.FormatInt(c.Dropped, 10)
+	default:
+		return ""
+	}
+}
+
+// ClientLister is the type of functions that describe every connection to a server.
+// They are called from adapter goroutines, so must be safe to call from many goroutines at once.
+type ClientLister func() []ClientStats
+
+// SetClientLister sets the function the adapter uses to answer 'clients' requests, and the group whose members may
+// make them; an empty group means that any client that may make requests may.
+// A nil lister, the default, means that the adapter doesn't answer them.
+// It must be called before Run.
+func (b *Bifrost) SetClientLister(list ClientLister, admins string) {
+	b.listClients = list
+	b.clientAdmins = admins
+}
+
+// handleClients handles a request rq for the server's connections.
+func (b *Bifrost) handleClients(rq message.Message) {
+	if b.listClients == nil {
+		b.respond(*b.errorToMessage(rq.Tag(), UnknownWord(rq.Word())))
+		return
+	}
+	args, opts, err := bifrost.SplitQuery(rq.Args(), clientFields...)
+	if err == nil {
+		err = bifrost.Args(args).Err()
+	}
+	if err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return
+	}
+	if err := CheckAdmin(b.identity.Load(), b.clientAdmins); err != nil {
+		b.deny(rq, err)
+		return
+	}
+
+	for _, c := range bifrost.ApplyQuery(opts, b.listClients()) {
+		b.respond(*c.Message(rq.Tag()))
+	}
+	b.respond(*message.New(rq.Tag(), core.RsAck).AddArgs("OK", "success"))
+}
@@ -0,0 +1,49 @@
+package controller
+
+// File clock.go contains the server clock that Bifrost clients can synchronise against.
+//
+// A TIME message carries the server's wall-clock time, in RFC 3339 format with nanoseconds, and its monotonic time,
+// in milliseconds since the server started.
+// Clients that send 'time <token>' get the token echoed back as a third argument, so they can match the reply to
+// their request and estimate the round trip.
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+const (
+	// RqTime is the word of requests for the server's time.
+	RqTime = "time"
+	// RsTime is the word of messages announcing the server's time.
+	RsTime = "TIME"
+)
+
+// serverStart is when the server started; monotonic times count from it.
+var serverStart = time.Now()
+
+// TimeMessage creates a TIME message with tag tag, carrying the server's current time.
+func TimeMessage(tag string) *message.Message {
+	now := time.Now()
+	mono := now.Sub(serverStart).Milliseconds()
+	return message.New(tag, RsTime).AddArgs(now.Format(time.RFC3339Nano), strconv.FormatInt(mono, 10))
+}
+
+// handleTime handles a request rq for the server's time.
+func (b *Bifrost) handleTime(rq message.Message) {
+	var token string
+	if err := bifrost.Args(rq.Args()).Optional().String(0, &token).Err(); err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return
+	}
+
+	m := TimeMessage(rq.Tag())
+	if token != "" {
+		m.AddArgs(token)
+	}
+	b.respond(*m)
+}
@@ -0,0 +1,118 @@
+package controller
+
+// File coalesce.go contains the Bifrost adapter's coalescing of rapid broadcasts.
+//
+// When coalescing is on, a broadcast that its state's parser gives a coalesce key waits, for up to the coalescing
+// window, in case a newer broadcast with the same key replaces it.
+// Any other broadcast flushes the waiting broadcasts first, so clients never see changes to the state's shape out of
+// order with the changes they affect.
+// Unicast replies pass straight through: they describe the same state as the waiting broadcasts.
+
+import (
+	"time"
+)
+
+// BroadcastCoalescer is the interface of BifrostParsers that know which broadcasts supersede each other.
+type BroadcastCoalescer interface {
+	// CoalesceKey gets the key of broadcast body rbody, and true, if a later broadcast with the same key makes rbody
+	// redundant; otherwise, it returns false.
+	CoalesceKey(rbody interface{}) (string, bool)
+}
+
+// coalescer holds broadcasts waiting to be sent by a Bifrost adapter.
+type coalescer struct {
+	// window is the longest a broadcast may wait; 0 means coalescing is off.
+	window time.Duration
+
+	// keys holds the keys of waiting broadcasts, oldest first.
+	keys []string
+
+	// pending maps the keys in keys to their waiting broadcasts.
+	pending map[string]Response
+
+	// timer fires when the oldest waiting broadcast has waited for window; it is nil if nothing is waiting.
+	timer *time.Timer
+}
+
+// SetCoalesce sets the window within which the adapter coalesces broadcasts that supersede each other.
+// A window of 0, the default, sends every broadcast as it arrives.
+// It must be called before Run.
+func (b *Bifrost) SetCoalesce(window time.Duration) {
+	b.coalescer.window = window
+}
+
+// expired gets a channel that receives when the waiting broadcasts must be flushed, or nil if none are waiting.
+func (c *coalescer) expired() <-chan time.Time {
+	if c.timer == nil {
+		return nil
+	}
+	return c.timer.C
+}
+
+// handleResponseCoalescing handles a controller response rs, holding it back if it can be coalesced.
+func (b *Bifrost) handleResponseCoalescing(rs Response) {
+	if key, ok := b.coalesceKey(rs); ok {
+		b.coalescer.hold(key, rs)
+		return
+	}
+	if rs.Broadcast {
+		b.flushCoalesced()
+	}
+	b.handleResponseForwardingError(rs)
+}
+
+// coalesceKey gets the coalesce key of rs, if coalescing is on and rs is a broadcast that has one.
+func (b *Bifrost) coalesceKey(rs Response) (string, bool) {
+	if b.coalescer.window <= 0 || !rs.Broadcast {
+		return "", false
+	}
+	bc, ok := b.parser.(BroadcastCoalescer)
+	if !ok {
+		return "", false
+	}
+	return bc.CoalesceKey(rs.Body)
+}
+
+// hold makes rs wait under key, replacing and taking the place of any broadcast already waiting under key.
+func (c *coalescer) hold(key string, rs Response) {
+	if c.pending == nil {
+		c.pending = make(map[string]Response)
+	}
+	if _, ok := c.pending[key]; ok {
+		// Moving the key to the end keeps the newest state last.
+		for i, k := range c.keys {
+			if k == key {
+				c.keys = append(c.keys[:i], c.keys[i+1:]...)
+				break
+			}
+		}
+	}
+	c.keys = append(c.keys, key)
+	c.pending[key] = rs
+
+	if c.timer == nil {
+		c.timer = time.NewTimer(c.window)
+	}
+}
+
+// flushCoalesced sends every waiting broadcast, oldest first, folding item broadcasts into a region if there are enough
+// of them (see region.go).
+func (b *Bifrost) flushCoalesced() {
+	c := &b.coalescer
+	if c.timer == nil {
+		return
+	}
+	c.timer.Stop()
+	c.timer = nil
+
+	rss := make([]Response, 0, len(c.keys))
+	for _, k := range c.keys {
+		rss = append(rss, c.pending[k])
+		delete(c.pending, k)
+	}
+	c.keys = c.keys[:0]
+
+	for _, rs := range b.foldRegion(rss) {
+		b.handleResponseForwardingError(rs)
+	}
+}
@@ -0,0 +1,88 @@
+package controller
+
+// File context.go contains the values carried in each request's context, for Controllables that need to know more
+// about a request than its body.
+//
+// Each request's context carries:
+// - who asked, if they logged in (see WithIdentity);
+// - the mount points the request passed through on its way to this Controller (see WithNamespace);
+// - a deadline, if whoever sent the request is only prepared to wait so long for it.
+// The Controller doesn't handle requests whose context has ended by the time it gets to them.
+// Controllables doing something long, such as sending many replies, should give up when the context ends, returning
+// its error: the Controller turns it into a 'timeout' or 'cancelled' error.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+const (
+	// CodeTimeout is the error code of requests whose deadline passed before they were done.
+	CodeTimeout = "timeout"
+	// CodeCancelled is the error code of requests cancelled before they were done.
+	CodeCancelled = "cancelled"
+)
+
+// contextKey is the type of keys of the values the controller package keeps in contexts.
+type contextKey int
+
+const (
+	// identityKey is the key of the identity of whoever sent a request.
+	identityKey contextKey = iota
+	// namespaceKey is the key of the namespace of a request.
+	namespaceKey
+)
+
+// WithIdentity gets a copy of ctx saying that requests made with it come from id.
+func WithIdentity(ctx context.Context, id auth.Identity) context.Context {
+	return context.WithValue(ctx, identityKey, id)
+}
+
+// IdentityFrom gets who made a request with context ctx, and whether they are known at all.
+func IdentityFrom(ctx context.Context) (auth.Identity, bool) {
+	id, ok := ctx.Value(identityKey).(auth.Identity)
+	return id, ok
+}
+
+// WithNamespace gets a copy of ctx saying that requests made with it are in namespace ns.
+func WithNamespace(ctx context.Context, ns string) context.Context {
+	return context.WithValue(ctx, namespaceKey, ns)
+}
+
+// NamespaceFrom gets the namespace of a request with context ctx.
+// This is the path of mount points, separated by '/', through which the request came; it is empty for requests
+// sent straight to a Controller.
+func NamespaceFrom(ctx context.Context) string {
+	ns, _ := ctx.Value(namespaceKey).(string)
+	return ns
+}
+
+// mountNamespace gets a copy of ctx for requests forwarded from it to the mount point name.
+func mountNamespace(ctx context.Context, name string) context.Context {
+	if ns := NamespaceFrom(ctx); ns != "" {
+		name = ns + "/" + name
+	}
+	return WithNamespace(ctx, name)
+}
+
+// checkContext gets the reason, if any, that a request with origin o shouldn't be handled any more.
+func checkContext(o RequestOrigin) error {
+	return contextError(o.Context().Err())
+}
+
+// contextError gives err, if it comes from a request's context ending, the error code saying why.
+// Other errors come back as they are.
+func contextError(err error) error {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return bifrost.WithCode(CodeTimeout, fmt.Errorf("request timed out: %w", err))
+	case errors.Is(err, context.Canceled):
+		return bifrost.WithCode(CodeCancelled, fmt.Errorf("request cancelled: %w", err))
+	default:
+		return err
+	}
+}
@@ -2,6 +2,8 @@ package controller
 
 // File controllable.go contains Controllable, an interface for inner Controller states.
 
+import "context"
+
 // ResponseCb is the type of response callbacks.
 type ResponseCb func(interface{})
 
@@ -13,6 +15,31 @@ type Controllable interface {
 	// Dump dumps out the Controllable's public state, calling dumpCb for each dump response.
 	Dump(dumpCb ResponseCb)
 
-	// HandleRequest handles a request with body rbody, reply callback replyCb, and broadcast callback bcastCb.
-	HandleRequest(replyCb ResponseCb, bcastCb ResponseCb, rbody interface{}) error
+	// HandleRequest handles a request with context ctx, body rbody, reply callback replyCb, and broadcast callback
+	// bcastCb.
+	// ctx carries the request's deadline and per-request values, such as who sent it (see 'context.go').
+	HandleRequest(ctx context.Context, replyCb ResponseCb, bcastCb ResponseCb, rbody interface{}) error
+}
+
+// Wrapper is the interface of Controllables that wrap another state, such as compatibility shims.
+// When the Controller looks for the optional interfaces of its state (Snapshotter, Prioritiser, and so on), it looks
+// through Wrappers to the states inside them.
+type Wrapper interface {
+	// Unwrap gets the wrapped state.
+	Unwrap() interface{}
+}
+
+// stateAs finds the first state, starting from s and looking through Wrappers, that is a T.
+func stateAs[T any](s interface{}) (T, bool) {
+	for {
+		if t, ok := s.(T); ok {
+			return t, true
+		}
+		w, ok := s.(Wrapper)
+		if !ok {
+			var zero T
+			return zero, false
+		}
+		s = w.Unwrap()
+	}
 }
@@ -6,10 +6,11 @@ package controller
 import (
 	"context"
 	"errors"
-	"fmt"
+	"log"
 	"reflect"
 
 	"github.com/UniversityRadioYork/bifrost-go/core"
+	"go.opentelemetry.io/otel/trace"
 )
 
 var (
@@ -33,6 +34,9 @@ type Controller struct {
 	// mounts is the mapping of mount-point names to Clients that represent 'mounted' Controllers.
 	mounts map[string]Client
 
+	// breakers maps the names of mount points that have circuit breakers to their breakers.
+	breakers map[string]*breaker
+
 	// cselects is the list of cases, one per client, used in the connector select loop.
 	// It gets rebuilt every time a client connects or disconnects.
 	//
@@ -41,28 +45,84 @@ type Controller struct {
 	// channel.
 	cselects []reflect.SelectCase
 
+	// cselClients holds, for each case in cselects, the client it belongs to.
+	cselClients []coclient
+
+	// fanIn, if not nil, receives every client's requests in fan-in mode, replacing cselects; see fanin.go.
+	fanIn chan fannedRequest
+
+	// queue holds requests that have arrived, but not yet been handled.
+	queue requestQueue
+
+	// dumping maps each client with a snapshot dump in progress to the broadcasts it is missing in the meantime.
+	dumping map[coclient][]Response
+
+	// seq is the sequence number of the last broadcast sent, or 0 if none has been.
+	seq uint64
+
+	// dumpDone receives each client whose snapshot dump has finished.
+	dumpDone chan coclient
+
+	// done is closed when the Controller stops, so that snapshot dumps stop waiting for it.
+	done chan struct{}
+
 	// running is the internal is-running flag.
 	// When this is set to false, the controller loop will exit.
 	running bool
+
+	// log is the Controller's logger.
+	log *log.Logger
+
+	// panics is the number of times state has panicked.
+	panics int
+
+	// panicLimit is the number of panics after which the Controller quarantines state; 0 means never.
+	panicLimit int
+
+	// nextSession is the session the next client to connect gets.
+	nextSession Session
+
+	// journal, if not nil, records each request handed to state.
+	journal *Journal
+
+	// badRequests counts the bad requests each client has sent; see ingress.go.
+	badRequests map[coclient]int
+
+	// badRequestLimit is the number of bad requests after which the Controller hangs up on a client; 0 means never.
+	badRequestLimit int
+
+	// observers holds the functions in this program that see each broadcast; see observer.go.
+	observers observers
 }
 
 // makeAndAddClient creates a new client and coclient pair, and adds the coclient to c's clients.
 func (c *Controller) makeAndAddClient() *Client {
 	client, co := makeClient()
+	co.session = c.nextSession
+	c.nextSession++
 	c.clients[co] = -1
 
 	c.rebuildClientSelects()
+	if c.fanIn != nil {
+		go c.forward(co)
+	}
 
 	return &client
 }
 
 // rebuildClientSelects repopulates the list of client select cases.
 // It should be run whenever a client connects or disconnects.
+// In fan-in mode, there are no cases to rebuild.
 func (c *Controller) rebuildClientSelects() {
+	if c.fanIn != nil {
+		return
+	}
 	c.cselects = make([]reflect.SelectCase, len(c.clients))
+	c.cselClients = make([]coclient, len(c.clients))
 	i := 0
 	for cl := range c.clients {
 		c.cselects[i] = reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(cl.rx)}
+		c.cselClients[i] = cl
 		c.clients[cl] = i
 		i++
 	}
@@ -71,32 +131,96 @@ func (c *Controller) rebuildClientSelects() {
 // NewController constructs a new Controller for a given Controllable.
 func NewController(c Controllable) (*Controller, *Client) {
 	controller := &Controller{
-		state:   c,
-		clients: make(map[coclient]int),
+		state:    c,
+		clients:  make(map[coclient]int),
+		log:      log.Default(),
+		dumping:  make(map[coclient][]Response),
+		dumpDone: make(chan coclient),
+		done:     make(chan struct{}),
 	}
+	controller.observers.set = make(map[*Observer]struct{})
 	client := controller.makeAndAddClient()
 	return controller, client
 }
 
+// SetLogger sets the logger c uses to report problems with its state, such as panics.
+// By default, c uses the standard logger.
+// It must be called before Run.
+func (c *Controller) SetLogger(l *log.Logger) {
+	c.log = l
+}
+
 // Run runs this Controller's event loop.
 func (c *Controller) Run(ctx context.Context) {
 	c.running = true
+	c.startFanIn()
 	for c.running {
-		i, value, open := reflect.Select(c.cselects)
-		if open {
-			// TODO(@MattWindsor91): properly handle if this isn't a Request
-			rq, ok := value.Interface().(Request)
-			if !ok {
-				panic("FIXME: got bad request")
-			}
+		if !c.queue.ready(c.dumping) {
+			c.receive(true)
+		}
+		c.gather()
 
-			c.handleRequest(ctx, rq)
-		} else {
-			c.hangUpClientWithCase(i)
+		if qr, ok := c.queue.pop(c.dumping); ok {
+			c.handleRequest(ctx, qr.from, qr.rq)
 		}
 	}
 
+	// Requests that made it into the queue were accepted, so they still get handled.
+	// Ordering behind snapshot dumps no longer matters, as every client is about to be hung up.
+	for !c.queue.empty() {
+		qr, _ := c.queue.pop(nil)
+		c.handleRequest(ctx, qr.from, qr.rq)
+	}
+	close(c.done)
 	c.hangUpClients()
+	c.stopObservers()
+}
+
+// gather queues every request that is ready to be received, without waiting for any more.
+// It receives at most one request per client, so that a busy client can't keep the Controller gathering forever.
+func (c *Controller) gather() {
+	for n := len(c.clients); c.running && 0 < n; n-- {
+		if !c.receive(false) {
+			return
+		}
+	}
+}
+
+// receive selects on c's client cases and snapshot dump completions, waiting for one to be ready if wait is true.
+// It queues any request received, and hangs up any client that has closed its channel.
+// It returns false if wait is false and nothing was ready.
+func (c *Controller) receive(wait bool) bool {
+	if c.fanIn != nil {
+		return c.receiveFanIn(wait)
+	}
+
+	n := len(c.cselects)
+	cases := append(c.cselects[:n:n], reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.dumpDone)})
+	if !wait {
+		cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+	}
+
+	i, value, open := reflect.Select(cases)
+	switch {
+	case i == n:
+		c.finishSnapshotDump(value.Interface().(coclient))
+		return true
+	case n < i:
+		return false
+	case !open:
+		c.hangUpClientWithCase(i)
+		return true
+	}
+
+	c.accept(c.cselClients[i], value.Interface().(Request))
+	return true
+}
+
+// accept queues the request rq from client from, if c admits it.
+func (c *Controller) accept(from coclient, rq Request) {
+	if c.admit(from, rq) {
+		c.queue.push(queuedRequest{from: from, rq: rq, priority: c.priorityOf(rq.Body)})
+	}
 }
 
 // hangUpClients hangs up every connected client.
@@ -124,6 +248,12 @@ func (c *Controller) hangUpClient(cl coclient) {
 	delete(c.clients, cl)
 	c.rebuildClientSelects()
 
+	// Nobody is left to hear the replies to the client's waiting requests, or broadcasts.
+	c.queue.drop(cl)
+	delete(c.dumping, cl)
+	delete(c.badRequests, cl)
+	c.endSession(cl)
+
 	// We need at least one client for the Controller to function
 	if len(c.clients) == 0 {
 		c.running = false
@@ -134,37 +264,70 @@ func (c *Controller) hangUpClient(cl coclient) {
 // Request handling
 //
 
-// handleRequest handles a Request rq.
+// handleRequest handles a Request rq from client from.
 // If the request is a standard Request, the Controller will handle it itself.
 // Otherwise, the Controller forwards it to the Controllable.
-func (c *Controller) handleRequest(ctx context.Context, rq Request) {
+func (c *Controller) handleRequest(ctx context.Context, from coclient, rq Request) {
 	var err error
 
 	o := rq.Origin
+	if err = checkContext(o); err != nil {
+		c.reply(o, DoneResponse{err})
+		return
+	}
+	var span trace.Span
+	o.Ctx, span = startSpan(o.Context(), "controller "+bodyName(rq.Body), trace.WithAttributes(tagAttr(o.Tag)))
+	defer func() { endSpan(span, err) }()
+
 	switch body := rq.Body.(type) {
 	case RoleRequest:
 		err = c.handleRoleRequest(o, body)
 	case OnRequest:
-		err = c.handleOnRequest(ctx, o, body)
+		if err = c.startOnRequest(ctx, o, body); err == nil {
+			// The relay goroutine sends the acknowledgement.
+			return
+		}
 	case DumpRequest:
+		if s, ok := stateAs[Snapshotter](c.state); ok {
+			if err = c.startSnapshotDump(from, o, s); err == nil {
+				// The snapshot dump's goroutine sends the acknowledgement.
+				return
+			}
+			break
+		}
 		err = c.handleDumpRequest(o, body)
 	case newClientRequest:
 		err = c.handleNewClientRequest(o, body)
+	case bifrostParserRequest:
+		err = c.handleBifrostParserRequest(o, body)
 	case shutdownRequest:
 		err = c.handleShutdownRequest(o, body)
+	case pingRequest:
+		// The reply is the only point of a ping.
 	default:
-		err = c.handleStateSpecificRequest(o, body)
+		err = c.handleStateSpecificRequest(from, o, body)
 	}
 
-	ack := DoneResponse{err}
+	ack := DoneResponse{contextError(err)}
 	c.reply(o, ack)
 }
 
-func (c *Controller) handleStateSpecificRequest(o RequestOrigin, body interface{}) error {
+// handleStateSpecificRequest forwards a request with origin o and body body, from client from, to the state.
+func (c *Controller) handleStateSpecificRequest(from coclient, o RequestOrigin, body interface{}) error {
 	replyCb := func(rbody interface{}) {
 		c.reply(o, rbody)
 	}
-	return c.state.HandleRequest(replyCb, c.broadcast, body)
+	c.journal.record(from.session, o, body)
+
+	ctx, span := startSpan(o.Context(), "state "+bodyName(body))
+	err := c.isolate("request", func() error {
+		if s, ok := stateAs[SessionAware](c.state); ok {
+			return s.HandleSessionRequest(ctx, from.session, replyCb, c.broadcast, body)
+		}
+		return c.state.HandleRequest(ctx, replyCb, c.broadcast, body)
+	})
+	endSpan(span, err)
+	return err
 }
 
 // handleDumpRequest handles a dump with origin o and body b.
@@ -172,30 +335,37 @@ func (c *Controller) handleDumpRequest(o RequestOrigin, b DumpRequest) error {
 	dumpCb := func(rbody interface{}) {
 		c.reply(o, rbody)
 	}
-	c.state.Dump(dumpCb)
-
-	// Dump requests never fail
-	return nil
+	// Dump requests only fail if the state does.
+	return c.isolate("dump", func() error {
+		c.state.Dump(dumpCb)
+		return nil
+	})
 }
 
 // handleNewClientRequest handles a new client request with origin o and body b.
 func (c *Controller) handleNewClientRequest(o RequestOrigin, b newClientRequest) error {
+	// The Controller doesn't broadcast between dumping and adding the client, so the client gets every broadcast
+	// after its dump, and none before.
+	if b.Dump {
+		if err := c.handleDumpRequest(o, DumpRequest{}); err != nil {
+			return err
+		}
+	}
+
 	cl := c.makeAndAddClient()
 	c.reply(o, newClientResponse{Client: cl})
 
-	// New client requests never fail
+	// New client requests only fail if the dump does.
 	return nil
 }
 
-// handleOnRequest handles an 'on' request with origin o and body b.
-func (c *Controller) handleOnRequest(ctx context.Context, o RequestOrigin, b OnRequest) error {
-	m, ok := c.mounts[b.MountPoint]
+// handleBifrostParserRequest handles a Bifrost parser request with origin o and body b.
+func (c *Controller) handleBifrostParserRequest(o RequestOrigin, b bifrostParserRequest) error {
+	p, ok := stateAs[BifrostParser](c.state)
 	if !ok {
-		return fmt.Errorf("no such mount point: %s", b.MountPoint)
-	}
-	if !m.Send(ctx, b.Request) {
-		return fmt.Errorf("couldn't send to mount point: %s", b.MountPoint)
+		return ErrControllerCannotSpeakBifrost
 	}
+	c.reply(o, bifrostParserResponse{Parser: p})
 	return nil
 }
 
@@ -231,13 +401,21 @@ func (c *Controller) reply(to RequestOrigin, rbody interface{}) {
 
 // broadcast sends a broadcast response with body rbody to all clients.
 func (c *Controller) broadcast(rbody interface{}) {
+	c.seq++
 	response := Response{
 		Broadcast: true,
 		Origin:    nil,
 		Body:      rbody,
+		Seq:       c.seq,
 	}
 
 	for cl := range c.clients {
+		if backlog, ok := c.dumping[cl]; ok {
+			// The client mustn't see this until it has the whole dump.
+			c.dumping[cl] = append(backlog, response)
+			continue
+		}
 		cl.tx <- response
 	}
+	c.notifyObservers(response)
 }
@@ -2,14 +2,27 @@ package controller_test
 
 import (
 	"context"
+	"errors"
+	"expvar"
 	"fmt"
+	"io"
+	"log"
 	"reflect"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/UniversityRadioYork/bifrost-go/message"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/bifrost"
 	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/version"
 )
 
 type testState struct{}
@@ -24,6 +37,28 @@ type knownDummyRequest struct {
 }
 type knownDummyResponse struct{}
 
+// itemDummyRequest makes the test state broadcast an itemDummyResponse for the item at Index.
+type itemDummyRequest struct {
+	Index int
+}
+type itemDummyResponse struct {
+	Index int
+}
+type regionDummyResponse struct {
+	Start, Count int
+}
+
+// panicRequest makes the test state panic.
+type panicRequest struct{}
+
+// waitRequest makes the test state block until the request's context ends.
+type waitRequest struct{}
+
+// wedgeRequest makes the test state block until Release closes.
+type wedgeRequest struct {
+	Release chan struct{}
+}
+
 /*
 Controllable implementation
 */
@@ -34,7 +69,7 @@ func (*testState) RoleName() string {
 
 func (*testState) Dump(controller.ResponseCb) {}
 
-func (*testState) HandleRequest(replyCb, bcastCb controller.ResponseCb, rbody interface{}) error {
+func (*testState) HandleRequest(ctx context.Context, replyCb, bcastCb controller.ResponseCb, rbody interface{}) error {
 	switch b := rbody.(type) {
 	case knownDummyRequest:
 		var cb controller.ResponseCb
@@ -46,6 +81,17 @@ func (*testState) HandleRequest(replyCb, bcastCb controller.ResponseCb, rbody in
 
 		cb(knownDummyResponse{})
 		return nil
+	case itemDummyRequest:
+		bcastCb(itemDummyResponse(b))
+		return nil
+	case wedgeRequest:
+		<-b.Release
+		return nil
+	case waitRequest:
+		<-ctx.Done()
+		return ctx.Err()
+	case panicRequest:
+		panic("test panic")
 	default:
 		return fmt.Errorf("unknown request")
 	}
@@ -59,11 +105,59 @@ type testStateWithParser struct {
 BifrostParser implementation for testStateWithParser
 */
 
-func (*testStateWithParser) ParseBifrostRequest(word string, _ []string) (interface{}, error) {
+func (*testStateWithParser) ParseBifrostRequest(word string, args []string) (interface{}, error) {
+	switch word {
+	case "item":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("bad item arguments")
+		}
+		i, err := strconv.Atoi(args[0])
+		return itemDummyRequest{Index: i}, err
+	case "known":
+		return knownDummyRequest{}, nil
+	case "bknown":
+		return knownDummyRequest{Broadcast: true}, nil
+	case "wait":
+		return waitRequest{}, nil
+	}
 	return nil, controller.UnknownWord(word)
 }
 
-func (*testStateWithParser) EmitBifrostResponse(string, interface{}, chan<- message.Message) error {
+func (*testStateWithParser) CoalesceKey(rbody interface{}) (string, bool) {
+	switch r := rbody.(type) {
+	case knownDummyResponse:
+		return "known", true
+	case itemDummyResponse:
+		return "item " + strconv.Itoa(r.Index), true
+	}
+	return "", false
+}
+
+func (*testStateWithParser) BroadcastIndex(rbody interface{}) (int, bool) {
+	r, ok := rbody.(itemDummyResponse)
+	return r.Index, ok
+}
+
+func (*testStateWithParser) RegionBroadcast(start, count int) interface{} {
+	return regionDummyResponse{Start: start, Count: count}
+}
+
+func (*testStateWithParser) BroadcastClass(rbody interface{}) controller.BroadcastClass {
+	if _, ok := rbody.(itemDummyResponse); ok {
+		return controller.BroadcastMeta
+	}
+	return controller.BroadcastCore
+}
+
+func (*testStateWithParser) EmitBifrostResponse(tag string, rbody interface{}, msgTx chan<- message.Message) error {
+	switch r := rbody.(type) {
+	case knownDummyResponse:
+		msgTx <- *message.New(tag, "KNOWN")
+	case itemDummyResponse:
+		msgTx <- *message.New(tag, "ITEM").AddArgs(strconv.Itoa(r.Index))
+	case regionDummyResponse:
+		msgTx <- *message.New(tag, "REGION").AddArgs(strconv.Itoa(r.Start), strconv.Itoa(r.Count))
+	}
 	return nil
 }
 
@@ -155,6 +249,46 @@ func TestClient_Bifrost_BifrostParser(t *testing.T) {
 	testWithController(&testStateWithParser{}, f, t)
 }
 
+// TestBifrost_Run_BifrostParser tests that a Bifrost adapter parses and emits messages using its Controller's
+// BifrostParser.
+func TestBifrost_Run_BifrostParser(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		expectWord := func(tag, word string) {
+			t.Helper()
+			m, ok := <-bfc.Rx
+			if !ok {
+				t.Fatalf("adapter closed while waiting for %s", word)
+			}
+			if m.Tag() != tag || m.Word() != word {
+				t.Fatalf("got message %s, want tag %s word %s", m.String(), tag, word)
+			}
+		}
+
+		expectWord(message.TagBcast, "OHAI")
+		expectWord(message.TagBcast, "IAMA")
+
+		bfc.Tx <- *message.New("t1", "known")
+		expectWord("t1", "KNOWN")
+		expectWord("t1", "ACK")
+
+		bfc.Tx <- *message.New("t2", "unknown")
+		expectWord("t2", "ACK")
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
 // TestClient_Shutdown tests Client.Shutdown's behaviour.
 func TestClient_Shutdown(t *testing.T) {
 	f := func(ctx context.Context, c *controller.Client, t *testing.T) {
@@ -234,3 +368,1957 @@ func TestClient_CopyAfterShutdown(t *testing.T) {
 	}
 	testWithController(&testState{}, f, t)
 }
+
+// TestWatchdog tests that a Watchdog raises an alert when its Controller wedges, and another when it recovers.
+func TestWatchdog(t *testing.T) {
+	f := func(ctx context.Context, c *controller.Client, t *testing.T) {
+		wdc, err := c.Copy(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error on copy: %s", err.Error())
+		}
+
+		alerts := make(chan controller.WatchdogAlert, 2)
+		wd := controller.NewWatchdog(log.New(io.Discard, "", 0), "test", wdc, time.Millisecond, 20*time.Millisecond)
+		wd.SetAlertHook(func(a controller.WatchdogAlert) { alerts <- a })
+
+		wdCtx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			_ = wd.Run(wdCtx)
+			wg.Done()
+		}()
+
+		release := make(chan struct{})
+		go func() {
+			_, _ = c.SendAndProcessReplies(ctx, "", wedgeRequest{Release: release}, func(controller.Response) error { return nil })
+			wg.Done()
+		}()
+
+		expectAlert := func(wedged bool) {
+			t.Helper()
+			select {
+			case a := <-alerts:
+				if a.Name != "test" || a.Wedged != wedged {
+					t.Fatalf("got alert %+v, want wedged=%v", a, wedged)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatalf("timed out waiting for alert with wedged=%v", wedged)
+			}
+		}
+		expectAlert(true)
+		close(release)
+		expectAlert(false)
+
+		cancel()
+		wg.Wait()
+	}
+	testWithController(&testState{}, f, t)
+}
+
+// TestController_Panic tests that panics in a Controllable become errors, and that too many quarantine it.
+func TestController_Panic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctl, c := controller.NewController(&testState{})
+	ctl.SetLogger(log.New(io.Discard, "", 0))
+	ctl.SetPanicLimit(2)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		ctl.Run(ctx)
+		wg.Done()
+	}()
+
+	send := func(body interface{}) error {
+		t.Helper()
+		alive, err := c.SendAndProcessReplies(ctx, "", body, func(controller.Response) error { return nil })
+		if !alive {
+			t.Fatal("controller shut down")
+		}
+		return err
+	}
+
+	for i := 0; i < 2; i++ {
+		var perr controller.PanicError
+		if err := send(panicRequest{}); !errors.As(err, &perr) {
+			t.Fatalf("panic %d: got %v, want a PanicError", i, err)
+		}
+	}
+	if err := send(knownDummyRequest{}); err != controller.ErrQuarantined {
+		t.Errorf("request after quarantine: got %v, want %v", err, controller.ErrQuarantined)
+	}
+	if err := send(controller.RoleRequest{}); err != nil {
+		t.Errorf("role request after quarantine: unexpected error %v", err)
+	}
+
+	if err := c.Shutdown(ctx); err != nil {
+		t.Errorf("error shutting client down after test: %s", err.Error())
+	}
+	wg.Wait()
+}
+
+// TestController_FanIn tests that a Controller in fan-in mode handles requests from, and hang-ups by, its clients.
+func TestController_FanIn(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctl, c := controller.NewController(&testState{})
+	ctl.SetFanIn(true)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		ctl.Run(ctx)
+		wg.Done()
+	}()
+
+	c2, err := c.Copy(ctx)
+	if err != nil {
+		t.Fatal("couldn't copy client:", err)
+	}
+	// Broadcasts from c2's request reach c too, which must keep draining them.
+	go func() {
+		for range c.Rx {
+		}
+	}()
+
+	for _, cl := range []*controller.Client{c, c2} {
+		var got []interface{}
+		alive, err := cl.SendAndProcessReplies(ctx, "", knownDummyRequest{}, func(r controller.Response) error {
+			got = append(got, r.Body)
+			return nil
+		})
+		if !alive || err != nil {
+			t.Fatalf("request: got alive %v, error %v; want true, nil", alive, err)
+		}
+		if len(got) != 1 {
+			t.Errorf("request: got replies %v, want one knownDummyResponse", got)
+		}
+	}
+
+	// Hanging up c2 mustn't affect c.
+	close(c2.Tx)
+	for range c2.Rx {
+	}
+	if alive, err := c.SendAndProcessReplies(ctx, "", knownDummyRequest{}, func(controller.Response) error { return nil }); !alive || err != nil {
+		t.Errorf("request after hang-up: got alive %v, error %v; want true, nil", alive, err)
+	}
+
+	if err := c.Shutdown(ctx); err != nil {
+		t.Errorf("error shutting client down after test: %s", err.Error())
+	}
+	wg.Wait()
+}
+
+// TestController_FanIn_hungUp tests that a Controller in fan-in mode acknowledges requests that arrive after it hung up
+// on their client with ErrClientHungUp, while carrying on for its other clients.
+func TestController_FanIn_hungUp(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctl, c := controller.NewController(&testState{})
+	ctl.SetLogger(log.New(io.Discard, "", 0))
+	ctl.SetBadRequestLimit(1)
+	ctl.SetFanIn(true)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		ctl.Run(ctx)
+		wg.Done()
+	}()
+
+	c2, err := c.Copy(ctx)
+	if err != nil {
+		t.Fatal("couldn't copy client:", err)
+	}
+	ignore := func(controller.Response) error { return nil }
+	if _, err := c2.SendAndProcessReplies(ctx, "", nil, ignore); bifrost.CodeOf(err) != controller.CodeBadRequest {
+		t.Errorf("request with no body: got error %v, want code %q", err, controller.CodeBadRequest)
+	}
+	for range c2.Rx {
+	}
+
+	if alive, err := c2.SendAndProcessReplies(ctx, "", knownDummyRequest{}, ignore); !alive || err != controller.ErrClientHungUp {
+		t.Errorf("request after hang-up: got alive %v, error %v; want true, %v", alive, err, controller.ErrClientHungUp)
+	}
+	if alive, err := c.SendAndProcessReplies(ctx, "", knownDummyRequest{}, ignore); !alive || err != nil {
+		t.Errorf("request from a well-behaved client: got alive %v, error %v; want true, nil", alive, err)
+	}
+
+	if err := c.Shutdown(ctx); err != nil {
+		t.Errorf("error shutting client down after test: %s", err.Error())
+	}
+	wg.Wait()
+}
+
+// TestController_BadRequest tests that a Controller refuses malformed requests without going down, and hangs up on
+// clients that send too many.
+func TestController_BadRequest(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctl, c := controller.NewController(&testState{})
+	ctl.SetLogger(log.New(io.Discard, "", 0))
+	ctl.SetBadRequestLimit(2)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		ctl.Run(ctx)
+		wg.Done()
+	}()
+
+	c2, err := c.Copy(ctx)
+	if err != nil {
+		t.Fatal("couldn't copy client:", err)
+	}
+	_, err = c2.SendAndProcessReplies(ctx, "", nil, func(controller.Response) error { return nil })
+	if code := bifrost.CodeOf(err); code != controller.CodeBadRequest {
+		t.Errorf("request with no body: got error %v (code %q), want code %q", err, code, controller.CodeBadRequest)
+	}
+
+	// There is nowhere to send an error for this one, so the Controller just drops it; it is c2's second strike.
+	if !c2.Send(ctx, controller.Request{Body: knownDummyRequest{}}) {
+		t.Fatal("controller shut down")
+	}
+	for range c2.Rx {
+	}
+
+	alive, err := c.SendAndProcessReplies(ctx, "", knownDummyRequest{}, func(controller.Response) error { return nil })
+	if !alive || err != nil {
+		t.Errorf("request from a well-behaved client: got alive %v, error %v; want true, nil", alive, err)
+	}
+
+	if err := c.Shutdown(ctx); err != nil {
+		t.Errorf("error shutting client down after test: %s", err.Error())
+	}
+	wg.Wait()
+}
+
+// TestController_Journal tests that a Controller journals the most recent requests it hands to its state.
+func TestController_Journal(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctl, c := controller.NewController(&testState{})
+	j := controller.NewJournal(2)
+	ctl.SetJournal(j)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		ctl.Run(ctx)
+		wg.Done()
+	}()
+
+	send := func(tag string, body interface{}) {
+		t.Helper()
+		if _, err := c.SendAndProcessReplies(ctx, tag, body, func(controller.Response) error { return nil }); err != nil {
+			t.Fatalf("request %s: unexpected error %v", tag, err)
+		}
+	}
+	send("a", knownDummyRequest{})
+	send("b", knownDummyRequest{})
+	send("c", knownDummyRequest{})
+	// Requests the Controller handles itself aren't journaled.
+	send("d", controller.RoleRequest{})
+
+	es := j.Entries()
+	if len(es) != 2 || es[0].Tag != "b" || es[1].Tag != "c" {
+		t.Fatalf("got entries %v, want requests b and c", es)
+	}
+	if !strings.Contains(es[1].Request, "controller_test.knownDummyRequest") {
+		t.Errorf("entry doesn't describe the request: %q", es[1].Request)
+	}
+
+	if err := c.Shutdown(ctx); err != nil {
+		t.Errorf("error shutting client down after test: %s", err.Error())
+	}
+	wg.Wait()
+}
+
+// TestBifrost_Run_Coalesce tests that a Bifrost adapter coalesces broadcasts that supersede each other.
+func TestBifrost_Run_Coalesce(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+		bf.SetCoalesce(50 * time.Millisecond)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		expectWord := func(tag, word string) {
+			t.Helper()
+			m, ok := <-bfc.Rx
+			if !ok {
+				t.Fatalf("adapter closed while waiting for %s", word)
+			}
+			if m.Tag() != tag || m.Word() != word {
+				t.Fatalf("got message %s, want tag %s word %s", m.String(), tag, word)
+			}
+		}
+
+		expectWord(message.TagBcast, "OHAI")
+		expectWord(message.TagBcast, "IAMA")
+
+		for _, tag := range []string{"t1", "t2", "t3"} {
+			bfc.Tx <- *message.New(tag, "bknown")
+			expectWord(tag, "ACK")
+		}
+		// Only one of the three broadcasts should make it out.
+		expectWord(message.TagBcast, "KNOWN")
+
+		bfc.Tx <- *message.New("t4", "known")
+		expectWord("t4", "KNOWN")
+		expectWord("t4", "ACK")
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_Regions tests that a Bifrost adapter folds many coalesced item broadcasts into one region broadcast,
+// but sends a few as they are.
+func TestBifrost_Run_Regions(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+		bf.SetCoalesce(50 * time.Millisecond)
+		bf.SetRegionThreshold(2)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		expectWord := func(tag, word string, args ...string) {
+			t.Helper()
+			m, ok := <-bfc.Rx
+			if !ok {
+				t.Fatalf("adapter closed while waiting for %s", word)
+			}
+			if m.Tag() != tag || m.Word() != word {
+				t.Fatalf("got message %s, want tag %s word %s", m.String(), tag, word)
+			}
+			if args != nil && !reflect.DeepEqual(m.Args(), args) {
+				t.Fatalf("got message %s, want arguments %v", m.String(), args)
+			}
+		}
+		send := func(tag string, index int) {
+			t.Helper()
+			bfc.Tx <- *message.New(tag, "item").AddArgs(strconv.Itoa(index))
+			expectWord(tag, "ACK")
+		}
+
+		expectWord(message.TagBcast, "OHAI")
+		expectWord(message.TagBcast, "IAMA")
+
+		send("t1", 3)
+		send("t2", 7)
+		send("t3", 5)
+		expectWord(message.TagBcast, "REGION", "3", "5")
+
+		send("t4", 1)
+		send("t5", 2)
+		expectWord(message.TagBcast, "ITEM", "1")
+		expectWord(message.TagBcast, "ITEM", "2")
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_Caps tests that a Bifrost adapter tailors broadcasts to the capabilities its client declares.
+func TestBifrost_Run_Caps(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		expectWord := func(tag, word string, args ...string) {
+			t.Helper()
+			m, ok := <-bfc.Rx
+			if !ok {
+				t.Fatalf("adapter closed while waiting for %s", word)
+			}
+			if m.Tag() != tag || m.Word() != word {
+				t.Fatalf("got message %s, want tag %s word %s", m.String(), tag, word)
+			}
+			if args != nil && !reflect.DeepEqual(m.Args(), args) {
+				t.Fatalf("got message %s, want arguments %v", m.String(), args)
+			}
+		}
+		send := func(tag, word string, args ...string) {
+			t.Helper()
+			bfc.Tx <- *message.New(tag, word).AddArgs(args...)
+		}
+
+		expectWord(message.TagBcast, "OHAI")
+		expectWord(message.TagBcast, "IAMA")
+
+		// Before declaring capabilities, the client gets everything.
+		send("t1", "item", "1")
+		expectWord(message.TagBcast, "ITEM", "1")
+		expectWord("t1", "ACK")
+
+		send("c1", controller.RqCaps, controller.CapDiff, "teleport", controller.CapDiff)
+		expectWord("c1", controller.RsCaps, controller.CapDiff)
+		expectWord("c1", "ACK")
+		send("t2", "item", "2")
+		expectWord("t2", "ACK")
+		send("t3", "bknown")
+		expectWord(message.TagBcast, "KNOWN")
+		expectWord("t3", "ACK")
+
+		send("c2", controller.RqCaps, controller.CapMeta)
+		expectWord("c2", controller.RsCaps, controller.CapMeta)
+		expectWord("c2", "ACK")
+		send("t4", "item", "4")
+		expectWord(message.TagBcast, "REGION", "4", "1")
+		expectWord("t4", "ACK")
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestClient_Seq tests that every client of a Controller sees its broadcasts with strictly increasing sequence numbers.
+func TestClient_Seq(t *testing.T) {
+	const n = 5
+
+	f := func(ctx context.Context, c *controller.Client, t *testing.T) {
+		c2, err := c.Copy(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error on copy: %s", err.Error())
+		}
+
+		var wg sync.WaitGroup
+		check := func(name string, cl *controller.Client) {
+			defer wg.Done()
+			var last uint64
+			for i := 0; i < n; i++ {
+				r, ok := <-cl.Rx
+				if !ok {
+					t.Errorf("%s: client closed after %d broadcasts", name, i)
+					return
+				}
+				if r.Seq <= last {
+					t.Errorf("%s: got sequence number %d after %d", name, r.Seq, last)
+				}
+				last = r.Seq
+			}
+		}
+		wg.Add(2)
+		go check("original", c)
+		go check("copy", c2)
+
+		for i := 0; i < n; i++ {
+			if err := c2.Call(ctx, knownDummyRequest{Broadcast: true}); err != nil {
+				t.Fatalf("unexpected error on broadcast request: %s", err.Error())
+			}
+		}
+		wg.Wait()
+
+		if err := c2.Shutdown(ctx); err != nil {
+			t.Fatalf("unexpected error on copy shutdown: %s", err.Error())
+		}
+	}
+	testWithController(&testState{}, f, t)
+}
+
+// TestBifrost_Run_Seq tests that a Bifrost adapter stamps broadcasts with strictly increasing sequence numbers for
+// clients that want them, chaining each stamp to the last even when coalescing leaves broadcasts out.
+func TestBifrost_Run_Seq(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+		bf.SetCoalesce(50 * time.Millisecond)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		next := func() message.Message {
+			t.Helper()
+			m, ok := <-bfc.Rx
+			if !ok {
+				t.Fatal("adapter closed while waiting for a message")
+			}
+			return m
+		}
+		expectWord := func(tag, word string) {
+			t.Helper()
+			if m := next(); m.Tag() != tag || m.Word() != word {
+				t.Fatalf("got message %s, want tag %s word %s", m.String(), tag, word)
+			}
+		}
+		var last uint64
+		expectStamped := func(word string) {
+			t.Helper()
+			m := next()
+			if m.Word() != controller.RsSeq || len(m.Args()) != 2 {
+				t.Fatalf("got message %s, want a sequence stamp", m.String())
+			}
+			seq, err := strconv.ParseUint(m.Args()[0], 10, 64)
+			if err != nil {
+				t.Fatalf("bad sequence number in %s: %s", m.String(), err.Error())
+			}
+			if seq <= last {
+				t.Errorf("got sequence number %d after %d", seq, last)
+			}
+			if prev := m.Args()[1]; prev != strconv.FormatUint(last, 10) {
+				t.Errorf("got previous sequence number %s, want %d", prev, last)
+			}
+			last = seq
+			expectWord(message.TagBcast, word)
+		}
+
+		expectWord(message.TagBcast, "OHAI")
+		expectWord(message.TagBcast, "IAMA")
+
+		bfc.Tx <- *message.New("c1", controller.RqCaps).AddArgs(controller.CapMeta, controller.CapDiff, controller.CapSeq)
+		expectWord("c1", controller.RsCaps)
+		expectWord("c1", "ACK")
+
+		// The first two broadcasts are superseded while they wait, so the stamps skip their numbers.
+		for _, rq := range []*message.Message{
+			message.New("t0", "item").AddArgs("1"),
+			message.New("t1", "bknown"),
+			message.New("t2", "item").AddArgs("1"),
+			message.New("t3", "bknown"),
+		} {
+			bfc.Tx <- *rq
+			expectWord(rq.Tag(), "ACK")
+		}
+		expectStamped("ITEM")
+		expectStamped("KNOWN")
+		if last != 4 {
+			t.Errorf("got last sequence number %d, want 4", last)
+		}
+
+		bfc.Tx <- *message.New("t4", "known")
+		expectWord("t4", "KNOWN")
+		expectWord("t4", "ACK")
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_SendBuffer tests that a Bifrost adapter with a send buffer drops broadcasts, rather than hold up its
+// Controller, while its client isn't reading, and warns the client that it is lagging and when it has caught up.
+func TestBifrost_Run_SendBuffer(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		go func() {
+			for range cli.Rx {
+			}
+		}()
+
+		bcli, err := cli.Copy(ctx)
+		if err != nil {
+			t.Fatalf("copy failed: %v", err)
+		}
+		bf, bfc := controller.NewBifrost(bcli)
+		bf.SetSendBuffer(4)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+		// The adapter only takes broadcasts once it has greeted the client, which it has once it answers requests.
+		bfc.Tx <- *message.New("k1", "known")
+		for m := <-bfc.Rx; m.Word() != "ACK"; m = <-bfc.Rx {
+		}
+
+		// The client reads nothing else until every broadcast has gone out.
+		sent := make(chan error)
+		go func() {
+			for i := 0; i < 20; i++ {
+				if err := cli.Call(ctx, knownDummyRequest{Broadcast: true}); err != nil {
+					sent <- err
+					return
+				}
+			}
+			sent <- nil
+		}()
+		select {
+		case err := <-sent:
+			if err != nil {
+				t.Fatalf("unexpected error broadcasting: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("broadcasts held up by a client that isn't reading")
+		}
+		if bf.Dropped() == 0 {
+			t.Fatal("no broadcasts dropped")
+		}
+
+		lagged := false
+		for m := range bfc.Rx {
+			if m.Word() != controller.RsLag {
+				continue
+			}
+			if m.Args()[0] != "0" {
+				lagged = true
+				continue
+			}
+			if !lagged {
+				t.Errorf("got %s before a lag warning", m.String())
+			}
+			if want := strconv.FormatInt(bf.Dropped(), 10); m.Args()[1] != want {
+				t.Errorf("got %s, want %s dropped", m.String(), want)
+			}
+			break
+		}
+		if got := bf.Queued(); got != 0 {
+			t.Errorf("got %d queued after catching up, want 0", got)
+		}
+
+		close(bfc.Tx)
+		for range bfc.Rx {
+		}
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_Dialect tests that a Bifrost adapter translates a client's dialect to and from the current protocol.
+func TestBifrost_Run_Dialect(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+		bf.SetDialect(&controller.Dialect{
+			Name:      "test",
+			Requests:  map[string]string{"old": "known"},
+			Responses: map[string]string{"KNOWN": "OLDKNOWN"},
+			EchoAcks:  true,
+		})
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		expect := func(want *message.Message) {
+			t.Helper()
+			m, ok := <-bfc.Rx
+			if !ok {
+				t.Fatalf("adapter closed while waiting for %s", want.String())
+			}
+			if got, want := m.String(), want.String(); got != want {
+				t.Fatalf("got %s, want %s", got, want)
+			}
+		}
+
+		// OHAI and IAMA
+		<-bfc.Rx
+		<-bfc.Rx
+
+		bfc.Tx <- *message.New("t1", "old").AddArgs("a", "b")
+		expect(message.New("t1", "OLDKNOWN"))
+		expect(message.New("t1", "ACK").AddArgs("OK", "success", "old", "a", "b"))
+
+		// Words the dialect doesn't rename pass through, and failures echo too.
+		bfc.Tx <- *message.New("t2", "known")
+		expect(message.New("t2", "OLDKNOWN"))
+		expect(message.New("t2", "ACK").AddArgs("OK", "success", "known"))
+		bfc.Tx <- *message.New("t3", "bogus")
+		m := <-bfc.Rx
+		if args := m.Args(); m.Word() != "ACK" || args[0] != "WHAT" || args[len(args)-1] != "bogus" {
+			t.Errorf("got %s, want a WHAT ACK echoing bogus", m.String())
+		}
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+
+	if d, err := controller.DialectByName("baps3d"); err != nil || d != &controller.Baps3d {
+		t.Errorf("DialectByName(baps3d) = %v, %v; want Baps3d", d, err)
+	}
+	if _, err := controller.DialectByName("nonesuch"); err == nil {
+		t.Error("DialectByName(nonesuch) didn't fail")
+	}
+}
+
+// TestBifrost_Run_WordFilter tests that a Bifrost adapter with a word filter refuses the words it doesn't accept, but
+// not those setting up the connection.
+func TestBifrost_Run_WordFilter(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+		bf.SetWordFilter(controller.NewWordFilter([]string{"known", controller.RqTime}, []string{controller.RqTime}))
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		// OHAI and IAMA
+		<-bfc.Rx
+		<-bfc.Rx
+
+		bfc.Tx <- *message.New("t1", "known")
+		if m := <-bfc.Rx; m.Word() != "KNOWN" {
+			t.Fatalf("got %s, want KNOWN", m.String())
+		}
+		if m := <-bfc.Rx; m.Word() != "ACK" || m.Args()[0] != "OK" {
+			t.Errorf("got %s, want a successful ACK", m.String())
+		}
+
+		bfc.Tx <- *message.New("t2", controller.RqErrMode).AddArgs(controller.ErrModeCode)
+		if m := <-bfc.Rx; m.Word() != "ACK" || m.Args()[0] != "OK" {
+			t.Fatalf("errmode: got %s, want a successful ACK", m.String())
+		}
+		for _, word := range []string{controller.RqTime, "dump"} {
+			bfc.Tx <- *message.New("t3", word)
+			if m := <-bfc.Rx; m.Word() != "ACK" || m.Args()[0] != "WHAT" || m.Args()[1] != controller.CodeForbidden {
+				t.Errorf("%s: got %s, want a forbidden ACK", word, m.String())
+			}
+		}
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+
+	if controller.NewWordFilter(nil, nil) != nil {
+		t.Error("NewWordFilter(nil, nil) isn't nil")
+	}
+	if wf := controller.NewWordFilter(nil, []string{"dump"}); wf.Accepts("dump") || !wf.Accepts("known") {
+		t.Error("deny-only filter: want dump refused, and other words accepted")
+	}
+}
+
+// TestBifrost_Run_ErrModeLocale tests that a Bifrost adapter in a localised prose error mode translates coded errors,
+// keeping the detail of arity errors, and leaves uncoded errors in English.
+func TestBifrost_Run_ErrModeLocale(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		// OHAI and IAMA
+		<-bfc.Rx
+		<-bfc.Rx
+
+		bfc.Tx <- *message.New("t1", controller.RqErrMode).AddArgs(controller.ErrModeProse, "fr-CA")
+		if m := <-bfc.Rx; m.Word() != "ACK" || m.Args()[0] != "OK" {
+			t.Fatalf("errmode: got %s, want a successful ACK", m.String())
+		}
+
+		bfc.Tx <- *message.New("t2", controller.RqTime).AddArgs("a", "b")
+		m := <-bfc.Rx
+		if desc := m.Args()[1]; !strings.HasPrefix(desc, "mauvais nombre d'arguments: ") || len(desc) <= len("mauvais nombre d'arguments: ") {
+			t.Errorf("arity error: got %s, want it in French with its detail", m.String())
+		}
+
+		bfc.Tx <- *message.New("t3", "item")
+		if m := <-bfc.Rx; m.Args()[1] != "bad item arguments" {
+			t.Errorf("uncoded error: got %s, want its English message", m.String())
+		}
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_Describe tests that a Bifrost adapter describes the words its connection accepts, and one word on
+// its own.
+func TestBifrost_Run_Describe(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+		bf.SetWordFilter(controller.NewWordFilter(nil, []string{controller.RqClients}))
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		// OHAI and IAMA
+		<-bfc.Rx
+		<-bfc.Rx
+
+		// collect gets the replies to the request with tag tag, up to and including its ACK.
+		collect := func(tag string) []message.Message {
+			var ms []message.Message
+			for m := range bfc.Rx {
+				if m.Tag() != tag {
+					continue
+				}
+				ms = append(ms, m)
+				if m.Word() == "ACK" {
+					break
+				}
+			}
+			return ms
+		}
+
+		bfc.Tx <- *message.New("t1", controller.RqDescribe)
+		ms := collect("t1")
+		if len(ms) < 2 || ms[0].Word() != controller.RsDescribe || ms[0].Args()[0] != "-" {
+			t.Fatalf("describe: got %v, want DESCRIBE - first", ms)
+		}
+		words := map[string]bool{}
+		for _, m := range ms {
+			if m.Word() == controller.RsRequestSchema {
+				words[m.Args()[0]] = true
+			}
+		}
+		if !words[controller.RqVersion] || !words[controller.RqDescribe] || words[controller.RqClients] {
+			t.Errorf("describe: got requests %v, want version and describe, but not the filtered clients", words)
+		}
+		if got, want := ms[0].Args()[1], strconv.Itoa(len(words)); got != want {
+			t.Errorf("describe: DESCRIBE counts %s requests, but got %s", got, want)
+		}
+
+		bfc.Tx <- *message.New("t2", controller.RqDescribe).AddArgs(controller.RqTime)
+		want := [][]string{
+			{controller.RsDescribe, "-", "1", "0"},
+			{controller.RsRequestSchema, "time", "Asks for the server's clock.", "TIME"},
+			{controller.RsArgSchema, "time", "Token", "string", "optional", "A token to echo in the reply."},
+			{"ACK", "OK", "success"},
+		}
+		ms = collect("t2")
+		if len(ms) != len(want) {
+			t.Fatalf("describe time: got %v, want %v", ms, want)
+		}
+		for i, m := range ms {
+			if got := append([]string{m.Word()}, m.Args()...); !reflect.DeepEqual(got, want[i]) {
+				t.Errorf("describe time: message %d is %q, want %q", i, got, want[i])
+			}
+		}
+
+		for _, word := range []string{"nonesuch", controller.RqClients} {
+			bfc.Tx <- *message.New("t3", controller.RqDescribe).AddArgs(word)
+			if ms := collect("t3"); len(ms) != 1 || ms[0].Args()[0] != "WHAT" {
+				t.Errorf("describe %s: got %v, want a failed ACK", word, ms)
+			}
+		}
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_Trace tests that a request through a Bifrost adapter leaves one trace, with the Controller's span
+// inside the adapter's, and the state's inside the Controller's.
+func TestBifrost_Run_Trace(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	old := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+	defer otel.SetTracerProvider(old)
+
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		// OHAI and IAMA
+		<-bfc.Rx
+		<-bfc.Rx
+
+		bfc.Tx <- *message.New("t1", "known")
+		for m := range bfc.Rx {
+			if m.Word() == "ACK" {
+				break
+			}
+		}
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, s := range rec.Ended() {
+		spans[s.Name()] = s
+	}
+	adapter, ok := spans["bifrost known"]
+	if !ok {
+		t.Fatalf("no adapter span among %v", spans)
+	}
+	ctrl, ok := spans["controller controller_test.knownDummyRequest"]
+	if !ok {
+		t.Fatalf("no controller span among %v", spans)
+	}
+	state, ok := spans["state controller_test.knownDummyRequest"]
+	if !ok {
+		t.Fatalf("no state span among %v", spans)
+	}
+	if ctrl.Parent().SpanID() != adapter.SpanContext().SpanID() {
+		t.Error("controller span isn't a child of the adapter span")
+	}
+	if state.Parent().SpanID() != ctrl.SpanContext().SpanID() {
+		t.Error("state span isn't a child of the controller span")
+	}
+}
+
+// TestBifrost_Run_SlowRequest tests that a Bifrost adapter reports requests slower than its threshold, and only those.
+func TestBifrost_Run_SlowRequest(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+		slow := make(chan controller.SlowRequest, 2)
+		bf.SetSlowRequestHook(time.Nanosecond, func(r controller.SlowRequest) { slow <- r })
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		// OHAI and IAMA
+		<-bfc.Rx
+		<-bfc.Rx
+
+		bfc.Tx <- *message.New("t1", "known")
+		for m := range bfc.Rx {
+			if m.Word() == "ACK" {
+				break
+			}
+		}
+		// The adapter answers time itself, so it's never slow.
+		bfc.Tx <- *message.New("t2", controller.RqTime)
+		<-bfc.Rx
+
+		close(bfc.Tx)
+		wg.Wait()
+
+		close(slow)
+		var got []controller.SlowRequest
+		for r := range slow {
+			got = append(got, r)
+		}
+		if len(got) != 1 || got[0].Word != "known" || got[0].Tag != "t1" || got[0].Err != nil || got[0].Elapsed <= 0 {
+			t.Errorf("got slow requests %+v, want just the successful t1 known", got)
+		}
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_Time tests that a Bifrost adapter answers time requests, echoing any token.
+func TestBifrost_Run_Time(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		// OHAI and IAMA
+		<-bfc.Rx
+		<-bfc.Rx
+
+		cases := []struct {
+			rq   *message.Message
+			want []string
+		}{
+			{message.New("t1", controller.RqTime), nil},
+			{message.New("t2", controller.RqTime).AddArgs("tok"), []string{"tok"}},
+		}
+		for _, c := range cases {
+			bfc.Tx <- *c.rq
+			m := <-bfc.Rx
+			if m.Tag() != c.rq.Tag() || m.Word() != controller.RsTime {
+				t.Fatalf("got message %s, want tag %s word %s", m.String(), c.rq.Tag(), controller.RsTime)
+			}
+			args := m.Args()
+			if len(args) != 2+len(c.want) {
+				t.Fatalf("got %d arguments, want %d", len(args), 2+len(c.want))
+			}
+			if _, err := time.Parse(time.RFC3339Nano, args[0]); err != nil {
+				t.Errorf("wall-clock time %q didn't parse: %v", args[0], err)
+			}
+			if _, err := strconv.ParseInt(args[1], 10, 64); err != nil {
+				t.Errorf("monotonic time %q didn't parse: %v", args[1], err)
+			}
+			for i, w := range c.want {
+				if args[2+i] != w {
+					t.Errorf("argument %d: got %q, want %q", 2+i, args[2+i], w)
+				}
+			}
+		}
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_Version tests that a Bifrost adapter gives its build in OHAI, and answers version requests even
+// before its client logs in.
+func TestBifrost_Run_Version(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+		bf.SetAuth(auth.Static{})
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		info := version.Get()
+		ohai := <-bfc.Rx
+		if args := ohai.Args(); len(args) != 2 || args[1] != info.Server() {
+			t.Errorf("got OHAI %s, want server version %s", ohai.String(), info.Server())
+		}
+		// IAMA
+		<-bfc.Rx
+
+		bfc.Tx <- *message.New("v1", controller.RqVersion)
+		m := <-bfc.Rx
+		if got, want := m.String(), controller.VersionMessage("v1", info).String(); got != want {
+			t.Errorf("got %s, want %s", got, want)
+		}
+		if m := <-bfc.Rx; m.Word() != "ACK" || m.Args()[0] != "OK" {
+			t.Errorf("got %s, want a successful ACK", m.String())
+		}
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_Login tests that a Bifrost adapter with an auth provider refuses requests until its client logs in.
+func TestBifrost_Run_Login(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+		bf.SetAuth(auth.Static{"sesame": {User: "ali", Groups: []string{"presenters"}}})
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		// OHAI and IAMA; there is no dump until the client logs in.
+		<-bfc.Rx
+		<-bfc.Rx
+
+		cases := []struct {
+			rq   *message.Message
+			want []string
+		}{
+			{message.New("k1", "known"), []string{"ACK WHAT 'log in first'"}},
+			{message.New("l1", controller.RqLogin).AddArgs("token", "open"), []string{"ACK WHAT 'login denied'"}},
+			{message.New("l2", controller.RqLogin).AddArgs("token"), []string{"ACK WHAT 'bad arity: got 1 arguments, want 2'"}},
+			{message.New("l3", controller.RqLogin).AddArgs("token", "sesame"), []string{"IDENT ali presenters", "ACK OK success"}},
+			{message.New("k2", "known"), []string{"KNOWN", "ACK OK success"}},
+		}
+		for _, c := range cases {
+			bfc.Tx <- *c.rq
+			for _, w := range c.want {
+				want := c.rq.Tag() + " " + w + "\n"
+				m := <-bfc.Rx
+				if got := m.String(); got != want {
+					t.Fatalf("got %q, want %q", got, want)
+				}
+			}
+		}
+
+		close(bfc.Tx)
+		wg.Wait()
+
+		if id, ok := bf.Identity(); !ok || id.User != "ali" {
+			t.Errorf("identity: got %v (ok %v), want ali", id, ok)
+		}
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_Motd tests that a Bifrost adapter greets its client with the message of the day, and lets admins,
+// and only admins, change it, reporting the denials.
+func TestBifrost_Run_Motd(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		announced := make(chan message.Message, 1)
+		motd := controller.NewMotd("maintenance at 02:00")
+		motd.SetAdmins("admins")
+		motd.SetAnnouncer(func(m message.Message) { announced <- m })
+		// Each adapter calls the hook on its own goroutine, and is done before the next starts.
+		var denied []controller.DeniedRequest
+
+		type exchange struct {
+			rq   *message.Message
+			want []string
+		}
+		cases := []struct {
+			token string
+			xs    []exchange
+		}{
+			{"bobs", []exchange{
+				{message.New("m1", controller.RqMotd), []string{"MOTD 'maintenance at 02:00'", "ACK OK success"}},
+				{message.New("m2", controller.RqMotd).AddArgs("all clear"), []string{`ACK WHAT 'only members of group "admins" may do that; you are "bob", in no groups'`}},
+			}},
+			{"sesame", []exchange{
+				{message.New("m3", controller.RqMotd).AddArgs("all clear"), []string{"ACK OK success"}},
+				{message.New("m4", controller.RqMotd), []string{"MOTD 'all clear'", "ACK OK success"}},
+			}},
+		}
+		for _, c := range cases {
+			bcli, err := cli.Copy(ctx)
+			if err != nil {
+				t.Fatalf("copy failed: %v", err)
+			}
+			bf, bfc := controller.NewBifrost(bcli)
+			bf.SetAuth(auth.Static{"sesame": {User: "ali", Groups: []string{"admins"}}, "bobs": {User: "bob"}})
+			bf.SetMotd(motd)
+			bf.SetDeniedRequestHook(func(r controller.DeniedRequest) { denied = append(denied, r) })
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				bf.Run(ctx)
+				wg.Done()
+			}()
+
+			// OHAI and IAMA, then the message of the day.
+			<-bfc.Rx
+			<-bfc.Rx
+			greeting := <-bfc.Rx
+			if got, want := greeting.String(), "! MOTD '"+motd.Text()+"'\n"; got != want {
+				t.Fatalf("got greeting %q, want %q", got, want)
+			}
+
+			bfc.Tx <- *message.New("l1", controller.RqLogin).AddArgs("token", c.token)
+			for m := <-bfc.Rx; m.Word() != "ACK"; m = <-bfc.Rx {
+			}
+
+			for _, x := range c.xs {
+				bfc.Tx <- *x.rq
+				for _, w := range x.want {
+					want := x.rq.Tag() + " " + w + "\n"
+					m := <-bfc.Rx
+					if got := m.String(); got != want {
+						t.Fatalf("got %q, want %q", got, want)
+					}
+				}
+			}
+
+			close(bfc.Tx)
+			wg.Wait()
+		}
+
+		m := <-announced
+		if got := m.String(); got != "! MOTD 'all clear'\n" {
+			t.Errorf("announced %q, want the new message", got)
+		}
+		if len(denied) != 1 || denied[0].Tag != "m2" || denied[0].Err.Identity.User != "bob" {
+			t.Errorf("denials reported: %+v, want just m2 from bob", denied)
+		}
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_Tune tests that a Bifrost adapter lets admins, and only admins, get and change tunables, checking
+// the new values, and auditing and announcing each change.
+func TestBifrost_Run_Tune(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		window := "50ms"
+		ts := controller.NewTunables()
+		ts.Add(controller.Tunable{
+			Name: "coalesce",
+			Doc:  "The window.",
+			Get:  func() string { return window },
+			Set: func(v string) error {
+				if _, err := time.ParseDuration(v); err != nil {
+					return errors.New("not a duration")
+				}
+				window = v
+				return nil
+			},
+		})
+		ts.SetAdmins("admins")
+		announced := make(chan message.Message, 1)
+		ts.SetAnnouncer(func(m message.Message) { announced <- m })
+		var audited []controller.TuneChange
+		ts.SetAuditHook(func(c controller.TuneChange) { audited = append(audited, c) })
+
+		type exchange struct {
+			rq   *message.Message
+			want []string
+		}
+		cases := []struct {
+			token string
+			xs    []exchange
+		}{
+			{"bobs", []exchange{
+				{message.New("t1", controller.RqTune), []string{`ACK WHAT 'only members of group "admins" may do that; you are "bob", in no groups'`}},
+			}},
+			{"sesame", []exchange{
+				{message.New("t2", controller.RqTune), []string{"TUNE coalesce 50ms 'The window.'", "ACK OK success"}},
+				{message.New("t3", controller.RqTune).AddArgs("nonesuch"), []string{`ACK WHAT 'bad argument 1 ("nonesuch"): no such tunable'`}},
+				{message.New("t4", controller.RqTune).AddArgs("coalesce", "soon"), []string{`ACK WHAT 'bad argument 2 ("soon"): not a duration'`}},
+				{message.New("t5", controller.RqTune).AddArgs("coalesce", "1s"), []string{"TUNE coalesce 1s 'The window.'", "ACK OK success"}},
+			}},
+		}
+		for _, c := range cases {
+			bcli, err := cli.Copy(ctx)
+			if err != nil {
+				t.Fatalf("copy failed: %v", err)
+			}
+			bf, bfc := controller.NewBifrost(bcli)
+			bf.SetAuth(auth.Static{"sesame": {User: "ali", Groups: []string{"admins"}}, "bobs": {User: "bob"}})
+			bf.SetTunables(ts)
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				bf.Run(ctx)
+				wg.Done()
+			}()
+
+			// OHAI and IAMA.
+			<-bfc.Rx
+			<-bfc.Rx
+
+			bfc.Tx <- *message.New("l1", controller.RqLogin).AddArgs("token", c.token)
+			for m := <-bfc.Rx; m.Word() != "ACK"; m = <-bfc.Rx {
+			}
+
+			for _, x := range c.xs {
+				bfc.Tx <- *x.rq
+				for _, w := range x.want {
+					want := x.rq.Tag() + " " + w + "\n"
+					m := <-bfc.Rx
+					if got := m.String(); got != want {
+						t.Fatalf("got %q, want %q", got, want)
+					}
+				}
+			}
+
+			close(bfc.Tx)
+			wg.Wait()
+		}
+
+		m := <-announced
+		if got := m.String(); got != "! TUNE coalesce 1s 'The window.'\n" {
+			t.Errorf("announced %q, want the new value", got)
+		}
+		if len(audited) != 1 || audited[0].Old != "50ms" || audited[0].New != "1s" || audited[0].Identity.User != "ali" {
+			t.Errorf("changes audited: %+v, want just 50ms to 1s by ali", audited)
+		}
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_Cancel tests that clients can cancel their in-flight requests by tag.
+func TestBifrost_Run_Cancel(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		// OHAI and IAMA; the test state's dump is empty.
+		<-bfc.Rx
+		<-bfc.Rx
+
+		expect := func(want string) {
+			t.Helper()
+			m := <-bfc.Rx
+			if got := m.String(); got != want+"\n" {
+				t.Fatalf("got %q, want %q", got, want+"\n")
+			}
+		}
+
+		bfc.Tx <- *message.New("w1", "wait")
+		bfc.Tx <- *message.New("c1", controller.RqCancel).AddArgs("w1")
+		expect("c1 ACK OK success")
+		expect("w1 ACK WHAT cancelled")
+
+		// The cancellation ACK doesn't depend on the error mode.
+		bfc.Tx <- *message.New("e1", controller.RqErrMode).AddArgs(controller.ErrModeCode)
+		expect("e1 ACK OK success")
+		bfc.Tx <- *message.New("w2", "wait")
+		bfc.Tx <- *message.New("c2", controller.RqCancel).AddArgs("w2")
+		expect("c2 ACK OK success")
+		expect("w2 ACK WHAT cancelled")
+
+		bfc.Tx <- *message.New("c3", controller.RqCancel).AddArgs("w1")
+		expect("c3 ACK WHAT error")
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_Batch tests that the Bifrost adapter unpacks batches, acknowledging each request in them and then
+// summarising the batch.
+func TestBifrost_Run_Batch(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		// OHAI and IAMA; the test state's dump is empty.
+		<-bfc.Rx
+		<-bfc.Rx
+
+		exchange := func(rq *message.Message, want ...string) {
+			t.Helper()
+			bfc.Tx <- *rq
+			for _, w := range want {
+				m := <-bfc.Rx
+				if got := m.String(); got != w+"\n" {
+					t.Fatalf("got %q, want %q", got, w+"\n")
+				}
+			}
+		}
+
+		// Each request waits for the one before it to be acknowledged, whether the Controller or the adapter handles it.
+		exchange(message.New("b1", controller.RqBatch).AddArgs("known", "nonesuch 1", "display", "known"),
+			"b1.1 KNOWN",
+			"b1.1 ACK OK success",
+			"b1.2 ACK WHAT 'unknown word: nonesuch'",
+			"b1.3 ACK OK success",
+			"b1.4 KNOWN",
+			"b1.4 ACK OK success",
+			"b1 BATCH 4 3 1",
+			"b1 ACK OK success",
+		)
+		exchange(message.New("b2", controller.RqBatch), "b2 ACK WHAT 'bad arity: got 0 arguments, want 1 to 64'")
+		exchange(message.New("b3", controller.RqBatch).AddArgs("batch known"),
+			"b3.1 ACK WHAT 'batch is not allowed in a batch'",
+			"b3 BATCH 1 0 1",
+			"b3 ACK OK success",
+		)
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// TestBifrost_Run_Drain tests that a draining Bifrost adapter refuses new requests for the Controller, but only
+// reports being drained once its requests in flight are acknowledged.
+func TestBifrost_Run_Drain(t *testing.T) {
+	f := func(ctx context.Context, cli *controller.Client, t *testing.T) {
+		bf, bfc := controller.NewBifrost(cli)
+
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			bf.Run(ctx)
+			wg.Done()
+		}()
+
+		// OHAI and IAMA; the test state's dump is empty.
+		<-bfc.Rx
+		<-bfc.Rx
+
+		expect := func(want string) {
+			t.Helper()
+			m := <-bfc.Rx
+			if got := m.String(); got != want+"\n" {
+				t.Fatalf("got %q, want %q", got, want+"\n")
+			}
+		}
+
+		bfc.Tx <- *message.New("w1", "wait")
+		// The adapter handles requests in order, so w1 is in flight once e1 is acknowledged.
+		bfc.Tx <- *message.New("e1", controller.RqErrMode).AddArgs(controller.ErrModeCode)
+		expect("e1 ACK OK success")
+		bf.Drain()
+		bfc.Tx <- *message.New("k1", "known")
+		expect("k1 ACK WHAT " + controller.CodeShuttingDown)
+
+		select {
+		case <-bf.Drained():
+			t.Fatal("drained with a request in flight")
+		default:
+		}
+
+		// Requests about the connection itself still work.
+		bfc.Tx <- *message.New("c1", controller.RqCancel).AddArgs("w1")
+		expect("c1 ACK OK success")
+		expect("w1 ACK WHAT cancelled")
+		<-bf.Drained()
+
+		close(bfc.Tx)
+		wg.Wait()
+	}
+	testWithController(&testStateWithParser{}, f, t)
+}
+
+// orderedRequest is a request that the test state records, in handling order, in a prioState.
+type orderedRequest struct {
+	Name     string
+	Priority controller.Priority
+}
+
+// prioState is a test state that gives orderedRequests their own priorities.
+type prioState struct {
+	testState
+	handled []string
+}
+
+func (s *prioState) HandleRequest(ctx context.Context, replyCb, bcastCb controller.ResponseCb, rbody interface{}) error {
+	if b, ok := rbody.(orderedRequest); ok {
+		s.handled = append(s.handled, b.Name)
+		return nil
+	}
+	return s.testState.HandleRequest(ctx, replyCb, bcastCb, rbody)
+}
+
+func (*prioState) Priority(rbody interface{}) controller.Priority {
+	if b, ok := rbody.(orderedRequest); ok {
+		return b.Priority
+	}
+	return controller.PriorityNormal
+}
+
+// TestController_Priority tests that, of the requests waiting for a Controller, it handles the most urgent first.
+func TestController_Priority(t *testing.T) {
+	s := &prioState{}
+	f := func(ctx context.Context, c *controller.Client, t *testing.T) {
+		clients := make([]*controller.Client, 2)
+		for i := range clients {
+			var err error
+			if clients[i], err = c.Copy(ctx); err != nil {
+				t.Fatalf("unexpected error on copy: %s", err.Error())
+			}
+		}
+
+		send := func(c *controller.Client, body interface{}) {
+			_, _ = c.SendAndProcessReplies(ctx, "", body, func(controller.Response) error { return nil })
+		}
+
+		// Wedge the controller so that both requests are waiting when it next looks.
+		release := make(chan struct{})
+		var wg sync.WaitGroup
+		wg.Add(3)
+		go func() {
+			send(c, wedgeRequest{Release: release})
+			wg.Done()
+		}()
+		time.Sleep(10 * time.Millisecond)
+		go func() {
+			send(clients[0], orderedRequest{Name: "bulk", Priority: controller.PriorityBulk})
+			wg.Done()
+		}()
+		go func() {
+			send(clients[1], orderedRequest{Name: "operator", Priority: controller.PriorityOperator})
+			wg.Done()
+		}()
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		wg.Wait()
+
+		if len(s.handled) != 2 || s.handled[0] != "operator" {
+			t.Errorf("got handling order %v, want operator first", s.handled)
+		}
+	}
+	testWithController(s, f, t)
+}
+
+// snapState is a test state that dumps from snapshots.
+type snapState struct {
+	testState
+}
+
+func (*snapState) Snapshot() []interface{} {
+	return []interface{}{knownDummyResponse{}, knownDummyResponse{}}
+}
+
+// TestController_SnapshotDump tests that a snapshot dump to a slow client doesn't hold up other clients,
+// and that the slow client only gets broadcasts once it has the dump.
+func TestController_SnapshotDump(t *testing.T) {
+	f := func(ctx context.Context, c *controller.Client, t *testing.T) {
+		go func() {
+			for range c.Rx {
+			}
+		}()
+
+		slow, err := c.Copy(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error on copy: %s", err.Error())
+		}
+		fast, err := c.Copy(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error on copy: %s", err.Error())
+		}
+		go func() {
+			for range fast.Rx {
+			}
+		}()
+
+		// The slow client doesn't read its dump until later.
+		dump := make(chan controller.Response)
+		slow.Send(ctx, controller.Request{Origin: controller.RequestOrigin{ReplyTx: dump}, Body: controller.DumpRequest{}})
+
+		done := make(chan error)
+		go func() {
+			_, err := fast.SendAndProcessReplies(ctx, "", knownDummyRequest{Broadcast: true}, func(controller.Response) error { return nil })
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("unexpected error on broadcast request: %s", err.Error())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("request held up by a dump")
+		}
+
+		select {
+		case rs := <-slow.Rx:
+			t.Fatalf("got broadcast %v before dump", rs)
+		default:
+		}
+		if err := controller.ProcessRepliesUntilAck(dump, func(controller.Response) error { return nil }); err != nil {
+			t.Fatalf("unexpected error on dump: %s", err.Error())
+		}
+		if rs := <-slow.Rx; !rs.Broadcast {
+			t.Errorf("got %v after dump, want the missed broadcast", rs)
+		}
+	}
+	testWithController(&snapState{}, f, t)
+}
+
+// dumpState is a test state whose dump is two dummy responses.
+type dumpState struct {
+	testState
+}
+
+func (*dumpState) Dump(dumpCb controller.ResponseCb) {
+	dumpCb(knownDummyResponse{})
+	dumpCb(knownDummyResponse{})
+}
+
+// TestClient_CopyWithDump tests that a Client copied with a dump gets the dump, then every later broadcast.
+func TestClient_CopyWithDump(t *testing.T) {
+	f := func(ctx context.Context, c *controller.Client, t *testing.T) {
+		go func() {
+			for range c.Rx {
+			}
+		}()
+
+		ndump := 0
+		c2, err := c.CopyWithDump(ctx, func(r controller.Response) error {
+			if _, ok := r.Body.(knownDummyResponse); !ok {
+				return fmt.Errorf("unexpected dump response %v", r)
+			}
+			ndump++
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error on copy: %s", err.Error())
+		}
+		if ndump != 2 {
+			t.Errorf("got %d dump responses, want 2", ndump)
+		}
+
+		bcast := make(chan controller.Response)
+		go func() {
+			for rs := range c2.Rx {
+				bcast <- rs
+			}
+		}()
+		if _, err := c.SendAndProcessReplies(ctx, "", knownDummyRequest{Broadcast: true}, func(controller.Response) error { return nil }); err != nil {
+			t.Fatalf("unexpected error on broadcast request: %s", err.Error())
+		}
+		if rs := <-bcast; !rs.Broadcast {
+			t.Errorf("got %v after dump, want the broadcast", rs)
+		}
+	}
+	testWithController(&dumpState{}, f, t)
+}
+
+// TestClient_CopyWithDump_Error tests that a Client copied with a dump that its callback rejects doesn't stay connected.
+func TestClient_CopyWithDump_Error(t *testing.T) {
+	f := func(ctx context.Context, c *controller.Client, t *testing.T) {
+		go func() {
+			for range c.Rx {
+			}
+		}()
+
+		want := errors.New("rejected")
+		c2, err := c.CopyWithDump(ctx, func(controller.Response) error { return want })
+		if !errors.Is(err, want) {
+			t.Fatalf("got error %v, want %v", err, want)
+		}
+		if c2 != nil {
+			t.Fatal("got non-nil Client from a failed copy")
+		}
+
+		// If the rejected client were still connected, nobody would read this broadcast, and the Controller would wedge.
+		done := make(chan error)
+		go func() {
+			_, err := c.SendAndProcessReplies(ctx, "", knownDummyRequest{Broadcast: true}, func(controller.Response) error { return nil })
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("unexpected error on broadcast request: %s", err.Error())
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("broadcast held up by the rejected client")
+		}
+	}
+	testWithController(&dumpState{}, f, t)
+}
+
+// mountCounter gets the mount metric key, or 0 if it hasn't been set.
+func mountCounter(key string) int64 {
+	v, ok := expvar.Get("yaps_mounts").(*expvar.Map).Get(key).(*expvar.Int)
+	if !ok {
+		return 0
+	}
+	return v.Value()
+}
+
+// TestController_Mount tests that a Controller forwards 'on' requests to a mount point, and counts them.
+func TestController_Mount(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inner, innerCli := controller.NewController(&testState{})
+	go inner.Run(ctx)
+	outer, outerCli := controller.NewController(&testState{})
+	outer.Mount("m", *innerCli)
+	go outer.Run(ctx)
+
+	requests, errs := mountCounter("m.requests"), mountCounter("m.errors")
+
+	send := func(mount string, body interface{}) ([]controller.Response, error) {
+		t.Helper()
+		var replies []controller.Response
+		rq := controller.OnRequest{MountPoint: mount, Request: controller.Request{Body: body}}
+		ok, err := outerCli.SendAndProcessReplies(ctx, "t", rq, func(rs controller.Response) error {
+			replies = append(replies, rs)
+			return nil
+		})
+		if !ok {
+			t.Fatal("controller stopped during request")
+		}
+		return replies, err
+	}
+
+	replies, err := send("m", knownDummyRequest{})
+	if err != nil {
+		t.Fatalf("forwarded request failed: %v", err)
+	}
+	want := controller.OnResponse{MountPoint: "m", Request: controller.Response{Body: knownDummyResponse{}}}
+	if len(replies) != 1 {
+		t.Fatalf("got %d replies, want 1", len(replies))
+	}
+	if got, ok := replies[0].Body.(controller.OnResponse); !ok || got.MountPoint != want.MountPoint || got.Request.Body != want.Request.Body {
+		t.Errorf("got reply %v, want %v", replies[0].Body, want)
+	}
+
+	if _, err := send("m", "junk"); err == nil {
+		t.Error("mount accepted a bad request")
+	}
+	if _, err := send("nowhere", knownDummyRequest{}); err == nil {
+		t.Error("forwarded to a missing mount point")
+	}
+
+	if got := mountCounter("m.requests") - requests; got != 2 {
+		t.Errorf("counted %d requests, want 2", got)
+	}
+	if got := mountCounter("m.errors") - errs; got != 1 {
+		t.Errorf("counted %d errors, want 1", got)
+	}
+
+	if err := outerCli.Shutdown(ctx); err != nil {
+		t.Errorf("error shutting down outer controller: %v", err)
+	}
+	if err := innerCli.Shutdown(ctx); err != nil {
+		t.Errorf("error shutting down inner controller: %v", err)
+	}
+}
+
+// TestController_MountBreaker tests that a mount whose requests keep timing out becomes degraded, failing requests
+// fast, and recovers once it answers probes again.
+func TestController_MountBreaker(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inner, innerCli := controller.NewController(&testState{})
+	go inner.Run(ctx)
+	outer, outerCli := controller.NewController(&testState{})
+	outer.Mount("b", *innerCli)
+	outer.SetMountBreaker("b", controller.BreakerConfig{Failures: 2, Timeout: 50 * time.Millisecond, ProbeInterval: 10 * time.Millisecond})
+	go outer.Run(ctx)
+
+	send := func(body interface{}) error {
+		t.Helper()
+		rq := controller.OnRequest{MountPoint: "b", Request: controller.Request{Body: body}}
+		ok, err := outerCli.SendAndProcessReplies(ctx, "t", rq, func(controller.Response) error { return nil })
+		if !ok {
+			t.Fatal("controller stopped during request")
+		}
+		return err
+	}
+
+	// The first request wedges the mount, and times out; the second can't get through to the mount at all.
+	release := make(chan struct{})
+	for i := 0; i < 2; i++ {
+		if err := send(wedgeRequest{Release: release}); bifrost.CodeOf(err) != controller.CodeTimeout {
+			t.Fatalf("request %d: got error %v, want code %q", i, err, controller.CodeTimeout)
+		}
+	}
+
+	start := time.Now()
+	err := send(knownDummyRequest{})
+	if code := bifrost.CodeOf(err); code != controller.CodeDegraded {
+		t.Fatalf("got error %v (code %q), want code %q", err, code, controller.CodeDegraded)
+	}
+	if elapsed := time.Since(start); 50*time.Millisecond <= elapsed {
+		t.Errorf("degraded mount took %s to refuse a request", elapsed)
+	}
+
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for send(knownDummyRequest{}) != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("mount never recovered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := outerCli.Shutdown(ctx); err != nil {
+		t.Errorf("error shutting down outer controller: %v", err)
+	}
+	if err := innerCli.Shutdown(ctx); err != nil {
+		t.Errorf("error shutting down inner controller: %v", err)
+	}
+}
+
+// ctxState is a test state that reports what it finds in each request's context.
+type ctxState struct {
+	testState
+}
+
+// ctxResponse is the reply ctxState gives to every request.
+type ctxResponse struct {
+	User      string
+	Namespace string
+}
+
+func (*ctxState) HandleRequest(ctx context.Context, replyCb, _ controller.ResponseCb, _ interface{}) error {
+	id, _ := controller.IdentityFrom(ctx)
+	replyCb(ctxResponse{User: id.User, Namespace: controller.NamespaceFrom(ctx)})
+	return nil
+}
+
+// TestController_Context tests that requests carry their context values through mount points, and that requests
+// whose deadlines have passed fail without reaching the state.
+func TestController_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	inner, innerCli := controller.NewController(&ctxState{})
+	go inner.Run(ctx)
+	outer, outerCli := controller.NewController(&ctxState{})
+	outer.Mount("m", *innerCli)
+	go outer.Run(ctx)
+
+	send := func(rctx context.Context, body interface{}) ([]controller.Response, error) {
+		t.Helper()
+		reply := make(chan controller.Response)
+		rq := controller.Request{Origin: controller.RequestOrigin{Tag: "t", ReplyTx: reply, Ctx: rctx}, Body: body}
+		if !outerCli.Send(ctx, rq) {
+			t.Fatal("controller stopped during request")
+		}
+		var replies []controller.Response
+		err := controller.ProcessRepliesUntilAck(reply, func(rs controller.Response) error {
+			replies = append(replies, rs)
+			return nil
+		})
+		return replies, err
+	}
+
+	rctx := controller.WithIdentity(ctx, auth.Identity{User: "ali"})
+	replies, err := send(rctx, knownDummyRequest{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if want := (ctxResponse{User: "ali"}); len(replies) != 1 || replies[0].Body != want {
+		t.Errorf("direct request: got %v, want %v", replies, want)
+	}
+
+	replies, err = send(rctx, controller.OnRequest{MountPoint: "m", Request: controller.Request{Body: knownDummyRequest{}}})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	want := ctxResponse{User: "ali", Namespace: "m"}
+	if len(replies) != 1 || replies[0].Body.(controller.OnResponse).Request.Body != want {
+		t.Errorf("mounted request: got %v, want %v", replies, want)
+	}
+
+	expired, cancelExpired := context.WithDeadline(ctx, time.Now().Add(-time.Second))
+	defer cancelExpired()
+	replies, err = send(expired, knownDummyRequest{})
+	if len(replies) != 0 {
+		t.Errorf("expired request reached the state: got %v", replies)
+	}
+	if code := bifrost.CodeOf(err); code != controller.CodeTimeout {
+		t.Errorf("expired request: got error %v (code %q), want code %q", err, code, controller.CodeTimeout)
+	}
+
+	if err := outerCli.Shutdown(ctx); err != nil {
+		t.Errorf("error shutting down outer controller: %v", err)
+	}
+	if err := innerCli.Shutdown(ctx); err != nil {
+		t.Errorf("error shutting down inner controller: %v", err)
+	}
+}
+
+// TestProgress tests that Progress reports each step of long requests, and nothing for short ones.
+func TestProgress(t *testing.T) {
+	var got []int
+	cb := func(rbody interface{}) {
+		got = append(got, rbody.(controller.ProgressResponse).Percent)
+	}
+
+	p := controller.NewProgress(cb, "testing", 200)
+	for i := 1; i <= 200; i++ {
+		p.Step(i)
+	}
+	if want := []int{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 100}; !reflect.DeepEqual(got, want) {
+		t.Errorf("long request: got reports %v, want %v", got, want)
+	}
+
+	got = nil
+	p = controller.NewProgress(cb, "testing", 5)
+	for i := 1; i <= 5; i++ {
+		p.Step(i)
+	}
+	if len(got) != 0 {
+		t.Errorf("short request: got reports %v, want none", got)
+	}
+
+	m := controller.ProgressResponse{Percent: 40, Note: "adding items"}.Message("t1")
+	if back, err := controller.ParseProgressResponse(m); err != nil || back.Percent != 40 || back.Note != "adding items" {
+		t.Errorf("round trip of %v: got %v, error %v", m, back, err)
+	}
+}
+
+// TestController_Observer tests that observers see broadcasts until unregistered, and miss those they fall too far
+// behind on without holding the Controller up.
+func TestController_Observer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctl, c := controller.NewController(&testState{})
+	go func() {
+		for range c.Rx {
+		}
+	}()
+
+	seen := make(chan controller.Response, 1)
+	o := ctl.RegisterObserver(func(r controller.Response) { seen <- r })
+
+	var (
+		release = make(chan struct{})
+		stuck   = make(chan struct{}, 1)
+	)
+	slow := ctl.RegisterObserver(func(controller.Response) {
+		stuck <- struct{}{}
+		<-release
+	})
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		ctl.Run(ctx)
+		wg.Done()
+	}()
+
+	bcast := func() {
+		t.Helper()
+		if _, err := c.SendAndProcessReplies(ctx, "", knownDummyRequest{Broadcast: true}, func(controller.Response) error { return nil }); err != nil {
+			t.Fatalf("unexpected error on broadcast request: %s", err.Error())
+		}
+	}
+
+	bcast()
+	if r := <-seen; !r.Broadcast || r.Body != (knownDummyResponse{}) {
+		t.Errorf("observer got %v, want the broadcast", r)
+	}
+	<-stuck
+
+	o.Unregister()
+	<-o.Done()
+	// The slow observer is stuck on the first broadcast, so it has room for ObserverBuffer more.
+	for i := 0; i < controller.ObserverBuffer+2; i++ {
+		bcast()
+	}
+	select {
+	case r := <-seen:
+		t.Errorf("unregistered observer got %v", r)
+	default:
+	}
+	if n := slow.Missed(); n != 2 {
+		t.Errorf("slow observer missed %d broadcasts, want 2", n)
+	}
+
+	if err := c.Shutdown(ctx); err != nil {
+		t.Errorf("error shutting client down after test: %s", err.Error())
+	}
+	wg.Wait()
+
+	// Once the Controller stops, the slow observer still sees what it had buffered.
+	close(release)
+	for i := 0; i < controller.ObserverBuffer; i++ {
+		<-stuck
+	}
+	<-slow.Done()
+}
@@ -0,0 +1,243 @@
+package controller
+
+// File describe.go contains the Bifrost adapter's handling of 'describe' requests, which tell clients which request
+// words the connection accepts, what arguments they take, and what the server may send back, so that generic clients
+// and UIs can build themselves from the server rather than from a copy of its documentation.
+//
+// 'describe' describes every word; 'describe <word>' describes just that one.
+// The reply is 'DESCRIBE <role> <requests> <responses>', counting the messages described, then, for each request
+// word the connection accepts, the adapter's own and then its role's,
+//
+//	RQ <word> <doc> <reply>...
+//
+// where the replies are the words of the messages the request replies with, other than the ACK, followed by one
+//
+//	ARG <word> <name> <type> <required|optional> <doc>
+//
+// per argument, in order; then 'RS <word> <doc>' and its ARGs for each response word.
+// Requests that may take the state's version as a final argument describe it as an optional 'Version' of type 'uint'.
+// The role is '-', and only the adapter's own words are described, if the state doesn't describe its messages.
+// Like 'version', 'describe' is available before logging in.
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+const (
+	// RqDescribe is the word of requests for the description of the protocol.
+	RqDescribe = "describe"
+	// RsDescribe is the word of messages starting the description of the protocol.
+	RsDescribe = "DESCRIBE"
+	// RsRequestSchema is the word of messages describing one request word.
+	RsRequestSchema = "RQ"
+	// RsResponseSchema is the word of messages describing one response word.
+	RsResponseSchema = "RS"
+	// RsArgSchema is the word of messages describing one argument of a request or response.
+	RsArgSchema = "ARG"
+)
+
+// Schema describes the Bifrost messages that one role understands and sends.
+type Schema struct {
+	// Role is the name of the role, such as 'list'.
+	Role string
+	// Requests describes the request words the role understands.
+	Requests []WordSchema
+	// Responses describes the response words the role sends.
+	Responses []WordSchema
+}
+
+// WordSchema describes one Bifrost message word.
+type WordSchema struct {
+	// Word is the message word.
+	Word string
+	// Doc describes the message.
+	Doc string
+	// Args describes the message's arguments, in order.
+	Args []ArgSchema
+	// Versioned is true if the request may take the state's version as an extra, final argument.
+	Versioned bool
+	// Replies lists the words of the messages a request replies with, other than the ACK.
+	Replies []string
+}
+
+// ArgSchema describes one argument of a Bifrost message.
+type ArgSchema struct {
+	// Name is the argument's name.
+	Name string
+	// Type is the argument's type, such as 'int' or 'hash'.
+	Type string
+	// Doc describes the argument.
+	Doc string
+	// Optional is true if the argument may be left off the end of the message.
+	Optional bool
+}
+
+// Describer is the interface of BifrostParsers that describe the messages they parse and emit.
+type Describer interface {
+	// BifrostSchema gets the description of the messages.
+	BifrostSchema() Schema
+}
+
+// adapterSchema describes the requests the adapter handles itself, whatever the state's role.
+var adapterSchema = []WordSchema{
+	{
+		Word: bifrost.RqSegSize,
+		Doc:  "Asks the server to split messages longer than a given length into segments.",
+		Args: []ArgSchema{{Name: "Max", Type: "int", Doc: "The longest line, in bytes, the client wants to receive."}},
+	},
+	{
+		Word: RqErrMode,
+		Doc:  "Chooses how the connection reports errors in ACKs.",
+		Args: []ArgSchema{
+			{Name: "Mode", Type: "string", Doc: "prose for descriptions, or code for error codes."},
+			{Name: "Locale", Type: "string", Doc: "The BCP 47 tag of the language of descriptions.", Optional: true},
+		},
+	},
+	{
+		Word:    RqCaps,
+		Doc:     "Declares what the client can do, tailoring the broadcasts it gets.",
+		Args:    []ArgSchema{{Name: "Caps", Type: "string", Doc: "The capabilities, as separate arguments.", Optional: true}},
+		Replies: []string{RsCaps},
+	},
+	{
+		Word:    RqTime,
+		Doc:     "Asks for the server's clock.",
+		Args:    []ArgSchema{{Name: "Token", Type: "string", Doc: "A token to echo in the reply.", Optional: true}},
+		Replies: []string{RsTime},
+	},
+	{
+		Word:    RqVersion,
+		Doc:     "Asks which build of the server this is.",
+		Replies: []string{RsVersion},
+	},
+	{
+		Word: RqLogin,
+		Doc:  "Logs in, as 'login password <user> <password>' or 'login token <token>'.",
+		Args: []ArgSchema{
+			{Name: "Method", Type: "string", Doc: "password or token."},
+			{Name: "Credentials", Type: "string", Doc: "The user and password, or the token, as separate arguments."},
+		},
+		Replies: []string{RsIdent},
+	},
+	{
+		Word:    RqDescribe,
+		Doc:     "Describes the request words the connection accepts and the responses the server sends.",
+		Args:    []ArgSchema{{Name: "Word", Type: "string", Doc: "The only word to describe.", Optional: true}},
+		Replies: []string{RsDescribe, RsRequestSchema, RsResponseSchema, RsArgSchema},
+	},
+	{
+		Word: RqCancel,
+		Doc:  "Cancels the client's unacknowledged requests with a tag.",
+		Args: []ArgSchema{{Name: "Tag", Type: "string", Doc: "The tag of the requests to cancel."}},
+	},
+	{
+		Word:    RqMotd,
+		Doc:     "Asks for the message of the day or, with a text, changes it.",
+		Args:    []ArgSchema{{Name: "Text", Type: "string", Doc: "The new message; empty clears it.", Optional: true}},
+		Replies: []string{RsMotd},
+	},
+	{
+		Word: RqDump,
+		Doc:  "Asks for the whole state, as the same messages that announce it.",
+	},
+	{
+		Word: RqDisplay,
+		Doc:  "Tells the server that the client is a read-only display, which may idle forever.",
+	},
+	{
+		Word:    RqClients,
+		Doc:     "Asks for the server's connections, as a series of CLIENT replies.",
+		Args:    []ArgSchema{{Name: "Options", Type: "string", Doc: "Query options, as option=value.", Optional: true}},
+		Replies: []string{RsClient},
+	},
+	{
+		Word: RqTune,
+		Doc:  "Lists the runtime tunables or, with a name and value, changes one.",
+		Args: []ArgSchema{
+			{Name: "Name", Type: "string", Doc: "The only tunable to list, or the one to change.", Optional: true},
+			{Name: "Value", Type: "string", Doc: "The tunable's new value.", Optional: true},
+		},
+		Replies: []string{RsTune},
+	},
+	{
+		Word:    RqBatch,
+		Doc:     "Carries several requests, each as a line without its tag, to be handled in order.",
+		Args:    []ArgSchema{{Name: "Requests", Type: "string", Doc: "The request lines, as separate arguments."}},
+		Replies: []string{RsBatch},
+	},
+}
+
+// describe gets the schema of the messages the adapter handles: its own, then those of its parser, if it describes
+// them.
+func (b *Bifrost) describe() Schema {
+	s := Schema{Role: AdapterRole}
+	if d, ok := b.parser.(Describer); ok {
+		s = d.BifrostSchema()
+	}
+	s.Requests = append(append([]WordSchema(nil), adapterSchema...), s.Requests...)
+	return s
+}
+
+// handleDescribe handles a request rq for the description of the protocol.
+func (b *Bifrost) handleDescribe(rq message.Message) {
+	var word string
+	if err := bifrost.Args(rq.Args()).Optional().String(0, &word).Err(); err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return
+	}
+
+	s := b.describe()
+	var rqs, rss []WordSchema
+	for _, w := range s.Requests {
+		if (word == "" || w.Word == word) && b.words.Accepts(w.Word) {
+			rqs = append(rqs, w)
+		}
+	}
+	for _, w := range s.Responses {
+		if word == "" || w.Word == word {
+			rss = append(rss, w)
+		}
+	}
+	if word != "" && len(rqs) == 0 && len(rss) == 0 {
+		b.respond(*b.errorToMessage(rq.Tag(), fmt.Errorf("describe: %w", UnknownWord(word))))
+		return
+	}
+
+	tag := rq.Tag()
+	b.respond(*message.New(tag, RsDescribe).AddArgs(s.Role, strconv.Itoa(len(rqs)), strconv.Itoa(len(rss))))
+	for _, w := range rqs {
+		b.respond(*message.New(tag, RsRequestSchema).AddArgs(w.Word, w.Doc).AddArgs(w.Replies...))
+		b.describeArgs(tag, w)
+	}
+	for _, w := range rss {
+		b.respond(*message.New(tag, RsResponseSchema).AddArgs(w.Word, w.Doc))
+		b.describeArgs(tag, w)
+	}
+	b.respond(*message.New(tag, core.RsAck).AddArgs("OK", "success"))
+}
+
+// describeArgs sends an ARG message with tag tag for each argument of w.
+func (b *Bifrost) describeArgs(tag string, w WordSchema) {
+	args := w.Args
+	if w.Versioned {
+		args = append(args[:len(args):len(args)], ArgSchema{
+			Name:     "Version",
+			Type:     "uint",
+			Doc:      "If given, the request fails unless the state is at this version.",
+			Optional: true,
+		})
+	}
+	for _, a := range args {
+		need := "required"
+		if a.Optional {
+			need = "optional"
+		}
+		b.respond(*message.New(tag, RsArgSchema).AddArgs(w.Word, a.Name, a.Type, need, a.Doc))
+	}
+}
@@ -0,0 +1,135 @@
+package controller
+
+// File dialect.go contains dialects: older flavours of Bifrost that some clients still speak, which the Bifrost
+// adapter translates to and from the current protocol so that those clients can move to yaps before they are
+// rewritten.
+//
+// A dialect renames words in each direction, and may have ACKs repeat the request they answer, as the BAPS3 protocol
+// that baps3d spoke did.
+// Translation happens entirely in the adapter: the Controller, and every other client, only ever see the current
+// protocol.
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+)
+
+// Dialect describes an older flavour of Bifrost.
+type Dialect struct {
+	// Name names the dialect, as in config.
+	Name string
+	// Requests maps request words in the dialect to the current words.
+	Requests map[string]string
+	// Responses maps current response words to the words in the dialect.
+	Responses map[string]string
+	// EchoAcks is true if ACKs repeat the word and arguments of the request they answer, after the description.
+	EchoAcks bool
+}
+
+// Baps3d is the dialect of baps3d, which older URY tooling speaks.
+var Baps3d = Dialect{
+	Name:      "baps3d",
+	Requests:  map[string]string{"select": "sel", "automode": "auto"},
+	Responses: map[string]string{"SEL": "SELECT", "AUTO": "AUTOMODE"},
+	EchoAcks:  true,
+}
+
+// dialects maps the name of each dialect to it.
+var dialects = map[string]*Dialect{
+	Baps3d.Name: &Baps3d,
+}
+
+// DialectByName gets the dialect called name.
+func DialectByName(name string) (*Dialect, error) {
+	d, ok := dialects[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown dialect: %s", name)
+	}
+	return d, nil
+}
+
+// SetDialect sets the dialect the client speaks; nil, the default, means the current protocol.
+// It must be called before Run.
+func (b *Bifrost) SetDialect(d *Dialect) {
+	if d == nil {
+		b.dialect = nil
+		return
+	}
+	b.dialect = &dialectState{d: d, pending: make(map[string][]message.Message)}
+}
+
+// dialectState is a Bifrost adapter's state for translating a dialect.
+type dialectState struct {
+	// d is the dialect.
+	d *Dialect
+
+	// mu guards pending.
+	// Requests come in on the adapter goroutine, but ACKs go out on the forwarding goroutine.
+	mu sync.Mutex
+	// pending maps the tags of requests whose ACKs are to echo them to the requests, as the client sent them, in the
+	// order they were sent.
+	pending map[string][]message.Message
+}
+
+// request translates the request rq from the dialect.
+// A nil dialectState leaves rq as it is.
+func (s *dialectState) request(rq message.Message) message.Message {
+	if s == nil {
+		return rq
+	}
+	// Time requests are the only ones without ACKs, so there'd be nothing to echo them.
+	if s.d.EchoAcks && rq.Word() != RqTime {
+		s.mu.Lock()
+		s.pending[rq.Tag()] = append(s.pending[rq.Tag()], rq)
+		s.mu.Unlock()
+	}
+
+	word, ok := s.d.Requests[rq.Word()]
+	if !ok {
+		return rq
+	}
+	return *message.New(rq.Tag(), word).AddArgs(rq.Args()...)
+}
+
+// response translates the response m into the dialect.
+// A nil dialectState leaves m as it is.
+func (s *dialectState) response(m message.Message) message.Message {
+	if s == nil {
+		return m
+	}
+	if m.Word() == core.RsAck {
+		return s.ack(m)
+	}
+
+	word, ok := s.d.Responses[m.Word()]
+	if !ok {
+		return m
+	}
+	return *message.New(m.Tag(), word).AddArgs(m.Args()...)
+}
+
+// ack translates the ACK m into the dialect, echoing the request it answers if need be.
+func (s *dialectState) ack(m message.Message) message.Message {
+	if !s.d.EchoAcks || m.Tag() == message.TagBcast {
+		return m
+	}
+
+	s.mu.Lock()
+	rqs := s.pending[m.Tag()]
+	if len(rqs) == 0 {
+		s.mu.Unlock()
+		return m
+	}
+	rq := rqs[0]
+	if len(rqs) == 1 {
+		delete(s.pending, m.Tag())
+	} else {
+		s.pending[m.Tag()] = rqs[1:]
+	}
+	s.mu.Unlock()
+
+	return *message.New(m.Tag(), m.Word()).AddArgs(m.Args()...).AddArgs(rq.Word()).AddArgs(rq.Args()...)
+}
@@ -0,0 +1,33 @@
+package controller
+
+// File display.go contains the Bifrost adapter's handling of 'display' requests.
+//
+// 'display' tells the server that the client is a read-only display, such as a studio clock or an on-air board,
+// which listens to broadcasts and seldom sends anything.
+// Servers use this to leave such clients alone when reclaiming idle connections.
+
+import (
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// RqDisplay is the word of requests declaring the client a read-only display.
+const RqDisplay = "display"
+
+// IsDisplay gets whether the client has declared itself a read-only display.
+// It is safe to call from any goroutine.
+func (b *Bifrost) IsDisplay() bool {
+	return b.display.Load()
+}
+
+// handleDisplay handles a request rq declaring the client a read-only display.
+func (b *Bifrost) handleDisplay(rq message.Message) {
+	if err := bifrost.Args(rq.Args()).Err(); err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return
+	}
+	b.display.Store(true)
+	b.respond(*message.New(rq.Tag(), core.RsAck).AddArgs("OK", "success"))
+}
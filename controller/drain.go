@@ -0,0 +1,69 @@
+package controller
+
+// File drain.go contains draining, which lets a server that is shutting down finish the requests its clients have
+// already made, without taking on any more, before it shuts its Controller down.
+//
+// Once told to drain, the adapter refuses requests that would go to the Controller, and logins, with the error code
+// 'shutting-down'; requests about the connection itself, such as 'time' and 'cancel', still work.
+// The adapter is drained once every request it sent the Controller has been acknowledged, and any login in progress
+// has been checked.
+
+import (
+	"errors"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// CodeShuttingDown is the error code of requests refused because the server is shutting down.
+const CodeShuttingDown = "shutting-down"
+
+// ErrShuttingDown is the error returned for requests made while the adapter is draining.
+var ErrShuttingDown = bifrost.WithCode(CodeShuttingDown, errors.New("the server is shutting down"))
+
+// Drain tells the adapter to stop sending new requests to the Controller; see Drained.
+// It is safe to call from any goroutine, and more than once.
+func (b *Bifrost) Drain() {
+	b.drainOnce.Do(func() { close(b.drain) })
+}
+
+// Drained gets a channel that closes once the adapter has drained, or stopped.
+func (b *Bifrost) Drained() <-chan struct{} {
+	return b.drained
+}
+
+// checkDraining gets whether the adapter is draining, starting to drain if it has been told to but hasn't noticed yet.
+// A request that arrives after Drain returns is always refused, even if the adapter's main loop has yet to see drain
+// close.
+func (b *Bifrost) checkDraining() bool {
+	if b.draining {
+		return true
+	}
+	select {
+	case <-b.drain:
+		b.startDraining()
+		return true
+	default:
+		return false
+	}
+}
+
+// startDraining stops the adapter taking new requests for the Controller.
+func (b *Bifrost) startDraining() {
+	if b.draining {
+		return
+	}
+	b.draining = true
+	b.checkDrained()
+}
+
+// checkDrained marks the adapter as drained if it is draining, and has nothing left in flight.
+func (b *Bifrost) checkDrained() {
+	if b.draining && len(b.inflight) == 0 && !b.loggingIn {
+		b.markDrained()
+	}
+}
+
+// markDrained marks the adapter as drained, if it hasn't been already.
+func (b *Bifrost) markDrained() {
+	b.drainedOnce.Do(func() { close(b.drained) })
+}
@@ -0,0 +1,182 @@
+package controller
+
+// File errmode.go contains the Bifrost adapter's per-connection choice of how errors are reported.
+//
+// Clients choose with 'errmode <mode> [locale]':
+//
+//	errmode prose        -- ACK <status> <English description> (the default)
+//	errmode prose <tag>  -- ACK <status> <description in the language of BCP 47 tag tag, if known, else English>
+//	errmode code         -- ACK <status> <error code>, for clients that show their own text
+//
+// Error codes come from bifrost.CodeOf.
+// The status is FAIL for errors blamed on the server, and WHAT otherwise.
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+const (
+	// RqErrMode is the word of requests choosing how errors are reported.
+	RqErrMode = "errmode"
+	// ErrModeProse is the error mode that reports errors as human-readable descriptions.
+	ErrModeProse = "prose"
+	// ErrModeCode is the error mode that reports errors as bare error codes.
+	ErrModeCode = "code"
+)
+
+var (
+	// ErrBadErrMode is the reason given for unknown error modes.
+	ErrBadErrMode = errors.New("error mode must be 'prose' or 'code'")
+	// ErrBadLocale is the reason given for locales that aren't shaped like BCP 47 tags.
+	ErrBadLocale = errors.New("not a locale tag")
+	// ErrLocaleWithCode is the error returned when a client gives a locale along with the code error mode.
+	ErrLocaleWithCode = errors.New("the code error mode doesn't take a locale")
+)
+
+// errorCatalogue maps language subtags, then error codes, to translated error descriptions.
+// Codes without a translation fall back to the error's own English message.
+// The generic code of uncoded errors is deliberately left untranslated, as it would swallow their specific messages.
+var errorCatalogue = map[string]map[string]string{
+	"de": {
+		bifrost.CodeArity:       "falsche Anzahl von Argumenten",
+		bifrost.CodeArg:         "ungültiges Argument",
+		bifrost.CodeEncoding:    "ungültige UTF-8-Kodierung",
+		bifrost.CodeSegment:     "ungültiges Segment",
+		bifrost.CodeUnknownWord: "unbekannter Befehl",
+		"conflict":              "Konflikt: die Liste wurde geändert",
+		"replica":               "die Liste ist schreibgeschützt",
+		"maintenance":           "die Liste ist wegen Wartungsarbeiten schreibgeschützt",
+		"duplicate":             "der Titel ist schon in der Liste",
+		"embargoed":             "der Beitrag ist noch gesperrt",
+		"expired":               "der Beitrag ist abgelaufen",
+		"stale":                 "Version zu alt für eine Differenz; bitte die ganze Liste abrufen",
+		CodePanic:               "interner Fehler",
+		CodeQuarantined:         "der Dienst ist nach wiederholten Fehlern gesperrt",
+		CodeUnauthenticated:     "bitte zuerst anmelden",
+		auth.CodeDenied:         "Anmeldung abgelehnt",
+		CodeTimeout:             "Zeitüberschreitung vor der Bearbeitung",
+		CodeShuttingDown:        "der Server wird heruntergefahren",
+		CodeDegraded:            "der eingebundene Dienst ist gestört",
+		CodeForbidden:           "Befehl auf dieser Verbindung nicht erlaubt",
+		CodeBadRequest:          "fehlerhafte Anfrage",
+	},
+	"fr": {
+		bifrost.CodeArity:       "mauvais nombre d'arguments",
+		bifrost.CodeArg:         "argument invalide",
+		bifrost.CodeEncoding:    "encodage UTF-8 invalide",
+		bifrost.CodeSegment:     "segment invalide",
+		bifrost.CodeUnknownWord: "commande inconnue",
+		"conflict":              "conflit : la liste a changé",
+		"replica":               "la liste est en lecture seule",
+		"maintenance":           "la liste est en lecture seule pour maintenance",
+		"duplicate":             "ce morceau est déjà dans la liste",
+		"embargoed":             "l'élément est sous embargo",
+		"expired":               "l'élément a expiré",
+		"stale":                 "version trop ancienne pour un diff ; rechargez toute la liste",
+		CodePanic:               "erreur interne",
+		CodeQuarantined:         "le service est mis en quarantaine après des erreurs répétées",
+		CodeUnauthenticated:     "connectez-vous d'abord",
+		auth.CodeDenied:         "connexion refusée",
+		CodeTimeout:             "délai dépassé avant le traitement",
+		CodeShuttingDown:        "le serveur s'arrête",
+		CodeDegraded:            "le service monté est dégradé",
+		CodeForbidden:           "commande non acceptée sur cette connexion",
+		CodeBadRequest:          "requête malformée",
+	},
+}
+
+// localise gets the description of e in the language of the locale tag locale, or e's own message if there isn't one.
+func localise(e error, locale string) string {
+	// Only the language subtag matters to the catalogue: 'fr-CA' and 'fr_FR' both get French.
+	lang, _, _ := strings.Cut(strings.ToLower(locale), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+
+	code := bifrost.CodeOf(e)
+	desc, ok := errorCatalogue[lang][code]
+	if !ok {
+		return e.Error()
+	}
+	// Arity and argument errors say which request or argument was wrong; the translation alone would lose that.
+	if code == bifrost.CodeArity || code == bifrost.CodeArg {
+		return desc + ": " + e.Error()
+	}
+	return desc
+}
+
+// errorToMessage converts the error e to a Bifrost message sent to tag t, in the client's chosen error mode.
+func (b *Bifrost) errorToMessage(t string, e error) *message.Message {
+	desc := e.Error()
+	switch {
+	case bifrost.CodeOf(e) == CodeCancelled:
+		// Clients must be able to tell cancellation from failure whatever their error mode; see 'cancel.go'.
+		desc = CodeCancelled
+	case b.errMode == ErrModeCode:
+		desc = bifrost.CodeOf(e)
+	case b.errLocale != "":
+		desc = localise(e, b.errLocale)
+	}
+
+	status := core.WordWhat
+	if isFailure(e) {
+		status = core.WordFail
+	}
+	return message.New(t, core.RsAck).AddArgs(status, desc)
+}
+
+// handleErrMode handles a request rq choosing how errors are reported to the client.
+func (b *Bifrost) handleErrMode(rq message.Message) {
+	var mode, locale string
+	err := bifrost.Args(rq.Args()).
+		Func(0, func(s string) error {
+			if s != ErrModeProse && s != ErrModeCode {
+				return ErrBadErrMode
+			}
+			mode = s
+			return nil
+		}).
+		Optional().
+		Func(1, func(s string) error {
+			if !isLocaleTag(s) {
+				return ErrBadLocale
+			}
+			locale = s
+			return nil
+		}).
+		Err()
+	if err == nil && mode == ErrModeCode && locale != "" {
+		err = ErrLocaleWithCode
+	}
+	if err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return
+	}
+
+	b.errMode, b.errLocale = mode, locale
+	b.respond(*message.New(rq.Tag(), core.RsAck).AddArgs("OK", "success"))
+}
+
+// isLocaleTag checks that s is shaped like a BCP 47 language tag: ASCII letters and digits in hyphen-separated subtags.
+// Underscores, as in POSIX locale names, are also allowed.
+func isLocaleTag(s string) bool {
+	if 35 < len(s) {
+		return false
+	}
+	for _, sub := range strings.Split(strings.ReplaceAll(s, "_", "-"), "-") {
+		if len(sub) == 0 || 8 < len(sub) {
+			return false
+		}
+		for _, r := range sub {
+			if !('a' <= r && r <= 'z' || 'A' <= r && r <= 'Z' || '0' <= r && r <= '9') {
+				return false
+			}
+		}
+	}
+	return true
+}
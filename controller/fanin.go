@@ -0,0 +1,138 @@
+package controller
+
+// File fanin.go contains the Controller's fan-in mode, which receives requests without reflection.
+//
+// By default, the Controller waits on every client's request channel at once through reflect.Select, which is the
+// only reflection on the path from a client's request to its handler.
+// In fan-in mode, each client instead gets a goroutine of its own that forwards its requests, and its hang-up, into one
+// channel the Controller waits on with a plain select; this costs a goroutine per client, but leaves the request path
+// free of reflection for deployments that want it easy to analyse and its cost predictable.
+// Handlers dispatch on request bodies with type switches in either mode.
+//
+// The forwarders take requests as soon as clients send them, so a Send returning no longer means that the Controller
+// has the request, only that it will get it: requests sent by different clients, even one after the other, may be
+// handled in either order, a request sent as the Controller shuts down is acknowledged with ErrControllerShutDown
+// rather than failing to send, and one sent after the Controller hung up on its client is acknowledged with
+// ErrClientHungUp.
+// Requests from the same client still arrive in order.
+
+import (
+	"errors"
+	"time"
+)
+
+// dropTimeout is how long a request the Controller won't handle waits for its sender to take its acknowledgement.
+const dropTimeout = 5 * time.Second
+
+// ErrClientHungUp is the error acknowledging requests that reach the Controller, in fan-in mode, after it has hung up
+// on their client.
+var ErrClientHungUp = errors.New("the controller has hung up on this client")
+
+// fannedRequest is a request, or a hang-up, forwarded from one client to the Controller in fan-in mode.
+type fannedRequest struct {
+	// from is the client the request came from.
+	from coclient
+	// rq is the request, if the client hasn't hung up.
+	rq Request
+	// open is false if the client has hung up.
+	open bool
+}
+
+// SetFanIn sets whether c receives requests in fan-in mode, through a goroutine per client rather than reflection;
+// false is the default.
+// It must be called before Run.
+func (c *Controller) SetFanIn(on bool) {
+	if !on {
+		c.fanIn = nil
+		c.rebuildClientSelects()
+		return
+	}
+	c.fanIn = make(chan fannedRequest)
+	c.cselects, c.cselClients = nil, nil
+}
+
+// startFanIn starts forwarding requests from every client c already has, if c is in fan-in mode.
+func (c *Controller) startFanIn() {
+	if c.fanIn == nil {
+		return
+	}
+	for cl := range c.clients {
+		go c.forward(cl)
+	}
+}
+
+// forward forwards the requests of client cl to c's fan-in channel until cl hangs up or c stops.
+func (c *Controller) forward(cl coclient) {
+	for {
+		var f fannedRequest
+		select {
+		case rq, ok := <-cl.rx:
+			f = fannedRequest{from: cl, rq: rq, open: ok}
+		case <-c.done:
+			return
+		}
+
+		select {
+		case c.fanIn <- f:
+		case <-c.done:
+			// The request's sender thinks it went through, and may be waiting for its acknowledgement.
+			drop(f, ErrControllerShutDown)
+			return
+		}
+		if !f.open {
+			return
+		}
+	}
+}
+
+// receiveFanIn is receive for fan-in mode.
+func (c *Controller) receiveFanIn(wait bool) bool {
+	var f fannedRequest
+	if wait {
+		select {
+		case f = <-c.fanIn:
+		case cl := <-c.dumpDone:
+			c.finishSnapshotDump(cl)
+			return true
+		}
+	} else {
+		select {
+		case f = <-c.fanIn:
+		case cl := <-c.dumpDone:
+			c.finishSnapshotDump(cl)
+			return true
+		default:
+			return false
+		}
+	}
+
+	switch _, ok := c.clients[f.from]; {
+	case !ok:
+		// We have already hung up on the client; its forwarder just hasn't heard yet.
+		// The Controller mustn't wait on the acknowledgement, as nobody may be left to take it.
+		go drop(f, ErrClientHungUp)
+	case !f.open:
+		c.hangUpClient(f.from)
+	default:
+		c.accept(f.from, f.rq)
+	}
+	return true
+}
+
+// drop acknowledges the forwarded request f, if it is one and has somewhere for replies to go, as failed with err
+// because the Controller won't handle it.
+// It gives up if the sender doesn't take the acknowledgement within dropTimeout, or its request's context ends.
+func drop(f fannedRequest, err error) {
+	if !f.open || f.rq.Origin.ReplyTx == nil {
+		return
+	}
+	reply := Response{Origin: &f.rq.Origin, Body: DoneResponse{err}}
+
+	timeout := time.NewTimer(dropTimeout)
+	defer timeout.Stop()
+	select {
+	case f.rq.Origin.ReplyTx <- reply:
+	case <-timeout.C:
+	case <-f.rq.Origin.Context().Done():
+	}
+}
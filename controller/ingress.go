@@ -0,0 +1,78 @@
+package controller
+
+// File ingress.go contains the Controller's checks on requests as they arrive, so that one client sending malformed
+// requests can't take down the Controller, or wedge it, for every other client.
+//
+// A request with no body, or with a body that is itself a request or response, is refused at once with the code
+// 'bad-request', without reaching the queue or the state.
+// A request with no reply channel can't be answered at all, so it is dropped and logged.
+// Either way, the sender gets a strike; with a limit set (see SetBadRequestLimit), a client that reaches it is hung up.
+
+import "fmt"
+
+// CodeBadRequest is the error code of BadRequestErrors.
+const CodeBadRequest = "bad-request"
+
+// BadRequestError is the error returned for requests that the Controller refuses before handling.
+type BadRequestError struct {
+	// Reason is why the request was refused.
+	Reason string
+}
+
+// Error gets the error message of a BadRequestError.
+func (e BadRequestError) Error() string {
+	return "bad request: " + e.Reason
+}
+
+// Code gets the error code of a BadRequestError.
+func (BadRequestError) Code() string {
+	return CodeBadRequest
+}
+
+// SetBadRequestLimit sets how many bad requests a client may send before c hangs up on it; 0, the default, means c
+// never does.
+// It must be called before Run.
+func (c *Controller) SetBadRequestLimit(limit int) {
+	c.badRequestLimit = limit
+}
+
+// admit checks the request rq, received on from, before it is queued, returning false if rq is refused.
+func (c *Controller) admit(from coclient, rq Request) bool {
+	err := checkRequest(rq)
+	if err == nil {
+		return true
+	}
+
+	c.log.Printf("refusing request from session %d: %v\n", from.session, err)
+	if rq.Origin.ReplyTx != nil {
+		c.reply(rq.Origin, DoneResponse{err})
+	}
+	c.strike(from)
+	return false
+}
+
+// checkRequest gets the reason the Controller refuses rq, if it does.
+func checkRequest(rq Request) error {
+	switch rq.Body.(type) {
+	case nil:
+		return BadRequestError{Reason: "no body"}
+	case Request, *Request, Response, *Response:
+		return BadRequestError{Reason: fmt.Sprintf("body is a %T", rq.Body)}
+	}
+	if rq.Origin.ReplyTx == nil {
+		return BadRequestError{Reason: "no reply channel"}
+	}
+	return nil
+}
+
+// strike counts a bad request against cl, hanging up on it if it has reached the bad request limit.
+func (c *Controller) strike(cl coclient) {
+	if c.badRequests == nil {
+		c.badRequests = make(map[coclient]int)
+	}
+	c.badRequests[cl]++
+	if 0 < c.badRequestLimit && c.badRequestLimit <= c.badRequests[cl] {
+		c.log.Printf("hanging up on session %d after %d bad requests\n", cl.session, c.badRequests[cl])
+		c.hangUpClient(cl)
+	}
+}
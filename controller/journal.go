@@ -0,0 +1,97 @@
+package controller
+
+// File journal.go contains the request journal, which remembers the last few requests a Controller handed to its
+// state, so that whoever picks up the pieces after a crash can see what the state was doing.
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultJournalSize is the number of requests a Journal keeps if not told otherwise.
+const DefaultJournalSize = 100
+
+// JournalEntry is one request in a Journal.
+type JournalEntry struct {
+	// Time is when the Controller handed the request to its state.
+	Time time.Time
+	// Session is the session of the client that made the request.
+	Session Session
+	// Tag is the request's tag, if any.
+	Tag string
+	// Request describes the request body.
+	Request string
+}
+
+// String gets a one-line description of e.
+func (e JournalEntry) String() string {
+	return fmt.Sprintf("%s session=%d tag=%q %s", e.Time.Format(time.RFC3339Nano), e.Session, e.Tag, e.Request)
+}
+
+// Journal is a fixed-size record of the most recent requests to a Controller's state.
+// It is safe to use from many goroutines at once.
+type Journal struct {
+	// mu guards entries and next.
+	mu sync.Mutex
+	// entries is a ring buffer of entries.
+	entries []JournalEntry
+	// next is the index in entries of the next entry, and the oldest entry once entries is full.
+	next int
+	// full is true once entries has wrapped around.
+	full bool
+}
+
+// NewJournal makes a Journal keeping the last size requests; a size of 0 or less means DefaultJournalSize.
+func NewJournal(size int) *Journal {
+	if size <= 0 {
+		size = DefaultJournalSize
+	}
+	return &Journal{entries: make([]JournalEntry, size)}
+}
+
+// record records the request with origin o and body body, from session sid.
+// A nil Journal records nothing.
+func (j *Journal) record(sid Session, o RequestOrigin, body interface{}) {
+	if j == nil {
+		return
+	}
+	e := JournalEntry{Time: time.Now(), Session: sid, Tag: o.Tag, Request: fmt.Sprintf("%T %+v", body, body)}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries[j.next] = e
+	j.next = (j.next + 1) % len(j.entries)
+	j.full = j.full || j.next == 0
+}
+
+// Entries gets the requests in j, oldest first.
+func (j *Journal) Entries() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.full {
+		return append([]JournalEntry(nil), j.entries[:j.next]...)
+	}
+	return append(append([]JournalEntry(nil), j.entries[j.next:]...), j.entries[:j.next]...)
+}
+
+// WriteTo writes the requests in j to w, one per line, oldest first.
+func (j *Journal) WriteTo(w io.Writer) (int64, error) {
+	var total int64
+	for _, e := range j.Entries() {
+		n, err := fmt.Fprintln(w, e)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// SetJournal sets the Journal in which c records each request it hands to its state; nil, the default, means c
+// doesn't record them.
+// It must be called before Run.
+func (c *Controller) SetJournal(j *Journal) {
+	c.journal = j
+}
@@ -0,0 +1,19 @@
+package controller
+
+// File json.go registers the JSON representations of the standard response bodies whose Go representations don't
+// marshal usefully.
+
+import "github.com/MattWindsor91/yaps/bifrost"
+
+func init() {
+	// Errors marshal as empty objects, so DoneResponses carry their errors' messages instead.
+	bifrost.RegisterJSON("DoneResponse", func(r DoneResponse) interface{} {
+		var jd struct {
+			Error string `json:",omitempty"`
+		}
+		if r.Err != nil {
+			jd.Error = r.Err.Error()
+		}
+		return jd
+	})
+}
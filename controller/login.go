@@ -0,0 +1,176 @@
+package controller
+
+// File login.go contains the Bifrost adapter's login handshake, for servers that need to know who their clients are.
+//
+// When the adapter has an auth provider, clients must log in before doing anything but choose how the connection
+// works (seg, segsize, errmode, time):
+//
+//	login password <user> <password>  -- log in with a user name and password
+//	login token <token>               -- log in with a token, such as an OIDC ID token
+//
+// A successful login gets 'IDENT <user> <group>...', then the state's dump, then an ACK.
+// Until then, the client hears nothing from the Controller: no dump, and no broadcasts.
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+const (
+	// RqLogin is the word of requests to log in.
+	RqLogin = "login"
+	// RsIdent is the word of messages announcing who the client logged in as.
+	RsIdent = "IDENT"
+
+	// CodeUnauthenticated is the error code of requests refused because the client hasn't logged in.
+	CodeUnauthenticated = "unauthenticated"
+
+	// loginTimeout is how long the auth provider has to check a client's credentials.
+	loginTimeout = 30 * time.Second
+)
+
+var (
+	// ErrUnauthenticated is the error returned for requests from clients that need to log in first.
+	ErrUnauthenticated = bifrost.WithCode(CodeUnauthenticated, errors.New("log in first"))
+	// ErrLoginPending is the error returned for logins made while another is being checked.
+	ErrLoginPending = errors.New("already logging in")
+	// ErrBadLoginMethod is the reason given for logins with a method other than 'password' or 'token'.
+	ErrBadLoginMethod = errors.New("login method must be 'password' or 'token'")
+)
+
+// loginResult is the outcome of checking a login.
+type loginResult struct {
+	// tag is the tag of the login request.
+	tag string
+	// id is who the client turned out to be, if err is nil.
+	id auth.Identity
+	// err is why the login failed, if it did.
+	err error
+}
+
+// authError is the error reported when the auth provider couldn't check a login at all.
+type authError struct {
+	// err is the provider's error.
+	err error
+}
+
+// Error gets the error message of an authError.
+func (e authError) Error() string {
+	return "couldn't check login: " + e.err.Error()
+}
+
+// Unwrap gets the provider's error.
+func (e authError) Unwrap() error {
+	return e.err
+}
+
+// Blame blames the server for an authError: the client's credentials may well be fine.
+func (authError) Blame() core.Blame {
+	return core.BlameServer
+}
+
+// SetAuth sets the provider the adapter checks logins with; if it is nil, the default, clients don't log in.
+// It must be called before Run.
+func (b *Bifrost) SetAuth(p auth.Provider) {
+	b.auth = p
+}
+
+// SetLoginHook sets a function the adapter calls, on its own goroutine, whenever the client logs in successfully;
+// nil, the default, means it calls nothing.
+// The hook mustn't block for long, as the adapter waits for it.
+// It must be called before Run.
+func (b *Bifrost) SetLoginHook(hook func(auth.Identity)) {
+	b.loginHook = hook
+}
+
+// Identity gets who the client logged in as, and whether it has logged in.
+// It is safe to call from any goroutine.
+func (b *Bifrost) Identity() (auth.Identity, bool) {
+	id := b.identity.Load()
+	if id == nil {
+		return auth.Identity{}, false
+	}
+	return *id, true
+}
+
+// authenticated checks whether the client may talk to the Controller.
+func (b *Bifrost) authenticated() bool {
+	return b.auth == nil || b.identity.Load() != nil
+}
+
+// handleLogin handles a request rq to log in.
+// The provider checks the credentials on another goroutine, so that a slow directory doesn't hold up the adapter;
+// the result comes back on b.logins.
+func (b *Bifrost) handleLogin(ctx context.Context, rq message.Message) {
+	// Servers that don't check logins don't know the word.
+	if b.auth == nil {
+		b.respond(*b.errorToMessage(rq.Tag(), UnknownWord(rq.Word())))
+		return
+	}
+
+	var (
+		method string
+		creds  auth.Credentials
+	)
+	args := bifrost.Args(rq.Args()).Func(0, func(s string) error {
+		if s != "password" && s != "token" {
+			return ErrBadLoginMethod
+		}
+		method = s
+		return nil
+	})
+	if method == "password" {
+		args = args.String(1, &creds.User).String(2, &creds.Password)
+	} else {
+		args = args.String(1, &creds.Token)
+	}
+	err := args.Err()
+	if err == nil && b.loggingIn {
+		err = ErrLoginPending
+	}
+	if err == nil && b.checkDraining() {
+		err = ErrShuttingDown
+	}
+	if err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return
+	}
+
+	b.loggingIn = true
+	tag := rq.Tag()
+	go func() {
+		lctx, cancel := context.WithTimeout(ctx, loginTimeout)
+		defer cancel()
+		id, err := b.auth.Authenticate(lctx, creds)
+		if err != nil && !errors.Is(err, auth.ErrDenied) {
+			err = authError{err: err}
+		}
+		// Only one login is ever in flight, and b.logins has room for its result.
+		b.logins <- loginResult{tag: tag, id: id, err: err}
+	}()
+}
+
+// handleLoginResult handles the outcome lr of checking a login.
+// It returns whether the Controller is still there.
+func (b *Bifrost) handleLoginResult(ctx context.Context, lr loginResult) bool {
+	b.loggingIn = false
+	if lr.err != nil {
+		b.respond(*b.errorToMessage(lr.tag, lr.err))
+		return true
+	}
+
+	b.identity.Store(&lr.id)
+	b.respond(*message.New(lr.tag, RsIdent).AddArgs(lr.id.User).AddArgs(lr.id.Groups...))
+	if b.loginHook != nil {
+		b.loginHook(lr.id)
+	}
+	// The client heard nothing from the Controller until now, so catch it up; the dump's ACK finishes the login.
+	return b.client.Send(ctx, *makeRequest(DumpRequest{}, lr.tag, b.reply))
+}
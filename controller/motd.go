@@ -0,0 +1,141 @@
+package controller
+
+// File motd.go contains the message of the day: a note from whoever runs the server, such as 'maintenance at 02:00',
+// that every client gets when it connects.
+//
+// Over Bifrost, the message is '! MOTD <text>', sent straight after IAMA when there is one.
+// 'motd' gets the message, and 'motd <text>' changes it (an empty text clears it), announcing the new message to every
+// client.
+// Servers can keep changes to a group of admins; otherwise, any client that may make requests may make them.
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+const (
+	// RqMotd is the word of requests to get or change the message of the day.
+	RqMotd = "motd"
+	// RsMotd is the word of messages carrying the message of the day.
+	RsMotd = "MOTD"
+)
+
+// ErrNotAdmin is the error matched by those returned when a client outside the admin group makes a request only admins
+// may make, such as changing the message of the day; see NotAdminError.
+var ErrNotAdmin = bifrost.WithCode(auth.CodeDenied, errors.New("only admins may do that"))
+
+// Motd is a message of the day, shared between the Bifrost adapters of a server.
+// It is safe to use from many goroutines.
+type Motd struct {
+	// mu guards text.
+	mu sync.Mutex
+	// text is the message, or empty if there isn't one.
+	text string
+	// admins is the group whose members may change the message, or empty if anyone may.
+	admins string
+	// announce, if not nil, sends messages to every client of the server.
+	announce func(message.Message)
+}
+
+// NewMotd makes a Motd whose message starts out as text.
+func NewMotd(text string) *Motd {
+	return &Motd{text: text}
+}
+
+// SetAdmins sets the group whose members may change m; empty, the default, means that anyone may.
+// It must be called before m is shared.
+func (m *Motd) SetAdmins(group string) {
+	m.admins = group
+}
+
+// SetAnnouncer sets the function m uses to tell every client of the server about changes.
+// It must be called before m is shared.
+func (m *Motd) SetAnnouncer(announce func(message.Message)) {
+	m.announce = announce
+}
+
+// Text gets the message of the day.
+func (m *Motd) Text() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.text
+}
+
+// Set changes the message of the day to text, and announces it.
+func (m *Motd) Set(text string) {
+	m.mu.Lock()
+	m.text = text
+	m.mu.Unlock()
+
+	if m.announce != nil {
+		m.announce(*MotdMessage(message.TagBcast, text))
+	}
+}
+
+// checkChange checks whether a client that logged in as id, or not at all if id is nil, may change m.
+func (m *Motd) checkChange(id *auth.Identity) error {
+	return CheckAdmin(id, m.admins)
+}
+
+// MotdMessage creates a MOTD message with tag tag, carrying text.
+func MotdMessage(tag, text string) *message.Message {
+	return message.New(tag, RsMotd).AddArgs(text)
+}
+
+// ParseMotdMessage tries to parse m as a 'MOTD' message, returning its text.
+func ParseMotdMessage(m *message.Message) (string, error) {
+	var text string
+	if err := core.CheckWord(RsMotd, m); err != nil {
+		return text, err
+	}
+	err := bifrost.Args(m.Args()).String(0, &text).Err()
+	return text, err
+}
+
+// SetMotd sets the message of the day the adapter greets its client with; nil, the default, means there is none.
+// It must be called before Run.
+func (b *Bifrost) SetMotd(m *Motd) {
+	b.motd = m
+}
+
+// sendMotd sends the message of the day, if there is one, as a broadcast.
+func (b *Bifrost) sendMotd() {
+	if b.motd == nil {
+		return
+	}
+	if text := b.motd.Text(); text != "" {
+		b.respond(*MotdMessage(message.TagBcast, text))
+	}
+}
+
+// handleMotd handles a request rq to get or change the message of the day.
+func (b *Bifrost) handleMotd(rq message.Message) {
+	if b.motd == nil {
+		b.respond(*b.errorToMessage(rq.Tag(), UnknownWord(rq.Word())))
+		return
+	}
+
+	var text string
+	args := rq.Args()
+	if err := bifrost.Args(args).Optional().String(0, &text).Err(); err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return
+	}
+
+	if len(args) == 0 {
+		b.respond(*MotdMessage(rq.Tag(), b.motd.Text()))
+	} else {
+		if err := b.motd.checkChange(b.identity.Load()); err != nil {
+			b.deny(rq, err)
+			return
+		}
+		b.motd.Set(text)
+	}
+	b.respond(*message.New(rq.Tag(), core.RsAck).AddArgs("OK", "success"))
+}
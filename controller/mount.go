@@ -0,0 +1,153 @@
+package controller
+
+// File mount.go contains the Controller's mount points, and the forwarding of 'on' requests to them.
+//
+// The Controller forwards an 'on' request to the mounted Controller, and relays its replies back, wrapped in
+// OnResponses, on another goroutine, so that a slow mount doesn't hold up the Controller.
+// The relay sends the acknowledgement, carrying the mount's own, once the mount acknowledges the request.
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// mountMetrics holds counters for every mount point, keyed by '<mount>.<counter>':
+// 'requests' counts requests forwarded, 'errors' counts those the mount rejected,
+// 'unreachable' counts those that couldn't be forwarded at all, 'rejected' counts those refused because the mount was
+// degraded (see breaker.go), 'trips' counts the times the mount became degraded, and 'latency_ms_sum' totals the
+// latencies of those the mount acknowledged.
+// 'latency_ms_le_<n>' counts acknowledged requests that took at most n milliseconds, 'latency_ms_le_inf' all of them.
+var mountMetrics = expvar.NewMap("yaps_mounts")
+
+// latencyBuckets holds the upper bounds, in milliseconds, of the latency histogram buckets.
+var latencyBuckets = []int64{1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Mount makes the Controller behind cli reachable through 'on' requests for the mount point name.
+// The caller must keep draining cli's Rx, which receives the mounted Controller's broadcasts.
+// It must be called before Run.
+func (c *Controller) Mount(name string, cli Client) {
+	if c.mounts == nil {
+		c.mounts = make(map[string]Client)
+	}
+	c.mounts[name] = cli
+}
+
+// startOnRequest forwards the request in b, with origin o, to its mount point, and starts relaying the replies.
+// If it can't forward the request, it returns the error, which the caller must acknowledge.
+func (c *Controller) startOnRequest(ctx context.Context, o RequestOrigin, b OnRequest) error {
+	m, ok := c.mounts[b.MountPoint]
+	if !ok {
+		return fmt.Errorf("no such mount point: %s", b.MountPoint)
+	}
+	br := c.breakers[b.MountPoint]
+	if br.isOpen() {
+		mountMetrics.Add(b.MountPoint+".rejected", 1)
+		return MountDegradedError{MountPoint: b.MountPoint}
+	}
+
+	mountMetrics.Add(b.MountPoint+".requests", 1)
+	replies := make(chan Response)
+	rq := b.Request
+	mctx, span := startSpan(o.Context(), "mount "+b.MountPoint,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(tagAttr(o.Tag)))
+	// With a timeout, the mount gets the same deadline as the relay, so that it can give up on the request too.
+	var (
+		rctx, sctx      = mountNamespace(mctx, b.MountPoint), ctx
+		cancel, scancel context.CancelFunc
+	)
+	if timeout := br.timeout(); 0 < timeout {
+		rctx, cancel = context.WithTimeout(rctx, timeout)
+		sctx, scancel = context.WithTimeout(sctx, timeout)
+	} else {
+		rctx, cancel = context.WithCancel(rctx)
+		sctx, scancel = context.WithCancel(sctx)
+	}
+	defer scancel()
+	rq.Origin = RequestOrigin{Tag: o.Tag, ReplyTx: replies, Ctx: rctx}
+
+	if !m.Send(sctx, rq) {
+		cancel()
+		mountMetrics.Add(b.MountPoint+".unreachable", 1)
+		err := fmt.Errorf("couldn't send to mount point: %s", b.MountPoint)
+		if ctx.Err() == nil {
+			err = mountTimeoutError(b.MountPoint, br.timeout())
+		}
+		if br.record(err) {
+			c.tripMount(ctx, b.MountPoint, br)
+		}
+		endSpan(span, err)
+		return err
+	}
+
+	go func() {
+		endSpan(span, c.relayOn(ctx, o, b.MountPoint, br, replies, time.Now()))
+		cancel()
+	}()
+	return nil
+}
+
+// relayOn relays replies from the mount point name, with breaker br, to a request with origin o sent at start, until it
+// acknowledges.
+// If the mount doesn't acknowledge within br's timeout, relayOn acknowledges the request with a timeout error, and
+// throws away the rest of the replies.
+// It returns the error, if any, with which it acknowledged the request.
+func (c *Controller) relayOn(ctx context.Context, o RequestOrigin, name string, br *breaker, replies <-chan Response, start time.Time) error {
+	var timeout <-chan time.Time
+	if t := br.timeout(); 0 < t {
+		timer := time.NewTimer(t)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var timedOut error
+
+	for {
+		select {
+		case rs := <-replies:
+			ack, ok := rs.Body.(DoneResponse)
+			switch {
+			case timedOut != nil && ok:
+				return timedOut
+			case timedOut != nil:
+			case ok:
+				observeMount(name, time.Since(start), ack.Err)
+				if br.record(ack.Err) {
+					c.tripMount(ctx, name, br)
+				}
+				c.reply(o, ack)
+				return ack.Err
+			default:
+				c.reply(o, OnResponse{MountPoint: name, Request: rs})
+			}
+		case <-timeout:
+			timedOut, timeout = mountTimeoutError(name, br.timeout()), nil
+			observeMount(name, time.Since(start), timedOut)
+			if br.record(timedOut) {
+				c.tripMount(ctx, name, br)
+			}
+			c.reply(o, DoneResponse{timedOut})
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// observeMount records a request to the mount point name that took latency, and failed with err if not nil.
+func observeMount(name string, latency time.Duration, err error) {
+	if err != nil {
+		mountMetrics.Add(name+".errors", 1)
+	}
+
+	ms := latency.Milliseconds()
+	mountMetrics.Add(name+".latency_ms_sum", ms)
+	for _, b := range latencyBuckets {
+		if ms <= b {
+			mountMetrics.Add(name+".latency_ms_le_"+strconv.FormatInt(b, 10), 1)
+		}
+	}
+	mountMetrics.Add(name+".latency_ms_le_inf", 1)
+}
@@ -0,0 +1,140 @@
+package controller
+
+// File observer.go contains observers: functions in the same program as a Controller that see each of its broadcasts,
+// so that programs embedding yaps as a library can follow a state without opening a loopback Bifrost connection to it.
+//
+// Each observer sees broadcasts, in order, on a goroutine of its own, through a buffer of ObserverBuffer broadcasts.
+// The Controller never waits for an observer: one that falls so far behind that its buffer fills misses broadcasts
+// until it catches up, and Missed counts how many, so that an observer that can't afford to miss anything knows when
+// it must resynchronise (say, by dumping the state through a Client).
+// An observer may itself send requests to the Controller, as it never holds the Controller up.
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// ObserverBuffer is the number of broadcasts an observer can fall behind by before it starts missing them.
+const ObserverBuffer = 256
+
+// Observer is a registration of a function that sees each broadcast a Controller sends.
+type Observer struct {
+	// c is the Controller being observed.
+	c *Controller
+	// observe is the function that sees each broadcast.
+	observe func(Response)
+	// rx carries broadcasts to the observer's goroutine; the Controller closes it when it stops.
+	rx chan Response
+	// stop is closed when the observer is unregistered.
+	stop chan struct{}
+	// stopOnce makes sure stop is closed only once.
+	stopOnce sync.Once
+	// done is closed once the observer's goroutine has returned.
+	done chan struct{}
+	// missed counts the broadcasts the observer missed because its buffer was full.
+	missed atomic.Uint64
+}
+
+// observers is the set of observers registered on a Controller.
+type observers struct {
+	// mu guards everything below, as observers come and go on goroutines other than the Controller's.
+	mu sync.Mutex
+	// set holds every registered observer.
+	set map[*Observer]struct{}
+	// stopped is set once the Controller has stopped, after which observers see nothing more.
+	stopped bool
+}
+
+// RegisterObserver makes c call observe, on a goroutine of its own, with each broadcast c sends from now on, in order,
+// until the returned Observer is unregistered or c stops.
+// It may be called at any time, from any goroutine.
+func (c *Controller) RegisterObserver(observe func(Response)) *Observer {
+	o := &Observer{
+		c:       c,
+		observe: observe,
+		rx:      make(chan Response, ObserverBuffer),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	c.observers.mu.Lock()
+	if c.observers.stopped {
+		close(o.rx)
+	} else {
+		c.observers.set[o] = struct{}{}
+	}
+	c.observers.mu.Unlock()
+
+	go o.run()
+	return o
+}
+
+// Unregister stops o seeing broadcasts, discarding any it hasn't yet seen.
+// It doesn't wait for a call to o's function already underway, so that the function itself may unregister o; wait on
+// Done for that.
+// Unregistering an Observer more than once does nothing.
+func (o *Observer) Unregister() {
+	o.c.observers.mu.Lock()
+	delete(o.c.observers.set, o)
+	o.c.observers.mu.Unlock()
+
+	o.stopOnce.Do(func() { close(o.stop) })
+}
+
+// Done gets a channel closed once o's function has seen its last broadcast, because o was unregistered or because its
+// Controller stopped.
+// When its Controller stops, o first sees every broadcast it had yet to see.
+func (o *Observer) Done() <-chan struct{} {
+	return o.done
+}
+
+// Missed gets the number of broadcasts o has missed because it fell too far behind.
+func (o *Observer) Missed() uint64 {
+	return o.missed.Load()
+}
+
+// run calls o's function with each broadcast it receives, until o is unregistered or its Controller stops.
+func (o *Observer) run() {
+	defer close(o.done)
+	for {
+		select {
+		case <-o.stop:
+			return
+		case r, ok := <-o.rx:
+			if !ok {
+				return
+			}
+			// Both cases may have been ready, and a broadcast mustn't get through after unregistering.
+			select {
+			case <-o.stop:
+				return
+			default:
+			}
+			o.observe(r)
+		}
+	}
+}
+
+// notifyObservers passes broadcast r to each of c's observers that has room for it.
+func (c *Controller) notifyObservers(r Response) {
+	c.observers.mu.Lock()
+	defer c.observers.mu.Unlock()
+	for o := range c.observers.set {
+		select {
+		case o.rx <- r:
+		default:
+			o.missed.Add(1)
+		}
+	}
+}
+
+// stopObservers lets each of c's observers see what broadcasts it has left, then stops it.
+func (c *Controller) stopObservers() {
+	c.observers.mu.Lock()
+	defer c.observers.mu.Unlock()
+	c.observers.stopped = true
+	for o := range c.observers.set {
+		close(o.rx)
+		delete(c.observers.set, o)
+	}
+}
@@ -0,0 +1,101 @@
+package controller
+
+// File panic.go contains the Controller's isolation of panics in its Controllable, so that one bad request doesn't take
+// every client down with it.
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+const (
+	// CodePanic is the error code of PanicErrors.
+	CodePanic = "panic"
+	// CodeQuarantined is the error code of ErrQuarantined.
+	CodeQuarantined = "quarantined"
+)
+
+// ErrQuarantined is the error returned for requests to a Controller whose state has panicked too often.
+var ErrQuarantined = bifrost.WithCode(CodeQuarantined, quarantinedError{})
+
+// quarantinedError is the error behind ErrQuarantined; it is a type only so that it can carry blame.
+type quarantinedError struct{}
+
+// Error gets the error message of a quarantinedError.
+func (quarantinedError) Error() string {
+	return "this controller's state has panicked too often, and is quarantined"
+}
+
+// Blame blames the server for a quarantinedError.
+func (quarantinedError) Blame() core.Blame {
+	return core.BlameServer
+}
+
+// PanicError is the error returned when a Controllable panics while handling a request.
+type PanicError struct {
+	// Value is the value the Controllable panicked with.
+	Value interface{}
+	// Stack is the stack trace of the panicking goroutine.
+	Stack []byte
+}
+
+// Error gets the error message of a PanicError.
+// It doesn't contain the stack trace, which is for the server log rather than clients.
+func (e PanicError) Error() string {
+	return fmt.Sprintf("internal error: %v", e.Value)
+}
+
+// Code gets the error code of a PanicError.
+func (PanicError) Code() string {
+	return CodePanic
+}
+
+// Blame blames the server for a PanicError.
+func (PanicError) Blame() core.Blame {
+	return core.BlameServer
+}
+
+// SetPanicLimit sets how many times c's state may panic before c quarantines it, failing all requests to it.
+// A limit of 0, the default, means c never quarantines its state.
+// It must be called before Run.
+func (c *Controller) SetPanicLimit(limit int) {
+	c.panicLimit = limit
+}
+
+// isolate runs f, converting any panic inside it into a PanicError that is logged and counted towards quarantine.
+// If c's state is already quarantined, it returns ErrQuarantined without running f.
+func (c *Controller) isolate(what string, f func() error) (err error) {
+	if c.quarantined() {
+		return ErrQuarantined
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			perr := PanicError{Value: v, Stack: debug.Stack()}
+			c.log.Printf("state panicked during %s: %v\n%s", what, v, perr.Stack)
+
+			c.panics++
+			if c.quarantined() {
+				c.log.Printf("state has panicked %d times; quarantining it\n", c.panics)
+			}
+			err = perr
+		}
+	}()
+	return f()
+}
+
+// quarantined gets whether c's state has panicked too often to be trusted with requests.
+func (c *Controller) quarantined() bool {
+	return 0 < c.panicLimit && c.panicLimit <= c.panics
+}
+
+// isFailure gets whether the error e is the server's fault, rather than the client's.
+func isFailure(e error) bool {
+	var b core.Blameable
+	return errors.As(e, &b) && b.Blame() == core.BlameServer
+}
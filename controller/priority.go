@@ -0,0 +1,131 @@
+package controller
+
+// File priority.go contains the Controller's request priorities and the queue that schedules requests by them.
+//
+// The Controller gathers every request that is ready, then handles the most urgent first.
+// Requests from the same client are always handled in the order the client sent them,
+// so that, for example, a selection of an item never overtakes the request adding it.
+
+// Priority is the type of request priorities.
+type Priority int
+
+const (
+	// PriorityBulk is the priority of requests that may take a while, or come in large numbers, such as item loads.
+	PriorityBulk Priority = -1
+	// PriorityNormal is the priority of most requests.
+	PriorityNormal Priority = 0
+	// PriorityOperator is the priority of requests a presenter is waiting on, such as changing the selection.
+	PriorityOperator Priority = 1
+	// PriorityEmergency is the priority of requests that can't wait at all, such as a panic button.
+	// They overtake every other request, however many have overtaken the oldest already.
+	PriorityEmergency Priority = 2
+)
+
+// maxOvertakes is how many requests in a row may overtake an older one before the older one is handled anyway.
+// This stops a stream of urgent requests from starving everything else.
+const maxOvertakes = 8
+
+// Prioritiser is the interface of Controllables that give their requests different priorities.
+// Controllables that aren't Prioritisers get PriorityNormal for every request.
+type Prioritiser interface {
+	// Priority gets the priority of a request with body rbody.
+	Priority(rbody interface{}) Priority
+}
+
+// queuedRequest is a request waiting in a requestQueue.
+type queuedRequest struct {
+	// from is the client that sent the request.
+	from coclient
+	// rq is the request itself.
+	rq Request
+	// priority is the priority of the request.
+	priority Priority
+}
+
+// requestQueue holds requests that have arrived but not been handled, in arrival order.
+type requestQueue struct {
+	// pending holds the waiting requests, oldest first.
+	pending []queuedRequest
+	// overtakes is how many requests in a row have overtaken the oldest waiting request.
+	overtakes int
+}
+
+// empty gets whether q has no waiting requests.
+func (q *requestQueue) empty() bool {
+	return len(q.pending) == 0
+}
+
+// push adds a request to the back of q.
+func (q *requestQueue) push(qr queuedRequest) {
+	q.pending = append(q.pending, qr)
+}
+
+// drop removes every request from the client from.
+func (q *requestQueue) drop(from coclient) {
+	kept := q.pending[:0]
+	for _, qr := range q.pending {
+		if qr.from != from {
+			kept = append(kept, qr)
+		}
+	}
+	q.pending = kept
+}
+
+// ready gets whether q has a request from a client that isn't busy.
+// Clients are busy if they are keys of busy.
+func (q *requestQueue) ready(busy map[coclient][]Response) bool {
+	for _, qr := range q.pending {
+		if _, ok := busy[qr.from]; !ok {
+			return true
+		}
+	}
+	return false
+}
+
+// pop removes and returns the next request to handle, if there is one:
+// of the oldest waiting requests from each client that isn't busy, the one with the highest priority, oldest first.
+// Clients are busy if they are keys of busy; their requests wait until they aren't.
+func (q *requestQueue) pop(busy map[coclient][]Response) (queuedRequest, bool) {
+	best, oldest := -1, -1
+	seen := make(map[coclient]struct{}, len(q.pending))
+	for i, qr := range q.pending {
+		if _, ok := seen[qr.from]; ok {
+			continue
+		}
+		seen[qr.from] = struct{}{}
+		if _, ok := busy[qr.from]; ok {
+			continue
+		}
+
+		if oldest == -1 {
+			oldest = i
+		}
+		if best == -1 || q.pending[best].priority < qr.priority {
+			best = i
+		}
+	}
+	if best == -1 {
+		return queuedRequest{}, false
+	}
+
+	if maxOvertakes <= q.overtakes && q.pending[best].priority < PriorityEmergency {
+		best = oldest
+	}
+	if best == oldest {
+		q.overtakes = 0
+	} else {
+		q.overtakes++
+	}
+
+	qr := q.pending[best]
+	q.pending = append(q.pending[:best], q.pending[best+1:]...)
+	return qr, true
+}
+
+// priorityOf gets the priority of the request body rbody.
+func (c *Controller) priorityOf(rbody interface{}) Priority {
+	if p, ok := stateAs[Prioritiser](c.state); ok {
+		return p.Priority(rbody)
+	}
+	return PriorityNormal
+}
@@ -0,0 +1,85 @@
+package controller
+
+// File progress.go contains progress reports: replies that long requests send ahead of their acknowledgement, so
+// that clients can show how far along they are.
+//
+// Over Bifrost, a report is 'PROGRESS <percent> <note>', with the request's tag.
+// Controllables report through a Progress, which only speaks up for requests long enough to need it, and then only
+// when the percentage moves on by a step.
+
+import (
+	"strconv"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// RsProgress is the word of messages reporting the progress of a request.
+const RsProgress = "PROGRESS"
+
+const (
+	// progressStep is the smallest change in percentage that a Progress reports.
+	progressStep = 10
+	// progressMin is the fewest steps a request must take for a Progress to report on it at all:
+	// shorter requests are over too soon for reports to be any use.
+	progressMin = 100
+)
+
+// ProgressResponse reports how far a request has got.
+type ProgressResponse struct {
+	// Percent is how much of the request is done, from 0 to 100.
+	Percent int
+	// Note says what the request is doing.
+	Note string
+}
+
+// Message converts a ProgressResponse into a Bifrost message with tag tag.
+func (p ProgressResponse) Message(tag string) *message.Message {
+	return message.New(tag, RsProgress).AddArgs(strconv.Itoa(p.Percent), p.Note)
+}
+
+// ParseProgressResponse tries to parse m as a 'PROGRESS' message.
+func ParseProgressResponse(m *message.Message) (ProgressResponse, error) {
+	var p ProgressResponse
+	if err := core.CheckWord(RsProgress, m); err != nil {
+		return p, err
+	}
+	err := bifrost.Args(m.Args()).Int(0, &p.Percent).String(1, &p.Note).Err()
+	return p, err
+}
+
+// Progress reports the progress of a request, as ProgressResponses, through the request's reply callback.
+type Progress struct {
+	// replyCb is the request's reply callback.
+	replyCb ResponseCb
+	// note says what the request is doing.
+	note string
+	// total is the number of steps the request takes.
+	total int
+	// next is the percentage at which to send the next report.
+	next int
+}
+
+// NewProgress makes a Progress for a request, replying through replyCb, that takes total steps and does what note
+// says.
+// If total is big enough to be worth reporting on, it reports that the request is starting.
+func NewProgress(replyCb ResponseCb, note string, total int) *Progress {
+	p := &Progress{replyCb: replyCb, note: note, total: total}
+	p.Step(0)
+	return p
+}
+
+// Step records that done of the request's steps are complete, reporting if the percentage has moved on by a step.
+func (p *Progress) Step(done int) {
+	if p.total < progressMin {
+		return
+	}
+	pc := done * 100 / p.total
+	if pc < p.next {
+		return
+	}
+	p.replyCb(ProgressResponse{Percent: pc, Note: p.note})
+	p.next = (pc/progressStep + 1) * progressStep
+}
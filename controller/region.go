@@ -0,0 +1,75 @@
+package controller
+
+// File region.go contains the Bifrost adapter's folding of many item broadcasts into one region broadcast, for clients
+// rendering large states, such as long lists, that would rather fetch a range again than follow every change.
+//
+// Regions build on coalescing (see coalesce.go): when the adapter flushes its waiting broadcasts, and more of them than
+// the region threshold each change one item's state, it sends a single broadcast naming the range of items they touched
+// in their place.
+// Fewer item broadcasts than that go out as they are, so small changes stay exact.
+// Broadcasts that change the state's shape are never held, so the indices in a region are always current.
+
+import "sort"
+
+// BroadcastRegioner is the interface of BifrostParsers whose states have indexed items that broadcasts can describe.
+type BroadcastRegioner interface {
+	// BroadcastIndex gets the index of the item broadcast body rbody changes, and true, if rbody changes only that
+	// item's state and not the state's shape; otherwise, it returns false.
+	BroadcastIndex(rbody interface{}) (int, bool)
+
+	// RegionBroadcast gets the body of a broadcast announcing that count items, from index start, have changed.
+	RegionBroadcast(start, count int) interface{}
+}
+
+// SetRegionThreshold sets how many item broadcasts the adapter sends as they are in one flush of coalesced broadcasts;
+// more than that, and it sends one region broadcast instead.
+// A threshold of 0, the default, never sends region broadcasts.
+// Regions only form while coalescing is on (see SetCoalesce).
+// It must be called before Run.
+func (b *Bifrost) SetRegionThreshold(threshold int) {
+	b.regionThreshold = threshold
+}
+
+// foldRegion gets the broadcasts in rss to send, replacing the item broadcasts among them with a region broadcast if
+// there are more than the region threshold.
+// The region broadcast takes the place of the first item broadcast.
+func (b *Bifrost) foldRegion(rss []Response) []Response {
+	if b.regionThreshold <= 0 || len(rss) <= b.regionThreshold {
+		return rss
+	}
+	br, ok := b.parser.(BroadcastRegioner)
+	if !ok {
+		return rss
+	}
+
+	var (
+		indices []int
+		first   = -1
+	)
+	for i, rs := range rss {
+		if idx, ok := br.BroadcastIndex(rs.Body); ok {
+			if first == -1 {
+				first = i
+			}
+			indices = append(indices, idx)
+		}
+	}
+	if len(indices) <= b.regionThreshold {
+		return rss
+	}
+
+	sort.Ints(indices)
+	start := indices[0]
+	region := Response{Broadcast: true, Body: br.RegionBroadcast(start, indices[len(indices)-1]-start+1), Seq: rss[first].Seq}
+
+	folded := make([]Response, 0, len(rss)-len(indices)+1)
+	for i, rs := range rss {
+		if i == first {
+			folded = append(folded, region)
+		}
+		if _, ok := br.BroadcastIndex(rs.Body); !ok {
+			folded = append(folded, rs)
+		}
+	}
+	return folded
+}
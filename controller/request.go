@@ -2,6 +2,8 @@ package controller
 
 // File request.go contains the high-level Request type, and request bodies common to all Controllers.
 
+import "context"
+
 // RequestOrigin is the structure identifying where a request originated.
 type RequestOrigin struct {
 	// Tag is a string used to identify this request, if any.
@@ -9,6 +11,17 @@ type RequestOrigin struct {
 
 	// ReplyTx is the channel any unicast responses will be sent down.
 	ReplyTx chan<- Response
+
+	// Ctx, if not nil, carries the request's deadline and per-request values (see 'context.go').
+	Ctx context.Context
+}
+
+// Context gets the context of requests from o, which is context.Background() if o has none.
+func (o RequestOrigin) Context() context.Context {
+	if o.Ctx == nil {
+		return context.Background()
+	}
+	return o.Ctx
 }
 
 // Request is the base structure for requests to a Controller.
@@ -25,6 +38,9 @@ type Request struct {
 // Standard request bodies
 //
 
+// RqDump is the word of requests for an information dump.
+const RqDump = "dump"
+
 // DumpRequest requests an information dump.
 type DumpRequest struct{}
 
@@ -47,8 +63,22 @@ type RoleRequest struct{}
 // newClientRequest requests that the Controller add a new client.
 // It will result in a newClientResponse reply with the client connector.
 //
-// This is kept private because clients should instead call Client.Copy.
-type newClientRequest struct{}
+// This is kept private because clients should instead call Client.Copy or Client.CopyWithDump.
+type newClientRequest struct {
+	// Dump, if true, asks for the state's dump to come before the newClientResponse, with no broadcasts in between.
+	Dump bool
+}
+
+// bifrostParserRequest requests the Controller's state as a BifrostParser.
+// It will result in a bifrostParserResponse reply, or ErrControllerCannotSpeakBifrost.
+//
+// This is kept private because it is only needed by the Bifrost adapter.
+type bifrostParserRequest struct{}
+
+// pingRequest does nothing, other than have the Controller reply with a DoneResponse.
+//
+// This is kept private because it is only needed by Watchdog, to check the Controller is still handling requests.
+type pingRequest struct{}
 
 // shutdownRequest requests a shutdown.
 // The Controller will not reply, other than immediately sending an DoneResponse.
@@ -13,6 +13,11 @@ type Response struct {
 
 	// Body gives the body of the response.
 	Body interface{}
+
+	// Seq, if 'Broadcast' is true, gives the broadcast's sequence number, counting up from 1 for each broadcast its
+	// Controller sends (see seq.go).
+	// Else, it is 0.
+	Seq uint64
 }
 
 //
@@ -42,3 +47,9 @@ type newClientResponse struct {
 	// Client is the new client connector.
 	Client *Client
 }
+
+// bifrostParserResponse responds to a request for the Controller state's BifrostParser.
+type bifrostParserResponse struct {
+	// Parser is the state, viewed as a BifrostParser.
+	Parser BifrostParser
+}
@@ -0,0 +1,98 @@
+package controller
+
+// File segment.go contains the Bifrost adapter's handling of message segmentation.
+// - See `bifrost/segment.go` for the segment format.
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// forward sends each outgoing message on b.tx, and each notice, to the client.
+// It closes the client's channel once b.tx closes.
+func (b *Bifrost) forward() {
+	defer close(b.bifrost.Tx)
+
+	for {
+		// Announcements can't wait, so go ahead of anything already waiting in tx.
+		select {
+		case m := <-b.notices:
+			b.send(m)
+			continue
+		default:
+		}
+
+		select {
+		case m, ok := <-b.tx:
+			if !ok {
+				return
+			}
+			b.send(m)
+			b.checkCaughtUp()
+		case m := <-b.notices:
+			b.send(m)
+		}
+	}
+}
+
+// send sends m to the client, segmenting it if the client asked.
+func (b *Bifrost) send(m message.Message) {
+	// Requests are checked on the way in, but the Controller may still echo back bad bytes from elsewhere.
+	m = bifrost.Sanitise(m)
+	m = b.dialect.response(m)
+
+	size := int(b.segSize.Load())
+	if size == 0 {
+		b.bifrost.Tx <- m
+		return
+	}
+
+	segs, err := bifrost.Segment(m, size)
+	if err != nil {
+		// Sending the message whole is better than not sending it.
+		segs = []message.Message{m}
+	}
+	for _, s := range segs {
+		b.bifrost.Tx <- s
+	}
+}
+
+// handleSegment handles a segment request rq.
+// Once it has the whole request, it handles that in turn; it returns whether the client can still handle requests.
+func (b *Bifrost) handleSegment(ctx context.Context, rq message.Message) bool {
+	m, err := b.reassembler.Add(rq)
+	if err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return true
+	}
+	if m == nil {
+		return true
+	}
+	if m.Word() == bifrost.RqSeg {
+		b.respond(*b.errorToMessage(m.Tag(), bifrost.WithCode(bifrost.CodeSegment, fmt.Errorf("segments can't be nested"))))
+		return true
+	}
+	return b.handleRequest(ctx, *m)
+}
+
+// handleSegSize handles a request rq setting the longest line the client wants to receive.
+// A size of 0 turns segmentation off.
+func (b *Bifrost) handleSegSize(rq message.Message) {
+	var size int
+	err := bifrost.Args(rq.Args()).Int(0, &size).Err()
+	if err == nil && size != 0 && size < bifrost.MinSegmentSize {
+		err = bifrost.ErrSegmentSizeTooSmall
+	}
+	if err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return
+	}
+
+	b.segSize.Store(int64(size))
+	b.respond(*message.New(rq.Tag(), core.RsAck).AddArgs("OK", "success"))
+}
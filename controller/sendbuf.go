@@ -0,0 +1,91 @@
+package controller
+
+// File sendbuf.go contains the adapter's send buffer, which stops a client that reads slowly holding up the Controller,
+// and every other client with it.
+//
+// With a buffer (see SetSendBuffer), messages to the client queue up to the buffer's size while the connection catches
+// up.
+// Once the buffer is full, the adapter drops whole broadcasts rather than wait, counting each; replies to the client's
+// own requests are never dropped.
+// A dropped broadcast leaves the client's view of the state out of date, so clients that may lag should stamp
+// broadcasts with sequence numbers (see seq.go) and dump again when one goes missing.
+//
+// When a broadcast finds the buffer half full, the adapter warns the client, ahead of everything queued, with
+//
+//	! LAG <queued> <dropped>
+//
+// where queued is the number of messages waiting, and dropped the number of broadcasts dropped since the client
+// connected; once the client has caught up, it sends the same message with queued 0.
+// Replies alone, such as a big dump, don't count as lagging, however much they fill the buffer.
+
+import (
+	"strconv"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+)
+
+// RsLag is the word of messages warning clients that they are reading too slowly.
+const RsLag = "LAG"
+
+// SetSendBuffer sets how many messages may wait to be sent to the client before the adapter drops broadcasts to it;
+// 0, the default, means there is no buffer, and the adapter waits for the client however long it takes.
+// It must be called before Run.
+func (b *Bifrost) SetSendBuffer(size int) {
+	b.tx = make(chan message.Message, size)
+}
+
+// SetDroppedBroadcastHook sets a function the adapter calls, on its own goroutine, for each broadcast it drops
+// because the send buffer was full.
+// The hook mustn't block for long, as the adapter waits for it.
+// It must be called before Run.
+func (b *Bifrost) SetDroppedBroadcastHook(hook func()) {
+	b.droppedHook = hook
+}
+
+// Queued gets the number of messages waiting in the adapter's send buffer.
+// It is safe to call from any goroutine.
+func (b *Bifrost) Queued() int {
+	return len(b.tx)
+}
+
+// Dropped gets the number of broadcasts the adapter has dropped because its send buffer was full.
+// It is safe to call from any goroutine.
+func (b *Bifrost) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+// shed drops the response rs, returning true, if it is a broadcast and the send buffer is full.
+// It warns the client if rs is a broadcast that finds the buffer half full.
+func (b *Bifrost) shed(rs Response) bool {
+	size := cap(b.tx)
+	if !rs.Broadcast || size == 0 {
+		return false
+	}
+
+	queued := len(b.tx)
+	full := size <= queued
+	if full {
+		b.dropped.Add(1)
+		if b.droppedHook != nil {
+			b.droppedHook()
+		}
+	}
+	if (size+1)/2 <= queued && b.lagging.CompareAndSwap(false, true) {
+		b.Announce(*LagMessage(message.TagBcast, queued, b.Dropped()))
+	}
+	return full
+}
+
+// checkCaughtUp tells the client if it was lagging, and has now caught up.
+// Only the forwarding goroutine may call it.
+func (b *Bifrost) checkCaughtUp() {
+	if len(b.tx) == 0 && b.lagging.CompareAndSwap(true, false) {
+		b.send(*LagMessage(message.TagBcast, 0, b.Dropped()))
+	}
+}
+
+// LagMessage creates a LAG message with tag tag, saying that queued messages are waiting, and dropped broadcasts have
+// been dropped.
+func LagMessage(tag string, queued int, dropped int64) *message.Message {
+	return message.New(tag, RsLag).AddArgs(strconv.Itoa(queued), strconv.FormatInt(dropped, 10))
+}
@@ -0,0 +1,40 @@
+package controller
+
+// File seq.go contains sequence stamps, which let clients caching a state notice when they have missed broadcasts
+// about it, and dump it again.
+//
+// Each Controller numbers its broadcasts, counting up from 1; see Response.Seq.
+// Clients that declare the 'seq' capability (see caps.go) get each broadcast preceded by
+//
+//	! SEQ <seq> <prev>
+//
+// where seq is the broadcast's number, and prev is the number of the broadcast the adapter last sent the client, or 0
+// if it hasn't sent one.
+// The adapter leaves some broadcasts out on purpose, when coalescing, folding regions, or tailoring them to the client's
+// capabilities, so the numbers themselves may skip; prev is what says whether they skipped on purpose.
+// A client that sees a prev other than the last seq it saw has missed broadcasts, and should dump the state again,
+// taking the next SEQ after the dump as its new starting point.
+// Sequence numbers always increase for as long as the client stays connected.
+
+import (
+	"strconv"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+)
+
+const (
+	// RsSeq is the word of messages stamping the broadcast that follows with its sequence number.
+	RsSeq = "SEQ"
+
+	// CapSeq is the capability of clients that want their broadcasts stamped with sequence numbers.
+	CapSeq = "seq"
+)
+
+// stampSeq sends the client the sequence stamp of broadcast rs, if it wants one.
+func (b *Bifrost) stampSeq(rs Response) {
+	if b.caps == nil || !b.caps.seq || !rs.Broadcast || rs.Seq == 0 {
+		return
+	}
+	b.respond(*message.New(message.TagBcast, RsSeq).AddArgs(strconv.FormatUint(rs.Seq, 10), strconv.FormatUint(b.lastSeq, 10)))
+	b.lastSeq = rs.Seq
+}
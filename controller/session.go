@@ -0,0 +1,37 @@
+package controller
+
+// File session.go contains sessions: each Client's connection to its Controller, for states that keep private
+// per-client state.
+//
+// Every Client, including each copy, is its own session, which ends when the Client hangs up.
+// If the state is SessionAware, the Controller tells it which session sent each request, and when sessions end, so
+// that it can throw away what they left behind.
+
+import "context"
+
+// Session identifies one Client's connection to a Controller.
+// Sessions are never reused within the life of a Controller.
+type Session uint64
+
+// SessionAware is the interface of Controllables that keep state private to each session.
+type SessionAware interface {
+	// HandleSessionRequest is HandleRequest, for the session sid.
+	// The Controller calls it instead of HandleRequest.
+	HandleSessionRequest(ctx context.Context, sid Session, replyCb ResponseCb, bcastCb ResponseCb, rbody interface{}) error
+
+	// EndSession throws away any state private to the session sid, which has hung up.
+	EndSession(sid Session)
+}
+
+// endSession tells the state, if it is SessionAware, that the session of the client cl has ended.
+func (c *Controller) endSession(cl coclient) {
+	s, ok := stateAs[SessionAware](c.state)
+	if !ok {
+		return
+	}
+	// There is nobody left to tell if this fails, but isolate logs it.
+	_ = c.isolate("session end", func() error {
+		s.EndSession(cl.session)
+		return nil
+	})
+}
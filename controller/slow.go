@@ -0,0 +1,41 @@
+package controller
+
+// File slow.go contains the Bifrost adapter's reporting of slow requests, so that operators can spot pathological
+// requests without tracing everything.
+//
+// A request is slow if it takes longer than the adapter's threshold from the adapter reading it to the Controller
+// acknowledging it, which takes in both queueing for the Controller and handling.
+// Requests the adapter answers itself, such as 'time', are never slow.
+
+import "time"
+
+// SlowRequest describes a request that took longer than the adapter's slow-request threshold.
+type SlowRequest struct {
+	// Word is the request's word.
+	Word string
+	// Tag is the request's tag.
+	Tag string
+	// Elapsed is how long the request took to be acknowledged.
+	Elapsed time.Duration
+	// Err is the error the request failed with, if it did.
+	Err error
+}
+
+// SetSlowRequestHook sets a function the adapter calls, on its own goroutine, for each request that takes longer than
+// threshold to be acknowledged; a threshold of 0, the default, means it calls nothing.
+// The hook mustn't block for long, as the adapter waits for it.
+// It must be called before Run.
+func (b *Bifrost) SetSlowRequestHook(threshold time.Duration, hook func(SlowRequest)) {
+	b.slowThreshold = threshold
+	b.slowHook = hook
+}
+
+// checkSlow calls the slow-request hook if rq, acknowledged with err, was slow.
+func (b *Bifrost) checkSlow(tag string, rq inflightRequest, err error) {
+	if b.slowHook == nil || b.slowThreshold <= 0 {
+		return
+	}
+	if elapsed := time.Since(rq.start); b.slowThreshold < elapsed {
+		b.slowHook(SlowRequest{Word: rq.word, Tag: tag, Elapsed: elapsed, Err: err})
+	}
+}
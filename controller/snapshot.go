@@ -0,0 +1,59 @@
+package controller
+
+// File snapshot.go contains the Controller's read path for dumps of Snapshotters.
+//
+// Sending a large dump to a slow client can take a while, and the Controller can't handle other requests while it
+// waits.
+// If the state is a Snapshotter, the Controller instead takes a snapshot of the dump, which is quick, and sends it on
+// another goroutine.
+// Until the dump is sent, the Controller holds back that client's broadcasts and further requests,
+// so the client sees everything in the same order as it would have otherwise.
+
+// Snapshotter is the interface of Controllables that can take snapshots of their dumps.
+type Snapshotter interface {
+	// Snapshot gets the response bodies that Dump would send, in order.
+	// The bodies must not share any mutable memory with the Controllable,
+	// as they are sent while the Controllable goes on handling requests.
+	Snapshot() []interface{}
+}
+
+// startSnapshotDump takes a snapshot of s's dump, and starts sending it to the client from, with request origin o.
+// If taking the snapshot fails, it returns the error, which the caller must acknowledge.
+func (c *Controller) startSnapshotDump(from coclient, o RequestOrigin, s Snapshotter) error {
+	var snap []interface{}
+	err := c.isolate("dump", func() error {
+		snap = s.Snapshot()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	c.dumping[from] = nil
+	go func() {
+		for _, rbody := range snap {
+			c.reply(o, rbody)
+		}
+		c.reply(o, DoneResponse{})
+
+		select {
+		case c.dumpDone <- from:
+		case <-c.done:
+		}
+	}()
+	return nil
+}
+
+// finishSnapshotDump sends the client from the broadcasts it missed during its snapshot dump.
+func (c *Controller) finishSnapshotDump(from coclient) {
+	backlog, ok := c.dumping[from]
+	if !ok {
+		// The client hung up mid-dump.
+		return
+	}
+	delete(c.dumping, from)
+
+	for _, rs := range backlog {
+		from.tx <- rs
+	}
+}
@@ -0,0 +1,59 @@
+package controller
+
+// File trace.go contains tracing, which follows each request from the Bifrost adapter, through the Controller, into
+// the Controllable or a mount, as OpenTelemetry spans.
+//
+// Each layer starts its span from the request's context, and passes the span's context on:
+//
+//	bifrost <word>      from the adapter parsing the request to the ACK going back to the client;
+//	controller <body>   while the Controller itself handles the request;
+//	state <body>        while the Controllable handles it;
+//	mount <name>        from forwarding an 'on' request to the mount acknowledging it.
+//
+// The gap between the adapter's span starting and the Controller's is the time spent queueing for the Controller.
+// A mounted Controller's spans are children of the 'mount' span, as the mount gets its context.
+// Spans go to whichever tracer provider is registered with otel.SetTracerProvider; until one is, tracing costs next to
+// nothing.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// errUnacknowledged is the error with which the adapter ends the spans of requests still in flight when it stops.
+var errUnacknowledged = errors.New("connection closed before the request was acknowledged")
+
+// tracerName is the name of the tracer the Controller and its adapters use.
+const tracerName = "github.com/MattWindsor91/yaps/controller"
+
+// startSpan starts a span called name, as a child of whatever span is in ctx.
+// It uses the tracer provider registered when the span starts, so that a provider registered after the Controller is
+// made still gets its spans.
+func startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// endSpan ends span, marking it as failed with err if err is not nil.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// bodyName gets the name a request body has in span names, which is its Go type.
+func bodyName(body interface{}) string {
+	return fmt.Sprintf("%T", body)
+}
+
+// tagAttr gets the span attribute for the Bifrost tag tag.
+func tagAttr(tag string) attribute.KeyValue {
+	return attribute.String("bifrost.tag", tag)
+}
@@ -0,0 +1,211 @@
+package controller
+
+// File tune.go contains tunables: runtime settings, such as the net server's coalescing window or a subsystem's
+// logging, that admins can change without restarting yaps or reloading its config.
+//
+// Over Bifrost, 'tune' lists every tunable, as one 'TUNE <name> <value> <doc>' per tunable in name order; 'tune <name>'
+// gets just that one; and 'tune <name> <value>' changes it, replying with the new value once the tunable has checked
+// and applied it.
+// Each change goes to the Tunables' audit hook, saying who made it and what the value was before, and is announced to
+// admin clients as '! TUNE <name> <value> <doc>'.
+// Only admins may make 'tune' requests at all, as the values say much about how the server is set up.
+// Changes last until yaps restarts; to keep one, change the config too.
+
+import (
+	"errors"
+	"sort"
+	"sync"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+const (
+	// RqTune is the word of requests to get or change tunables.
+	RqTune = "tune"
+	// RsTune is the word of messages carrying the value of a tunable.
+	RsTune = "TUNE"
+)
+
+// ErrNoTunable is the reason given for names in 'tune' requests that don't name tunables.
+var ErrNoTunable = errors.New("no such tunable")
+
+// Tunable is a setting that admins may change at runtime.
+type Tunable struct {
+	// Name names the tunable, such as 'coalesce'.
+	Name string
+	// Doc describes the tunable and the values it takes.
+	Doc string
+	// Get gets the tunable's value, as a Bifrost argument.
+	Get func() string
+	// Set checks the value v, and applies it if it is well-formed and in range.
+	Set func(v string) error
+}
+
+// TuneChange describes a change to a tunable, for auditing.
+type TuneChange struct {
+	// Name is the tunable's name.
+	Name string
+	// Old and New are the tunable's value before and after the change.
+	Old, New string
+	// Identity is who the client that made the change logged in as, or nil if it didn't.
+	Identity *auth.Identity
+}
+
+// Tunables is a set of tunables, shared between the Bifrost adapters of a server.
+// It is safe to use from many goroutines once shared.
+type Tunables struct {
+	// mu serialises changes, so that audit entries see each value change from the one before.
+	mu sync.Mutex
+	// tunables maps the name of each tunable to it.
+	tunables map[string]Tunable
+	// admins is the group whose members may make 'tune' requests, or empty if anyone may.
+	admins string
+	// announce, if not nil, sends messages to every admin client of the server.
+	announce func(message.Message)
+	// audit, if not nil, is called with each change.
+	audit func(TuneChange)
+}
+
+// NewTunables makes an empty set of tunables.
+func NewTunables() *Tunables {
+	return &Tunables{tunables: make(map[string]Tunable)}
+}
+
+// Add adds tunable to ts.
+// It panics if ts already has a tunable with the same name, as that is a programming error.
+// It must be called before ts is shared.
+func (ts *Tunables) Add(tunable Tunable) {
+	if _, ok := ts.tunables[tunable.Name]; ok {
+		panic("controller: tunable added twice: " + tunable.Name)
+	}
+	ts.tunables[tunable.Name] = tunable
+}
+
+// SetAdmins sets the group whose members may make 'tune' requests; empty, the default, means that anyone may.
+// It must be called before ts is shared.
+func (ts *Tunables) SetAdmins(group string) {
+	ts.admins = group
+}
+
+// SetAnnouncer sets the function ts uses to tell admin clients of the server about changes.
+// It must be called before ts is shared.
+func (ts *Tunables) SetAnnouncer(announce func(message.Message)) {
+	ts.announce = announce
+}
+
+// SetAuditHook sets a function ts calls with each change; nil, the default, means it calls nothing.
+// It must be called before ts is shared.
+func (ts *Tunables) SetAuditHook(hook func(TuneChange)) {
+	ts.audit = hook
+}
+
+// Names gets the names of ts's tunables, in order.
+func (ts *Tunables) Names() []string {
+	names := make([]string, 0, len(ts.tunables))
+	for n := range ts.tunables {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// get gets the tunable called name, failing if ts has no such tunable.
+func (ts *Tunables) get(name string) (Tunable, error) {
+	t, ok := ts.tunables[name]
+	if !ok {
+		return t, bifrost.ArgError{Pos: 0, Arg: name, Err: ErrNoTunable}
+	}
+	return t, nil
+}
+
+// Get gets the value of the tunable called name.
+func (ts *Tunables) Get(name string) (string, error) {
+	t, err := ts.get(name)
+	if err != nil {
+		return "", err
+	}
+	return t.Get(), nil
+}
+
+// Set changes the tunable called name to value on behalf of a client that logged in as id, or not at all if id is
+// nil, then audits and announces the change.
+// It returns the new value.
+func (ts *Tunables) Set(id *auth.Identity, name, value string) (string, error) {
+	t, err := ts.get(name)
+	if err != nil {
+		return "", err
+	}
+
+	ts.mu.Lock()
+	old := t.Get()
+	if err := t.Set(value); err != nil {
+		ts.mu.Unlock()
+		return "", bifrost.ArgError{Pos: 1, Arg: value, Err: err}
+	}
+	c := TuneChange{Name: name, Old: old, New: t.Get(), Identity: id}
+	ts.mu.Unlock()
+
+	if ts.audit != nil {
+		ts.audit(c)
+	}
+	if ts.announce != nil {
+		ts.announce(*TuneMessage(message.TagBcast, t, c.New))
+	}
+	return c.New, nil
+}
+
+// TuneMessage creates a TUNE message with tag tag, carrying the value value of t.
+func TuneMessage(tag string, t Tunable, value string) *message.Message {
+	return message.New(tag, RsTune).AddArgs(t.Name, value, t.Doc)
+}
+
+// SetTunables sets the tunables the adapter lets admins get and change; nil, the default, means there are none.
+// It must be called before Run.
+func (b *Bifrost) SetTunables(ts *Tunables) {
+	b.tunables = ts
+}
+
+// handleTune handles a request rq to get or change tunables.
+func (b *Bifrost) handleTune(rq message.Message) {
+	if b.tunables == nil {
+		b.respond(*b.errorToMessage(rq.Tag(), UnknownWord(rq.Word())))
+		return
+	}
+
+	var name, value string
+	args := rq.Args()
+	if err := bifrost.Args(args).Optional().String(0, &name).String(1, &value).Err(); err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return
+	}
+	id := b.identity.Load()
+	if err := CheckAdmin(id, b.tunables.admins); err != nil {
+		b.deny(rq, err)
+		return
+	}
+
+	names := b.tunables.Names()
+	if name != "" {
+		names = []string{name}
+	}
+	for _, n := range names {
+		t, err := b.tunables.get(n)
+		if err != nil {
+			b.respond(*b.errorToMessage(rq.Tag(), err))
+			return
+		}
+		v := t.Get()
+		if len(args) == 2 {
+			if v, err = b.tunables.Set(id, n, value); err != nil {
+				b.respond(*b.errorToMessage(rq.Tag(), err))
+				return
+			}
+		}
+		b.respond(*TuneMessage(rq.Tag(), t, v))
+	}
+	b.respond(*message.New(rq.Tag(), core.RsAck).AddArgs("OK", "success"))
+}
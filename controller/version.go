@@ -0,0 +1,38 @@
+package controller
+
+// File version.go contains the Bifrost adapter's handling of 'version' requests, which tell clients exactly which
+// build of the server they are talking to.
+//
+// The reply is 'VERSION <version> <commit> <date>', then an ACK, where the commit and date are 'unknown' if the build doesn't
+// know them (see the 'version' package).
+// Like OHAI, it is available before logging in.
+
+import (
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/version"
+)
+
+const (
+	// RqVersion is the word of requests for the server's build.
+	RqVersion = "version"
+	// RsVersion is the word of messages describing the server's build.
+	RsVersion = "VERSION"
+)
+
+// VersionMessage creates a VERSION message with tag tag, describing the build i.
+func VersionMessage(tag string, i version.Info) *message.Message {
+	return message.New(tag, RsVersion).AddArgs(i.Version, i.Commit, i.Date)
+}
+
+// handleVersion handles a request rq for the server's build.
+func (b *Bifrost) handleVersion(rq message.Message) {
+	if err := bifrost.Args(rq.Args()).Err(); err != nil {
+		b.respond(*b.errorToMessage(rq.Tag(), err))
+		return
+	}
+	b.respond(*VersionMessage(rq.Tag(), version.Get()))
+	b.respond(*message.New(rq.Tag(), core.RsAck).AddArgs("OK", "success"))
+}
@@ -0,0 +1,161 @@
+package controller
+
+// File watchdog.go contains Watchdog, which notices when a Controller stops handling requests.
+
+import (
+	"context"
+	"expvar"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+)
+
+const (
+	// RsWatchdog is the word of messages announcing WatchdogAlerts.
+	RsWatchdog = "WATCHDOG"
+	// WatchdogWedged is the first argument of WATCHDOG messages announcing a wedged Controller.
+	WatchdogWedged = "wedged"
+	// WatchdogRecovered is the first argument of WATCHDOG messages announcing a recovered Controller.
+	WatchdogRecovered = "recovered"
+)
+
+// watchdogMetrics holds counters for every Watchdog, keyed by '<name>.<counter>':
+// 'probes' counts probes sent, 'alerts' counts times the Controller was found wedged,
+// and 'recoveries' counts times it started replying again.
+var watchdogMetrics = expvar.NewMap("yaps_watchdog")
+
+// WatchdogAlert describes a change in the health of a watched Controller.
+type WatchdogAlert struct {
+	// Name is the name of the watched Controller.
+	Name string
+	// Wedged is true if the Controller has stopped replying, and false if it has started again.
+	Wedged bool
+	// Elapsed is how long the Controller had gone without replying to a probe.
+	Elapsed time.Duration
+}
+
+// Message converts a into a Bifrost message with tag tag: WATCHDOG, whether the Controller is wedged or recovered,
+// the Controller's name, and the elapsed time in milliseconds.
+func (a WatchdogAlert) Message(tag string) *message.Message {
+	state := WatchdogRecovered
+	if a.Wedged {
+		state = WatchdogWedged
+	}
+	return message.New(tag, RsWatchdog).AddArgs(state, a.Name, strconv.FormatInt(a.Elapsed.Milliseconds(), 10))
+}
+
+// Watchdog periodically sends no-op probe requests to a Controller, raising an alert if one goes unanswered for too
+// long.
+type Watchdog struct {
+	// log is the Watchdog's logger.
+	log *log.Logger
+
+	// name is the name of the watched Controller, used in logs, metrics, and alerts.
+	name string
+
+	// client is the Watchdog's client for the watched Controller.
+	client *Client
+
+	// interval is the time between the end of one probe and the start of the next.
+	interval time.Duration
+
+	// threshold is how long a probe may go unanswered before the Watchdog raises an alert.
+	threshold time.Duration
+
+	// onAlert, if non-nil, is called, on the Watchdog's goroutine, whenever the Watchdog raises an alert.
+	onAlert func(WatchdogAlert)
+}
+
+// NewWatchdog creates a Watchdog, with logger l, for the Controller named name that client talks to.
+// It probes every interval, raising an alert if a probe is unanswered after threshold.
+func NewWatchdog(l *log.Logger, name string, client *Client, interval, threshold time.Duration) *Watchdog {
+	return &Watchdog{
+		log:       l,
+		name:      name,
+		client:    client,
+		interval:  interval,
+		threshold: threshold,
+	}
+}
+
+// SetAlertHook sets a function to be called whenever w finds the Controller wedged, or finds it has recovered.
+// It must be called before Run.
+func (w *Watchdog) SetAlertHook(f func(WatchdogAlert)) {
+	w.onAlert = f
+}
+
+// Run runs the Watchdog until ctx is cancelled or the Controller shuts down.
+func (w *Watchdog) Run(ctx context.Context) error {
+	var (
+		// next fires when it's time to send the next probe; it is nil while a probe is outstanding.
+		next <-chan time.Time = time.After(w.interval)
+		// answered receives when the outstanding probe gets its reply.
+		answered chan struct{}
+		// deadline fires when the outstanding probe has gone unanswered for too long.
+		deadline <-chan time.Time
+		// sent is when the outstanding probe was sent.
+		sent time.Time
+		// wedged is true if the Watchdog has raised an alert that hasn't yet been cleared.
+		wedged bool
+	)
+
+	for {
+		select {
+		case <-next:
+			next = nil
+			sent = time.Now()
+			answered = w.probe(ctx)
+			deadline = time.After(w.threshold)
+		case <-answered:
+			answered, deadline = nil, nil
+			next = time.After(w.interval)
+			if wedged {
+				wedged = false
+				w.alert(false, time.Since(sent))
+			}
+		case <-deadline:
+			deadline = nil
+			wedged = true
+			w.alert(true, time.Since(sent))
+		case _, ok := <-w.client.Rx:
+			// The Watchdog doesn't care about broadcasts, but must drain them so as not to wedge the Controller itself.
+			if !ok {
+				return nil
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// probe sends a probe to the Controller, returning a channel that closes when the Controller answers.
+// If the Controller never answers, the probe's goroutine lasts until ctx is cancelled.
+func (w *Watchdog) probe(ctx context.Context) chan struct{} {
+	watchdogMetrics.Add(w.name+".probes", 1)
+
+	answered := make(chan struct{})
+	go func() {
+		alive, err := w.client.SendAndProcessReplies(ctx, "", pingRequest{}, func(Response) error { return nil })
+		if alive && err == nil {
+			close(answered)
+		}
+	}()
+	return answered
+}
+
+// alert logs and counts an alert, then passes it to the alert hook, if any.
+func (w *Watchdog) alert(wedged bool, elapsed time.Duration) {
+	if wedged {
+		watchdogMetrics.Add(w.name+".alerts", 1)
+		w.log.Printf("controller %s hasn't answered a probe for %s; it may be wedged\n", w.name, elapsed)
+	} else {
+		watchdogMetrics.Add(w.name+".recoveries", 1)
+		w.log.Printf("controller %s answered a probe after %s\n", w.name, elapsed)
+	}
+
+	if w.onAlert != nil {
+		w.onAlert(WatchdogAlert{Name: w.name, Wedged: wedged, Elapsed: elapsed})
+	}
+}
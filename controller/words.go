@@ -0,0 +1,87 @@
+package controller
+
+// File words.go contains word filters, which restrict the request words a Bifrost adapter accepts, whatever the client
+// is allowed to do once logged in; for example, a public listener might only accept 'dump'.
+//
+// The filter sees words after dialect translation, so it always works in the current protocol.
+// The words that set up the connection itself (seg, segsize, errmode, caps and login) always get through, as do batches,
+// whose requests the filter sees one by one.
+
+import (
+	"fmt"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// CodeForbidden is the error code of WordForbiddenErrors.
+const CodeForbidden = "forbidden"
+
+// WordForbiddenError is the error returned for requests whose word the adapter's word filter doesn't accept.
+type WordForbiddenError string
+
+// Error gets the error message of a WordForbiddenError.
+func (e WordForbiddenError) Error() string {
+	return fmt.Sprintf("%s: not accepted on this connection", string(e))
+}
+
+// Code gets the error code of a WordForbiddenError.
+func (WordForbiddenError) Code() string {
+	return CodeForbidden
+}
+
+// WordFilter decides which request words an adapter accepts.
+// A nil WordFilter accepts every word.
+type WordFilter struct {
+	// allow is the set of words accepted, or nil if every word not in deny is.
+	allow map[string]struct{}
+	// deny is the set of words refused, even if they are in allow.
+	deny map[string]struct{}
+}
+
+// NewWordFilter makes a filter accepting the words in allow, or every word if allow is empty, except those in deny.
+// If both are empty, it returns nil.
+func NewWordFilter(allow, deny []string) *WordFilter {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil
+	}
+	f := WordFilter{deny: wordSet(deny)}
+	if len(allow) != 0 {
+		f.allow = wordSet(allow)
+	}
+	return &f
+}
+
+// wordSet makes a set of the words in words.
+func wordSet(words []string) map[string]struct{} {
+	set := make(map[string]struct{}, len(words))
+	for _, w := range words {
+		set[w] = struct{}{}
+	}
+	return set
+}
+
+// Accepts gets whether f accepts requests with word word.
+func (f *WordFilter) Accepts(word string) bool {
+	if f == nil {
+		return true
+	}
+	switch word {
+	case bifrost.RqSeg, bifrost.RqSegSize, RqErrMode, RqCaps, RqLogin, RqBatch:
+		return true
+	}
+	if _, ok := f.deny[word]; ok {
+		return false
+	}
+	if f.allow == nil {
+		return true
+	}
+	_, ok := f.allow[word]
+	return ok
+}
+
+// SetWordFilter sets the filter deciding which request words the adapter accepts; nil, the default, accepts every
+// word.
+// It must be called before Run.
+func (b *Bifrost) SetWordFilter(f *WordFilter) {
+	b.words = f
+}
@@ -0,0 +1,118 @@
+package controller
+
+// File wordtable.go contains word tables, which map each request and response word to the role that understands or
+// sends it.
+//
+// Parsers, emitters, dialects and clients each name the words they use in their own code.
+// A table built from the schemas that the adapter and each role describe lets tests check that those names are words
+// some role actually has, and that no two roles claim the same word.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// AdapterRole is the role under which the adapter's own words are described and tabled.
+const AdapterRole = "-"
+
+// adapterResponses lists the response words the adapter sends on its own account, other than replies to its own
+// requests, which its schema already lists.
+var adapterResponses = []string{
+	core.RsOhai, core.RsIama, core.RsAck, bifrost.RsSeg, RsSeq, RsLag, RsProgress, RsWatchdog,
+}
+
+// WordTable maps request and response words to the roles that understand and send them.
+type WordTable struct {
+	// requests maps each request word to its role.
+	requests map[string]string
+	// responses maps each response word to its role.
+	responses map[string]string
+}
+
+// NewWordTable makes a WordTable of the adapter's own words and the words each of schemas describes.
+// It fails if two roles claim the same word, or a request replies with a response word no role sends.
+func NewWordTable(schemas ...Schema) (*WordTable, error) {
+	t := WordTable{requests: map[string]string{}, responses: map[string]string{}}
+
+	adapter := Schema{Role: AdapterRole, Requests: adapterSchema}
+	for _, w := range adapterResponses {
+		adapter.Responses = append(adapter.Responses, WordSchema{Word: w})
+	}
+	for _, w := range adapterSchema {
+		for _, r := range w.Replies {
+			adapter.Responses = append(adapter.Responses, WordSchema{Word: r})
+		}
+	}
+
+	all := append([]Schema{adapter}, schemas...)
+	for _, s := range all {
+		for _, w := range s.Requests {
+			if err := claimWord(t.requests, "request", w.Word, s.Role); err != nil {
+				return nil, err
+			}
+		}
+		for _, w := range s.Responses {
+			if err := claimWord(t.responses, "response", w.Word, s.Role); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, s := range all {
+		for _, w := range s.Requests {
+			for _, r := range w.Replies {
+				if _, ok := t.responses[r]; !ok {
+					return nil, fmt.Errorf("%s request %q replies with unknown response %q", s.Role, w.Word, r)
+				}
+			}
+		}
+	}
+	return &t, nil
+}
+
+// claimWord records in roles that the word word, of kind kind, belongs to role, failing if another role has it.
+func claimWord(roles map[string]string, kind, word, role string) error {
+	if had, ok := roles[word]; ok && had != role {
+		return fmt.Errorf("%s %q belongs to both %s and %s", kind, word, had, role)
+	}
+	roles[word] = role
+	return nil
+}
+
+// RequestRole gets the role that understands requests with word word, and whether any does.
+func (t *WordTable) RequestRole(word string) (string, bool) {
+	role, ok := t.requests[word]
+	return role, ok
+}
+
+// ResponseRole gets the role that sends responses with word word, and whether any does.
+func (t *WordTable) ResponseRole(word string) (string, bool) {
+	role, ok := t.responses[word]
+	return role, ok
+}
+
+// Check checks that each of rqs is a request word, and each of rss a response word, of either role or the adapter,
+// which are the words a client of a role server may send and receive.
+// Its error names every word that isn't.
+func (t *WordTable) Check(role string, rqs, rss []string) error {
+	var bad []string
+	for _, w := range rqs {
+		if r, ok := t.requests[w]; !ok || (r != role && r != AdapterRole) {
+			bad = append(bad, "request "+w)
+		}
+	}
+	for _, w := range rss {
+		if r, ok := t.responses[w]; !ok || (r != role && r != AdapterRole) {
+			bad = append(bad, "response "+w)
+		}
+	}
+	if len(bad) != 0 {
+		sort.Strings(bad)
+		return fmt.Errorf("not %s words: %s", role, strings.Join(bad, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,171 @@
+// Package crash writes crash bundles: everything yaps knows about itself when it dies of a panic, for whoever has to
+// work out why it died overnight.
+//
+// A bundle is a directory, named after the time of the crash, holding:
+//
+//   - panic.txt, the panic value and the stack of the goroutine that panicked;
+//   - goroutines.txt, the stacks of every goroutine;
+//   - journal.txt, the most recent requests to the list (see controller.Journal);
+//   - config.toml, the config, with every secret redacted;
+//   - version.txt, the versions of yaps, its API, Go, and the modules it was built with.
+//
+// Go can only catch panics in the goroutine they happen in, so the Reporter only sees panics in goroutines that defer
+// its Guard; panics elsewhere still kill yaps, but without a bundle.
+package crash
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+
+	"github.com/MattWindsor91/yaps/api"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/version"
+)
+
+// DefaultDir is the directory in which a Reporter writes bundles if not told otherwise.
+const DefaultDir = "crashes"
+
+// Reporter writes crash bundles.
+// It is safe to use from many goroutines at once.
+type Reporter struct {
+	// dir is the directory in which bundles go.
+	dir string
+
+	// mu guards config and journal, and makes sure that only one bundle is written at a time.
+	mu sync.Mutex
+	// config is the redacted config, as TOML, or nil if there isn't one yet.
+	config []byte
+	// journal is the list's request journal, or nil if there isn't one yet.
+	journal *controller.Journal
+}
+
+// New makes a Reporter that writes bundles into dir; an empty dir means DefaultDir.
+func New(dir string) *Reporter {
+	if dir == "" {
+		dir = DefaultDir
+	}
+	return &Reporter{dir: dir}
+}
+
+// SetConfig sets the config that goes into bundles, which should already be redacted.
+func (r *Reporter) SetConfig(redacted []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.config = redacted
+}
+
+// SetJournal sets the request journal that goes into bundles.
+func (r *Reporter) SetJournal(j *controller.Journal) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.journal = j
+}
+
+// Guard, when deferred, writes a bundle if the goroutine deferring it panics, and then lets the panic carry on.
+func (r *Reporter) Guard() {
+	v := recover()
+	if v == nil {
+		return
+	}
+	if dir, err := r.Write(v, debug.Stack()); err != nil {
+		fmt.Fprintf(os.Stderr, "couldn't write crash bundle: %v\n", err)
+	} else {
+		fmt.Fprintf(os.Stderr, "wrote crash bundle to %s\n", dir)
+	}
+	panic(v)
+}
+
+// Group is an errgroup.Group whose goroutines are guarded by a Reporter.
+type Group struct {
+	errgroup.Group
+
+	// r is the Reporter guarding the group's goroutines.
+	r *Reporter
+}
+
+// Group makes an empty Group guarded by r.
+func (r *Reporter) Group() *Group {
+	return &Group{r: r}
+}
+
+// Go runs f in a new goroutine, as errgroup.Group.Go does, guarded by g's Reporter.
+func (g *Group) Go(f func() error) {
+	g.Group.Go(func() error {
+		defer g.r.Guard()
+		return f()
+	})
+}
+
+// Write writes a bundle for a panic with value v and stack trace stack, returning the bundle's directory.
+func (r *Reporter) Write(v interface{}, stack []byte) (string, error) {
+	goroutines := allStacks()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	dir := filepath.Join(r.dir, "crash-"+time.Now().UTC().Format("20060102T150405.000000000Z"))
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+
+	files := map[string][]byte{
+		"panic.txt":      []byte(fmt.Sprintf("panic: %v\n\n%s", v, stack)),
+		"goroutines.txt": goroutines,
+		"version.txt":    versionInfo(),
+	}
+	if r.config != nil {
+		files["config.toml"] = r.config
+	}
+	if r.journal != nil {
+		var journal bytes.Buffer
+		if _, err := r.journal.WriteTo(&journal); err != nil {
+			return "", err
+		}
+		files["journal.txt"] = journal.Bytes()
+	}
+
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			return dir, err
+		}
+	}
+	return dir, nil
+}
+
+// allStacks gets the stack traces of every goroutine.
+func allStacks() []byte {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// versionInfo describes the versions of everything that went into this yaps.
+func versionInfo() []byte {
+	text := fmt.Sprintf("%s\napi %s\ngo %s %s/%s\n", version.Get(), api.Version, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return []byte(text)
+	}
+	text += fmt.Sprintf("module %s %s\n", bi.Main.Path, bi.Main.Version)
+	for _, s := range bi.Settings {
+		text += fmt.Sprintf("setting %s=%s\n", s.Key, s.Value)
+	}
+	for _, d := range bi.Deps {
+		text += fmt.Sprintf("dep %s %s\n", d.Path, d.Version)
+	}
+	return []byte(text)
+}
@@ -0,0 +1,52 @@
+package crash_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/crash"
+)
+
+// TestReporter_Guard tests that a Reporter writes a full bundle when a guarded goroutine panics, and lets the panic
+// carry on.
+func TestReporter_Guard(t *testing.T) {
+	dir := t.TempDir()
+	r := crash.New(dir)
+	r.SetConfig([]byte("[Icy]\npassword = \"<redacted>\"\n"))
+	r.SetJournal(controller.NewJournal(0))
+
+	func() {
+		defer func() {
+			if v := recover(); v != "overnight" {
+				t.Errorf("got panic %v after the guard, want the original", v)
+			}
+		}()
+		defer r.Guard()
+		panic("overnight")
+	}()
+
+	bundles, err := filepath.Glob(filepath.Join(dir, "crash-*"))
+	if err != nil || len(bundles) != 1 {
+		t.Fatalf("got bundles %v (error %v), want one", bundles, err)
+	}
+	want := map[string]string{
+		"panic.txt":      "panic: overnight",
+		"goroutines.txt": "TestReporter_Guard",
+		"journal.txt":    "",
+		"config.toml":    "<redacted>",
+		"version.txt":    "api ",
+	}
+	for name, content := range want {
+		data, err := os.ReadFile(filepath.Join(bundles[0], name))
+		if err != nil {
+			t.Errorf("bundle is missing %s: %v", name, err)
+			continue
+		}
+		if !strings.Contains(string(data), content) {
+			t.Errorf("%s doesn't mention %q:\n%s", name, content, data)
+		}
+	}
+}
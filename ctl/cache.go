@@ -0,0 +1,296 @@
+package ctl
+
+// File cache.go contains Cache, a local copy of a list's state for long-running clients, such as UIs, that read the
+// list far more often than it changes.
+//
+// A Cache has a connection of its own, on which it declares itself a display, so that the server never reclaims it
+// for idling, and asks for every broadcast about the list stamped with its sequence number (see controller.CapSeq).
+// It dumps the list, and then applies each broadcast to its copy as it arrives.
+// Whenever a stamp shows that it has missed broadcasts, it dumps the list again, taking the next stamp as its new
+// starting point; servers too old to stamp broadcasts leave it to trust that it never misses any.
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// Cache is a copy of the state of a list, kept up to date from the server's broadcasts.
+// Its reads never go to the server, and are safe to make from many goroutines.
+type Cache struct {
+	// conn is the Cache's connection, which only its goroutine reads from once it is running.
+	conn *Conn
+	// stamped is true if the server stamps broadcasts with sequence numbers.
+	stamped bool
+	// onChange, if not nil, is called after each change to the copy.
+	onChange func()
+
+	// mu guards the fields below.
+	mu sync.RWMutex
+	// mirror is the copy of the list.
+	mirror *list.Mirror
+	// resyncs counts the dumps taken after missing broadcasts.
+	resyncs int
+	// err is why the Cache stopped following the list, if it has.
+	err error
+	// closed is true once the Cache has been closed.
+	closed bool
+
+	// dumpTag is the tag of the dump the Cache is waiting for, or empty if it isn't waiting for one.
+	// Only the Cache's goroutine touches it once running, as with the fields below.
+	dumpTag string
+	// dump is the copy being rebuilt from the dump the Cache is waiting for.
+	dump *list.Mirror
+	// lastSeq is the sequence number of the last broadcast applied, or 0 if the next one starts afresh.
+	lastSeq uint64
+
+	// done is closed once the Cache has stopped following the list.
+	done chan struct{}
+}
+
+// OpenCache connects to the list server at address, logging in with token if it isn't empty, and makes a Cache of
+// its list; each step may take up to timeout.
+// It returns once the Cache holds the whole list; onChange, if not nil, is then called on the Cache's goroutine after
+// each change to it, and mustn't block for long.
+func OpenCache(ctx context.Context, address, token string, timeout time.Duration, onChange func()) (*Cache, error) {
+	conn, err := Dial(ctx, address, token, timeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cache{conn: conn, onChange: onChange, mirror: list.NewMirror(), done: make(chan struct{})}
+	if err := c.setUp(); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	go c.run()
+	return c, nil
+}
+
+// setUp declares c's connection a display that wants stamped broadcasts, then fills c with a dump.
+func (c *Cache) setUp() error {
+	if _, err := c.conn.Request(controller.RqDisplay); err != nil {
+		return err
+	}
+	replies, err := c.conn.Request(controller.RqCaps, controller.CapMeta, controller.CapDiff, controller.CapMinimal, controller.CapSeq)
+	if err != nil {
+		return err
+	}
+	for _, r := range replies {
+		for _, a := range r.Args() {
+			c.stamped = c.stamped || (r.Word() == controller.RsCaps && a == controller.CapSeq)
+		}
+	}
+
+	if err := c.requestDump(); err != nil {
+		return err
+	}
+	if err := c.conn.conn.SetDeadline(time.Now().Add(c.conn.timeout)); err != nil {
+		return err
+	}
+	for c.dumpTag != "" {
+		m, err := c.conn.read()
+		if err != nil {
+			return err
+		}
+		if err := c.handle(*m); err != nil {
+			return err
+		}
+	}
+	return c.conn.conn.SetDeadline(time.Time{})
+}
+
+// Close stops c following the list, and hangs up on the server.
+func (c *Cache) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	c.mu.Unlock()
+
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
+
+// Done gets a channel closed once c has stopped following the list, such as when the server hangs up; Err then says
+// why.
+func (c *Cache) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err gets why c stopped following the list, or nil if it hasn't or was closed.
+func (c *Cache) Err() error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.err
+}
+
+// Items gets a copy of the items in the list, in order.
+func (c *Cache) Items() []list.Item {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.mirror.Items()
+}
+
+// Selection gets the index of the selected item and a copy of it, or -1 and nil if nothing is selected.
+func (c *Cache) Selection() (int, *list.Item) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i, item := c.mirror.Selection()
+	if item == nil {
+		return -1, nil
+	}
+	cp := *item
+	return i, &cp
+}
+
+// AutoMode gets the list's autoselect mode.
+func (c *Cache) AutoMode() list.AutoMode {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.mirror.AutoMode()
+}
+
+// Note gets the note on the whole list.
+func (c *Cache) Note() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.mirror.Note()
+}
+
+// Version gets the list's version.
+func (c *Cache) Version() uint64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.mirror.Version()
+}
+
+// Blocks gets the blocks in the list, in the order they start.
+func (c *Cache) Blocks() []list.BlockResponse {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.mirror.Blocks()
+}
+
+// Dump gets the list as a Dump, without the replies a dump from the server would carry.
+func (c *Cache) Dump() *Dump {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return makeDump(c.mirror, nil)
+}
+
+// Resyncs counts the times c has dumped the list again after missing broadcasts.
+func (c *Cache) Resyncs() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.resyncs
+}
+
+// run follows the list until the connection fails or c is closed.
+func (c *Cache) run() {
+	var err error
+	for err == nil {
+		var m *message.Message
+		if m, err = c.conn.read(); err == nil {
+			err = c.handle(*m)
+		}
+	}
+
+	c.mu.Lock()
+	if !c.closed {
+		c.err = err
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// requestDump asks the server for a dump, to rebuild c's copy from.
+func (c *Cache) requestDump() error {
+	tag, err := c.conn.send(controller.RqDump)
+	if err != nil {
+		return err
+	}
+	c.dumpTag, c.dump = tag, list.NewMirror()
+	return nil
+}
+
+// handle handles the message m from the server.
+func (c *Cache) handle(m message.Message) error {
+	switch {
+	case c.dumpTag != "" && m.Tag() == c.dumpTag:
+		return c.handleDump(m)
+	case m.Tag() != message.TagBcast:
+		return nil
+	case m.Word() == controller.RsSeq:
+		return c.handleSeq(m)
+	case c.dumpTag != "":
+		// The dump will be newer than anything broadcast while waiting for it.
+		return nil
+	}
+
+	body, err := list.ParseBifrostResponse(m)
+	if err != nil {
+		// Not everything broadcast is list state.
+		return nil
+	}
+	c.mu.Lock()
+	c.mirror.Apply(body)
+	c.mu.Unlock()
+	c.changed()
+	return nil
+}
+
+// handleDump handles the reply m to the dump c is waiting for.
+func (c *Cache) handleDump(m message.Message) error {
+	if m.Word() != core.RsAck {
+		if body, err := list.ParseBifrostResponse(m); err == nil {
+			c.dump.Apply(body)
+		}
+		return nil
+	}
+	ack, err := core.ParseAckResponse(&m)
+	if err != nil {
+		return err
+	}
+	if ack.Status != core.StatusOk {
+		return bifrost.AckError{Ack: *ack}
+	}
+
+	c.mu.Lock()
+	c.mirror = c.dump
+	c.mu.Unlock()
+	c.dumpTag, c.dump, c.lastSeq = "", nil, 0
+	c.changed()
+	return nil
+}
+
+// handleSeq handles the sequence stamp m, dumping the list again if it shows that c has missed broadcasts.
+func (c *Cache) handleSeq(m message.Message) error {
+	var seq, prev uint64
+	if err := bifrost.Args(m.Args()).Uint(0, &seq).Uint(1, &prev).Err(); err != nil {
+		return err
+	}
+	if c.dumpTag != "" {
+		return nil
+	}
+	if c.lastSeq != 0 && prev != c.lastSeq {
+		c.mu.Lock()
+		c.resyncs++
+		c.mu.Unlock()
+		return c.requestDump()
+	}
+	c.lastSeq = seq
+	return nil
+}
+
+// changed tells c's change hook, if it has one, that c's copy has changed.
+func (c *Cache) changed() {
+	if c.onChange != nil {
+		c.onChange()
+	}
+}
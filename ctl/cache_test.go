@@ -0,0 +1,143 @@
+package ctl_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/ctl"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// openCache opens a Cache of the list at address, retrying while the server starts up.
+func openCache(ctx context.Context, t *testing.T, address string, onChange func()) *ctl.Cache {
+	t.Helper()
+	for i := 0; ; i++ {
+		c, err := ctl.OpenCache(ctx, address, "", 5*time.Second, onChange)
+		if err == nil {
+			return c
+		}
+		if 50 < i {
+			t.Fatalf("open failed: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// hashes gets the hashes of items, in order.
+func hashes(items []list.Item) string {
+	hs := make([]string, len(items))
+	for i := range items {
+		hs[i] = items[i].Hash()
+	}
+	return strings.Join(hs, " ")
+}
+
+// TestCache tests that a Cache starts with the whole list and follows changes made through another connection.
+func TestCache(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	address := startServer(ctx, t, "")
+	c := dial(ctx, t, address, "")
+	defer c.Close()
+	if _, err := c.Add(-1, "abc", "/music/a.mp3", true); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+
+	changed := make(chan struct{}, 100)
+	cache := openCache(ctx, t, address, func() { changed <- struct{}{} })
+	if got := hashes(cache.Items()); got != "abc" {
+		t.Errorf("items on opening: got %q, want abc", got)
+	}
+
+	if _, err := c.Add(-1, "def", "/music/d.mp3", true); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := c.Select(1, "def"); err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	for deadline := time.After(5 * time.Second); ; {
+		if i, item := cache.Selection(); i == 1 && item.Hash() == "def" {
+			break
+		}
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("cache never saw the selection; items %q", hashes(cache.Items()))
+		}
+	}
+	if got := hashes(cache.Items()); got != "abc def" {
+		t.Errorf("items after adding: got %q, want abc def", got)
+	}
+
+	if err := cache.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if err := cache.Err(); err != nil {
+		t.Errorf("Err after Close: got %v, want nil", err)
+	}
+}
+
+// TestCache_resync tests that a Cache dumps the list again when sequence stamps show it has missed broadcasts.
+func TestCache_resync(t *testing.T) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	// The fake server answers each request as a list server would; the second dump follows a gap in the stamps.
+	replies := map[string][]string{
+		"display": {"ACK OK success"},
+		"caps":    {"CAPS meta diff minimal seq", "ACK OK success"},
+	}
+	dumps := [][]string{
+		{"COUNTL 1", "FLOADL 0 a a.mp3", "ACK OK success"},
+		{"COUNTL 3", "FLOADL 0 a a.mp3", "FLOADL 1 b b.mp3", "FLOADL 2 c c.mp3", "ACK OK success"},
+	}
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		fmt.Fprint(conn, "! OHAI bifrost-0.0.0 fake\n! IAMA list\n")
+		r := bufio.NewReader(conn)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			fields := strings.Fields(line)
+			out := replies[fields[1]]
+			if fields[1] == "dump" {
+				out, dumps = dumps[0], dumps[1:]
+			}
+			for _, o := range out {
+				fmt.Fprintf(conn, "%s %s\n", fields[0], o)
+			}
+			if fields[1] == "dump" && len(dumps) == 1 {
+				// Seq 3 never arrives, and the dump must paper over b and c.
+				fmt.Fprint(conn, "! SEQ 1 0\n! FLOADL 1 b b.mp3\n! SEQ 4 3\n! FLOADL 2 c c.mp3\n")
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := make(chan struct{}, 100)
+	cache := openCache(ctx, t, ln.Addr().String(), func() { changed <- struct{}{} })
+	defer cache.Close()
+
+	for deadline := time.After(5 * time.Second); cache.Resyncs() == 0 || hashes(cache.Items()) != "a b c"; {
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("cache never resynced; items %q, resyncs %d", hashes(cache.Items()), cache.Resyncs())
+		}
+	}
+}
@@ -0,0 +1,196 @@
+// Package ctl is a one-shot Bifrost client for list servers, for cron jobs and shell scripts that need to poke a
+// running yaps without a console.
+//
+// A Conn connects, checks that the server is a list server, logs in if given a token, and then sends requests one at
+// a time, collecting each one's replies up to its ACK; broadcasts meant for everyone are ignored.
+// Longer-running clients that read the list often can instead keep a Cache of it, which follows the broadcasts.
+package ctl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+const (
+	// DefaultAddress is the address of the list server a Conn dials if not told otherwise.
+	DefaultAddress = "localhost:1350"
+	// DefaultTimeout is how long, by default, a Conn waits for the server to do anything.
+	DefaultTimeout = 10 * time.Second
+	// TokenEnv is the environment variable from which the ctl subcommand takes its login token.
+	TokenEnv = "YAPS_TOKEN"
+)
+
+// ErrNotList is the error returned when the server a Conn dials isn't a list server.
+var ErrNotList = errors.New("server isn't a list server")
+
+// Conn is a connection to a list server.
+type Conn struct {
+	// conn is the underlying connection.
+	conn net.Conn
+	// r reads Bifrost lines from conn.
+	r *message.Reader
+	// timeout is how long each request may take.
+	timeout time.Duration
+	// tags counts the requests sent so far, so that each gets its own tag.
+	tags int
+}
+
+// Dial connects to the list server at address, and logs in with token if it isn't empty.
+// Each step, and later each request, may take up to timeout.
+func Dial(ctx context.Context, address, token string, timeout time.Duration) (*Conn, error) {
+	var d net.Dialer
+	dctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	nc, err := d.DialContext(dctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Conn{conn: nc, r: message.NewReader(nc), timeout: timeout}
+	if err := c.handshake(); err != nil {
+		_ = nc.Close()
+		return nil, err
+	}
+	if token != "" {
+		if _, err := c.Request(controller.RqLogin, "token", token); err != nil {
+			_ = nc.Close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Close hangs up on the server.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}
+
+// handshake checks that the server greets c with OHAI, and then IAMA as a list server.
+func (c *Conn) handshake() error {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	m, err := c.read()
+	if err != nil {
+		return err
+	}
+	if _, err := core.ParseOhaiResponse(m); err != nil {
+		return err
+	}
+	if m, err = c.read(); err != nil {
+		return err
+	}
+	iama, err := core.ParseIamaResponse(m)
+	if err != nil {
+		return err
+	}
+	if iama.Role != "list" {
+		return fmt.Errorf("%w: role is %s", ErrNotList, iama.Role)
+	}
+	return nil
+}
+
+// read reads the next message from the server.
+func (c *Conn) read() (*message.Message, error) {
+	line, err := c.r.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	return message.NewFromLine(line)
+}
+
+// Request sends the request with word word and arguments args, and gets the server's replies to it, not counting its
+// ACK; it fails if the ACK isn't successful.
+func (c *Conn) Request(word string, args ...string) ([]message.Message, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return nil, err
+	}
+	tag, err := c.send(word, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	conv := bifrost.Converse(context.Background(), bifrost.ReaderReceiver{R: c.r}, tag, nil)
+	replies, err := conv.Collect()
+	var aerr bifrost.AckError
+	switch {
+	case errors.As(err, &aerr):
+		return replies, fmt.Errorf("%s failed: %w", word, err)
+	case err != nil:
+		return nil, fmt.Errorf("waiting for %s: %w", word, err)
+	default:
+		return replies, nil
+	}
+}
+
+// send sends the request with word word and arguments args under a fresh tag, without waiting for replies, and
+// returns the tag.
+func (c *Conn) send(word string, args ...string) (string, error) {
+	c.tags++
+	tag := "ctl" + strconv.Itoa(c.tags)
+	bs, err := message.New(tag, word).AddArgs(args...).Pack()
+	if err != nil {
+		return "", err
+	}
+	_, err = c.conn.Write(bs)
+	return tag, err
+}
+
+// Add adds an item with hash hash and payload payload at index index, which is a track if track is true and text
+// otherwise.
+// A negative index adds the item at the end; an empty hash gets a fresh one.
+// It returns the item's hash.
+func (c *Conn) Add(index int, hash, payload string, track bool) (string, error) {
+	if index < 0 {
+		d, err := c.Dump()
+		if err != nil {
+			return "", err
+		}
+		index = len(d.Items)
+	}
+	if hash == "" {
+		var err error
+		if hash, err = list.FreshHash(); err != nil {
+			return "", err
+		}
+	}
+	word := list.RqTloadl
+	if track {
+		word = list.RqFloadl
+	}
+	_, err := c.Request(word, strconv.Itoa(index), hash, payload)
+	return hash, err
+}
+
+// Select selects the item at index index, which must have hash hash.
+func (c *Conn) Select(index int, hash string) error {
+	_, err := c.Request(list.RqSel, strconv.Itoa(index), hash)
+	return err
+}
+
+// Dump gets the whole state of the list.
+func (c *Conn) Dump() (*Dump, error) {
+	replies, err := c.Request(controller.RqDump)
+	if err != nil {
+		return nil, err
+	}
+	m := list.NewMirror()
+	for _, r := range replies {
+		// Not everything in a dump is list state.
+		if body, err := list.ParseBifrostResponse(r); err == nil {
+			m.Apply(body)
+		}
+	}
+	return makeDump(m, replies), nil
+}
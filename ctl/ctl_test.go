@@ -0,0 +1,119 @@
+package ctl_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/ctl"
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/netsrv"
+)
+
+// startServer starts a list server, needing the login token token if it isn't empty, and gets its address.
+func startServer(ctx context.Context, t *testing.T, token string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	address := ln.Addr().String()
+	_ = ln.Close()
+
+	con, cli := controller.NewController(list.New())
+	go con.Run(ctx)
+	srv := netsrv.New(log.New(io.Discard, "", 0), address, cli)
+	if token != "" {
+		srv.SetAuth(auth.Static{token: {User: "cron"}})
+	}
+	go srv.Run(ctx)
+	return address
+}
+
+// dial connects to the server at address, retrying while it starts up.
+func dial(ctx context.Context, t *testing.T, address, token string) *ctl.Conn {
+	t.Helper()
+	for i := 0; ; i++ {
+		c, err := ctl.Dial(ctx, address, token, 5*time.Second)
+		if err == nil {
+			return c
+		}
+		if 50 < i {
+			t.Fatalf("dial failed: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestConn tests adding, selecting, and dumping through a Conn.
+func TestConn(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := dial(ctx, t, startServer(ctx, t, ""), "")
+	defer c.Close()
+
+	if _, err := c.Add(-1, "abc", "/music/a.mp3", true); err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	h, err := c.Add(-1, "", "Station ident", false)
+	if err != nil {
+		t.Fatalf("Add with a fresh hash failed: %v", err)
+	}
+	if _, err := c.Add(0, "zzz", "/music/z.mp3", true); err != nil {
+		t.Fatalf("Add at the start failed: %v", err)
+	}
+	if err := c.Select(1, "abc"); err != nil {
+		t.Fatalf("Select failed: %v", err)
+	}
+	if err := c.Select(1, "nope"); err == nil {
+		t.Error("Select of the wrong hash succeeded, want an error")
+	}
+
+	d, err := c.Dump()
+	if err != nil {
+		t.Fatalf("Dump failed: %v", err)
+	}
+	want := []ctl.Item{
+		{Index: 0, Hash: "zzz", Type: "track", Payload: "/music/z.mp3"},
+		{Index: 1, Hash: "abc", Type: "track", Payload: "/music/a.mp3"},
+		{Index: 2, Hash: h, Type: "text", Payload: "Station ident"},
+	}
+	if len(d.Items) != len(want) {
+		t.Fatalf("got items %+v, want %+v", d.Items, want)
+	}
+	for i, w := range want {
+		if d.Items[i] != w {
+			t.Errorf("item %d: got %+v, want %+v", i, d.Items[i], w)
+		}
+	}
+	if d.Selection != 1 {
+		t.Errorf("got selection %d, want 1", d.Selection)
+	}
+	if len(d.Lines()) == 0 {
+		t.Error("got no dump lines")
+	}
+}
+
+// TestDial_Login tests that Dial logs in with its token, and that a server needing one refuses requests without it.
+func TestDial_Login(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	address := startServer(ctx, t, "sesame")
+
+	anon := dial(ctx, t, address, "")
+	defer anon.Close()
+	if _, err := anon.Dump(); err == nil {
+		t.Error("Dump without logging in succeeded, want an error")
+	}
+
+	c := dial(ctx, t, address, "sesame")
+	defer c.Close()
+	if _, err := c.Dump(); err != nil {
+		t.Errorf("Dump after logging in failed: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package ctl
+
+// File dump.go contains the JSON representation of a list dump.
+
+import (
+	"strings"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// Dump is the state of a list, as a script sees it.
+type Dump struct {
+	// Version is the list's version.
+	Version uint64 `json:"version"`
+	// AutoMode is the name of the list's autoselect mode.
+	AutoMode string `json:"automode"`
+	// Note is the note on the whole list, if any.
+	Note string `json:"note,omitempty"`
+	// Selection is the index of the selected item, or -1 if nothing is selected.
+	Selection int `json:"selection"`
+	// Items holds the items in the list, in order.
+	Items []Item `json:"items"`
+	// Blocks holds the blocks in the list, in the order they start.
+	Blocks []Block `json:"blocks,omitempty"`
+
+	// lines holds the replies the dump was made from, as the server sent them.
+	lines []message.Message
+}
+
+// Item is the JSON representation of a list item in a Dump.
+type Item struct {
+	// Index is the item's position in the list.
+	Index int `json:"index"`
+	// Hash is the item's unique hash.
+	Hash string `json:"hash"`
+	// Type is the name of the item's type.
+	Type string `json:"type"`
+	// Payload is the item's payload (a path for tracks, or text).
+	Payload string `json:"payload"`
+	// Note is the item's note, if it has one.
+	Note string `json:"note,omitempty"`
+	// Category is the name of the item's category, if it has one.
+	Category string `json:"category,omitempty"`
+	// Block is the ID of the block the item is in, if it is in one.
+	Block string `json:"block,omitempty"`
+}
+
+// Block is the JSON representation of a block of items in a Dump.
+type Block struct {
+	// ID is the block's ID.
+	ID string `json:"id"`
+	// Title is the block's title.
+	Title string `json:"title"`
+	// Index is the index of the block's first item.
+	Index int `json:"index"`
+	// Count is the number of items in the block.
+	Count int `json:"count"`
+	// Collapsed is true if displays should show the block as one line.
+	Collapsed bool `json:"collapsed,omitempty"`
+}
+
+// makeDump makes the Dump of the list mirrored by m, which was rebuilt from replies.
+func makeDump(m *list.Mirror, replies []message.Message) *Dump {
+	sel, _ := m.Selection()
+	d := Dump{
+		Version:   m.Version(),
+		AutoMode:  m.AutoMode().String(),
+		Note:      m.Note(),
+		Selection: sel,
+		Items:     []Item{},
+		lines:     replies,
+	}
+	for i, it := range m.Items() {
+		d.Items = append(d.Items, Item{
+			Index:    i,
+			Hash:     it.Hash(),
+			Type:     it.Type().String(),
+			Payload:  it.Payload(),
+			Note:     it.Note(),
+			Category: it.Category(),
+			Block:    it.Block(),
+		})
+	}
+	for _, b := range m.Blocks() {
+		d.Blocks = append(d.Blocks, Block{ID: b.ID, Title: b.Title, Index: b.Index, Count: b.Count, Collapsed: b.Collapsed})
+	}
+	return &d
+}
+
+// Lines gets the replies d was made from, one Bifrost line each, without their tags.
+func (d *Dump) Lines() []string {
+	lines := make([]string, len(d.lines))
+	for i, m := range d.lines {
+		lines[i] = Line(m)
+	}
+	return lines
+}
+
+// Line gets m as a Bifrost line, without its tag or newline, as scripts want to see replies.
+func Line(m message.Message) string {
+	return strings.TrimSuffix(strings.TrimPrefix(m.String(), m.Tag()+" "), "\n")
+}
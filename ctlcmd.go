@@ -0,0 +1,146 @@
+package main
+
+// File ctlcmd.go contains the 'ctl' subcommand, which does one thing to a running list server and exits, for cron jobs
+// and shell scripts.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/ctl"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// ctlUsage describes how to use the 'ctl' subcommand.
+const ctlUsage = `usage: ctl [flags] action [action flags] [args]
+actions:
+  add [-index n] [-hash h] [-text] payload  add a track (or text item), by default at the end with a fresh hash
+  sel index hash                            select an item
+  dump [-json]                              print the list, as Bifrost lines or as JSON
+  send word [args...]                       send any request, printing its replies
+flags before the action apply to every action; -json prints replies as JSON objects, one per line`
+
+// ctlActions maps each 'ctl' action to the function implementing it.
+// Each takes the connection, the action's arguments, and whether to print JSON.
+var ctlActions = map[string]func(c *ctl.Conn, args []string, asJSON bool) error{
+	"add":  runCtlAdd,
+	"sel":  runCtlSel,
+	"dump": runCtlDump,
+	"send": runCtlSend,
+}
+
+// runCtl connects to a list server and performs one action on it.
+func runCtl(args []string) error {
+	fs := flag.NewFlagSet("ctl", flag.ContinueOnError)
+	address := fs.String("addr", ctl.DefaultAddress, "host:port of the list server")
+	token := fs.String("token", os.Getenv(ctl.TokenEnv), "token to log in with, if the server needs one (default $"+ctl.TokenEnv+")")
+	timeout := fs.Duration("timeout", ctl.DefaultTimeout, "how long to wait for the server")
+	asJSON := fs.Bool("json", false, "print replies as JSON objects, one per line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() == 0 {
+		return errors.New(ctlUsage)
+	}
+	action, ok := ctlActions[fs.Arg(0)]
+	if !ok {
+		return fmt.Errorf("unknown action %q\n%s", fs.Arg(0), ctlUsage)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+	c, err := ctl.Dial(ctx, *address, *token, *timeout)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	return action(c, fs.Args()[1:], *asJSON)
+}
+
+// runCtlAdd adds an item, printing its hash.
+func runCtlAdd(c *ctl.Conn, args []string, asJSON bool) error {
+	fs := flag.NewFlagSet("ctl add", flag.ContinueOnError)
+	index := fs.Int("index", -1, "index to add the item in front of (default the end)")
+	hash := fs.String("hash", "", "hash of the new item (default a fresh one)")
+	text := fs.Bool("text", false, "add a text item instead of a track")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: ctl add [-index n] [-hash h] [-text] payload")
+	}
+	h, err := c.Add(*index, *hash, fs.Arg(0), !*text)
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		return json.NewEncoder(os.Stdout).Encode(struct {
+			Hash string `json:"hash"`
+		}{h})
+	}
+	fmt.Println(h)
+	return nil
+}
+
+// runCtlSel selects an item.
+func runCtlSel(c *ctl.Conn, args []string, _ bool) error {
+	if len(args) != 2 {
+		return errors.New("usage: ctl sel index hash")
+	}
+	index, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("bad index: %w", err)
+	}
+	return c.Select(index, args[1])
+}
+
+// runCtlDump prints the list.
+func runCtlDump(c *ctl.Conn, args []string, asJSON bool) error {
+	fs := flag.NewFlagSet("ctl dump", flag.ContinueOnError)
+	fs.BoolVar(&asJSON, "json", asJSON, "print the list as JSON")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: ctl dump [-json]")
+	}
+	d, err := c.Dump()
+	if err != nil {
+		return err
+	}
+	if asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(d)
+	}
+	for _, l := range d.Lines() {
+		fmt.Println(l)
+	}
+	return nil
+}
+
+// runCtlSend sends any request, printing its replies.
+func runCtlSend(c *ctl.Conn, args []string, asJSON bool) error {
+	if len(args) == 0 {
+		return errors.New("usage: ctl send word [args...]")
+	}
+	replies, err := c.Request(args[0], args[1:]...)
+	enc := json.NewEncoder(os.Stdout)
+	for _, m := range replies {
+		if !asJSON {
+			fmt.Println(ctl.Line(m))
+			continue
+		}
+		if jerr := enc.Encode(bifrost.ToJSON(m, list.ParseBifrostResponse)); jerr != nil {
+			return jerr
+		}
+	}
+	return err
+}
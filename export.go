@@ -0,0 +1,96 @@
+package main
+
+// File export.go contains the 'export-history' subcommand.
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/MattWindsor91/yaps/history"
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/store"
+)
+
+// runExportHistory converts part of a play log, or the play history of a list in storage, into CSV or JSON on
+// stdout.
+func runExportHistory(args []string) error {
+	fs := flag.NewFlagSet("export-history", flag.ContinueOnError)
+	from := fs.String("from", "", "RFC 3339 time of the first selection to export (default: the start of the log)")
+	to := fs.String("to", "", "RFC 3339 time before which to stop exporting (default: the end of the log)")
+	format := fs.String("format", "csv", "output format: csv or json")
+	storage := fs.String("store", "", "storage spec (for example 'sqlite:yaps.db') to export from, instead of a play log")
+	name := fs.String("list", "main", "with -store, the name of the list to export")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if (*storage == "") != (fs.NArg() == 1) {
+		return errors.New("usage: export-history [flags] play-log, or export-history -store spec [flags]")
+	}
+
+	var start, end time.Time
+	if err := parseExportTime(*from, &start); err != nil {
+		return fmt.Errorf("bad -from: %w", err)
+	}
+	if err := parseExportTime(*to, &end); err != nil {
+		return fmt.Errorf("bad -to: %w", err)
+	}
+
+	var (
+		rs  []list.PlayRecord
+		err error
+	)
+	if *storage == "" {
+		rs, err = readPlayLog(fs.Arg(0), start, end)
+	} else {
+		rs, err = readStoredHistory(*storage, *name, start, end)
+	}
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "csv":
+		return history.WriteCSV(os.Stdout, rs)
+	case "json":
+		return history.WriteJSON(os.Stdout, rs)
+	default:
+		return fmt.Errorf("unknown format: %q", *format)
+	}
+}
+
+// readPlayLog reads the records in the play log file at path from time from to time to.
+func readPlayLog(path string, from, to time.Time) ([]list.PlayRecord, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return history.Read(f, from, to)
+}
+
+// readStoredHistory reads the play history of the list called name, in the storage described by spec, from time
+// from to time to.
+func readStoredHistory(spec, name string, from, to time.Time) ([]list.PlayRecord, error) {
+	s, err := store.Open(spec)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	return s.QueryHistory(name, from, to)
+}
+
+// parseExportTime parses s, if not empty, as an RFC 3339 time into dst.
+func parseExportTime(s string, dst *time.Time) error {
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return err
+	}
+	*dst = t
+	return nil
+}
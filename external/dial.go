@@ -0,0 +1,318 @@
+package external
+
+// File dial.go contains the options a Service uses to reach its remote service, and the dialer that applies them.
+//
+// Proxies are given as URLs: 'socks5://' (or 'socks5h://') for SOCKS 5, and 'http://' for HTTP CONNECT.
+// Either may carry a username and password.
+// Host names are always resolved by the proxy.
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// DialOptions configures how a Service connects to its remote service.
+type DialOptions struct {
+	// Timeout is how long the remote service, and any proxy, has to accept the connection and say OHAI and IAMA.
+	// If zero, it is 5 seconds.
+	Timeout time.Duration
+
+	// KeepAlive is the period between TCP keepalive probes.
+	// If zero, the operating system's default is used; if negative, keepalives are off.
+	KeepAlive time.Duration
+
+	// TLS, if not nil, makes the Service speak TLS to the remote service.
+	// If it has no ServerName, the host part of the remote service's address is used.
+	TLS *tls.Config
+
+	// Proxy, if not nil, is the URL of a proxy to connect through.
+	Proxy *url.URL
+}
+
+// timeout gets the connection timeout set in o, or its default.
+func (o DialOptions) timeout() time.Duration {
+	if o.Timeout <= 0 {
+		return connectTimeout
+	}
+	return o.Timeout
+}
+
+// Dial connects to address, according to o.
+// Anything else that dials Bifrost services, such as the net server's hub link, can use it too.
+func (o DialOptions) Dial(ctx context.Context, address string) (net.Conn, error) {
+	d := net.Dialer{Timeout: o.timeout(), KeepAlive: o.KeepAlive}
+	if o.Proxy == nil {
+		conn, err := d.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		return o.secure(ctx, conn, address)
+	}
+
+	conn, err := d.DialContext(ctx, "tcp", o.Proxy.Host)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't reach proxy: %w", err)
+	}
+	if conn, err = o.tunnel(conn, address); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return o.secure(ctx, conn, address)
+}
+
+// tunnel asks the proxy on the other end of conn to connect to address, returning the tunnelled connection.
+func (o DialOptions) tunnel(conn net.Conn, address string) (net.Conn, error) {
+	if err := conn.SetDeadline(time.Now().Add(o.timeout())); err != nil {
+		return conn, err
+	}
+
+	var err error
+	switch o.Proxy.Scheme {
+	case "socks5", "socks5h":
+		err = socks5Connect(conn, o.Proxy.User, address)
+	case "http":
+		conn, err = httpConnect(conn, o.Proxy.User, address)
+	default:
+		err = fmt.Errorf("unsupported proxy scheme: %q", o.Proxy.Scheme)
+	}
+	if err != nil {
+		return conn, err
+	}
+
+	return conn, conn.SetDeadline(time.Time{})
+}
+
+// secure wraps conn, which is a connection to address, in TLS if o asks for it.
+func (o DialOptions) secure(ctx context.Context, conn net.Conn, address string) (net.Conn, error) {
+	if o.TLS == nil {
+		return conn, nil
+	}
+
+	cfg := o.TLS
+	if cfg.ServerName == "" {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+		cfg = cfg.Clone()
+		cfg.ServerName = host
+	}
+
+	tctx, cancel := context.WithTimeout(ctx, o.timeout())
+	defer cancel()
+	tconn := tls.Client(conn, cfg)
+	if err := tconn.HandshakeContext(tctx); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return tconn, nil
+}
+
+//
+// SOCKS 5 (RFC 1928, with RFC 1929 username/password authentication)
+//
+
+const (
+	socksVersion      = 5
+	socksAuthNone     = 0
+	socksAuthPassword = 2
+	socksCmdConnect   = 1
+	socksAddrIPv4     = 1
+	socksAddrName     = 3
+	socksAddrIPv6     = 4
+)
+
+// socksReplies holds the meanings of SOCKS 5 reply codes.
+var socksReplies = []string{
+	"succeeded",
+	"general failure",
+	"connection not allowed by ruleset",
+	"network unreachable",
+	"host unreachable",
+	"connection refused",
+	"TTL expired",
+	"command not supported",
+	"address type not supported",
+}
+
+// socks5Connect asks the SOCKS 5 proxy on the other end of conn to connect to address, authenticating as user.
+func socks5Connect(conn net.Conn, user *url.Userinfo, address string) error {
+	methods := []byte{socksAuthNone}
+	if user != nil {
+		methods = append(methods, socksAuthPassword)
+	}
+	if _, err := conn.Write(append([]byte{socksVersion, byte(len(methods))}, methods...)); err != nil {
+		return err
+	}
+
+	var choice [2]byte
+	if _, err := io.ReadFull(conn, choice[:]); err != nil {
+		return err
+	}
+	if choice[0] != socksVersion {
+		return fmt.Errorf("proxy speaks SOCKS version %d, want %d", choice[0], socksVersion)
+	}
+	switch choice[1] {
+	case socksAuthNone:
+	case socksAuthPassword:
+		if err := socks5Authenticate(conn, user); err != nil {
+			return err
+		}
+	default:
+		return errors.New("proxy accepts none of our authentication methods")
+	}
+
+	rq, err := socks5Address(address)
+	if err != nil {
+		return err
+	}
+	if _, err = conn.Write(append([]byte{socksVersion, socksCmdConnect, 0}, rq...)); err != nil {
+		return err
+	}
+
+	var rs [4]byte
+	if _, err = io.ReadFull(conn, rs[:]); err != nil {
+		return err
+	}
+	if rep := int(rs[1]); rep != 0 {
+		if rep < len(socksReplies) {
+			return fmt.Errorf("proxy couldn't connect: %s", socksReplies[rep])
+		}
+		return fmt.Errorf("proxy couldn't connect: reply code %d", rep)
+	}
+	return socks5SkipAddress(conn, rs[3])
+}
+
+// socks5Authenticate sends the username and password in user to the SOCKS 5 proxy on the other end of conn.
+func socks5Authenticate(conn net.Conn, user *url.Userinfo) error {
+	if user == nil {
+		return errors.New("proxy wants a username and password")
+	}
+	name := user.Username()
+	pass, _ := user.Password()
+	if 255 < len(name) || 255 < len(pass) {
+		return errors.New("proxy username or password too long")
+	}
+
+	rq := []byte{1, byte(len(name))}
+	rq = append(rq, name...)
+	rq = append(rq, byte(len(pass)))
+	rq = append(rq, pass...)
+	if _, err := conn.Write(rq); err != nil {
+		return err
+	}
+
+	var rs [2]byte
+	if _, err := io.ReadFull(conn, rs[:]); err != nil {
+		return err
+	}
+	if rs[1] != 0 {
+		return errors.New("proxy rejected our username and password")
+	}
+	return nil
+}
+
+// socks5Address encodes address as a SOCKS 5 address and port.
+func socks5Address(address string) ([]byte, error) {
+	host, sport, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(sport, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("bad port: %q", sport)
+	}
+
+	var rq []byte
+	if ip := net.ParseIP(host); ip == nil {
+		if 255 < len(host) {
+			return nil, fmt.Errorf("host name too long: %q", host)
+		}
+		rq = append([]byte{socksAddrName, byte(len(host))}, host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		rq = append([]byte{socksAddrIPv4}, ip4...)
+	} else {
+		rq = append([]byte{socksAddrIPv6}, ip.To16()...)
+	}
+	return append(rq, byte(port>>8), byte(port)), nil
+}
+
+// socks5SkipAddress reads past the bound address, of type atyp, at the end of a SOCKS 5 reply.
+func socks5SkipAddress(conn net.Conn, atyp byte) error {
+	var n int
+	switch atyp {
+	case socksAddrIPv4:
+		n = net.IPv4len
+	case socksAddrIPv6:
+		n = net.IPv6len
+	case socksAddrName:
+		var l [1]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return err
+		}
+		n = int(l[0])
+	default:
+		return fmt.Errorf("proxy sent unknown address type %d", atyp)
+	}
+
+	// The port follows the address.
+	_, err := io.CopyN(io.Discard, conn, int64(n+2))
+	return err
+}
+
+//
+// HTTP CONNECT
+//
+
+// httpConnect asks the HTTP proxy on the other end of conn to connect to address, authenticating as user.
+func httpConnect(conn net.Conn, user *url.Userinfo, address string) (net.Conn, error) {
+	rq := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if user != nil {
+		pass, _ := user.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + pass))
+		rq.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := rq.Write(conn); err != nil {
+		return conn, err
+	}
+
+	r := bufio.NewReader(conn)
+	rs, err := http.ReadResponse(r, rq)
+	if err != nil {
+		return conn, err
+	}
+	_ = rs.Body.Close()
+	if rs.StatusCode != http.StatusOK {
+		return conn, fmt.Errorf("proxy couldn't connect: %s", rs.Status)
+	}
+
+	// The remote service speaks first, so its greeting may already be in r's buffer.
+	return bufferedConn{Conn: conn, r: r}, nil
+}
+
+// bufferedConn is a net.Conn whose reads go through a buffer that may already hold data.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Read reads from the buffer, and then the connection.
+func (c bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
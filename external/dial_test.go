@@ -0,0 +1,135 @@
+package external_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/external"
+)
+
+// remoteAddress is the address the tests ask proxies to connect to.
+// Nothing listens there: the fake proxies play the remote service themselves.
+const remoteAddress = "playd.example:1350"
+
+// serveSocks5 plays a SOCKS 5 proxy, with username 'user' and password 'pass', on conn, which it reads through r.
+// It returns the address the client asked for.
+func serveSocks5(t *testing.T, conn net.Conn, r *bufio.Reader) string {
+	t.Helper()
+	read := func(n int) []byte {
+		t.Helper()
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			t.Fatalf("proxy read failed: %v", err)
+		}
+		return buf
+	}
+	write := func(bs ...byte) {
+		t.Helper()
+		if _, err := conn.Write(bs); err != nil {
+			t.Fatalf("proxy write failed: %v", err)
+		}
+	}
+
+	greeting := read(2)
+	methods := read(int(greeting[1]))
+	if greeting[0] != 5 || len(methods) != 2 || methods[1] != 2 {
+		t.Fatalf("got greeting %v %v, want password auth offered", greeting, methods)
+	}
+	write(5, 2)
+
+	auth := read(2)
+	user := string(read(int(auth[1])))
+	pass := string(read(int(read(1)[0])))
+	if user != "user" || pass != "pass" {
+		t.Fatalf("got credentials %s:%s, want user:pass", user, pass)
+	}
+	write(1, 0)
+
+	rq := read(5)
+	if rq[1] != 1 || rq[3] != 3 {
+		t.Fatalf("got request %v, want connect to a host name", rq)
+	}
+	host := string(read(int(rq[4])))
+	port := read(2)
+	write(5, 0, 0, 1, 0, 0, 0, 0, 0, 0)
+
+	return net.JoinHostPort(host, strconv.Itoa(int(port[0])<<8|int(port[1])))
+}
+
+// serveHTTPConnect plays an HTTP proxy, with username 'user' and password 'pass', on conn, which it reads through r.
+// It returns the address the client asked for.
+func serveHTTPConnect(t *testing.T, conn net.Conn, r *bufio.Reader) string {
+	t.Helper()
+	rq, err := http.ReadRequest(r)
+	if err != nil {
+		t.Fatalf("proxy read failed: %v", err)
+	}
+	if rq.Method != http.MethodConnect {
+		t.Fatalf("got method %s, want CONNECT", rq.Method)
+	}
+	if got, want := rq.Header.Get("Proxy-Authorization"), "Basic "+base64.StdEncoding.EncodeToString([]byte("user:pass")); got != want {
+		t.Fatalf("got authorization %q, want %q", got, want)
+	}
+
+	// Sending the greeting along with the response checks that the Service doesn't lose it.
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n! OHAI bifrost-0.0.0 fake-0.0.0\n"); err != nil {
+		t.Fatalf("proxy write failed: %v", err)
+	}
+	return rq.Host
+}
+
+// TestService_Proxy tests that a Service can reach its remote service through each kind of proxy.
+func TestService_Proxy(t *testing.T) {
+	cases := map[string]struct {
+		serve func(*testing.T, net.Conn, *bufio.Reader) string
+		// greeted is true if serve already sent OHAI.
+		greeted bool
+	}{
+		"socks5": {serve: serveSocks5},
+		"http":   {serve: serveHTTPConnect, greeted: true},
+	}
+
+	for scheme, c := range cases {
+		t.Run(scheme, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatalf("listen failed: %v", err)
+			}
+			defer ln.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			proxy := &url.URL{Scheme: scheme, User: url.UserPassword("user", "pass"), Host: ln.Addr().String()}
+			_, expectBcast := startService(ctx, t, remoteAddress, external.DialOptions{Proxy: proxy})
+
+			conn, err := ln.Accept()
+			if err != nil {
+				t.Fatalf("accept failed: %v", err)
+			}
+			defer conn.Close()
+			br := bufio.NewReader(conn)
+			if got := c.serve(t, conn, br); got != remoteAddress {
+				t.Fatalf("proxy asked for %s, want %s", got, remoteAddress)
+			}
+
+			f := &fakeRemote{t: t, conn: conn, r: br}
+			if c.greeted {
+				f.send("! IAMA player")
+			} else {
+				f = greet(t, conn, br)
+			}
+			tag := f.expect("dump")
+			f.send(tag+" STATE stopped", tag+" ACK OK success")
+			expectBcast("STATE stopped")
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package external
+
+// File link.go contains the link between a Service and the remote service it mirrors.
+//
+// The link redials whenever the connection drops, waiting longer after each failure, up to a limit.
+// On every connection, it asks for a dump, which the Service uses to resynchronise its view.
+// Broadcasts that arrive mid-dump are held back until the dump is done, as the dump may or may not include them.
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/comm"
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+const (
+	// retryMin is how long the link waits before its first attempt to redial.
+	retryMin = 500 * time.Millisecond
+	// retryMax is the longest the link waits between attempts to redial.
+	retryMax = 30 * time.Second
+	// connectTimeout is the default for how long the remote service has to accept the connection and say OHAI and
+	// IAMA.
+	connectTimeout = 5 * time.Second
+)
+
+// link holds the state of a Service's connection that outlives any one connection.
+type link struct {
+	// s is the Service being linked.
+	s *Service
+
+	// cli is the client of the Service's controller.
+	cli *controller.Client
+
+	// acks receives the controller's replies to updates.
+	acks chan controller.Response
+
+	// updates holds requests waiting to be sent to the controller, oldest first.
+	// The link never blocks on the controller, which may itself be waiting for the link to forward a request.
+	updates []controller.Request
+
+	// ntags is the number of tags the link has handed out.
+	ntags uint64
+}
+
+// Run connects s to its remote service, and keeps it connected until ctx is cancelled.
+// cli must be a client of the Controller whose state is s.
+func (s *Service) Run(ctx context.Context, cli *controller.Client) error {
+	defer close(s.done)
+
+	l := link{s: s, cli: cli, acks: make(chan controller.Response)}
+	go l.drain()
+
+	delay := retryMin
+	for {
+		connected, err := l.connect(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if connected {
+			delay = retryMin
+		}
+
+		s.log.Printf("lost external service at %s: %v; retrying in %s", s.address, err, delay)
+		s.linkChanged(err)
+		if !l.wait(ctx, delay) {
+			return nil
+		}
+		if delay *= 2; retryMax < delay {
+			delay = retryMax
+		}
+	}
+}
+
+// drain throws away everything the controller sends the link, until the controller shuts down.
+// The link doesn't need the controller's replies or broadcasts, but must drain them so as not to wedge it.
+func (l *link) drain() {
+	for {
+		select {
+		case _, ok := <-l.cli.Rx:
+			if !ok {
+				return
+			}
+		case <-l.acks:
+		}
+	}
+}
+
+// wait waits for delay while disconnected, refusing forwarded requests and sending any waiting updates.
+// It returns false if ctx was cancelled first.
+func (l *link) wait(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	for {
+		tx, next := l.nextUpdate()
+		select {
+		case <-timer.C:
+			return true
+		case f := <-l.s.forwards:
+			f.conv.HangUp()
+		case tx <- next:
+			l.updates = l.updates[1:]
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// nextUpdate gets the controller's request channel and the oldest waiting update, if there is one.
+// Otherwise, it returns a nil channel, so that sends on it never happen.
+func (l *link) nextUpdate() (chan<- controller.Request, controller.Request) {
+	if len(l.updates) == 0 {
+		return nil, controller.Request{}
+	}
+	return l.cli.Tx, l.updates[0]
+}
+
+// queue adds an update with body rbody to the back of the update queue.
+func (l *link) queue(rbody interface{}) {
+	l.updates = append(l.updates, controller.Request{
+		Origin: controller.RequestOrigin{ReplyTx: l.acks},
+		Body:   rbody,
+	})
+}
+
+// newTag gets a fresh tag for a request to the remote service.
+func (l *link) newTag() string {
+	l.ntags++
+	return "yaps" + strconv.FormatUint(l.ntags, 10)
+}
+
+// connect dials the remote service and runs the connection until it fails, or ctx is cancelled.
+// It returns whether it got as far as the handshake, and the reason the connection ended.
+func (l *link) connect(ctx context.Context) (bool, error) {
+	conn, err := l.s.opts.Dial(ctx, l.s.address)
+	if err != nil {
+		return false, err
+	}
+
+	cctx, cancel := context.WithCancel(ctx)
+	cliEnd, srvEnd := comm.NewEndpointPair()
+	ioEnd := comm.IoEndpoint{Endpoint: srvEnd, Io: conn}
+	errCh := make(chan error)
+	go ioEnd.Run(cctx, errCh)
+
+	defer func() {
+		close(cliEnd.Tx)
+		_ = conn.Close()
+		cancel()
+		for range errCh {
+		}
+	}()
+
+	hctx, hcancel := context.WithTimeout(cctx, l.s.opts.timeout())
+	role, err := handshake(hctx, cliEnd)
+	hcancel()
+	if err != nil {
+		return false, err
+	}
+
+	l.s.linkChanged(nil)
+	return true, l.run(cctx, cliEnd, errCh, role)
+}
+
+// run runs a connection to a remote service with role role, over cliEnd, until it fails.
+func (l *link) run(ctx context.Context, cliEnd *comm.Endpoint, errCh <-chan error, role string) error {
+	dumpTag := l.newTag()
+	if !cliEnd.Send(ctx, *message.New(dumpTag, controller.RqDump)) {
+		return ctx.Err()
+	}
+	var dump, held []message.Message
+
+	// pending routes replies to forwarded requests back to the Service.
+	pending := bifrost.NewRouter()
+	defer pending.HangUp()
+
+	for {
+		tx, next := l.nextUpdate()
+		select {
+		case m := <-cliEnd.Rx:
+			switch t := m.Tag(); {
+			case t == dumpTag && m.Word() == core.RsAck:
+				l.queue(resyncRequest{Role: role, Dump: dump})
+				for _, b := range held {
+					l.queue(updateRequest{Message: b})
+				}
+				dumpTag, dump, held = "", nil, nil
+			case t == dumpTag:
+				dump = append(dump, m)
+			case t == message.TagBcast && dumpTag != "":
+				held = append(held, m)
+			case t == message.TagBcast:
+				l.queue(updateRequest{Message: m})
+			default:
+				if pending.Route(ctx, m) && ctx.Err() != nil {
+					return ctx.Err()
+				}
+			}
+		case f := <-l.s.forwards:
+			tag := l.newTag()
+			if !cliEnd.Send(ctx, *message.New(tag, f.msg.Word()).AddArgs(f.msg.Args()...)) {
+				f.conv.HangUp()
+				return ctx.Err()
+			}
+			pending.Add(tag, f.conv)
+		case tx <- next:
+			l.updates = l.updates[1:]
+		case err, ok := <-errCh:
+			if !ok {
+				return comm.HungUpError
+			}
+			return err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// handshake performs the Bifrost handshake with whichever Bifrost service is on the other end of cliEnd.
+func handshake(ctx context.Context, cliEnd *comm.Endpoint) (role string, err error) {
+	var m *message.Message
+	if m, err = cliEnd.Recv(ctx); err != nil {
+		return "", err
+	}
+	if _, err = core.ParseOhaiResponse(m); err != nil {
+		return "", err
+	}
+
+	if m, err = cliEnd.Recv(ctx); err != nil {
+		return "", err
+	}
+	var iama *core.IamaResponse
+	if iama, err = core.ParseIamaResponse(m); err != nil {
+		return "", err
+	}
+	return iama.Role, nil
+}
@@ -1,77 +1,283 @@
 package external
 
+// File service.go contains Service, a Controllable that mirrors a Bifrost service over the network.
+// - See `external/link.go` for how the Service keeps its connection to the remote service alive.
+//
+// The Service keeps a view of the remote service's state, built from its dump and its broadcasts.
+// It assumes that each response word announces one whole piece of state:
+// a broadcast replaces every message in the view with the same word.
+//
+// Whenever the Service (re)connects, it asks the remote service for a dump, and compares it with the view.
+// Any word whose messages changed while the Service was away gets broadcast again, so that the Service's clients
+// end up seeing the same state as if the connection had never dropped.
+
 import (
 	"context"
 	"errors"
-	"net"
+	"fmt"
+	"log"
 
-	"github.com/MattWindsor91/yaps/controller"
-	"github.com/UniversityRadioYork/bifrost-go/comm"
 	"github.com/UniversityRadioYork/bifrost-go/core"
 	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/controller"
 )
 
+// ErrDisconnected is the error returned when a request can't be forwarded because the remote service is unreachable.
+var ErrDisconnected = errors.New("not connected to the external service")
+
+// RemoteError is the error returned when the remote service rejects a forwarded request.
+type RemoteError struct {
+	// Ack is the acknowledgement the remote service sent.
+	Ack core.AckResponse
+}
+
+// Error gets the remote service's description of the error.
+func (e RemoteError) Error() string {
+	return "external service: " + e.Ack.Description
+}
+
+// Blame blames whoever the remote service blamed.
+func (e RemoteError) Blame() core.Blame {
+	if e.Ack.Status == core.StatusWhat {
+		return core.BlameClient
+	}
+	return core.BlameServer
+}
+
+// ForwardRequest is a request to pass on to the remote service as-is.
+type ForwardRequest struct {
+	// Word is the request word.
+	Word string
+	// Args is the request's arguments.
+	Args []string
+}
+
+// resyncRequest tells the Service's controller about a fresh dump of the remote service.
+//
+// This is kept private because only the Service's link sends it.
+type resyncRequest struct {
+	// Role is the role the remote service announced.
+	Role string
+	// Dump holds the messages the remote service sent in its dump, in order.
+	Dump []message.Message
+}
+
+// updateRequest tells the Service's controller about a broadcast from the remote service.
+//
+// This is kept private because only the Service's link sends it.
+type updateRequest struct {
+	// Message is the broadcast.
+	Message message.Message
+}
+
+// forward is a request on its way from the Service to its link.
+type forward struct {
+	// msg is the request to send; the link gives it a tag.
+	msg message.Message
+	// conv follows the replies to msg.
+	// If the link loses the connection first, it hangs conv up.
+	conv *bifrost.Conversation
+}
+
 // Service is a Controllable that delegates requests and responses to a Bifrost service.
 type Service struct {
-	// role stores the last known role of the client.
+	// address is the host:port of the remote service.
+	address string
+
+	// opts configures how the Service connects to address.
+	opts DialOptions
+
+	// role stores the last known role of the remote service.
 	role string
 
-	// io represents the connection to the external service.
-	io comm.IoEndpoint
+	// words holds the words in the view, in the order they were first seen.
+	words []string
+
+	// view maps each word in words to the latest messages the remote service sent with that word.
+	view map[string][]message.Message
+
+	// forwards carries requests from the Service to its link.
+	forwards chan forward
+
+	// done is closed when the link stops.
+	done chan struct{}
+
+	// log is the Service's logger.
+	log *log.Logger
+
+	// onLink, if non-nil, is called whenever the link connects or loses the remote service.
+	onLink func(err error)
 }
 
-func (s *Service) RoleName() string {
-	return s.role
+// NewService constructs a new Service for the Bifrost service at address, reached according to opts.
+// The Service doesn't connect until Run is called.
+func NewService(address string, opts DialOptions) *Service {
+	return &Service{
+		address:  address,
+		opts:     opts,
+		view:     make(map[string][]message.Message),
+		forwards: make(chan forward),
+		done:     make(chan struct{}),
+		log:      log.Default(),
+	}
 }
 
-func (s *Service) Dump(ctx context.Context, dumpCb controller.ResponseCb) {
-	panic("implement me")
+// SetLogger sets the logger the Service uses to report connection problems.
+// It must be called before Run.
+func (s *Service) SetLogger(l *log.Logger) {
+	s.log = l
 }
 
-func (s *Service) HandleRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, rbody interface{}) error {
-	panic("implement me")
+// SetLinkHook sets a function to be called, on the link's goroutine, with nil whenever the Service connects to the
+// remote service, and with the reason whenever it loses or fails to reach it.
+// It must be called before Run, and must not block.
+func (s *Service) SetLinkHook(f func(err error)) {
+	s.onLink = f
 }
 
-func (c *Service) ParseBifrostRequest(word string, args []string) (interface{}, error) {
-	return nil, errors.New("not implemented")
+// linkChanged calls the link hook, if any.
+func (s *Service) linkChanged(err error) {
+	if s.onLink != nil {
+		s.onLink(err)
+	}
 }
 
-func (c *Service) EmitBifrostResponse(tag string, resp interface{}, out chan<- message.Message) error {
-	return errors.New("not implemented")
+// RoleName gets the role the remote service last announced.
+func (s *Service) RoleName() string {
+	return s.role
 }
 
-// NewService connects to a Bifrost server at address, and, if successful, constructs a new ExternalService over it.
-func NewService(address string) (c *Service, err error) {
-	var conn net.Conn
-	if conn, err = net.Dial("tcp", address); err != nil {
-		return nil, err
+// Dump dumps the Service's view of the remote service's state.
+func (s *Service) Dump(dumpCb controller.ResponseCb) {
+	for _, w := range s.words {
+		for _, m := range s.view[w] {
+			dumpCb(m)
+		}
 	}
+}
 
-	srvEnd, cliEnd := comm.NewEndpointPair()
+// HandleRequest handles a request, with context ctx, for Service s.
+func (s *Service) HandleRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, rbody interface{}) error {
+	switch b := rbody.(type) {
+	case ForwardRequest:
+		return s.handleForwardRequest(ctx, replyCb, b)
+	case resyncRequest:
+		s.handleResyncRequest(bcastCb, b)
+		return nil
+	case updateRequest:
+		s.handleUpdateRequest(bcastCb, b)
+		return nil
+	default:
+		return fmt.Errorf("external service can't handle this request")
+	}
+}
 
-	var role string
-	if role, err = handshake(cliEnd); err != nil {
-		return nil, err
+// handleForwardRequest sends b to the remote service, and passes its replies back through replyCb.
+// It blocks until the remote service acknowledges b, or the connection drops.
+// If ctx ends before b can be sent, b is never sent; once sent, it runs to completion.
+func (s *Service) handleForwardRequest(ctx context.Context, replyCb controller.ResponseCb, b ForwardRequest) error {
+	conv := bifrost.NewConversation()
+	select {
+	case s.forwards <- forward{msg: *message.New("", b.Word).AddArgs(b.Args...), conv: conv}:
+	case <-s.done:
+		return ErrDisconnected
+	case <-ctx.Done():
+		return ctx.Err()
 	}
 
-	c = &Service{role: role, io: comm.IoEndpoint{Endpoint: srvEnd, Io: conn}}
-	return c, nil
+	err := conv.Each(func(m message.Message) { replyCb(m) })
+	var aerr bifrost.AckError
+	switch {
+	case errors.Is(err, bifrost.ErrHungUp):
+		return ErrDisconnected
+	case errors.As(err, &aerr):
+		return RemoteError{Ack: aerr.Ack}
+	default:
+		return err
+	}
 }
 
-// handshake performs the Bifrost handshake with whichever Bifrost service is on the other end of cliEnd.
-func handshake(cliEnd *comm.Endpoint) (role string, err error) {
-	// TODO(@MattWindsor91): make this more symmetric with the way it's done on the client side
-	// TODO(@MattWindsor91): timeouts
-	ohaiMsg := <-cliEnd.Rx
-	if _, err = core.ParseOhaiResponse(&ohaiMsg); err != nil {
-		return "", err
+// handleResyncRequest replaces the view with the dump in b, broadcasting every word that changed.
+func (s *Service) handleResyncRequest(bcastCb controller.ResponseCb, b resyncRequest) {
+	s.role = b.Role
+
+	fresh := make(map[string][]message.Message)
+	var words []string
+	for _, m := range b.Dump {
+		if _, ok := fresh[m.Word()]; !ok {
+			words = append(words, m.Word())
+		}
+		fresh[m.Word()] = append(fresh[m.Word()], m)
 	}
 
-	var iama *core.IamaResponse
-	iamaMsg := <-cliEnd.Rx
-	if iama, err = core.ParseIamaResponse(&iamaMsg); err != nil {
-		return "", err
+	for _, w := range words {
+		if sameMessages(s.view[w], fresh[w]) {
+			continue
+		}
+		for _, m := range fresh[w] {
+			bcastCb(m)
+		}
+	}
+	for _, w := range s.words {
+		if _, ok := fresh[w]; !ok {
+			// Bifrost has no general way to retract a piece of state, so the best we can do is note it.
+			s.log.Printf("external service at %s no longer reports %s", s.address, w)
+		}
 	}
 
-	return iama.Role, nil
+	s.words = words
+	s.view = fresh
+}
+
+// handleUpdateRequest updates the view with the broadcast in b, and passes it on.
+func (s *Service) handleUpdateRequest(bcastCb controller.ResponseCb, b updateRequest) {
+	w := b.Message.Word()
+	if _, ok := s.view[w]; !ok {
+		s.words = append(s.words, w)
+	}
+	s.view[w] = []message.Message{b.Message}
+	bcastCb(b.Message)
+}
+
+// sameMessages gets whether xs and ys have the same words and arguments, in the same order.
+func sameMessages(xs, ys []message.Message) bool {
+	if len(xs) != len(ys) {
+		return false
+	}
+	for i := range xs {
+		if xs[i].Word() != ys[i].Word() || !sameArgs(xs[i].Args(), ys[i].Args()) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameArgs gets whether xs and ys are equal.
+func sameArgs(xs, ys []string) bool {
+	if len(xs) != len(ys) {
+		return false
+	}
+	for i := range xs {
+		if xs[i] != ys[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseBifrostRequest parses any request into a ForwardRequest: the remote service knows best what it accepts.
+func (s *Service) ParseBifrostRequest(word string, args []string) (interface{}, error) {
+	return ForwardRequest{Word: word, Args: args}, nil
+}
+
+// EmitBifrostResponse re-tags messages from the remote service with tag, and sends them down out.
+func (s *Service) EmitBifrostResponse(tag string, rbody interface{}, out chan<- message.Message) error {
+	m, ok := rbody.(message.Message)
+	if !ok {
+		return fmt.Errorf("external service can't emit %v", rbody)
+	}
+	out <- *message.New(tag, m.Word()).AddArgs(m.Args()...)
+	return nil
 }
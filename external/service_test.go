@@ -0,0 +1,152 @@
+package external_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/external"
+)
+
+// fakeRemote is one connection's worth of a fake remote Bifrost service.
+type fakeRemote struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// accept accepts a connection on ln, and greets it.
+func accept(t *testing.T, ln net.Listener) *fakeRemote {
+	t.Helper()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept failed: %v", err)
+	}
+	return greet(t, conn, bufio.NewReader(conn))
+}
+
+// greet says OHAI and IAMA down conn, which the fake remote service reads through r.
+func greet(t *testing.T, conn net.Conn, r *bufio.Reader) *fakeRemote {
+	t.Helper()
+	f := &fakeRemote{t: t, conn: conn, r: r}
+	f.send("! OHAI bifrost-0.0.0 fake-0.0.0", "! IAMA player")
+	return f
+}
+
+// send sends each of lines to the Service.
+func (f *fakeRemote) send(lines ...string) {
+	f.t.Helper()
+	for _, l := range lines {
+		if _, err := io.WriteString(f.conn, l+"\n"); err != nil {
+			f.t.Fatalf("write failed: %v", err)
+		}
+	}
+}
+
+// expect reads a request from the Service, checks that its word is word, and returns its tag.
+func (f *fakeRemote) expect(word string) string {
+	f.t.Helper()
+	line, err := f.r.ReadString('\n')
+	if err != nil {
+		f.t.Fatalf("read failed: %v", err)
+	}
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[1] != word {
+		f.t.Fatalf("got request %q, want word %s", line, word)
+	}
+	return fields[0]
+}
+
+// startService starts a Service, and its Controller, for the remote service at address, reached according to opts.
+// It returns a client of the Controller, and a function that waits for the Controller to broadcast want.
+func startService(ctx context.Context, t *testing.T, address string, opts external.DialOptions) (*controller.Client, func(want string)) {
+	t.Helper()
+
+	svc := external.NewService(address, opts)
+	svc.SetLogger(log.New(io.Discard, "", 0))
+	con, linkCli := controller.NewController(svc)
+	go con.Run(ctx)
+	cli, err := linkCli.Copy(ctx)
+	if err != nil {
+		t.Fatalf("copy failed: %v", err)
+	}
+	go svc.Run(ctx, linkCli)
+
+	bcasts := make(chan string, 16)
+	go func() {
+		for rs := range cli.Rx {
+			if m, ok := rs.Body.(message.Message); ok && rs.Broadcast {
+				bcasts <- strings.Join(append([]string{m.Word()}, m.Args()...), " ")
+			}
+		}
+	}()
+	expectBcast := func(want string) {
+		t.Helper()
+		select {
+		case got := <-bcasts:
+			if got != want {
+				t.Fatalf("got broadcast %q, want %q", got, want)
+			}
+		case <-ctx.Done():
+			t.Fatalf("timed out waiting for broadcast %q", want)
+		}
+	}
+	return cli, expectBcast
+}
+
+// TestService_Resync tests that a Service broadcasts what changed while its connection was down.
+func TestService_Resync(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	cli, expectBcast := startService(ctx, t, ln.Addr().String(), external.DialOptions{})
+
+	r := accept(t, ln)
+	tag := r.expect("dump")
+	r.send(tag+" STATE stopped", tag+" FLOAD foo.mp3", tag+" ACK OK success", "! POS 100")
+	expectBcast("STATE stopped")
+	expectBcast("FLOAD foo.mp3")
+	expectBcast("POS 100")
+	r.conn.Close()
+
+	r = accept(t, ln)
+	tag = r.expect("dump")
+	r.send(tag+" STATE playing", tag+" FLOAD foo.mp3", tag+" POS 100", tag+" ACK OK success", "! MARK")
+	// Only the state changed while the Service was away.
+	expectBcast("STATE playing")
+	expectBcast("MARK")
+
+	go func() {
+		tag := r.expect("eject")
+		r.send(tag+" EJECT", tag+" ACK WHAT 'nothing loaded'")
+	}()
+	var replies []string
+	ok, err := cli.SendAndProcessReplies(ctx, "t1", external.ForwardRequest{Word: "eject"}, func(rs controller.Response) error {
+		m := rs.Body.(message.Message)
+		replies = append(replies, m.Word())
+		return nil
+	})
+	if !ok {
+		t.Fatal("controller stopped during forward")
+	}
+	if _, isRemote := err.(external.RemoteError); !isRemote {
+		t.Errorf("got error %v, want a RemoteError", err)
+	}
+	if len(replies) != 1 || replies[0] != "EJECT" {
+		t.Errorf("got replies %v, want [EJECT]", replies)
+	}
+}
@@ -0,0 +1,109 @@
+// Package history keeps a permanent, append-only log of every item a list selects, for music reporting.
+//
+// The log is a file of JSON lines, one per selection, in the order they happened.
+// yaps only ever appends to it, so it can be rotated or archived by moving it aside while yaps is stopped.
+package history
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// File is a play log kept in a file.
+// It implements list.PlayLog.
+type File struct {
+	// path is the path of the log file.
+	path string
+	// f is the log file, opened for appending.
+	f *os.File
+}
+
+// Open opens the play log at path, creating it if it doesn't exist.
+func Open(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &File{path: path, f: f}, nil
+}
+
+// Close closes the log.
+func (l *File) Close() error {
+	return l.f.Close()
+}
+
+// Append adds r to the end of the log.
+func (l *File) Append(r list.PlayRecord) error {
+	bs, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = l.f.Write(append(bs, '\n'))
+	return err
+}
+
+// Query gets the records in the log from time from (inclusive) to time to (exclusive), oldest first.
+// A zero time leaves that end of the range open.
+func (l *File) Query(from, to time.Time) ([]list.PlayRecord, error) {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Read(f, from, to)
+}
+
+// Read reads the records in the play log r from time from (inclusive) to time to (exclusive), oldest first.
+// A zero time leaves that end of the range open.
+func Read(r io.Reader, from, to time.Time) ([]list.PlayRecord, error) {
+	var rs []list.PlayRecord
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		var pr list.PlayRecord
+		if err := json.Unmarshal(s.Bytes(), &pr); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if inRange(pr.At, from, to) {
+			rs = append(rs, pr)
+		}
+	}
+	return rs, s.Err()
+}
+
+// inRange gets whether t is from time from (inclusive) to time to (exclusive), where zero times are open ends.
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
+
+// WriteCSV writes rs to w as CSV, with a header row.
+func WriteCSV(w io.Writer, rs []list.PlayRecord) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"time", "hash", "payload"}); err != nil {
+		return err
+	}
+	for _, r := range rs {
+		if err := cw.Write([]string{r.At.Format(time.RFC3339), r.Hash, r.Payload}); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes rs to w as a JSON array.
+func WriteJSON(w io.Writer, rs []list.PlayRecord) error {
+	if rs == nil {
+		rs = []list.PlayRecord{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rs)
+}
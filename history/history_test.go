@@ -0,0 +1,82 @@
+package history_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/history"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// TestFile_Query checks that records appended to a File come back out of time-range queries, and survive reopening.
+func TestFile_Query(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "plays.log")
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	records := []list.PlayRecord{
+		{At: start, Hash: "a", Payload: "a.mp3"},
+		{At: start.Add(time.Hour), Hash: "b", Payload: "b, with a comma.mp3"},
+		{At: start.Add(2 * time.Hour), Hash: "a", Payload: "a.mp3"},
+	}
+
+	for i, r := range records {
+		// Reopening between appends checks that the log is appended to, not replaced.
+		f, err := history.Open(path)
+		if err != nil {
+			t.Fatalf("couldn't open log: %v", err)
+		}
+		if err := f.Append(r); err != nil {
+			t.Fatalf("couldn't append record %d: %v", i, err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatalf("couldn't close log: %v", err)
+		}
+	}
+
+	f, err := history.Open(path)
+	if err != nil {
+		t.Fatalf("couldn't open log: %v", err)
+	}
+	defer f.Close()
+
+	cases := []struct {
+		name     string
+		from, to time.Time
+		want     []string
+	}{
+		{"all", time.Time{}, time.Time{}, []string{"a", "b", "a"}},
+		{"from", start.Add(time.Hour), time.Time{}, []string{"b", "a"}},
+		{"to", time.Time{}, start.Add(time.Hour), []string{"a"}},
+		{"empty", start.Add(time.Minute), start.Add(time.Minute * 2), nil},
+	}
+	for _, c := range cases {
+		rs, err := f.Query(c.from, c.to)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", c.name, err)
+			continue
+		}
+		var got []string
+		for _, r := range rs {
+			got = append(got, r.Hash)
+		}
+		if len(got) != len(c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != c.want[i] {
+				t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+				break
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := history.WriteCSV(&buf, records[1:2]); err != nil {
+		t.Fatalf("couldn't write CSV: %v", err)
+	}
+	if got, want := buf.String(), "time,hash,payload\n2020-01-01T13:00:00Z,b,\"b, with a comma.mp3\"\n"; got != want {
+		t.Errorf("CSV: got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,203 @@
+// Package icy pushes the selected track's title to an Icecast or Shoutcast server's metadata admin endpoint.
+// This lets stream listeners see correct titles without running a separate metadata bridge.
+package icy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// Flavour is the type of supported streaming server flavours.
+type Flavour int
+
+const (
+	// Icecast is an Icecast 2 server, updated through /admin/metadata with HTTP basic auth.
+	Icecast Flavour = iota
+	// Shoutcast is a Shoutcast (v1-compatible) server, updated through /admin.cgi with a password parameter.
+	Shoutcast
+)
+
+// ParseFlavour tries to parse a Flavour from a string.
+// The empty string is treated as Icecast.
+func ParseFlavour(s string) (Flavour, error) {
+	switch strings.ToLower(s) {
+	case "", "icecast":
+		return Icecast, nil
+	case "shoutcast":
+		return Shoutcast, nil
+	default:
+		return Icecast, fmt.Errorf("invalid icy server flavour: %s", s)
+	}
+}
+
+// Target describes the streaming server to which a Pusher sends metadata.
+type Target struct {
+	// Flavour is the type of streaming server.
+	Flavour Flavour
+	// URL is the base URL of the server, for example http://localhost:8000.
+	URL string
+	// Mount is the mount point to update (Icecast only), for example /live.
+	Mount string
+	// User is the admin username (Icecast only).
+	User string
+	// Password is the admin password.
+	Password string
+}
+
+// Pusher follows a list and pushes the selected track's title to a Target whenever it changes.
+type Pusher struct {
+	// log is the Pusher's logger.
+	log *log.Logger
+
+	// target is the streaming server being updated.
+	target Target
+
+	// client is the controller Client the Pusher uses to follow the list.
+	client *controller.Client
+
+	// mirror is the Pusher's view of the list.
+	mirror *list.Mirror
+
+	// http is the HTTP client used to push updates.
+	http *http.Client
+
+	// onPush, if non-nil, is called with the outcome of every push.
+	onPush func(err error)
+}
+
+// New creates a new Pusher for a yaps list.
+func New(l *log.Logger, target Target, client *controller.Client) *Pusher {
+	return &Pusher{
+		log:    l,
+		target: target,
+		client: client,
+		mirror: list.NewMirror(),
+		http:   &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// SetPushHook sets a function to be called, on the Pusher's pushing goroutine, with the error from every push, or nil
+// if the push worked.
+// It must be called before Run.
+func (p *Pusher) SetPushHook(f func(err error)) {
+	p.onPush = f
+}
+
+// Run pushes metadata until ctx is cancelled or the controller shuts down.
+//
+// Pushes happen on a goroutine of their own, as the list can't broadcast to anyone until the Pusher takes each
+// broadcast, and the streaming server may be slow or down.
+// If titles change faster than they can be pushed, only the latest waiting title gets pushed.
+func (p *Pusher) Run(ctx context.Context) error {
+	titles := make(chan string, 1)
+	done := make(chan struct{})
+	go func() {
+		p.pushAll(ctx, titles)
+		close(done)
+	}()
+	defer func() {
+		close(titles)
+		<-done
+	}()
+
+	return list.Follow(ctx, p.client, p.mirror, func(_ interface{}, selChanged bool) {
+		if !selChanged {
+			return
+		}
+		_, item := p.mirror.Selection()
+		if item == nil || item.Type() != list.ItemTrack {
+			return
+		}
+		offer(titles, Title(*item))
+	})
+}
+
+// offer puts title on titles, replacing any title still waiting there.
+// titles must have a buffer of one, and offer must be its only sender.
+func offer(titles chan string, title string) {
+	select {
+	case <-titles:
+	default:
+	}
+	titles <- title
+}
+
+// pushAll pushes each title from titles until it closes.
+func (p *Pusher) pushAll(ctx context.Context, titles <-chan string) {
+	for title := range titles {
+		err := p.push(ctx, title)
+		if err != nil {
+			p.log.Println("couldn't push metadata:", err)
+		}
+		if p.onPush != nil {
+			p.onPush(err)
+		}
+	}
+}
+
+// push sends title to the Pusher's target.
+func (p *Pusher) push(ctx context.Context, title string) error {
+	rq, err := p.request(ctx, title)
+	if err != nil {
+		return err
+	}
+
+	rs, err := p.http.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+
+	if rs.StatusCode != http.StatusOK {
+		return fmt.Errorf("metadata update for %q got status %s", title, rs.Status)
+	}
+	p.log.Printf("pushed title %q\n", title)
+	return nil
+}
+
+// request builds the metadata update request for title.
+func (p *Pusher) request(ctx context.Context, title string) (*http.Request, error) {
+	u, err := url.Parse(p.target.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	q := url.Values{}
+	q.Set("mode", "updinfo")
+	q.Set("song", title)
+
+	switch p.target.Flavour {
+	case Shoutcast:
+		u.Path = path.Join(u.Path, "admin.cgi")
+		q.Set("pass", p.target.Password)
+	default:
+		u.Path = path.Join(u.Path, "admin", "metadata")
+		q.Set("mount", p.target.Mount)
+	}
+	u.RawQuery = q.Encode()
+
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if p.target.Flavour == Icecast {
+		rq.SetBasicAuth(p.target.User, p.target.Password)
+	}
+	return rq, nil
+}
+
+// Title works out the stream title for item.
+// Track payloads are paths, so this is the file name less any extension.
+func Title(item list.Item) string {
+	base := path.Base(strings.ReplaceAll(item.Payload(), `\`, "/"))
+	return strings.TrimSuffix(base, path.Ext(base))
+}
@@ -0,0 +1,131 @@
+package icy
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// TestTitle tests that Title takes the file name, less its extension, from track paths of either slash.
+func TestTitle(t *testing.T) {
+	cases := []struct {
+		payload, want string
+	}{
+		{"/music/Artist - Song.mp3", "Artist - Song"},
+		{`C:\music\Artist - Song.flac`, "Artist - Song"},
+		{"no-extension", "no-extension"},
+		{"/music/v1.2 remix.ogg", "v1.2 remix"},
+	}
+	for _, c := range cases {
+		if got := Title(*list.NewTrack("h", c.payload)); got != c.want {
+			t.Errorf("Title(%q) = %q, want %q", c.payload, got, c.want)
+		}
+	}
+}
+
+// TestPusher_request tests that requests go to the right endpoint, with the right credentials, for each flavour.
+func TestPusher_request(t *testing.T) {
+	cases := []struct {
+		target   Target
+		want     string
+		wantAuth bool
+	}{
+		{
+			Target{Flavour: Icecast, URL: "http://localhost:8000", Mount: "/live", User: "admin", Password: "hackme"},
+			"http://localhost:8000/admin/metadata?mode=updinfo&mount=%2Flive&song=A+%26+B",
+			true,
+		},
+		{
+			Target{Flavour: Shoutcast, URL: "http://localhost:8000/sc", Password: "hackme"},
+			"http://localhost:8000/sc/admin.cgi?mode=updinfo&pass=hackme&song=A+%26+B",
+			false,
+		},
+	}
+	for _, c := range cases {
+		p := New(log.New(io.Discard, "", 0), c.target, nil)
+		rq, err := p.request(context.Background(), "A & B")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		if got := rq.URL.String(); got != c.want {
+			t.Errorf("URL = %q, want %q", got, c.want)
+		}
+		user, pass, ok := rq.BasicAuth()
+		if ok != c.wantAuth || (ok && (user != c.target.User || pass != c.target.Password)) {
+			t.Errorf("basic auth = %q, %q, %v; want it only for Icecast", user, pass, ok)
+		}
+	}
+}
+
+// TestPusher_request_badURL tests that request fails on target URLs that don't parse.
+func TestPusher_request_badURL(t *testing.T) {
+	p := New(log.New(io.Discard, "", 0), Target{URL: "http://[::1"}, nil)
+	if _, err := p.request(context.Background(), "x"); err == nil {
+		t.Error("request with bad URL succeeded")
+	}
+}
+
+// TestOffer tests that offer never blocks, and leaves only the latest title waiting.
+func TestOffer(t *testing.T) {
+	titles := make(chan string, 1)
+	for _, title := range []string{"a", "b", "c"} {
+		offer(titles, title)
+	}
+	if got := <-titles; got != "c" {
+		t.Errorf("waiting title = %q, want %q", got, "c")
+	}
+	select {
+	case got := <-titles:
+		t.Errorf("another title %q was waiting", got)
+	default:
+	}
+}
+
+// TestPusher_pushAll tests that titles offered while a push is stuck don't queue up: once it finishes, only the latest
+// is pushed.
+func TestPusher_pushAll(t *testing.T) {
+	got := make(chan string)
+	release := make(chan struct{})
+	hs := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		got <- r.URL.Query().Get("song")
+		<-release
+	}))
+	defer hs.Close()
+
+	p := New(log.New(io.Discard, "", 0), Target{URL: hs.URL}, nil)
+	pushed := make(chan error)
+	p.SetPushHook(func(err error) { pushed <- err })
+
+	titles := make(chan string, 1)
+	done := make(chan struct{})
+	go func() {
+		p.pushAll(context.Background(), titles)
+		close(done)
+	}()
+
+	offer(titles, "a")
+	if title := <-got; title != "a" {
+		t.Fatalf("pushed %q, want %q", title, "a")
+	}
+	// The push of "a" is stuck, so these wait, and "c" replaces "b".
+	offer(titles, "b")
+	offer(titles, "c")
+	close(release)
+	if err := <-pushed; err != nil {
+		t.Errorf("push failed: %v", err)
+	}
+	if title := <-got; title != "c" {
+		t.Errorf("pushed %q, want %q", title, "c")
+	}
+	if err := <-pushed; err != nil {
+		t.Errorf("push failed: %v", err)
+	}
+
+	close(titles)
+	<-done
+}
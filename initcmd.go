@@ -0,0 +1,398 @@
+package main
+
+// File initcmd.go contains the 'init' subcommand, which asks about a new station and writes a yaps.toml for it.
+//
+// The wizard only asks about what most stations need to decide on day one: where the net server listens, the list and
+// where it keeps its state, the player, and who may log in.
+// Everything else keeps its default; 'yaps config example' prints every setting, with its documentation.
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/MattWindsor91/yaps/config"
+	"github.com/MattWindsor91/yaps/store"
+)
+
+// initUsage is the usage message of the 'init' subcommand.
+const initUsage = "usage: init [-force] [yaps.toml]"
+
+// runInit asks about the station on stdin, then writes a config for it.
+func runInit(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	force := fs.Bool("force", false, "overwrite the config if it already exists")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	cfile := "yaps.toml"
+	switch fs.NArg() {
+	case 0:
+	case 1:
+		cfile = fs.Arg(0)
+	default:
+		return errors.New(initUsage)
+	}
+	if _, err := os.Stat(cfile); err == nil && !*force {
+		return fmt.Errorf("%s already exists; use -force to overwrite it", cfile)
+	}
+	return initConfig(os.Stdin, os.Stdout, cfile)
+}
+
+// initConfig asks about the station on in, writing the questions to out, then writes a config for it to cfile.
+func initConfig(in io.Reader, out io.Writer, cfile string) error {
+	w := wizard{in: bufio.NewReader(in), out: out}
+	ans, err := w.run()
+	if err != nil {
+		return err
+	}
+
+	toml := ans.toml()
+	if err := checkConfig(toml); err != nil {
+		return fmt.Errorf("the answers don't make a valid config (this is a bug): %w", err)
+	}
+	if err := os.WriteFile(cfile, []byte(toml), 0o600); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w.out, "\nWrote %s; 'yaps config check %s' checks it after editing, and 'yaps' starts the server.\n", cfile, cfile)
+	if ans.token != "" {
+		fmt.Fprintf(w.out, "%s logs in with 'login %s'; keep the token secret, or seal it with 'yaps seal-secret'.\n", ans.user, ans.token)
+	}
+	return nil
+}
+
+// checkConfig checks that toml parses as a config, by way of a temporary file.
+func checkConfig(toml string) error {
+	f, err := os.CreateTemp("", "yaps-init-*.toml")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(toml)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	_, err = config.Parse(f.Name())
+	return err
+}
+
+// answers holds the answers to the wizard's questions.
+type answers struct {
+	// net is true if the net server is enabled.
+	net bool
+	// host is the net server's host:port.
+	host string
+	// nowPlaying is the now-playing endpoint's host:port, or empty if it is disabled.
+	nowPlaying string
+	// list is the name of the list.
+	list string
+	// store is the list's store spec.
+	store string
+	// player is the player's host:port, or empty if there is none.
+	player string
+	// snapshots is the snapshot directory, or empty if the list takes none.
+	snapshots string
+	// provider is the auth provider, or empty if clients don't log in.
+	provider string
+	// user and groups are who logs in with token, for the static provider.
+	user   string
+	groups []string
+	token  string
+	// url is the LDAP directory's URL, or the OIDC issuer's.
+	url string
+	// userDN is the LDAP user DN pattern.
+	userDN string
+	// audience is the OIDC audience.
+	audience string
+	// admins is the admin group, or empty if anyone may make admin requests.
+	admins string
+}
+
+// wizard asks questions on in, writing them to out.
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// run asks every question, returning the answers.
+func (w wizard) run() (answers, error) {
+	var (
+		a   answers
+		err error
+	)
+	fmt.Fprintln(w.out, "This asks a few questions, then writes a config for yaps; press enter to take the default in brackets.")
+
+	fmt.Fprintln(w.out, "\nListeners")
+	if a.net, err = w.yesNo("Should clients connect to yaps over the network?", true); err != nil {
+		return a, err
+	}
+	if a.net {
+		if a.host, err = w.ask("Host and port for clients", "localhost:1350", checkHostPort); err != nil {
+			return a, err
+		}
+	}
+	if a.nowPlaying, err = w.ask("Host and port for the now-playing HTTP endpoint (- for none)", "-", optional(checkHostPort)); err != nil {
+		return a, err
+	}
+
+	fmt.Fprintln(w.out, "\nList")
+	if a.list, err = w.ask("Name of the list", "main", checkListName); err != nil {
+		return a, err
+	}
+	if a.store, err = w.ask("Where to keep its state: memory, file:<dir> or sqlite:<path>", "file:state", checkStore); err != nil {
+		return a, err
+	}
+	if a.snapshots, err = w.ask("Directory for nightly snapshots of the list (- for none)", "-", nil); err != nil {
+		return a, err
+	}
+
+	fmt.Fprintln(w.out, "\nPlayer")
+	if a.player, err = w.ask("Host and port of the playd instance playing the list (- for none)", "-", optional(checkHostPort)); err != nil {
+		return a, err
+	}
+
+	fmt.Fprintln(w.out, "\nAuth")
+	if a.provider, err = w.ask("How clients log in: none, static, ldap or oidc", "none", checkProvider); err != nil {
+		return a, err
+	}
+	if err := w.askProvider(&a); err != nil {
+		return a, err
+	}
+	if a.net && a.provider != "" {
+		if a.admins, err = w.ask("Group whose members may make admin requests (- for anyone)", "-", nil); err != nil {
+			return a, err
+		}
+	}
+
+	a.nowPlaying, a.player, a.snapshots, a.admins = dash(a.nowPlaying), dash(a.player), dash(a.snapshots), dash(a.admins)
+	return a, nil
+}
+
+// askProvider asks the questions for a's auth provider.
+func (w wizard) askProvider(a *answers) error {
+	var err error
+	switch a.provider {
+	case "none":
+		a.provider = ""
+	case "static":
+		if a.user, err = w.ask("User name to make a token for", "admin", checkNonEmpty); err != nil {
+			return err
+		}
+		groups, err := w.ask("Groups the user is in, separated by commas", "admins", nil)
+		if err != nil {
+			return err
+		}
+		for _, g := range strings.Split(groups, ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				a.groups = append(a.groups, g)
+			}
+		}
+		bs := make([]byte, 16)
+		if _, err := rand.Read(bs); err != nil {
+			return err
+		}
+		a.token = hex.EncodeToString(bs)
+	case "ldap":
+		if a.url, err = w.ask("URL of the LDAP directory", "ldaps://ldap.example.com", checkNonEmpty); err != nil {
+			return err
+		}
+		if a.userDN, err = w.ask("DN of each user, with %s for the user name", "uid=%s,ou=people,dc=example,dc=com", checkUserDN); err != nil {
+			return err
+		}
+	case "oidc":
+		if a.url, err = w.ask("Issuer URL of the OpenID Connect provider", "https://accounts.example.com", checkNonEmpty); err != nil {
+			return err
+		}
+		if a.audience, err = w.ask("Client ID the provider issues yaps' ID tokens to", "", checkNonEmpty); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ask asks question, with default answer def, until the answer passes check (if not nil).
+// At the end of the input, it takes the default, if it passes.
+func (w wizard) ask(question, def string, check func(string) error) (string, error) {
+	for {
+		if def == "" {
+			fmt.Fprintf(w.out, "%s: ", question)
+		} else {
+			fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+		}
+
+		line, err := w.in.ReadString('\n')
+		eof := errors.Is(err, io.EOF)
+		if err != nil && !eof {
+			return "", err
+		}
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = def
+		}
+		if eof {
+			fmt.Fprintln(w.out)
+		}
+
+		if check == nil {
+			return answer, nil
+		}
+		cerr := check(answer)
+		if cerr == nil {
+			return answer, nil
+		}
+		if eof {
+			return "", fmt.Errorf("%s: %w", question, cerr)
+		}
+		fmt.Fprintf(w.out, "  %v\n", cerr)
+	}
+}
+
+// yesNo asks the yes-or-no question question, with default answer def.
+func (w wizard) yesNo(question string, def bool) (bool, error) {
+	defs := "n"
+	if def {
+		defs = "y"
+	}
+	answer, err := w.ask(question+" (y/n)", defs, func(s string) error {
+		switch strings.ToLower(s) {
+		case "y", "yes", "n", "no":
+			return nil
+		default:
+			return errors.New("answer y or n")
+		}
+	})
+	return strings.HasPrefix(strings.ToLower(answer), "y"), err
+}
+
+// dash gets s, or empty if s is "-".
+func dash(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// optional makes check pass "-" too.
+func optional(check func(string) error) func(string) error {
+	return func(s string) error {
+		if s == "-" {
+			return nil
+		}
+		return check(s)
+	}
+}
+
+// checkNonEmpty checks that s isn't empty.
+func checkNonEmpty(s string) error {
+	if s == "" {
+		return errors.New("this needs an answer")
+	}
+	return nil
+}
+
+// checkHostPort checks that s is a host:port string.
+func checkHostPort(s string) error {
+	if _, _, err := net.SplitHostPort(s); err != nil {
+		return fmt.Errorf("%q isn't host:port: %w", s, err)
+	}
+	return nil
+}
+
+// checkListName checks that s can name a list in any store.
+func checkListName(s string) error {
+	if s == "" || strings.ContainsAny(s, `/\`) || s == "." || s == ".." {
+		return fmt.Errorf("%q can't name a list", s)
+	}
+	return nil
+}
+
+// checkStore checks that s is a store spec of a kind yaps knows.
+func checkStore(s string) error {
+	kind, arg, _ := strings.Cut(s, ":")
+	for _, k := range store.Kinds() {
+		if k != kind {
+			continue
+		}
+		if kind != "memory" && arg == "" {
+			return fmt.Errorf("%s storage needs a path, as '%s:<path>'", kind, kind)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown store %q; yaps knows %s", kind, strings.Join(store.Kinds(), ", "))
+}
+
+// checkProvider checks that s is an auth provider the wizard can set up.
+func checkProvider(s string) error {
+	switch s {
+	case "none", "static", "ldap", "oidc":
+		return nil
+	default:
+		return fmt.Errorf("unknown provider %q", s)
+	}
+}
+
+// checkUserDN checks that s is a DN pattern with a place for the user name.
+func checkUserDN(s string) error {
+	if !strings.Contains(s, "%s") {
+		return errors.New("the DN needs %s where the user name goes")
+	}
+	return nil
+}
+
+// toml gets a as a config file.
+func (a answers) toml() string {
+	var sb strings.Builder
+	fmt.Fprintln(&sb, "# yaps config written by 'yaps init'; 'yaps config example' documents every setting.")
+
+	fmt.Fprintf(&sb, "\n[Net]\nenabled = %t\n", a.net)
+	if a.net {
+		fmt.Fprintf(&sb, "host = %q\n", a.host)
+	}
+	if a.admins != "" {
+		fmt.Fprintf(&sb, "admins = %q\n", a.admins)
+	}
+	fmt.Fprintln(&sb, "log = true")
+
+	if a.nowPlaying != "" {
+		fmt.Fprintf(&sb, "\n[NowPlaying]\nenabled = true\nhost = %q\n", a.nowPlaying)
+	}
+
+	switch a.provider {
+	case "static":
+		fmt.Fprintf(&sb, "\n[Auth]\nprovider = \"static\"\n\n[[Auth.Tokens]]\ntoken = %q\nuser = %q\ngroups = %s\n",
+			a.token, a.user, tomlStrings(a.groups))
+	case "ldap":
+		fmt.Fprintf(&sb, "\n[Auth]\nprovider = \"ldap\"\n\n[Auth.LDAP]\nurl = %q\nuserdn = %q\n", a.url, a.userDN)
+	case "oidc":
+		fmt.Fprintf(&sb, "\n[Auth]\nprovider = \"oidc\"\n\n[Auth.OIDC]\nissuer = %q\naudience = %q\n", a.url, a.audience)
+	}
+
+	fmt.Fprintf(&sb, "\n[[Lists]]\nname = %q\nstore = %q\n", a.list, a.store)
+	if a.player != "" {
+		fmt.Fprintf(&sb, "player = %q\n", a.player)
+	}
+	if a.snapshots != "" {
+		fmt.Fprintf(&sb, "\n[Lists.Snapshots]\ndir = %q\nat = [\"03:30\"]\nkeep = 14\nlog = true\n", a.snapshots)
+	}
+	return sb.String()
+}
+
+// tomlStrings formats ss as a TOML array of strings.
+func tomlStrings(ss []string) string {
+	qs := make([]string, len(ss))
+	for i, s := range ss {
+		qs[i] = fmt.Sprintf("%q", s)
+	}
+	return "[" + strings.Join(qs, ", ") + "]"
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/config"
+)
+
+// Test_initConfig_defaults checks that taking every default, by giving no input at all, writes a config that parses
+// with those defaults.
+func Test_initConfig_defaults(t *testing.T) {
+	conf, out := runWizard(t, "")
+	if !conf.Net.Enabled || conf.Net.Host != "localhost:1350" {
+		t.Errorf("net: got enabled %v on %q, want enabled on localhost:1350", conf.Net.Enabled, conf.Net.Host)
+	}
+	if conf.NowPlaying.Enabled {
+		t.Error("now-playing endpoint enabled by default")
+	}
+	if len(conf.Lists) != 1 || conf.Lists[0].Name != "main" || conf.Lists[0].Store != "file:state" || conf.Lists[0].Player != "" {
+		t.Errorf("lists: got %+v, want one called main in file:state without a player", conf.Lists)
+	}
+	if conf.Auth.Provider != "" {
+		t.Errorf("auth provider: got %q, want none", conf.Auth.Provider)
+	}
+	if strings.Contains(out, "logs in with") {
+		t.Errorf("output mentions a token without static auth:\n%s", out)
+	}
+}
+
+// Test_initConfig_answers checks that the wizard asks again after each invalid answer, saying why, and writes a config
+// that parses with the valid answers.
+func Test_initConfig_answers(t *testing.T) {
+	answers := []string{
+		"maybe", "y",
+		"localhost", "0.0.0.0:1400",
+		"localhost:8080",
+		"../main", "radio",
+		"redis:localhost", "sqlite:", "sqlite:radio.db",
+		"snapshots",
+		"-",
+		"kerberos", "static",
+		"presenter",
+		"ops, presenters,",
+		"ops",
+	}
+	conf, out := runWizard(t, strings.Join(answers, "\n")+"\n")
+
+	for _, complaint := range []string{
+		"answer y or n",
+		`"localhost" isn't host:port`,
+		`"../main" can't name a list`,
+		`unknown store "redis"`,
+		"sqlite storage needs a path",
+		`unknown provider "kerberos"`,
+	} {
+		if !strings.Contains(out, complaint) {
+			t.Errorf("output doesn't complain %q:\n%s", complaint, out)
+		}
+	}
+
+	if !conf.Net.Enabled || conf.Net.Host != "0.0.0.0:1400" || conf.Net.Admins != "ops" {
+		t.Errorf("net: got %+v, want enabled on 0.0.0.0:1400 with admins ops", conf.Net)
+	}
+	if !conf.NowPlaying.Enabled || conf.NowPlaying.Host != "localhost:8080" {
+		t.Errorf("now-playing: got %+v, want enabled on localhost:8080", conf.NowPlaying)
+	}
+	if len(conf.Lists) != 1 {
+		t.Fatalf("lists: got %d, want 1", len(conf.Lists))
+	}
+	if l := conf.Lists[0]; l.Name != "radio" || l.Store != "sqlite:radio.db" || l.Snapshots.Dir != "snapshots" {
+		t.Errorf("list: got %+v, want radio in sqlite:radio.db with snapshots in snapshots", l)
+	}
+
+	if conf.Auth.Provider != "static" || len(conf.Auth.Tokens) != 1 {
+		t.Fatalf("auth: got %+v, want one static token", conf.Auth)
+	}
+	tok := conf.Auth.Tokens[0]
+	if tok.User != "presenter" || fmt.Sprint(tok.Groups) != "[ops presenters]" {
+		t.Errorf("token: got user %q in %v, want presenter in [ops presenters]", tok.User, tok.Groups)
+	}
+	if !regexp.MustCompile(`^[0-9a-f]{32}$`).MatchString(string(tok.Token)) {
+		t.Errorf("token: got %q, want 32 hex digits", tok.Token)
+	}
+	if !strings.Contains(out, "login "+string(tok.Token)) {
+		t.Errorf("output doesn't tell how to log in with the token:\n%s", out)
+	}
+}
+
+// Test_initConfig_invalidAtEnd checks that an invalid answer at the end of the input, where the wizard can't ask
+// again, is an error, and writes nothing.
+func Test_initConfig_invalidAtEnd(t *testing.T) {
+	cfile := filepath.Join(t.TempDir(), "yaps.toml")
+	var out strings.Builder
+	err := initConfig(strings.NewReader("n\n-\nradio\nredis:localhost"), &out, cfile)
+	if err == nil || !strings.Contains(err.Error(), `unknown store "redis"`) {
+		t.Errorf("got error %v, want one about the store", err)
+	}
+	if _, perr := config.Parse(cfile); perr == nil {
+		t.Error("wrote a config despite the error")
+	}
+}
+
+// runWizard runs the wizard on input, then parses the config it writes, returning it and the wizard's output.
+func runWizard(t *testing.T, input string) (config.Config, string) {
+	t.Helper()
+	cfile := filepath.Join(t.TempDir(), "yaps.toml")
+	var out strings.Builder
+	if err := initConfig(strings.NewReader(input), &out, cfile); err != nil {
+		t.Fatalf("wizard failed: %v\n%s", err, out.String())
+	}
+	conf, err := config.Parse(cfile)
+	if err != nil {
+		t.Fatalf("written config doesn't parse: %v", err)
+	}
+	return conf, out.String()
+}
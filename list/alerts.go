@@ -0,0 +1,250 @@
+package list
+
+// File alerts.go contains the List logic for operational alerts: problems, such as a storage failure or an
+// unreachable mount, that every client should hear about.
+//
+// Each alert has a key naming the problem, so that raising the same problem again doesn't repeat it:
+// it just counts the repeat.
+// Each key is raised in broadcasts at most once per alert interval, and cleared in broadcasts only if it was raised in
+// one; changes inside the interval are held back, but clients can still see them by asking for the active alerts.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+const (
+	// AlertKeyStorage is the key of alerts about failures to save the list's state.
+	AlertKeyStorage = "storage"
+	// AlertKeyPlayLog is the key of alerts about failures to log plays.
+	AlertKeyPlayLog = "playlog"
+)
+
+// AlertSeverity is the type of alert severities.
+type AlertSeverity int
+
+const (
+	// AlertInfo is the severity of alerts that need no action.
+	AlertInfo AlertSeverity = iota
+	// AlertWarning is the severity of alerts about something that may soon go wrong.
+	AlertWarning
+	// AlertError is the severity of alerts about something that has gone wrong.
+	AlertError
+	// AlertCritical is the severity of alerts about something that has gone wrong on air.
+	AlertCritical
+)
+
+// String gets the Bifrost name of an AlertSeverity.
+func (s AlertSeverity) String() string {
+	switch s {
+	case AlertInfo:
+		return "info"
+	case AlertWarning:
+		return "warning"
+	case AlertError:
+		return "error"
+	case AlertCritical:
+		return "critical"
+	default:
+		return "?unknown?"
+	}
+}
+
+// ParseAlertSeverity tries to parse an AlertSeverity from its Bifrost name.
+func ParseAlertSeverity(s string) (AlertSeverity, error) {
+	switch s {
+	case "info":
+		return AlertInfo, nil
+	case "warning":
+		return AlertWarning, nil
+	case "error":
+		return AlertError, nil
+	case "critical":
+		return AlertCritical, nil
+	default:
+		return AlertInfo, fmt.Errorf("invalid alert severity")
+	}
+}
+
+// alert is the List's record of an active alert.
+type alert struct {
+	// AlertResponse is how the alert is announced.
+	AlertResponse
+	// announced is true if the alert has been broadcast in some form since it was raised.
+	announced bool
+}
+
+// SetAlertInterval sets the shortest time l leaves between broadcasts about the same alert key; 0 turns the limit
+// off.
+func (l *List) SetAlertInterval(interval time.Duration) {
+	l.alertInterval = interval
+}
+
+// RaiseAlert raises, at time now, the alert with key key, severity sev, and message msg.
+// It returns the alert's announcement, and whether to broadcast it: repeats of an active alert aren't broadcast,
+// and nor is anything about a key broadcast within the alert interval.
+func (l *List) RaiseAlert(key string, sev AlertSeverity, msg string, now time.Time) (AlertResponse, bool) {
+	a, ok := l.alerts[key]
+	if ok && a.Severity == sev && a.Message == msg {
+		a.Count++
+		return a.AlertResponse, false
+	}
+	if !ok {
+		a = &alert{AlertResponse: AlertResponse{Key: key, Since: now}}
+		l.alerts[key] = a
+	}
+	a.Severity = sev
+	a.Message = msg
+	a.Count++
+
+	ok = l.mayAnnounceAlert(key, now)
+	a.announced = a.announced || ok
+	return a.AlertResponse, ok
+}
+
+// ClearAlert clears the alert with key key.
+// It returns whether to broadcast the clearance: only alerts that were broadcast have their clearance broadcast, but
+// those always do, so that clients don't think them still active.
+func (l *List) ClearAlert(key string) bool {
+	a, ok := l.alerts[key]
+	if !ok {
+		return false
+	}
+	delete(l.alerts, key)
+	return a.announced
+}
+
+// mayAnnounceAlert checks, at time now, whether l may broadcast about key, and if so notes that it did.
+func (l *List) mayAnnounceAlert(key string, now time.Time) bool {
+	if last, ok := l.alertSent[key]; ok && now.Sub(last) < l.alertInterval {
+		return false
+	}
+	l.alertSent[key] = now
+	return true
+}
+
+// Alerts gets the active alerts, in key order.
+func (l *List) Alerts() []AlertResponse {
+	rs := make([]AlertResponse, 0, len(l.alerts))
+	for _, a := range l.alerts {
+		rs = append(rs, a.AlertResponse)
+	}
+	sort.Slice(rs, func(i, j int) bool { return rs[i].Key < rs[j].Key })
+	return rs
+}
+
+// raiseAlert raises an alert now, broadcasting it through bcastCb if need be.
+func (l *List) raiseAlert(bcastCb controller.ResponseCb, key string, sev AlertSeverity, msg string) {
+	if r, ok := l.RaiseAlert(key, sev, msg, l.clock.Now()); ok {
+		bcastCb(r)
+	}
+}
+
+// clearAlert clears an alert, broadcasting the clearance through bcastCb if need be.
+func (l *List) clearAlert(bcastCb controller.ResponseCb, key string) {
+	if l.ClearAlert(key) {
+		bcastCb(AlertClearedResponse{Key: key})
+	}
+}
+
+// handleRaiseAlertRequest handles an alert raised for List l.
+func (l *List) handleRaiseAlertRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b RaiseAlertRequest) error {
+	l.raiseAlert(bcastCb, b.Key, b.Severity, b.Message)
+	return nil
+}
+
+// handleClearAlertRequest handles an alert cleared for List l.
+func (l *List) handleClearAlertRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b ClearAlertRequest) error {
+	l.clearAlert(bcastCb, b.Key)
+	return nil
+}
+
+// handleAlertsRequest handles an active alerts query for List l.
+func (l *List) handleAlertsRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b AlertsRequest) error {
+	for _, r := range l.Alerts() {
+		replyCb(r)
+	}
+	return nil
+}
+
+// Alerter raises and clears alerts on a List on behalf of other parts of yaps, such as the player link.
+// Its methods never block, so they are safe to call from anywhere.
+type Alerter struct {
+	// client is the Alerter's client of the List's Controller.
+	client *controller.Client
+
+	// mu guards pending.
+	mu sync.Mutex
+	// pending holds the requests waiting to be sent, oldest first.
+	pending []interface{}
+	// wake receives whenever pending gains a request.
+	wake chan struct{}
+}
+
+// NewAlerter creates an Alerter sending alerts through client, which must be a client of a List Controller.
+// The Alerter sends nothing until Run is called.
+func NewAlerter(client *controller.Client) *Alerter {
+	return &Alerter{client: client, wake: make(chan struct{}, 1)}
+}
+
+// Raise raises the alert with key key, severity sev, and message msg.
+func (a *Alerter) Raise(key string, sev AlertSeverity, msg string) {
+	a.queue(RaiseAlertRequest{Key: key, Severity: sev, Message: msg})
+}
+
+// Clear clears the alert with key key, if it is active.
+func (a *Alerter) Clear(key string) {
+	a.queue(ClearAlertRequest{Key: key})
+}
+
+// queue adds rbody to the pending requests, and wakes Run.
+func (a *Alerter) queue(rbody interface{}) {
+	a.mu.Lock()
+	a.pending = append(a.pending, rbody)
+	a.mu.Unlock()
+
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends alerts until ctx is cancelled or the Controller hangs up.
+// It hangs up the Alerter's client when it returns.
+func (a *Alerter) Run(ctx context.Context) error {
+	// The client receives broadcasts too, and must keep draining them.
+	go func() {
+		for range a.client.Rx {
+		}
+	}()
+	// Closing our request channel is how we hang up on the Controller.
+	defer close(a.client.Tx)
+
+	for {
+		select {
+		case <-a.wake:
+			a.mu.Lock()
+			pending := a.pending
+			a.pending = nil
+			a.mu.Unlock()
+
+			for _, rbody := range pending {
+				err := a.client.Call(ctx, rbody)
+				if errors.Is(err, controller.ErrControllerShutDown) {
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
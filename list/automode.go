@@ -2,11 +2,12 @@ package list
 
 // This file contains AutoMode, which enumerates over autoselection modes.
 // It also contains functions for converting AutoModes to and from strings.
-// For the actual autoselection logic, see 'list.go'.
+// For the policies behind each mode, see 'policy.go'.
 
 import "fmt"
 
 // AutoMode is the type of autoselection modes.
+// Each names a Policy: either one of the built-in modes below, or one returned by RegisterPolicy.
 type AutoMode int
 
 const (
@@ -18,40 +19,30 @@ const (
 	AutoNext
 	// AutoShuffle is a selection mode that selects the next track in a pseudorandom permuation when a track ends.
 	AutoShuffle
-	// FirstAuto points to the first AutoMode constant.
-	FirstAuto = AutoOff
-	// LastAuto points to the last AutoMode constant.
-	LastAuto = AutoNext
 )
 
 // String gets the Bifrost name of an AutoMode as a string.
 func (a AutoMode) String() string {
-	switch a {
-	case AutoOff:
-		return "off"
-	case AutoDrop:
-		return "drop"
-	case AutoNext:
-		return "next"
-	case AutoShuffle:
-		return "shuffle"
-	default:
-		return "?unknown?"
+	if p, ok := policyOf(a); ok {
+		return p.name
 	}
+	return "?unknown?"
+}
+
+// known checks whether a names a built-in or registered Policy.
+func (a AutoMode) known() bool {
+	_, ok := policyOf(a)
+	return ok
 }
 
 // ParseAutoMode tries to parse an AutoMode from a string.
 func ParseAutoMode(s string) (AutoMode, error) {
-	switch s {
-	case "off":
-		return AutoOff, nil
-	case "drop":
-		return AutoDrop, nil
-	case "next":
-		return AutoNext, nil
-	case "shuffle":
-		return AutoShuffle, nil
-	default:
-		return AutoOff, fmt.Errorf("invalid automode")
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+	for i, p := range policies {
+		if p.name == s {
+			return AutoMode(i), nil
+		}
 	}
+	return AutoOff, fmt.Errorf("invalid automode")
 }
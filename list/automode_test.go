@@ -24,7 +24,7 @@ func TestAutoModeString(t *testing.T) {
 		{list.AutoDrop, "drop"},
 		{list.AutoNext, "next"},
 		{list.AutoShuffle, "shuffle"},
-		{list.AutoShuffle + 1, "?unknown?"},
+		{list.AutoMode(-1), "?unknown?"},
 	}
 
 	for _, c := range cases {
@@ -91,12 +91,12 @@ func ExampleParseAutoMode() {
 
 // TestAutoModeParseIdempotence checks that parsing the string version of an AutoMode is the identity.
 func TestAutoModeParseIdempotence(t *testing.T) {
-	for i := list.FirstAuto; i <= list.LastAuto; i++ {
-		a, e := list.ParseAutoMode(i.String())
+	for _, name := range list.Policies() {
+		a, e := list.ParseAutoMode(name)
 		if e != nil {
 			t.Errorf("unexpected parse error: %v", e)
-		} else if a != i {
-			t.Errorf("%v parsed as %v", i, a)
+		} else if g := a.String(); g != name {
+			t.Errorf("%s parsed as %v", name, g)
 		}
 	}
 }
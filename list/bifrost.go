@@ -2,48 +2,89 @@ package list
 
 // File list/bifrost.go implements BifrostParser for List.
 // - See `comm/bifrost.go` for the common marshalling logic.
+// - Most parsers and emitters are generated from 'protocol.json' into 'bifrost_gen.go';
+//   this file holds the messages marked 'custom' there, which don't map directly onto one struct.
+// - The generated bifrostSchema describes the messages for 'describe' (see `controller/describe.go`).
+
+//go:generate go run ../bifrostgen -go bifrost_gen.go -doc PROTOCOL.md protocol.json
 
 import (
 	"fmt"
 	"strconv"
+	"time"
 
 	"github.com/UniversityRadioYork/bifrost-go/message"
 
+	"github.com/MattWindsor91/yaps/bifrost"
 	"github.com/MattWindsor91/yaps/controller"
 )
 
+// BifrostSchema describes the list's Bifrost requests and responses.
+func (l *List) BifrostSchema() controller.Schema {
+	return bifrostSchema
+}
+
 // ParseBifrostRequest handles Bifrost parsing for List controllers.
 func (l *List) ParseBifrostRequest(word string, args []string) (interface{}, error) {
-	switch word {
-	case "auto":
-		return parseAutoMessage(args)
-	case "floadl":
-		return parseFloadlMessage(args)
-	case "sel":
-		return parseSelMessage(args)
-	case "tloadl":
-		return parseTloadlMessage(args)
-	default:
-		return nil, controller.UnknownWord(word)
+	return parseListRequest(word, args)
+}
+
+// parseListRequest parses a list request with word word and arguments args, which may carry a version.
+func parseListRequest(word string, args []string) (interface{}, error) {
+	if n, ok := versionedArity[word]; ok && len(args) == n+1 {
+		return parseVersionedMessage(word, args)
 	}
+
+	return parseRequest(word, args)
 }
 
 //
 // Request parsers
 //
 
-// parseAutoMessage tries to parse an 'auto' message.
-func parseAutoMessage(args []string) (interface{}, error) {
-	if len(args) != 1 {
-		return nil, fmt.Errorf("bad arity")
+// parseVersionedMessage tries to parse a message with word word and arguments args, the last of which is a version.
+func parseVersionedMessage(word string, args []string) (interface{}, error) {
+	n := len(args) - 1
+
+	var version uint64
+	if err := bifrost.Args(args).Uint(n, &version).Err(); err != nil {
+		return nil, err
+	}
+
+	rq, err := parseListRequest(word, args[:n])
+	if err != nil {
+		return nil, err
 	}
+	return VersionedRequest{Version: version, Request: rq}, nil
+}
 
-	amode, err := ParseAutoMode(args[0])
+// parseDryrunMessage tries to parse a 'dryrun' message, which wraps the word and arguments of another request.
+func parseDryrunMessage(args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, bifrost.WithCode(bifrost.CodeArity, fmt.Errorf("dryrun needs a request to check"))
+	}
+	rq, err := parseListRequest(args[0], args[1:])
 	if err != nil {
 		return nil, err
 	}
+	return DryRunRequest{Request: rq}, nil
+}
 
-	return SetAutoModeRequest{AutoMode: amode}, nil
+// parseCheckMessage tries to parse a 'check' message, which takes any number of hashes, but at least one.
+func parseCheckMessage(args []string) (interface{}, error) {
+	n := len(args)
+	if n == 0 {
+		n = 1
+	}
+	rq := CheckHashesRequest{Hashes: make([]string, n)}
+	v := bifrost.Args(args)
+	for i := range rq.Hashes {
+		v.Hash(i, &rq.Hashes[i])
+	}
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+	return rq, nil
 }
 
 // parseFloadlMessage tries to parse a 'floadl' message.
@@ -51,19 +92,24 @@ func parseFloadlMessage(args []string) (interface{}, error) {
 	return parseItemAddMessage(NewTrack, args)
 }
 
-// parseSelMessage tries to parse a 'sel' message.
-func parseSelMessage(args []string) (interface{}, error) {
-	if len(args) != 2 {
-		return nil, fmt.Errorf("bad arity")
-	}
-
-	index, err := strconv.Atoi(args[0])
+// parseIcatMessage tries to parse an 'icat' message.
+// With two arguments it queries an item's category; with three, it sets it.
+func parseIcatMessage(args []string) (interface{}, error) {
+	var rq SetItemCategoryRequest
+	err := bifrost.Args(args).
+		Int(0, &rq.Index).
+		Hash(1, &rq.Hash).
+		Optional().
+		String(2, &rq.Category).
+		Err()
 	if err != nil {
 		return nil, err
 	}
-	hash := args[1]
 
-	return SetSelectRequest{Index: index, Hash: hash}, nil
+	if len(args) == 2 {
+		return GetItemCategoryRequest{Index: rq.Index, Hash: rq.Hash}, nil
+	}
+	return rq, nil
 }
 
 // parseTloadlMessage tries to parse a 'tloadl' message.
@@ -71,19 +117,41 @@ func parseTloadlMessage(args []string) (interface{}, error) {
 	return parseItemAddMessage(NewText, args)
 }
 
+// parseSfloadlMessage tries to parse an 'sfloadl' message.
+func parseSfloadlMessage(args []string) (interface{}, error) {
+	return parseScratchItemAddMessage(NewTrack, args)
+}
+
+// parseStloadlMessage tries to parse an 'stloadl' message.
+func parseStloadlMessage(args []string) (interface{}, error) {
+	return parseScratchItemAddMessage(NewText, args)
+}
+
+// parseScratchItemAddMessage tries to parse an 's*loadl' message, whose item type has constructor con.
+// Scratchpad items take the same arguments as list items.
+func parseScratchItemAddMessage(con func(string, string) *Item, args []string) (interface{}, error) {
+	rq, err := parseItemAddMessage(con, args)
+	if err != nil {
+		return nil, err
+	}
+	return AddScratchItemRequest(rq.(AddItemRequest)), nil
+}
+
 // parseItemAddMessage tries to parse a '*loadl' message with arguments args.
 // We have already decided which type of item we're adding and stored its constructor in con.
 func parseItemAddMessage(con func(string, string) *Item, args []string) (interface{}, error) {
-	if len(args) != 3 {
-		return nil, fmt.Errorf("bad arity")
-	}
-
-	index, err := strconv.Atoi(args[0])
+	var (
+		index         int
+		hash, payload string
+	)
+	err := bifrost.Args(args).
+		Int(0, &index).
+		Hash(1, &hash).
+		String(2, &payload).
+		Err()
 	if err != nil {
 		return nil, err
 	}
-	hash := args[1]
-	payload := args[2]
 
 	item := con(hash, payload)
 	return AddItemRequest{Index: index, Item: *item}, nil
@@ -95,32 +163,15 @@ func parseItemAddMessage(con func(string, string) *Item, args []string) (interfa
 
 // EmitBifrostResponse handles a controller response with tag tag and body rbody.
 // It sends response messages to msgTx.
-func (l *List) EmitBifrostResponse(tag string, rbody interface{}, msgTx chan<- message.Message) (err error) {
-	switch r := rbody.(type) {
-	case AutoModeResponse:
-		err = handleAutoMode(tag, r, msgTx)
-	case FreezeResponse:
-		err = handleFreeze(tag, r, msgTx)
-	case ItemResponse:
-		err = handleItem(tag, r, msgTx)
-	case SelectResponse:
-		err = handleSelect(tag, r, msgTx)
-	default:
-		err = fmt.Errorf("response with no message equivalent: %v", r)
-	}
-
-	return
-}
-
-// handleAutoMode handles converting an AutoModeResponse r into messages for tag t.
-func handleAutoMode(t string, r AutoModeResponse, msgTx chan<- message.Message) error {
-	msgTx <- *message.New(t, "AUTO").AddArgs(r.AutoMode.String())
-	return nil
+func (l *List) EmitBifrostResponse(tag string, rbody interface{}, msgTx chan<- message.Message) error {
+	return emitResponse(tag, rbody, msgTx)
 }
 
 // handleFreeze handles converting a FreezeResponse r into messages for tag t.
 func handleFreeze(t string, r FreezeResponse, msgTx chan<- message.Message) error {
-	msgTx <- *message.New(t, "COUNTL").AddArgs(strconv.Itoa(len(r)))
+	if err := handleCount(t, CountResponse{Count: len(r)}, msgTx); err != nil {
+		return err
+	}
 
 	// The next bit is the same as if we were loading the items--
 	// so we reuse the logic.
@@ -143,20 +194,88 @@ func handleItem(t string, r ItemResponse, msgTx chan<- message.Message) error {
 	var word string
 	switch r.Item.Type() {
 	case ItemTrack:
-		word = "FLOADL"
+		word = RsFloadl
 	case ItemText:
-		word = "TLOADL"
+		word = RsTloadl
 	default:
 		return fmt.Errorf("unknown item type %v", r.Item.Type())
 	}
 
 	msgTx <- *message.New(t, word).AddArgs(strconv.Itoa(r.Index), r.Item.Hash(), r.Item.Payload())
+
+	// Item metadata doesn't fit in the load messages, so it follows separately.
+	if cat := r.Item.Category(); cat != "" {
+		icr := ItemCategoryResponse{Index: r.Index, Hash: r.Item.Hash(), Category: cat}
+		if err := handleItemCategory(t, icr, msgTx); err != nil {
+			return err
+		}
+	}
+	if !r.Item.Planned().IsZero() || r.Item.Duration() != 0 {
+		itr := ItemTimingResponse{Index: r.Index, Hash: r.Item.Hash(), Planned: r.Item.Planned(), Duration: r.Item.Duration()}
+		if err := handleItemTiming(t, itr, msgTx); err != nil {
+			return err
+		}
+	}
+	if !r.Item.ValidFrom().IsZero() || !r.Item.ValidUntil().IsZero() {
+		ivr := ItemValidityResponse{Index: r.Index, Hash: r.Item.Hash(), From: r.Item.ValidFrom(), Until: r.Item.ValidUntil()}
+		if err := handleItemValidity(t, ivr, msgTx); err != nil {
+			return err
+		}
+	}
+	if d := r.Item.Display(); d != (DisplayHints{}) {
+		idr := ItemDisplayResponse{Index: r.Index, Hash: r.Item.Hash(), DisplayHints: d}
+		if err := handleItemDisplay(t, idr, msgTx); err != nil {
+			return err
+		}
+	}
+	if note := r.Item.Note(); note != "" {
+		inr := ItemNoteResponse{Index: r.Index, Hash: r.Item.Hash(), Note: note}
+		if err := handleItemNote(t, inr, msgTx); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// handleSelect handles converting a SelectResponse r into messages for tag t.
-func handleSelect(t string, r SelectResponse, msgTx chan<- message.Message) error {
-	msg := *message.New(t, "SEL").AddArgs(strconv.Itoa(r.Index), r.Hash)
-	msgTx <- msg
+// handleScratchItem handles converting a ScratchItemResponse r into messages for tag t.
+// Scratchpad items only ever have a payload, so there is no metadata to follow.
+func handleScratchItem(t string, r ScratchItemResponse, msgTx chan<- message.Message) error {
+	var word string
+	switch r.Item.Type() {
+	case ItemTrack:
+		word = RsSfloadl
+	case ItemText:
+		word = RsStloadl
+	default:
+		return fmt.Errorf("unknown item type %v", r.Item.Type())
+	}
+
+	msgTx <- *message.New(t, word).AddArgs(strconv.Itoa(r.Index), r.Item.Hash(), r.Item.Payload())
+	return nil
+}
+
+// handleCategories handles converting a CategoriesResponse r into messages for tag t.
+func handleCategories(t string, r CategoriesResponse, msgTx chan<- message.Message) error {
+	for _, c := range r {
+		msgTx <- *message.New(t, RsCatdef).AddArgs(c.Name, c.Colour)
+	}
 	return nil
 }
+
+//
+// Argument conversions used by generated code
+//
+
+// parseMilliseconds parses a whole number of milliseconds s as a duration.
+func parseMilliseconds(s string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// formatMilliseconds formats d as a whole number of milliseconds.
+func formatMilliseconds(d time.Duration) string {
+	return strconv.FormatInt(d.Milliseconds(), 10)
+}
@@ -0,0 +1,64 @@
+package list
+
+// File list/bifrost_client.go parses the messages a list server sends back into response bodies.
+// It is the client-side counterpart of the emitters in 'bifrost.go', used when yaps talks to another list server.
+
+import (
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// ParseBifrostResponse tries to parse a message sent by a list server into a response body.
+// Messages that aren't specific to lists (OHAI, IAMA, ACK, ...) are rejected.
+func ParseBifrostResponse(m message.Message) (interface{}, error) {
+	return parseResponse(m.Word(), m.Args())
+}
+
+// parseCatdefResponse tries to parse a 'CATDEF' message.
+// Each message defines one category, so the response only ever has one element.
+func parseCatdefResponse(args []string) (interface{}, error) {
+	var c Category
+	if err := bifrost.Args(args).String(0, &c.Name).String(1, &c.Colour).Err(); err != nil {
+		return nil, err
+	}
+	return CategoriesResponse{c}, nil
+}
+
+// parseFloadlResponse tries to parse a 'FLOADL' message.
+func parseFloadlResponse(args []string) (interface{}, error) {
+	return parseLoadlResponse(NewTrack, args)
+}
+
+// parseTloadlResponse tries to parse a 'TLOADL' message.
+func parseTloadlResponse(args []string) (interface{}, error) {
+	return parseLoadlResponse(NewText, args)
+}
+
+// parseLoadlResponse tries to parse a '*LOADL' message, whose item type has constructor con.
+func parseLoadlResponse(con func(string, string) *Item, args []string) (interface{}, error) {
+	rq, err := parseItemAddMessage(con, args)
+	if err != nil {
+		return nil, err
+	}
+	return ItemResponse(rq.(AddItemRequest)), nil
+}
+
+// parseSfloadlResponse tries to parse an 'SFLOADL' message.
+func parseSfloadlResponse(args []string) (interface{}, error) {
+	return parseScratchLoadlResponse(NewTrack, args)
+}
+
+// parseStloadlResponse tries to parse an 'STLOADL' message.
+func parseStloadlResponse(args []string) (interface{}, error) {
+	return parseScratchLoadlResponse(NewText, args)
+}
+
+// parseScratchLoadlResponse tries to parse an 'S*LOADL' message, whose item type has constructor con.
+func parseScratchLoadlResponse(con func(string, string) *Item, args []string) (interface{}, error) {
+	rq, err := parseItemAddMessage(con, args)
+	if err != nil {
+		return nil, err
+	}
+	return ScratchItemResponse(rq.(AddItemRequest)), nil
+}
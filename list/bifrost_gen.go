@@ -0,0 +1,2418 @@
+// Code generated by bifrostgen; DO NOT EDIT.
+
+package list
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// Words of the list requests.
+const (
+	// RqAlerts is the word of 'alerts' requests.
+	RqAlerts = "alerts"
+	// RqAuto is the word of 'auto' requests.
+	RqAuto = "auto"
+	// RqBdel is the word of 'bdel' requests.
+	RqBdel = "bdel"
+	// RqBlock is the word of 'block' requests.
+	RqBlock = "block"
+	// RqBmove is the word of 'bmove' requests.
+	RqBmove = "bmove"
+	// RqBset is the word of 'bset' requests.
+	RqBset = "bset"
+	// RqChecksum is the word of 'checksum' requests.
+	RqChecksum = "checksum"
+	// RqClone is the word of 'clone' requests.
+	RqClone = "clone"
+	// RqDiff is the word of 'diff' requests.
+	RqDiff = "diff"
+	// RqCheck is the word of 'check' requests.
+	RqCheck = "check"
+	// RqDryrun is the word of 'dryrun' requests.
+	RqDryrun = "dryrun"
+	// RqDupes is the word of 'dupes' requests.
+	RqDupes = "dupes"
+	// RqEmergency is the word of 'emergency' requests.
+	RqEmergency = "emergency"
+	// RqEnd is the word of 'end' requests.
+	RqEnd = "end"
+	// RqFind is the word of 'find' requests.
+	RqFind = "find"
+	// RqFloadl is the word of 'floadl' requests.
+	RqFloadl = "floadl"
+	// RqHistory is the word of 'history' requests.
+	RqHistory = "history"
+	// RqIcat is the word of 'icat' requests.
+	RqIcat = "icat"
+	// RqIdisp is the word of 'idisp' requests.
+	RqIdisp = "idisp"
+	// RqInote is the word of 'inote' requests.
+	RqInote = "inote"
+	// RqItext is the word of 'itext' requests.
+	RqItext = "itext"
+	// RqItime is the word of 'itime' requests.
+	RqItime = "itime"
+	// RqIvalid is the word of 'ivalid' requests.
+	RqIvalid = "ivalid"
+	// RqMaint is the word of 'maint' requests.
+	RqMaint = "maint"
+	// RqNote is the word of 'note' requests.
+	RqNote = "note"
+	// RqPlays is the word of 'plays' requests.
+	RqPlays = "plays"
+	// RqPromote is the word of 'promote' requests.
+	RqPromote = "promote"
+	// RqRdump is the word of 'rdump' requests.
+	RqRdump = "rdump"
+	// RqReady is the word of 'ready' requests.
+	RqReady = "ready"
+	// RqRelease is the word of 'release' requests.
+	RqRelease = "release"
+	// RqSdrop is the word of 'sdrop' requests.
+	RqSdrop = "sdrop"
+	// RqSdump is the word of 'sdump' requests.
+	RqSdump = "sdump"
+	// RqSel is the word of 'sel' requests.
+	RqSel = "sel"
+	// RqSep is the word of 'sep' requests.
+	RqSep = "sep"
+	// RqSfloadl is the word of 'sfloadl' requests.
+	RqSfloadl = "sfloadl"
+	// RqSpromote is the word of 'spromote' requests.
+	RqSpromote = "spromote"
+	// RqStloadl is the word of 'stloadl' requests.
+	RqStloadl = "stloadl"
+	// RqTloadl is the word of 'tloadl' requests.
+	RqTloadl = "tloadl"
+	// RqUnblock is the word of 'unblock' requests.
+	RqUnblock = "unblock"
+	// RqUpcoming is the word of 'upcoming' requests.
+	RqUpcoming = "upcoming"
+)
+
+// Words of the list responses.
+const (
+	// RsAlert is the word of 'ALERT' responses.
+	RsAlert = "ALERT"
+	// RsAlertclr is the word of 'ALERTCLR' responses.
+	RsAlertclr = "ALERTCLR"
+	// RsAuto is the word of 'AUTO' responses.
+	RsAuto = "AUTO"
+	// RsBlock is the word of 'BLOCK' responses.
+	RsBlock = "BLOCK"
+	// RsBlockclr is the word of 'BLOCKCLR' responses.
+	RsBlockclr = "BLOCKCLR"
+	// RsCatdef is the word of 'CATDEF' responses.
+	RsCatdef = "CATDEF"
+	// RsChanged is the word of 'CHANGED' responses.
+	RsChanged = "CHANGED"
+	// RsChecksum is the word of 'CHECKSUM' responses.
+	RsChecksum = "CHECKSUM"
+	// RsCountl is the word of 'COUNTL' responses.
+	RsCountl = "COUNTL"
+	// RsDiff is the word of 'DIFF' responses.
+	RsDiff = "DIFF"
+	// RsDrift is the word of 'DRIFT' responses.
+	RsDrift = "DRIFT"
+	// RsDupe is the word of 'DUPE' responses.
+	RsDupe = "DUPE"
+	// RsEmergency is the word of 'EMERGENCY' responses.
+	RsEmergency = "EMERGENCY"
+	// RsFloadl is the word of 'FLOADL' responses.
+	RsFloadl = "FLOADL"
+	// RsHash is the word of 'HASH' responses.
+	RsHash = "HASH"
+	// RsHandover is the word of 'HANDOVER' responses.
+	RsHandover = "HANDOVER"
+	// RsHandoverclr is the word of 'HANDOVERCLR' responses.
+	RsHandoverclr = "HANDOVERCLR"
+	// RsFound is the word of 'FOUND' responses.
+	RsFound = "FOUND"
+	// RsIcat is the word of 'ICAT' responses.
+	RsIcat = "ICAT"
+	// RsIdel is the word of 'IDEL' responses.
+	RsIdel = "IDEL"
+	// RsIdisp is the word of 'IDISP' responses.
+	RsIdisp = "IDISP"
+	// RsIexpired is the word of 'IEXPIRED' responses.
+	RsIexpired = "IEXPIRED"
+	// RsImove is the word of 'IMOVE' responses.
+	RsImove = "IMOVE"
+	// RsInote is the word of 'INOTE' responses.
+	RsInote = "INOTE"
+	// RsIplays is the word of 'IPLAYS' responses.
+	RsIplays = "IPLAYS"
+	// RsItext is the word of 'ITEXT' responses.
+	RsItext = "ITEXT"
+	// RsItime is the word of 'ITIME' responses.
+	RsItime = "ITIME"
+	// RsIvalid is the word of 'IVALID' responses.
+	RsIvalid = "IVALID"
+	// RsMaint is the word of 'MAINT' responses.
+	RsMaint = "MAINT"
+	// RsNote is the word of 'NOTE' responses.
+	RsNote = "NOTE"
+	// RsPlayed is the word of 'PLAYED' responses.
+	RsPlayed = "PLAYED"
+	// RsSel is the word of 'SEL' responses.
+	RsSel = "SEL"
+	// RsSfloadl is the word of 'SFLOADL' responses.
+	RsSfloadl = "SFLOADL"
+	// RsStloadl is the word of 'STLOADL' responses.
+	RsStloadl = "STLOADL"
+	// RsTloadl is the word of 'TLOADL' responses.
+	RsTloadl = "TLOADL"
+	// RsVer is the word of 'VER' responses.
+	RsVer = "VER"
+)
+
+// parseRequest parses a list request message with word word and arguments args.
+func parseRequest(word string, args []string) (interface{}, error) {
+	switch word {
+	case RqAlerts:
+		return parseAlertsMessage(args)
+	case RqAuto:
+		return parseAutoMessage(args)
+	case RqBdel:
+		return parseBdelMessage(args)
+	case RqBlock:
+		return parseBlockMessage(args)
+	case RqBmove:
+		return parseBmoveMessage(args)
+	case RqBset:
+		return parseBsetMessage(args)
+	case RqChecksum:
+		return parseChecksumMessage(args)
+	case RqClone:
+		return parseCloneMessage(args)
+	case RqDiff:
+		return parseDiffMessage(args)
+	case RqCheck:
+		return parseCheckMessage(args)
+	case RqDryrun:
+		return parseDryrunMessage(args)
+	case RqDupes:
+		return parseDupesMessage(args)
+	case RqEmergency:
+		return parseEmergencyMessage(args)
+	case RqEnd:
+		return parseEndMessage(args)
+	case RqFind:
+		return parseFindMessage(args)
+	case RqFloadl:
+		return parseFloadlMessage(args)
+	case RqHistory:
+		return parseHistoryMessage(args)
+	case RqIcat:
+		return parseIcatMessage(args)
+	case RqIdisp:
+		return parseIdispMessage(args)
+	case RqInote:
+		return parseInoteMessage(args)
+	case RqItext:
+		return parseItextMessage(args)
+	case RqItime:
+		return parseItimeMessage(args)
+	case RqIvalid:
+		return parseIvalidMessage(args)
+	case RqMaint:
+		return parseMaintMessage(args)
+	case RqNote:
+		return parseNoteMessage(args)
+	case RqPlays:
+		return parsePlaysMessage(args)
+	case RqPromote:
+		return parsePromoteMessage(args)
+	case RqRdump:
+		return parseRdumpMessage(args)
+	case RqReady:
+		return parseReadyMessage(args)
+	case RqRelease:
+		return parseReleaseMessage(args)
+	case RqSdrop:
+		return parseSdropMessage(args)
+	case RqSdump:
+		return parseSdumpMessage(args)
+	case RqSel:
+		return parseSelMessage(args)
+	case RqSep:
+		return parseSepMessage(args)
+	case RqSfloadl:
+		return parseSfloadlMessage(args)
+	case RqSpromote:
+		return parseSpromoteMessage(args)
+	case RqStloadl:
+		return parseStloadlMessage(args)
+	case RqTloadl:
+		return parseTloadlMessage(args)
+	case RqUnblock:
+		return parseUnblockMessage(args)
+	case RqUpcoming:
+		return parseUpcomingMessage(args)
+	default:
+		return nil, controller.UnknownWord(word)
+	}
+}
+
+// versionedArity maps each word that changes a list to its arity without a version.
+// These words may take the list version as an extra, final argument; see VersionedRequest.
+var versionedArity = map[string]int{
+	RqAuto:     1,
+	RqBdel:     1,
+	RqBlock:    4,
+	RqBmove:    2,
+	RqBset:     3,
+	RqClone:    2,
+	RqFloadl:   3,
+	RqIcat:     3,
+	RqIdisp:    6,
+	RqInote:    3,
+	RqItext:    3,
+	RqItime:    4,
+	RqIvalid:   4,
+	RqNote:     1,
+	RqSel:      2,
+	RqSep:      2,
+	RqSpromote: 1,
+	RqTloadl:   3,
+	RqUnblock:  1,
+}
+
+// parseResponse parses a list response message with word word and arguments args.
+func parseResponse(word string, args []string) (interface{}, error) {
+	switch word {
+	case RsAlert:
+		return parseAlertResponse(args)
+	case RsAlertclr:
+		return parseAlertclrResponse(args)
+	case RsAuto:
+		return parseAutoResponse(args)
+	case RsBlock:
+		return parseBlockResponse(args)
+	case RsBlockclr:
+		return parseBlockclrResponse(args)
+	case RsCatdef:
+		return parseCatdefResponse(args)
+	case RsChanged:
+		return parseChangedResponse(args)
+	case RsChecksum:
+		return parseChecksumResponse(args)
+	case RsCountl:
+		return parseCountlResponse(args)
+	case RsDiff:
+		return parseDiffResponse(args)
+	case RsDrift:
+		return parseDriftResponse(args)
+	case RsDupe:
+		return parseDupeResponse(args)
+	case RsEmergency:
+		return parseEmergencyResponse(args)
+	case RsFloadl:
+		return parseFloadlResponse(args)
+	case RsHash:
+		return parseHashResponse(args)
+	case RsHandover:
+		return parseHandoverResponse(args)
+	case RsHandoverclr:
+		return parseHandoverclrResponse(args)
+	case RsFound:
+		return parseFoundResponse(args)
+	case RsIcat:
+		return parseIcatResponse(args)
+	case RsIdel:
+		return parseIdelResponse(args)
+	case RsIdisp:
+		return parseIdispResponse(args)
+	case RsIexpired:
+		return parseIexpiredResponse(args)
+	case RsImove:
+		return parseImoveResponse(args)
+	case RsInote:
+		return parseInoteResponse(args)
+	case RsIplays:
+		return parseIplaysResponse(args)
+	case RsItext:
+		return parseItextResponse(args)
+	case RsItime:
+		return parseItimeResponse(args)
+	case RsIvalid:
+		return parseIvalidResponse(args)
+	case RsMaint:
+		return parseMaintResponse(args)
+	case RsNote:
+		return parseNoteResponse(args)
+	case RsPlayed:
+		return parsePlayedResponse(args)
+	case RsSel:
+		return parseSelResponse(args)
+	case RsSfloadl:
+		return parseSfloadlResponse(args)
+	case RsStloadl:
+		return parseStloadlResponse(args)
+	case RsTloadl:
+		return parseTloadlResponse(args)
+	case RsVer:
+		return parseVerResponse(args)
+	default:
+		return nil, bifrost.WithCode(bifrost.CodeUnknownWord, fmt.Errorf("unknown list response word: %s", word))
+	}
+}
+
+// emitResponse converts a list response body rbody into messages with tag tag, sending them to msgTx.
+func emitResponse(tag string, rbody interface{}, msgTx chan<- message.Message) error {
+	switch r := rbody.(type) {
+	case AlertResponse:
+		return handleAlert(tag, r, msgTx)
+	case AlertClearedResponse:
+		return handleAlertCleared(tag, r, msgTx)
+	case AutoModeResponse:
+		return handleAutoMode(tag, r, msgTx)
+	case BlockResponse:
+		return handleBlock(tag, r, msgTx)
+	case BlockClearedResponse:
+		return handleBlockCleared(tag, r, msgTx)
+	case CategoriesResponse:
+		return handleCategories(tag, r, msgTx)
+	case ItemsChangedResponse:
+		return handleItemsChanged(tag, r, msgTx)
+	case ChecksumResponse:
+		return handleChecksum(tag, r, msgTx)
+	case CountResponse:
+		return handleCount(tag, r, msgTx)
+	case FreezeResponse:
+		return handleFreeze(tag, r, msgTx)
+	case DiffResponse:
+		return handleDiff(tag, r, msgTx)
+	case DriftResponse:
+		return handleDrift(tag, r, msgTx)
+	case DuplicateResponse:
+		return handleDuplicate(tag, r, msgTx)
+	case EmergencyResponse:
+		return handleEmergency(tag, r, msgTx)
+	case ItemResponse:
+		return handleItem(tag, r, msgTx)
+	case HashStateResponse:
+		return handleHashState(tag, r, msgTx)
+	case HandoverResponse:
+		return handleHandover(tag, r, msgTx)
+	case HandoverClearedResponse:
+		return handleHandoverCleared(tag, r, msgTx)
+	case FoundResponse:
+		return handleFound(tag, r, msgTx)
+	case ItemCategoryResponse:
+		return handleItemCategory(tag, r, msgTx)
+	case ItemRemoveResponse:
+		return handleItemRemove(tag, r, msgTx)
+	case ItemDisplayResponse:
+		return handleItemDisplay(tag, r, msgTx)
+	case ItemExpiredResponse:
+		return handleItemExpired(tag, r, msgTx)
+	case ItemMoveResponse:
+		return handleItemMove(tag, r, msgTx)
+	case ItemNoteResponse:
+		return handleItemNote(tag, r, msgTx)
+	case ItemPlaysResponse:
+		return handleItemPlays(tag, r, msgTx)
+	case ItemTextResponse:
+		return handleItemText(tag, r, msgTx)
+	case ItemTimingResponse:
+		return handleItemTiming(tag, r, msgTx)
+	case ItemValidityResponse:
+		return handleItemValidity(tag, r, msgTx)
+	case MaintenanceResponse:
+		return handleMaintenance(tag, r, msgTx)
+	case ListNoteResponse:
+		return handleListNote(tag, r, msgTx)
+	case PlayedResponse:
+		return handlePlayed(tag, r, msgTx)
+	case SelectResponse:
+		return handleSelect(tag, r, msgTx)
+	case ScratchItemResponse:
+		return handleScratchItem(tag, r, msgTx)
+	case VersionResponse:
+		return handleVersion(tag, r, msgTx)
+	default:
+		return fmt.Errorf("response with no message equivalent: %v", r)
+	}
+}
+
+// bifrostSchema describes the list requests and responses, for 'describe'.
+var bifrostSchema = controller.Schema{
+	Role: "list",
+	Requests: []controller.WordSchema{
+		{
+			Word:    RqAlerts,
+			Doc:     "Asks for the active alerts, as a series of ALERT replies in key order.",
+			Replies: []string{RsAlert},
+		},
+		{
+			Word: RqAuto,
+			Doc:  "Changes the autoselect mode.",
+			Args: []controller.ArgSchema{
+				{Name: "AutoMode", Type: "automode", Doc: "The new mode: off, drop, next, shuffle, or the name of a registered policy."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqBdel,
+			Doc:  "Removes a block and all of its items, announcing each removal with IDEL; fails if the block holds the selection.",
+			Args: []controller.ArgSchema{
+				{Name: "ID", Type: "hash", Doc: "The ID of the block."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqBlock,
+			Doc:  "Makes adjacent items, none of them in a block, into a new named block.",
+			Args: []controller.ArgSchema{
+				{Name: "ID", Type: "hash", Doc: "An ID, unique within the list, identifying the new block."},
+				{Name: "Index", Type: "int", Doc: "The index of the block's first item."},
+				{Name: "Count", Type: "int", Doc: "The number of items in the block."},
+				{Name: "Title", Type: "string", Doc: "The block's title, such as Ad break 2."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqBmove,
+			Doc:  "Moves a block's items as one, announcing each move with IMOVE; the block may not land inside another.",
+			Args: []controller.ArgSchema{
+				{Name: "ID", Type: "hash", Doc: "The ID of the block."},
+				{Name: "Index", Type: "int", Doc: "The index of the block's first item once moved, counting items as if the block weren't in the list."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqBset,
+			Doc:  "Changes a block's title, and whether displays should show it collapsed.",
+			Args: []controller.ArgSchema{
+				{Name: "ID", Type: "hash", Doc: "The ID of the block."},
+				{Name: "Collapsed", Type: "bool", Doc: "Whether displays should show the block as one line."},
+				{Name: "Title", Type: "string", Doc: "The block's new title."},
+			},
+			Versioned: true,
+		},
+		{
+			Word:    RqChecksum,
+			Doc:     "Asks for a checksum of the list's items and selection, as CHECKSUM, so that a client or mirror can cheaply check that its cached copy matches.",
+			Replies: []string{RsChecksum},
+		},
+		{
+			Word: RqClone,
+			Doc:  "Splices a copy of a template into the list in one change, giving every item a fresh hash.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index in the list to splice the template in front of."},
+				{Name: "Template", Type: "string", Doc: "The name of the template."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqDiff,
+			Doc:  "Asks for the changes needed to bring a copy of the list at an older version up to date, as DIFF followed by the changes.",
+			Args: []controller.ArgSchema{
+				{Name: "Since", Type: "uint", Doc: "The version of the client's copy."},
+			},
+			Replies: []string{RsDiff},
+		},
+		{
+			Word: RqCheck,
+			Doc:  "Checks a batch of hashes, as a series of HASH replies, one per hash in the order given; for reconciling a cached copy of the list after reconnecting.",
+			Args: []controller.ArgSchema{
+				{Name: "Hashes", Type: "hash", Doc: "The hashes to check, as one or more separate arguments."},
+			},
+			Replies: []string{RsHash},
+		},
+		{
+			Word: RqDryrun,
+			Doc:  "Checks another request without carrying it out: replies as it would, then with the broadcasts it would cause, or fails as it would.",
+			Args: []controller.ArgSchema{
+				{Name: "Word", Type: "string", Doc: "The word of the request to check."},
+				{Name: "Args", Type: "string", Doc: "The request's arguments, including any version, as separate arguments.", Optional: true},
+			},
+		},
+		{
+			Word:    RqDupes,
+			Doc:     "Reports the tracks that duplicate earlier ones, by path or title, as a series of DUPE replies.",
+			Replies: []string{RsDupe},
+		},
+		{
+			Word: RqEmergency,
+			Doc:  "Puts the list's fail-safe track on air at once, adding it after the selection if need be, and locks the list, refusing other changes with the error code emergency until released; goes through even during maintenance.",
+			Args: []controller.ArgSchema{
+				{Name: "Reason", Type: "string", Doc: "What the emergency is.", Optional: true},
+			},
+		},
+		{
+			Word: RqEnd,
+			Doc:  "Tells the list that the selected item is ending: the list moves on to the item it is handing over to once the player is ready for it, or by the automode if it has none.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the selected item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the selected item."},
+			},
+		},
+		{
+			Word: RqFind,
+			Doc:  "Searches the list, as a series of FOUND replies, one per matching item in list order.",
+			Args: []controller.ArgSchema{
+				{Name: "Query", Type: "string", Doc: "The text to look for, ignoring case."},
+				{Name: "Field", Type: "string", Doc: "Where to look: payload, note, hash, category (matched whole), or any (the default: payload or note).", Optional: true},
+			},
+			Replies: []string{RsFound},
+		},
+		{
+			Word: RqFloadl,
+			Doc:  "Enqueues a track.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index to enqueue the track in front of."},
+				{Name: "Hash", Type: "hash", Doc: "A hash, unique within the list, identifying the new item."},
+				{Name: "Path", Type: "string", Doc: "The file path of the track."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqHistory,
+			Doc:  "Asks for the selections in the play log within a range of time, as a series of PLAYED replies, oldest first.",
+			Args: []controller.ArgSchema{
+				{Name: "From", Type: "time", Doc: "The start of the range, inclusive."},
+				{Name: "To", Type: "time", Doc: "The end of the range, exclusive."},
+			},
+			Replies: []string{RsPlayed},
+		},
+		{
+			Word: RqIcat,
+			Doc:  "Sets an item's category or, without a category, asks for it.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Category", Type: "string", Doc: "The new category; empty to remove it.", Optional: true},
+			},
+			Versioned: true,
+			Replies:   []string{RsIcat},
+		},
+		{
+			Word: RqIdisp,
+			Doc:  "Sets the display hints of a text item, telling displays how to show it.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Markup", Type: "markup", Doc: "The markup of the item's text."},
+				{Name: "Severity", Type: "severity", Doc: "How urgent the item is."},
+				{Name: "Colour", Type: "string", Doc: "The colour to show the item in, as #rrggbb; - for the display's choice."},
+				{Name: "Hold", Type: "duration", Doc: "How long to show the item for; 0 for as long as the display likes."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqInote,
+			Doc:  "Sets the note on an item.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Note", Type: "string", Doc: "The new note; empty to remove it."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqItext,
+			Doc:  "Changes the text of a text item in place, keeping its hash, position and metadata.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Text", Type: "string", Doc: "The new text of the item."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqItime,
+			Doc:  "Sets an item's planned start time and expected duration.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Planned", Type: "time", Doc: "The planned start time."},
+				{Name: "Duration", Type: "duration", Doc: "The expected duration."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqIvalid,
+			Doc:  "Sets the window of time in which an item may be selected.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "From", Type: "time", Doc: "The time before which the item is embargoed."},
+				{Name: "Until", Type: "time", Doc: "The time after which the item has expired."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqMaint,
+			Doc:  "Makes the list read-only for maintenance, refusing changes with the error code maintenance until the time is up; only admins may send it.",
+			Args: []controller.ArgSchema{
+				{Name: "Duration", Type: "duration", Doc: "How long the maintenance lasts; 0 to end it now."},
+				{Name: "Reason", Type: "string", Doc: "Why the list is going read-only.", Optional: true},
+			},
+		},
+		{
+			Word: RqNote,
+			Doc:  "Sets the note on the whole list.",
+			Args: []controller.ArgSchema{
+				{Name: "Note", Type: "string", Doc: "The new note; empty to remove it."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqPlays,
+			Doc:  "Asks for the most recent selections, as a series of PLAYED replies, oldest first.",
+			Args: []controller.ArgSchema{
+				{Name: "Count", Type: "int", Doc: "The maximum number of selections to send; 0, or none, for all yaps remembers.", Optional: true},
+			},
+			Replies: []string{RsPlayed},
+		},
+		{
+			Word: RqPromote,
+			Doc:  "Promotes a read-only replica to a primary.",
+		},
+		{
+			Word: RqRdump,
+			Doc:  "Dumps part of the list, as a series of FLOADL and TLOADL replies.",
+			Args: []controller.ArgSchema{
+				{Name: "Start", Type: "int", Doc: "The index of the first item to dump."},
+				{Name: "Count", Type: "int", Doc: "The maximum number of items to consider."},
+				{Name: "Category", Type: "string", Doc: "If given, only items in this category are dumped.", Optional: true},
+			},
+			Replies: []string{RsFloadl, RsTloadl},
+		},
+		{
+			Word: RqReady,
+			Doc:  "Tells the list that the player is ready to go straight on to the item being handed over to; if the selection has already ended, the list moves on to it now.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item being handed over to."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item being handed over to."},
+			},
+		},
+		{
+			Word: RqRelease,
+			Doc:  "Ends any emergency, unlocking the list; only admins may send it.",
+		},
+		{
+			Word: RqSdrop,
+			Doc:  "Throws away the connection's scratchpad.",
+		},
+		{
+			Word:    RqSdump,
+			Doc:     "Asks for the connection's scratchpad, as a series of SFLOADL and STLOADL replies.",
+			Replies: []string{RsSfloadl, RsStloadl},
+		},
+		{
+			Word: RqSel,
+			Doc:  "Selects an item.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqSep,
+			Doc:  "Puts a copy of a separator defined in the config, such as an hour marker, into the list as a text item with a fresh hash.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index to put the separator in front of."},
+				{Name: "Name", Type: "string", Doc: "The name of the separator."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqSfloadl,
+			Doc:  "Puts a track in the connection's scratchpad, which nobody else sees, and which is thrown away when the connection closes.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index in the scratchpad to put the track in front of."},
+				{Name: "Hash", Type: "hash", Doc: "A hash, unique within the scratchpad, identifying the new item."},
+				{Name: "Path", Type: "string", Doc: "The file path of the track."},
+			},
+		},
+		{
+			Word: RqSpromote,
+			Doc:  "Splices the connection's scratchpad into the list in one change, emptying the scratchpad.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index in the list to splice the scratchpad in front of."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqStloadl,
+			Doc:  "Puts a text item in the connection's scratchpad.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index in the scratchpad to put the item in front of."},
+				{Name: "Hash", Type: "hash", Doc: "A hash, unique within the scratchpad, identifying the new item."},
+				{Name: "Text", Type: "string", Doc: "The text of the item."},
+			},
+		},
+		{
+			Word: RqTloadl,
+			Doc:  "Enqueues a text item.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index to enqueue the item in front of."},
+				{Name: "Hash", Type: "hash", Doc: "A hash, unique within the list, identifying the new item."},
+				{Name: "Text", Type: "string", Doc: "The text of the item."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqUnblock,
+			Doc:  "Removes a block, leaving its items where they are.",
+			Args: []controller.ArgSchema{
+				{Name: "ID", Type: "hash", Doc: "The ID of the block."},
+			},
+			Versioned: true,
+		},
+		{
+			Word: RqUpcoming,
+			Doc:  "Asks for the tracks likely to be selected next, most likely first, as a series of FLOADL replies; under shuffle, these are tracks the shuffle hasn't yet picked.",
+			Args: []controller.ArgSchema{
+				{Name: "Count", Type: "int", Doc: "The maximum number of tracks to send; 0, or none, for just the next.", Optional: true},
+			},
+			Replies: []string{RsFloadl},
+		},
+	},
+	Responses: []controller.WordSchema{
+		{
+			Word: RsAlert,
+			Doc:  "Announces an operational problem every client should know about, such as a storage failure.",
+			Args: []controller.ArgSchema{
+				{Name: "Key", Type: "string", Doc: "The name of the problem, such as storage, playlog, player, or icy."},
+				{Name: "Severity", Type: "severity", Doc: "How bad the problem is."},
+				{Name: "Since", Type: "time", Doc: "When the problem was first raised."},
+				{Name: "Count", Type: "int", Doc: "How many times the problem has been raised since."},
+				{Name: "Message", Type: "string", Doc: "A description of the problem."},
+			},
+		},
+		{
+			Word: RsAlertclr,
+			Doc:  "Announces that an announced problem has gone away.",
+			Args: []controller.ArgSchema{
+				{Name: "Key", Type: "string", Doc: "The name of the problem."},
+			},
+		},
+		{
+			Word: RsAuto,
+			Doc:  "Announces the autoselect mode.",
+			Args: []controller.ArgSchema{
+				{Name: "AutoMode", Type: "automode", Doc: "The mode."},
+			},
+		},
+		{
+			Word: RsBlock,
+			Doc:  "Announces a block, and that the given items, and no others, make it up; sent in dumps after the items.",
+			Args: []controller.ArgSchema{
+				{Name: "ID", Type: "hash", Doc: "The ID of the block."},
+				{Name: "Index", Type: "int", Doc: "The index of the block's first item."},
+				{Name: "Count", Type: "int", Doc: "The number of items in the block."},
+				{Name: "Collapsed", Type: "bool", Doc: "Whether displays should show the block as one line."},
+				{Name: "Title", Type: "string", Doc: "The block's title."},
+			},
+		},
+		{
+			Word: RsBlockclr,
+			Doc:  "Announces that a block is gone; its items, if any are left, are no longer in a block.",
+			Args: []controller.ArgSchema{
+				{Name: "ID", Type: "hash", Doc: "The ID of the block."},
+			},
+		},
+		{
+			Word: RsCatdef,
+			Doc:  "Announces one category defined on the list.",
+			Args: []controller.ArgSchema{
+				{Name: "Name", Type: "string", Doc: "The category name."},
+				{Name: "Colour", Type: "string", Doc: "The colour clients should show the category in."},
+			},
+		},
+		{
+			Word: RsChanged,
+			Doc:  "Announces that items in a range changed, in place of their separate announcements, on listeners that fold them; clients should fetch the range again with rdump.",
+			Args: []controller.ArgSchema{
+				{Name: "Start", Type: "int", Doc: "The index of the first item in the range."},
+				{Name: "Count", Type: "int", Doc: "The number of items in the range."},
+			},
+		},
+		{
+			Word: RsChecksum,
+			Doc:  "Reports the checksum of the list's items and selection, at a version, asked for by checksum.",
+			Args: []controller.ArgSchema{
+				{Name: "Version", Type: "uint", Doc: "The list's version."},
+				{Name: "Checksum", Type: "string", Doc: "The checksum: 16 hex digits."},
+			},
+		},
+		{
+			Word: RsCountl,
+			Doc:  "Announces the number of items in the list snapshot that follows.",
+			Args: []controller.ArgSchema{
+				{Name: "Count", Type: "int", Doc: "The number of items."},
+			},
+		},
+		{
+			Word: RsDiff,
+			Doc:  "Starts the reply to a diff: the changes that follow bring the list from one version to another.",
+			Args: []controller.ArgSchema{
+				{Name: "From", Type: "uint", Doc: "The version the changes start from."},
+				{Name: "To", Type: "uint", Doc: "The version the changes bring the list to."},
+			},
+		},
+		{
+			Word: RsDrift,
+			Doc:  "Announces how late (positive) or early (negative) the running order is.",
+			Args: []controller.ArgSchema{
+				{Name: "Drift", Type: "duration", Doc: "The drift."},
+			},
+		},
+		{
+			Word: RsDupe,
+			Doc:  "Reports a track duplicating an earlier one.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the duplicate."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the duplicate."},
+				{Name: "OfIndex", Type: "int", Doc: "The index of the item it duplicates."},
+				{Name: "OfHash", Type: "hash", Doc: "The hash of the item it duplicates."},
+				{Name: "Reason", Type: "string", Doc: "What the two share: payload or title."},
+			},
+		},
+		{
+			Word: RsEmergency,
+			Doc:  "Announces that the list has locked itself in an emergency, or no longer has; sent in dumps while it has.",
+			Args: []controller.ArgSchema{
+				{Name: "Since", Type: "time", Doc: "When the emergency started; - once released."},
+				{Name: "Reason", Type: "string", Doc: "What the emergency is.", Optional: true},
+			},
+		},
+		{
+			Word: RsFloadl,
+			Doc:  "Announces a track in the list.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Path", Type: "string", Doc: "The file path of the track."},
+			},
+		},
+		{
+			Word: RsHash,
+			Doc:  "Reports the index and state of a hash asked about by check.",
+			Args: []controller.ArgSchema{
+				{Name: "Hash", Type: "hash", Doc: "The hash."},
+				{Name: "Index", Type: "int", Doc: "The index of the item with the hash, or -1 if it isn't in the list."},
+				{Name: "State", Type: "string", Doc: "selected, queued (could be selected now), embargoed, expired, removed (in a version the list remembers, but not now), or unknown."},
+			},
+		},
+		{
+			Word: RsHandover,
+			Doc:  "Announces the item the list will move on to when the selection ends, so that the player can ready it, and how far the handover has got; sent in dumps while there is one.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "State", Type: "string", Doc: "pending until the player is ready, ready once it is, or waiting if the selection has ended first."},
+				{Name: "Planned", Type: "time", Doc: "The item's planned start time."},
+				{Name: "Duration", Type: "duration", Doc: "The item's expected duration."},
+				{Name: "Due", Type: "time", Doc: "When the list stops waiting for the player, and moves on anyway."},
+			},
+		},
+		{
+			Word: RsHandoverclr,
+			Doc:  "Announces that the list no longer has an item to move on to when the selection ends.",
+		},
+		{
+			Word: RsFound,
+			Doc:  "Announces an item matching a search.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+			},
+		},
+		{
+			Word: RsIcat,
+			Doc:  "Announces an item's category.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Category", Type: "string", Doc: "The category; empty if uncategorised.", Optional: true},
+			},
+		},
+		{
+			Word: RsIdel,
+			Doc:  "Announces that an item has left the list.",
+			Args: []controller.ArgSchema{
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+			},
+		},
+		{
+			Word: RsIdisp,
+			Doc:  "Announces the display hints of a text item; sent in dumps for items with any.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Markup", Type: "markup", Doc: "The markup of the item's text."},
+				{Name: "Severity", Type: "severity", Doc: "How urgent the item is."},
+				{Name: "Colour", Type: "string", Doc: "The colour to show the item in, as #rrggbb; - for the display's choice."},
+				{Name: "Hold", Type: "duration", Doc: "How long to show the item for; 0 for as long as the display likes."},
+			},
+		},
+		{
+			Word: RsIexpired,
+			Doc:  "Announces that an item has passed its valid-until time, and can no longer be selected.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+			},
+		},
+		{
+			Word: RsImove,
+			Doc:  "Announces that an item has moved to a new index.",
+			Args: []controller.ArgSchema{
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Index", Type: "int", Doc: "The item's new index."},
+			},
+		},
+		{
+			Word: RsInote,
+			Doc:  "Announces the note on an item.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Note", Type: "string", Doc: "The note; empty if there isn't one.", Optional: true},
+			},
+		},
+		{
+			Word: RsIplays,
+			Doc:  "Announces how many times an item has been selected, counting by hash.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Count", Type: "int", Doc: "The number of selections."},
+			},
+		},
+		{
+			Word: RsItext,
+			Doc:  "Announces that the text of a text item has changed in place.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Text", Type: "string", Doc: "The new text of the item."},
+			},
+		},
+		{
+			Word: RsItime,
+			Doc:  "Announces an item's planned start time and expected duration.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Planned", Type: "time", Doc: "The planned start time."},
+				{Name: "Duration", Type: "duration", Doc: "The expected duration."},
+			},
+		},
+		{
+			Word: RsIvalid,
+			Doc:  "Announces the window of time in which an item may be selected.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "From", Type: "time", Doc: "The time before which the item is embargoed."},
+				{Name: "Until", Type: "time", Doc: "The time after which the item has expired."},
+			},
+		},
+		{
+			Word: RsMaint,
+			Doc:  "Announces that the list is read-only for maintenance, or no longer is; sent in dumps while it is.",
+			Args: []controller.ArgSchema{
+				{Name: "Until", Type: "time", Doc: "When the maintenance is due to end; - once it has."},
+				{Name: "Reason", Type: "string", Doc: "Why the list is read-only.", Optional: true},
+			},
+		},
+		{
+			Word: RsNote,
+			Doc:  "Announces the note on the whole list.",
+			Args: []controller.ArgSchema{
+				{Name: "Note", Type: "string", Doc: "The note; empty if there isn't one.", Optional: true},
+			},
+		},
+		{
+			Word: RsPlayed,
+			Doc:  "Reports one selection from the play history.",
+			Args: []controller.ArgSchema{
+				{Name: "At", Type: "time", Doc: "When the item was selected."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Payload", Type: "string", Doc: "The item's payload when it was selected."},
+			},
+		},
+		{
+			Word: RsSel,
+			Doc:  "Announces the selection.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the selected item, or -1 for none."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the selected item."},
+			},
+		},
+		{
+			Word: RsSfloadl,
+			Doc:  "Reports a track in the connection's scratchpad.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item in the scratchpad."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Path", Type: "string", Doc: "The file path of the track."},
+			},
+		},
+		{
+			Word: RsStloadl,
+			Doc:  "Reports a text item in the connection's scratchpad.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item in the scratchpad."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Text", Type: "string", Doc: "The text of the item."},
+			},
+		},
+		{
+			Word: RsTloadl,
+			Doc:  "Announces a text item in the list.",
+			Args: []controller.ArgSchema{
+				{Name: "Index", Type: "int", Doc: "The index of the item."},
+				{Name: "Hash", Type: "hash", Doc: "The hash of the item."},
+				{Name: "Text", Type: "string", Doc: "The text of the item."},
+			},
+		},
+		{
+			Word: RsVer,
+			Doc:  "Announces the list's state version, after every change and at the end of every dump.",
+			Args: []controller.ArgSchema{
+				{Name: "Version", Type: "uint", Doc: "The version."},
+			},
+		},
+	},
+}
+
+// parseAlertsMessage tries to parse an 'alerts' message.
+func parseAlertsMessage(args []string) (interface{}, error) {
+	var rq AlertsRequest
+	err := bifrost.Args(args).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseAutoMessage tries to parse an 'auto' message.
+func parseAutoMessage(args []string) (interface{}, error) {
+	var rq SetAutoModeRequest
+	err := bifrost.Args(args).
+		Func(0, func(s string) (err error) {
+			rq.AutoMode, err = ParseAutoMode(s)
+			return err
+		}).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseBdelMessage tries to parse a 'bdel' message.
+func parseBdelMessage(args []string) (interface{}, error) {
+	var rq RemoveBlockRequest
+	err := bifrost.Args(args).
+		Hash(0, &rq.ID).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseBlockMessage tries to parse a 'block' message.
+func parseBlockMessage(args []string) (interface{}, error) {
+	var rq NewBlockRequest
+	err := bifrost.Args(args).
+		Hash(0, &rq.ID).
+		Int(1, &rq.Index).
+		Int(2, &rq.Count).
+		String(3, &rq.Title).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseBmoveMessage tries to parse a 'bmove' message.
+func parseBmoveMessage(args []string) (interface{}, error) {
+	var rq MoveBlockRequest
+	err := bifrost.Args(args).
+		Hash(0, &rq.ID).
+		Int(1, &rq.Index).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseBsetMessage tries to parse a 'bset' message.
+func parseBsetMessage(args []string) (interface{}, error) {
+	var rq SetBlockRequest
+	err := bifrost.Args(args).
+		Hash(0, &rq.ID).
+		Func(1, func(s string) (err error) {
+			rq.Collapsed, err = strconv.ParseBool(s)
+			return err
+		}).
+		String(2, &rq.Title).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseChecksumMessage tries to parse a 'checksum' message.
+func parseChecksumMessage(args []string) (interface{}, error) {
+	var rq ChecksumRequest
+	err := bifrost.Args(args).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseCloneMessage tries to parse a 'clone' message.
+func parseCloneMessage(args []string) (interface{}, error) {
+	var rq CloneRequest
+	err := bifrost.Args(args).
+		Int(0, &rq.Index).
+		String(1, &rq.Template).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseDiffMessage tries to parse a 'diff' message.
+func parseDiffMessage(args []string) (interface{}, error) {
+	var rq DiffRequest
+	err := bifrost.Args(args).
+		Uint(0, &rq.Since).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseDupesMessage tries to parse a 'dupes' message.
+func parseDupesMessage(args []string) (interface{}, error) {
+	var rq DuplicateRequest
+	err := bifrost.Args(args).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseEmergencyMessage tries to parse an 'emergency' message.
+func parseEmergencyMessage(args []string) (interface{}, error) {
+	var rq EmergencyRequest
+	err := bifrost.Args(args).
+		Optional().
+		String(0, &rq.Reason).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseEndMessage tries to parse an 'end' message.
+func parseEndMessage(args []string) (interface{}, error) {
+	var rq EndRequest
+	err := bifrost.Args(args).
+		Int(0, &rq.Index).
+		Hash(1, &rq.Hash).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseFindMessage tries to parse a 'find' message.
+func parseFindMessage(args []string) (interface{}, error) {
+	var rq SearchRequest
+	args, opts, err := bifrost.SplitQuery(args, "index", "hash", "type", "payload", "note", "category")
+	if err != nil {
+		return nil, err
+	}
+	rq.Options = opts
+	err = bifrost.Args(args).
+		String(0, &rq.Query).
+		Optional().
+		String(1, &rq.Field).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseHistoryMessage tries to parse a 'history' message.
+func parseHistoryMessage(args []string) (interface{}, error) {
+	var rq PlayLogRequest
+	args, opts, err := bifrost.SplitQuery(args, "at", "hash", "payload")
+	if err != nil {
+		return nil, err
+	}
+	rq.Options = opts
+	err = bifrost.Args(args).
+		Func(0, func(s string) (err error) {
+			if s != "-" {
+				rq.From, err = time.Parse(time.RFC3339, s)
+			}
+			return err
+		}).
+		Func(1, func(s string) (err error) {
+			if s != "-" {
+				rq.To, err = time.Parse(time.RFC3339, s)
+			}
+			return err
+		}).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseIdispMessage tries to parse an 'idisp' message.
+func parseIdispMessage(args []string) (interface{}, error) {
+	var rq SetItemDisplayRequest
+	err := bifrost.Args(args).
+		Int(0, &rq.Index).
+		Hash(1, &rq.Hash).
+		Func(2, func(s string) (err error) {
+			rq.Markup, err = ParseMarkup(s)
+			return err
+		}).
+		Func(3, func(s string) (err error) {
+			rq.Severity, err = ParseAlertSeverity(s)
+			return err
+		}).
+		Func(4, func(s string) (err error) {
+			if s != "-" {
+				rq.Colour = s
+			}
+			return err
+		}).
+		Func(5, func(s string) (err error) {
+			rq.Hold, err = parseMilliseconds(s)
+			return err
+		}).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseInoteMessage tries to parse an 'inote' message.
+func parseInoteMessage(args []string) (interface{}, error) {
+	var rq SetItemNoteRequest
+	err := bifrost.Args(args).
+		Int(0, &rq.Index).
+		Hash(1, &rq.Hash).
+		String(2, &rq.Note).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseItextMessage tries to parse an 'itext' message.
+func parseItextMessage(args []string) (interface{}, error) {
+	var rq SetItemTextRequest
+	err := bifrost.Args(args).
+		Int(0, &rq.Index).
+		Hash(1, &rq.Hash).
+		String(2, &rq.Text).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseItimeMessage tries to parse an 'itime' message.
+func parseItimeMessage(args []string) (interface{}, error) {
+	var rq SetItemTimingRequest
+	err := bifrost.Args(args).
+		Int(0, &rq.Index).
+		Hash(1, &rq.Hash).
+		Func(2, func(s string) (err error) {
+			if s != "-" {
+				rq.Planned, err = time.Parse(time.RFC3339, s)
+			}
+			return err
+		}).
+		Func(3, func(s string) (err error) {
+			if s != "-" {
+				rq.Duration, err = parseMilliseconds(s)
+			}
+			return err
+		}).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseIvalidMessage tries to parse an 'ivalid' message.
+func parseIvalidMessage(args []string) (interface{}, error) {
+	var rq SetItemValidityRequest
+	err := bifrost.Args(args).
+		Int(0, &rq.Index).
+		Hash(1, &rq.Hash).
+		Func(2, func(s string) (err error) {
+			if s != "-" {
+				rq.From, err = time.Parse(time.RFC3339, s)
+			}
+			return err
+		}).
+		Func(3, func(s string) (err error) {
+			if s != "-" {
+				rq.Until, err = time.Parse(time.RFC3339, s)
+			}
+			return err
+		}).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseMaintMessage tries to parse a 'maint' message.
+func parseMaintMessage(args []string) (interface{}, error) {
+	var rq MaintenanceRequest
+	err := bifrost.Args(args).
+		Func(0, func(s string) (err error) {
+			rq.Duration, err = parseMilliseconds(s)
+			return err
+		}).
+		Optional().
+		String(1, &rq.Reason).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseNoteMessage tries to parse a 'note' message.
+func parseNoteMessage(args []string) (interface{}, error) {
+	var rq SetListNoteRequest
+	err := bifrost.Args(args).
+		String(0, &rq.Note).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parsePlaysMessage tries to parse a 'plays' message.
+func parsePlaysMessage(args []string) (interface{}, error) {
+	var rq PlayHistoryRequest
+	args, opts, err := bifrost.SplitQuery(args, "at", "hash", "payload")
+	if err != nil {
+		return nil, err
+	}
+	rq.Options = opts
+	err = bifrost.Args(args).
+		Optional().
+		Int(0, &rq.Count).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parsePromoteMessage tries to parse a 'promote' message.
+func parsePromoteMessage(args []string) (interface{}, error) {
+	var rq PromoteRequest
+	err := bifrost.Args(args).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseRdumpMessage tries to parse a 'rdump' message.
+func parseRdumpMessage(args []string) (interface{}, error) {
+	var rq RangeDumpRequest
+	args, opts, err := bifrost.SplitQuery(args, "index", "hash", "type", "payload", "note", "category")
+	if err != nil {
+		return nil, err
+	}
+	rq.Options = opts
+	err = bifrost.Args(args).
+		Int(0, &rq.Start).
+		Int(1, &rq.Count).
+		Optional().
+		String(2, &rq.Category).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseReadyMessage tries to parse a 'ready' message.
+func parseReadyMessage(args []string) (interface{}, error) {
+	var rq HandoverReadyRequest
+	err := bifrost.Args(args).
+		Int(0, &rq.Index).
+		Hash(1, &rq.Hash).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseReleaseMessage tries to parse a 'release' message.
+func parseReleaseMessage(args []string) (interface{}, error) {
+	var rq ReleaseRequest
+	err := bifrost.Args(args).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseSdropMessage tries to parse a 'sdrop' message.
+func parseSdropMessage(args []string) (interface{}, error) {
+	var rq DropScratchRequest
+	err := bifrost.Args(args).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseSdumpMessage tries to parse a 'sdump' message.
+func parseSdumpMessage(args []string) (interface{}, error) {
+	var rq ScratchDumpRequest
+	err := bifrost.Args(args).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseSelMessage tries to parse a 'sel' message.
+func parseSelMessage(args []string) (interface{}, error) {
+	var rq SetSelectRequest
+	err := bifrost.Args(args).
+		Int(0, &rq.Index).
+		Hash(1, &rq.Hash).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseSepMessage tries to parse a 'sep' message.
+func parseSepMessage(args []string) (interface{}, error) {
+	var rq SeparatorRequest
+	err := bifrost.Args(args).
+		Int(0, &rq.Index).
+		String(1, &rq.Name).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseSpromoteMessage tries to parse a 'spromote' message.
+func parseSpromoteMessage(args []string) (interface{}, error) {
+	var rq PromoteScratchRequest
+	err := bifrost.Args(args).
+		Int(0, &rq.Index).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseUnblockMessage tries to parse an 'unblock' message.
+func parseUnblockMessage(args []string) (interface{}, error) {
+	var rq DissolveBlockRequest
+	err := bifrost.Args(args).
+		Hash(0, &rq.ID).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseUpcomingMessage tries to parse an 'upcoming' message.
+func parseUpcomingMessage(args []string) (interface{}, error) {
+	var rq UpcomingRequest
+	err := bifrost.Args(args).
+		Optional().
+		Int(0, &rq.Count).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return rq, nil
+}
+
+// parseAlertResponse tries to parse an 'ALERT' message.
+func parseAlertResponse(args []string) (interface{}, error) {
+	var r AlertResponse
+	err := bifrost.Args(args).
+		String(0, &r.Key).
+		Func(1, func(s string) (err error) {
+			r.Severity, err = ParseAlertSeverity(s)
+			return err
+		}).
+		Func(2, func(s string) (err error) {
+			r.Since, err = time.Parse(time.RFC3339, s)
+			return err
+		}).
+		Int(3, &r.Count).
+		String(4, &r.Message).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseAlertclrResponse tries to parse an 'ALERTCLR' message.
+func parseAlertclrResponse(args []string) (interface{}, error) {
+	var r AlertClearedResponse
+	err := bifrost.Args(args).
+		String(0, &r.Key).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseAutoResponse tries to parse an 'AUTO' message.
+func parseAutoResponse(args []string) (interface{}, error) {
+	var r AutoModeResponse
+	err := bifrost.Args(args).
+		Func(0, func(s string) (err error) {
+			r.AutoMode, err = ParseAutoMode(s)
+			return err
+		}).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseBlockResponse tries to parse a 'BLOCK' message.
+func parseBlockResponse(args []string) (interface{}, error) {
+	var r BlockResponse
+	err := bifrost.Args(args).
+		Hash(0, &r.ID).
+		Int(1, &r.Index).
+		Int(2, &r.Count).
+		Func(3, func(s string) (err error) {
+			r.Collapsed, err = strconv.ParseBool(s)
+			return err
+		}).
+		String(4, &r.Title).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseBlockclrResponse tries to parse a 'BLOCKCLR' message.
+func parseBlockclrResponse(args []string) (interface{}, error) {
+	var r BlockClearedResponse
+	err := bifrost.Args(args).
+		Hash(0, &r.ID).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseChangedResponse tries to parse a 'CHANGED' message.
+func parseChangedResponse(args []string) (interface{}, error) {
+	var r ItemsChangedResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Start).
+		Int(1, &r.Count).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseChecksumResponse tries to parse a 'CHECKSUM' message.
+func parseChecksumResponse(args []string) (interface{}, error) {
+	var r ChecksumResponse
+	err := bifrost.Args(args).
+		Uint(0, &r.Version).
+		String(1, &r.Checksum).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseCountlResponse tries to parse a 'COUNTL' message.
+func parseCountlResponse(args []string) (interface{}, error) {
+	var r CountResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Count).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseDiffResponse tries to parse a 'DIFF' message.
+func parseDiffResponse(args []string) (interface{}, error) {
+	var r DiffResponse
+	err := bifrost.Args(args).
+		Uint(0, &r.From).
+		Uint(1, &r.To).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseDriftResponse tries to parse a 'DRIFT' message.
+func parseDriftResponse(args []string) (interface{}, error) {
+	var r DriftResponse
+	err := bifrost.Args(args).
+		Func(0, func(s string) (err error) {
+			r.Drift, err = parseMilliseconds(s)
+			return err
+		}).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseDupeResponse tries to parse a 'DUPE' message.
+func parseDupeResponse(args []string) (interface{}, error) {
+	var r DuplicateResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Index).
+		Hash(1, &r.Hash).
+		Int(2, &r.OfIndex).
+		Hash(3, &r.OfHash).
+		String(4, &r.Reason).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseEmergencyResponse tries to parse an 'EMERGENCY' message.
+func parseEmergencyResponse(args []string) (interface{}, error) {
+	var r EmergencyResponse
+	err := bifrost.Args(args).
+		Func(0, func(s string) (err error) {
+			if s != "-" {
+				r.Since, err = time.Parse(time.RFC3339, s)
+			}
+			return err
+		}).
+		Optional().
+		String(1, &r.Reason).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseHashResponse tries to parse a 'HASH' message.
+func parseHashResponse(args []string) (interface{}, error) {
+	var r HashStateResponse
+	err := bifrost.Args(args).
+		Hash(0, &r.Hash).
+		Int(1, &r.Index).
+		String(2, &r.State).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseHandoverResponse tries to parse a 'HANDOVER' message.
+func parseHandoverResponse(args []string) (interface{}, error) {
+	var r HandoverResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Index).
+		Hash(1, &r.Hash).
+		String(2, &r.State).
+		Func(3, func(s string) (err error) {
+			if s != "-" {
+				r.Planned, err = time.Parse(time.RFC3339, s)
+			}
+			return err
+		}).
+		Func(4, func(s string) (err error) {
+			if s != "-" {
+				r.Duration, err = parseMilliseconds(s)
+			}
+			return err
+		}).
+		Func(5, func(s string) (err error) {
+			if s != "-" {
+				r.Due, err = time.Parse(time.RFC3339, s)
+			}
+			return err
+		}).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseHandoverclrResponse tries to parse a 'HANDOVERCLR' message.
+func parseHandoverclrResponse(args []string) (interface{}, error) {
+	var r HandoverClearedResponse
+	err := bifrost.Args(args).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseFoundResponse tries to parse a 'FOUND' message.
+func parseFoundResponse(args []string) (interface{}, error) {
+	var r FoundResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Index).
+		Hash(1, &r.Hash).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseIcatResponse tries to parse an 'ICAT' message.
+func parseIcatResponse(args []string) (interface{}, error) {
+	var r ItemCategoryResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Index).
+		Hash(1, &r.Hash).
+		Optional().
+		String(2, &r.Category).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseIdelResponse tries to parse an 'IDEL' message.
+func parseIdelResponse(args []string) (interface{}, error) {
+	var r ItemRemoveResponse
+	err := bifrost.Args(args).
+		Hash(0, &r.Hash).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseIdispResponse tries to parse an 'IDISP' message.
+func parseIdispResponse(args []string) (interface{}, error) {
+	var r ItemDisplayResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Index).
+		Hash(1, &r.Hash).
+		Func(2, func(s string) (err error) {
+			r.Markup, err = ParseMarkup(s)
+			return err
+		}).
+		Func(3, func(s string) (err error) {
+			r.Severity, err = ParseAlertSeverity(s)
+			return err
+		}).
+		Func(4, func(s string) (err error) {
+			if s != "-" {
+				r.Colour = s
+			}
+			return err
+		}).
+		Func(5, func(s string) (err error) {
+			r.Hold, err = parseMilliseconds(s)
+			return err
+		}).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseIexpiredResponse tries to parse an 'IEXPIRED' message.
+func parseIexpiredResponse(args []string) (interface{}, error) {
+	var r ItemExpiredResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Index).
+		Hash(1, &r.Hash).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseImoveResponse tries to parse an 'IMOVE' message.
+func parseImoveResponse(args []string) (interface{}, error) {
+	var r ItemMoveResponse
+	err := bifrost.Args(args).
+		Hash(0, &r.Hash).
+		Int(1, &r.Index).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseInoteResponse tries to parse an 'INOTE' message.
+func parseInoteResponse(args []string) (interface{}, error) {
+	var r ItemNoteResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Index).
+		Hash(1, &r.Hash).
+		Optional().
+		String(2, &r.Note).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseIplaysResponse tries to parse an 'IPLAYS' message.
+func parseIplaysResponse(args []string) (interface{}, error) {
+	var r ItemPlaysResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Index).
+		Hash(1, &r.Hash).
+		Int(2, &r.Count).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseItextResponse tries to parse an 'ITEXT' message.
+func parseItextResponse(args []string) (interface{}, error) {
+	var r ItemTextResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Index).
+		Hash(1, &r.Hash).
+		String(2, &r.Text).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseItimeResponse tries to parse an 'ITIME' message.
+func parseItimeResponse(args []string) (interface{}, error) {
+	var r ItemTimingResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Index).
+		Hash(1, &r.Hash).
+		Func(2, func(s string) (err error) {
+			if s != "-" {
+				r.Planned, err = time.Parse(time.RFC3339, s)
+			}
+			return err
+		}).
+		Func(3, func(s string) (err error) {
+			if s != "-" {
+				r.Duration, err = parseMilliseconds(s)
+			}
+			return err
+		}).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseIvalidResponse tries to parse an 'IVALID' message.
+func parseIvalidResponse(args []string) (interface{}, error) {
+	var r ItemValidityResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Index).
+		Hash(1, &r.Hash).
+		Func(2, func(s string) (err error) {
+			if s != "-" {
+				r.From, err = time.Parse(time.RFC3339, s)
+			}
+			return err
+		}).
+		Func(3, func(s string) (err error) {
+			if s != "-" {
+				r.Until, err = time.Parse(time.RFC3339, s)
+			}
+			return err
+		}).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseMaintResponse tries to parse a 'MAINT' message.
+func parseMaintResponse(args []string) (interface{}, error) {
+	var r MaintenanceResponse
+	err := bifrost.Args(args).
+		Func(0, func(s string) (err error) {
+			if s != "-" {
+				r.Until, err = time.Parse(time.RFC3339, s)
+			}
+			return err
+		}).
+		Optional().
+		String(1, &r.Reason).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseNoteResponse tries to parse a 'NOTE' message.
+func parseNoteResponse(args []string) (interface{}, error) {
+	var r ListNoteResponse
+	err := bifrost.Args(args).
+		Optional().
+		String(0, &r.Note).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parsePlayedResponse tries to parse a 'PLAYED' message.
+func parsePlayedResponse(args []string) (interface{}, error) {
+	var r PlayedResponse
+	err := bifrost.Args(args).
+		Func(0, func(s string) (err error) {
+			r.At, err = time.Parse(time.RFC3339, s)
+			return err
+		}).
+		Hash(1, &r.Hash).
+		String(2, &r.Payload).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseSelResponse tries to parse a 'SEL' message.
+func parseSelResponse(args []string) (interface{}, error) {
+	var r SelectResponse
+	err := bifrost.Args(args).
+		Int(0, &r.Index).
+		Hash(1, &r.Hash).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseVerResponse tries to parse a 'VER' message.
+func parseVerResponse(args []string) (interface{}, error) {
+	var r VersionResponse
+	err := bifrost.Args(args).
+		Uint(0, &r.Version).
+		Err()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// handleAlert handles converting a AlertResponse r into messages for tag t.
+func handleAlert(t string, r AlertResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 5)
+	args[0] = r.Key
+	args[1] = r.Severity.String()
+	args[2] = r.Since.Format(time.RFC3339)
+	args[3] = strconv.Itoa(r.Count)
+	args[4] = r.Message
+	msgTx <- *message.New(t, RsAlert).AddArgs(args...)
+	return nil
+}
+
+// handleAlertCleared handles converting a AlertClearedResponse r into messages for tag t.
+func handleAlertCleared(t string, r AlertClearedResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 1)
+	args[0] = r.Key
+	msgTx <- *message.New(t, RsAlertclr).AddArgs(args...)
+	return nil
+}
+
+// handleAutoMode handles converting a AutoModeResponse r into messages for tag t.
+func handleAutoMode(t string, r AutoModeResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 1)
+	args[0] = r.AutoMode.String()
+	msgTx <- *message.New(t, RsAuto).AddArgs(args...)
+	return nil
+}
+
+// handleBlock handles converting a BlockResponse r into messages for tag t.
+func handleBlock(t string, r BlockResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 5)
+	args[0] = r.ID
+	args[1] = strconv.Itoa(r.Index)
+	args[2] = strconv.Itoa(r.Count)
+	args[3] = strconv.FormatBool(r.Collapsed)
+	args[4] = r.Title
+	msgTx <- *message.New(t, RsBlock).AddArgs(args...)
+	return nil
+}
+
+// handleBlockCleared handles converting a BlockClearedResponse r into messages for tag t.
+func handleBlockCleared(t string, r BlockClearedResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 1)
+	args[0] = r.ID
+	msgTx <- *message.New(t, RsBlockclr).AddArgs(args...)
+	return nil
+}
+
+// handleItemsChanged handles converting a ItemsChangedResponse r into messages for tag t.
+func handleItemsChanged(t string, r ItemsChangedResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 2)
+	args[0] = strconv.Itoa(r.Start)
+	args[1] = strconv.Itoa(r.Count)
+	msgTx <- *message.New(t, RsChanged).AddArgs(args...)
+	return nil
+}
+
+// handleChecksum handles converting a ChecksumResponse r into messages for tag t.
+func handleChecksum(t string, r ChecksumResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 2)
+	args[0] = strconv.FormatUint(r.Version, 10)
+	args[1] = r.Checksum
+	msgTx <- *message.New(t, RsChecksum).AddArgs(args...)
+	return nil
+}
+
+// handleCount handles converting a CountResponse r into messages for tag t.
+func handleCount(t string, r CountResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 1)
+	args[0] = strconv.Itoa(r.Count)
+	msgTx <- *message.New(t, RsCountl).AddArgs(args...)
+	return nil
+}
+
+// handleDiff handles converting a DiffResponse r into messages for tag t.
+func handleDiff(t string, r DiffResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 2)
+	args[0] = strconv.FormatUint(r.From, 10)
+	args[1] = strconv.FormatUint(r.To, 10)
+	msgTx <- *message.New(t, RsDiff).AddArgs(args...)
+	return nil
+}
+
+// handleDrift handles converting a DriftResponse r into messages for tag t.
+func handleDrift(t string, r DriftResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 1)
+	args[0] = formatMilliseconds(r.Drift)
+	msgTx <- *message.New(t, RsDrift).AddArgs(args...)
+	return nil
+}
+
+// handleDuplicate handles converting a DuplicateResponse r into messages for tag t.
+func handleDuplicate(t string, r DuplicateResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 5)
+	args[0] = strconv.Itoa(r.Index)
+	args[1] = r.Hash
+	args[2] = strconv.Itoa(r.OfIndex)
+	args[3] = r.OfHash
+	args[4] = r.Reason
+	msgTx <- *message.New(t, RsDupe).AddArgs(args...)
+	return nil
+}
+
+// handleEmergency handles converting a EmergencyResponse r into messages for tag t.
+func handleEmergency(t string, r EmergencyResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 2)
+	args[0] = "-"
+	if !(r.Since.IsZero()) {
+		args[0] = r.Since.Format(time.RFC3339)
+	}
+	args[1] = r.Reason
+	msgTx <- *message.New(t, RsEmergency).AddArgs(args...)
+	return nil
+}
+
+// handleHashState handles converting a HashStateResponse r into messages for tag t.
+func handleHashState(t string, r HashStateResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 3)
+	args[0] = r.Hash
+	args[1] = strconv.Itoa(r.Index)
+	args[2] = r.State
+	msgTx <- *message.New(t, RsHash).AddArgs(args...)
+	return nil
+}
+
+// handleHandover handles converting a HandoverResponse r into messages for tag t.
+func handleHandover(t string, r HandoverResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 6)
+	args[0] = strconv.Itoa(r.Index)
+	args[1] = r.Hash
+	args[2] = r.State
+	args[3] = "-"
+	if !(r.Planned.IsZero()) {
+		args[3] = r.Planned.Format(time.RFC3339)
+	}
+	args[4] = "-"
+	if !(r.Duration == 0) {
+		args[4] = formatMilliseconds(r.Duration)
+	}
+	args[5] = "-"
+	if !(r.Due.IsZero()) {
+		args[5] = r.Due.Format(time.RFC3339)
+	}
+	msgTx <- *message.New(t, RsHandover).AddArgs(args...)
+	return nil
+}
+
+// handleHandoverCleared handles converting a HandoverClearedResponse r into messages for tag t.
+func handleHandoverCleared(t string, r HandoverClearedResponse, msgTx chan<- message.Message) error {
+	msgTx <- *message.New(t, RsHandoverclr)
+	return nil
+}
+
+// handleFound handles converting a FoundResponse r into messages for tag t.
+func handleFound(t string, r FoundResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 2)
+	args[0] = strconv.Itoa(r.Index)
+	args[1] = r.Hash
+	msgTx <- *message.New(t, RsFound).AddArgs(args...)
+	return nil
+}
+
+// handleItemCategory handles converting a ItemCategoryResponse r into messages for tag t.
+func handleItemCategory(t string, r ItemCategoryResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 3)
+	args[0] = strconv.Itoa(r.Index)
+	args[1] = r.Hash
+	args[2] = r.Category
+	msgTx <- *message.New(t, RsIcat).AddArgs(args...)
+	return nil
+}
+
+// handleItemRemove handles converting a ItemRemoveResponse r into messages for tag t.
+func handleItemRemove(t string, r ItemRemoveResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 1)
+	args[0] = r.Hash
+	msgTx <- *message.New(t, RsIdel).AddArgs(args...)
+	return nil
+}
+
+// handleItemDisplay handles converting a ItemDisplayResponse r into messages for tag t.
+func handleItemDisplay(t string, r ItemDisplayResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 6)
+	args[0] = strconv.Itoa(r.Index)
+	args[1] = r.Hash
+	args[2] = r.Markup.String()
+	args[3] = r.Severity.String()
+	args[4] = "-"
+	if !(r.Colour == "") {
+		args[4] = r.Colour
+	}
+	args[5] = formatMilliseconds(r.Hold)
+	msgTx <- *message.New(t, RsIdisp).AddArgs(args...)
+	return nil
+}
+
+// handleItemExpired handles converting a ItemExpiredResponse r into messages for tag t.
+func handleItemExpired(t string, r ItemExpiredResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 2)
+	args[0] = strconv.Itoa(r.Index)
+	args[1] = r.Hash
+	msgTx <- *message.New(t, RsIexpired).AddArgs(args...)
+	return nil
+}
+
+// handleItemMove handles converting a ItemMoveResponse r into messages for tag t.
+func handleItemMove(t string, r ItemMoveResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 2)
+	args[0] = r.Hash
+	args[1] = strconv.Itoa(r.Index)
+	msgTx <- *message.New(t, RsImove).AddArgs(args...)
+	return nil
+}
+
+// handleItemNote handles converting a ItemNoteResponse r into messages for tag t.
+func handleItemNote(t string, r ItemNoteResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 3)
+	args[0] = strconv.Itoa(r.Index)
+	args[1] = r.Hash
+	args[2] = r.Note
+	msgTx <- *message.New(t, RsInote).AddArgs(args...)
+	return nil
+}
+
+// handleItemPlays handles converting a ItemPlaysResponse r into messages for tag t.
+func handleItemPlays(t string, r ItemPlaysResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 3)
+	args[0] = strconv.Itoa(r.Index)
+	args[1] = r.Hash
+	args[2] = strconv.Itoa(r.Count)
+	msgTx <- *message.New(t, RsIplays).AddArgs(args...)
+	return nil
+}
+
+// handleItemText handles converting a ItemTextResponse r into messages for tag t.
+func handleItemText(t string, r ItemTextResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 3)
+	args[0] = strconv.Itoa(r.Index)
+	args[1] = r.Hash
+	args[2] = r.Text
+	msgTx <- *message.New(t, RsItext).AddArgs(args...)
+	return nil
+}
+
+// handleItemTiming handles converting a ItemTimingResponse r into messages for tag t.
+func handleItemTiming(t string, r ItemTimingResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 4)
+	args[0] = strconv.Itoa(r.Index)
+	args[1] = r.Hash
+	args[2] = "-"
+	if !(r.Planned.IsZero()) {
+		args[2] = r.Planned.Format(time.RFC3339)
+	}
+	args[3] = "-"
+	if !(r.Duration == 0) {
+		args[3] = formatMilliseconds(r.Duration)
+	}
+	msgTx <- *message.New(t, RsItime).AddArgs(args...)
+	return nil
+}
+
+// handleItemValidity handles converting a ItemValidityResponse r into messages for tag t.
+func handleItemValidity(t string, r ItemValidityResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 4)
+	args[0] = strconv.Itoa(r.Index)
+	args[1] = r.Hash
+	args[2] = "-"
+	if !(r.From.IsZero()) {
+		args[2] = r.From.Format(time.RFC3339)
+	}
+	args[3] = "-"
+	if !(r.Until.IsZero()) {
+		args[3] = r.Until.Format(time.RFC3339)
+	}
+	msgTx <- *message.New(t, RsIvalid).AddArgs(args...)
+	return nil
+}
+
+// handleMaintenance handles converting a MaintenanceResponse r into messages for tag t.
+func handleMaintenance(t string, r MaintenanceResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 2)
+	args[0] = "-"
+	if !(r.Until.IsZero()) {
+		args[0] = r.Until.Format(time.RFC3339)
+	}
+	args[1] = r.Reason
+	msgTx <- *message.New(t, RsMaint).AddArgs(args...)
+	return nil
+}
+
+// handleListNote handles converting a ListNoteResponse r into messages for tag t.
+func handleListNote(t string, r ListNoteResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 1)
+	args[0] = r.Note
+	msgTx <- *message.New(t, RsNote).AddArgs(args...)
+	return nil
+}
+
+// handlePlayed handles converting a PlayedResponse r into messages for tag t.
+func handlePlayed(t string, r PlayedResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 3)
+	args[0] = r.At.Format(time.RFC3339)
+	args[1] = r.Hash
+	args[2] = r.Payload
+	msgTx <- *message.New(t, RsPlayed).AddArgs(args...)
+	return nil
+}
+
+// handleSelect handles converting a SelectResponse r into messages for tag t.
+func handleSelect(t string, r SelectResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 2)
+	args[0] = strconv.Itoa(r.Index)
+	args[1] = r.Hash
+	msgTx <- *message.New(t, RsSel).AddArgs(args...)
+	return nil
+}
+
+// handleVersion handles converting a VersionResponse r into messages for tag t.
+func handleVersion(t string, r VersionResponse, msgTx chan<- message.Message) error {
+	args := make([]string, 1)
+	args[0] = strconv.FormatUint(r.Version, 10)
+	msgTx <- *message.New(t, RsVer).AddArgs(args...)
+	return nil
+}
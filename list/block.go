@@ -0,0 +1,363 @@
+package list
+
+// File block.go contains blocks: named runs of adjacent items, such as an ad break or a news bed, that clients can
+// collapse, move, or remove as one.
+//
+// Each item belongs to at most one block, and a block's items are always adjacent.
+// An item added between two items of the same block joins it, and a block goes when its last item does.
+// Blocks are announced, in dumps after the items and whenever a request changes them, with
+//
+//	BLOCK <id> <index> <count> <collapsed> <title>
+//
+// meaning that the count items from index, and no others, make up the block; and with 'BLOCKCLR <id>' once a block is
+// gone.
+// Clients that don't know about blocks can ignore both: moving a block is also announced with an IMOVE per item, and
+// removing one with an IDEL per item, so the flat list stays in step.
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// Block is the definition of a block of items.
+type Block struct {
+	// ID identifies the block within its list.
+	ID string
+	// Title is the block's title, such as 'Ad break 2'.
+	Title string
+	// Collapsed is true if displays should show the block as one line, rather than item by item.
+	Collapsed bool
+}
+
+// Block returns the ID of the block the Item belongs to, or "" if it isn't in one.
+func (i *Item) Block() string {
+	return i.block
+}
+
+// joinedBlock gets the block that an item added between the items prev and next, either of which may be nil, joins.
+func joinedBlock(prev, next *Item) string {
+	if prev == nil || next == nil || prev.block != next.block {
+		return ""
+	}
+	return prev.block
+}
+
+// blockResponses gets a BlockResponse for each of the blocks defined in defs, in the order they start in items.
+func blockResponses(items []Item, defs map[string]Block) []BlockResponse {
+	var rs []BlockResponse
+	for i := range items {
+		id := items[i].block
+		switch {
+		case id == "":
+		case 0 < i && items[i-1].block == id:
+			rs[len(rs)-1].Count++
+		default:
+			d := defs[id]
+			rs = append(rs, BlockResponse{ID: id, Index: i, Count: 1, Collapsed: d.Collapsed, Title: d.Title})
+		}
+	}
+	return rs
+}
+
+// blockRange gets the index of the first item of the block id in items, and how many items it has.
+func blockRange(items []Item, id string) (start, count int) {
+	start = -1
+	for i := range items {
+		if items[i].block != id {
+			continue
+		}
+		if start == -1 {
+			start = i
+		}
+		count++
+	}
+	return start, count
+}
+
+// Blocks gets the blocks in l, in the order they start, along with the items they hold.
+func (l *List) Blocks() []BlockResponse {
+	return blockResponses(l.Freeze(), l.blocks)
+}
+
+// blockResponse gets the announcement of the block id in l.
+func (l *List) blockResponse(id string) BlockResponse {
+	start, count := blockRange(l.Freeze(), id)
+	d := l.blocks[id]
+	return BlockResponse{ID: id, Index: start, Count: count, Collapsed: d.Collapsed, Title: d.Title}
+}
+
+// checkedBlock gets the definition of the block id in l, failing if there isn't one; op names the operation for
+// errors.
+func (l *List) checkedBlock(op, id string) (Block, error) {
+	d, ok := l.blocks[id]
+	if !ok {
+		return d, fmt.Errorf("%s: no block %s", op, id)
+	}
+	return d, nil
+}
+
+// NewBlock makes the count items from index into a new block with the given ID and title.
+// It fails if the ID is in use, or any of the items doesn't exist or is already in a block.
+func (l *List) NewBlock(id string, index, count int, title string) error {
+	if _, ok := l.blocks[id]; ok {
+		return fmt.Errorf("NewBlock: block %s already exists", id)
+	}
+	if count < 1 {
+		return fmt.Errorf("NewBlock: a block needs at least one item")
+	}
+
+	var items []*Item
+	for i, e := index, l.elementWithIndex(index); i < index+count; i, e = i+1, e.Next() {
+		if e == nil {
+			return fmt.Errorf("NewBlock: index %d out of bounds", i)
+		}
+		item := e.Value.(*Item)
+		if item.block != "" {
+			return fmt.Errorf("NewBlock: item %s is already in block %s", item.hash, item.block)
+		}
+		items = append(items, item)
+	}
+
+	for _, item := range items {
+		item.block = id
+	}
+	l.blocks[id] = Block{ID: id, Title: title}
+	return nil
+}
+
+// SetBlock changes the title of the block id, and whether it is collapsed.
+// It returns whether the block has changed.
+func (l *List) SetBlock(id string, collapsed bool, title string) (bool, error) {
+	d, err := l.checkedBlock("SetBlock", id)
+	if err != nil {
+		return false, err
+	}
+	nd := Block{ID: id, Title: title, Collapsed: collapsed}
+	l.blocks[id] = nd
+	return d != nd, nil
+}
+
+// DissolveBlock removes the block id, leaving its items where they are.
+func (l *List) DissolveBlock(id string) error {
+	if _, err := l.checkedBlock("DissolveBlock", id); err != nil {
+		return err
+	}
+	l.clearBlock(id)
+	return nil
+}
+
+// clearBlock removes the block id, if there is one, leaving its items where they are.
+func (l *List) clearBlock(id string) {
+	for e := l.list.Front(); e != nil; e = e.Next() {
+		if item := e.Value.(*Item); item.block == id {
+			item.block = ""
+		}
+	}
+	delete(l.blocks, id)
+}
+
+// MoveBlock moves the items of the block id, keeping their order, so that the first lands at index.
+// The index counts items as if the block had already been taken out of the list.
+// It returns the responses announcing each item's move, if any.
+// It fails if the block doesn't exist, the index is out of bounds, or it would put the block inside another.
+func (l *List) MoveBlock(id string, index int) ([]interface{}, error) {
+	if _, err := l.checkedBlock("MoveBlock", id); err != nil {
+		return nil, err
+	}
+	items := l.Freeze()
+	start, count := blockRange(items, id)
+	if count == 0 {
+		return nil, fmt.Errorf("MoveBlock: block %s is empty", id)
+	}
+
+	rest := make([]Item, 0, len(items)-count)
+	rest = append(append(rest, items[:start]...), items[start+count:]...)
+	if index < 0 || len(rest) < index {
+		return nil, fmt.Errorf("MoveBlock: index %d out of bounds", index)
+	}
+	if 0 < index && index < len(rest) {
+		if b := joinedBlock(&rest[index-1], &rest[index]); b != "" {
+			return nil, fmt.Errorf("MoveBlock: index %d is inside block %s", index, b)
+		}
+	}
+	if index == start {
+		return nil, nil
+	}
+
+	rs := make([]interface{}, count)
+	for k := 0; k < count; k++ {
+		rs[k] = ItemMoveResponse{Hash: items[start+k].hash, Index: index + k}
+	}
+	if start < index {
+		// Moving items down the list one by one, first to last, would leave earlier ones behind later ones.
+		for i, j := 0, len(rs)-1; i < j; i, j = i+1, j-1 {
+			rs[i], rs[j] = rs[j], rs[i]
+		}
+	}
+	for _, r := range rs {
+		m := r.(ItemMoveResponse)
+		if err := l.moveItem(m.Hash, m.Index); err != nil {
+			return nil, fmt.Errorf("MoveBlock: %w", err)
+		}
+	}
+	return rs, nil
+}
+
+// moveItem moves the item with hash h to index i, keeping the same item selected.
+func (l *List) moveItem(h string, i int) error {
+	j, e := l.elementWithHash(h)
+	if e == nil {
+		return fmt.Errorf("can't move missing item %s", h)
+	}
+	if i < 0 || l.list.Len() <= i {
+		return fmt.Errorf("can't move item %s to index %d", h, i)
+	}
+
+	_, sel := l.Selection()
+	l.list.Remove(e)
+	if i == 0 {
+		l.list.PushFront(e.Value)
+	} else {
+		l.list.InsertAfter(e.Value, l.elementWithIndex(i-1))
+	}
+	if sel != nil && j != i {
+		l.selection, _ = l.elementWithHash(sel.hash)
+	}
+	return nil
+}
+
+// RemoveBlock removes the block id and all of its items.
+// It returns the responses announcing each item's removal.
+// It fails if the block doesn't exist or holds the selection.
+func (l *List) RemoveBlock(id string) ([]interface{}, error) {
+	if _, err := l.checkedBlock("RemoveBlock", id); err != nil {
+		return nil, err
+	}
+	if _, sel := l.Selection(); sel != nil && sel.block == id {
+		return nil, fmt.Errorf("RemoveBlock: block %s holds the selected item %s", id, sel.hash)
+	}
+
+	var rs []interface{}
+	i := 0
+	for e := l.list.Front(); e != nil; {
+		next := e.Next()
+		if item := e.Value.(*Item); item.block == id {
+			l.removeElement(i, e)
+			rs = append(rs, ItemRemoveResponse{Hash: item.hash})
+		} else {
+			i++
+		}
+		e = next
+	}
+	delete(l.blocks, id)
+	return rs, nil
+}
+
+// applyBlock makes the items in the range r announces, and no others, the block r.ID, defining it as r says.
+func (l *List) applyBlock(r BlockResponse) error {
+	if r.Count < 1 || r.Index < 0 || l.list.Len() < r.Index+r.Count {
+		return fmt.Errorf("can't apply block %s at %d+%d", r.ID, r.Index, r.Count)
+	}
+	i := 0
+	for e := l.list.Front(); e != nil; e = e.Next() {
+		item := e.Value.(*Item)
+		switch {
+		case r.Index <= i && i < r.Index+r.Count:
+			item.block = r.ID
+		case item.block == r.ID:
+			item.block = ""
+		}
+		i++
+	}
+	l.blocks[r.ID] = Block{ID: r.ID, Title: r.Title, Collapsed: r.Collapsed}
+	return nil
+}
+
+// forgetEmptyBlock removes the definition of the block id, if none of l's items are in it any more.
+func (l *List) forgetEmptyBlock(id string) {
+	if id == "" {
+		return
+	}
+	for e := l.list.Front(); e != nil; e = e.Next() {
+		if e.Value.(*Item).block == id {
+			return
+		}
+	}
+	delete(l.blocks, id)
+}
+
+// blockStates gets copies of the definitions of l's blocks, in ID order.
+func (l *List) blockStates() []Block {
+	bs := make([]Block, 0, len(l.blocks))
+	for _, b := range l.blocks {
+		bs = append(bs, b)
+	}
+	sort.Slice(bs, func(i, j int) bool { return bs[i].ID < bs[j].ID })
+	return bs
+}
+
+// copyBlocks gets a copy of the block definitions bs.
+func copyBlocks(bs map[string]Block) map[string]Block {
+	c := make(map[string]Block, len(bs))
+	for k, b := range bs {
+		c[k] = b
+	}
+	return c
+}
+
+// handleNewBlockRequest handles a new block request for List l.
+func (l *List) handleNewBlockRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b NewBlockRequest) error {
+	if err := l.NewBlock(b.ID, b.Index, b.Count, b.Title); err != nil {
+		return err
+	}
+	bcastCb(l.blockResponse(b.ID))
+	return nil
+}
+
+// handleSetBlockRequest handles a block change request for List l.
+func (l *List) handleSetBlockRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b SetBlockRequest) error {
+	changed, err := l.SetBlock(b.ID, b.Collapsed, b.Title)
+	if err == nil && changed {
+		bcastCb(l.blockResponse(b.ID))
+	}
+	return err
+}
+
+// handleDissolveBlockRequest handles a block dissolution request for List l.
+func (l *List) handleDissolveBlockRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b DissolveBlockRequest) error {
+	if err := l.DissolveBlock(b.ID); err != nil {
+		return err
+	}
+	bcastCb(BlockClearedResponse(b))
+	return nil
+}
+
+// handleMoveBlockRequest handles a block move request for List l.
+func (l *List) handleMoveBlockRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b MoveBlockRequest) error {
+	rs, err := l.MoveBlock(b.ID, b.Index)
+	if err != nil {
+		return err
+	}
+	for _, r := range rs {
+		bcastCb(r)
+	}
+	if len(rs) != 0 {
+		bcastCb(l.blockResponse(b.ID))
+	}
+	return nil
+}
+
+// handleRemoveBlockRequest handles a block removal request for List l.
+func (l *List) handleRemoveBlockRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b RemoveBlockRequest) error {
+	rs, err := l.RemoveBlock(b.ID)
+	if err != nil {
+		return err
+	}
+	for _, r := range rs {
+		bcastCb(r)
+	}
+	bcastCb(BlockClearedResponse{ID: b.ID})
+	return nil
+}
@@ -0,0 +1,103 @@
+package list
+
+// File call.go contains typed call-and-wait helpers, for in-process subsystems that want to make a request of a list's
+// Controller and get its result back without handling raw responses themselves.
+//
+// Each helper sends one request through a controller.Client and waits for it to be acknowledged, so the usual caveats of
+// controller.Client.Call apply: they return controller.ErrControllerShutDown if the request can't be sent, and
+// they mustn't be used from anything the Controller is waiting on.
+// As the Controller also sends broadcasts to client, something else must keep draining the Client's Rx.
+
+import (
+	"context"
+	"errors"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// DumpList gets a snapshot of the list behind client, as a Mirror seeded with a dump.
+func DumpList(ctx context.Context, client *controller.Client) (*Mirror, error) {
+	rbodies, err := client.CallReplies(ctx, controller.DumpRequest{})
+	if err != nil {
+		return nil, err
+	}
+	m := NewMirror()
+	for _, rbody := range rbodies {
+		m.Apply(rbody)
+	}
+	return m, nil
+}
+
+// SetAutoMode sets the automode of the list behind client to mode.
+func SetAutoMode(ctx context.Context, client *controller.Client, mode AutoMode) error {
+	return client.Call(ctx, SetAutoModeRequest{AutoMode: mode})
+}
+
+// Select selects the item at index index, with hash hash, in the list behind client.
+// It fails if the item at index doesn't have that hash.
+func Select(ctx context.Context, client *controller.Client, index int, hash string) error {
+	return client.Call(ctx, SetSelectRequest{Index: index, Hash: hash})
+}
+
+// AddItem enqueues item in front of index index in the list behind client.
+func AddItem(ctx context.Context, client *controller.Client, index int, item Item) error {
+	return client.Call(ctx, AddItemRequest{Index: index, Item: item})
+}
+
+// Search gets the items in the list behind client that match query in the SearchField field.
+func Search(ctx context.Context, client *controller.Client, query, field string) ([]FoundResponse, error) {
+	rbodies, err := client.CallReplies(ctx, SearchRequest{Query: query, Field: field})
+	if err != nil {
+		return nil, err
+	}
+	var found []FoundResponse
+	for _, rbody := range rbodies {
+		if f, ok := rbody.(FoundResponse); ok {
+			found = append(found, f)
+		}
+	}
+	return found, nil
+}
+
+// GetChecksum gets the checksum of the list behind client, and the version it is of.
+func GetChecksum(ctx context.Context, client *controller.Client) (ChecksumResponse, error) {
+	rbodies, err := client.CallReplies(ctx, ChecksumRequest{})
+	if err != nil {
+		return ChecksumResponse{}, err
+	}
+	for _, rbody := range rbodies {
+		if r, ok := rbody.(ChecksumResponse); ok {
+			return r, nil
+		}
+	}
+	return ChecksumResponse{}, errors.New("list sent no checksum")
+}
+
+// GetState gets a copy of the state of the list behind client, for example to keep a snapshot of it.
+func GetState(ctx context.Context, client *controller.Client) (State, error) {
+	rbodies, err := client.CallReplies(ctx, StateRequest{})
+	if err != nil {
+		return State{}, err
+	}
+	for _, rbody := range rbodies {
+		if r, ok := rbody.(stateResponse); ok {
+			return r.st, nil
+		}
+	}
+	return State{}, errors.New("list sent no state")
+}
+
+// Upcoming gets up to count tracks likely to be selected next on the list behind client, most likely first.
+func Upcoming(ctx context.Context, client *controller.Client, count int) ([]ItemResponse, error) {
+	rbodies, err := client.CallReplies(ctx, UpcomingRequest{Count: count})
+	if err != nil {
+		return nil, err
+	}
+	var upcoming []ItemResponse
+	for _, rbody := range rbodies {
+		if r, ok := rbody.(ItemResponse); ok {
+			upcoming = append(upcoming, r)
+		}
+	}
+	return upcoming, nil
+}
@@ -0,0 +1,66 @@
+package list
+
+// File category.go contains Category, the type of item categories, and the List logic for defining them.
+
+import "fmt"
+
+// Category is a definition of an item category (for example, jingle, music, speech, or advert).
+type Category struct {
+	// Name is the name by which items refer to the category.
+	Name string
+	// Colour is a client-interpreted colour hint for the category, for example "#ff8800".
+	Colour string
+}
+
+// DefineCategories replaces the set of categories items in l may have.
+// If no categories are defined, items may have any category.
+func (l *List) DefineCategories(cats []Category) {
+	l.categories = append([]Category(nil), cats...)
+}
+
+// Categories gets a copy of the categories defined on l.
+func (l *List) Categories() []Category {
+	return append([]Category(nil), l.categories...)
+}
+
+// checkCategory checks whether cat is a category items in l may have.
+// The empty category, meaning 'uncategorised', is always allowed.
+func (l *List) checkCategory(cat string) error {
+	if cat == "" || len(l.categories) == 0 {
+		return nil
+	}
+	for _, c := range l.categories {
+		if c.Name == cat {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown category: %s", cat)
+}
+
+// SetItemCategory changes the category of the item with the given index and hash.
+// It returns whether the category has changed.
+// It fails if the item doesn't exist, has a different hash, or cat isn't a defined category.
+func (l *List) SetItemCategory(index int, hash, cat string) (changed bool, err error) {
+	if err = l.checkCategory(cat); err != nil {
+		return
+	}
+
+	var i *Item
+	if i, err = l.checkedItem("SetItemCategory", index, hash); err != nil {
+		return
+	}
+
+	changed = cat != i.category
+	i.category = cat
+	return
+}
+
+// ItemCategory gets the category of the item with the given index and hash.
+// It fails if the item doesn't exist or has a different hash.
+func (l *List) ItemCategory(index int, hash string) (string, error) {
+	i, err := l.checkedItem("ItemCategory", index, hash)
+	if err != nil {
+		return "", err
+	}
+	return i.category, nil
+}
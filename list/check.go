@@ -0,0 +1,87 @@
+package list
+
+// File check.go contains the List logic for checking a batch of hashes at once.
+//
+// A client coming back from a dropped connection can check the hashes it has cached, rather than dumping the whole
+// list, and then fetch only what has changed.
+// Hashes that aren't in the list are told apart by whether the list still remembers them from a recent version (see
+// diff.go): such hashes were removed, and others the list knows nothing about.
+
+import (
+	"context"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+const (
+	// HashSelected is the state of the selected item.
+	HashSelected = "selected"
+	// HashQueued is the state of items that are in the list, and could be selected now.
+	HashQueued = "queued"
+	// HashEmbargoed is the state of items that are in the list, but can't be selected until their valid-from time.
+	HashEmbargoed = "embargoed"
+	// HashExpired is the state of items that are in the list, but can't be selected after their valid-until time.
+	HashExpired = "expired"
+	// HashRemoved is the state of hashes that were removed from the list in one of the versions it remembers.
+	HashRemoved = "removed"
+	// HashUnknown is the state of hashes that the list knows nothing about.
+	HashUnknown = "unknown"
+)
+
+// CheckHashes gets the index and state, at time now, of each of hashes, in the order given.
+func (l *List) CheckHashes(hashes []string, now time.Time) []HashStateResponse {
+	indices := make(map[string]int, l.list.Len())
+	items := make(map[string]*Item, l.list.Len())
+	i := 0
+	for e := l.list.Front(); e != nil; e = e.Next() {
+		item := e.Value.(*Item)
+		indices[item.hash] = i
+		items[item.hash] = item
+		i++
+	}
+
+	rs := make([]HashStateResponse, len(hashes))
+	for j, h := range hashes {
+		rs[j] = HashStateResponse{Hash: h, Index: -1, State: HashUnknown}
+		if i, ok := indices[h]; ok {
+			rs[j].Index = i
+			rs[j].State = itemState(items[h], i == l.selection, now)
+		} else if l.rememberedHash(h) {
+			rs[j].State = HashRemoved
+		}
+	}
+	return rs
+}
+
+// itemState gets the state at time now of item, which is selected if selected is true.
+func itemState(item *Item, selected bool, now time.Time) string {
+	if selected {
+		return HashSelected
+	}
+	switch item.ValidAt(now).(type) {
+	case EmbargoError:
+		return HashEmbargoed
+	case ExpiredError:
+		return HashExpired
+	default:
+		return HashQueued
+	}
+}
+
+// rememberedHash gets whether any of the versions l remembers has an item with hash h.
+func (l *List) rememberedHash(h string) bool {
+	for _, s := range l.history {
+		for _, item := range s.items {
+			if item.hash == h {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// handleCheckHashesRequest handles a hash check request for List l.
+func (l *List) handleCheckHashesRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b CheckHashesRequest) error {
+	return replyEach(ctx, replyCb, "sending hash states", l.CheckHashes(b.Hashes, l.clock.Now()))
+}
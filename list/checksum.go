@@ -0,0 +1,48 @@
+package list
+
+// File checksum.go contains the list checksum, which lets clients and mirrors check that their cached copy of a list
+// matches the server's without fetching the whole list.
+//
+// The checksum covers the hashes of the items, in order, and the selection; it doesn't cover anything else about the
+// items, such as their notes, nor the automode or list note.
+// It is for catching copies that have drifted by accident, such as through missed broadcasts, so it is a fast 64-bit
+// FNV-1a hash rather than a cryptographic one.
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// Checksum gets the checksum of a list whose items have hashes hashes, in order, and whose selection is selection,
+// or -1 if it has none, as 16 hex digits.
+func Checksum(hashes []string, selection int) string {
+	h := fnv.New64a()
+	var buf [8]byte
+	for _, hash := range hashes {
+		// Each hash has its length in front, so that no two lists of hashes hash the same bytes.
+		binary.BigEndian.PutUint64(buf[:], uint64(len(hash)))
+		h.Write(buf[:])
+		h.Write([]byte(hash))
+	}
+	binary.BigEndian.PutUint64(buf[:], uint64(int64(selection)))
+	h.Write(buf[:])
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// Checksum gets the checksum of l's items and selection; see the package-level Checksum.
+func (l *List) Checksum() string {
+	hashes := make([]string, 0, l.list.Len())
+	for e := l.list.Front(); e != nil; e = e.Next() {
+		hashes = append(hashes, e.Value.(*Item).hash)
+	}
+	return Checksum(hashes, l.selection)
+}
+
+// handleChecksumRequest handles a request for the checksum of List l.
+func (l *List) handleChecksumRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b ChecksumRequest) error {
+	replyCb(ChecksumResponse{Version: l.version, Checksum: l.Checksum()})
+	return nil
+}
@@ -0,0 +1,93 @@
+package list
+
+// File coalesce.go tells Bifrost adapters which List broadcasts supersede each other, and which describe single items.
+// - See `controller/coalesce.go` for how adapters coalesce broadcasts.
+// - See `controller/region.go` for how adapters fold item broadcasts into regions.
+// - See `controller/caps.go` for how adapters pick broadcasts by class.
+
+import "github.com/MattWindsor91/yaps/controller"
+
+// CoalesceKey gets the coalesce key of the broadcast body rbody.
+// Broadcasts that announce a whole piece of state, such as the selection or an item's note, have keys;
+// broadcasts that change the shape of the list, such as new items, don't.
+func (l *List) CoalesceKey(rbody interface{}) (string, bool) {
+	switch r := rbody.(type) {
+	case AutoModeResponse:
+		return "auto", true
+	case SelectResponse:
+		return "sel", true
+	case ListNoteResponse:
+		return "note", true
+	case DriftResponse:
+		return "drift", true
+	case VersionResponse:
+		return "ver", true
+	case MaintenanceResponse:
+		return "maint", true
+	case EmergencyResponse:
+		return "emergency", true
+	case HandoverResponse, HandoverClearedResponse:
+		return "handover", true
+	case ItemNoteResponse:
+		return "inote " + r.Hash, true
+	case ItemCategoryResponse:
+		return "icat " + r.Hash, true
+	case ItemTimingResponse:
+		return "itime " + r.Hash, true
+	case ItemPlaysResponse:
+		return "iplays " + r.Hash, true
+	case ItemValidityResponse:
+		return "ivalid " + r.Hash, true
+	case ItemDisplayResponse:
+		return "idisp " + r.Hash, true
+	case ItemTextResponse:
+		return "itext " + r.Hash, true
+	case BlockResponse:
+		return "block " + r.ID, true
+	case BlockClearedResponse:
+		return "block " + r.ID, true
+	default:
+		return "", false
+	}
+}
+
+// BroadcastIndex gets the index of the item the broadcast body rbody changes, if rbody only changes one item's state.
+func (l *List) BroadcastIndex(rbody interface{}) (int, bool) {
+	switch r := rbody.(type) {
+	case ItemNoteResponse:
+		return r.Index, true
+	case ItemCategoryResponse:
+		return r.Index, true
+	case ItemTimingResponse:
+		return r.Index, true
+	case ItemPlaysResponse:
+		return r.Index, true
+	case ItemValidityResponse:
+		return r.Index, true
+	case ItemDisplayResponse:
+		return r.Index, true
+	case ItemTextResponse:
+		return r.Index, true
+	default:
+		return 0, false
+	}
+}
+
+// BroadcastClass gets the class of the broadcast body rbody: item details, other than the text of text items, blocks,
+// and the list's note are metadata, and news of alerts, drift, maintenance, emergencies and expiry is status.
+func (l *List) BroadcastClass(rbody interface{}) controller.BroadcastClass {
+	switch rbody.(type) {
+	case ListNoteResponse, ItemNoteResponse, ItemCategoryResponse, ItemTimingResponse, ItemPlaysResponse, ItemValidityResponse,
+		ItemDisplayResponse, BlockResponse, BlockClearedResponse:
+		return controller.BroadcastMeta
+	case AlertResponse, AlertClearedResponse, DriftResponse, MaintenanceResponse, EmergencyResponse, ItemExpiredResponse:
+		return controller.BroadcastStatus
+	default:
+		return controller.BroadcastCore
+	}
+}
+
+// RegionBroadcast gets the broadcast body announcing that count items, from index start, have changed.
+func (l *List) RegionBroadcast(start, count int) interface{} {
+	return ItemsChangedResponse{Start: start, Count: count}
+}
@@ -3,8 +3,10 @@ package list
 // File controller.go defines the specific Controller logic for lists.
 
 import (
+	"context"
 	"fmt"
 
+	"github.com/MattWindsor91/yaps/bifrost"
 	"github.com/MattWindsor91/yaps/controller"
 )
 
@@ -43,6 +45,11 @@ func (l *List) selectResponse() SelectResponse {
 	return SelectResponse{Index: index, Hash: hash}
 }
 
+// listNoteResponse returns l's note as a response.
+func (l *List) listNoteResponse() ListNoteResponse {
+	return ListNoteResponse{Note: l.Note()}
+}
+
 // freezeResponse returns l's frozen representation as a response.
 func (l *List) freezeResponse() FreezeResponse {
 	return l.Freeze()
@@ -52,17 +59,84 @@ func (l *List) freezeResponse() FreezeResponse {
 func (l *List) Dump(dumpCb controller.ResponseCb) {
 	// SPEC: see https://universityradioyork.github.io/baps3-spec/protocol/roles/list
 	dumpCb(l.autoModeResponse())
+	dumpCb(CategoriesResponse(l.Categories()))
 	dumpCb(l.freezeResponse())
+	for _, r := range l.Blocks() {
+		dumpCb(r)
+	}
+	for _, r := range l.playsResponses() {
+		dumpCb(r)
+	}
 	dumpCb(l.selectResponse())
+	if r, ok := l.Handover(); ok {
+		dumpCb(r)
+	}
+	dumpCb(l.listNoteResponse())
+	// Drift is only announced with a threshold set, so only dumped with one too.
+	if d, ok := l.Drift(); ok && 0 < l.driftThreshold {
+		dumpCb(DriftResponse{Drift: d})
+	}
+	for _, r := range l.Alerts() {
+		dumpCb(r)
+	}
+	if r, ok := l.Maintenance(); ok {
+		dumpCb(r)
+	}
+	if r, ok := l.Emergency(); ok {
+		dumpCb(r)
+	}
+	dumpCb(l.versionResponse())
 	// TODO(@MattWindsor91): other items in dump
 }
 
+// Snapshot gets the responses Dump would send, so that the Controller can send them without holding up l.
+// Every response is a copy: Freeze and Categories copy l's items and categories.
+func (l *List) Snapshot() []interface{} {
+	var snap []interface{}
+	l.Dump(func(rbody interface{}) {
+		snap = append(snap, rbody)
+	})
+	return snap
+}
+
 //
 // Request handling
 //
 
-// HandleRequest handles a request for List l.
-func (l *List) HandleRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, rbody interface{}) error {
+// HandleRequest handles a request, with context ctx, for List l.
+// Requests that send many replies, or add many items, give up if ctx ends.
+func (l *List) HandleRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, rbody interface{}) error {
+	if b, ok := rbody.(DryRunRequest); ok {
+		return l.handleDryRunRequest(ctx, replyCb, b)
+	}
+	if l.replica && mutates(rbody) {
+		return ErrReplica
+	}
+	if err := l.checkEmergency(rbody); err != nil {
+		return err
+	}
+	if err := l.checkMaintenance(rbody); err != nil {
+		return err
+	}
+
+	if b, ok := rbody.(VersionedRequest); ok {
+		if err := l.checkVersion(b); err != nil {
+			return err
+		}
+		rbody = b.Request
+	}
+
+	bcastCb, done := l.versionedBcast(bcastCb)
+	err := l.handleRequest(ctx, replyCb, bcastCb, rbody)
+	l.updateHandover(bcastCb)
+	if serr := done(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// handleRequest dispatches an unversioned request, with context ctx, for List l.
+func (l *List) handleRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, rbody interface{}) error {
 	var err error
 
 	switch b := rbody.(type) {
@@ -72,6 +146,84 @@ func (l *List) HandleRequest(replyCb controller.ResponseCb, bcastCb controller.R
 		err = l.handleSelectRequest(replyCb, bcastCb, b)
 	case AddItemRequest:
 		err = l.handleAddItemRequest(replyCb, bcastCb, b)
+	case SetListNoteRequest:
+		err = l.handleSetListNoteRequest(replyCb, bcastCb, b)
+	case SetItemNoteRequest:
+		err = l.handleSetItemNoteRequest(replyCb, bcastCb, b)
+	case SetItemCategoryRequest:
+		err = l.handleSetItemCategoryRequest(replyCb, bcastCb, b)
+	case GetItemCategoryRequest:
+		err = l.handleGetItemCategoryRequest(replyCb, bcastCb, b)
+	case SetItemTimingRequest:
+		err = l.handleSetItemTimingRequest(replyCb, bcastCb, b)
+	case RangeDumpRequest:
+		err = l.handleRangeDumpRequest(ctx, replyCb, bcastCb, b)
+	case UpcomingRequest:
+		err = l.handleUpcomingRequest(replyCb, bcastCb, b)
+	case ChecksumRequest:
+		err = l.handleChecksumRequest(replyCb, bcastCb, b)
+	case PromoteRequest:
+		err = l.handlePromoteRequest(replyCb, bcastCb, b)
+	case ReplicateRequest:
+		err = l.handleReplicateRequest(replyCb, bcastCb, b)
+	case DiffRequest:
+		err = l.handleDiffRequest(replyCb, bcastCb, b)
+	case SearchRequest:
+		err = l.handleSearchRequest(ctx, replyCb, bcastCb, b)
+	case CheckHashesRequest:
+		err = l.handleCheckHashesRequest(ctx, replyCb, bcastCb, b)
+	case DuplicateRequest:
+		err = l.handleDuplicateRequest(ctx, replyCb, bcastCb, b)
+	case SetItemValidityRequest:
+		err = l.handleSetItemValidityRequest(replyCb, bcastCb, b)
+	case SetItemDisplayRequest:
+		err = l.handleSetItemDisplayRequest(replyCb, bcastCb, b)
+	case SetItemTextRequest:
+		err = l.handleSetItemTextRequest(replyCb, bcastCb, b)
+	case NewBlockRequest:
+		err = l.handleNewBlockRequest(replyCb, bcastCb, b)
+	case SetBlockRequest:
+		err = l.handleSetBlockRequest(replyCb, bcastCb, b)
+	case MoveBlockRequest:
+		err = l.handleMoveBlockRequest(replyCb, bcastCb, b)
+	case RemoveBlockRequest:
+		err = l.handleRemoveBlockRequest(replyCb, bcastCb, b)
+	case DissolveBlockRequest:
+		err = l.handleDissolveBlockRequest(replyCb, bcastCb, b)
+	case ExpireRequest:
+		err = l.handleExpireRequest(replyCb, bcastCb, b)
+	case PlayHistoryRequest:
+		err = l.handlePlayHistoryRequest(ctx, replyCb, bcastCb, b)
+	case PlayLogRequest:
+		err = l.handlePlayLogRequest(ctx, replyCb, bcastCb, b)
+	case RaiseAlertRequest:
+		err = l.handleRaiseAlertRequest(replyCb, bcastCb, b)
+	case ClearAlertRequest:
+		err = l.handleClearAlertRequest(replyCb, bcastCb, b)
+	case AlertsRequest:
+		err = l.handleAlertsRequest(replyCb, bcastCb, b)
+	case CloneRequest:
+		err = l.handleCloneRequest(ctx, replyCb, bcastCb, b)
+	case SeparatorRequest:
+		err = l.handleSeparatorRequest(ctx, replyCb, bcastCb, b)
+	case spliceRequest:
+		err = l.handleSpliceRequest(ctx, replyCb, bcastCb, b)
+	case MaintenanceRequest:
+		err = l.handleMaintenanceRequest(ctx, replyCb, bcastCb, b)
+	case MaintenanceCheckRequest:
+		err = l.handleMaintenanceCheckRequest(replyCb, bcastCb, b)
+	case EmergencyRequest:
+		err = l.handleEmergencyRequest(replyCb, bcastCb, b)
+	case ReleaseRequest:
+		err = l.handleReleaseRequest(ctx, replyCb, bcastCb, b)
+	case HandoverReadyRequest:
+		err = l.handleHandoverReadyRequest(replyCb, bcastCb, b)
+	case EndRequest:
+		err = l.handleEndRequest(replyCb, bcastCb, b)
+	case StateRequest:
+		err = l.handleStateRequest(replyCb, bcastCb, b)
+	case HandoverCheckRequest:
+		err = l.handleHandoverCheckRequest(replyCb, bcastCb, b)
 	default:
 		err = fmt.Errorf("list can't handle this request")
 	}
@@ -92,15 +244,35 @@ func (l *List) handleAutoModeRequest(replyCb controller.ResponseCb, bcastCb cont
 // handleSelectRequest handles a selection change request for List l.
 func (l *List) handleSelectRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b SetSelectRequest) error {
 	changed, err := l.Select(b.Index, b.Hash)
-	if err != nil && changed {
-		bcastCb(l.selectResponse())
+	if err == nil && changed {
+		err = l.announceSelection(bcastCb)
 	}
 
 	return err
 }
 
+// announceSelection broadcasts a change to l's selection, and what comes of it, then logs the play.
+func (l *List) announceSelection(bcastCb controller.ResponseCb) error {
+	bcastCb(l.selectResponse())
+	index, item := l.Selection()
+	if item == nil {
+		return nil
+	}
+	bcastCb(ItemPlaysResponse{Index: index, Hash: item.hash, Count: l.PlayCount(item.hash)})
+	if dr, ok := l.updateDrift(); ok {
+		bcastCb(dr)
+	}
+	return l.logPlay(bcastCb)
+}
+
 // handleAddItemRequest handles an item add request for List l.
 func (l *List) handleAddItemRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b AddItemRequest) error {
+	if l.dedupe {
+		if err := l.checkDuplicate(&b.Item); err != nil {
+			return err
+		}
+	}
+
 	err := l.Add(&b.Item, b.Index)
 	if err == nil {
 		bcastCb(ItemResponse(b))
@@ -108,3 +280,128 @@ func (l *List) handleAddItemRequest(replyCb controller.ResponseCb, bcastCb contr
 
 	return err
 }
+
+// handleSetListNoteRequest handles a list note change request for List l.
+func (l *List) handleSetListNoteRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b SetListNoteRequest) error {
+	if l.SetNote(b.Note) {
+		bcastCb(l.listNoteResponse())
+	}
+	return nil
+}
+
+// handleSetItemNoteRequest handles an item note change request for List l.
+func (l *List) handleSetItemNoteRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b SetItemNoteRequest) error {
+	changed, err := l.SetItemNote(b.Index, b.Hash, b.Note)
+	if err == nil && changed {
+		bcastCb(ItemNoteResponse(b))
+	}
+	return err
+}
+
+// handleSetItemCategoryRequest handles an item category change request for List l.
+func (l *List) handleSetItemCategoryRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b SetItemCategoryRequest) error {
+	changed, err := l.SetItemCategory(b.Index, b.Hash, b.Category)
+	if err == nil && changed {
+		bcastCb(ItemCategoryResponse(b))
+	}
+	return err
+}
+
+// handleGetItemCategoryRequest handles an item category query for List l.
+func (l *List) handleGetItemCategoryRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b GetItemCategoryRequest) error {
+	cat, err := l.ItemCategory(b.Index, b.Hash)
+	if err == nil {
+		replyCb(ItemCategoryResponse{Index: b.Index, Hash: b.Hash, Category: cat})
+	}
+	return err
+}
+
+// handleSetItemTimingRequest handles an item timing change request for List l.
+func (l *List) handleSetItemTimingRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b SetItemTimingRequest) error {
+	changed, err := l.SetItemTiming(b.Index, b.Hash, b.Planned, b.Duration)
+	if err == nil && changed {
+		bcastCb(ItemTimingResponse(b))
+	}
+	return err
+}
+
+// handleRangeDumpRequest handles a ranged dump request, with context ctx, for List l.
+func (l *List) handleRangeDumpRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b RangeDumpRequest) error {
+	if b.Start < 0 || b.Count < 0 {
+		return fmt.Errorf("bad range: start %d, count %d", b.Start, b.Count)
+	}
+	return replyEach(ctx, replyCb, "dumping", bifrost.ApplyQuery(b.Options, l.FreezeRange(b.Start, b.Count, b.Category)))
+}
+
+// handleUpcomingRequest handles a request for the tracks likely to be selected next on List l.
+func (l *List) handleUpcomingRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b UpcomingRequest) error {
+	if b.Count < 0 {
+		return fmt.Errorf("bad count: %d", b.Count)
+	}
+	count := b.Count
+	if count == 0 {
+		count = 1
+	}
+	for _, r := range l.Upcoming(count) {
+		replyCb(r)
+	}
+	return nil
+}
+
+// replyEach sends each of rs through replyCb, giving up with ctx's error if ctx ends first.
+// Sending replies to a slow client can take a while, so this is how long replies are cut short, and how their
+// progress, described by note, is reported.
+func replyEach[T any](ctx context.Context, replyCb controller.ResponseCb, note string, rs []T) error {
+	p := controller.NewProgress(replyCb, note, len(rs))
+	for i, r := range rs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		replyCb(r)
+		p.Step(i + 1)
+	}
+	return nil
+}
+
+// handlePromoteRequest handles a promotion request for List l.
+func (l *List) handlePromoteRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b PromoteRequest) error {
+	if !l.replica {
+		return fmt.Errorf("list is not a replica")
+	}
+	l.SetReplica(false)
+	return nil
+}
+
+// handleReplicateRequest handles a replicated response for List l.
+func (l *List) handleReplicateRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b ReplicateRequest) error {
+	if !l.replica {
+		return fmt.Errorf("list is not a replica")
+	}
+
+	changed, err := l.applyReplicated(b.Response)
+	if err == nil && changed {
+		bcastCb(b.Response)
+	}
+	return err
+}
+
+// Priority gets the priority of a request, with body rbody, to l.
+// Emergencies can't wait at all, selection and automode changes, and handovers, are for presenters and players
+// waiting on air, and item loads may come in bulk.
+func (l *List) Priority(rbody interface{}) controller.Priority {
+	switch b := rbody.(type) {
+	case VersionedRequest:
+		return l.Priority(b.Request)
+	case DryRunRequest:
+		return l.Priority(b.Request)
+	case EmergencyRequest, ReleaseRequest:
+		return controller.PriorityEmergency
+	case SetSelectRequest, SetAutoModeRequest, HandoverReadyRequest, EndRequest:
+		return controller.PriorityOperator
+	case AddItemRequest, RangeDumpRequest, SearchRequest, CheckHashesRequest, DuplicateRequest, PlayHistoryRequest,
+		PlayLogRequest, AlertsRequest, ScratchDumpRequest, StateRequest:
+		return controller.PriorityBulk
+	default:
+		return controller.PriorityNormal
+	}
+}
@@ -0,0 +1,225 @@
+package list
+
+// File diff.go contains the List's memory of recent versions, and the diffs between them.
+//
+// A diff is a series of ordinary responses which, applied in order to a copy of the list at the older version, bring
+// it to the newer one: removals (IDEL) first, then additions (FLOADL/TLOADL) and moves (IMOVE) in index order, then
+// changes to items, blocks, and the list as a whole, ending with the selection if anything could have disturbed it.
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// CodeStale is the error code of StaleErrors.
+const CodeStale = "stale"
+
+// diffHistory is the number of versions, including the current one, that a List can diff from.
+const diffHistory = 64
+
+// StaleError is the error returned when a DiffRequest asks for a version the list doesn't remember.
+type StaleError struct {
+	// Since is the version asked for.
+	Since uint64
+	// Current is the list's current version.
+	Current uint64
+}
+
+// Error gets the error message of a StaleError.
+func (e StaleError) Error() string {
+	return fmt.Sprintf("stale: can't diff from version %d to %d; dump the list instead", e.Since, e.Current)
+}
+
+// Code gets the error code of a StaleError.
+func (StaleError) Code() string {
+	return CodeStale
+}
+
+// versionSnapshot is a copy of the state of a List at one version.
+type versionSnapshot struct {
+	// version is the version the snapshot was taken at.
+	version uint64
+	// items is a copy of the items.
+	items []Item
+	// selection is the selected index, or -1.
+	selection int
+	// note is the list note.
+	note string
+	// autoMode is the autoselect mode.
+	autoMode AutoMode
+	// blocks is a copy of the block definitions.
+	blocks map[string]Block
+}
+
+// remember adds l's current state to its history, forgetting the oldest version if there are too many.
+func (l *List) remember() {
+	if diffHistory <= len(l.history) {
+		l.history = append(l.history[:0], l.history[1:]...)
+	}
+	l.history = append(l.history, versionSnapshot{
+		version:   l.version,
+		items:     l.Freeze(),
+		selection: l.selection,
+		note:      l.note,
+		autoMode:  l.autoselect,
+		blocks:    copyBlocks(l.blocks),
+	})
+}
+
+// remembered gets the snapshot of version v, if l still has it.
+func (l *List) remembered(v uint64) (versionSnapshot, bool) {
+	for _, s := range l.history {
+		if s.version == v {
+			return s, true
+		}
+	}
+	return versionSnapshot{}, false
+}
+
+// handleDiffRequest handles a diff request for List l.
+func (l *List) handleDiffRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b DiffRequest) error {
+	from, ok := l.remembered(b.Since)
+	if !ok {
+		return StaleError{Since: b.Since, Current: l.version}
+	}
+	to, _ := l.remembered(l.version)
+
+	for _, r := range diff(from, to) {
+		replyCb(r)
+	}
+	return nil
+}
+
+// diff gets the responses that bring a copy of the list at from to the state at to, starting with a DiffResponse.
+func diff(from, to versionSnapshot) []interface{} {
+	rs := []interface{}{DiffResponse{From: from.version, To: to.version}}
+
+	// Removals first, so that later indices are relative to the surviving items.
+	present := make(map[string]struct{}, len(to.items))
+	for _, it := range to.items {
+		present[it.hash] = struct{}{}
+	}
+	var cur []string
+	for _, it := range from.items {
+		if _, ok := present[it.hash]; ok {
+			cur = append(cur, it.hash)
+		} else {
+			rs = append(rs, ItemRemoveResponse{Hash: it.hash})
+		}
+	}
+	shaped := len(rs) != 1
+
+	// Then put each item in place, in index order: everything before index i is already where it should be.
+	for i, it := range to.items {
+		if i < len(cur) && cur[i] == it.hash {
+			continue
+		}
+		shaped = true
+		if j := indexOfHash(cur, it.hash); j != -1 {
+			cur = append(cur[:j], cur[j+1:]...)
+			rs = append(rs, ItemMoveResponse{Hash: it.hash, Index: i})
+		} else {
+			rs = append(rs, ItemResponse{Index: i, Item: it})
+		}
+		cur = append(cur[:i], append([]string{it.hash}, cur[i:]...)...)
+	}
+
+	rs = append(rs, itemChanges(from.items, to.items)...)
+	rs = append(rs, blockChanges(from, to, shaped)...)
+	if from.autoMode != to.autoMode {
+		rs = append(rs, AutoModeResponse{AutoMode: to.autoMode})
+	}
+	if from.note != to.note {
+		rs = append(rs, ListNoteResponse{Note: to.note})
+	}
+	if shaped || selectedHash(from) != selectedHash(to) || from.selection != to.selection {
+		rs = append(rs, SelectResponse{Index: to.selection, Hash: selectedHash(to)})
+	}
+	return rs
+}
+
+// itemChanges gets responses announcing the changes to items in both from and to, at their indices in to.
+func itemChanges(from, to []Item) []interface{} {
+	old := make(map[string]Item, len(from))
+	for _, it := range from {
+		old[it.hash] = it
+	}
+
+	var rs []interface{}
+	for i, it := range to {
+		o, ok := old[it.hash]
+		if !ok {
+			// New items arrive whole.
+			continue
+		}
+		if o.payload != it.payload {
+			rs = append(rs, ItemTextResponse{Index: i, Hash: it.hash, Text: it.payload})
+		}
+		if o.note != it.note {
+			rs = append(rs, ItemNoteResponse{Index: i, Hash: it.hash, Note: it.note})
+		}
+		if o.category != it.category {
+			rs = append(rs, ItemCategoryResponse{Index: i, Hash: it.hash, Category: it.category})
+		}
+		if !o.planned.Equal(it.planned) || o.duration != it.duration {
+			rs = append(rs, ItemTimingResponse{Index: i, Hash: it.hash, Planned: it.planned, Duration: it.duration})
+		}
+		if !o.validFrom.Equal(it.validFrom) || !o.validUntil.Equal(it.validUntil) {
+			rs = append(rs, ItemValidityResponse{Index: i, Hash: it.hash, From: it.validFrom, Until: it.validUntil})
+		}
+		if o.display != it.display {
+			rs = append(rs, ItemDisplayResponse{Index: i, Hash: it.hash, DisplayHints: it.display})
+		}
+	}
+	return rs
+}
+
+// blockChanges gets responses announcing the blocks that differ between from and to, or, if the shape of the list has
+// changed, every block in to, as adding items may have put them in the wrong blocks along the way.
+func blockChanges(from, to versionSnapshot, shaped bool) []interface{} {
+	var gone []string
+	for id := range from.blocks {
+		if _, ok := to.blocks[id]; !ok {
+			gone = append(gone, id)
+		}
+	}
+	// Map order is random, and diffs should come out the same every time.
+	sort.Strings(gone)
+
+	var rs []interface{}
+	for _, id := range gone {
+		rs = append(rs, BlockClearedResponse{ID: id})
+	}
+
+	old := make(map[string]BlockResponse, len(from.blocks))
+	for _, r := range blockResponses(from.items, from.blocks) {
+		old[r.ID] = r
+	}
+	for _, r := range blockResponses(to.items, to.blocks) {
+		if o, ok := old[r.ID]; shaped || !ok || o != r {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
+// indexOfHash gets the index of hash in hashes, or -1 if it isn't there.
+func indexOfHash(hashes []string, hash string) int {
+	for i, h := range hashes {
+		if h == hash {
+			return i
+		}
+	}
+	return -1
+}
+
+// selectedHash gets the hash of the item selected in s, or the undefined hash if there isn't one.
+func selectedHash(s versionSnapshot) string {
+	if s.selection < 0 || len(s.items) <= s.selection {
+		// SPEC: as in dumps, the hash of no selection is undefined.
+		return "(undefined)"
+	}
+	return s.items[s.selection].hash
+}
@@ -0,0 +1,144 @@
+package list
+
+// File display.go contains the List logic for text items shown to presenters, such as prompts and cart wall notes.
+//
+// Each text item may carry display hints, telling displays how to show it: its markup, its severity, a colour, and how
+// long to show it for.
+// Hints are only hints: yaps stores and announces them, but doesn't act on them itself.
+// Text items may also be edited in place, keeping their hash and position, so that displays can update a note live
+// rather than removing it and adding a new one.
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// Markup is the type of the markup languages of text items.
+type Markup int
+
+const (
+	// MarkupPlain marks text items as plain text.
+	MarkupPlain Markup = iota
+	// MarkupMarkdown marks text items as Markdown.
+	MarkupMarkdown
+)
+
+// String gets the Bifrost name of a Markup.
+func (m Markup) String() string {
+	switch m {
+	case MarkupPlain:
+		return "plain"
+	case MarkupMarkdown:
+		return "markdown"
+	default:
+		return "?unknown?"
+	}
+}
+
+// ParseMarkup tries to parse a Markup from its Bifrost name.
+func ParseMarkup(s string) (Markup, error) {
+	switch s {
+	case "plain":
+		return MarkupPlain, nil
+	case "markdown":
+		return MarkupMarkdown, nil
+	default:
+		return MarkupPlain, fmt.Errorf("invalid markup: %q", s)
+	}
+}
+
+// colourPattern matches the colours allowed in display hints.
+var colourPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// DisplayHints tells displays how to show a text item.
+// The zero DisplayHints, plain text with no other hints, is the default.
+type DisplayHints struct {
+	// Markup is the markup language of the item's text.
+	Markup Markup
+	// Severity is how urgent the item is.
+	Severity AlertSeverity
+	// Colour is the colour in which to show the item, as '#rrggbb', or "" for the display's choice.
+	Colour string
+	// Hold is how long to show the item for, or 0 for as long as the display likes.
+	Hold time.Duration
+}
+
+// Check checks that h's colour and hold are well-formed.
+func (h DisplayHints) Check() error {
+	if h.Colour != "" && !colourPattern.MatchString(h.Colour) {
+		return fmt.Errorf("colour %q isn't of the form #rrggbb", h.Colour)
+	}
+	if h.Hold < 0 {
+		return fmt.Errorf("hold %s is negative", h.Hold)
+	}
+	return nil
+}
+
+// Display returns the Item's display hints.
+func (i *Item) Display() DisplayHints {
+	return i.display
+}
+
+// checkedText gets the text item with the given index and hash, failing if it doesn't exist or isn't text; op names
+// the operation for errors.
+func (l *List) checkedText(op string, index int, hash string) (*Item, error) {
+	i, err := l.checkedItem(op, index, hash)
+	if err == nil && i.itype != ItemText {
+		err = fmt.Errorf("%s: item %s isn't a text item", op, hash)
+	}
+	return i, err
+}
+
+// SetItemDisplay changes the display hints of the text item with the given index and hash.
+// It returns whether the hints have changed.
+// It fails if the item doesn't exist, has a different hash, isn't a text item, or the hints are malformed.
+func (l *List) SetItemDisplay(index int, hash string, h DisplayHints) (changed bool, err error) {
+	if err = h.Check(); err != nil {
+		return false, fmt.Errorf("SetItemDisplay: %w", err)
+	}
+
+	var i *Item
+	if i, err = l.checkedText("SetItemDisplay", index, hash); err != nil {
+		return
+	}
+
+	changed = i.display != h
+	i.display = h
+	return
+}
+
+// SetItemText changes the text of the text item with the given index and hash, keeping its hash, position and
+// metadata.
+// It returns whether the text has changed.
+// It fails if the item doesn't exist, has a different hash, or isn't a text item.
+func (l *List) SetItemText(index int, hash, text string) (changed bool, err error) {
+	var i *Item
+	if i, err = l.checkedText("SetItemText", index, hash); err != nil {
+		return
+	}
+
+	changed = i.payload != text
+	i.payload = text
+	return
+}
+
+// handleSetItemDisplayRequest handles a text item display hints change request for List l.
+func (l *List) handleSetItemDisplayRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b SetItemDisplayRequest) error {
+	changed, err := l.SetItemDisplay(b.Index, b.Hash, b.DisplayHints)
+	if err == nil && changed {
+		bcastCb(ItemDisplayResponse(b))
+	}
+	return err
+}
+
+// handleSetItemTextRequest handles a text item edit request for List l.
+func (l *List) handleSetItemTextRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b SetItemTextRequest) error {
+	changed, err := l.SetItemText(b.Index, b.Hash, b.Text)
+	if err == nil && changed {
+		bcastCb(ItemTextResponse(b))
+	}
+	return err
+}
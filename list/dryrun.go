@@ -0,0 +1,79 @@
+package list
+
+// File dryrun.go contains dry runs, which tell a client what a request would do to the list without doing it, for
+// scripted changes to a live list.
+//
+// A dry run handles the request on a sandbox: a copy of the list that doesn't save its state, log selections, or
+// broadcast.
+// The client gets the request's replies, then, as further replies, the broadcasts it would have caused, which give the
+// resulting indices, selection and version; if the request would fail, the dry run fails with the same error.
+
+import (
+	"container/list"
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// handleDryRunRequest handles a dry run request, with context ctx, for List l.
+func (l *List) handleDryRunRequest(ctx context.Context, replyCb controller.ResponseCb, b DryRunRequest) error {
+	return l.sandbox().HandleRequest(ctx, replyCb, replyCb, b.Request)
+}
+
+// sandbox gets a copy of l that shares no mutable state with it, and has no effects outside itself.
+func (l *List) sandbox() *List {
+	sb := *l
+
+	sb.list = list.New()
+	for e := l.list.Front(); e != nil; e = e.Next() {
+		item := *(e.Value.(*Item))
+		sb.list.PushBack(&item)
+	}
+
+	sb.playLog = nil
+	sb.saveState = nil
+	sb.plays = l.PlayCounts()
+	sb.played = append([]PlayRecord(nil), l.played...)
+	sb.history = append([]versionSnapshot(nil), l.history...)
+	sb.expired = copySet(l.expired)
+	sb.blocks = copyBlocks(l.blocks)
+	sb.usedHashes = copySet(l.usedHashes)
+	if l.handover != nil {
+		h := *l.handover
+		sb.handover = &h
+	}
+
+	sb.alerts = make(map[string]*alert, len(l.alerts))
+	for k, a := range l.alerts {
+		ac := *a
+		sb.alerts[k] = &ac
+	}
+	sb.alertSent = make(map[string]time.Time, len(l.alertSent))
+	for k, t := range l.alertSent {
+		sb.alertSent[k] = t
+	}
+
+	sb.scratchpads = make(map[controller.Session][]*Item, len(l.scratchpads))
+	for s, items := range l.scratchpads {
+		sb.scratchpads[s] = make([]*Item, len(items))
+		for i, item := range items {
+			ic := *item
+			sb.scratchpads[s][i] = &ic
+		}
+	}
+
+	// Shuffling mustn't use up l's random numbers.
+	sb.rng = rand.New(rand.NewSource(time.Now().UnixNano()))
+	return &sb
+}
+
+// copySet gets a copy of the hash set s.
+func copySet(s map[string]struct{}) map[string]struct{} {
+	c := make(map[string]struct{}, len(s))
+	for k := range s {
+		c[k] = struct{}{}
+	}
+	return c
+}
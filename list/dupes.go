@@ -0,0 +1,145 @@
+package list
+
+// File dupes.go contains the List logic for spotting tracks queued more than once.
+//
+// Two tracks are duplicates if they have the same path, or failing that the same title.
+// yaps doesn't read tags, so a track's title is its file name, less any extension and leading track number,
+// lowercased, with punctuation ignored: 'music/01 - Blue Monday.mp3' and 'old/blue_monday.flac' share a title.
+// Text items are never duplicates: links and idents are often read more than once.
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// CodeDuplicate is the error code of DuplicateErrors.
+const CodeDuplicate = "duplicate"
+
+const (
+	// DupePayload is the reason given for duplicates with the same path.
+	DupePayload = "payload"
+	// DupeTitle is the reason given for duplicates with different paths but the same title.
+	DupeTitle = "title"
+)
+
+// DuplicateError is the error returned when a list that dedupes refuses a track it already has.
+type DuplicateError struct {
+	// Of is the item in the list that the new track duplicates.
+	Of DuplicateResponse
+}
+
+// Error gets the error message of a DuplicateError.
+func (e DuplicateError) Error() string {
+	return fmt.Sprintf("duplicate: same %s as item %d (%s)", e.Of.Reason, e.Of.OfIndex, e.Of.OfHash)
+}
+
+// Code gets the error code of a DuplicateError.
+func (DuplicateError) Code() string {
+	return CodeDuplicate
+}
+
+// SetDedupe sets whether l refuses, with a DuplicateError, client requests to add tracks it already has.
+// Replicated additions are always accepted, so that replicas stay faithful to their primary.
+func (l *List) SetDedupe(dedupe bool) {
+	l.dedupe = dedupe
+}
+
+// Duplicates gets a report of every track in l that duplicates an earlier one, in list order.
+// Each duplicate points at the first item it duplicates.
+func (l *List) Duplicates() []DuplicateResponse {
+	type first struct {
+		index int
+		hash  string
+	}
+	paths := make(map[string]first)
+	titles := make(map[string]first)
+
+	var dupes []DuplicateResponse
+	i := 0
+	for e := l.list.Front(); e != nil; e, i = e.Next(), i+1 {
+		item := e.Value.(*Item)
+		if item.itype != ItemTrack {
+			continue
+		}
+
+		p, t := path.Clean(item.payload), trackTitle(item.payload)
+		if f, ok := paths[p]; ok {
+			dupes = append(dupes, DuplicateResponse{Index: i, Hash: item.hash, OfIndex: f.index, OfHash: f.hash, Reason: DupePayload})
+			continue
+		}
+		paths[p] = first{index: i, hash: item.hash}
+
+		if t == "" {
+			continue
+		}
+		if f, ok := titles[t]; ok {
+			dupes = append(dupes, DuplicateResponse{Index: i, Hash: item.hash, OfIndex: f.index, OfHash: f.hash, Reason: DupeTitle})
+			continue
+		}
+		titles[t] = first{index: i, hash: item.hash}
+	}
+	return dupes
+}
+
+// checkDuplicate fails with a DuplicateError if item is a track duplicating one already in l.
+func (l *List) checkDuplicate(item *Item) error {
+	if item.itype != ItemTrack {
+		return nil
+	}
+
+	p, t := path.Clean(item.payload), trackTitle(item.payload)
+	i := 0
+	for e := l.list.Front(); e != nil; e, i = e.Next(), i+1 {
+		other := e.Value.(*Item)
+		if other.itype != ItemTrack {
+			continue
+		}
+
+		reason := ""
+		switch {
+		case path.Clean(other.payload) == p:
+			reason = DupePayload
+		case t != "" && trackTitle(other.payload) == t:
+			reason = DupeTitle
+		default:
+			continue
+		}
+		return DuplicateError{Of: DuplicateResponse{Index: -1, Hash: item.hash, OfIndex: i, OfHash: other.hash, Reason: reason}}
+	}
+	return nil
+}
+
+// trackTitle gets the title yaps assumes the track at path p has: see the top of this file.
+func trackTitle(p string) string {
+	base := path.Base(strings.ReplaceAll(p, "\\", "/"))
+	base = strings.TrimSuffix(base, path.Ext(base))
+
+	words := strings.FieldsFunc(strings.ToLower(base), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	// Drop the track number, but not a title that is all numbers.
+	if 1 < len(words) && isNumber(words[0]) {
+		words = words[1:]
+	}
+	return strings.Join(words, " ")
+}
+
+// isNumber gets whether s consists only of digits.
+func isNumber(s string) bool {
+	for _, r := range s {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// handleDuplicateRequest handles a duplicate report request for List l.
+func (l *List) handleDuplicateRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b DuplicateRequest) error {
+	return replyEach(ctx, replyCb, "sending duplicates", l.Duplicates())
+}
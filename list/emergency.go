@@ -0,0 +1,171 @@
+package list
+
+// File emergency.go contains the List logic for emergencies: the panic button that puts a fail-safe track, such as an
+// evergreen sustainer or an apology loop, on air at once, and holds it there until someone has sorted things out.
+//
+// An EmergencyRequest selects the fail-safe track, adding it after the selection if the list doesn't already have it,
+// whether or not it is valid now.
+// Until an admin releases the emergency, every client hears EMERGENCY and a critical 'emergency' alert, and every
+// other request that would change the list fails with the code 'emergency'.
+// Emergency requests go through even during maintenance, and overtake every other request waiting on the list.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+const (
+	// CodeEmergency is the error code of EmergencyErrors.
+	CodeEmergency = "emergency"
+	// AlertKeyEmergency is the key of alerts about emergencies.
+	AlertKeyEmergency = "emergency"
+)
+
+// ErrNoFailsafe is the error returned for emergencies on lists with no fail-safe track.
+var ErrNoFailsafe = errors.New("no fail-safe track to put on air")
+
+// EmergencyError is the error returned when a client tries to change the list during an emergency.
+type EmergencyError struct {
+	// Since is when the emergency started.
+	Since time.Time
+	// Reason is what the emergency is, if given.
+	Reason string
+}
+
+// Error gets the error message of an EmergencyError.
+func (e EmergencyError) Error() string {
+	msg := "list is locked by an emergency since " + e.Since.Format(time.RFC3339)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// Code gets the error code of an EmergencyError.
+func (EmergencyError) Code() string {
+	return CodeEmergency
+}
+
+// emergency is the List's record of an emergency.
+type emergency struct {
+	// since is when the emergency started, or the zero time if there isn't one.
+	since time.Time
+	// reason is what the emergency is.
+	reason string
+}
+
+// active gets whether e is a current emergency.
+func (e emergency) active() bool {
+	return !e.since.IsZero()
+}
+
+// response gets the announcement of e.
+func (e emergency) response() EmergencyResponse {
+	return EmergencyResponse{Since: e.since, Reason: e.reason}
+}
+
+// SetFailsafe sets the payload of the track l puts on air in an emergency; empty, the default, means l has none.
+func (l *List) SetFailsafe(payload string) {
+	l.failsafe = payload
+}
+
+// Emergency gets the announcement of l's emergency, and whether l has one.
+func (l *List) Emergency() (EmergencyResponse, bool) {
+	return l.emergency.response(), l.emergency.active()
+}
+
+// checkEmergency checks whether l may handle the request body rbody during any emergency.
+func (l *List) checkEmergency(rbody interface{}) error {
+	if !l.emergency.active() || overridesLocks(rbody) || !mutates(rbody) {
+		return nil
+	}
+	return EmergencyError{Since: l.emergency.since, Reason: l.emergency.reason}
+}
+
+// overridesLocks checks whether the request body rbody goes through even while the list is locked.
+func overridesLocks(rbody interface{}) bool {
+	switch rbody.(type) {
+	case EmergencyRequest, ReleaseRequest:
+		return true
+	default:
+		return false
+	}
+}
+
+// failsafeTrack finds the fail-safe track in l, adding it after the selection if l doesn't have it.
+// It returns the track's index and hash.
+func (l *List) failsafeTrack(bcastCb controller.ResponseCb) (int, string, error) {
+	i := 0
+	for e := l.list.Front(); e != nil; e = e.Next() {
+		if item := e.Value.(*Item); item.Type() == ItemTrack && item.payload == l.failsafe {
+			return i, item.hash, nil
+		}
+		i++
+	}
+
+	hash, err := FreshHash()
+	if err != nil {
+		return 0, "", err
+	}
+	item := NewTrack(hash, l.failsafe)
+	i = l.selection + 1
+	if err := l.Add(item, i); err != nil {
+		return 0, "", err
+	}
+	bcastCb(ItemResponse{Index: i, Item: *item})
+	return i, hash, nil
+}
+
+// handleEmergencyRequest handles an emergency for List l.
+func (l *List) handleEmergencyRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b EmergencyRequest) error {
+	if l.failsafe == "" {
+		return ErrNoFailsafe
+	}
+
+	index, hash, err := l.failsafeTrack(bcastCb)
+	if err != nil {
+		return err
+	}
+	// The fail-safe goes to air whatever its validity says.
+	changed, err := l.selectAt(index, hash, time.Time{})
+	if err != nil {
+		return err
+	}
+	if changed {
+		if err := l.announceSelection(bcastCb); err != nil {
+			return err
+		}
+	}
+
+	if !l.emergency.active() {
+		l.emergency.since = l.clock.Now()
+	}
+	l.emergency.reason = b.Reason
+	bcastCb(l.emergency.response())
+
+	msg := "emergency: the fail-safe track is on air, and the list is locked"
+	if b.Reason != "" {
+		msg = fmt.Sprintf("%s: %s", msg, b.Reason)
+	}
+	l.raiseAlert(bcastCb, AlertKeyEmergency, AlertCritical, msg)
+	return nil
+}
+
+// handleReleaseRequest handles the release, with context ctx, of any emergency on List l.
+// Only maintenance admins may release emergencies (see SetMaintenanceAdmins).
+func (l *List) handleReleaseRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b ReleaseRequest) error {
+	if err := l.checkMaintainer(ctx); err != nil {
+		return err
+	}
+	if !l.emergency.active() {
+		return nil
+	}
+	l.emergency = emergency{}
+	bcastCb(EmergencyResponse{})
+	l.clearAlert(bcastCb, AlertKeyEmergency)
+	return nil
+}
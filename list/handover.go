@@ -0,0 +1,324 @@
+package list
+
+// File handover.go contains the List logic for gapless handovers from the selection to the item after it.
+//
+// With handovers on (see SetHandoverTimeout), the list predicts the item it will move on to once the selection ends,
+// and announces it with its timing, so that a player that can go from one track straight into the next can ready it.
+// The player says it is ready with 'ready', and that the selection is ending with 'end'; the list only moves on once
+// both have happened, so that it never selects an item the player can't start at once.
+// If the selection ends before the player is ready, the list waits up to the handover timeout, then moves on anyway,
+// raising an alert; if the item can no longer be selected by then, the list falls back on its automode.
+//
+// Without handovers, or without an item to hand over to, 'end' just moves on by the automode.
+// The list doesn't watch the clock itself: RunHandover sends it HandoverCheckRequests when a wait is due to run out.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/clock"
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+const (
+	// HandoverPending is the state of handovers the player hasn't yet said it is ready for.
+	HandoverPending = "pending"
+	// HandoverReady is the state of handovers the player is ready for.
+	HandoverReady = "ready"
+	// HandoverWaiting is the state of handovers whose selection has ended before the player was ready.
+	HandoverWaiting = "waiting"
+
+	// AlertKeyHandover is the key of alerts about handovers the player wasn't ready for in time.
+	AlertKeyHandover = "handover"
+)
+
+// handover is the List's record of the item it will hand over to.
+type handover struct {
+	// from is the hash of the selection being handed over from.
+	from string
+	// index is the index of the item being handed over to.
+	index int
+	// hash is the hash of the item being handed over to.
+	hash string
+	// drawn is true if the shuffle drew the item, so that it is spent unless handed over to.
+	drawn bool
+	// ready is true once the player has said it is ready for the item.
+	ready bool
+}
+
+// ending is the List's record of a selection that has ended before the player was ready to move on from it.
+type ending struct {
+	// hash is the hash of the selection, or empty if it hasn't ended.
+	hash string
+	// due is when the list stops waiting for the player.
+	due time.Time
+}
+
+// SetHandoverTimeout sets how long l waits for the player to be ready for a handover once the selection has ended;
+// 0, the default, turns handovers off.
+func (l *List) SetHandoverTimeout(d time.Duration) {
+	l.handoverTimeout = d
+}
+
+// Handover gets the announcement of l's handover, and whether l has one.
+func (l *List) Handover() (HandoverResponse, bool) {
+	h := l.handover
+	if h == nil {
+		return HandoverResponse{}, false
+	}
+
+	r := HandoverResponse{Index: h.index, Hash: h.hash, State: HandoverPending}
+	switch {
+	case h.ready:
+		r.State = HandoverReady
+	case l.ending.hash != "":
+		r.State = HandoverWaiting
+		r.Due = l.ending.due
+	}
+	if item := l.ItemWithIndex(h.index); item != nil {
+		r.Planned, r.Duration = item.planned, item.duration
+	}
+	return r, true
+}
+
+// updateHandover predicts l's handover again after a request, broadcasting any change to its announcement.
+func (l *List) updateHandover(bcastCb controller.ResponseCb) {
+	l.handover = l.predictHandover()
+
+	r, ok := l.Handover()
+	switch {
+	case ok && (l.handoverSent == nil || *l.handoverSent != r):
+		l.handoverSent = &r
+		bcastCb(r)
+	case !ok && l.handoverSent != nil:
+		l.handoverSent = nil
+		bcastCb(HandoverClearedResponse{})
+	}
+}
+
+// predictHandover predicts the handover l should have now.
+// The player's readiness carries over from the old handover if it is to the same item from the same selection.
+func (l *List) predictHandover() *handover {
+	_, sel := l.Selection()
+	if sel == nil || sel.hash != l.ending.hash {
+		l.ending = ending{}
+	}
+
+	old := l.handover
+	var next *handover
+	if sel != nil && 0 < l.handoverTimeout && !l.replica {
+		switch l.autoselect {
+		case AutoNext:
+			next = l.nextHandover()
+		case AutoShuffle:
+			next = l.shuffleHandover(old, sel.hash)
+		}
+	}
+
+	if old != nil && old.drawn && (next == nil || next.hash != old.hash) && (sel == nil || sel.hash != old.hash) {
+		// The shuffle won't be playing the item it drew after all, so can draw it again.
+		delete(l.usedHashes, old.hash)
+	}
+	if next == nil {
+		return nil
+	}
+	next.from = sel.hash
+	if old != nil && old.from == next.from && old.hash == next.hash {
+		next.ready = old.ready
+	}
+	return next
+}
+
+// nextHandover finds the first track after the selection that can go to air now.
+func (l *List) nextHandover() *handover {
+	now := l.clock.Now()
+	i := l.selection
+	for e := l.elementWithIndex(l.selection).Next(); e != nil; e = e.Next() {
+		i++
+		if item := e.Value.(*Item); item.Type() == ItemTrack && item.ValidAt(now) == nil {
+			return &handover{index: i, hash: item.hash}
+		}
+	}
+	return nil
+}
+
+// shuffleHandover keeps the item the shuffle drew for the old handover, if it was from selection from and can still
+// go to air; otherwise, it draws a track the shuffle hasn't used, if there is one.
+func (l *List) shuffleHandover(old *handover, from string) *handover {
+	now := l.clock.Now()
+	if old != nil && old.drawn && old.from == from {
+		if i, item := l.ItemWithHash(old.hash); item != nil && item.ValidAt(now) == nil {
+			return &handover{index: i, hash: old.hash, drawn: true}
+		}
+	}
+
+	var candidates []*handover
+	i := 0
+	for e := l.list.Front(); e != nil; e = e.Next() {
+		item := e.Value.(*Item)
+		_, used := l.usedHashes[item.hash]
+		if i != l.selection && !used && item.Type() == ItemTrack && item.ValidAt(now) == nil {
+			candidates = append(candidates, &handover{index: i, hash: item.hash, drawn: true})
+		}
+		i++
+	}
+	// Running out of tracks leaves the shuffle to start afresh when the selection ends, as it does without handovers.
+	if len(candidates) == 0 {
+		return nil
+	}
+	h := candidates[l.rng.Intn(len(candidates))]
+	l.usedHashes[h.hash] = struct{}{}
+	return h
+}
+
+// handOver moves l on from its selection: to the item being handed over to, if there is one, and otherwise, or if
+// that item can no longer be selected, by the automode.
+func (l *List) handOver(bcastCb controller.ResponseCb) error {
+	h := l.handover
+	l.handover, l.ending = nil, ending{}
+
+	var (
+		changed bool
+		err     error
+	)
+	if h != nil {
+		changed, err = l.Select(h.index, h.hash)
+	}
+	if h == nil || err != nil {
+		_, changed = l.Next()
+	}
+	if !changed {
+		return nil
+	}
+	return l.announceSelection(bcastCb)
+}
+
+// handleHandoverReadyRequest handles the player being ready for a handover for List l.
+func (l *List) handleHandoverReadyRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b HandoverReadyRequest) error {
+	h := l.handover
+	if h == nil || h.index != b.Index || h.hash != b.Hash {
+		return fmt.Errorf("Ready: not handing over to item %d (%s)", b.Index, b.Hash)
+	}
+	h.ready = true
+	if l.ending.hash == "" {
+		return nil
+	}
+	l.clearAlert(bcastCb, AlertKeyHandover)
+	return l.handOver(bcastCb)
+}
+
+// handleEndRequest handles the selection ending for List l.
+func (l *List) handleEndRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b EndRequest) error {
+	if _, err := l.checkedItem("End", b.Index, b.Hash); err != nil {
+		return err
+	}
+	if b.Index != l.selection {
+		return fmt.Errorf("End: item %d isn't selected", b.Index)
+	}
+
+	switch h := l.handover; {
+	case h == nil:
+		return l.handOver(bcastCb)
+	case h.ready:
+		l.clearAlert(bcastCb, AlertKeyHandover)
+		return l.handOver(bcastCb)
+	case l.ending.hash == "":
+		l.ending = ending{hash: b.Hash, due: l.clock.Now().Add(l.handoverTimeout)}
+	}
+	return nil
+}
+
+// handoverNextResponse is the reply to a HandoverCheckRequest, saying when the list should next be checked.
+type handoverNextResponse struct {
+	// at is when the next check is due, or the zero time if none is.
+	at time.Time
+}
+
+// handleHandoverCheckRequest handles a handover check for List l.
+func (l *List) handleHandoverCheckRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b HandoverCheckRequest) error {
+	var err error
+	if l.ending.hash != "" && !l.clock.Now().Before(l.ending.due) {
+		if h := l.handover; h != nil {
+			l.raiseAlert(bcastCb, AlertKeyHandover, AlertWarning,
+				fmt.Sprintf("the player wasn't ready for %s in time, so it went to air anyway", h.hash))
+		}
+		err = l.handOver(bcastCb)
+	}
+	replyCb(handoverNextResponse{at: l.ending.due})
+	return err
+}
+
+// RunHandover sends HandoverCheckRequests through client whenever the list is due to stop waiting for the player, by
+// clk, until ctx is cancelled or the Controller hangs up.
+// While the list is a replica, RunHandover idles until a promotion.
+// It hangs up client when it returns.
+func RunHandover(ctx context.Context, client *controller.Client, clk clock.Clock) error {
+	// The client receives broadcasts too, and must keep draining them; handovers start waiting, and maintenance and
+	// emergencies end, by request.
+	wake := make(chan struct{}, 1)
+	go func() {
+		for r := range client.Rx {
+			switch r.Body.(type) {
+			case HandoverResponse, MaintenanceResponse, EmergencyResponse:
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	// Closing our request channel is how we hang up on the Controller.
+	defer close(client.Tx)
+
+	t := clk.NewTimer(0)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C():
+		case <-wake:
+			if !t.Stop() {
+				// The timer may have fired without us taking the time, or not have been set at all.
+				select {
+				case <-t.C():
+				default:
+				}
+			}
+		case <-ctx.Done():
+			return nil
+		}
+
+		next, err := checkHandover(ctx, client)
+		if errors.Is(err, controller.ErrControllerShutDown) {
+			return nil
+		}
+		if code := bifrost.CodeOf(err); code == CodeMaintenance || code == CodeEmergency || code == CodeReplica {
+			// Handovers wait for maintenance, or the emergency, to end, which wakes us; a replica has no handovers until
+			// promoted, and its first handover wakes us.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !next.IsZero() {
+			t.Reset(next.Sub(clk.Now()))
+		}
+	}
+}
+
+// checkHandover sends one HandoverCheckRequest through client, returning when the next is due.
+func checkHandover(ctx context.Context, client *controller.Client) (time.Time, error) {
+	rbodies, err := client.CallReplies(ctx, HandoverCheckRequest{})
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, rbody := range rbodies {
+		if r, ok := rbody.(handoverNextResponse); ok {
+			return r.at, nil
+		}
+	}
+	return time.Time{}, nil
+}
@@ -0,0 +1,208 @@
+package list
+
+// File integrity.go contains the checks a State must pass before a List is restored to it, so that a corrupt snapshot
+// can't leave the List, and its Controller, in a state they were never meant to be in.
+//
+// A State breaks the List's invariants if any item has an unknown type, or shares its hash with an earlier one; if the
+// selection is out of bounds, or on an item that can't be selected; if the automode is unknown; if any play count
+// is negative; or if any item is in an undefined block, or apart from the rest of its block, or any block is empty or
+// defined twice.
+// Restore refuses such States with an IntegrityError; Repair makes a copy that passes, for whoever would rather start
+// with some of the list than none of it.
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IntegrityError is the error returned when restoring a State that breaks a List's invariants.
+type IntegrityError struct {
+	// Problems describes each way in which the State breaks the invariants.
+	Problems []string
+}
+
+// Error gets the error message of an IntegrityError.
+func (e IntegrityError) Error() string {
+	return "corrupt list state: " + strings.Join(e.Problems, "; ")
+}
+
+// Check gets a description of each way in which s breaks a List's invariants; if there are none, s can be restored.
+func (s State) Check() []string {
+	var problems []string
+
+	seen := make(map[string]int, len(s.Items))
+	for i, is := range s.Items {
+		if is.Type != ItemTrack && is.Type != ItemText {
+			problems = append(problems, fmt.Sprintf("item %d has unknown type %v", i, is.Type))
+		}
+		if j, ok := seen[is.Hash]; ok {
+			problems = append(problems, fmt.Sprintf("item %d has the same hash, %s, as item %d", i, is.Hash, j))
+			continue
+		}
+		seen[is.Hash] = i
+	}
+
+	switch {
+	case s.Selection < -1 || len(s.Items) <= s.Selection:
+		problems = append(problems, fmt.Sprintf("selection %d is out of bounds", s.Selection))
+	case s.Selection != -1 && s.Items[s.Selection].Type != ItemTrack:
+		problems = append(problems, fmt.Sprintf("selected item %d can't be selected", s.Selection))
+	}
+
+	if !s.AutoMode.known() {
+		problems = append(problems, fmt.Sprintf("automode %d is unknown", s.AutoMode))
+	}
+
+	for _, h := range sortedKeys(s.Plays) {
+		if s.Plays[h] < 0 {
+			problems = append(problems, fmt.Sprintf("item %s has a negative play count", h))
+		}
+	}
+
+	_, _, fixes := fixBlocks(s.Items, s.Blocks)
+	for _, f := range fixes {
+		problems = append(problems, f.problem)
+	}
+	return problems
+}
+
+// Repair gets a copy of s that passes Check, along with a description of each repair made.
+// It drops items of unknown type, and items sharing their hash with an earlier one; clears a selection that is out of
+// bounds, or on an item that was dropped or can't be selected; turns an unknown automode off; forgets negative play
+// counts; and takes items out of undefined blocks, and out of their block if apart from the rest of it, and forgets
+// empty and repeated blocks.
+func (s State) Repair() (State, []string) {
+	var repairs []string
+	r := State{Selection: -1, Note: s.Note, AutoMode: s.AutoMode, Version: s.Version, Plays: make(map[string]int, len(s.Plays))}
+
+	var (
+		seen         = make(map[string]struct{}, len(s.Items))
+		unselectable bool
+	)
+	for i, is := range s.Items {
+		if is.Type != ItemTrack && is.Type != ItemText {
+			repairs = append(repairs, fmt.Sprintf("dropped item %d (%s), which has unknown type %v", i, is.Hash, is.Type))
+			continue
+		}
+		if _, ok := seen[is.Hash]; ok {
+			repairs = append(repairs, fmt.Sprintf("dropped item %d, which has the same hash, %s, as an earlier item", i, is.Hash))
+			continue
+		}
+		seen[is.Hash] = struct{}{}
+
+		if i == s.Selection {
+			if is.Type == ItemTrack {
+				r.Selection, r.SelectedAt = len(r.Items), s.SelectedAt
+			} else {
+				unselectable = true
+				repairs = append(repairs, fmt.Sprintf("cleared selection of item %d, which can't be selected", i))
+			}
+		}
+		r.Items = append(r.Items, is)
+	}
+	if s.Selection != -1 && r.Selection == -1 && !unselectable {
+		repairs = append(repairs, fmt.Sprintf("cleared selection %d, which is out of bounds or was dropped", s.Selection))
+	}
+
+	if !r.AutoMode.known() {
+		repairs = append(repairs, fmt.Sprintf("turned off unknown automode %d", r.AutoMode))
+		r.AutoMode = AutoOff
+	}
+
+	for _, h := range sortedKeys(s.Plays) {
+		if n := s.Plays[h]; n < 0 {
+			repairs = append(repairs, fmt.Sprintf("forgot negative play count of item %s", h))
+		} else {
+			r.Plays[h] = n
+		}
+	}
+
+	var fixes []blockFix
+	r.Items, r.Blocks, fixes = fixBlocks(r.Items, s.Blocks)
+	for _, f := range fixes {
+		repairs = append(repairs, f.repair)
+	}
+	return r, repairs
+}
+
+// blockFix describes one way in which items and block definitions break a List's invariants, and its repair.
+type blockFix struct {
+	problem, repair string
+}
+
+// fixBlocks gets copies of items and blocks that keep a List's invariants about blocks, and the fixes made.
+func fixBlocks(items []ItemState, blocks []Block) ([]ItemState, []Block, []blockFix) {
+	var fixes []blockFix
+
+	defs := make(map[string]struct{}, len(blocks))
+	for _, b := range blocks {
+		if _, ok := defs[b.ID]; ok {
+			fixes = append(fixes, blockFix{
+				problem: fmt.Sprintf("block %s is defined twice", b.ID),
+				repair:  fmt.Sprintf("forgot repeated definition of block %s", b.ID),
+			})
+		}
+		defs[b.ID] = struct{}{}
+	}
+
+	fixed := append([]ItemState(nil), items...)
+	// done holds the blocks whose items have ended.
+	done := make(map[string]struct{}, len(blocks))
+	used := make(map[string]struct{}, len(blocks))
+	for i := range fixed {
+		id := fixed[i].Block
+		if 0 < i && items[i-1].Block != "" && items[i-1].Block != id {
+			done[items[i-1].Block] = struct{}{}
+		}
+		if id == "" {
+			continue
+		}
+		if _, ok := defs[id]; !ok {
+			fixes = append(fixes, blockFix{
+				problem: fmt.Sprintf("item %d is in undefined block %s", i, id),
+				repair:  fmt.Sprintf("took item %d out of undefined block %s", i, id),
+			})
+			fixed[i].Block = ""
+			continue
+		}
+		if _, ok := done[id]; ok {
+			fixes = append(fixes, blockFix{
+				problem: fmt.Sprintf("item %d is apart from the rest of block %s", i, id),
+				repair:  fmt.Sprintf("took item %d, which was apart from the rest of it, out of block %s", i, id),
+			})
+			fixed[i].Block = ""
+			continue
+		}
+		used[id] = struct{}{}
+	}
+
+	var kept []Block
+	seen := make(map[string]struct{}, len(blocks))
+	for _, b := range blocks {
+		if _, ok := seen[b.ID]; ok {
+			continue
+		}
+		seen[b.ID] = struct{}{}
+		if _, ok := used[b.ID]; !ok {
+			fixes = append(fixes, blockFix{
+				problem: fmt.Sprintf("block %s has no items", b.ID),
+				repair:  fmt.Sprintf("forgot empty block %s", b.ID),
+			})
+			continue
+		}
+		kept = append(kept, b)
+	}
+	return fixed, kept, fixes
+}
+
+// sortedKeys gets the keys of the play counts plays, in order, so that problems and repairs are reported in the same
+// order every time.
+func sortedKeys(plays map[string]int) []string {
+	hs := make([]string, 0, len(plays))
+	for h := range plays {
+		hs = append(hs, h)
+	}
+	sort.Strings(hs)
+	return hs
+}
@@ -1,5 +1,10 @@
 package list
 
+import (
+	"fmt"
+	"time"
+)
+
 // ItemType is the type of types of item.
 type ItemType int
 
@@ -28,6 +33,18 @@ func (i ItemType) String() string {
 	}
 }
 
+// ParseItemType tries to parse a (non-none) ItemType from its descriptive name.
+func ParseItemType(s string) (ItemType, error) {
+	switch s {
+	case "track":
+		return ItemTrack, nil
+	case "text":
+		return ItemText, nil
+	default:
+		return ItemNone, fmt.Errorf("invalid item type")
+	}
+}
+
 // Item is the internal representation of a yaps list item.
 type Item struct {
 	// hash is the inserter-supplied unique hash of the item.
@@ -36,11 +53,27 @@ type Item struct {
 	payload string
 	// itype is the type of the item.
 	itype ItemType
+	// note is a free-text note attached to the item, or "" if there isn't one.
+	note string
+	// category is the name of the item's category, or "" if it is uncategorised.
+	category string
+	// planned is the planned start time of the item, or the zero time if it has none.
+	planned time.Time
+	// duration is the expected duration of the item, or 0 if it is unknown.
+	duration time.Duration
+	// validFrom is the time before which the item is embargoed, or the zero time if it has none.
+	validFrom time.Time
+	// validUntil is the time after which the item has expired, or the zero time if it has none.
+	validUntil time.Time
+	// display is how displays should show the item, if it is a text item.
+	display DisplayHints
+	// block is the ID of the block the item belongs to, or "" if it isn't in one.
+	block string
 }
 
 // NewItem creates a new item with the given hash, payload, and item type.
 func NewItem(itype ItemType, hash, payload string) *Item {
-	return &Item{hash, payload, itype}
+	return &Item{hash: hash, payload: payload, itype: itype}
 }
 
 // NewTrack creates a new track-type item.
@@ -68,6 +101,26 @@ func (i *Item) Hash() string {
 	return i.hash
 }
 
+// Note returns the free-text note attached to the Item, or "" if there isn't one.
+func (i *Item) Note() string {
+	return i.note
+}
+
+// Category returns the name of the Item's category, or "" if it is uncategorised.
+func (i *Item) Category() string {
+	return i.category
+}
+
+// Planned returns the Item's planned start time, or the zero time if it has none.
+func (i *Item) Planned() time.Time {
+	return i.planned
+}
+
+// Duration returns the Item's expected duration, or 0 if it is unknown.
+func (i *Item) Duration() time.Duration {
+	return i.duration
+}
+
 // IsSelectable returns whether or not the Item i can be selected.
 func (i *Item) IsSelectable() bool {
 	return i.itype != ItemText
@@ -0,0 +1,147 @@
+package list
+
+// File json.go contains the JSON representations of list values whose Go representations are opaque, so that decoded
+// responses (see bifrost.ToJSON) come out readably.
+// Responses whose JSON representations differ from their Go ones are registered with bifrost.RegisterJSON.
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+func init() {
+	bifrost.RegisterJSON("DriftResponse", func(r DriftResponse) interface{} {
+		return struct{ Drift string }{r.Drift.String()}
+	})
+	bifrost.RegisterJSON("ItemTimingResponse", func(r ItemTimingResponse) interface{} {
+		jt := struct {
+			Index    int
+			Hash     string
+			Planned  *time.Time `json:",omitempty"`
+			Duration string     `json:",omitempty"`
+		}{Index: r.Index, Hash: r.Hash, Planned: timeOrNil(r.Planned)}
+		if r.Duration != 0 {
+			jt.Duration = r.Duration.String()
+		}
+		return jt
+	})
+	bifrost.RegisterJSON("ItemValidityResponse", func(r ItemValidityResponse) interface{} {
+		return struct {
+			Index int
+			Hash  string
+			From  *time.Time `json:",omitempty"`
+			Until *time.Time `json:",omitempty"`
+		}{r.Index, r.Hash, timeOrNil(r.From), timeOrNil(r.Until)}
+	})
+	bifrost.RegisterJSON("ItemDisplayResponse", func(r ItemDisplayResponse) interface{} {
+		return struct {
+			Index int
+			Hash  string
+			jsonDisplay
+		}{r.Index, r.Hash, toJSONDisplay(r.DisplayHints)}
+	})
+	bifrost.RegisterJSON("HandoverResponse", func(r HandoverResponse) interface{} {
+		jh := struct {
+			Index    int
+			Hash     string
+			State    string
+			Planned  *time.Time `json:",omitempty"`
+			Duration string     `json:",omitempty"`
+			Due      *time.Time `json:",omitempty"`
+		}{Index: r.Index, Hash: r.Hash, State: r.State, Planned: timeOrNil(r.Planned), Due: timeOrNil(r.Due)}
+		if r.Duration != 0 {
+			jh.Duration = r.Duration.String()
+		}
+		return jh
+	})
+	bifrost.RegisterJSON("FreezeResponse", func(r FreezeResponse) interface{} {
+		return struct{ Items []Item }{append([]Item{}, r...)}
+	})
+}
+
+// jsonItem is the JSON representation of an Item.
+type jsonItem struct {
+	Hash       string
+	Type       string
+	Payload    string
+	Note       string       `json:",omitempty"`
+	Category   string       `json:",omitempty"`
+	Planned    *time.Time   `json:",omitempty"`
+	Duration   string       `json:",omitempty"`
+	ValidFrom  *time.Time   `json:",omitempty"`
+	ValidUntil *time.Time   `json:",omitempty"`
+	Display    *jsonDisplay `json:",omitempty"`
+	Block      string       `json:",omitempty"`
+}
+
+// jsonDisplay is the JSON representation of DisplayHints.
+type jsonDisplay struct {
+	Markup   Markup
+	Severity AlertSeverity
+	Colour   string `json:",omitempty"`
+	Hold     string `json:",omitempty"`
+}
+
+// MarshalJSON marshals i as an object with its hash, type, and payload, and whichever of its note, category, timing,
+// validity, display hints, and block it has.
+func (i Item) MarshalJSON() ([]byte, error) {
+	ji := jsonItem{
+		Hash:       i.hash,
+		Type:       i.itype.String(),
+		Payload:    i.payload,
+		Note:       i.note,
+		Category:   i.category,
+		Planned:    timeOrNil(i.planned),
+		ValidFrom:  timeOrNil(i.validFrom),
+		ValidUntil: timeOrNil(i.validUntil),
+		Display:    displayOrNil(i.display),
+		Block:      i.block,
+	}
+	if i.duration != 0 {
+		ji.Duration = i.duration.String()
+	}
+	return json.Marshal(ji)
+}
+
+// MarshalText marshals a as its Bifrost name.
+func (a AutoMode) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// MarshalText marshals m as its Bifrost name.
+func (m Markup) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// MarshalText marshals s as its Bifrost name.
+func (s AlertSeverity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// timeOrNil gets a pointer to t, or nil if t is zero.
+func timeOrNil(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// toJSONDisplay gets the JSON representation of h.
+func toJSONDisplay(h DisplayHints) jsonDisplay {
+	jd := jsonDisplay{Markup: h.Markup, Severity: h.Severity, Colour: h.Colour}
+	if h.Hold != 0 {
+		jd.Hold = h.Hold.String()
+	}
+	return jd
+}
+
+// displayOrNil gets the JSON representation of h, or nil if h is the default.
+func displayOrNil(h DisplayHints) *jsonDisplay {
+	if h == (DisplayHints{}) {
+		return nil
+	}
+	jd := toJSONDisplay(h)
+	return &jd
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 	"math/rand"
 	"time"
+
+	"github.com/MattWindsor91/yaps/clock"
+	"github.com/MattWindsor91/yaps/controller"
 )
 
 // List is the internal representation of a yaps list.
@@ -17,13 +20,93 @@ type List struct {
 
 	// selection is the currently selected index, or -1 if there isn't one.
 	selection int
+	// selectedAt is when the current selection was made, or the zero time if that isn't known.
+	selectedAt time.Time
+
+	// note is a free-text note attached to the whole list, or "" if there isn't one.
+	note string
+
+	// categories is the set of categories items may have.
+	// If empty, items may have any category.
+	categories []Category
+
+	// replica is true if the list is a read-only replica of another list.
+	replica bool
+
+	// dedupe is true if the list refuses client requests to add tracks it already has.
+	dedupe bool
+
+	// plays maps the hash of every item ever selected to the number of times it has been.
+	plays map[string]int
+	// played holds the most recent selections, oldest first.
+	played []PlayRecord
+	// playLog, if not nil, is where the list logs every selection a client makes.
+	playLog PlayLog
+	// saveState, if not nil, is called with the list's state whenever it changes.
+	saveState StateSaver
+	// templates, if not nil, is where the list finds templates to clone.
+	templates TemplateLoader
+	// separators maps the names of the separators 'sep' requests may copy to their definitions.
+	separators map[string]Separator
+	// blocks maps the IDs of the list's blocks to their definitions.
+	blocks map[string]Block
+
+	// expiryPolicy is what the list does with expired items.
+	expiryPolicy ExpiryPolicy
+	// expired is the set of hashes of items whose expiry has been announced.
+	expired map[string]struct{}
+
+	// version is the state version, increased every time a request changes the list.
+	version uint64
+	// history holds snapshots of the most recent versions, oldest first, for diffing.
+	history []versionSnapshot
+
+	// alerts maps the keys of active alerts to the alerts.
+	alerts map[string]*alert
+	// alertSent maps alert keys to when the list last broadcast about them.
+	alertSent map[string]time.Time
+	// alertInterval is the shortest time the list leaves between broadcasts about the same alert key.
+	alertInterval time.Duration
+
+	// maintenance is the list's record of its maintenance.
+	maintenance maintenance
+	// maintenanceWindows are the windows in which the list goes read-only by itself.
+	maintenanceWindows []MaintenanceWindow
+	// maintenanceWarning is how long before each maintenance window clients are warned of it, or 0 if they aren't.
+	maintenanceWarning time.Duration
+	// maintenanceAdmins is the group whose members may start and end maintenance by request, or empty if anyone may.
+	maintenanceAdmins string
+
+	// failsafe is the payload of the track the list puts on air in an emergency, or empty if there isn't one.
+	failsafe string
+	// emergency is the list's record of any emergency.
+	emergency emergency
+
+	// scratchpads maps sessions to their scratchpads' items, in order.
+	scratchpads map[controller.Session][]*Item
+
+	// driftThreshold is the granularity of drift announcements, or 0 if they are disabled.
+	driftThreshold time.Duration
+	// lastDriftBand is the drift band (see driftBand) last announced.
+	lastDriftBand int
+
+	// handoverTimeout is how long the list waits for the player to be ready for a handover, or 0 if handovers are off.
+	handoverTimeout time.Duration
+	// handover is the item the list will hand over to when the selection ends, or nil if there isn't one.
+	handover *handover
+	// handoverSent is the handover last announced, or nil if none is announced.
+	handoverSent *HandoverResponse
+	// ending records the selection having ended before the player was ready to move on from it.
+	ending ending
+
+	// clock is where the list gets the time, such as for validity checks and play history.
+	clock clock.Clock
 
 	// autoselect is the current autoselection mode.
 	autoselect AutoMode
-	// rng is the random number generator for autoshuffling.
+	// rng is the random number generator for autoselect policies, such as shuffle.
 	rng *rand.Rand
-	// usedHashes is the set of currently spent hashes since the last select.
-	// It is used for calculating the next track in AutoShuffle mode.
+	// usedHashes is the set of hashes the automode's policy has spent; see PolicyState.Used.
 	usedHashes map[string]struct{}
 }
 
@@ -34,21 +117,42 @@ func New() *List {
 	// This just needs to be 'random enough', not foolproof
 	src := rand.NewSource(time.Now().Unix())
 
-	return &List{
+	l := &List{
 		list:       list.New(),
 		selection:  -1,
 		autoselect: AutoOff,
+		clock:      clock.Real,
 		rng:        rand.New(src),
 		usedHashes: make(map[string]struct{}),
+		expired:    make(map[string]struct{}),
+		plays:      make(map[string]int),
+		alerts:     make(map[string]*alert),
+		alertSent:  make(map[string]time.Time),
+		blocks:     make(map[string]Block),
+
+		scratchpads: make(map[controller.Session][]*Item),
 	}
+	l.remember()
+	return l
+}
+
+// SetClock sets where l gets the time; the default is clock.Real.
+func (l *List) SetClock(clk clock.Clock) {
+	l.clock = clk
 }
 
 // Add adds an Item to a list.
+// The item joins a block if, and only if, it lands between two of the block's items.
 // It will fail if there is already an Item with the same hash enqueued.
 func (l *List) Add(item *Item, i int) error {
 	if j, _ := l.ItemWithHash(item.Hash()); j > -1 {
 		return fmt.Errorf("List.Add(): duplicate hash %s at index %d", item.Hash(), j)
 	}
+	if 0 < i {
+		item.block = joinedBlock(l.ItemWithIndex(i-1), l.ItemWithIndex(i))
+	} else {
+		item.block = ""
+	}
 
 	// Adding an item on or before the current selection moves it down one.
 	if i <= l.selection {
@@ -88,10 +192,8 @@ func (l *List) SetAutoMode(mode AutoMode) bool {
 		return false
 	}
 
-	// If we've changed to shuffle mode, prepare the state for it.
-	if mode == AutoShuffle {
-		l.clearUsedHashes()
-	}
+	// Each policy starts afresh, rather than with hashes another spent.
+	l.clearUsedHashes()
 
 	l.autoselect = mode
 	return true
@@ -163,20 +265,33 @@ func (l *List) Selection() (int, *Item) {
 	panic("Selection(): selection not in list")
 }
 
-// Select tries to select the item with the given index and hash.
-// It returns a Boolean stating whether the selection changed.
-// It fails if the item doesn't exist, or has a different hash.
-func (l *List) Select(index int, hash string) (changed bool, err error) {
-	// We always validate the hash, even if the index hasn't changed.
+// checkedItem finds the item with the given index, checking that it has the given hash.
+// op names the operation for error messages.
+func (l *List) checkedItem(op string, index int, hash string) (*Item, error) {
 	i := l.ItemWithIndex(index)
 	if i == nil {
-		err = fmt.Errorf("Select: index %d out of bounds", index)
-		return
+		return nil, fmt.Errorf("%s: index %d out of bounds", op, index)
+	}
+
+	if ihash := i.Hash(); hash != ihash {
+		return nil, fmt.Errorf("%s: hash mismatch: requested '%s', actual '%s'", op, hash, ihash)
 	}
+	return i, nil
+}
+
+// Select tries to select the item with the given index and hash.
+// It returns a Boolean stating whether the selection changed.
+// It fails if the item doesn't exist, has a different hash, or is embargoed or expired.
+func (l *List) Select(index int, hash string) (changed bool, err error) {
+	return l.selectAt(index, hash, l.clock.Now())
+}
 
-	ihash := i.Hash()
-	if hash != ihash {
-		err = fmt.Errorf("Select: hash mismatch: requested '%s', actual '%s'", hash, ihash)
+// selectAt selects the item with the given index and hash, checking that it is valid at time now.
+// If now is the zero time, validity isn't checked.
+func (l *List) selectAt(index int, hash string, now time.Time) (changed bool, err error) {
+	// We always validate the hash, even if the index hasn't changed.
+	var i *Item
+	if i, err = l.checkedItem("Select", index, hash); err != nil {
 		return
 	}
 
@@ -184,12 +299,67 @@ func (l *List) Select(index int, hash string) (changed bool, err error) {
 		err = fmt.Errorf("Select: item not selectable")
 		return
 	}
+	if !now.IsZero() {
+		if err = i.ValidAt(now); err != nil {
+			return
+		}
+	}
 
 	changed = index != l.selection
 	l.selection = index
+	if changed {
+		l.selectedAt = l.clock.Now()
+		l.recordPlay(i, l.selectedAt)
+	}
+	return
+}
+
+// Note gets the free-text note attached to the given List.
+func (l *List) Note() string {
+	return l.note
+}
+
+// SetNote changes the free-text note attached to the given List.
+// It returns whether the note has changed.
+func (l *List) SetNote(note string) bool {
+	if note == l.note {
+		return false
+	}
+	l.note = note
+	return true
+}
+
+// SetItemNote changes the free-text note attached to the item with the given index and hash.
+// It returns whether the note has changed.
+// It fails if the item doesn't exist, or has a different hash.
+func (l *List) SetItemNote(index int, hash, note string) (changed bool, err error) {
+	var i *Item
+	if i, err = l.checkedItem("SetItemNote", index, hash); err != nil {
+		return
+	}
+
+	changed = note != i.note
+	i.note = note
 	return
 }
 
+// FreezeRange copies up to count items, starting at index start, to a slice of ItemResponses.
+// If cat is non-empty, only items with that category are included (and count applies before filtering).
+func (l *List) FreezeRange(start, count int, cat string) []ItemResponse {
+	var frozen []ItemResponse
+
+	e := l.elementWithIndex(start)
+	for i := start; e != nil && i < start+count; i++ {
+		item := *(e.Value.(*Item))
+		if cat == "" || item.category == cat {
+			frozen = append(frozen, ItemResponse{Index: i, Item: item})
+		}
+		e = e.Next()
+	}
+
+	return frozen
+}
+
 // Freeze copies the current list to a slice.
 func (l *List) Freeze() []Item {
 	// TODO(@MattWindsor91): inefficient
@@ -215,67 +385,65 @@ func (l *List) Next() (int, bool) {
 		return -1, false
 	}
 
-	ni, nh := l.chooseNext(l.selection, e)
+	ni, nh := l.chooseNext(l.selection)
 	l.selection = ni
-	return ni, nh != e.Value.(*Item).Hash()
-}
-
-// chooseNext chooses the next selection based on the given previous selection element.
-func (l *List) chooseNext(i int, prev *list.Element) (int, string) {
-	switch l.autoselect {
-	case AutoOff:
-		return i, prev.Value.(*Item).hash
-	case AutoDrop:
-		return -1, ""
-	case AutoNext:
-		if e := prev.Next(); e != nil {
-			return i + 1, e.Value.(*Item).Hash()
-		}
-		return -1, ""
-	case AutoShuffle:
-		return l.shuffleChoose()
+	changed := nh != e.Value.(*Item).Hash()
+	if changed && ni != -1 {
+		l.selectedAt = l.clock.Now()
+		l.recordPlay(l.ItemWithIndex(ni), l.selectedAt)
 	}
-
-	// TODO: error here?
-	return -1, ""
+	return ni, changed
 }
 
-// clearUsedHashes empties the used hash bucket for the given List.
-func (l *List) clearUsedHashes() {
-	l.usedHashes = make(map[string]struct{})
-}
+// Upcoming predicts up to n tracks likely to be selected next, most likely first, without changing the selection.
+// Outside shuffle, these are the tracks after the selection, or from the top of the list if nothing is selected, as
+// presenters mostly work down the list even when autoselect doesn't.
+// Under shuffle, which picks at random, these are tracks other than the selection that the shuffle hasn't yet used, in
+// list order.
+// Either way, tracks that can't go to air now are left out, and any track being handed over to comes first.
+func (l *List) Upcoming(n int) []ItemResponse {
+	var (
+		upcoming []ItemResponse
+		now      = l.clock.Now()
+		shuffle  = l.autoselect == AutoShuffle
+		start    = l.selection + 1
+		handover string
+	)
+	if shuffle {
+		start = 0
+	}
+	if h := l.handover; h != nil && 0 < n {
+		handover = h.hash
+		upcoming = append(upcoming, ItemResponse{Index: h.index, Item: *l.ItemWithIndex(h.index)})
+	}
 
-// shuffleChoose selects a random item from the playlist.
-// It will not select an item whose hash is in the used hash bucket.
-// It returns a the index and hash.
-func (l *List) shuffleChoose() (int, string) {
-	// First, work out which items are available.
-	/* TODO(CaptainHayashi): this is slow, but guaranteed to terminate.
-	   Randomly choosing a hash then checking it for previous play would be faster
-	   in some cases, but could technically never terminate. */
-	count := 0
-	unpickedH := make([]string, l.list.Len())
-	unpickedI := make([]int, l.list.Len())
-	i := 0
-	for e := l.list.Front(); e != nil; e = e.Next() {
-		le := e.Value.(*Item)
-		lh := le.Hash()
-		if _, in := l.usedHashes[lh]; !in {
-			unpickedH[count] = lh
-			unpickedI[count] = i
-			count++
+	i := start
+	for e := l.elementWithIndex(start); e != nil && len(upcoming) < n; e = e.Next() {
+		item := e.Value.(*Item)
+		_, used := l.usedHashes[item.Hash()]
+		if item.Type() == ItemTrack && item.ValidAt(now) == nil && !(shuffle && (used || i == l.selection)) && item.hash != handover {
+			upcoming = append(upcoming, ItemResponse{Index: i, Item: *item})
 		}
 		i++
 	}
+	return upcoming
+}
 
-	/* If we didn't find anything, we're done with this shuffle.
-	   Prepare a new one. */
-	if count == 0 {
-		l.clearUsedHashes()
+// chooseNext chooses the next selection, after the selection i ends, by the automode's policy.
+func (l *List) chooseNext(i int) (int, string) {
+	p, ok := policyOf(l.autoselect)
+	if !ok {
+		return -1, ""
+	}
+	items := l.Freeze()
+	ni, nh := p.policy.Next(&PolicyState{Items: items, Selection: i, Now: l.clock.Now(), Rand: l.rng, Used: l.usedHashes})
+	if ni < 0 || len(items) <= ni || items[ni].hash != nh {
 		return -1, ""
 	}
+	return ni, nh
+}
 
-	s := l.rng.Intn(count)
-	l.usedHashes[unpickedH[s]] = struct{}{}
-	return unpickedI[s], unpickedH[s]
+// clearUsedHashes empties the used hash bucket for the given List.
+func (l *List) clearUsedHashes() {
+	l.usedHashes = make(map[string]struct{})
 }
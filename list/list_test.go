@@ -1,9 +1,17 @@
 package list_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/clock"
+	"github.com/MattWindsor91/yaps/controller"
 	"github.com/MattWindsor91/yaps/list"
 )
 
@@ -118,6 +126,39 @@ func Test_SelectTrack_Success(t *testing.T) {
 	}
 }
 
+// Test_HandleRequest_Select checks that selection requests broadcast the new selection if, and only if, they succeed.
+func Test_HandleRequest_Select(t *testing.T) {
+	l := list.New()
+	if err := l.Add(list.NewTrack("abc", "foo.mp3"), 0); err != nil {
+		panic(err)
+	}
+	if err := l.Add(list.NewText("xyz", "test"), 1); err != nil {
+		panic(err)
+	}
+
+	var sels []list.SelectResponse
+	ignore := func(interface{}) {}
+	record := func(r interface{}) {
+		if sel, ok := r.(list.SelectResponse); ok {
+			sels = append(sels, sel)
+		}
+	}
+
+	if err := l.HandleRequest(context.Background(), ignore, record, list.SetSelectRequest{Index: 1, Hash: "xyz"}); err == nil {
+		t.Error("expected error when selecting text item")
+	}
+	if len(sels) != 0 {
+		t.Errorf("failed selection broadcast %v, want nothing", sels)
+	}
+
+	if err := l.HandleRequest(context.Background(), ignore, record, list.SetSelectRequest{Index: 0, Hash: "abc"}); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	if len(sels) != 1 || sels[0].Hash != "abc" {
+		t.Errorf("selection broadcast %v, want the selection of abc", sels)
+	}
+}
+
 // Test_CannotSelectTextItem makes sure a text item can't be selected manually.
 func Test_CannotSelectTextItem(t *testing.T) {
 	l := list.New()
@@ -136,3 +177,1614 @@ func Test_CannotSelectTextItem(t *testing.T) {
 
 	// TODO(@MattWindsor91): make sure we get the right error
 }
+
+// ExampleList_SetItemNote tests List.SetItemNote in an example style.
+func ExampleList_SetItemNote() {
+	l := list.New()
+
+	if err := l.Add(list.NewTrack("abc", "foo.mp3"), 0); err != nil {
+		panic(err)
+	}
+
+	changed, err := l.SetItemNote(0, "abc", "back-announce the competition")
+	fmt.Println(changed, err)
+
+	// Notes follow the item into frozen copies.
+	fmt.Println(l.Freeze()[0].Note())
+
+	// The hash must match, as with selection.
+	_, err = l.SetItemNote(0, "xyz", "wrong item")
+	fmt.Println(err != nil)
+
+	// Output:
+	// true <nil>
+	// back-announce the competition
+	// true
+}
+
+// Test_SetItemCategory_Undefined checks that items can't be put in undefined categories.
+func Test_SetItemCategory_Undefined(t *testing.T) {
+	l := list.New()
+	l.DefineCategories([]list.Category{{Name: "music", Colour: "#3080ff"}})
+
+	if err := l.Add(list.NewTrack("abc", "foo.mp3"), 0); err != nil {
+		panic(err)
+	}
+
+	if _, err := l.SetItemCategory(0, "abc", "music"); err != nil {
+		t.Error("unexpected error setting defined category:", err)
+	}
+	if _, err := l.SetItemCategory(0, "abc", "advert"); err == nil {
+		t.Error("expected error setting undefined category")
+	}
+	if cat, _ := l.ItemCategory(0, "abc"); cat != "music" {
+		t.Errorf("category after failed set: got %q, want music", cat)
+	}
+}
+
+// Test_Drift checks drift calculation from planned start times, durations, and when the selection was made.
+func Test_Drift(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewMock(start)
+	l := list.New()
+	l.SetClock(clk)
+
+	for i, h := range []string{"a", "b", "c"} {
+		if err := l.Add(list.NewTrack(h, h+".mp3"), i); err != nil {
+			panic(err)
+		}
+	}
+	if _, err := l.SetItemTiming(0, "a", start, 3*time.Minute); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := l.SetItemTiming(1, "b", time.Time{}, 2*time.Minute); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, ok := l.Drift(); ok {
+		t.Error("got drift with no selection")
+	}
+
+	// 'c' is expected at 12:05, so selecting it at 12:06 is a minute late, however long ago that was.
+	clk.Advance(6 * time.Minute)
+	if _, err := l.Select(2, "c"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	clk.Advance(3 * time.Minute)
+	d, ok := l.Drift()
+	if !ok {
+		t.Fatal("couldn't calculate drift")
+	}
+	if d != time.Minute {
+		t.Errorf("drift: got %v, want %v", d, time.Minute)
+	}
+
+	// The selection time survives a restore.
+	r := list.New()
+	if err := r.Restore(l.State()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if d, ok := r.Drift(); !ok || d != time.Minute {
+		t.Errorf("restored drift: got %v, %v; want %v", d, ok, time.Minute)
+	}
+
+	// Without b's duration, we can't tell when c should start.
+	if _, err := l.SetItemTiming(1, "b", time.Time{}, 0); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, ok := l.Drift(); ok {
+		t.Error("got drift despite an unknown duration")
+	}
+}
+
+// Test_Dump_drift checks that dumps only carry drift when drift is announced at all.
+func Test_Dump_drift(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	l := list.New()
+	l.SetClock(clock.NewMock(start.Add(time.Minute)))
+	if err := l.Add(list.NewTrack("a", "a.mp3"), 0); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := l.SetItemTiming(0, "a", start, 0); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := l.Select(0, "a"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	drifts := func() (n int) {
+		l.Dump(func(r interface{}) {
+			if _, ok := r.(list.DriftResponse); ok {
+				n++
+			}
+		})
+		return n
+	}
+	if n := drifts(); n != 0 {
+		t.Errorf("dump with drift announcements off has %d DRIFTs, want none", n)
+	}
+	l.SetDriftThreshold(time.Second)
+	if n := drifts(); n != 1 {
+		t.Errorf("dump with drift announcements on has %d DRIFTs, want one", n)
+	}
+}
+
+// Test_Replica checks that replicas refuse client changes, but accept replicated ones, until promoted.
+func Test_Replica(t *testing.T) {
+	l := list.New()
+	l.SetReplica(true)
+	ignore := func(interface{}) {}
+
+	add := list.AddItemRequest{Index: 0, Item: *list.NewTrack("abc", "foo.mp3")}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, add); err != list.ErrReplica {
+		t.Errorf("client add on replica: got %v, want %v", err, list.ErrReplica)
+	}
+
+	rep := list.ReplicateRequest{Response: list.ItemResponse(add)}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, rep); err != nil {
+		t.Fatal("unexpected error replicating:", err)
+	}
+	if l.Count() != 1 {
+		t.Errorf("count after replication: got %d, want 1", l.Count())
+	}
+
+	if err := l.HandleRequest(context.Background(), ignore, ignore, list.PromoteRequest{}); err != nil {
+		t.Fatal("unexpected error promoting:", err)
+	}
+	if l.IsReplica() {
+		t.Error("list still a replica after promotion")
+	}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, list.SetSelectRequest{Index: 0, Hash: "abc"}); err != nil {
+		t.Error("unexpected error selecting after promotion:", err)
+	}
+}
+
+// Test_VersionedRequest checks that versioned requests fail if the list has changed since the given version.
+func Test_VersionedRequest(t *testing.T) {
+	l := list.New()
+	ignore := func(interface{}) {}
+
+	if err := l.HandleRequest(context.Background(), ignore, ignore, list.SetListNoteRequest{Note: "first"}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if l.Version() != 1 {
+		t.Fatalf("version after change: got %d, want 1", l.Version())
+	}
+
+	stale := list.VersionedRequest{Version: 0, Request: list.SetListNoteRequest{Note: "stale"}}
+	err := l.HandleRequest(context.Background(), ignore, ignore, stale)
+	if cerr, ok := err.(list.ConflictError); !ok || cerr.Current != 1 {
+		t.Errorf("stale request: got error %v, want conflict at version 1", err)
+	}
+	if l.Note() != "first" {
+		t.Errorf("note after stale request: got %q, want first", l.Note())
+	}
+
+	fresh := list.VersionedRequest{Version: 1, Request: list.SetListNoteRequest{Note: "second"}}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, fresh); err != nil {
+		t.Error("unexpected error on fresh request:", err)
+	}
+	if l.Version() != 2 {
+		t.Errorf("version after fresh request: got %d, want 2", l.Version())
+	}
+}
+
+// Test_Diff checks that applying a diff to a copy of an old version of a list brings it up to date.
+func Test_Diff(t *testing.T) {
+	l := list.New()
+	l.SetReplica(true)
+	ignore := func(interface{}) {}
+	replicate := func(rs ...interface{}) {
+		t.Helper()
+		for _, r := range rs {
+			if err := l.HandleRequest(context.Background(), ignore, ignore, list.ReplicateRequest{Response: r}); err != nil {
+				t.Fatalf("unexpected error replicating %v: %v", r, err)
+			}
+		}
+	}
+
+	replicate(
+		list.ItemResponse{Index: 0, Item: *list.NewTrack("a", "a.mp3")},
+		list.ItemResponse{Index: 1, Item: *list.NewTrack("b", "b.mp3")},
+		list.ItemResponse{Index: 2, Item: *list.NewTrack("c", "c.mp3")},
+		list.SelectResponse{Index: 1, Hash: "b"},
+	)
+	m := list.NewMirror()
+	l.Dump(func(r interface{}) { m.Apply(r) })
+	since := l.Version()
+
+	// Reloading the list in a different order is the only way, for now, to remove and move items.
+	replicate(
+		list.CountResponse{},
+		list.ItemResponse{Index: 0, Item: *list.NewTrack("c", "c.mp3")},
+		list.ItemResponse{Index: 1, Item: *list.NewTrack("d", "d.mp3")},
+		list.ItemResponse{Index: 2, Item: *list.NewTrack("a", "a.mp3")},
+		list.SelectResponse{Index: 2, Hash: "a"},
+		list.ItemNoteResponse{Index: 0, Hash: "c", Note: "fade early"},
+		list.AutoModeResponse{AutoMode: list.AutoNext},
+	)
+
+	if err := l.HandleRequest(context.Background(), func(r interface{}) { m.Apply(r) }, ignore, list.DiffRequest{Since: since}); err != nil {
+		t.Fatal("unexpected error diffing:", err)
+	}
+
+	if m.Version() != l.Version() {
+		t.Errorf("version after diff: got %d, want %d", m.Version(), l.Version())
+	}
+	want := l.Freeze()
+	got := m.Items()
+	if len(got) != len(want) {
+		t.Fatalf("items after diff: got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i].Hash() != want[i].Hash() || got[i].Note() != want[i].Note() {
+			t.Errorf("item %d after diff: got %v, want %v", i, got[i], want[i])
+		}
+	}
+	if idx, sel := m.Selection(); idx != 2 || sel == nil || sel.Hash() != "a" {
+		t.Errorf("selection after diff: got %d (%v), want 2 (a)", idx, sel)
+	}
+	if m.AutoMode() != list.AutoNext {
+		t.Errorf("automode after diff: got %v, want %v", m.AutoMode(), list.AutoNext)
+	}
+
+	err := l.HandleRequest(context.Background(), ignore, ignore, list.DiffRequest{Since: l.Version() + 1})
+	if _, ok := err.(list.StaleError); !ok {
+		t.Errorf("diff from the future: got error %v, want a stale error", err)
+	}
+}
+
+// Test_Search checks that searches find the right items in each field.
+func Test_Search(t *testing.T) {
+	l := list.New()
+	for i, it := range []*list.Item{
+		list.NewTrack("a1", "music/Blue Monday.mp3"),
+		list.NewText("b2", "Read the weather"),
+		list.NewTrack("c3", "jingles/station-id.mp3"),
+	} {
+		if err := l.Add(it, i); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+	if _, err := l.SetItemNote(2, "c3", "blue jingle"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := l.SetItemCategory(1, "b2", "Speech"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	cases := []struct {
+		query, field string
+		want         []string
+	}{
+		{"blue", "", []string{"a1", "c3"}},
+		{"BLUE", list.SearchPayload, []string{"a1"}},
+		{"blue", list.SearchNote, []string{"c3"}},
+		{"2", list.SearchHash, []string{"b2"}},
+		{"speech", list.SearchCategory, []string{"b2"}},
+		{"spee", list.SearchCategory, nil},
+		{"nothing", list.SearchAny, nil},
+	}
+	for _, c := range cases {
+		found, err := l.Search(c.query, c.field)
+		if err != nil {
+			t.Errorf("search %q in %q: unexpected error: %v", c.query, c.field, err)
+			continue
+		}
+		var got []string
+		for _, f := range found {
+			if it := l.ItemWithIndex(f.Index); it == nil || it.Hash() != f.Hash {
+				t.Errorf("search %q in %q: found %v, which isn't in the list", c.query, c.field, f)
+			}
+			got = append(got, f.Hash)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(c.want) {
+			t.Errorf("search %q in %q: got %v, want %v", c.query, c.field, got, c.want)
+		}
+	}
+
+	if _, err := l.Search("x", "colour"); err == nil {
+		t.Error("search in an unknown field: expected an error")
+	}
+
+	// Query options apply to the matches, whichever request asks for them.
+	for word, args := range map[string][]string{
+		"find":  {"blue", "sort=-index"},
+		"rdump": {"0", "3", "filter=type:track", "sort=-index"},
+	} {
+		rq, err := l.ParseBifrostRequest(word, args)
+		if err != nil {
+			t.Fatalf("%s %v: unexpected error: %v", word, args, err)
+		}
+		var got []string
+		reply := func(rbody interface{}) {
+			switch r := rbody.(type) {
+			case list.FoundResponse:
+				got = append(got, r.Hash)
+			case list.ItemResponse:
+				got = append(got, r.Item.Hash())
+			}
+		}
+		if err := l.HandleRequest(context.Background(), reply, func(interface{}) {}, rq); err != nil {
+			t.Fatalf("%s %v: unexpected error: %v", word, args, err)
+		}
+		if want := "[c3 a1]"; fmt.Sprint(got) != want {
+			t.Errorf("%s %v: got %v, want %s", word, args, got, want)
+		}
+	}
+}
+
+// Test_Duplicates checks that duplicate reports find repeated paths and titles, and that dedupe refuses them.
+func Test_Duplicates(t *testing.T) {
+	l := list.New()
+	ignore := func(interface{}) {}
+	add := func(i int, item *list.Item) error {
+		return l.HandleRequest(context.Background(), ignore, ignore, list.AddItemRequest{Index: i, Item: *item})
+	}
+
+	for i, it := range []*list.Item{
+		list.NewTrack("a", "music/01 - Blue Monday.mp3"),
+		list.NewText("b", "Weather"),
+		list.NewTrack("c", "music/../music/01 - Blue Monday.mp3"),
+		list.NewText("d", "Weather"),
+		list.NewTrack("e", "old/blue_monday.flac"),
+		list.NewTrack("f", "music/Ceremony.mp3"),
+	} {
+		if err := add(i, it); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	want := []list.DuplicateResponse{
+		{Index: 2, Hash: "c", OfIndex: 0, OfHash: "a", Reason: list.DupePayload},
+		{Index: 4, Hash: "e", OfIndex: 0, OfHash: "a", Reason: list.DupeTitle},
+	}
+	if got := l.Duplicates(); fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("duplicates: got %v, want %v", got, want)
+	}
+
+	l.SetDedupe(true)
+	err := add(0, list.NewTrack("g", "new/Ceremony.wav"))
+	if derr, ok := err.(list.DuplicateError); !ok || derr.Of.OfHash != "f" || derr.Of.Reason != list.DupeTitle {
+		t.Errorf("adding a duplicate with dedupe on: got error %v, want a title duplicate of f", err)
+	}
+	if err := add(0, list.NewText("h", "Weather")); err != nil {
+		t.Errorf("adding repeated text with dedupe on: unexpected error: %v", err)
+	}
+}
+
+// Test_Validity checks that embargoed and expired items can't be selected, and that expiry follows the policy.
+func Test_Validity(t *testing.T) {
+	l := list.New()
+	now := time.Now()
+	for i, h := range []string{"a", "b", "c", "d"} {
+		if err := l.Add(list.NewTrack(h, h+".mp3"), i); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+	if _, err := l.SetItemValidity(1, "b", now.Add(time.Hour), time.Time{}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := l.SetItemValidity(2, "c", time.Time{}, now.Add(-time.Minute)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := l.SetItemValidity(3, "d", now, now.Add(-time.Minute)); err == nil {
+		t.Error("window ending before it starts: expected an error")
+	}
+
+	if _, err := l.Select(1, "b"); err == nil || err.(list.EmbargoError).Hash != "b" {
+		t.Errorf("selecting an embargoed item: got error %v, want an embargo error", err)
+	}
+	if _, err := l.Select(2, "c"); err == nil || err.(list.ExpiredError).Hash != "c" {
+		t.Errorf("selecting an expired item: got error %v, want an expiry error", err)
+	}
+
+	// Autoselection should skip straight past b and c.
+	l.SetAutoMode(list.AutoNext)
+	if _, err := l.Select(0, "a"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if i, _ := l.Next(); i != 3 {
+		t.Errorf("next after a: got index %d, want 3", i)
+	}
+
+	if got, want := fmt.Sprint(l.Expire(now)), fmt.Sprint([]interface{}{list.ItemExpiredResponse{Index: 2, Hash: "c"}}); got != want {
+		t.Errorf("flagging expiry: got %s, want %s", got, want)
+	}
+	if got := l.Expire(now); len(got) != 0 {
+		t.Errorf("flagging expiry again: got %v, want nothing", got)
+	}
+
+	l.SetExpiryPolicy(list.ExpiryRemove)
+	if got, want := fmt.Sprint(l.Expire(now)), fmt.Sprint([]interface{}{list.ItemRemoveResponse{Hash: "c"}}); got != want {
+		t.Errorf("removing expired items: got %s, want %s", got, want)
+	}
+	if idx, sel := l.Selection(); idx != 2 || sel.Hash() != "d" {
+		t.Errorf("selection after removal: got %d (%v), want 2 (d)", idx, sel)
+	}
+}
+
+// Test_RunExpiry_replica checks that expiry waits out a replica's promotion, then checks for expiry as usual.
+func Test_RunExpiry_replica(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewMock(start)
+	l := list.New()
+	l.SetClock(clk)
+	if err := l.Add(list.NewTrack("a", "a.mp3"), 0); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := l.SetItemValidity(0, "a", time.Time{}, start.Add(90*time.Second)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	l.SetReplica(true)
+
+	wl := watchedList{List: l, handled: make(chan interface{}, 16)}
+	ctl, client := controller.NewController(wl)
+	go ctl.Run(ctx)
+	expClient, err := client.Copy(ctx)
+	if err != nil {
+		t.Fatal("unexpected error copying client:", err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- list.RunExpiry(ctx, expClient, time.Minute, clk)
+	}()
+
+	// The first check comes while the list is still a replica.
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	wl.await(t, list.ExpireRequest{})
+	if err := client.Call(ctx, list.PromoteRequest{}); err != nil {
+		t.Fatal("unexpected error promoting:", err)
+	}
+	clk.Advance(time.Minute)
+
+	for {
+		select {
+		case r := <-client.Rx:
+			if _, ok := r.Body.(list.ItemExpiredResponse); ok {
+				return
+			}
+		case err := <-errc:
+			t.Fatalf("expiry stopped before the item expired: %v", err)
+		}
+	}
+}
+
+// Test_TextItems checks that text items, and only text items, take display hints and edits in place, and that mirrors
+// following the broadcasts, or a diff, keep up.
+func Test_TextItems(t *testing.T) {
+	l := list.New()
+	ignore := func(interface{}) {}
+	for i, it := range []*list.Item{list.NewTrack("a", "a.mp3"), list.NewText("t", "Stand by")} {
+		if err := l.HandleRequest(context.Background(), ignore, ignore, list.AddItemRequest{Index: i, Item: *it}); err != nil {
+			t.Fatal("unexpected error adding:", err)
+		}
+	}
+	m := list.NewMirror()
+	l.Dump(func(r interface{}) { m.Apply(r) })
+	since := l.Version()
+
+	hints := list.DisplayHints{Markup: list.MarkupMarkdown, Severity: list.AlertCritical, Colour: "#ff0000", Hold: 30 * time.Second}
+	for _, rq := range []interface{}{
+		list.SetItemDisplayRequest{Index: 0, Hash: "a", DisplayHints: hints},
+		list.SetItemDisplayRequest{Index: 1, Hash: "t", DisplayHints: list.DisplayHints{Colour: "red"}},
+		list.SetItemTextRequest{Index: 0, Hash: "a", Text: "b.mp3"},
+	} {
+		if err := l.HandleRequest(context.Background(), ignore, ignore, rq); err == nil {
+			t.Errorf("%v: no error", rq)
+		}
+	}
+
+	var bcasts []string
+	bcast := func(rbody interface{}) {
+		bcasts = append(bcasts, fmt.Sprintf("%T", rbody))
+		m.Apply(rbody)
+	}
+	for _, rq := range []interface{}{
+		list.SetItemDisplayRequest{Index: 1, Hash: "t", DisplayHints: hints},
+		list.SetItemTextRequest{Index: 1, Hash: "t", Text: "**Mic live**"},
+		list.SetItemTextRequest{Index: 1, Hash: "t", Text: "**Mic live**"},
+	} {
+		if err := l.HandleRequest(context.Background(), ignore, bcast, rq); err != nil {
+			t.Fatalf("%v: unexpected error: %v", rq, err)
+		}
+	}
+	if got, want := fmt.Sprint(bcasts), "[list.ItemDisplayResponse list.VersionResponse list.ItemTextResponse list.VersionResponse]"; got != want {
+		t.Errorf("broadcasts: got %s, want %s", got, want)
+	}
+
+	check := func(what string, items []list.Item) {
+		t.Helper()
+		if len(items) != 2 {
+			t.Fatalf("%s: got %d items, want 2", what, len(items))
+		}
+		if it := items[1]; it.Hash() != "t" || it.Payload() != "**Mic live**" || it.Display() != hints {
+			t.Errorf("%s: got %s %q %v, want t %q %v", what, it.Hash(), it.Payload(), it.Display(), "**Mic live**", hints)
+		}
+	}
+	check("list", l.Freeze())
+	check("mirror following broadcasts", m.Items())
+
+	dm := list.NewMirror()
+	l.Dump(func(r interface{}) { dm.Apply(r) })
+	check("mirror following a dump", dm.Items())
+
+	om := list.NewMirror()
+	for _, r := range []interface{}{
+		list.ItemResponse{Index: 0, Item: *list.NewTrack("a", "a.mp3")},
+		list.ItemResponse{Index: 1, Item: *list.NewText("t", "Stand by")},
+	} {
+		om.Apply(r)
+	}
+	if err := l.HandleRequest(context.Background(), func(r interface{}) { om.Apply(r) }, ignore, list.DiffRequest{Since: since}); err != nil {
+		t.Fatal("unexpected error diffing:", err)
+	}
+	check("mirror following a diff", om.Items())
+}
+
+// Test_Blocks checks that blocks hold adjacent items, grow and shrink with them, and move and go as one, and that
+// mirrors and replicas following the broadcasts, or a diff, keep up.
+func Test_Blocks(t *testing.T) {
+	l := list.New()
+	rep := list.New()
+	rep.SetReplica(true)
+	m := list.NewMirror()
+	var bcasts []interface{}
+	bcast := func(rbody interface{}) {
+		bcasts = append(bcasts, rbody)
+		m.Apply(rbody)
+		if err := rep.HandleRequest(context.Background(), func(interface{}) {}, func(interface{}) {}, list.ReplicateRequest{Response: rbody}); err != nil {
+			t.Fatalf("unexpected error replicating %v: %v", rbody, err)
+		}
+	}
+	do := func(rq interface{}) error {
+		t.Helper()
+		bcasts = nil
+		return l.HandleRequest(context.Background(), func(interface{}) {}, bcast, rq)
+	}
+	must := func(rq interface{}) {
+		t.Helper()
+		if err := do(rq); err != nil {
+			t.Fatalf("%v: unexpected error: %v", rq, err)
+		}
+	}
+	check := func(what, wantHashes, wantBlocks string) {
+		t.Helper()
+		if got := fmt.Sprint(hashes(l)); got != wantHashes {
+			t.Errorf("%s: items: got %s, want %s", what, got, wantHashes)
+		}
+		want := fmt.Sprint(l.Blocks())
+		if want != wantBlocks {
+			t.Errorf("%s: blocks: got %s, want %s", what, want, wantBlocks)
+		}
+		if got := fmt.Sprint(m.Blocks()); got != want {
+			t.Errorf("%s: mirrored blocks: got %s, want %s", what, got, want)
+		}
+		if got := fmt.Sprint(rep.Blocks()); got != want {
+			t.Errorf("%s: replicated blocks: got %s, want %s", what, got, want)
+		}
+	}
+
+	for i, h := range []string{"a", "b", "c", "d", "e"} {
+		must(list.AddItemRequest{Index: i, Item: *list.NewTrack(h, h+".mp3")})
+	}
+	l.Dump(func(r interface{}) { m.Apply(r) })
+	since := l.Version()
+
+	must(list.NewBlockRequest{ID: "ads", Index: 1, Count: 2, Title: "Ad break 2"})
+	check("new block", "[a b c d e]", "[{ads 1 2 false Ad break 2}]")
+	for _, rq := range []interface{}{
+		list.NewBlockRequest{ID: "ads", Index: 3, Count: 1},
+		list.NewBlockRequest{ID: "news", Index: 2, Count: 2},
+		list.NewBlockRequest{ID: "news", Index: 4, Count: 2},
+		list.MoveBlockRequest{ID: "nope", Index: 0},
+	} {
+		if err := do(rq); err == nil {
+			t.Errorf("%v: no error", rq)
+		}
+	}
+
+	must(list.AddItemRequest{Index: 2, Item: *list.NewTrack("x", "x.mp3")})
+	must(list.AddItemRequest{Index: 1, Item: *list.NewTrack("y", "y.mp3")})
+	check("adding items", "[a y b x c d e]", "[{ads 2 3 false Ad break 2}]")
+
+	must(list.NewBlockRequest{ID: "news", Index: 5, Count: 2, Title: "News"})
+	if err := do(list.MoveBlockRequest{ID: "ads", Index: 3}); err == nil {
+		t.Error("moving a block inside another: no error")
+	}
+	must(list.MoveBlockRequest{ID: "ads", Index: 4})
+	check("moving a block down", "[a y d e b x c]", "[{news 2 2 false News} {ads 4 3 false Ad break 2}]")
+	must(list.MoveBlockRequest{ID: "ads", Index: 0})
+	check("moving a block up", "[b x c a y d e]", "[{ads 0 3 false Ad break 2} {news 5 2 false News}]")
+
+	must(list.SetBlockRequest{ID: "news", Collapsed: true, Title: "News at 6"})
+	check("changing a block", "[b x c a y d e]", "[{ads 0 3 false Ad break 2} {news 5 2 true News at 6}]")
+
+	must(list.SetSelectRequest{Index: 1, Hash: "x"})
+	if err := do(list.RemoveBlockRequest{ID: "ads"}); err == nil {
+		t.Error("removing the selected item's block: no error")
+	}
+	must(list.DissolveBlockRequest{ID: "ads"})
+	must(list.RemoveBlockRequest{ID: "news"})
+	check("removing blocks", "[b x c a y]", "[]")
+	if got, want := fmt.Sprint(bcasts), fmt.Sprint([]interface{}{
+		list.ItemRemoveResponse{Hash: "d"},
+		list.ItemRemoveResponse{Hash: "e"},
+		list.BlockClearedResponse{ID: "news"},
+		list.VersionResponse{Version: l.Version()},
+	}); got != want {
+		t.Errorf("broadcasts of removal: got %s, want %s", got, want)
+	}
+
+	must(list.NewBlockRequest{ID: "end", Index: 3, Count: 2, Title: "Outro"})
+	dm := list.NewMirror()
+	for _, h := range []string{"a", "b", "c", "d", "e"} {
+		dm.Apply(list.ItemResponse{Index: len(dm.Items()), Item: *list.NewTrack(h, h+".mp3")})
+	}
+	if err := l.HandleRequest(context.Background(), func(r interface{}) { dm.Apply(r) }, func(interface{}) {}, list.DiffRequest{Since: since}); err != nil {
+		t.Fatal("unexpected error diffing:", err)
+	}
+	if got, want := fmt.Sprint(dm.Blocks()), fmt.Sprint(l.Blocks()); got != want {
+		t.Errorf("blocks after diff: got %s, want %s", got, want)
+	}
+
+	restored := list.New()
+	if err := restored.Restore(l.State()); err != nil {
+		t.Fatal("unexpected error restoring:", err)
+	}
+	if got, want := fmt.Sprint(restored.Blocks()), fmt.Sprint(l.Blocks()); got != want {
+		t.Errorf("blocks after restoring: got %s, want %s", got, want)
+	}
+}
+
+// Test_State_Check_blocks checks that states whose blocks are broken are refused, and repaired.
+func Test_State_Check_blocks(t *testing.T) {
+	st := list.State{
+		Selection: -1,
+		Items: []list.ItemState{
+			{Hash: "a", Type: list.ItemTrack, Block: "ads"},
+			{Hash: "b", Type: list.ItemTrack},
+			{Hash: "c", Type: list.ItemTrack, Block: "ads"},
+			{Hash: "d", Type: list.ItemTrack, Block: "news"},
+		},
+		Blocks: []list.Block{{ID: "ads"}, {ID: "empty"}},
+	}
+	if got := len(st.Check()); got != 3 {
+		t.Errorf("problems: got %d (%v), want 3", got, st.Check())
+	}
+
+	fixed, repairs := st.Repair()
+	if problems := fixed.Check(); len(problems) != 0 {
+		t.Errorf("repaired state still has problems %v (repairs %v)", problems, repairs)
+	}
+	var blocks []string
+	for _, is := range fixed.Items {
+		blocks = append(blocks, is.Block)
+	}
+	if got, want := fmt.Sprintf("%q %v", blocks, fixed.Blocks), `["ads" "" "" ""] [{ads  false}]`; got != want {
+		t.Errorf("repaired blocks: got %s, want %s", got, want)
+	}
+}
+
+// Test_State_Repair_selection checks that repairs keep the selection, and when it was made, where they can, and
+// forget both where they can't.
+func Test_State_Repair_selection(t *testing.T) {
+	at := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	st := list.State{
+		Items: []list.ItemState{
+			{Hash: "a", Type: list.ItemTrack},
+			{Hash: "a", Type: list.ItemTrack},
+			{Hash: "b", Type: list.ItemTrack},
+			{Hash: "t", Type: list.ItemText},
+		},
+		Selection:  2,
+		SelectedAt: at,
+	}
+
+	fixed, repairs := st.Repair()
+	if fixed.Selection != 1 || !fixed.SelectedAt.Equal(at) {
+		t.Errorf("kept selection: got %d at %v, want 1 at %v (repairs %v)", fixed.Selection, fixed.SelectedAt, at, repairs)
+	}
+
+	st.Selection = 3
+	fixed, repairs = st.Repair()
+	if fixed.Selection != -1 || !fixed.SelectedAt.IsZero() {
+		t.Errorf("cleared selection: got %d at %v, want -1 at the zero time (repairs %v)", fixed.Selection, fixed.SelectedAt, repairs)
+	}
+}
+
+// Test_Upcoming checks that the tracks predicted to come next follow the selection, or, under shuffle, are those the
+// shuffle hasn't used, and never include items that can't be selected.
+func Test_Upcoming(t *testing.T) {
+	l := list.New()
+	for i, it := range []*list.Item{
+		list.NewTrack("a", "a.mp3"),
+		list.NewText("t", "text"),
+		list.NewTrack("b", "b.mp3"),
+		list.NewTrack("c", "c.mp3"),
+		list.NewTrack("d", "d.mp3"),
+	} {
+		if err := l.Add(it, i); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+	if _, err := l.SetItemValidity(2, "b", time.Now().Add(time.Hour), time.Time{}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	hashes := func(rs []list.ItemResponse) string {
+		var hs []string
+		for _, r := range rs {
+			hs = append(hs, fmt.Sprintf("%d:%s", r.Index, r.Item.Hash()))
+		}
+		return strings.Join(hs, " ")
+	}
+	check := func(what string, n int, want string) {
+		t.Helper()
+		if got := hashes(l.Upcoming(n)); got != want {
+			t.Errorf("upcoming %s: got %q, want %q", what, got, want)
+		}
+	}
+
+	check("with nothing selected", 2, "0:a 3:c")
+	if _, err := l.Select(0, "a"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	check("after a", 5, "3:c 4:d")
+
+	l.SetAutoMode(list.AutoShuffle)
+	if _, err := l.Select(3, "c"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	check("on shuffle from c", 5, "0:a 4:d")
+	l.Next()
+	_, picked := l.Selection()
+	if picked == nil {
+		t.Fatal("shuffle dropped the selection")
+	}
+	if strings.Contains(hashes(l.Upcoming(5)), ":"+picked.Hash()) {
+		t.Errorf("upcoming on shuffle includes %s, which the shuffle has used", picked.Hash())
+	}
+}
+
+// Test_CheckHashes checks that a batch of hashes comes back with each hash's index and state, in the order asked.
+func Test_CheckHashes(t *testing.T) {
+	l := list.New()
+	ignore := func(interface{}) {}
+	now := time.Now()
+	for i, h := range []string{"a", "b", "c", "d"} {
+		if err := l.HandleRequest(context.Background(), ignore, ignore, list.AddItemRequest{Index: i, Item: *list.NewTrack(h, h+".mp3")}); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+	if _, err := l.Select(0, "a"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := l.SetItemValidity(1, "b", now.Add(time.Hour), time.Time{}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := l.SetItemValidity(2, "c", time.Time{}, now.Add(-time.Minute)); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	check := func(want ...list.HashStateResponse) {
+		t.Helper()
+		var got []interface{}
+		reply := func(r interface{}) {
+			if _, ok := r.(list.HashStateResponse); ok {
+				got = append(got, r)
+			}
+		}
+		hashes := make([]string, len(want))
+		wants := make([]interface{}, len(want))
+		for i, w := range want {
+			hashes[i], wants[i] = w.Hash, w
+		}
+		if err := l.HandleRequest(context.Background(), reply, ignore, list.CheckHashesRequest{Hashes: hashes}); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(wants) {
+			t.Errorf("got %v, want %v", got, wants)
+		}
+	}
+	check(
+		list.HashStateResponse{Hash: "d", Index: 3, State: list.HashQueued},
+		list.HashStateResponse{Hash: "a", Index: 0, State: list.HashSelected},
+		list.HashStateResponse{Hash: "b", Index: 1, State: list.HashEmbargoed},
+		list.HashStateResponse{Hash: "c", Index: 2, State: list.HashExpired},
+		list.HashStateResponse{Hash: "z", Index: -1, State: list.HashUnknown},
+	)
+
+	l.SetExpiryPolicy(list.ExpiryRemove)
+	if err := l.HandleRequest(context.Background(), ignore, ignore, list.ExpireRequest{}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	check(
+		list.HashStateResponse{Hash: "c", Index: -1, State: list.HashRemoved},
+		list.HashStateResponse{Hash: "d", Index: 2, State: list.HashQueued},
+	)
+}
+
+// Test_Plays checks that selections are counted by hash, and remembered in order.
+func Test_Plays(t *testing.T) {
+	l := list.New()
+	l.SetPlayCounts(map[string]int{"a": 5})
+	for i, h := range []string{"a", "b"} {
+		if err := l.Add(list.NewTrack(h, h+".mp3"), i); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	for _, sel := range []struct {
+		index int
+		hash  string
+	}{{0, "a"}, {0, "a"}, {1, "b"}, {0, "a"}} {
+		if _, err := l.Select(sel.index, sel.hash); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	// Reselecting the selected item isn't a new play.
+	if got := l.PlayCounts(); got["a"] != 7 || got["b"] != 1 {
+		t.Errorf("play counts: got %v, want a:7 b:1", got)
+	}
+
+	var got []string
+	for _, r := range l.PlayHistory(2) {
+		got = append(got, r.Hash+"="+r.Payload)
+	}
+	if want := []string{"b=b.mp3", "a=a.mp3"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("play history: got %v, want %v", got, want)
+	}
+}
+
+// Test_Alerts checks that alerts are deduplicated and rate-limited, and that storage failures raise one.
+func Test_Alerts(t *testing.T) {
+	l := list.New()
+	l.SetAlertInterval(time.Minute)
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		name  string
+		sev   list.AlertSeverity
+		msg   string
+		after time.Duration
+		want  bool
+	}{
+		{"first raise", list.AlertError, "down", 0, true},
+		{"repeat", list.AlertError, "down", time.Second, false},
+		{"change inside interval", list.AlertCritical, "very down", time.Second, false},
+		{"change after interval", list.AlertError, "down again", 2 * time.Minute, true},
+	}
+	now := start
+	for _, s := range steps {
+		now = now.Add(s.after)
+		if _, got := l.RaiseAlert("mount", s.sev, s.msg, now); got != s.want {
+			t.Errorf("%s: broadcast %v, want %v", s.name, got, s.want)
+		}
+	}
+
+	as := l.Alerts()
+	if len(as) != 1 {
+		t.Fatalf("got %d alerts, want 1", len(as))
+	}
+	if a := as[0]; a.Count != 4 || !a.Since.Equal(start) || a.Message != "down again" {
+		t.Errorf("alert: got %+v, want 4 raises since %v, message 'down again'", a, start)
+	}
+
+	// Clearances of broadcast alerts aren't rate-limited, so clients never think an alert is still active.
+	if !l.ClearAlert("mount") {
+		t.Error("clearing a broadcast alert: not broadcast")
+	}
+	if _, got := l.RaiseAlert("mount", list.AlertError, "flapping", now.Add(time.Second)); got {
+		t.Error("raise inside interval after clearing: broadcast")
+	}
+	if l.ClearAlert("mount") {
+		t.Error("clearing an alert never broadcast: broadcast")
+	}
+
+	// Storage failures raise an alert, but don't bump the version.
+	l.SetStateSaver(func(list.State) error { return fmt.Errorf("disk full") })
+	var bcasts []string
+	bcast := func(rbody interface{}) { bcasts = append(bcasts, fmt.Sprintf("%T", rbody)) }
+	if err := l.HandleRequest(context.Background(), func(interface{}) {}, bcast, list.SetListNoteRequest{Note: "x"}); err == nil {
+		t.Error("note with failing storage: no error")
+	}
+	if want := "[list.ListNoteResponse list.VersionResponse list.AlertResponse]"; fmt.Sprint(bcasts) != want {
+		t.Errorf("broadcasts: got %v, want %s", bcasts, want)
+	}
+	if l.Version() != 1 {
+		t.Errorf("version: got %d, want 1", l.Version())
+	}
+}
+
+// Test_Scratchpad checks that scratchpads are private to their sessions, and splice into the list in one change.
+func Test_Scratchpad(t *testing.T) {
+	l := list.New()
+	l.SetDedupe(true)
+	ignore := func(interface{}) {}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, list.AddItemRequest{Index: 0, Item: *list.NewTrack("a", "a.mp3")}); err != nil {
+		t.Fatal("unexpected error adding:", err)
+	}
+
+	var me, you controller.Session = 1, 2
+	var bcasts []interface{}
+	bcast := func(rbody interface{}) { bcasts = append(bcasts, rbody) }
+	for i, h := range []string{"b", "c"} {
+		add := list.AddScratchItemRequest{Index: i, Item: *list.NewTrack(h, h+".mp3")}
+		if err := l.HandleSessionRequest(context.Background(), me, ignore, bcast, add); err != nil {
+			t.Fatal("unexpected error adding to scratchpad:", err)
+		}
+	}
+	if len(bcasts) != 0 || l.Count() != 1 || l.Version() != 1 {
+		t.Errorf("scratchpad changed the list: broadcasts %v, count %d, version %d", bcasts, l.Count(), l.Version())
+	}
+	if err := l.HandleSessionRequest(context.Background(), you, ignore, bcast, list.ScratchDumpRequest{}); !errors.Is(err, list.ErrNoScratchpad) {
+		t.Errorf("dumping another session's scratchpad: got error %v, want ErrNoScratchpad", err)
+	}
+
+	// A stale promotion fails, and keeps the scratchpad for another try.
+	stale := list.VersionedRequest{Version: 0, Request: list.PromoteScratchRequest{Index: 0}}
+	if err := l.HandleSessionRequest(context.Background(), me, ignore, bcast, stale); err == nil {
+		t.Error("stale promotion: no error")
+	}
+	if err := l.HandleSessionRequest(context.Background(), me, ignore, bcast, list.PromoteScratchRequest{Index: 0}); err != nil {
+		t.Fatal("unexpected error promoting:", err)
+	}
+	if got, want := fmt.Sprint(hashes(l)), "[b c a]"; got != want {
+		t.Errorf("list after promotion: got %s, want %s", got, want)
+	}
+	if l.Version() != 2 {
+		t.Errorf("version after promotion: got %d, want 2", l.Version())
+	}
+	if err := l.HandleSessionRequest(context.Background(), me, ignore, bcast, list.ScratchDumpRequest{}); !errors.Is(err, list.ErrNoScratchpad) {
+		t.Errorf("dumping a promoted scratchpad: got error %v, want ErrNoScratchpad", err)
+	}
+
+	// If one item can't go in, none do.
+	for i, h := range []string{"d", "a2"} {
+		add := list.AddScratchItemRequest{Index: i, Item: *list.NewTrack(h, strings.TrimSuffix(h, "2")+".mp3")}
+		if err := l.HandleSessionRequest(context.Background(), you, ignore, bcast, add); err != nil {
+			t.Fatal("unexpected error adding to scratchpad:", err)
+		}
+	}
+	if err := l.HandleSessionRequest(context.Background(), you, ignore, bcast, list.PromoteScratchRequest{Index: 1}); err == nil {
+		t.Error("promoting a duplicate: no error")
+	}
+	if got, want := fmt.Sprint(hashes(l)), "[b c a]"; got != want {
+		t.Errorf("list after failed promotion: got %s, want %s", got, want)
+	}
+
+	l.EndSession(you)
+	if err := l.HandleSessionRequest(context.Background(), you, ignore, bcast, list.PromoteScratchRequest{Index: 0}); !errors.Is(err, list.ErrNoScratchpad) {
+		t.Errorf("promoting after the session ended: got error %v, want ErrNoScratchpad", err)
+	}
+}
+
+// Test_Clone checks that cloning a list copies its running order, with fresh hashes if asked, and nothing else.
+func Test_Clone(t *testing.T) {
+	l := list.New()
+	ignore := func(interface{}) {}
+	for i, h := range []string{"a", "b"} {
+		if err := l.HandleRequest(context.Background(), ignore, ignore, list.AddItemRequest{Index: i, Item: *list.NewTrack(h, h+".mp3")}); err != nil {
+			t.Fatal("unexpected error adding:", err)
+		}
+	}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, list.SetSelectRequest{Index: 1, Hash: "b"}); err != nil {
+		t.Fatal("unexpected error selecting:", err)
+	}
+
+	same, err := l.Clone(false)
+	if err != nil {
+		t.Fatal("unexpected error cloning:", err)
+	}
+	if got, want := fmt.Sprint(hashes(same)), "[a b]"; got != want {
+		t.Errorf("clone keeping hashes: got %s, want %s", got, want)
+	}
+	if i, _ := same.Selection(); i != -1 {
+		t.Errorf("clone selection: got %d, want -1", i)
+	}
+
+	fresh, err := l.Clone(true)
+	if err != nil {
+		t.Fatal("unexpected error cloning:", err)
+	}
+	items := fresh.Freeze()
+	if len(items) != 2 || items[0].Payload() != "a.mp3" || items[1].Payload() != "b.mp3" {
+		t.Fatalf("fresh clone: got %v, want copies of a and b", items)
+	}
+	for i, it := range items {
+		if h := it.Hash(); h == "a" || h == "b" || h == "" {
+			t.Errorf("fresh clone item %d: got stale hash %q", i, h)
+		}
+	}
+}
+
+// Test_CloneRequest checks that cloning a template into a list splices it in, with fresh hashes, as one change.
+func Test_CloneRequest(t *testing.T) {
+	l := list.New()
+	ignore := func(interface{}) {}
+	rq := list.CloneRequest{Index: 0, Template: "weekly"}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, rq); !errors.Is(err, list.ErrNoTemplates) {
+		t.Errorf("cloning without templates: got error %v, want ErrNoTemplates", err)
+	}
+
+	tpl := list.Template{Items: []list.ItemState{
+		{Hash: "x", Type: list.ItemText, Payload: "Hello"},
+		{Hash: "y", Type: list.ItemTrack, Payload: "theme.mp3"},
+	}}
+	l.SetTemplates(func(name string) (list.Template, error) {
+		if name != "weekly" {
+			return list.Template{}, fmt.Errorf("no template %q", name)
+		}
+		return tpl, nil
+	})
+
+	var bcasts []interface{}
+	bcast := func(rbody interface{}) { bcasts = append(bcasts, rbody) }
+	for week := 1; week <= 2; week++ {
+		if err := l.HandleRequest(context.Background(), ignore, bcast, list.VersionedRequest{Version: uint64(week - 1), Request: rq}); err != nil {
+			t.Fatalf("week %d: unexpected error cloning: %v", week, err)
+		}
+		if l.Count() != 2*week || l.Version() != uint64(week) {
+			t.Errorf("week %d: got count %d, version %d; want %d, %d", week, l.Count(), l.Version(), 2*week, week)
+		}
+	}
+	if n := len(bcasts); n < 4 {
+		t.Errorf("got %d broadcasts, want at least one per item", n)
+	}
+
+	// A cancelled clone leaves the list as it was.
+	cctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.HandleRequest(cctx, ignore, ignore, rq); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled clone: got error %v, want context.Canceled", err)
+	}
+	if l.Count() != 4 || l.Version() != 2 {
+		t.Errorf("cancelled clone changed the list: count %d, version %d", l.Count(), l.Version())
+	}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, list.CloneRequest{Index: 0, Template: "daily"}); err == nil {
+		t.Error("cloning a missing template: no error")
+	}
+}
+
+// Test_SeparatorRequest checks that separators go into the list as fresh, unselectable text items with their note and
+// category.
+func Test_SeparatorRequest(t *testing.T) {
+	l := list.New()
+	l.DefineCategories([]list.Category{{Name: "speech"}})
+	l.DefineSeparators([]list.Separator{
+		{Name: "news", Text: "NEWS", Note: "Hand over", Category: "speech"},
+		{Name: "bad", Text: "BAD", Category: "advert"},
+	})
+	ignore := func(interface{}) {}
+
+	for i := 0; i < 2; i++ {
+		if err := l.HandleRequest(context.Background(), ignore, ignore, list.SeparatorRequest{Index: 0, Name: "news"}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	items := l.Freeze()
+	if len(items) != 2 || items[0].Hash() == items[1].Hash() {
+		t.Fatalf("got items %v, want two copies with different hashes", hashes(l))
+	}
+	it := items[0]
+	if it.Type() != list.ItemText || it.Payload() != "NEWS" || it.Note() != "Hand over" {
+		t.Errorf("got %s item %q with note %q, want text item NEWS with note Hand over", it.Type(), it.Payload(), it.Note())
+	}
+	if cat, _ := l.ItemCategory(0, it.Hash()); cat != "speech" {
+		t.Errorf("got category %q, want speech", cat)
+	}
+	if _, err := l.Select(0, it.Hash()); err == nil {
+		t.Error("selected a separator")
+	}
+
+	for _, name := range []string{"weather", "bad"} {
+		if err := l.HandleRequest(context.Background(), ignore, ignore, list.SeparatorRequest{Index: 0, Name: name}); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+	if l.Count() != 2 {
+		t.Errorf("failed separators changed the list: count %d", l.Count())
+	}
+}
+
+// hashes gets the hashes of l's items, in order.
+// Test_Calls checks that the call-and-wait helpers act on, and report, a list behind a real Controller.
+func Test_Calls(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctl, client := controller.NewController(list.New())
+	done := make(chan struct{})
+	go func() {
+		ctl.Run(ctx)
+		close(done)
+	}()
+	// The Controller waits for every client to take its broadcasts, including this one.
+	go func() {
+		for range client.Rx {
+		}
+	}()
+
+	for i, it := range []*list.Item{list.NewTrack("a", "alpha.mp3"), list.NewTrack("b", "beta.mp3")} {
+		if err := list.AddItem(ctx, client, i, *it); err != nil {
+			t.Fatalf("adding %s: %v", it.Hash(), err)
+		}
+	}
+	if err := list.Select(ctx, client, 1, "a"); err == nil {
+		t.Error("selecting with the wrong hash: no error")
+	}
+	if err := list.Select(ctx, client, 1, "b"); err != nil {
+		t.Errorf("selecting: %v", err)
+	}
+	if err := list.SetAutoMode(ctx, client, list.AutoNext); err != nil {
+		t.Errorf("setting automode: %v", err)
+	}
+
+	found, err := list.Search(ctx, client, "ALPHA", "")
+	if err != nil {
+		t.Errorf("searching: %v", err)
+	} else if len(found) != 1 || found[0].Hash != "a" {
+		t.Errorf("search: got %+v, want just 'a'", found)
+	}
+
+	m, err := list.DumpList(ctx, client)
+	if err != nil {
+		t.Fatalf("dumping: %v", err)
+	}
+	if i, it := m.Selection(); i != 1 || it == nil || it.Hash() != "b" {
+		t.Errorf("selection: got %d, %v, want 1, b", i, it)
+	}
+	if m.AutoMode() != list.AutoNext {
+		t.Errorf("automode: got %v, want %v", m.AutoMode(), list.AutoNext)
+	}
+
+	if err := client.Shutdown(ctx); err != nil {
+		t.Fatalf("shutting down: %v", err)
+	}
+	<-done
+	cancel()
+	if err := list.SetAutoMode(ctx, client, list.AutoOff); !errors.Is(err, controller.ErrControllerShutDown) {
+		t.Errorf("calling after shutdown: got %v, want %v", err, controller.ErrControllerShutDown)
+	}
+}
+
+// Test_DryRun checks that dry runs report what a request would do, or how it would fail, without doing it.
+func Test_DryRun(t *testing.T) {
+	l := list.New()
+	for i, it := range []*list.Item{list.NewTrack("a", "alpha.mp3"), list.NewTrack("b", "beta.mp3")} {
+		if err := l.Add(it, i); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+	before := l.State()
+
+	dry := func(word string, args ...string) ([]string, error) {
+		t.Helper()
+		rq, err := l.ParseBifrostRequest("dryrun", append([]string{word}, args...))
+		if err != nil {
+			t.Fatalf("dryrun %s %v: couldn't parse: %v", word, args, err)
+		}
+		var got []string
+		reply := func(rbody interface{}) { got = append(got, fmt.Sprintf("%T", rbody)) }
+		bcast := func(rbody interface{}) { t.Errorf("dryrun %s %v: broadcast %v", word, args, rbody) }
+		return got, l.HandleRequest(context.Background(), reply, bcast, rq)
+	}
+
+	got, err := dry("sel", "1", "b")
+	if err != nil {
+		t.Errorf("dry run of a good selection: unexpected error: %v", err)
+	}
+	if want := "[list.SelectResponse list.ItemPlaysResponse list.VersionResponse]"; fmt.Sprint(got) != want {
+		t.Errorf("dry run of a good selection: got %v, want %s", got, want)
+	}
+	if _, err := dry("sel", "1", "a"); err == nil {
+		t.Error("dry run of a bad selection: no error")
+	}
+	if _, err := dry("note", "changed", "5"); err == nil {
+		t.Error("dry run at the wrong version: no error")
+	}
+
+	if after := l.State(); !reflect.DeepEqual(before, after) {
+		t.Errorf("dry runs changed the list: got %+v, want %+v", after, before)
+	}
+}
+
+func Test_Maintenance(t *testing.T) {
+	l := list.New()
+	w, err := list.ParseMaintenanceWindow(nil, "02:00", 30*time.Minute, "backup")
+	if err != nil {
+		t.Fatal("unexpected error parsing window:", err)
+	}
+	l.SetMaintenanceWindows([]list.MaintenanceWindow{w}, 10*time.Minute)
+
+	day := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.Local)
+	at := func(h, m int) time.Time { return day.Add(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute) }
+	check := func(now, wantNext time.Time, want ...string) {
+		t.Helper()
+		rs, next := l.CheckMaintenance(now)
+		var got []string
+		for _, r := range rs {
+			got = append(got, fmt.Sprintf("%T", r))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("check at %s: got %v, want %v", now.Format("15:04"), got, want)
+		}
+		if !next.Equal(wantNext) {
+			t.Errorf("check at %s: next check at %v, want %v", now.Format("15:04"), next, wantNext)
+		}
+	}
+
+	ignore := func(interface{}) {}
+	add := list.AddItemRequest{Index: 0, Item: *list.NewTrack("abc", "foo.mp3")}
+
+	check(at(1, 45), at(1, 50))
+	check(at(1, 55), at(2, 0), "list.AlertResponse")
+	check(at(2, 5), at(2, 30), "list.MaintenanceResponse", "list.AlertClearedResponse")
+	if r, ok := l.Maintenance(); !ok || !r.Until.Equal(at(2, 30)) || r.Reason != "backup" {
+		t.Errorf("maintenance during window: got %v, %v", r, ok)
+	}
+
+	var me list.MaintenanceError
+	if err := l.HandleRequest(context.Background(), ignore, ignore, add); !errors.As(err, &me) {
+		t.Errorf("add during maintenance: got %v, want a MaintenanceError", err)
+	}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, list.SearchRequest{Query: "foo"}); err != nil {
+		t.Errorf("search during maintenance: unexpected error: %v", err)
+	}
+
+	check(at(2, 30), at(24+1, 50), "list.MaintenanceResponse")
+	if _, ok := l.Maintenance(); ok {
+		t.Error("still in maintenance after the window")
+	}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, add); err != nil {
+		t.Errorf("add after maintenance: unexpected error: %v", err)
+	}
+
+	l.SetMaintenanceAdmins("ops")
+	start := list.MaintenanceRequest{Duration: time.Hour, Reason: "upgrade"}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, start); !errors.Is(err, controller.ErrNotAdmin) {
+		t.Errorf("maintenance from a non-admin: got %v, want %v", err, controller.ErrNotAdmin)
+	}
+	admin := controller.WithIdentity(context.Background(), auth.Identity{User: "root", Groups: []string{"ops"}})
+	if err := l.HandleRequest(admin, ignore, ignore, start); err != nil {
+		t.Errorf("maintenance from an admin: unexpected error: %v", err)
+	}
+	if _, ok := l.Maintenance(); !ok {
+		t.Error("not in maintenance after an admin asked")
+	}
+	if err := l.HandleRequest(admin, ignore, ignore, list.MaintenanceRequest{}); err != nil {
+		t.Errorf("ending maintenance: unexpected error: %v", err)
+	}
+	if _, ok := l.Maintenance(); ok {
+		t.Error("still in maintenance after an admin ended it")
+	}
+}
+
+// Test_Emergency checks that an emergency puts the fail-safe track on air, even during maintenance, and locks the list
+// until an admin releases it.
+func Test_Emergency(t *testing.T) {
+	l := list.New()
+	ignore := func(interface{}) {}
+	for i, h := range []string{"a", "b"} {
+		if err := l.HandleRequest(context.Background(), ignore, ignore, list.AddItemRequest{Index: i, Item: *list.NewTrack(h, h+".mp3")}); err != nil {
+			t.Fatal("unexpected error adding:", err)
+		}
+	}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, list.EmergencyRequest{}); !errors.Is(err, list.ErrNoFailsafe) {
+		t.Errorf("emergency without a fail-safe: got %v, want %v", err, list.ErrNoFailsafe)
+	}
+
+	l.SetFailsafe("sustainer.mp3")
+	l.SetMaintenanceAdmins("ops")
+	admin := controller.WithIdentity(context.Background(), auth.Identity{User: "root", Groups: []string{"ops"}})
+	if err := l.HandleRequest(admin, ignore, ignore, list.SetSelectRequest{Index: 0, Hash: "a"}); err != nil {
+		t.Fatal("unexpected error selecting:", err)
+	}
+	if err := l.HandleRequest(admin, ignore, ignore, list.MaintenanceRequest{Duration: time.Hour}); err != nil {
+		t.Fatal("unexpected error starting maintenance:", err)
+	}
+
+	var bcasts []string
+	bcast := func(r interface{}) { bcasts = append(bcasts, fmt.Sprintf("%T", r)) }
+	if err := l.HandleRequest(context.Background(), ignore, bcast, list.EmergencyRequest{Reason: "dead air"}); err != nil {
+		t.Fatal("unexpected error in emergency:", err)
+	}
+	if i, item := l.Selection(); i != 1 || item.Payload() != "sustainer.mp3" {
+		t.Errorf("selection in emergency: got %d (%v), want the fail-safe at 1", i, item)
+	}
+	for _, want := range []string{"list.ItemResponse", "list.SelectResponse", "list.EmergencyResponse", "list.AlertResponse"} {
+		if !strings.Contains(fmt.Sprint(bcasts), want) {
+			t.Errorf("emergency broadcasts: got %v, want a %s", bcasts, want)
+		}
+	}
+	if err := l.HandleRequest(admin, ignore, ignore, list.MaintenanceRequest{}); err != nil {
+		t.Fatal("unexpected error ending maintenance:", err)
+	}
+
+	var ee list.EmergencyError
+	if err := l.HandleRequest(context.Background(), ignore, ignore, list.SetSelectRequest{Index: 0, Hash: "a"}); !errors.As(err, &ee) {
+		t.Errorf("select in emergency: got %v, want an EmergencyError", err)
+	}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, list.ReleaseRequest{}); !errors.Is(err, controller.ErrNotAdmin) {
+		t.Errorf("release from a non-admin: got %v, want %v", err, controller.ErrNotAdmin)
+	}
+	if err := l.HandleRequest(admin, ignore, ignore, list.ReleaseRequest{}); err != nil {
+		t.Fatal("unexpected error releasing:", err)
+	}
+	if _, ok := l.Emergency(); ok {
+		t.Error("still in an emergency after release")
+	}
+	if err := l.HandleRequest(context.Background(), ignore, ignore, list.SetSelectRequest{Index: 0, Hash: "a"}); err != nil {
+		t.Errorf("select after release: unexpected error: %v", err)
+	}
+
+	// The list already has the fail-safe now, so a second emergency reuses it.
+	if err := l.HandleRequest(context.Background(), ignore, ignore, list.EmergencyRequest{}); err != nil {
+		t.Fatal("unexpected error in second emergency:", err)
+	}
+	if got := l.Count(); got != 3 {
+		t.Errorf("count after second emergency: got %d, want 3", got)
+	}
+}
+
+func Test_ParseMaintenanceWindow(t *testing.T) {
+	w, err := list.ParseMaintenanceWindow([]string{"Sat", "sunday"}, "23:15", time.Hour, "")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if want := []time.Weekday{time.Saturday, time.Sunday}; !reflect.DeepEqual(w.Days, want) {
+		t.Errorf("days: got %v, want %v", w.Days, want)
+	}
+	if want := 23*time.Hour + 15*time.Minute; w.At != want {
+		t.Errorf("at: got %v, want %v", w.At, want)
+	}
+
+	for _, c := range []struct {
+		days     []string
+		at       string
+		duration time.Duration
+	}{
+		{nil, "25:00", time.Hour},
+		{nil, "noon", time.Hour},
+		{[]string{"funday"}, "12:00", time.Hour},
+		{nil, "12:00", 0},
+	} {
+		if _, err := list.ParseMaintenanceWindow(c.days, c.at, c.duration, ""); err == nil {
+			t.Errorf("window %v at %s for %v: no error", c.days, c.at, c.duration)
+		}
+	}
+}
+
+// Test_Clock checks that a list checks validity, and records plays, by its clock rather than the system's.
+func Test_Clock(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewMock(start)
+	l := list.New()
+	l.SetClock(clk)
+
+	if err := l.Add(list.NewTrack("a", "a.mp3"), 0); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := l.SetItemValidity(0, "a", start.Add(time.Hour), time.Time{}); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	var ee list.EmbargoError
+	if _, err := l.Select(0, "a"); !errors.As(err, &ee) {
+		t.Errorf("selecting before valid-from: got %v, want an EmbargoError", err)
+	}
+	clk.Advance(2 * time.Hour)
+	if _, err := l.Select(0, "a"); err != nil {
+		t.Fatal("selecting after valid-from: unexpected error:", err)
+	}
+
+	ps := l.PlayHistory(0)
+	if len(ps) != 1 || !ps[0].At.Equal(start.Add(2*time.Hour)) {
+		t.Errorf("plays: got %v, want one at %v", ps, start.Add(2*time.Hour))
+	}
+}
+
+// Test_Handover checks that a list only moves on from an ended selection once the player is ready for the next track,
+// or the player has had its time.
+func Test_Handover(t *testing.T) {
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewMock(start)
+	l := list.New()
+	l.SetClock(clk)
+	l.SetHandoverTimeout(10 * time.Second)
+	l.SetAutoMode(list.AutoNext)
+
+	ignore := func(interface{}) {}
+	var bcasts []interface{}
+	bcast := func(r interface{}) { bcasts = append(bcasts, r) }
+	rq := func(rbody interface{}) error {
+		t.Helper()
+		bcasts = nil
+		return l.HandleRequest(context.Background(), ignore, bcast, rbody)
+	}
+	wantHandover := func(want list.HandoverResponse) {
+		t.Helper()
+		for _, r := range bcasts {
+			if got, ok := r.(list.HandoverResponse); ok {
+				if got != want {
+					t.Errorf("handover: got %+v, want %+v", got, want)
+				}
+				return
+			}
+		}
+		t.Errorf("handover: got none, want %+v", want)
+	}
+	wantSelection := func(want int) {
+		t.Helper()
+		if got, _ := l.Selection(); got != want {
+			t.Errorf("selection: got %d, want %d", got, want)
+		}
+	}
+
+	for i, it := range []*list.Item{
+		list.NewTrack("a", "a.mp3"),
+		list.NewText("t", "text"),
+		list.NewTrack("b", "b.mp3"),
+		list.NewTrack("c", "c.mp3"),
+	} {
+		if err := rq(list.AddItemRequest{Index: i, Item: *it}); err != nil {
+			t.Fatal("unexpected error adding:", err)
+		}
+	}
+
+	// The text item can't go to air, so is skipped.
+	if err := rq(list.SetSelectRequest{Index: 0, Hash: "a"}); err != nil {
+		t.Fatal("unexpected error selecting:", err)
+	}
+	wantHandover(list.HandoverResponse{Index: 2, Hash: "b", State: list.HandoverPending})
+
+	if err := rq(list.HandoverReadyRequest{Index: 3, Hash: "c"}); err == nil {
+		t.Error("ready for an item not being handed over to: no error")
+	}
+	if err := rq(list.HandoverReadyRequest{Index: 2, Hash: "b"}); err != nil {
+		t.Fatal("unexpected error readying:", err)
+	}
+	wantHandover(list.HandoverResponse{Index: 2, Hash: "b", State: list.HandoverReady})
+
+	if err := rq(list.EndRequest{Index: 0, Hash: "a"}); err != nil {
+		t.Fatal("unexpected error ending:", err)
+	}
+	wantSelection(2)
+	wantHandover(list.HandoverResponse{Index: 3, Hash: "c", State: list.HandoverPending})
+
+	// Now the player isn't ready in time.
+	if err := rq(list.EndRequest{Index: 2, Hash: "b"}); err != nil {
+		t.Fatal("unexpected error ending:", err)
+	}
+	wantSelection(2)
+	due := start.Add(10 * time.Second)
+	wantHandover(list.HandoverResponse{Index: 3, Hash: "c", State: list.HandoverWaiting, Due: due})
+
+	if err := rq(list.HandoverCheckRequest{}); err != nil {
+		t.Fatal("unexpected error checking:", err)
+	}
+	wantSelection(2)
+	clk.Advance(10 * time.Second)
+	if err := rq(list.HandoverCheckRequest{}); err != nil {
+		t.Fatal("unexpected error checking:", err)
+	}
+	wantSelection(3)
+	if alerts := l.Alerts(); len(alerts) != 1 || alerts[0].Key != list.AlertKeyHandover {
+		t.Errorf("alerts: got %v, want one handover alert", alerts)
+	}
+
+	// With nothing left to hand over to, ending falls back on the automode.
+	if _, ok := l.Handover(); ok {
+		t.Error("handover at the end of the list")
+	}
+	if err := rq(list.EndRequest{Index: 3, Hash: "c"}); err != nil {
+		t.Fatal("unexpected error ending:", err)
+	}
+	wantSelection(-1)
+}
+
+// Test_RunHandover_replica checks that handovers wait out a replica's promotion, then run as usual.
+func Test_RunHandover_replica(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	clk := clock.NewMock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	l := list.New()
+	l.SetClock(clk)
+	l.SetHandoverTimeout(10 * time.Second)
+	l.SetAutoMode(list.AutoNext)
+	for i, h := range []string{"a", "b"} {
+		if err := l.Add(list.NewTrack(h, h+".mp3"), i); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+	l.SetReplica(true)
+
+	wl := watchedList{List: l, handled: make(chan interface{}, 16)}
+	ctl, client := controller.NewController(wl)
+	go ctl.Run(ctx)
+	handedOver := make(chan struct{}, 1)
+	go func() {
+		for r := range client.Rx {
+			if r, ok := r.Body.(list.SelectResponse); ok && r.Hash == "b" {
+				select {
+				case handedOver <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	hoClient, err := client.Copy(ctx)
+	if err != nil {
+		t.Fatal("unexpected error copying client:", err)
+	}
+	errc := make(chan error, 1)
+	go func() {
+		errc <- list.RunHandover(ctx, hoClient, clk)
+	}()
+
+	// The first check comes while the list is still a replica.
+	wl.await(t, list.HandoverCheckRequest{})
+	for _, rq := range []interface{}{list.PromoteRequest{}, list.SetSelectRequest{Index: 0, Hash: "a"}, list.EndRequest{Index: 0, Hash: "a"}} {
+		if err := client.Call(ctx, rq); err != nil {
+			t.Fatalf("unexpected error sending %T: %v", rq, err)
+		}
+	}
+	// Ending before the player is ready starts the wait, which the next check times.
+	wl.await(t, list.HandoverCheckRequest{})
+	clk.BlockUntil(1)
+	clk.Advance(10 * time.Second)
+
+	select {
+	case <-handedOver:
+	case err := <-errc:
+		t.Fatalf("handovers stopped before handing over: %v", err)
+	}
+}
+
+// watchedList is a List that reports the body of each request it has handled, so that tests can wait for requests
+// that runners send.
+type watchedList struct {
+	*list.List
+	// handled receives the body of each request the list has handled, unless full.
+	handled chan interface{}
+}
+
+// HandleSessionRequest handles a request as the List does, then reports its body.
+func (w watchedList) HandleSessionRequest(ctx context.Context, sid controller.Session, replyCb, bcastCb controller.ResponseCb, rbody interface{}) error {
+	err := w.List.HandleSessionRequest(ctx, sid, replyCb, bcastCb, rbody)
+	select {
+	case w.handled <- rbody:
+	default:
+	}
+	return err
+}
+
+// await waits until w has handled a request with body rbody.
+func (w watchedList) await(t *testing.T, rbody interface{}) {
+	t.Helper()
+	for {
+		select {
+		case got := <-w.handled:
+			if got == rbody {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("never handled %T", rbody)
+		}
+	}
+}
+
+func hashes(l *list.List) []string {
+	var hs []string
+	for _, it := range l.Freeze() {
+		hs = append(hs, it.Hash())
+	}
+	return hs
+}
@@ -0,0 +1,361 @@
+package list
+
+// File maintenance.go contains the List logic for maintenance, in which the list goes read-only for a while, such as
+// for backups and upgrades around live programming.
+//
+// Maintenance starts either when an admin sends a MaintenanceRequest, or when one of the list's maintenance windows
+// comes round; either way, every client hears MAINT, and every request that would change the list fails with the
+// code 'maintenance' until it ends.
+// Before each window, clients are warned with a 'maintenance' alert.
+// Maintenance ends by itself when its time is up, or early when an admin asks; a window ended early doesn't start
+// again until it next comes round.
+// The list doesn't watch the clock itself: RunMaintenance sends it MaintenanceCheckRequests when something is due.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/clock"
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+const (
+	// CodeMaintenance is the error code of MaintenanceErrors.
+	CodeMaintenance = "maintenance"
+	// AlertKeyMaintenance is the key of alerts warning of upcoming maintenance.
+	AlertKeyMaintenance = "maintenance"
+)
+
+// maintenanceRecheck is the longest RunMaintenance waits between checks, so that it notices changes to the clock.
+const maintenanceRecheck = time.Hour
+
+// MaintenanceError is the error returned when a client tries to change the list during maintenance.
+type MaintenanceError struct {
+	// Until is when the maintenance is due to end.
+	Until time.Time
+	// Reason is why the list is read-only, if given.
+	Reason string
+}
+
+// Error gets the error message of a MaintenanceError.
+func (e MaintenanceError) Error() string {
+	msg := "list is read-only for maintenance until " + e.Until.Format(time.RFC3339)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// Code gets the error code of a MaintenanceError.
+func (MaintenanceError) Code() string {
+	return CodeMaintenance
+}
+
+// MaintenanceWindow is a time, recurring daily or on certain days of the week, at which the list goes read-only.
+type MaintenanceWindow struct {
+	// Days are the days of the week on which the window starts; if empty, it starts every day.
+	Days []time.Weekday
+	// At is the time of day, in local time, at which the window starts, as a duration since midnight.
+	At time.Duration
+	// Duration is how long the window lasts.
+	Duration time.Duration
+	// Reason is why the list goes read-only, for clients to show.
+	Reason string
+}
+
+// ParseMaintenanceWindow makes a MaintenanceWindow starting at the local time of day at, such as "02:30", on the days
+// of the week days, such as "mon" or "Sunday" (every day, if empty), and lasting for duration.
+func ParseMaintenanceWindow(days []string, at string, duration time.Duration, reason string) (MaintenanceWindow, error) {
+	w := MaintenanceWindow{Duration: duration, Reason: reason}
+	if duration <= 0 {
+		return w, fmt.Errorf("maintenance at %s: duration must be positive", at)
+	}
+
+	t, err := time.Parse("15:04", at)
+	if err != nil {
+		return w, fmt.Errorf("maintenance at %q: time must be HH:MM", at)
+	}
+	w.At = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+
+	for _, d := range days {
+		wd, err := ParseWeekday(d)
+		if err != nil {
+			return w, fmt.Errorf("maintenance at %s: %w", at, err)
+		}
+		w.Days = append(w.Days, wd)
+	}
+	return w, nil
+}
+
+// ParseWeekday parses the day of the week named s, in full or by its first three letters, ignoring case.
+func ParseWeekday(s string) (time.Weekday, error) {
+	ls := strings.ToLower(s)
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if ls == name || ls == name[:3] {
+			return d, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("unknown day of the week %q", s)
+}
+
+// startsOn checks whether w starts on day d.
+func (w MaintenanceWindow) startsOn(d time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, wd := range w.Days {
+		if wd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// next gets the start and end of the earliest time w comes round that ends after now, if there is one.
+func (w MaintenanceWindow) next(now time.Time) (start, end time.Time, ok bool) {
+	// A time that started this many days ago may not have ended yet.
+	back := int(w.Duration/(24*time.Hour)) + 1
+
+	y, m, d := now.Date()
+	for off := -back; off <= 7; off++ {
+		day := time.Date(y, m, d+off, 0, 0, 0, 0, now.Location())
+		if !w.startsOn(day.Weekday()) {
+			continue
+		}
+		start = day.Add(w.At)
+		end = start.Add(w.Duration)
+		if end.After(now) {
+			return start, end, true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// maintenance is the List's record of its maintenance.
+type maintenance struct {
+	// until is when the current maintenance is due to end, or the zero time if there is none.
+	until time.Time
+	// reason is why the list is read-only.
+	reason string
+	// skipUntil is the end of the last maintenance ended early, before which windows don't start again.
+	skipUntil time.Time
+}
+
+// active checks whether the list is in maintenance.
+func (m maintenance) active() bool {
+	return !m.until.IsZero()
+}
+
+// response gets the announcement of m.
+func (m maintenance) response() MaintenanceResponse {
+	return MaintenanceResponse{Until: m.until, Reason: m.reason}
+}
+
+// SetMaintenanceWindows sets the windows in which l goes read-only by itself, and how long before each its clients
+// are warned; a warning of 0 means they aren't.
+func (l *List) SetMaintenanceWindows(windows []MaintenanceWindow, warning time.Duration) {
+	l.maintenanceWindows = windows
+	l.maintenanceWarning = warning
+}
+
+// SetMaintenanceAdmins sets the group whose members may start and end maintenance by request; empty, the default,
+// means that anyone may.
+func (l *List) SetMaintenanceAdmins(group string) {
+	l.maintenanceAdmins = group
+}
+
+// Maintenance gets the announcement of l's maintenance, and whether l is in maintenance at all.
+func (l *List) Maintenance() (MaintenanceResponse, bool) {
+	return l.maintenance.response(), l.maintenance.active()
+}
+
+// checkMaintenance gets the error with which l refuses the request body rbody, if l is in maintenance and rbody
+// would change it.
+func (l *List) checkMaintenance(rbody interface{}) error {
+	if !l.maintenance.active() || overridesLocks(rbody) || !mutates(rbody) {
+		return nil
+	}
+	return MaintenanceError{Until: l.maintenance.until, Reason: l.maintenance.reason}
+}
+
+// CheckMaintenance starts, warns of, and ends maintenance as is due at time now.
+// It returns the responses announcing what it did, and when it should next be called, or the zero time if nothing is
+// due.
+func (l *List) CheckMaintenance(now time.Time) ([]interface{}, time.Time) {
+	var rs []interface{}
+	if l.maintenance.active() && !now.Before(l.maintenance.until) {
+		l.maintenance = maintenance{skipUntil: l.maintenance.skipUntil}
+		rs = append(rs, MaintenanceResponse{})
+	}
+
+	start, end, w, ok := l.nextMaintenanceWindow(now)
+	if !ok {
+		return rs, l.maintenance.until
+	}
+
+	if !now.Before(start) {
+		if end.After(l.maintenance.until) {
+			l.maintenance.until = end
+			l.maintenance.reason = w.Reason
+			rs = append(rs, l.maintenance.response())
+		}
+		if l.ClearAlert(AlertKeyMaintenance) {
+			rs = append(rs, AlertClearedResponse{Key: AlertKeyMaintenance})
+		}
+		return rs, l.maintenance.until
+	}
+
+	next := start
+	if warnAt := start.Add(-l.maintenanceWarning); 0 < l.maintenanceWarning && !l.maintenance.active() {
+		if now.Before(warnAt) {
+			next = warnAt
+		} else if r, ok := l.RaiseAlert(AlertKeyMaintenance, AlertWarning, maintenanceWarning(start, end, w.Reason), now); ok {
+			rs = append(rs, r)
+		}
+	}
+	if l.maintenance.active() && l.maintenance.until.Before(next) {
+		next = l.maintenance.until
+	}
+	return rs, next
+}
+
+// nextMaintenanceWindow gets the start and end of the earliest of l's windows to come round that ends after now, and
+// hasn't been ended early, along with the window itself.
+func (l *List) nextMaintenanceWindow(now time.Time) (start, end time.Time, w MaintenanceWindow, ok bool) {
+	after := now
+	if after.Before(l.maintenance.skipUntil) {
+		after = l.maintenance.skipUntil
+	}
+	for _, cw := range l.maintenanceWindows {
+		if s, e, cok := cw.next(after); cok && (!ok || s.Before(start)) {
+			start, end, w, ok = s, e, cw, true
+		}
+	}
+	return
+}
+
+// maintenanceWarning gets the message of the alert warning of maintenance from start to end, for reason.
+func maintenanceWarning(start, end time.Time, reason string) string {
+	msg := fmt.Sprintf("the list goes read-only for maintenance from %s to %s", start.Format("Mon 15:04"), end.Format("Mon 15:04"))
+	if reason != "" {
+		msg += ": " + reason
+	}
+	return msg
+}
+
+// checkMaintainer checks whether the client that made a request with context ctx may start and end maintenance.
+func (l *List) checkMaintainer(ctx context.Context) error {
+	var id *auth.Identity
+	if i, ok := controller.IdentityFrom(ctx); ok {
+		id = &i
+	}
+	return controller.CheckAdmin(id, l.maintenanceAdmins)
+}
+
+// handleMaintenanceRequest handles a maintenance request, with context ctx, for List l.
+func (l *List) handleMaintenanceRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b MaintenanceRequest) error {
+	if err := l.checkMaintainer(ctx); err != nil {
+		return err
+	}
+
+	if b.Duration <= 0 {
+		if !l.maintenance.active() {
+			return nil
+		}
+		// Ending a window early mustn't start it again at the next check.
+		l.maintenance = maintenance{skipUntil: l.maintenance.until}
+		bcastCb(MaintenanceResponse{})
+		return nil
+	}
+
+	l.maintenance.until = l.clock.Now().Add(b.Duration)
+	l.maintenance.reason = b.Reason
+	bcastCb(l.maintenance.response())
+	l.clearAlert(bcastCb, AlertKeyMaintenance)
+	return nil
+}
+
+// maintenanceNextResponse is the reply to a MaintenanceCheckRequest, saying when the list should next be checked.
+type maintenanceNextResponse struct {
+	// at is when the next check is due, or the zero time if none is.
+	at time.Time
+}
+
+// handleMaintenanceCheckRequest handles a maintenance check for List l.
+func (l *List) handleMaintenanceCheckRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b MaintenanceCheckRequest) error {
+	rs, next := l.CheckMaintenance(l.clock.Now())
+	for _, r := range rs {
+		bcastCb(r)
+	}
+	replyCb(maintenanceNextResponse{at: next})
+	return nil
+}
+
+// RunMaintenance sends MaintenanceCheckRequests through client whenever the list says one is due by clk, or
+// maintenance starts or ends, until ctx is cancelled or the Controller hangs up.
+// It hangs up client when it returns.
+func RunMaintenance(ctx context.Context, client *controller.Client, clk clock.Clock) error {
+	// The client receives broadcasts too, and must keep draining them; maintenance started or ended by request may
+	// change when the next check is due.
+	wake := make(chan struct{}, 1)
+	go func() {
+		for r := range client.Rx {
+			if _, ok := r.Body.(MaintenanceResponse); ok {
+				select {
+				case wake <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	// Closing our request channel is how we hang up on the Controller.
+	defer close(client.Tx)
+
+	t := clk.NewTimer(0)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C():
+		case <-wake:
+			if !t.Stop() {
+				<-t.C()
+			}
+		case <-ctx.Done():
+			return nil
+		}
+
+		next, err := checkMaintenance(ctx, client)
+		if errors.Is(err, controller.ErrControllerShutDown) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		wait := maintenanceRecheck
+		if until := next.Sub(clk.Now()); !next.IsZero() && until < wait {
+			wait = until
+		}
+		t.Reset(wait)
+	}
+}
+
+// checkMaintenance sends one MaintenanceCheckRequest through client, returning when the next is due.
+func checkMaintenance(ctx context.Context, client *controller.Client) (time.Time, error) {
+	rbodies, err := client.CallReplies(ctx, MaintenanceCheckRequest{})
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, rbody := range rbodies {
+		if r, ok := rbody.(maintenanceNextResponse); ok {
+			return r.at, nil
+		}
+	}
+	return time.Time{}, nil
+}
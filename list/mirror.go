@@ -0,0 +1,280 @@
+package list
+
+// File mirror.go contains Mirror, a client-side copy of a List rebuilt from its Controller's responses.
+
+import (
+	"context"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// Mirror tracks the public state of a List using only the responses its Controller sends.
+// It lets in-process subsystems follow a list without reaching into the List itself.
+type Mirror struct {
+	// items is the mirrored list contents.
+	items []Item
+	// selection is the mirrored selected index, or -1 if there isn't one.
+	selection int
+	// autoMode is the mirrored autoselect mode.
+	autoMode AutoMode
+	// note is the mirrored list note.
+	note string
+	// version is the mirrored list version.
+	version uint64
+	// blocks maps the IDs of the mirrored blocks to their definitions.
+	blocks map[string]Block
+}
+
+// NewMirror creates an empty Mirror, as if of a fresh List.
+func NewMirror() *Mirror {
+	return &Mirror{selection: -1, autoMode: AutoOff, blocks: make(map[string]Block)}
+}
+
+// Apply updates the Mirror with the response body rbody.
+// It returns whether the selected item changed as a result; bodies the Mirror doesn't understand are ignored.
+// Items moving around the selection don't count as a change.
+func (m *Mirror) Apply(rbody interface{}) (selChanged bool) {
+	_, oldItem := m.Selection()
+
+	switch r := rbody.(type) {
+	case AutoModeResponse:
+		m.autoMode = r.AutoMode
+	case CountResponse:
+		m.items = nil
+		m.selection = -1
+		m.blocks = make(map[string]Block)
+	case FreezeResponse:
+		m.items = append([]Item(nil), r...)
+	case ItemResponse:
+		m.insert(r.Index, r.Item)
+	case ItemRemoveResponse:
+		m.remove(r.Hash)
+	case ItemMoveResponse:
+		m.move(r.Hash, r.Index)
+	case SelectResponse:
+		m.selection = r.Index
+	case ListNoteResponse:
+		m.note = r.Note
+	case ItemNoteResponse:
+		if i := m.itemWithHash(r.Index, r.Hash); i != nil {
+			i.note = r.Note
+		}
+	case ItemCategoryResponse:
+		if i := m.itemWithHash(r.Index, r.Hash); i != nil {
+			i.category = r.Category
+		}
+	case ItemTimingResponse:
+		if i := m.itemWithHash(r.Index, r.Hash); i != nil {
+			i.planned = r.Planned
+			i.duration = r.Duration
+		}
+	case ItemValidityResponse:
+		if i := m.itemWithHash(r.Index, r.Hash); i != nil {
+			i.validFrom = r.From
+			i.validUntil = r.Until
+		}
+	case ItemDisplayResponse:
+		if i := m.itemWithHash(r.Index, r.Hash); i != nil {
+			i.display = r.DisplayHints
+		}
+	case ItemTextResponse:
+		if i := m.itemWithHash(r.Index, r.Hash); i != nil {
+			i.payload = r.Text
+		}
+	case BlockResponse:
+		m.applyBlock(r)
+	case BlockClearedResponse:
+		m.clearBlock(r.ID)
+	case VersionResponse:
+		m.version = r.Version
+	case DiffResponse:
+		// The rest of the diff follows, bringing the items up to this version.
+		m.version = r.To
+	}
+
+	_, newItem := m.Selection()
+	return !sameHash(oldItem, newItem)
+}
+
+// insert mirrors List.Add, placing item at index i.
+func (m *Mirror) insert(i int, item Item) {
+	if i < 0 || len(m.items) < i {
+		return
+	}
+	if i <= m.selection {
+		m.selection++
+	}
+	item.block = ""
+	if 0 < i && i < len(m.items) {
+		item.block = joinedBlock(&m.items[i-1], &m.items[i])
+	}
+	m.items = append(m.items, Item{})
+	copy(m.items[i+1:], m.items[i:])
+	m.items[i] = item
+}
+
+// remove removes the item with hash h, if there is one.
+func (m *Mirror) remove(h string) {
+	i := m.indexOfHash(h)
+	if i == -1 {
+		return
+	}
+	switch {
+	case i == m.selection:
+		m.selection = -1
+	case i < m.selection:
+		m.selection--
+	}
+	id := m.items[i].block
+	m.items = append(m.items[:i], m.items[i+1:]...)
+	if _, count := blockRange(m.items, id); id != "" && count == 0 {
+		delete(m.blocks, id)
+	}
+}
+
+// applyBlock makes the mirrored items in the range r announces, and no others, the block r.ID.
+func (m *Mirror) applyBlock(r BlockResponse) {
+	if r.Index < 0 || len(m.items) < r.Index+r.Count {
+		return
+	}
+	for i := range m.items {
+		switch {
+		case r.Index <= i && i < r.Index+r.Count:
+			m.items[i].block = r.ID
+		case m.items[i].block == r.ID:
+			m.items[i].block = ""
+		}
+	}
+	m.blocks[r.ID] = Block{ID: r.ID, Title: r.Title, Collapsed: r.Collapsed}
+}
+
+// clearBlock forgets the mirrored block id, leaving its items where they are.
+func (m *Mirror) clearBlock(id string) {
+	for i := range m.items {
+		if m.items[i].block == id {
+			m.items[i].block = ""
+		}
+	}
+	delete(m.blocks, id)
+}
+
+// move moves the item with hash h, if there is one, to index i, keeping the same item selected.
+func (m *Mirror) move(h string, i int) {
+	j := m.indexOfHash(h)
+	if j == -1 || i < 0 || len(m.items) <= i {
+		return
+	}
+	_, sel := m.Selection()
+	var selHash string
+	if sel != nil {
+		selHash = sel.hash
+	}
+
+	item := m.items[j]
+	m.items = append(m.items[:j], m.items[j+1:]...)
+	m.items = append(m.items[:i], append([]Item{item}, m.items[i:]...)...)
+	if sel != nil {
+		m.selection = m.indexOfHash(selHash)
+	}
+}
+
+// indexOfHash gets the index of the mirrored item with hash h, or -1 if there isn't one.
+func (m *Mirror) indexOfHash(h string) int {
+	for i := range m.items {
+		if m.items[i].hash == h {
+			return i
+		}
+	}
+	return -1
+}
+
+// itemWithHash gets the mirrored item at index i if it has hash h, and nil otherwise.
+func (m *Mirror) itemWithHash(i int, h string) *Item {
+	if i < 0 || len(m.items) <= i || m.items[i].hash != h {
+		return nil
+	}
+	return &m.items[i]
+}
+
+// sameHash checks whether two possibly-nil items have the same hash.
+func sameHash(x, y *Item) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	return x.Hash() == y.Hash()
+}
+
+// AutoMode gets the mirrored autoselect mode.
+func (m *Mirror) AutoMode() AutoMode {
+	return m.autoMode
+}
+
+// Note gets the mirrored list note.
+func (m *Mirror) Note() string {
+	return m.note
+}
+
+// Version gets the mirrored list version, for use in VersionedRequests.
+func (m *Mirror) Version() uint64 {
+	return m.version
+}
+
+// Items gets a copy of the mirrored list contents.
+func (m *Mirror) Items() []Item {
+	return append([]Item(nil), m.items...)
+}
+
+// Blocks gets the mirrored blocks, in the order they start, along with the items they hold.
+func (m *Mirror) Blocks() []BlockResponse {
+	return blockResponses(m.items, m.blocks)
+}
+
+// Checksum gets the checksum of the mirrored items and selection; see list.Checksum.
+func (m *Mirror) Checksum() string {
+	hashes := make([]string, len(m.items))
+	for i := range m.items {
+		hashes[i] = m.items[i].hash
+	}
+	return Checksum(hashes, m.selection)
+}
+
+// Selection gets the mirrored selection as a pair of index and possible item.
+// If the index is -1, there is no selection (or it is out of sync), and the item is nil.
+func (m *Mirror) Selection() (int, *Item) {
+	if m.selection < 0 || len(m.items) <= m.selection {
+		return -1, nil
+	}
+	return m.selection, &m.items[m.selection]
+}
+
+// Follow keeps m in sync with the list behind client until ctx is cancelled or the controller hangs up.
+// It first seeds m with a dump, then applies each broadcast, calling onChange after every update with the broadcast
+// body (nil for the initial dump) and whether the selected item changed.
+// onChange is called on Follow's goroutine, and is the only safe place to read m while Follow is running.
+// It must not send requests to client's Controller and wait for them, as the Controller may be waiting on Follow.
+func Follow(ctx context.Context, client *controller.Client, m *Mirror, onChange func(rbody interface{}, selChanged bool)) error {
+	cb := func(r controller.Response) error {
+		m.Apply(r.Body)
+		return nil
+	}
+	alive, err := client.SendAndProcessReplies(ctx, "", controller.DumpRequest{}, cb)
+	if !alive {
+		return controller.ErrControllerShutDown
+	}
+	if err != nil {
+		return err
+	}
+	onChange(nil, false)
+
+	for {
+		select {
+		case r, ok := <-client.Rx:
+			if !ok {
+				return nil
+			}
+			onChange(r.Body, m.Apply(r.Body))
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package list_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// TestMirror_Apply checks that a Mirror follows a sequence of list responses.
+func TestMirror_Apply(t *testing.T) {
+	m := list.NewMirror()
+
+	m.Apply(list.FreezeResponse{*list.NewTrack("abc", "foo.mp3"), *list.NewTrack("def", "bar.mp3")})
+	if changed := m.Apply(list.SelectResponse{Index: 1, Hash: "def"}); !changed {
+		t.Error("selecting an item didn't report a selection change")
+	}
+
+	// Adding before the selection should move the selection, but not change it.
+	if changed := m.Apply(list.ItemResponse{Index: 0, Item: *list.NewText("xyz", "News")}); changed {
+		t.Error("adding an item before the selection reported a selection change")
+	}
+
+	idx, item := m.Selection()
+	if idx != 2 {
+		t.Errorf("selection index after add: got %d, want 2", idx)
+	}
+	if item == nil || item.Hash() != "def" {
+		t.Errorf("selection item after add: got %v, want def", item)
+	}
+
+	m.Apply(list.AutoModeResponse{AutoMode: list.AutoNext})
+	if got := m.AutoMode(); got != list.AutoNext {
+		t.Errorf("automode: got %v, want %v", got, list.AutoNext)
+	}
+
+	if got := len(m.Items()); got != 3 {
+		t.Errorf("item count: got %d, want 3", got)
+	}
+}
+
+// TestMirror_Checksum checks that a Mirror of a list has the list's checksum, and that the checksum changes with the
+// items and selection.
+func TestMirror_Checksum(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctl, client := controller.NewController(list.New())
+	go ctl.Run(ctx)
+	// The Controller waits for every client to take its broadcasts, including this one.
+	go func() {
+		for range client.Rx {
+		}
+	}()
+
+	for i, it := range []*list.Item{list.NewTrack("a", "a.mp3"), list.NewText("t", "text")} {
+		if err := list.AddItem(ctx, client, i, *it); err != nil {
+			t.Fatalf("adding %s: %v", it.Hash(), err)
+		}
+	}
+
+	check := func(name string) string {
+		t.Helper()
+		r, err := list.GetChecksum(ctx, client)
+		if err != nil {
+			t.Fatalf("%s: couldn't get checksum: %v", name, err)
+		}
+		m, err := list.DumpList(ctx, client)
+		if err != nil {
+			t.Fatalf("%s: couldn't dump list: %v", name, err)
+		}
+		if got := m.Checksum(); got != r.Checksum {
+			t.Errorf("%s: mirror has checksum %s, list has %s", name, got, r.Checksum)
+		}
+		if r.Version != m.Version() {
+			t.Errorf("%s: checksum is of version %d, mirror is at %d", name, r.Version, m.Version())
+		}
+		return r.Checksum
+	}
+
+	before := check("unselected")
+	if err := list.Select(ctx, client, 0, "a"); err != nil {
+		t.Fatalf("selecting: %v", err)
+	}
+	if after := check("selected"); after == before {
+		t.Error("selecting didn't change the checksum")
+	}
+
+	if list.Checksum([]string{"ab", "c"}, -1) == list.Checksum([]string{"a", "bc"}, -1) {
+		t.Error("lists with different hashes have the same checksum")
+	}
+}
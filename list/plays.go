@@ -0,0 +1,143 @@
+package list
+
+// File plays.go contains the List logic for counting how often each item has been selected, and remembering when.
+//
+// Counts are kept by hash, so they survive an item leaving and rejoining the list, and shuffle cycles.
+// Only the most recent selections are remembered in detail; for a permanent record, a List can append every
+// selection a client makes to a PlayLog (see package 'history').
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// playHistory is the number of selections a List remembers in detail.
+const playHistory = 256
+
+// PlayRecord is a record of an item being selected.
+type PlayRecord struct {
+	// At is when the item was selected.
+	At time.Time `json:"at"`
+	// Hash is the hash of the item.
+	Hash string `json:"hash"`
+	// Payload is the payload the item had when selected.
+	Payload string `json:"payload"`
+}
+
+// PlayLog is the interface of permanent, append-only records of selections.
+type PlayLog interface {
+	// Append adds r to the end of the log.
+	Append(r PlayRecord) error
+	// Query gets the records from time from (inclusive) to time to (exclusive), oldest first.
+	// A zero time leaves that end of the range open.
+	Query(from, to time.Time) ([]PlayRecord, error)
+}
+
+// ErrNoPlayLog is the error returned when querying the play log of a List that doesn't have one.
+var ErrNoPlayLog = errors.New("this list keeps no play log")
+
+// recordPlay counts a selection of item, at time now.
+func (l *List) recordPlay(item *Item, now time.Time) {
+	l.plays[item.hash]++
+
+	if playHistory <= len(l.played) {
+		l.played = append(l.played[:0], l.played[1:]...)
+	}
+	l.played = append(l.played, PlayRecord{At: now, Hash: item.hash, Payload: item.payload})
+}
+
+// SetPlayLog sets the log to which l appends every selection a client makes; nil turns logging off.
+func (l *List) SetPlayLog(pl PlayLog) {
+	l.playLog = pl
+}
+
+// logPlay appends l's latest selection to its play log, if it has one, raising or clearing the play log alert
+// through bcastCb.
+func (l *List) logPlay(bcastCb controller.ResponseCb) error {
+	if l.playLog == nil || len(l.played) == 0 {
+		return nil
+	}
+	if err := l.playLog.Append(l.played[len(l.played)-1]); err != nil {
+		err = fmt.Errorf("selected, but couldn't log the play: %w", err)
+		l.raiseAlert(bcastCb, AlertKeyPlayLog, AlertError, err.Error())
+		return err
+	}
+	l.clearAlert(bcastCb, AlertKeyPlayLog)
+	return nil
+}
+
+// PlayCount gets the number of times the item with hash hash has been selected.
+func (l *List) PlayCount(hash string) int {
+	return l.plays[hash]
+}
+
+// PlayCounts gets a copy of the play counts of every hash l has selected.
+func (l *List) PlayCounts() map[string]int {
+	counts := make(map[string]int, len(l.plays))
+	for h, n := range l.plays {
+		counts[h] = n
+	}
+	return counts
+}
+
+// SetPlayCounts replaces l's play counts with a copy of counts, for example those saved by a previous run.
+func (l *List) SetPlayCounts(counts map[string]int) {
+	l.plays = make(map[string]int, len(counts))
+	for h, n := range counts {
+		l.plays[h] = n
+	}
+}
+
+// PlayHistory gets up to the count most recent selections, oldest first; a count of 0 or less gets all l remembers.
+func (l *List) PlayHistory(count int) []PlayRecord {
+	rs := l.played
+	if 0 < count && count < len(rs) {
+		rs = rs[len(rs)-count:]
+	}
+	return append([]PlayRecord(nil), rs...)
+}
+
+// playsResponses gets a response for the play count of every item in l that has been played.
+func (l *List) playsResponses() []ItemPlaysResponse {
+	var rs []ItemPlaysResponse
+	i := 0
+	for e := l.list.Front(); e != nil; e, i = e.Next(), i+1 {
+		h := e.Value.(*Item).hash
+		if n := l.plays[h]; n != 0 {
+			rs = append(rs, ItemPlaysResponse{Index: i, Hash: h, Count: n})
+		}
+	}
+	return rs
+}
+
+// handlePlayHistoryRequest handles a play history request for List l.
+func (l *List) handlePlayHistoryRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b PlayHistoryRequest) error {
+	return replyEach(ctx, replyCb, "sending plays", bifrost.ApplyQuery(b.Options, playedResponses(l.PlayHistory(b.Count))))
+}
+
+// handlePlayLogRequest handles a play log query for List l.
+func (l *List) handlePlayLogRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b PlayLogRequest) error {
+	if l.playLog == nil {
+		return ErrNoPlayLog
+	}
+
+	rs, err := l.playLog.Query(b.From, b.To)
+	if err != nil {
+		return err
+	}
+	return replyEach(ctx, replyCb, "exporting history", bifrost.ApplyQuery(b.Options, playedResponses(rs)))
+}
+
+// playedResponses converts play records into responses.
+func playedResponses(rs []PlayRecord) []PlayedResponse {
+	prs := make([]PlayedResponse, len(rs))
+	for i, r := range rs {
+		prs[i] = PlayedResponse(r)
+	}
+	return prs
+}
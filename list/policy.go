@@ -0,0 +1,152 @@
+package list
+
+// File policy.go contains autoselect policies, which decide what the list selects when its selection ends.
+//
+// The automode names the policy in force.
+// yaps has four built in: 'off', which keeps the selection; 'drop', which clears it; 'next', which moves down the list;
+// and 'shuffle', which picks tracks at random without repeating them until it runs out.
+// Stations with house rotation rules, such as only playing certain categories at certain times of day, can implement
+// Policy and call RegisterPolicy before starting any lists; 'auto <name>' then selects the policy like any other.
+//
+// Handovers are only predicted under 'next' and 'shuffle'; under other policies, 'end' moves on by the policy at once.
+
+import (
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Policy is the interface of autoselect policies.
+type Policy interface {
+	// Next chooses the next selection given the state s, as its index and hash in s.Items; -1 and "" clear the
+	// selection.
+	// Choosing anything that isn't an item in s.Items clears the selection.
+	Next(s *PolicyState) (int, string)
+}
+
+// PolicyFunc adapts a function into a Policy.
+type PolicyFunc func(s *PolicyState) (int, string)
+
+// Next chooses the next selection by calling f.
+func (f PolicyFunc) Next(s *PolicyState) (int, string) {
+	return f(s)
+}
+
+// PolicyState is what a Policy sees of a list when its selection ends.
+type PolicyState struct {
+	// Items holds copies of the list's items, in order.
+	Items []Item
+	// Selection is the index of the selection that has ended.
+	Selection int
+	// Now is the time by the list's clock.
+	Now time.Time
+	// Rand is the list's random number generator.
+	Rand *rand.Rand
+	// Used is the set of hashes the policy has spent, which the list keeps between selections.
+	// Policies may add and delete hashes as they like; the list forgets them all when the automode changes, and forgets
+	// each hash when its item goes.
+	Used map[string]struct{}
+}
+
+// namedPolicy is a Policy in the registry, along with the name by which 'auto' selects it.
+type namedPolicy struct {
+	name   string
+	policy Policy
+}
+
+var (
+	// policiesMu guards policies.
+	policiesMu sync.RWMutex
+	// policies holds the known policies, indexed by AutoMode.
+	policies = []namedPolicy{
+		AutoOff:     {name: "off", policy: PolicyFunc(offPolicy)},
+		AutoDrop:    {name: "drop", policy: PolicyFunc(dropPolicy)},
+		AutoNext:    {name: "next", policy: PolicyFunc(nextPolicy)},
+		AutoShuffle: {name: "shuffle", policy: PolicyFunc(shufflePolicy)},
+	}
+)
+
+// RegisterPolicy makes p available as the automode called name, returning that automode.
+// It panics if the name is already taken or isn't a single Bifrost word, as that is a programming error.
+func RegisterPolicy(name string, p Policy) AutoMode {
+	if name == "" || strings.ContainsAny(name, " \t\r\n'\"\\") {
+		panic("list: invalid policy name " + name)
+	}
+
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	for _, np := range policies {
+		if np.name == name {
+			panic("list: policy registered twice for name " + name)
+		}
+	}
+	policies = append(policies, namedPolicy{name: name, policy: p})
+	return AutoMode(len(policies) - 1)
+}
+
+// Policies gets the names of the known policies, built-in ones first, then in order of registration.
+func Policies() []string {
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+	names := make([]string, len(policies))
+	for i, np := range policies {
+		names[i] = np.name
+	}
+	return names
+}
+
+// policyOf gets the policy that the automode a names, and whether there is one.
+func policyOf(a AutoMode) (namedPolicy, bool) {
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+	if a < 0 || len(policies) <= int(a) {
+		return namedPolicy{}, false
+	}
+	return policies[a], true
+}
+
+// offPolicy keeps the selection.
+func offPolicy(s *PolicyState) (int, string) {
+	return s.Selection, s.Items[s.Selection].hash
+}
+
+// dropPolicy clears the selection.
+func dropPolicy(*PolicyState) (int, string) {
+	return -1, ""
+}
+
+// nextPolicy selects the first item after the selection that can go to air now.
+func nextPolicy(s *PolicyState) (int, string) {
+	for i := s.Selection + 1; i < len(s.Items); i++ {
+		if s.Items[i].ValidAt(s.Now) == nil {
+			return i, s.Items[i].hash
+		}
+	}
+	return -1, ""
+}
+
+// shufflePolicy selects a random item that can go to air now and that the shuffle hasn't used.
+// Once it has used every such item, it clears the selection and starts afresh.
+func shufflePolicy(s *PolicyState) (int, string) {
+	/* TODO(CaptainHayashi): this is slow, but guaranteed to terminate.
+	   Randomly choosing a hash then checking it for previous play would be faster
+	   in some cases, but could technically never terminate. */
+	var unpicked []int
+	for i := range s.Items {
+		if _, in := s.Used[s.Items[i].hash]; !in && s.Items[i].ValidAt(s.Now) == nil {
+			unpicked = append(unpicked, i)
+		}
+	}
+
+	if len(unpicked) == 0 {
+		for h := range s.Used {
+			delete(s.Used, h)
+		}
+		return -1, ""
+	}
+
+	i := unpicked[s.Rand.Intn(len(unpicked))]
+	s.Used[s.Items[i].hash] = struct{}{}
+	return i, s.Items[i].hash
+}
@@ -0,0 +1,74 @@
+package list_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/clock"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// daypart is a house rotation policy that, before noon, only moves on to tracks in the 'morning' category.
+var daypart = list.RegisterPolicy("daypart", list.PolicyFunc(func(s *list.PolicyState) (int, string) {
+	for i := s.Selection + 1; i < len(s.Items); i++ {
+		if item := &s.Items[i]; 12 <= s.Now.Hour() || item.Category() == "morning" {
+			return i, item.Hash()
+		}
+	}
+	return -1, ""
+}))
+
+// bad is a policy that always chooses an item that doesn't exist.
+var bad = list.RegisterPolicy("bad", list.PolicyFunc(func(s *list.PolicyState) (int, string) {
+	return s.Selection, "nope"
+}))
+
+// Test_RegisterPolicy checks that a list moves on by a registered policy selected by name.
+func Test_RegisterPolicy(t *testing.T) {
+	if a, err := list.ParseAutoMode("daypart"); err != nil || a != daypart {
+		t.Fatalf("parsing daypart: got %v, %v; want %v", a, err, daypart)
+	}
+
+	clk := clock.NewMock(time.Date(2020, 1, 1, 9, 0, 0, 0, time.UTC))
+	l := list.New()
+	l.SetClock(clk)
+	l.DefineCategories([]list.Category{{Name: "morning"}})
+	for i, h := range []string{"a", "b", "c", "d"} {
+		if err := l.Add(list.NewTrack(h, h+".mp3"), i); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+	if _, err := l.SetItemCategory(2, "c", "morning"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := l.Select(0, "a"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	l.SetAutoMode(daypart)
+
+	if i, _ := l.Next(); i != 2 {
+		t.Errorf("next in the morning: got %d, want 2", i)
+	}
+	clk.Advance(4 * time.Hour)
+	if i, _ := l.Next(); i != 3 {
+		t.Errorf("next in the afternoon: got %d, want 3", i)
+	}
+	if st := l.State(); st.Check() != nil {
+		t.Errorf("state under a registered policy: unexpected problems: %v", st.Check())
+	}
+}
+
+// Test_RegisterPolicy_badChoice checks that a policy choosing something that isn't an item clears the selection.
+func Test_RegisterPolicy_badChoice(t *testing.T) {
+	l := list.New()
+	if err := l.Add(list.NewTrack("a", "a.mp3"), 0); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if _, err := l.Select(0, "a"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	l.SetAutoMode(bad)
+	if i, changed := l.Next(); i != -1 || !changed {
+		t.Errorf("next: got %d, %v; want -1, true", i, changed)
+	}
+}
@@ -0,0 +1,44 @@
+package list
+
+// File query.go contains the fields by which query options (see bifrost.QueryOptions) sort and filter list results.
+
+import (
+	"strconv"
+	"time"
+)
+
+// QueryField gets the field called name of the item r announces, for sorting and filtering.
+// The fields are index, hash, type, payload, note, and category.
+func (r ItemResponse) QueryField(name string) string {
+	switch name {
+	case "index":
+		return strconv.Itoa(r.Index)
+	case "hash":
+		return r.Item.Hash()
+	case "type":
+		return r.Item.Type().String()
+	case "payload":
+		return r.Item.Payload()
+	case "note":
+		return r.Item.Note()
+	case "category":
+		return r.Item.Category()
+	default:
+		return ""
+	}
+}
+
+// QueryField gets the field called name of the selection r reports, for sorting and filtering.
+// The fields are at, hash, and payload.
+func (r PlayedResponse) QueryField(name string) string {
+	switch name {
+	case "at":
+		return r.At.UTC().Format(time.RFC3339)
+	case "hash":
+		return r.Hash
+	case "payload":
+		return r.Payload
+	default:
+		return ""
+	}
+}
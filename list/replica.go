@@ -0,0 +1,123 @@
+package list
+
+// File replica.go contains the List logic for acting as a read-only replica of another list.
+
+import (
+	"container/list"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
+// CodeReplica is the error code of ErrReplica.
+const CodeReplica = "replica"
+
+// ErrReplica is the error returned when a client tries to change a replica list directly.
+var ErrReplica = bifrost.WithCode(CodeReplica, errors.New("list is a read-only replica; promote it first"))
+
+// SetReplica marks whether l is a read-only replica of another list.
+// Replicas reject changes from clients, only accepting ReplicateRequests, until promoted.
+func (l *List) SetReplica(replica bool) {
+	l.replica = replica
+}
+
+// IsReplica gets whether l is a read-only replica of another list.
+func (l *List) IsReplica() bool {
+	return l.replica
+}
+
+// mutates checks whether the request body rbody would change the list if handled.
+func mutates(rbody interface{}) bool {
+	switch b := rbody.(type) {
+	case VersionedRequest:
+		return mutates(b.Request)
+	case DryRunRequest:
+		return false
+	case GetItemCategoryRequest, RangeDumpRequest, SearchRequest, CheckHashesRequest, DuplicateRequest, PlayHistoryRequest, PlayLogRequest, DiffRequest, PromoteRequest, ReplicateRequest,
+		RaiseAlertRequest, ClearAlertRequest, AlertsRequest, AddScratchItemRequest, ScratchDumpRequest, DropScratchRequest,
+		MaintenanceRequest, MaintenanceCheckRequest, UpcomingRequest, ChecksumRequest, StateRequest:
+		return false
+	default:
+		return true
+	}
+}
+
+// reset empties l, as if it had just been created.
+func (l *List) reset() {
+	l.list = list.New()
+	l.selection = -1
+	l.clearUsedHashes()
+	l.expired = make(map[string]struct{})
+	l.blocks = make(map[string]Block)
+}
+
+// applyReplicated applies the response body rbody, received from the primary, to l.
+// It returns whether the response should be rebroadcast to l's own clients.
+func (l *List) applyReplicated(rbody interface{}) (bool, error) {
+	switch r := rbody.(type) {
+	case CountResponse:
+		l.reset()
+		return true, nil
+	case ItemResponse:
+		return true, l.Add(&r.Item, r.Index)
+	case SelectResponse:
+		return l.applyReplicatedSelect(r)
+	case AutoModeResponse:
+		return l.SetAutoMode(r.AutoMode), nil
+	case ListNoteResponse:
+		return l.SetNote(r.Note), nil
+	case ItemNoteResponse:
+		return l.SetItemNote(r.Index, r.Hash, r.Note)
+	case ItemCategoryResponse:
+		// The replica checks categories against its own definitions, so these must match the primary's.
+		return l.SetItemCategory(r.Index, r.Hash, r.Category)
+	case ItemTimingResponse:
+		return l.SetItemTiming(r.Index, r.Hash, r.Planned, r.Duration)
+	case ItemValidityResponse:
+		return l.SetItemValidity(r.Index, r.Hash, r.From, r.Until)
+	case ItemDisplayResponse:
+		return l.SetItemDisplay(r.Index, r.Hash, r.DisplayHints)
+	case ItemTextResponse:
+		return l.SetItemText(r.Index, r.Hash, r.Text)
+	case ItemPlaysResponse:
+		// The primary's count is authoritative, even though the replica counts replicated selections itself.
+		l.plays[r.Hash] = r.Count
+		return true, nil
+	case ItemExpiredResponse:
+		// Only the primary checks for expiry, but the replica's clients should still hear about it.
+		return true, nil
+	case ItemMoveResponse:
+		return true, l.moveItem(r.Hash, r.Index)
+	case BlockResponse:
+		return true, l.applyBlock(r)
+	case BlockClearedResponse:
+		l.clearBlock(r.ID)
+		return true, nil
+	case ItemRemoveResponse:
+		if i, e := l.elementWithHash(r.Hash); e != nil {
+			l.removeElement(i, e)
+			return true, nil
+		}
+		return false, fmt.Errorf("can't remove missing item %s", r.Hash)
+	case CategoriesResponse, DriftResponse, VersionResponse, AlertResponse, AlertClearedResponse, MaintenanceResponse,
+		EmergencyResponse, HandoverResponse, HandoverClearedResponse:
+		// Categories come from the replica's config; drift, versions, and alerts are calculated locally; and the
+		// replica is read-only anyway, so has no player to hand over to.
+		return false, nil
+	default:
+		return false, fmt.Errorf("can't replicate %v", r)
+	}
+}
+
+// applyReplicatedSelect applies a replicated selection r, which, unlike a client selection, may clear the selection.
+func (l *List) applyReplicatedSelect(r SelectResponse) (bool, error) {
+	if r.Index == -1 {
+		changed := l.selection != -1
+		l.selection = -1
+		return changed, nil
+	}
+	// The primary has already checked the item's validity, possibly by a slightly different clock.
+	return l.selectAt(r.Index, r.Hash, time.Time{})
+}
@@ -11,6 +11,12 @@ package list
 // - a parser from messages in 'bifrost.go';
 // - an emitter to messages in 'bifrost.go'.
 
+import (
+	"time"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+)
+
 // SetAutoModeRequest requests an automode change.
 type SetAutoModeRequest struct {
 	// AutoMode represents the new AutoMode to use.
@@ -33,3 +39,348 @@ type AddItemRequest struct {
 	// Item is the item itself, including its required hash.
 	Item Item
 }
+
+// SetListNoteRequest requests a change to the note attached to the whole list.
+type SetListNoteRequest struct {
+	// Note is the new note; "" removes the note.
+	Note string
+}
+
+// SetItemNoteRequest requests a change to the note attached to a single item.
+type SetItemNoteRequest struct {
+	// Index is the index of the item to annotate.
+	Index int
+	// Hash is the hash of the item to annotate.
+	// It exists to prevent races.
+	Hash string
+	// Note is the new note; "" removes the note.
+	Note string
+}
+
+// SetItemCategoryRequest requests a change to the category of a single item.
+type SetItemCategoryRequest struct {
+	// Index is the index of the item to categorise.
+	Index int
+	// Hash is the hash of the item to categorise.
+	// It exists to prevent races.
+	Hash string
+	// Category is the name of the new category; "" removes the category.
+	Category string
+}
+
+// GetItemCategoryRequest requests the category of a single item.
+// It will result in an ItemCategoryResponse reply.
+type GetItemCategoryRequest struct {
+	// Index is the index of the item.
+	Index int
+	// Hash is the hash of the item.
+	Hash string
+}
+
+// SetItemTimingRequest requests a change to the planned start time and duration of a single item.
+type SetItemTimingRequest struct {
+	// Index is the index of the item.
+	Index int
+	// Hash is the hash of the item.
+	// It exists to prevent races.
+	Hash string
+	// Planned is the planned start time, or the zero time for none.
+	Planned time.Time
+	// Duration is the expected duration, or 0 if unknown.
+	Duration time.Duration
+}
+
+// SetItemValidityRequest requests a change to the window of time in which an item may go to air.
+type SetItemValidityRequest struct {
+	// Index is the index of the item.
+	Index int
+	// Hash is the hash of the item.
+	// It exists to prevent races.
+	Hash string
+	// From is the time before which the item is embargoed, or the zero time for no embargo.
+	From time.Time
+	// Until is the time after which the item has expired, or the zero time for no expiry.
+	Until time.Time
+}
+
+// SetItemDisplayRequest requests a change to the display hints of a single text item.
+type SetItemDisplayRequest struct {
+	// Index is the index of the item.
+	Index int
+	// Hash is the hash of the item.
+	// It exists to prevent races.
+	Hash string
+	// DisplayHints holds the new hints.
+	DisplayHints
+}
+
+// NewBlockRequest requests that adjacent items be made into a new block.
+type NewBlockRequest struct {
+	// ID is the ID of the new block.
+	ID string
+	// Index is the index of the block's first item.
+	Index int
+	// Count is the number of items in the block.
+	Count int
+	// Title is the block's title.
+	Title string
+}
+
+// SetBlockRequest requests a change to the title of a block, and whether it is collapsed.
+type SetBlockRequest struct {
+	// ID is the ID of the block.
+	ID string
+	// Collapsed is whether displays should show the block as one line.
+	Collapsed bool
+	// Title is the block's new title.
+	Title string
+}
+
+// MoveBlockRequest requests that a block's items be moved, as one.
+type MoveBlockRequest struct {
+	// ID is the ID of the block.
+	ID string
+	// Index is the index of the block's first item once moved, counting items as if the block weren't in the list.
+	Index int
+}
+
+// RemoveBlockRequest requests that a block be removed along with its items.
+type RemoveBlockRequest struct {
+	// ID is the ID of the block.
+	ID string
+}
+
+// DissolveBlockRequest requests that a block be removed, leaving its items in the list.
+type DissolveBlockRequest struct {
+	// ID is the ID of the block.
+	ID string
+}
+
+// SetItemTextRequest requests a change to the text of a single text item, in place.
+type SetItemTextRequest struct {
+	// Index is the index of the item.
+	Index int
+	// Hash is the hash of the item.
+	// It exists to prevent races.
+	Hash string
+	// Text is the new text.
+	Text string
+}
+
+// ExpireRequest asks the list to apply its expiry policy to any newly expired items.
+// It has no Bifrost equivalent: yaps sends it in-process, through RunExpiry.
+type ExpireRequest struct{}
+
+// RaiseAlertRequest raises an alert, broadcasting it with an AlertResponse unless deduplicated or rate-limited.
+// It has no Bifrost equivalent: yaps sends it in-process, through an Alerter.
+type RaiseAlertRequest struct {
+	// Key names the problem.
+	Key string
+	// Severity is how bad the problem is.
+	Severity AlertSeverity
+	// Message describes the problem.
+	Message string
+}
+
+// ClearAlertRequest clears an alert, broadcasting an AlertClearedResponse if its raising was broadcast.
+// It has no Bifrost equivalent: yaps sends it in-process, through an Alerter.
+type ClearAlertRequest struct {
+	// Key names the problem.
+	Key string
+}
+
+// AlertsRequest asks for the active alerts.
+// It will result in an AlertResponse reply for each, in key order.
+type AlertsRequest struct{}
+
+// PlayHistoryRequest asks for the most recent selections the list remembers.
+// It will result in a PlayedResponse reply for each, oldest first.
+type PlayHistoryRequest struct {
+	// Count is the maximum number of selections to return; 0 means all of them.
+	Count int
+	// Options pages, sorts, and filters the selections.
+	Options bifrost.QueryOptions
+}
+
+// ChecksumRequest asks for the checksum of the list's items and selection.
+// It will result in a ChecksumResponse reply.
+type ChecksumRequest struct{}
+
+// UpcomingRequest asks for the tracks likely to be selected next.
+// It will result in an ItemResponse reply for each, most likely first.
+type UpcomingRequest struct {
+	// Count is the maximum number of tracks to return; 0 means 1.
+	Count int
+}
+
+// PlayLogRequest asks for the selections in the list's play log within a range of time.
+// It will result in a PlayedResponse reply for each, oldest first.
+type PlayLogRequest struct {
+	// From is the start of the range, inclusive; the zero time leaves it open.
+	From time.Time
+	// To is the end of the range, exclusive; the zero time leaves it open.
+	To time.Time
+	// Options pages, sorts, and filters the selections.
+	Options bifrost.QueryOptions
+}
+
+// RangeDumpRequest requests a dump of part of the list.
+// It will result in an ItemResponse reply for each matching item.
+type RangeDumpRequest struct {
+	// Start is the index of the first item to dump.
+	Start int
+	// Count is the maximum number of items, from Start, to consider.
+	Count int
+	// Category, if non-empty, restricts the dump to items with that category.
+	Category string
+	// Options pages, sorts, and filters the items in the range.
+	Options bifrost.QueryOptions
+}
+
+// PromoteRequest requests that a read-only replica list become a primary, accepting changes from its own clients.
+type PromoteRequest struct{}
+
+// ReplicateRequest asks a replica list to apply a response body received from its primary.
+// It has no Bifrost equivalent: it is sent in-process by the replicator.
+type ReplicateRequest struct {
+	// Response is the body of the primary's response.
+	Response interface{}
+}
+
+// DryRunRequest wraps a request that should be checked, but not carried out.
+// It will result in the wrapped request's replies, then the broadcasts it would have caused as replies, or its error.
+type DryRunRequest struct {
+	// Request is the body of the wrapped request.
+	Request interface{}
+}
+
+// VersionedRequest wraps a request that should only go ahead if the list is still at a given version.
+// Clients send the version from the list's last VersionResponse, so their change can't clobber one they haven't seen.
+type VersionedRequest struct {
+	// Version is the version the client expects the list to be at.
+	Version uint64
+	// Request is the body of the wrapped request.
+	Request interface{}
+}
+
+// SearchRequest asks for the items matching a query.
+type SearchRequest struct {
+	// Query is the text to look for, ignoring case.
+	Query string
+	// Field is the SearchField to look in; empty means SearchAny.
+	Field string
+	// Options pages, sorts, and filters the matches.
+	Options bifrost.QueryOptions
+}
+
+// CheckHashesRequest asks for the index and state of each of a batch of hashes.
+// It will result in a HashStateResponse reply for each hash, in the order given.
+type CheckHashesRequest struct {
+	// Hashes is the batch of hashes to check.
+	Hashes []string
+}
+
+// DuplicateRequest asks for a report of the tracks that duplicate others.
+// It will result in a DuplicateResponse reply for each duplicate.
+type DuplicateRequest struct{}
+
+// DiffRequest requests the changes needed to bring a copy of the list at an older version up to date.
+// It will result in a DiffResponse reply, followed by a reply for each change.
+type DiffRequest struct {
+	// Since is the version of the client's copy.
+	Since uint64
+}
+
+// AddScratchItemRequest requests that the given item be put in the requesting session's scratchpad, in front of the
+// given index.
+// It will result in a ScratchItemResponse reply.
+type AddScratchItemRequest struct {
+	// Index is the index in the scratchpad at which to put the item.
+	Index int
+	// Item is the item itself, including its required hash.
+	Item Item
+}
+
+// ScratchDumpRequest asks for the requesting session's scratchpad.
+// It will result in a ScratchItemResponse reply for each item.
+type ScratchDumpRequest struct{}
+
+// DropScratchRequest requests that the requesting session's scratchpad be thrown away.
+type DropScratchRequest struct{}
+
+// PromoteScratchRequest requests that the requesting session's scratchpad be spliced into the list, in one change,
+// in front of the given index.
+// The scratchpad is emptied if, and only if, the splice succeeds.
+type PromoteScratchRequest struct {
+	// Index is the index in the list at which to splice the scratchpad.
+	Index int
+}
+
+// CloneRequest requests that a copy of the named template be spliced into the list, in one change, in front of the
+// given index.
+// Every copied item gets a fresh hash.
+type CloneRequest struct {
+	// Index is the index in the list at which to splice the template.
+	Index int
+	// Template is the name of the template.
+	Template string
+}
+
+// SeparatorRequest requests that a copy of the named separator be put into the list in front of the given index.
+// The copy gets a fresh hash.
+type SeparatorRequest struct {
+	// Index is the index in the list at which to put the separator.
+	Index int
+	// Name is the name of the separator.
+	Name string
+}
+
+// MaintenanceRequest requests that the list go read-only for maintenance, from now until Duration has passed, or,
+// with a zero Duration, that any maintenance end now.
+// Only admins may make it; see SetMaintenanceAdmins.
+type MaintenanceRequest struct {
+	// Duration is how long the maintenance lasts, or 0 to end it.
+	Duration time.Duration
+	// Reason is why the list is going read-only, for clients to show.
+	Reason string
+}
+
+// MaintenanceCheckRequest asks the list to start, warn of, or end maintenance windows as the time has come to.
+// It has no Bifrost equivalent: yaps sends it in-process, through RunMaintenance.
+type MaintenanceCheckRequest struct{}
+
+// StateRequest asks the list for a copy of its State.
+// It has no Bifrost equivalent: yaps sends it in-process, through GetState.
+type StateRequest struct{}
+
+// EmergencyRequest asks the list to put its fail-safe track on air at once, and lock itself until released.
+type EmergencyRequest struct {
+	// Reason is what the emergency is, for clients to show.
+	Reason string
+}
+
+// ReleaseRequest asks the list to end any emergency, unlocking it.
+// Only admins may make it; see SetMaintenanceAdmins.
+type ReleaseRequest struct{}
+
+// HandoverReadyRequest tells the list that the player is ready to go straight on to the item being handed over to.
+type HandoverReadyRequest struct {
+	// Index is the index of the item.
+	Index int
+	// Hash is the hash of the item.
+	// It exists to prevent races.
+	Hash string
+}
+
+// EndRequest tells the list that the selected item is ending, so that the list should move on from it.
+type EndRequest struct {
+	// Index is the index of the item.
+	Index int
+	// Hash is the hash of the item.
+	// It exists to prevent races.
+	Hash string
+}
+
+// HandoverCheckRequest asks the list to give up waiting on a handover the player hasn't confirmed in time.
+// It has no Bifrost equivalent: yaps sends it in-process, through RunHandover.
+type HandoverCheckRequest struct{}
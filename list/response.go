@@ -9,7 +9,10 @@ package list
 // When adding new responses, make sure to add:
 // - controller logic in 'controller.go';
 // - a parser from messages in 'bifrost.go';
-// - an emitter to messages in 'bifrost.go'.
+// - an emitter to messages in 'bifrost.go';
+// - if it doesn't marshal usefully to JSON as it is, a registration in 'json.go'.
+
+import "time"
 
 // AutoModeResponse announces a change in AutoMode.
 type AutoModeResponse struct {
@@ -25,6 +28,23 @@ type SelectResponse struct {
 	Hash string
 }
 
+// CountResponse announces the number of items in a list snapshot about to follow.
+// Receivers should discard their previous view of the list's items and selection.
+// Emitters send a FreezeResponse as a CountResponse followed by an ItemResponse per item.
+type CountResponse struct {
+	// Count is the number of items in the snapshot.
+	Count int
+}
+
+// ItemsChangedResponse announces that some of a range of items have changed, in place of the separate broadcasts.
+// Receivers should fetch the range again, for example with a RangeDumpRequest.
+type ItemsChangedResponse struct {
+	// Start is the index of the first item in the range.
+	Start int
+	// Count is the number of items in the range.
+	Count int
+}
+
 // FreezeResponse announces a snapshot of the entire list.
 type FreezeResponse []Item
 
@@ -35,3 +55,239 @@ type ItemResponse struct {
 	// Item is the item itself.
 	Item Item
 }
+
+// ListNoteResponse announces the note attached to the whole list.
+type ListNoteResponse struct {
+	// Note is the list's note, or "" if there isn't one.
+	Note string
+}
+
+// ItemNoteResponse announces the note attached to a single item.
+type ItemNoteResponse struct {
+	// Index is the index of the item in the list.
+	Index int
+	// Hash is the item's hash.
+	Hash string
+	// Note is the item's note, or "" if there isn't one.
+	Note string
+}
+
+// ItemCategoryResponse announces the category of a single item.
+type ItemCategoryResponse struct {
+	// Index is the index of the item in the list.
+	Index int
+	// Hash is the item's hash.
+	Hash string
+	// Category is the item's category, or "" if it is uncategorised.
+	Category string
+}
+
+// ItemRemoveResponse announces that an item has left the list.
+type ItemRemoveResponse struct {
+	// Hash is the item's hash.
+	Hash string
+}
+
+// ItemMoveResponse announces that an item has moved within the list.
+type ItemMoveResponse struct {
+	// Hash is the item's hash.
+	Hash string
+	// Index is the item's new index.
+	Index int
+}
+
+// CategoriesResponse announces the categories defined on the list.
+type CategoriesResponse []Category
+
+// ItemTimingResponse announces the planned start time and duration of a single item.
+type ItemTimingResponse struct {
+	// Index is the index of the item in the list.
+	Index int
+	// Hash is the item's hash.
+	Hash string
+	// Planned is the planned start time, or the zero time for none.
+	Planned time.Time
+	// Duration is the expected duration, or 0 if unknown.
+	Duration time.Duration
+}
+
+// DriftResponse announces how late or early the running order is.
+type DriftResponse struct {
+	// Drift is positive if the selection started late, and negative if it started early.
+	Drift time.Duration
+}
+
+// VersionResponse announces the list's state version.
+// It follows every change to the list, and ends every dump.
+type VersionResponse struct {
+	// Version is the list's current version.
+	Version uint64
+}
+
+// ChecksumResponse reports the checksum of the list's items and selection, in reply to a ChecksumRequest.
+type ChecksumResponse struct {
+	// Version is the list's version.
+	Version uint64
+	// Checksum is the checksum; see Checksum.
+	Checksum string
+}
+
+// FoundResponse announces an item matching a SearchRequest.
+type FoundResponse struct {
+	// Index is the index of the item.
+	Index int
+	// Hash is the hash of the item.
+	Hash string
+}
+
+// HashStateResponse reports the index and state of one hash in a CheckHashesRequest.
+type HashStateResponse struct {
+	// Hash is the hash checked.
+	Hash string
+	// Index is the index of the item with the hash, or -1 if it isn't in the list.
+	Index int
+	// State is the state of the hash: HashSelected, HashQueued, HashEmbargoed, HashExpired, HashRemoved, or
+	// HashUnknown.
+	State string
+}
+
+// DuplicateResponse reports a track that duplicates an earlier one.
+type DuplicateResponse struct {
+	// Index is the index of the duplicate, or -1 if it isn't in the list.
+	Index int
+	// Hash is the hash of the duplicate.
+	Hash string
+	// OfIndex is the index of the item it duplicates.
+	OfIndex int
+	// OfHash is the hash of the item it duplicates.
+	OfHash string
+	// Reason is what the two have in common: DupePayload or DupeTitle.
+	Reason string
+}
+
+// ItemValidityResponse announces a change to the window of time in which an item may go to air.
+type ItemValidityResponse SetItemValidityRequest
+
+// ItemDisplayResponse announces a change to the display hints of a text item.
+type ItemDisplayResponse SetItemDisplayRequest
+
+// BlockResponse announces a block, and which items make it up.
+type BlockResponse struct {
+	// ID is the ID of the block.
+	ID string
+	// Index is the index of the block's first item.
+	Index int
+	// Count is the number of items in the block.
+	Count int
+	// Collapsed is whether displays should show the block as one line.
+	Collapsed bool
+	// Title is the block's title.
+	Title string
+}
+
+// BlockClearedResponse announces that a block is gone.
+type BlockClearedResponse struct {
+	// ID is the ID of the block.
+	ID string
+}
+
+// ItemTextResponse announces a change to the text of a text item.
+type ItemTextResponse SetItemTextRequest
+
+// ItemExpiredResponse announces that an item has passed its valid-until time.
+type ItemExpiredResponse struct {
+	// Index is the index of the item.
+	Index int
+	// Hash is the hash of the item.
+	Hash string
+}
+
+// ItemPlaysResponse announces the number of times an item has been selected.
+type ItemPlaysResponse struct {
+	// Index is the index of the item.
+	Index int
+	// Hash is the hash of the item.
+	Hash string
+	// Count is the number of times an item with this hash has been selected.
+	Count int
+}
+
+// AlertResponse announces an active alert.
+type AlertResponse struct {
+	// Key names the problem.
+	Key string
+	// Severity is how bad the problem is.
+	Severity AlertSeverity
+	// Since is when the alert was first raised.
+	Since time.Time
+	// Count is how many times the alert has been raised since.
+	Count int
+	// Message describes the problem.
+	Message string
+}
+
+// AlertClearedResponse announces that an alert has been cleared.
+type AlertClearedResponse struct {
+	// Key names the problem.
+	Key string
+}
+
+// PlayedResponse reports one selection in the list's play history.
+type PlayedResponse PlayRecord
+
+// DiffResponse starts the reply to a DiffRequest.
+// The replies that follow it, applied in order, bring a copy of the list at version From to version To.
+type DiffResponse struct {
+	// From is the version the changes start from.
+	From uint64
+	// To is the version the changes bring the list to.
+	To uint64
+}
+
+// ScratchItemResponse announces the presence of a single item in the requesting session's scratchpad.
+// It is only ever a reply: nobody else hears about scratchpads.
+type ScratchItemResponse struct {
+	// Index is the index of the item in the scratchpad.
+	Index int
+	// Item is the item itself.
+	Item Item
+}
+
+// MaintenanceResponse announces that the list has gone read-only for maintenance, or, with a zero Until, that it is
+// no longer.
+type MaintenanceResponse struct {
+	// Until is when the maintenance is due to end, or the zero time if it has ended.
+	Until time.Time
+	// Reason is why the list is read-only.
+	Reason string
+}
+
+// EmergencyResponse announces that the list has locked itself in an emergency, or, with a zero Since, that it is no
+// longer.
+type EmergencyResponse struct {
+	// Since is when the emergency started, or the zero time if it has been released.
+	Since time.Time
+	// Reason is what the emergency is.
+	Reason string
+}
+
+// HandoverResponse announces the item the list will hand over to when the selection ends, and how far the handover has
+// got.
+type HandoverResponse struct {
+	// Index is the index of the item in the list.
+	Index int
+	// Hash is the item's hash.
+	Hash string
+	// State is HandoverPending, HandoverReady, or HandoverWaiting.
+	State string
+	// Planned is the item's planned start time, or the zero time for none.
+	Planned time.Time
+	// Duration is the item's expected duration, or 0 if unknown.
+	Duration time.Duration
+	// Due is when the list gives up waiting for the player and hands over anyway, or the zero time if it isn't
+	// waiting.
+	Due time.Time
+}
+
+// HandoverClearedResponse announces that the list no longer has an item to hand over to.
+type HandoverClearedResponse struct{}
@@ -0,0 +1,147 @@
+package list
+
+// File scratch.go contains the List logic for scratchpads: private, temporary lists for preparing a block of items
+// off-air.
+//
+// Each session (each client connection) has at most one scratchpad, made the first time it loads an item into one.
+// Nobody else hears about a scratchpad, and it is thrown away when its session ends, unless promoted first:
+// promotion splices the whole scratchpad into the list as one change, so other clients never see half a block.
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// ErrNoScratchpad is the error returned when a session asks for a scratchpad it doesn't have.
+var ErrNoScratchpad = errors.New("no scratchpad: load an item into one first")
+
+// spliceRequest requests that items be added to the list, in order, in front of the given index, as one change.
+// It has no Bifrost equivalent: it is how a PromoteScratchRequest reaches the list once its items are known.
+// (CloneRequests splice through handleSpliceRequest directly.)
+type spliceRequest struct {
+	// Index is the index at which to splice the items.
+	Index int
+	// Items holds the items to splice.
+	Items []*Item
+}
+
+// HandleSessionRequest handles a request, with context ctx, for List l from the session sid.
+// Scratchpad requests are handled here; everything else goes to HandleRequest.
+func (l *List) HandleSessionRequest(ctx context.Context, sid controller.Session, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, rbody interface{}) error {
+	switch b := rbody.(type) {
+	case AddScratchItemRequest:
+		return l.handleAddScratchItemRequest(sid, replyCb, b)
+	case ScratchDumpRequest:
+		return l.handleScratchDumpRequest(sid, replyCb, b)
+	case DropScratchRequest:
+		delete(l.scratchpads, sid)
+		return nil
+	case PromoteScratchRequest:
+		return l.promoteScratch(ctx, sid, replyCb, bcastCb, nil, b)
+	case VersionedRequest:
+		if p, ok := b.Request.(PromoteScratchRequest); ok {
+			return l.promoteScratch(ctx, sid, replyCb, bcastCb, &b, p)
+		}
+	}
+	return l.HandleRequest(ctx, replyCb, bcastCb, rbody)
+}
+
+// EndSession throws away the scratchpad of the session sid, if it has one.
+func (l *List) EndSession(sid controller.Session) {
+	delete(l.scratchpads, sid)
+}
+
+// handleAddScratchItemRequest handles a scratchpad item add request for List l from the session sid.
+func (l *List) handleAddScratchItemRequest(sid controller.Session, replyCb controller.ResponseCb, b AddScratchItemRequest) error {
+	pad := l.scratchpads[sid]
+	if b.Index < 0 || len(pad) < b.Index {
+		return fmt.Errorf("tried to insert element at index %d when there are only %d item(s)", b.Index, len(pad))
+	}
+	for j, it := range pad {
+		if it.hash == b.Item.hash {
+			return fmt.Errorf("duplicate hash %s at scratchpad index %d", it.hash, j)
+		}
+	}
+
+	item := b.Item
+	pad = append(pad, nil)
+	copy(pad[b.Index+1:], pad[b.Index:])
+	pad[b.Index] = &item
+	l.scratchpads[sid] = pad
+
+	replyCb(ScratchItemResponse(b))
+	return nil
+}
+
+// handleScratchDumpRequest handles a scratchpad dump request for List l from the session sid.
+func (l *List) handleScratchDumpRequest(sid controller.Session, replyCb controller.ResponseCb, b ScratchDumpRequest) error {
+	pad, ok := l.scratchpads[sid]
+	if !ok {
+		return ErrNoScratchpad
+	}
+	for i, it := range pad {
+		replyCb(ScratchItemResponse{Index: i, Item: *it})
+	}
+	return nil
+}
+
+// promoteScratch splices the scratchpad of the session sid into List l, as asked by b with context ctx.
+// If v is not nil, the splice only goes ahead if l is still at v's version.
+// The scratchpad goes away only if the splice succeeds, so that the client can try again.
+func (l *List) promoteScratch(ctx context.Context, sid controller.Session, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, v *VersionedRequest, b PromoteScratchRequest) error {
+	pad, ok := l.scratchpads[sid]
+	if !ok {
+		return ErrNoScratchpad
+	}
+
+	var rbody interface{} = spliceRequest{Index: b.Index, Items: pad}
+	if v != nil {
+		rbody = VersionedRequest{Version: v.Version, Request: rbody}
+	}
+	if err := l.HandleRequest(ctx, replyCb, bcastCb, rbody); err != nil {
+		return err
+	}
+	delete(l.scratchpads, sid)
+	return nil
+}
+
+// handleSpliceRequest handles a splice request, with context ctx, for List l.
+// If any item can't be added, or ctx ends midway, none are.
+func (l *List) handleSpliceRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b spliceRequest) error {
+	p := controller.NewProgress(replyCb, "adding items", len(b.Items))
+	for k, it := range b.Items {
+		err := ctx.Err()
+		if err == nil {
+			err = l.spliceItem(it, b.Index+k)
+		}
+		if err == nil {
+			p.Step(k + 1)
+			continue
+		}
+
+		// Back out the items already spliced, last first, so that the indices stay right.
+		for j := k - 1; 0 <= j; j-- {
+			l.removeElement(b.Index+j, l.elementWithIndex(b.Index+j))
+		}
+		return fmt.Errorf("spliced item %d (%s): %w", k, it.hash, err)
+	}
+
+	for k, it := range b.Items {
+		bcastCb(ItemResponse{Index: b.Index + k, Item: *it})
+	}
+	return nil
+}
+
+// spliceItem adds a copy of it to l at index i, as part of a splice.
+func (l *List) spliceItem(it *Item, i int) error {
+	item := *it
+	if l.dedupe {
+		if err := l.checkDuplicate(&item); err != nil {
+			return err
+		}
+	}
+	return l.Add(&item, i)
+}
@@ -0,0 +1,94 @@
+package list
+
+// File search.go contains the List logic for finding items without dumping the whole list.
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+const (
+	// SearchAny searches items' payloads and notes.
+	SearchAny = "any"
+	// SearchPayload searches items' payloads: paths for tracks, or text for text items.
+	SearchPayload = "payload"
+	// SearchNote searches items' notes.
+	SearchNote = "note"
+	// SearchHash searches items' hashes.
+	SearchHash = "hash"
+	// SearchCategory matches items whose category is the query, ignoring case.
+	SearchCategory = "category"
+)
+
+// Search gets the items in l that match query in field, in list order.
+// Matches are case-insensitive, and are on substrings except for SearchCategory; an empty field means SearchAny.
+func (l *List) Search(query, field string) ([]FoundResponse, error) {
+	matches, err := l.searchItems(query, field)
+	if err != nil {
+		return nil, err
+	}
+	return foundResponses(matches), nil
+}
+
+// searchItems gets the items in l matching query in field, in list order.
+func (l *List) searchItems(query, field string) ([]ItemResponse, error) {
+	match, err := searchMatcher(strings.ToLower(query), field)
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []ItemResponse
+	i := 0
+	for e := l.list.Front(); e != nil; e = e.Next() {
+		item := e.Value.(*Item)
+		if match(item) {
+			matches = append(matches, ItemResponse{Index: i, Item: *item})
+		}
+		i++
+	}
+	return matches, nil
+}
+
+// foundResponses converts matching items into responses.
+func foundResponses(matches []ItemResponse) []FoundResponse {
+	found := make([]FoundResponse, len(matches))
+	for i, m := range matches {
+		found[i] = FoundResponse{Index: m.Index, Hash: m.Item.hash}
+	}
+	return found
+}
+
+// searchMatcher gets a function checking whether an item matches the lowercase query q in field.
+func searchMatcher(q, field string) (func(*Item) bool, error) {
+	has := func(s string) bool {
+		return strings.Contains(strings.ToLower(s), q)
+	}
+
+	switch field {
+	case "", SearchAny:
+		return func(i *Item) bool { return has(i.payload) || has(i.note) }, nil
+	case SearchPayload:
+		return func(i *Item) bool { return has(i.payload) }, nil
+	case SearchNote:
+		return func(i *Item) bool { return has(i.note) }, nil
+	case SearchHash:
+		return func(i *Item) bool { return has(i.hash) }, nil
+	case SearchCategory:
+		return func(i *Item) bool { return strings.ToLower(i.category) == q }, nil
+	default:
+		return nil, fmt.Errorf("unknown search field: %s", field)
+	}
+}
+
+// handleSearchRequest handles a search request for List l.
+func (l *List) handleSearchRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b SearchRequest) error {
+	matches, err := l.searchItems(b.Query, b.Field)
+	if err != nil {
+		return err
+	}
+	return replyEach(ctx, replyCb, "sending matches", foundResponses(bifrost.ApplyQuery(b.Options, matches)))
+}
@@ -0,0 +1,55 @@
+package list
+
+// File separator.go contains separators: text items defined once, in the config, that presenters drop into the list
+// with a short command, such as hour markers or 'NEWS' breaks.
+//
+// Each copy of a separator is an ordinary text item with a fresh hash, so, like any text item, it can't be selected.
+// Giving separators a category of their own lets clients draw them differently from other text items.
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// Separator is a text item that can be copied into the list by name.
+type Separator struct {
+	// Name is the name by which 'sep' requests refer to the separator.
+	Name string
+	// Text is the text of each copy.
+	Text string
+	// Note is the note on each copy, if any.
+	Note string
+	// Category is the category of each copy, if any.
+	Category string
+}
+
+// DefineSeparators replaces the set of separators 'sep' requests may copy into l.
+func (l *List) DefineSeparators(seps []Separator) {
+	l.separators = make(map[string]Separator, len(seps))
+	for _, s := range seps {
+		l.separators[s.Name] = s
+	}
+}
+
+// handleSeparatorRequest handles a separator request, with context ctx, for List l.
+// The copy is spliced in, so that it reaches clients with its note and category.
+func (l *List) handleSeparatorRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b SeparatorRequest) error {
+	s, ok := l.separators[b.Name]
+	if !ok {
+		return fmt.Errorf("no such separator: %s", b.Name)
+	}
+	if err := l.checkCategory(s.Category); err != nil {
+		return fmt.Errorf("separator %s: %w", s.Name, err)
+	}
+	hash, err := FreshHash()
+	if err != nil {
+		return err
+	}
+
+	item := NewText(hash, s.Text)
+	item.note = s.Note
+	item.category = s.Category
+	return l.handleSpliceRequest(ctx, replyCb, bcastCb, spliceRequest{Index: b.Index, Items: []*Item{item}})
+}
@@ -0,0 +1,192 @@
+package list
+
+// File state.go contains State, a plain copy of everything about a List worth keeping across restarts.
+// - See package 'store' for the places yaps keeps it.
+//
+// Anything recalculated as time passes, such as drift, or set from the config, such as categories, isn't part of it.
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// ItemState is a plain copy of an Item.
+type ItemState struct {
+	Hash       string
+	Type       ItemType
+	Payload    string
+	Note       string
+	Category   string
+	Planned    time.Time
+	Duration   time.Duration
+	ValidFrom  time.Time
+	ValidUntil time.Time
+	Display    DisplayHints
+	Block      string
+}
+
+// State is a plain copy of the state of a List.
+type State struct {
+	// Items holds the items, in order.
+	Items []ItemState
+	// Selection is the selected index, or -1.
+	Selection int
+	// SelectedAt is when the selection was made, or the zero time if that isn't known.
+	SelectedAt time.Time
+	// Note is the list note.
+	Note string
+	// AutoMode is the autoselect mode.
+	AutoMode AutoMode
+	// Version is the state version.
+	Version uint64
+	// Plays maps hashes to play counts.
+	Plays map[string]int
+	// Blocks holds the definitions of the blocks the items are in, in ID order.
+	Blocks []Block
+}
+
+// StateSaver is the type of functions that keep a List's State somewhere whenever it changes.
+type StateSaver func(s State) error
+
+// State gets a copy of l's state.
+func (l *List) State() State {
+	s := State{
+		Items:      make([]ItemState, 0, l.list.Len()),
+		Selection:  l.selection,
+		SelectedAt: l.selectedAt.Round(0), // no monotonic reading, as it can't survive being saved
+		Note:       l.note,
+		AutoMode:   l.autoselect,
+		Version:    l.version,
+		Plays:      l.PlayCounts(),
+		Blocks:     l.blockStates(),
+	}
+	for e := l.list.Front(); e != nil; e = e.Next() {
+		i := e.Value.(*Item)
+		s.Items = append(s.Items, ItemState{
+			Hash:       i.hash,
+			Type:       i.itype,
+			Payload:    i.payload,
+			Note:       i.note,
+			Category:   i.category,
+			Planned:    i.planned,
+			Duration:   i.duration,
+			ValidFrom:  i.validFrom,
+			ValidUntil: i.validUntil,
+			Display:    i.display,
+			Block:      i.block,
+		})
+	}
+	return s
+}
+
+// Restore replaces l's state with s, for example one saved by a previous run.
+// It fails with an IntegrityError, leaving l as it was, if s isn't a state a List could be in; see State.Check.
+func (l *List) Restore(s State) error {
+	if problems := s.Check(); len(problems) != 0 {
+		return IntegrityError{Problems: problems}
+	}
+
+	nl := New()
+	for i, is := range s.Items {
+		item := itemFromState(is)
+		if err := nl.Add(item, i); err != nil {
+			return fmt.Errorf("restoring item %d: %w", i, err)
+		}
+		// Adding only puts items in blocks they land inside.
+		item.block = is.Block
+	}
+	blocks := make(map[string]Block, len(s.Blocks))
+	for _, b := range s.Blocks {
+		blocks[b.ID] = b
+	}
+
+	l.list = nl.list
+	l.blocks = blocks
+	l.selection = s.Selection
+	l.selectedAt = s.SelectedAt
+	l.note = s.Note
+	l.autoselect = s.AutoMode
+	l.version = s.Version
+	l.SetPlayCounts(s.Plays)
+	l.clearUsedHashes()
+	l.expired = make(map[string]struct{})
+	// Older versions are gone, so diffs must start from here.
+	l.history = nil
+	l.remember()
+	return nil
+}
+
+// itemFromState makes an Item from its plain copy is.
+func itemFromState(is ItemState) *Item {
+	item := NewItem(is.Type, is.Hash, is.Payload)
+	item.note = is.Note
+	item.category = is.Category
+	item.planned = is.Planned
+	item.duration = is.Duration
+	item.validFrom = is.ValidFrom
+	item.validUntil = is.ValidUntil
+	item.display = is.Display
+	return item
+}
+
+// SetStateSaver sets the function l calls with its new state whenever a request changes it; nil turns saving off.
+// If saving fails, the request that made the change fails with the error, but the change stands.
+func (l *List) SetStateSaver(save StateSaver) {
+	l.saveState = save
+}
+
+// saveChanges calls l's StateSaver, if it has one, raising or clearing the storage alert through bcastCb.
+func (l *List) saveChanges(bcastCb controller.ResponseCb) error {
+	if l.saveState == nil {
+		return nil
+	}
+	if err := l.saveState(l.State()); err != nil {
+		err = fmt.Errorf("changed, but couldn't save the list: %w", err)
+		l.raiseAlert(bcastCb, AlertKeyStorage, AlertError, err.Error())
+		return err
+	}
+	l.clearAlert(bcastCb, AlertKeyStorage)
+	return nil
+}
+
+// stateResponse is the reply to a StateRequest.
+type stateResponse struct {
+	// st is a copy of the list's state.
+	st State
+}
+
+// handleStateRequest handles a request for a copy of List l's state.
+func (l *List) handleStateRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b StateRequest) error {
+	replyCb(stateResponse{st: l.State()})
+	return nil
+}
+
+// RecoverState rebuilds a minimal State from the plays in log at or after since, for when the saved state is missing
+// or can't be restored.
+// The State holds each item played, in the order each was first played, with the last one played selected as of when
+// it was played, and the number of times each was played; notes, categories, timings and so on can't be recovered.
+// Its version is the time of recovery in Unix seconds, so that it is newer than any version a client will have
+// cached.
+func RecoverState(log PlayLog, since time.Time) (State, error) {
+	plays, err := log.Query(since, time.Time{})
+	if err != nil {
+		return State{}, fmt.Errorf("couldn't read play history: %w", err)
+	}
+
+	s := State{Selection: -1, Version: uint64(time.Now().Unix()), Plays: make(map[string]int)}
+	indices := make(map[string]int)
+	for _, p := range plays {
+		i, ok := indices[p.Hash]
+		if !ok {
+			i = len(s.Items)
+			indices[p.Hash] = i
+			s.Items = append(s.Items, ItemState{Hash: p.Hash, Type: ItemTrack, Payload: p.Payload})
+		}
+		s.Plays[p.Hash]++
+		s.Selection = i
+		s.SelectedAt = p.At
+	}
+	return s, nil
+}
@@ -0,0 +1,123 @@
+package list
+
+// File template.go contains templates: the running order of a list without the state of any one show, for
+// recurring shows that start from the same format every time.
+// - See package 'store' for template files.
+//
+// A List can be instantiated from a template, or cloned from another List by way of one, and a template can be
+// cloned into a running List with the 'clone' request.
+// Hashes must be unique within a list, and play counts and history go by hash, so clones usually get fresh hashes:
+// otherwise, every week's show would share the last one's.
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// ErrNoTemplates is the error returned when a list with no TemplateLoader is asked to clone a template.
+var ErrNoTemplates = errors.New("this list has no templates")
+
+// Template is the running order of a list, without its selection, version or plays.
+type Template struct {
+	// Note is the list note.
+	Note string
+	// AutoMode is the autoselect mode.
+	AutoMode AutoMode
+	// Items holds the items, in order.
+	Items []ItemState
+}
+
+// TemplateLoader is the type of functions that get the template with the given name.
+type TemplateLoader func(name string) (Template, error)
+
+// Template gets the template of s.
+func (s State) Template() Template {
+	return Template{Note: s.Note, AutoMode: s.AutoMode, Items: append([]ItemState(nil), s.Items...)}
+}
+
+// Template gets a template of l's current running order.
+func (l *List) Template() Template {
+	return l.State().Template()
+}
+
+// Instantiate makes a new List from t, with nothing selected.
+// If fresh is true, every item gets a fresh hash; otherwise the items keep the template's hashes.
+func (t Template) Instantiate(fresh bool) (*List, error) {
+	s := State{Items: t.Items, Selection: -1, Note: t.Note, AutoMode: t.AutoMode}
+	if fresh {
+		var err error
+		if s.Items, err = freshenHashes(t.Items); err != nil {
+			return nil, err
+		}
+	}
+
+	l := New()
+	if err := l.Restore(s); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Clone makes a new List with l's running order, with nothing selected.
+// If fresh is true, every item gets a fresh hash; otherwise the items keep l's hashes.
+func (l *List) Clone(fresh bool) (*List, error) {
+	return l.Template().Instantiate(fresh)
+}
+
+// SetTemplates sets the function l uses to find templates for 'clone' requests; nil turns cloning off.
+func (l *List) SetTemplates(load TemplateLoader) {
+	l.templates = load
+}
+
+// FreshHash makes a new random hash, for items that need one.
+func FreshHash() (string, error) {
+	var bs [8]byte
+	if _, err := rand.Read(bs[:]); err != nil {
+		return "", fmt.Errorf("couldn't make a fresh hash: %w", err)
+	}
+	return hex.EncodeToString(bs[:]), nil
+}
+
+// freshenHashes gets a copy of items with fresh hashes.
+func freshenHashes(items []ItemState) ([]ItemState, error) {
+	fresh := make([]ItemState, len(items))
+	for i, is := range items {
+		h, err := FreshHash()
+		if err != nil {
+			return nil, err
+		}
+		is.Hash = h
+		fresh[i] = is
+	}
+	return fresh, nil
+}
+
+// handleCloneRequest handles a template clone request, with context ctx, for List l.
+// The template's items, with fresh hashes, are spliced into l in one change.
+func (l *List) handleCloneRequest(ctx context.Context, replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b CloneRequest) error {
+	if l.templates == nil {
+		return ErrNoTemplates
+	}
+	t, err := l.templates(b.Template)
+	if err != nil {
+		return fmt.Errorf("couldn't load template %q: %w", b.Template, err)
+	}
+	states, err := freshenHashes(t.Items)
+	if err != nil {
+		return err
+	}
+
+	items := make([]*Item, len(states))
+	for i, is := range states {
+		if is.Type != ItemTrack && is.Type != ItemText {
+			return fmt.Errorf("template %q item %d: unknown item type %v", b.Template, i, is.Type)
+		}
+		items[i] = itemFromState(is)
+	}
+	return l.handleSpliceRequest(ctx, replyCb, bcastCb, spliceRequest{Index: b.Index, Items: items})
+}
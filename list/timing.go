@@ -0,0 +1,83 @@
+package list
+
+// File timing.go contains the List logic for planned start times, durations, and running-order drift.
+
+import (
+	"time"
+)
+
+// SetItemTiming changes the planned start time and duration of the item with the given index and hash.
+// A zero planned time means 'no planned start', and a zero duration means 'unknown duration'.
+// It returns whether the timing has changed.
+// It fails if the item doesn't exist or has a different hash.
+func (l *List) SetItemTiming(index int, hash string, planned time.Time, duration time.Duration) (changed bool, err error) {
+	var i *Item
+	if i, err = l.checkedItem("SetItemTiming", index, hash); err != nil {
+		return
+	}
+
+	changed = !planned.Equal(i.planned) || duration != i.duration
+	i.planned = planned
+	i.duration = duration
+	return
+}
+
+// SetDriftThreshold sets the granularity at which drift changes are worth announcing.
+// A zero threshold disables drift announcements.
+func (l *List) SetDriftThreshold(t time.Duration) {
+	l.driftThreshold = t
+}
+
+// Drift calculates how late (positive) or early (negative) the current selection started, from when it was selected.
+//
+// The expected start of the selection is the planned start of the nearest item at or before it with one, plus the
+// durations of every item in between.
+// Drift returns false if there is no selection, it isn't known when the selection was made, there is no such planned
+// item, or an intervening item has no duration.
+func (l *List) Drift() (time.Duration, bool) {
+	if l.selection < 0 || l.selectedAt.IsZero() {
+		return 0, false
+	}
+
+	var offset time.Duration
+	e := l.elementWithIndex(l.selection)
+	for first := true; e != nil; e, first = e.Prev(), false {
+		item := e.Value.(*Item)
+		if !first {
+			if item.duration == 0 {
+				return 0, false
+			}
+			offset += item.duration
+		}
+		if !item.planned.IsZero() {
+			return l.selectedAt.Sub(item.planned.Add(offset)), true
+		}
+	}
+	return 0, false
+}
+
+// driftBand quantises drift d by the List's drift threshold.
+// Band 0 means 'within the threshold either way'.
+func (l *List) driftBand(d time.Duration) int {
+	return int(d / l.driftThreshold)
+}
+
+// updateDrift recalculates drift, returning a response if it has moved into a different band since the last
+// announcement.
+func (l *List) updateDrift() (DriftResponse, bool) {
+	if l.driftThreshold <= 0 {
+		return DriftResponse{}, false
+	}
+
+	d, ok := l.Drift()
+	if !ok {
+		return DriftResponse{}, false
+	}
+
+	band := l.driftBand(d)
+	if band == l.lastDriftBand {
+		return DriftResponse{}, false
+	}
+	l.lastDriftBand = band
+	return DriftResponse{Drift: d}, true
+}
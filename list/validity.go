@@ -0,0 +1,247 @@
+package list
+
+// File validity.go contains the List logic for items that may only go to air within a window of time.
+//
+// An item is embargoed before its valid-from time, and expired after its valid-until time; either may be zero,
+// meaning 'no limit'.
+// Neither clients nor autoselection can select an item outside its window.
+// Expiry is checked by ExpireRequests, which yaps sends regularly: depending on the list's ExpiryPolicy, each
+// newly expired item is then either announced with IEXPIRED or removed with IDEL.
+// The selected item is never removed, and is only announced once it is no longer selected.
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/clock"
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+const (
+	// CodeEmbargoed is the error code of EmbargoErrors.
+	CodeEmbargoed = "embargoed"
+	// CodeExpired is the error code of ExpiredErrors.
+	CodeExpired = "expired"
+)
+
+// ExpiryPolicy is the type of policies for what a List does with expired items.
+type ExpiryPolicy int
+
+const (
+	// ExpiryFlag announces expired items, but leaves them in the list.
+	ExpiryFlag ExpiryPolicy = iota
+	// ExpiryRemove removes expired items from the list.
+	ExpiryRemove
+)
+
+// ParseExpiryPolicy parses the expiry policy named s: 'flag' or 'remove'.
+func ParseExpiryPolicy(s string) (ExpiryPolicy, error) {
+	switch s {
+	case "flag":
+		return ExpiryFlag, nil
+	case "remove":
+		return ExpiryRemove, nil
+	default:
+		return ExpiryFlag, fmt.Errorf("unknown expiry policy: %q", s)
+	}
+}
+
+// EmbargoError is the error returned when selecting an item before its valid-from time.
+type EmbargoError struct {
+	// Hash is the hash of the item.
+	Hash string
+	// From is the item's valid-from time.
+	From time.Time
+}
+
+// Error gets the error message of an EmbargoError.
+func (e EmbargoError) Error() string {
+	return fmt.Sprintf("embargoed: item %s can't be selected until %s", e.Hash, e.From.Format(time.RFC3339))
+}
+
+// Code gets the error code of an EmbargoError.
+func (EmbargoError) Code() string {
+	return CodeEmbargoed
+}
+
+// ExpiredError is the error returned when selecting an item after its valid-until time.
+type ExpiredError struct {
+	// Hash is the hash of the item.
+	Hash string
+	// Until is the item's valid-until time.
+	Until time.Time
+}
+
+// Error gets the error message of an ExpiredError.
+func (e ExpiredError) Error() string {
+	return fmt.Sprintf("expired: item %s couldn't be selected after %s", e.Hash, e.Until.Format(time.RFC3339))
+}
+
+// Code gets the error code of an ExpiredError.
+func (ExpiredError) Code() string {
+	return CodeExpired
+}
+
+// ValidFrom returns the time before which the Item is embargoed, or the zero time if it has none.
+func (i *Item) ValidFrom() time.Time {
+	return i.validFrom
+}
+
+// ValidUntil returns the time after which the Item is expired, or the zero time if it has none.
+func (i *Item) ValidUntil() time.Time {
+	return i.validUntil
+}
+
+// ValidAt checks whether the Item may go to air at time now, returning an EmbargoError or ExpiredError if not.
+func (i *Item) ValidAt(now time.Time) error {
+	if !i.validFrom.IsZero() && now.Before(i.validFrom) {
+		return EmbargoError{Hash: i.hash, From: i.validFrom}
+	}
+	if i.expiredAt(now) {
+		return ExpiredError{Hash: i.hash, Until: i.validUntil}
+	}
+	return nil
+}
+
+// expiredAt gets whether the Item has expired by time now.
+func (i *Item) expiredAt(now time.Time) bool {
+	return !i.validUntil.IsZero() && now.After(i.validUntil)
+}
+
+// SetItemValidity changes the window of time in which the item with the given index and hash may go to air.
+// A zero time means 'no limit' at that end.
+// It returns whether the window has changed.
+// It fails if the item doesn't exist, has a different hash, or the window ends before it starts.
+func (l *List) SetItemValidity(index int, hash string, from, until time.Time) (changed bool, err error) {
+	if !from.IsZero() && !until.IsZero() && until.Before(from) {
+		return false, fmt.Errorf("SetItemValidity: valid-until %s is before valid-from %s",
+			until.Format(time.RFC3339), from.Format(time.RFC3339))
+	}
+
+	var i *Item
+	if i, err = l.checkedItem("SetItemValidity", index, hash); err != nil {
+		return
+	}
+
+	changed = !from.Equal(i.validFrom) || !until.Equal(i.validUntil)
+	if changed {
+		// A new window means any expiry has to be announced afresh.
+		delete(l.expired, hash)
+	}
+	i.validFrom = from
+	i.validUntil = until
+	return
+}
+
+// SetExpiryPolicy sets what l does with items that have expired.
+func (l *List) SetExpiryPolicy(p ExpiryPolicy) {
+	l.expiryPolicy = p
+}
+
+// Expire applies l's expiry policy to every item that has expired by time now, other than the selection.
+// Under ExpiryFlag, items already announced are left alone.
+// It returns the responses announcing what it did.
+func (l *List) Expire(now time.Time) []interface{} {
+	var rs []interface{}
+
+	i := 0
+	for e := l.list.Front(); e != nil; {
+		item := e.Value.(*Item)
+		next := e.Next()
+
+		_, flagged := l.expired[item.hash]
+		done := flagged && l.expiryPolicy == ExpiryFlag
+		if done || i == l.selection || !item.expiredAt(now) {
+			e = next
+			i++
+			continue
+		}
+
+		switch l.expiryPolicy {
+		case ExpiryRemove:
+			l.removeElement(i, e)
+			rs = append(rs, ItemRemoveResponse{Hash: item.hash})
+			// The next item now has index i.
+		default:
+			l.expired[item.hash] = struct{}{}
+			rs = append(rs, ItemExpiredResponse{Index: i, Hash: item.hash})
+			i++
+		}
+		e = next
+	}
+	return rs
+}
+
+// removeElement removes element e, which has index i, from l, keeping the same item selected.
+func (l *List) removeElement(i int, e *list.Element) {
+	item := e.Value.(*Item)
+	h := item.hash
+	l.list.Remove(e)
+	delete(l.usedHashes, h)
+	delete(l.expired, h)
+	l.forgetEmptyBlock(item.block)
+
+	switch {
+	case i == l.selection:
+		l.selection = -1
+	case i < l.selection:
+		l.selection--
+	}
+}
+
+// handleSetItemValidityRequest handles an item validity change request for List l.
+func (l *List) handleSetItemValidityRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b SetItemValidityRequest) error {
+	changed, err := l.SetItemValidity(b.Index, b.Hash, b.From, b.Until)
+	if err == nil && changed {
+		bcastCb(ItemValidityResponse(b))
+	}
+	return err
+}
+
+// handleExpireRequest handles an expiry check for List l.
+func (l *List) handleExpireRequest(replyCb controller.ResponseCb, bcastCb controller.ResponseCb, b ExpireRequest) error {
+	for _, r := range l.Expire(l.clock.Now()) {
+		bcastCb(r)
+	}
+	return nil
+}
+
+// RunExpiry sends an ExpireRequest through client every interval, by clk, until ctx is cancelled or the Controller
+// hangs up.
+// While the list is a replica, the primary checks for expiry instead, so RunExpiry skips its checks until a promotion.
+// It hangs up client when it returns.
+func RunExpiry(ctx context.Context, client *controller.Client, interval time.Duration, clk clock.Clock) error {
+	// The client receives broadcasts too, and must keep draining them.
+	go func() {
+		for range client.Rx {
+		}
+	}()
+	// Closing our request channel is how we hang up on the Controller.
+	defer close(client.Tx)
+
+	t := clk.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C():
+			err := client.Call(ctx, ExpireRequest{})
+			if errors.Is(err, controller.ErrControllerShutDown) {
+				return nil
+			}
+			if code := bifrost.CodeOf(err); code == CodeMaintenance || code == CodeEmergency || code == CodeReplica {
+				// Expiry waits for maintenance, or the emergency, to end, and for a replica to be promoted.
+				continue
+			}
+			if err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package list
+
+// File version.go contains the List's state version, used for optimistic concurrency between clients.
+
+import (
+	"fmt"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// CodeConflict is the error code of ConflictErrors.
+const CodeConflict = "conflict"
+
+// ConflictError is the error returned when a VersionedRequest's version doesn't match the list's.
+type ConflictError struct {
+	// Current is the list's current version.
+	Current uint64
+}
+
+// Error gets the error message of a ConflictError.
+func (e ConflictError) Error() string {
+	return fmt.Sprintf("conflict: list has changed, and is now at version %d", e.Current)
+}
+
+// Code gets the error code of a ConflictError.
+func (ConflictError) Code() string {
+	return CodeConflict
+}
+
+// Version gets l's state version.
+// The version goes up by one every time a request changes l.
+func (l *List) Version() uint64 {
+	return l.version
+}
+
+// versionResponse returns l's version as a response.
+func (l *List) versionResponse() VersionResponse {
+	return VersionResponse{Version: l.version}
+}
+
+// checkVersion checks a versioned request against l's version.
+func (l *List) checkVersion(b VersionedRequest) error {
+	if b.Version != l.version {
+		return ConflictError{Current: l.version}
+	}
+	return nil
+}
+
+// versionedBcast wraps bcastCb so that l's version increases after any broadcast that changes l's state.
+// The returned function announces the new version, if it changed, and saves the new state;
+// call it once handling is over.
+func (l *List) versionedBcast(bcastCb controller.ResponseCb) (controller.ResponseCb, func() error) {
+	changed := false
+
+	wrapped := func(rbody interface{}) {
+		// Drift, expiry, alerts, maintenance, emergencies, and handovers come and go with time and circumstance, so
+		// they aren't part of the state being versioned.
+		switch rbody.(type) {
+		case DriftResponse, ItemExpiredResponse, AlertResponse, AlertClearedResponse, MaintenanceResponse,
+			EmergencyResponse, HandoverResponse, HandoverClearedResponse:
+		default:
+			changed = true
+		}
+		bcastCb(rbody)
+	}
+	done := func() error {
+		if !changed {
+			return nil
+		}
+		l.version++
+		l.remember()
+		bcastCb(l.versionResponse())
+		return l.saveChanges(bcastCb)
+	}
+	return wrapped, done
+}
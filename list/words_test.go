@@ -0,0 +1,108 @@
+package list_test
+
+import (
+	"testing"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// wordTable builds the word table of the adapter and the list role, failing t if the two clash.
+func wordTable(t *testing.T) *controller.WordTable {
+	t.Helper()
+	wt, err := controller.NewWordTable(list.New().BifrostSchema())
+	if err != nil {
+		t.Fatal("couldn't build word table:", err)
+	}
+	return wt
+}
+
+// TestWordTable_roles checks that list and adapter words are tabled under the right roles.
+func TestWordTable_roles(t *testing.T) {
+	wt := wordTable(t)
+	for word, want := range map[string]string{
+		list.RqSel:         "list",
+		list.RqFloadl:      "list",
+		controller.RqDump:  controller.AdapterRole,
+		controller.RqCaps:  controller.AdapterRole,
+		controller.RqLogin: controller.AdapterRole,
+	} {
+		if got, ok := wt.RequestRole(word); !ok || got != want {
+			t.Errorf("RequestRole(%q) = %q, %v; want %q", word, got, ok, want)
+		}
+	}
+	for word, want := range map[string]string{
+		list.RsSel:            "list",
+		list.RsCatdef:         "list",
+		controller.RsCaps:     controller.AdapterRole,
+		controller.RsDescribe: controller.AdapterRole,
+	} {
+		if got, ok := wt.ResponseRole(word); !ok || got != want {
+			t.Errorf("ResponseRole(%q) = %q, %v; want %q", word, got, ok, want)
+		}
+	}
+	if _, ok := wt.RequestRole("SEL"); ok {
+		t.Error("response word SEL tabled as a request")
+	}
+}
+
+// TestBifrostSchema_parsers checks that every word the list describes has a parser, so that the schema, the request
+// dispatcher and the client-side response dispatcher can't drift apart.
+func TestBifrostSchema_parsers(t *testing.T) {
+	l := list.New()
+	s := l.BifrostSchema()
+	for _, w := range s.Requests {
+		if _, err := l.ParseBifrostRequest(w.Word, nil); bifrost.CodeOf(err) == bifrost.CodeUnknownWord {
+			t.Errorf("described request %q has no parser", w.Word)
+		}
+	}
+	for _, w := range s.Responses {
+		m := message.New(message.TagBcast, w.Word)
+		if _, err := list.ParseBifrostResponse(*m); bifrost.CodeOf(err) == bifrost.CodeUnknownWord {
+			t.Errorf("described response %q has no parser", w.Word)
+		}
+	}
+}
+
+// TestWordTable_Check_dialects checks that the dialects only translate words a list server has.
+func TestWordTable_Check_dialects(t *testing.T) {
+	wt := wordTable(t)
+	var rqs, rss []string
+	for _, w := range controller.Baps3d.Requests {
+		rqs = append(rqs, w)
+	}
+	for w := range controller.Baps3d.Responses {
+		rss = append(rss, w)
+	}
+	if err := wt.Check("list", rqs, rss); err != nil {
+		t.Errorf("dialect %s: %v", controller.Baps3d.Name, err)
+	}
+}
+
+// TestWordTable_Check checks that Check names words that aren't the role's, or are the wrong kind.
+func TestWordTable_Check(t *testing.T) {
+	wt := wordTable(t)
+	if err := wt.Check("list", []string{list.RqSel, controller.RqDump}, []string{list.RsSel, controller.RsTime}); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	err := wt.Check("list", []string{"select", list.RsSel}, []string{"SELECT"})
+	want := "not list words: request SEL, request select, response SELECT"
+	if err == nil || err.Error() != want {
+		t.Errorf("Check error = %v; want %q", err, want)
+	}
+}
+
+// TestNewWordTable_clash checks that two roles can't claim the same word.
+func TestNewWordTable_clash(t *testing.T) {
+	s := controller.Schema{Role: "other", Requests: []controller.WordSchema{{Word: list.RqSel}}}
+	if _, err := controller.NewWordTable(list.New().BifrostSchema(), s); err == nil {
+		t.Error("clashing roles tabled without error")
+	}
+	s = controller.Schema{Role: "other", Requests: []controller.WordSchema{{Word: "foo", Replies: []string{"FOO"}}}}
+	if _, err := controller.NewWordTable(s); err == nil {
+		t.Error("reply with unknown response tabled without error")
+	}
+}
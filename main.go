@@ -3,131 +3,83 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
-	"log"
 	"os"
 	"os/signal"
 
 	"github.com/MattWindsor91/yaps/config"
-	"golang.org/x/sync/errgroup"
-
-	"github.com/MattWindsor91/yaps/console"
-	"github.com/MattWindsor91/yaps/controller"
-	"github.com/MattWindsor91/yaps/list"
-	"github.com/MattWindsor91/yaps/netsrv"
+	"github.com/MattWindsor91/yaps/server"
+	"github.com/MattWindsor91/yaps/version"
 )
 
-func makeLog(section string, enabled bool) *log.Logger {
-	var lw io.Writer
-	if enabled {
-		lw = os.Stderr
-	} else {
-		lw = io.Discard
-	}
-
-	return log.New(lw, "["+section+"] ", log.LstdFlags)
-}
-
-func runNet(ctx context.Context, rootClient *controller.Client, ncfg config.Net) error {
-	netClient, err := rootClient.Copy(ctx)
-	if err != nil {
-		return err
-	}
-
-	netLog := makeLog("net", ncfg.Log)
-	netSrv := netsrv.New(netLog, ncfg.Host, netClient)
-	netSrv.Run(ctx)
-	return nil
+// subcommands maps each yaps subcommand word to the function implementing it.
+// Running yaps without a known subcommand starts the server.
+var subcommands = map[string]func(args []string) error{
+	"record":         runRecord,
+	"replay-wire":    runReplayWire,
+	"export-history": runExportHistory,
+	"clone":          runClone,
+	"config":         runConfig,
+	"init":           runInit,
+	"secrets-keygen": runSecretsKeygen,
+	"seal-secret":    runSealSecret,
+	"selftest":       runSelftest,
+	"ctl":            runCtl,
 }
 
-func runConsole(ctx context.Context, rootClient *controller.Client, ccfg config.Console) error {
-	consoleClient, err := rootClient.Copy(ctx)
-	if err != nil {
-		return err
+func main() {
+	if 1 < len(os.Args) {
+		if arg := os.Args[1]; arg == "--version" || arg == "-version" {
+			fmt.Println(version.Get())
+			return
+		}
+		if sc, ok := subcommands[os.Args[1]]; ok {
+			if err := sc(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", os.Args[1], err.Error())
+				os.Exit(1)
+			}
+			return
+		}
 	}
 
-	con, err := console.New(ctx, consoleClient)
-	if err != nil {
-		return err
-	}
-	return con.Run(ctx)
+	runServer()
 }
 
-func main() {
-	ctx, cancel := context.WithCancel(context.Background())
-
-	rootLog := makeLog("root", true)
+// runServer runs the yaps server proper, from yaps.toml, until interrupted.
+func runServer() {
+	rootLog := server.NewLogger("root", true)
 
 	cfile := "yaps.toml"
-	conf, err := config.Parse(cfile)
+	profile := os.Getenv(config.ProfileEnv)
+	if profile != "" {
+		rootLog.Printf("using profile %s\n", profile)
+	}
+	conf, err := config.ParseProfile(cfile, profile)
 	if err != nil {
 		rootLog.Printf("couldn't open config: %v\n", err)
 		return
 	}
 
-	interrupt := make(chan os.Signal, 1)
-	signal.Notify(interrupt, os.Interrupt)
-
-	var errg errgroup.Group
-
-	if len(conf.Lists) != 1 {
-		rootLog.Printf("FIXME: must have precisely one configured list, got %d\n", len(conf.Lists))
+	srv, err := server.New(conf)
+	if err != nil {
+		rootLog.Printf("%v\n", err)
 		return
 	}
-	// lstConf := conf.Lists[0]
-
-	lst := list.New()
-	lstCon, rootClient := controller.NewController(lst)
-	errg.Go(func() error {
-		lstCon.Run(ctx)
-		rootLog.Println("list controller closing")
-		return nil
-	})
-
-	if conf.Net.Enabled {
-		errg.Go(func() error {
-			err := runNet(ctx, rootClient, conf.Net)
-			if err != nil {
-				err = fmt.Errorf("netsrv error: %w", err)
-			}
-			rootLog.Println("netsrv closing")
-			return err
-		})
-	}
 
-	if conf.Console.Enabled {
-		errg.Go(func() error {
-			err := runConsole(ctx, rootClient, conf.Console)
-			if err != nil {
-				err = fmt.Errorf("console error: %w", err)
-			}
-			rootLog.Println("console closing")
-			return err
-		})
-	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 
-	mainLoop(rootClient, interrupt, ctx, rootLog)
-	cancel()
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		// Ctrl-C, so gracefully shut down.
+		<-interrupt
+		cancel()
+		for range interrupt {
+			rootLog.Println("already shutting down")
+		}
+	}()
 
-	rootLog.Println("Waiting for subsystems to shut down...")
-	if err := errg.Wait(); err != nil {
+	if err := srv.Run(ctx); err != nil {
 		rootLog.Printf("main subsystem error: %s", err.Error())
 	}
-	rootLog.Println("It's now safe to turn off your yaps.")
-}
-
-func mainLoop(rootClient *controller.Client, interrupt chan os.Signal, ctx context.Context, rootLog *log.Logger) {
-	running := true
-	for running {
-		select {
-		case _, running = <-rootClient.Rx:
-			// Accept, but ignore, all messages from the root client.
-			// Start closing yaps if the client has closed.
-		case <-interrupt:
-			// Ctrl-C, so gracefully shut down.
-			if err := rootClient.Shutdown(ctx); err != nil {
-				rootLog.Println("couldn't shut down gracefully:", err)
-			}
-		}
-	}
 }
@@ -0,0 +1,115 @@
+package netsrv
+
+// File addrs.go contains address filters, which restrict the addresses each listener accepts connections from.
+//
+// A listener with an address filter checks each connection as soon as it accepts it, before greeting it or working out
+// what it speaks; those from addresses the filter refuses are logged, counted as 'refused', and hung up on at once.
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// AddressFilter decides which remote addresses a listener accepts connections from.
+// The nil AddressFilter accepts every address.
+type AddressFilter struct {
+	// allow, if not empty, holds the only networks accepted.
+	allow []*net.IPNet
+	// deny holds the networks refused, even if they are in allow.
+	deny []*net.IPNet
+}
+
+// NewAddressFilter makes an AddressFilter accepting the networks in allow, or every network if allow is empty, except
+// those in deny.
+// Networks are in CIDR notation, such as '10.1.2.0/24', or single addresses.
+// It returns nil if the filter would accept every address, and fails if any network is malformed.
+func NewAddressFilter(allow, deny []string) (*AddressFilter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	var (
+		f   AddressFilter
+		err error
+	)
+	if f.allow, err = parseNetworks(allow); err != nil {
+		return nil, fmt.Errorf("allow: %w", err)
+	}
+	if f.deny, err = parseNetworks(deny); err != nil {
+		return nil, fmt.Errorf("deny: %w", err)
+	}
+	return &f, nil
+}
+
+// parseNetworks parses each of nets as a network in CIDR notation or a single address.
+func parseNetworks(nets []string) ([]*net.IPNet, error) {
+	ns := make([]*net.IPNet, 0, len(nets))
+	for _, n := range nets {
+		if !strings.Contains(n, "/") {
+			ip := net.ParseIP(n)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q", n)
+			}
+			bits := 8 * net.IPv4len
+			if ip.To4() == nil {
+				bits = 8 * net.IPv6len
+			}
+			ns = append(ns, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, ipn, err := net.ParseCIDR(n)
+		if err != nil {
+			return nil, err
+		}
+		ns = append(ns, ipn)
+	}
+	return ns, nil
+}
+
+// Accepts checks whether f accepts connections from addr.
+// Addresses that aren't IP addresses are only accepted by the nil filter.
+func (f *AddressFilter) Accepts(addr net.Addr) bool {
+	if f == nil {
+		return true
+	}
+	var ip net.IP
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		ip = a.IP
+	case *net.UDPAddr:
+		ip = a.IP
+	case *net.IPAddr:
+		ip = a.IP
+	default:
+		return false
+	}
+	return !containsIP(f.deny, ip) && (len(f.allow) == 0 || containsIP(f.allow, ip))
+}
+
+// containsIP checks whether any of nets contains ip.
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetAddressFilters sets the filters restricting the addresses that clients of the main listener and the
+// compatibility listener (see SetCompat) may connect from; nil, the default, accepts every address.
+// It must be called before Run.
+func (s *Server) SetAddressFilters(main, compat *AddressFilter) {
+	s.addrs = main
+	s.compatAddrs = compat
+}
+
+// refuseAddress logs, and counts, a connection on conn from an address the listener ln's filter refuses, and hangs
+// up on it without a word.
+func (s *Server) refuseAddress(ln net.Listener, conn net.Conn) {
+	s.log.Printf("refusing %s on %s: address not allowed\n", conn.RemoteAddr(), ln.Addr())
+	netMetrics.Add("refused", 1)
+	if err := conn.Close(); err != nil {
+		s.log.Printf("error closing connection %s: %s\n", conn.RemoteAddr(), err.Error())
+	}
+}
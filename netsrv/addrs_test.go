@@ -0,0 +1,70 @@
+package netsrv_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/netsrv"
+)
+
+// TestAddressFilter_Accepts tests AddressFilter.Accepts on various filters and addresses.
+func TestAddressFilter_Accepts(t *testing.T) {
+	cases := []struct {
+		name        string
+		allow, deny []string
+		ip          string
+		want        bool
+	}{
+		{"empty", nil, nil, "192.0.2.1", true},
+		{"allowed network", []string{"10.1.2.0/24"}, nil, "10.1.2.99", true},
+		{"outside allowed network", []string{"10.1.2.0/24"}, nil, "10.1.3.1", false},
+		{"allowed address", []string{"10.1.2.3"}, nil, "10.1.2.3", true},
+		{"outside allowed address", []string{"10.1.2.3"}, nil, "10.1.2.4", false},
+		{"denied network", nil, []string{"192.0.2.0/24"}, "192.0.2.1", false},
+		{"outside denied network", nil, []string{"192.0.2.0/24"}, "198.51.100.1", true},
+		{"deny beats allow", []string{"10.0.0.0/8"}, []string{"10.1.0.0/16"}, "10.1.2.3", false},
+		{"ipv6", []string{"2001:db8::/32"}, nil, "2001:db8::1", true},
+		{"ipv4-mapped", []string{"127.0.0.0/8"}, nil, "::ffff:127.0.0.1", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			f, err := netsrv.NewAddressFilter(c.allow, c.deny)
+			if err != nil {
+				t.Fatalf("NewAddressFilter failed: %v", err)
+			}
+			addr := &net.TCPAddr{IP: net.ParseIP(c.ip), Port: 1350}
+			if got := f.Accepts(addr); got != c.want {
+				t.Errorf("Accepts(%s) = %v, want %v", c.ip, got, c.want)
+			}
+		})
+	}
+}
+
+// TestNewAddressFilter_invalid tests that NewAddressFilter rejects malformed networks.
+func TestNewAddressFilter_invalid(t *testing.T) {
+	for _, n := range []string{"", "studio", "10.1.2.0/33", "10.1.2.256"} {
+		if _, err := netsrv.NewAddressFilter([]string{n}, nil); err == nil {
+			t.Errorf("NewAddressFilter accepted %q", n)
+		}
+	}
+}
+
+// TestServer_SetAddressFilters tests that a Server hangs up, without greeting them, on clients its address filter
+// refuses.
+func TestServer_SetAddressFilters(t *testing.T) {
+	f, err := netsrv.NewAddressFilter(nil, []string{"127.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatalf("NewAddressFilter failed: %v", err)
+	}
+
+	address, stop := startServer(t, func(srv *netsrv.Server) {
+		srv.SetAddressFilters(f, nil)
+	})
+	defer stop()
+
+	conn, r := dialServer(t, address)
+	defer conn.Close()
+	if line, err := r.ReadString('\n'); err == nil {
+		t.Errorf("refused client got %q, want to be hung up on", line)
+	}
+}
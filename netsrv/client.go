@@ -5,6 +5,7 @@ import (
 	"errors"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/MattWindsor91/yaps/controller"
 	"github.com/UniversityRadioYork/bifrost-go/comm"
@@ -24,6 +25,15 @@ type Client struct {
 
 	// ioClient is the underlying Bifrost-level client.
 	ioClient *comm.IoEndpoint
+
+	// bifrost is the client's Bifrost adapter.
+	bifrost *controller.Bifrost
+
+	// idle tracks how long the client has been idle, or is nil if it may idle forever.
+	idle *idleState
+
+	// since is when the client connected.
+	since time.Time
 }
 
 // Close closes the given client.
@@ -42,11 +52,15 @@ func (c *Client) Run(ctx context.Context, bf *controller.Bifrost, hangUp chan<-
 
 	go func() {
 		c.ioClient.Run(ctx, errCh)
+		// The connection may have died with messages still on their way to it, and the adapter can't stop until
+		// they're gone.
+		for range c.ioClient.Endpoint.Rx {
+		}
 		wg.Done()
 	}()
 
 	go func() {
-		c.handleIoErrors(errCh, hangUp)
+		c.handleIoErrors(ctx, errCh, hangUp)
 		wg.Done()
 	}()
 
@@ -60,10 +74,14 @@ func (c *Client) Run(ctx context.Context, bf *controller.Bifrost, hangUp chan<-
 
 // handleIoErrors monitors errCh for errors, forwarding any hangup requests coming through to hangUp and logging all
 // other errors.
-func (c *Client) handleIoErrors(errCh <-chan error, hangUp chan<- *Client) {
+// Hangups are dropped once ctx is cancelled, as the server hangs up every client itself when it stops.
+func (c *Client) handleIoErrors(ctx context.Context, errCh <-chan error, hangUp chan<- *Client) {
 	for err := range errCh {
 		if errors.Is(err, comm.HungUpError) {
-			hangUp <- c
+			select {
+			case hangUp <- c:
+			case <-ctx.Done():
+			}
 		} else {
 			c.outputError(err)
 		}
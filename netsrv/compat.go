@@ -0,0 +1,31 @@
+package netsrv
+
+// File compat.go contains the compatibility listener, for clients that speak an older dialect of Bifrost (see
+// controller.Dialect) and can't yet be moved to the current one.
+//
+// Everything about the listener's clients is as for any other client, except that their adapters translate between
+// the dialect and the current protocol.
+
+import (
+	"net"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// accepted is a connection accepted by one of the Server's listeners.
+type accepted struct {
+	// conn is the connection.
+	conn net.Conn
+	// dialect is the dialect the connection's client speaks, or nil for the current protocol.
+	dialect *controller.Dialect
+	// words, if not nil, restricts the request words the connection's client may send.
+	words *controller.WordFilter
+}
+
+// SetCompat makes s also listen on host for clients that speak dialect; an empty host, the default, means that s
+// doesn't.
+// It must be called before Run.
+func (s *Server) SetCompat(host string, dialect *controller.Dialect) {
+	s.compatHost = host
+	s.compatDialect = dialect
+}
@@ -0,0 +1,113 @@
+package netsrv
+
+// File duplicate.go contains the duplicate-login policy, which stops one user ending up in control of the list from
+// two places at once, such as a studio PC and a laptop left logged in, without realising it.
+//
+// Whenever a client logs in as a user that is already logged in on another connection, the Server applies its
+// policy:
+//
+//   - 'allow', the default, does nothing;
+//   - 'warn' sends every one of the user's connections '! DUPLICATE <user> <connection> warn -', where the
+//     connection is the one that just logged in;
+//   - 'kick-oldest' hangs up on the user's other connections, so that only the one that logged in last is left, and
+//     sends it '! DUPLICATE <user> <connection> kick-oldest <kicked>' for each connection it hung up on.
+
+import (
+	"fmt"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+)
+
+// RsDuplicate is the word of messages telling a user's connections that the user has logged in more than once.
+const RsDuplicate = "DUPLICATE"
+
+// DuplicatePolicy is what a Server does when a user logs in on more than one connection at once.
+type DuplicatePolicy string
+
+const (
+	// DuplicateAllow lets users log in on as many connections as they like.
+	DuplicateAllow DuplicatePolicy = "allow"
+	// DuplicateWarn lets users log in on many connections, but tells each of them when it happens.
+	DuplicateWarn DuplicatePolicy = "warn"
+	// DuplicateKickOldest hangs up on a user's other connections whenever the user logs in again.
+	DuplicateKickOldest DuplicatePolicy = "kick-oldest"
+)
+
+// ParseDuplicatePolicy parses the duplicate-login policy s; an empty s is DuplicateAllow.
+func ParseDuplicatePolicy(s string) (DuplicatePolicy, error) {
+	switch p := DuplicatePolicy(s); p {
+	case "":
+		return DuplicateAllow, nil
+	case DuplicateAllow, DuplicateWarn, DuplicateKickOldest:
+		return p, nil
+	default:
+		return "", fmt.Errorf("unknown duplicate-login policy %q: must be allow, warn or kick-oldest", s)
+	}
+}
+
+// SetDuplicatePolicy sets what s does when a user logs in on more than one connection at once.
+// It must be called before Run.
+func (s *Server) SetDuplicatePolicy(p DuplicatePolicy) {
+	s.duplicatePolicy = p
+}
+
+// DuplicateMessage creates a DUPLICATE message with tag tag, saying that user logged in on conn, and that the
+// Server applied policy p, hanging up on kicked (which is empty if it didn't hang up on anything).
+func DuplicateMessage(tag, user, conn string, p DuplicatePolicy, kicked string) *message.Message {
+	if kicked == "" {
+		kicked = "-"
+	}
+	return message.New(tag, RsDuplicate).AddArgs(user, conn, string(p), kicked)
+}
+
+// loggedIn tells s, from any goroutine, that the client c just logged in.
+func (s *Server) loggedIn(c Client) {
+	select {
+	case s.clientLogin <- c:
+	case <-s.done:
+	}
+}
+
+// checkDuplicates applies s's duplicate-login policy to the client c, which just logged in.
+func (s *Server) checkDuplicates(c Client) {
+	if s.duplicatePolicy == "" || s.duplicatePolicy == DuplicateAllow {
+		return
+	}
+	if _, ok := s.clients[c]; !ok {
+		return
+	}
+	id, ok := c.bifrost.Identity()
+	if !ok {
+		return
+	}
+
+	var sessions []Client
+	for o := range s.clients {
+		if oid, ok := o.bifrost.Identity(); ok && oid.User == id.User {
+			sessions = append(sessions, o)
+		}
+	}
+	if len(sessions) < 2 {
+		return
+	}
+	s.log.Printf("%s logged in on %d connections, latest %s; applying policy %s\n", id.User, len(sessions), c.name,
+		s.duplicatePolicy)
+
+	switch s.duplicatePolicy {
+	case DuplicateWarn:
+		m := *DuplicateMessage(message.TagBcast, id.User, c.name, DuplicateWarn, "")
+		for _, o := range sessions {
+			o.bifrost.Announce(m)
+		}
+	case DuplicateKickOldest:
+		// The oldest login is any but c's, whenever their connections were made.
+		for _, o := range sessions {
+			if o == c {
+				continue
+			}
+			o := o
+			s.hangUpClient(&o)
+			c.bifrost.Announce(*DuplicateMessage(message.TagBcast, id.User, c.name, DuplicateKickOldest, o.name))
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package netsrv_test
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/netsrv"
+)
+
+// TestParseDuplicatePolicy tests ParseDuplicatePolicy on each policy, the default, and nonsense.
+func TestParseDuplicatePolicy(t *testing.T) {
+	for in, want := range map[string]netsrv.DuplicatePolicy{
+		"":            netsrv.DuplicateAllow,
+		"allow":       netsrv.DuplicateAllow,
+		"warn":        netsrv.DuplicateWarn,
+		"kick-oldest": netsrv.DuplicateKickOldest,
+	} {
+		if got, err := netsrv.ParseDuplicatePolicy(in); err != nil || got != want {
+			t.Errorf("ParseDuplicatePolicy(%q) = %q, %v; want %q", in, got, err, want)
+		}
+	}
+	if _, err := netsrv.ParseDuplicatePolicy("kick-newest"); err == nil {
+		t.Error("ParseDuplicatePolicy(kick-newest) succeeded, want an error")
+	}
+}
+
+// TestServer_DuplicateWarn tests that a Server with the warn policy tells every one of a user's connections when the
+// user logs in twice.
+func TestServer_DuplicateWarn(t *testing.T) {
+	testDuplicate(t, netsrv.DuplicateWarn, func(t *testing.T, older, newer *bufio.Reader, newConn net.Conn) {
+		for name, r := range map[string]*bufio.Reader{"old": older, "new": newer} {
+			got := strings.Fields(readUntil(t, r, netsrv.RsDuplicate))
+			if want := []string{"!", netsrv.RsDuplicate, "ali", newConn.LocalAddr().String(), "warn", "-"}; strings.Join(got, " ") != strings.Join(want, " ") {
+				t.Errorf("%s connection got %v, want %v", name, got, want)
+			}
+		}
+	})
+}
+
+// TestServer_DuplicateKickOldest tests that a Server with the kick-oldest policy hangs up on a user's older
+// connection when the user logs in again, and tells the newer one.
+func TestServer_DuplicateKickOldest(t *testing.T) {
+	testDuplicate(t, netsrv.DuplicateKickOldest, func(t *testing.T, older, newer *bufio.Reader, newConn net.Conn) {
+		got := strings.Fields(readUntil(t, newer, netsrv.RsDuplicate))
+		if len(got) != 6 || got[4] != "kick-oldest" || got[5] == "-" {
+			t.Errorf("new connection got %v, want a kick", got)
+		}
+		for {
+			if _, err := older.ReadString('\n'); errors.Is(err, io.EOF) {
+				break
+			} else if err != nil {
+				t.Fatalf("old connection got %v, want a hangup", err)
+			}
+		}
+	})
+}
+
+// TestServer_DuplicateKickOldest_loginOrder tests that a Server with the kick-oldest policy keeps the connection that
+// logged in last, even if it connected first.
+func TestServer_DuplicateKickOldest_loginOrder(t *testing.T) {
+	address, stop := startServer(t, func(srv *netsrv.Server) {
+		srv.SetAuth(auth.Static{"one": {User: "ali"}, "two": {User: "ali"}})
+		srv.SetDuplicatePolicy(netsrv.DuplicateKickOldest)
+	})
+	defer stop()
+
+	first, fr := dialServer(t, address)
+	defer first.Close()
+	readUntil(t, fr, "IAMA")
+	second, sr := dialServer(t, address)
+	defer second.Close()
+	readUntil(t, sr, "IAMA")
+
+	logIn(t, second, sr, "two")
+	logIn(t, first, fr, "one")
+
+	got := strings.Fields(readUntil(t, fr, netsrv.RsDuplicate))
+	if want := second.LocalAddr().String(); len(got) != 6 || got[3] != first.LocalAddr().String() || got[5] != want {
+		t.Errorf("first connection got %v, want a kick of %s", got, want)
+	}
+	for {
+		if _, err := sr.ReadString('\n'); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			t.Fatalf("second connection got %v, want a hangup", err)
+		}
+	}
+}
+
+// testDuplicate logs two connections in as the same user on a Server with policy p, then runs check on them.
+func testDuplicate(t *testing.T, p netsrv.DuplicatePolicy, check func(t *testing.T, older, newer *bufio.Reader, newConn net.Conn)) {
+	t.Helper()
+	address, stop := startServer(t, func(srv *netsrv.Server) {
+		srv.SetAuth(auth.Static{"one": {User: "ali"}, "two": {User: "ali"}})
+		srv.SetDuplicatePolicy(p)
+	})
+	defer stop()
+
+	login := func(token string) (net.Conn, *bufio.Reader) {
+		conn, r := dialServer(t, address)
+		logIn(t, conn, r, token)
+		return conn, r
+	}
+	oldConn, older := login("one")
+	defer oldConn.Close()
+	newConn, newer := login("two")
+	defer newConn.Close()
+
+	check(t, older, newer, newConn)
+}
+
+// logIn logs conn, whose replies r reads, in with token.
+func logIn(t *testing.T, conn net.Conn, r *bufio.Reader, token string) {
+	t.Helper()
+	if _, err := io.WriteString(conn, "l1 login token "+token+"\n"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	readUntil(t, r, controller.RsIdent)
+}
@@ -0,0 +1,97 @@
+package netsrv
+
+// File hub.go contains the hub link: a connection that the Server dials out to a central hub, rather than accepting,
+// for yaps instances behind NAT or firewalls that the hub can't reach.
+//
+// Once connected, the hub is just another client: it gets the same Bifrost session, including logging in, as any
+// connection the Server accepts.
+// The link redials whenever the connection drops, waiting longer after each failure, up to a limit.
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// hubRetryMin is how long the Server waits before its first attempt to redial the hub.
+	hubRetryMin = time.Second
+	// hubRetryMax is the longest the Server waits between attempts to redial the hub.
+	hubRetryMax = 30 * time.Second
+)
+
+// Dialer is the type of functions that connect to a hub at address.
+type Dialer func(ctx context.Context, address string) (net.Conn, error)
+
+// SetHub sets the address of a hub that s dials out to and serves, and how to dial it; an empty address, the default,
+// means that s doesn't dial out.
+// It must be called before Run.
+func (s *Server) SetHub(address string, dial Dialer) {
+	s.hub = address
+	s.dialHub = dial
+}
+
+// hubConn is a connection to the hub that can report when it closes.
+type hubConn struct {
+	net.Conn
+
+	// closed is closed when the connection is.
+	closed chan struct{}
+	// once makes sure that closed is only closed once.
+	once sync.Once
+}
+
+// Close closes the connection, and reports that it has closed.
+func (c *hubConn) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return c.Conn.Close()
+}
+
+// linkHub keeps s connected to its hub until ctx is cancelled or s stops, handing each connection to the main loop.
+func (s *Server) linkHub(ctx context.Context) {
+	delay := hubRetryMin
+	for {
+		conn, err := s.dialHub(ctx, s.hub)
+		if err == nil {
+			delay = hubRetryMin
+			if !s.serveHub(conn) {
+				return
+			}
+			s.log.Println("lost hub:", s.hub)
+		} else {
+			s.log.Printf("couldn't reach hub %s: %s\n", s.hub, err.Error())
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return
+		case <-s.done:
+			return
+		}
+		if delay *= 2; hubRetryMax < delay {
+			delay = hubRetryMax
+		}
+	}
+}
+
+// serveHub hands conn to the main loop, and waits for it to close.
+// It returns false if s stopped first.
+func (s *Server) serveHub(conn net.Conn) bool {
+	hc := &hubConn{Conn: conn, closed: make(chan struct{})}
+	select {
+	case s.hubConn <- hc:
+	case <-s.done:
+		_ = conn.Close()
+		return false
+	}
+	s.log.Println("connected to hub:", s.hub)
+
+	select {
+	case <-hc.closed:
+		return true
+	case <-s.done:
+		return false
+	}
+}
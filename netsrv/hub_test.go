@@ -0,0 +1,98 @@
+package netsrv_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/netsrv"
+)
+
+// acceptHub accepts the Server's connection to the hub listening on ln, and checks that it greets the hub.
+func acceptHub(t *testing.T, ln net.Listener) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	// A Server that never dials should fail the test, not hang it.
+	if dl, ok := ln.(interface{ SetDeadline(time.Time) error }); ok {
+		_ = dl.SetDeadline(time.Now().Add(5 * time.Second))
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatalf("accept failed: %v", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(conn)
+	for _, want := range []string{"OHAI", "IAMA"} {
+		readUntil(t, r, want)
+	}
+	return conn, r
+}
+
+// readUntil reads lines from r until one has the word word, and returns that line.
+func readUntil(t *testing.T, r *bufio.Reader, word string) string {
+	t.Helper()
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read failed waiting for %s: %v", word, err)
+		}
+		if fields := strings.Fields(line); 2 <= len(fields) && fields[1] == word {
+			return line
+		}
+	}
+}
+
+// TestServer_Hub tests that a Server with a hub dials out to it, makes it log in, and redials when it hangs up.
+func TestServer_Hub(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+
+	con, cli := controller.NewController(list.New())
+	go con.Run(ctx)
+
+	srv := netsrv.New(log.New(io.Discard, "", 0), "", cli)
+	srv.SetAuth(auth.Static{"sesame": {User: "hub"}})
+	var d net.Dialer
+	srv.SetHub(ln.Addr().String(), func(ctx context.Context, address string) (net.Conn, error) {
+		return d.DialContext(ctx, "tcp", address)
+	})
+	done := make(chan struct{})
+	go func() {
+		srv.Run(ctx)
+		close(done)
+	}()
+
+	conn, r := acceptHub(t, ln)
+	if _, err := io.WriteString(conn, "d1 dump\n"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if got := readUntil(t, r, "ACK"); !strings.Contains(got, "WHAT") {
+		t.Errorf("dump before login got %q, want an error", got)
+	}
+	if _, err := io.WriteString(conn, "l1 login token sesame\n"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if got := readUntil(t, r, "IDENT"); !strings.Contains(got, "hub") {
+		t.Errorf("login got %q, want IDENT hub", got)
+	}
+	_ = conn.Close()
+
+	conn, _ = acceptHub(t, ln)
+	_ = conn.Close()
+
+	cancel()
+	<-done
+}
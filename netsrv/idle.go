@@ -0,0 +1,127 @@
+package netsrv
+
+// File idle.go contains the idle timeout, which reclaims connections from clients that have been forgotten about.
+//
+// A client that sends nothing for the idle timeout is hung up on.
+// If there is a warning period, the client first gets '! IDLE <seconds>', saying how long it has left to send
+// something; anything at all, such as 'time', will do.
+// Clients that have declared themselves read-only displays (see controller.RqDisplay), and the hub, are never hung up
+// on for being idle.
+
+import (
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/clock"
+)
+
+const (
+	// RsIdle is the word of messages warning clients that they will soon be hung up on for being idle.
+	RsIdle = "IDLE"
+
+	// idleChecks is how many times the Server checks for idle clients per idle timeout.
+	idleChecks = 20
+)
+
+// SetIdleTimeout sets how long clients may send nothing before s hangs up on them, and how long before that s warns
+// them; a timeout of 0, the default, means that s never does.
+// It must be called before Run.
+func (s *Server) SetIdleTimeout(timeout, warning time.Duration) {
+	s.idleTimeout = timeout
+	s.idleWarning = warning
+}
+
+// SetClock sets where s gets the time, such as for idle timeouts; the default is clock.Real.
+// It must be called before Run.
+func (s *Server) SetClock(clk clock.Clock) {
+	s.clock = clk
+}
+
+// IdleMessage creates an IDLE message with tag tag, warning that the client will be hung up on after left.
+func IdleMessage(tag string, left time.Duration) *message.Message {
+	return message.New(tag, RsIdle).AddArgs(strconv.Itoa(int(left.Round(time.Second).Seconds())))
+}
+
+// idleState tracks how long a client has been idle.
+type idleState struct {
+	// clock is where the client's connection gets the time.
+	clock clock.Clock
+	// last is when the client last sent anything, in Unix nanoseconds.
+	// It is set by the client's connection and read by the main goroutine.
+	last atomic.Int64
+	// warned is true if the client has been warned since it last sent anything.
+	// Only the main goroutine touches it.
+	warned bool
+}
+
+// newIdleState makes an idleState for a client that has just connected.
+func newIdleState(clk clock.Clock) *idleState {
+	i := idleState{clock: clk}
+	i.touch()
+	return &i
+}
+
+// touch records that the client has just sent something.
+func (i *idleState) touch() {
+	i.last.Store(i.clock.Now().UnixNano())
+}
+
+// idleFor gets how long, at now, the client has been idle.
+func (i *idleState) idleFor(now time.Time) time.Duration {
+	return now.Sub(time.Unix(0, i.last.Load()))
+}
+
+// activityConn is a connection that records when anything arrives on it.
+type activityConn struct {
+	net.Conn
+
+	// idle is the idle state of the connection's client.
+	idle *idleState
+}
+
+// Read reads from the connection, recording any activity.
+func (c activityConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if 0 < n {
+		c.idle.touch()
+	}
+	return n, err
+}
+
+// idleTick gets a channel on which s should check for idle clients, and a function that stops it.
+// The channel is nil if s has no idle timeout.
+func (s *Server) idleTick() (<-chan time.Time, func()) {
+	if s.idleTimeout <= 0 {
+		return nil, func() {}
+	}
+	ticker := s.clock.NewTicker(s.idleTimeout / idleChecks)
+	return ticker.C(), ticker.Stop
+}
+
+// checkIdle, at now, warns clients nearing the idle timeout, and hangs up on those past it.
+func (s *Server) checkIdle(now time.Time) {
+	for c := range s.clients {
+		if c.idle == nil || c.bifrost.IsDisplay() {
+			continue
+		}
+
+		idle := c.idle.idleFor(now)
+		left := s.idleTimeout - idle
+		switch {
+		case left <= 0:
+			s.log.Printf("%s idle for %s\n", c.name, idle.Round(time.Second))
+			c := c
+			s.hangUpClient(&c)
+		case left <= s.idleWarning:
+			if !c.idle.warned {
+				c.idle.warned = c.bifrost.Announce(*IdleMessage(message.TagBcast, left))
+			}
+		default:
+			c.idle.warned = false
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package netsrv_test
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/netsrv"
+)
+
+// freeAddress gets an address on which nothing is listening, for a Server to listen on.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// dialServer connects to the Server at address, retrying while it starts up.
+func dialServer(t *testing.T, address string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	for i := 0; ; i++ {
+		conn, err := net.Dial("tcp", address)
+		if err == nil {
+			_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+			return conn, bufio.NewReader(conn)
+		}
+		if 50 < i {
+			t.Fatalf("dial failed: %v", err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// startServer runs a Server over an empty list on a free address, letting configure (if not nil) set it up first.
+// It returns the address and a function that stops the Server and its Controller, and waits for the Server to finish.
+func startServer(t *testing.T, configure func(*netsrv.Server)) (address string, stop func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	con, cli := controller.NewController(list.New())
+	go con.Run(ctx)
+
+	address = freeAddress(t)
+	srv := netsrv.New(log.New(io.Discard, "", 0), address, cli)
+	if configure != nil {
+		configure(srv)
+	}
+	done := make(chan struct{})
+	go func() {
+		srv.Run(ctx)
+		close(done)
+	}()
+	return address, func() {
+		cancel()
+		<-done
+	}
+}
+
+// TestServer_IdleTimeout tests that a Server warns idle clients and then hangs up on them, unless they are displays.
+func TestServer_IdleTimeout(t *testing.T) {
+	address, stop := startServer(t, func(srv *netsrv.Server) {
+		srv.SetIdleTimeout(400*time.Millisecond, 200*time.Millisecond)
+	})
+	defer stop()
+
+	idler, ir := dialServer(t, address)
+	defer idler.Close()
+	display, dr := dialServer(t, address)
+	defer display.Close()
+
+	if _, err := io.WriteString(display, "d1 display\n"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	readUntil(t, dr, "ACK")
+
+	readUntil(t, ir, netsrv.RsIdle)
+	for {
+		if _, err := ir.ReadString('\n'); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("idle client got %v, want hangup", err)
+		}
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if _, err := io.WriteString(display, "t1 time\n"); err != nil {
+		t.Fatalf("display write failed: %v", err)
+	}
+	readUntil(t, dr, controller.RsTime)
+}
@@ -0,0 +1,87 @@
+package netsrv
+
+// File pool.go contains the worker pool, which caps the goroutines the Server runs for its clients, so that churning
+// connections can't grow them without bound on a small machine.
+//
+// Each client takes connGoroutines goroutines for its adapter and connection for as long as it stays connected, and
+// each connection being sniffed (see sniff.go) takes one more while it is.
+// When the pool can't spare them, the Server degrades by turning the connection away with '! BUSY' rather than
+// starting goroutines it has no room for; the client can try again once others have gone.
+// The hub is ours, so it is never turned away, and doesn't count against the ceiling.
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+)
+
+const (
+	// RsBusy is the word of messages telling clients that the server has no room for them.
+	RsBusy = "BUSY"
+
+	// connGoroutines is how many goroutines each client runs on: its own, the adapter and its forwarder, the
+	// connection's reader and writer and their supervisor, and the connection's error handler.
+	connGoroutines = 7
+
+	// busyWriteTimeout is how long the Server spends telling a client it is busy before giving up on it.
+	busyWriteTimeout = time.Second
+)
+
+// SetMaxGoroutines sets the most goroutines s runs for its clients at once; 0, the default, means that there is no
+// limit.
+// It must be called before Run.
+func (s *Server) SetMaxGoroutines(n int) {
+	s.workers.ceiling = n
+}
+
+// workerPool counts the goroutines the Server runs for its clients against a ceiling.
+// It is safe to use from many goroutines.
+type workerPool struct {
+	// ceiling is the most goroutines allowed at once, or 0 if there is no limit.
+	ceiling int
+	// mu guards used.
+	mu sync.Mutex
+	// used is the number of goroutines running.
+	used int
+}
+
+// acquire takes n goroutines from p, returning false, and taking none, if p can't spare them all.
+func (p *workerPool) acquire(n int) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if 0 < p.ceiling && p.ceiling < p.used+n {
+		return false
+	}
+	p.used += n
+	return true
+}
+
+// release gives n goroutines back to p.
+func (p *workerPool) release(n int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.used -= n
+}
+
+// inUse gets the number of goroutines taken from p.
+func (p *workerPool) inUse() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.used
+}
+
+// refuseBusy tells the client on conn that s has no room for it, and hangs up.
+func (s *Server) refuseBusy(conn net.Conn) {
+	s.log.Printf("turning away %s: %d goroutines of %d in use\n", conn.RemoteAddr(), s.workers.inUse(), s.workers.ceiling)
+	netMetrics.Add("busy", 1)
+
+	_ = conn.SetWriteDeadline(time.Now().Add(busyWriteTimeout))
+	if line, err := message.New(message.TagBcast, RsBusy).Pack(); err == nil {
+		_, _ = conn.Write(line)
+	}
+	if err := conn.Close(); err != nil {
+		s.log.Printf("error closing connection %s: %s\n", conn.RemoteAddr(), err.Error())
+	}
+}
@@ -0,0 +1,49 @@
+package netsrv_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/netsrv"
+)
+
+// TestServer_SetMaxGoroutines tests that a Server turns away clients it has no goroutines for, and takes them again
+// once others have gone.
+func TestServer_SetMaxGoroutines(t *testing.T) {
+	address, stop := startServer(t, func(srv *netsrv.Server) {
+		// Room for one client, but not two.
+		srv.SetMaxGoroutines(10)
+	})
+	defer stop()
+
+	first, r := dialServer(t, address)
+	readUntil(t, r, "IAMA")
+
+	second, r2 := dialServer(t, address)
+	if got := readUntil(t, r2, netsrv.RsBusy); !strings.HasPrefix(got, "! ") {
+		t.Errorf("second client got %q, want a broadcast", got)
+	}
+	if _, err := r2.ReadString('\n'); err == nil {
+		t.Error("second client wasn't hung up on")
+	}
+	second.Close()
+
+	first.Close()
+	// The first client's goroutines come back once the server notices it has gone, which may take a few tries.
+	for i := 0; ; i++ {
+		third, r3 := dialServer(t, address)
+		line, err := r3.ReadString('\n')
+		third.Close()
+		if err != nil {
+			t.Fatalf("third client read failed: %v", err)
+		}
+		if !strings.Contains(line, netsrv.RsBusy) {
+			break
+		}
+		if 50 < i {
+			t.Fatal("server never made room for another client")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
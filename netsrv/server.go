@@ -4,10 +4,15 @@ import (
 	"context"
 	"log"
 	"net"
+	"net/http"
 	"sync"
+	"time"
 
 	"github.com/UniversityRadioYork/bifrost-go/comm"
+	"github.com/UniversityRadioYork/bifrost-go/message"
 
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/clock"
 	"github.com/MattWindsor91/yaps/controller"
 )
 
@@ -19,22 +24,133 @@ type Server struct {
 	// host is the Server's host:port string.
 	host string
 
+	// words, if not nil, restricts the request words clients of host may send.
+	words *controller.WordFilter
+	// addrs, if not nil, restricts the addresses clients of host may connect from.
+	addrs *AddressFilter
+
+	// normalise is true if the Server NFC-normalises incoming message arguments.
+	normalise bool
+
+	// coalesce is the window within which the Server coalesces broadcasts that supersede each other.
+	coalesce time.Duration
+
+	// regions is the most item broadcasts the Server sends separately in one coalesced flush; 0 means no limit.
+	regions int
+
+	// timeInterval is how often the Server broadcasts its clock; 0 means never.
+	timeInterval time.Duration
+
+	// auth is the provider that checks client logins, or nil if clients don't log in.
+	auth auth.Provider
+
+	// requestTimeout is how long each client request may wait to be handled; 0 means forever.
+	requestTimeout time.Duration
+
+	// slowRequest is how long a client request may take to be acknowledged before the Server logs it; 0 means
+	// forever.
+	slowRequest time.Duration
+
+	// idleTimeout is how long clients may send nothing before the Server hangs up on them; 0 means forever.
+	idleTimeout time.Duration
+
+	// idleWarning is how long before hanging up on an idle client the Server warns it.
+	idleWarning time.Duration
+
+	// clock is where the Server gets the time, such as for idle timeouts.
+	clock clock.Clock
+
+	// sendBuffer is how many messages may wait to be sent to each client; 0 means none may.
+	sendBuffer int
+
+	// bandwidthCap is how many bytes per second each client may send, and be sent; 0 means there is no limit.
+	bandwidthCap int64
+
+	// admins is the group whose members may make admin requests, such as listing clients, or empty if anyone may.
+	admins string
+
+	// deniedHook, if not nil, is called with each request refused because the client wasn't an admin.
+	deniedHook func(cname string, r controller.DeniedRequest)
+
+	// duplicatePolicy is what the Server does when a user logs in on more than one connection at once.
+	duplicatePolicy DuplicatePolicy
+
+	// trafficMu guards traffic.
+	trafficMu sync.Mutex
+
+	// traffic maps the name of each connection to its traffic counts.
+	// Unlike clients, it may be read from any goroutine.
+	traffic map[string]*traffic
+
+	// motd is the message of the day the Server greets clients with, or nil if there is none.
+	motd *controller.Motd
+
+	// tunables, if not nil, are the tunables admins may get and change with 'tune'; see tune.go.
+	tunables *controller.Tunables
+
+	// hub is the host:port string of the hub the Server dials out to, or empty if it doesn't.
+	hub string
+
+	// dialHub is the function the Server uses to dial its hub.
+	dialHub Dialer
+
+	// hubWords, if not nil, restricts the request words the hub may send.
+	hubWords *controller.WordFilter
+
+	// stopHub, if not nil, stops the Server dialling its hub.
+	stopHub context.CancelFunc
+
 	// rootClient is a controller Client the Server can clone for
 	// use by incoming connections.
 	rootClient *controller.Client
+	// rootClosed is true once rootClient's controller has shut down.
+	// Only the main goroutine touches it.
+	rootClosed bool
 
 	// clients is a map containing all connected clients.
 	clients map[Client]struct{}
 
-	// accConn is a channel used by the acceptor goroutine to send new
+	// workers counts the goroutines the Server runs for its clients; see pool.go.
+	workers workerPool
+
+	// compatHost is the host:port string of the Server's compatibility listener, or empty if it has none.
+	compatHost string
+
+	// compatDialect is the dialect clients of the compatibility listener speak.
+	compatDialect *controller.Dialect
+
+	// compatWords, if not nil, restricts the request words clients of the compatibility listener may send.
+	compatWords *controller.WordFilter
+	// compatAddrs, if not nil, restricts the addresses clients of the compatibility listener may connect from.
+	compatAddrs *AddressFilter
+
+	// httpHandler, if not nil, serves the HTTP clients of the Server's main listener; see sniff.go.
+	httpHandler http.Handler
+
+	// httpListener, if not nil, is the listener through which sniffed HTTP connections reach httpHandler.
+	httpListener *connListener
+
+	// listeners holds the Server's open listeners.
+	// Only the main goroutine touches it once Run has started.
+	listeners []net.Listener
+
+	// accepting is true until the Server is told to stop accepting clients.
+	// Only the main goroutine touches it.
+	accepting bool
+
+	// accConn is a channel used by the acceptor goroutines to send new
 	// connections to the main goroutine.
-	accConn chan net.Conn
+	accConn chan accepted
 
-	// accErr is a channel used by the acceptor goroutine to send errors
+	// accErr is a channel used by the acceptor goroutines to send errors
 	// to the main goroutine.
 	// Errors landing from accErr are considered fatal.
 	accErr chan error
 
+	// hubConn is a channel used by the hub goroutine to send new connections
+	// to the hub to the main goroutine.
+	hubConn chan net.Conn
+
 	// clientHangUp is a channel used by client goroutines to send
 	// disconnections to the main goroutine.
 	// It sends a pointer to the client to disconnect.
@@ -45,6 +161,27 @@ type Server struct {
 	// The client will send a hangup request if the error is fatal.
 	clientErr chan error
 
+	// clientLogin is a channel used by client adapters to tell the main goroutine that their clients logged in.
+	clientLogin chan Client
+
+	// stopAccept is a channel used by StopAccepting to ask the main goroutine to stop accepting clients.
+	// The main goroutine closes the channel it sends once it has.
+	stopAccept chan chan struct{}
+
+	// drainClients is a channel used by Drain to ask the main goroutine to drain every client.
+	// The main goroutine replies with the channels that close once each client has drained.
+	drainClients chan chan []<-chan struct{}
+
+	// announce is a channel used by Announce to send messages for every client to the main goroutine.
+	announce chan message.Message
+
+	// adminAnnounce is a channel used by AnnounceAdmins to send messages for every admin client to the main
+	// goroutine.
+	adminAnnounce chan message.Message
+
+	// tune is a channel used by onMain to run functions, such as changes to tunables, on the main goroutine.
+	tune chan func()
+
 	// done is a channel closed when the main loop terminates.
 	// This is used to signal all goroutines to close, if they haven't
 	// already.
@@ -58,28 +195,151 @@ type Server struct {
 // New creates a new network server for a yaps instance.
 func New(l *log.Logger, host string, rc *controller.Client) *Server {
 	return &Server{
-		log:          l,
-		host:         host,
-		rootClient:   rc,
-		accConn:      make(chan net.Conn),
-		accErr:       make(chan error),
-		clientHangUp: make(chan *Client),
-		clientErr:    make(chan error),
-		done:         make(chan struct{}),
-		clients:      make(map[Client]struct{}),
+		log:           l,
+		host:          host,
+		rootClient:    rc,
+		accConn:       make(chan accepted),
+		accErr:        make(chan error),
+		hubConn:       make(chan net.Conn),
+		clientHangUp:  make(chan *Client),
+		clientErr:     make(chan error),
+		clientLogin:   make(chan Client),
+		stopAccept:    make(chan chan struct{}),
+		drainClients:  make(chan chan []<-chan struct{}),
+		announce:      make(chan message.Message),
+		adminAnnounce: make(chan message.Message),
+		tune:          make(chan func()),
+		done:          make(chan struct{}),
+		clients:       make(map[Client]struct{}),
+		traffic:       make(map[string]*traffic),
+		clock:         clock.Real,
+	}
+}
+
+// SetNormalise sets whether s NFC-normalises the arguments of incoming messages.
+// It must be called before Run.
+func (s *Server) SetNormalise(normalise bool) {
+	s.normalise = normalise
+}
+
+// SetCoalesce sets the window within which s coalesces broadcasts that supersede each other; 0 turns coalescing off.
+// It must be called before Run.
+func (s *Server) SetCoalesce(window time.Duration) {
+	s.coalesce = window
+}
+
+// SetRegionThreshold sets how many item broadcasts s sends separately in one coalesced flush, before it folds them into a
+// single region broadcast; 0, the default, never folds them.
+// It must be called before Run.
+func (s *Server) SetRegionThreshold(threshold int) {
+	s.regions = threshold
+}
+
+// SetTimeInterval sets how often s broadcasts its clock to every client; 0, the default, turns this off.
+// It must be called before Run.
+func (s *Server) SetTimeInterval(interval time.Duration) {
+	s.timeInterval = interval
+}
+
+// SetAuth sets the provider that checks client logins; nil, the default, means that clients don't log in.
+// It must be called before Run.
+func (s *Server) SetAuth(p auth.Provider) {
+	s.auth = p
+}
+
+// SetRequestTimeout sets how long each client request may wait to be handled before failing; 0, the default, means
+// forever.
+// It must be called before Run.
+func (s *Server) SetRequestTimeout(timeout time.Duration) {
+	s.requestTimeout = timeout
+}
+
+// SetWordFilters sets the filters restricting the request words that clients of the main listener, the
+// compatibility listener (see SetCompat), and the hub (see SetHub) may send; nil, the default, accepts every word.
+// It must be called before Run.
+func (s *Server) SetWordFilters(main, compat, hub *controller.WordFilter) {
+	s.words = main
+	s.compatWords = compat
+	s.hubWords = hub
+}
+
+// SetSlowRequest sets how long a client request may take to be acknowledged before s logs it and counts it as slow;
+// 0, the default, means that s never does.
+// It must be called before Run.
+func (s *Server) SetSlowRequest(threshold time.Duration) {
+	s.slowRequest = threshold
+}
+
+// logSlow logs, and counts, the slow request r from the client of the connection cname, with adapter b.
+func (s *Server) logSlow(cname string, b *controller.Bifrost, r controller.SlowRequest) {
+	netMetrics.Add("slow_requests", 1)
+
+	user := "-"
+	if id, ok := b.Identity(); ok {
+		user = id.User
+	}
+	outcome := "ok"
+	if r.Err != nil {
+		outcome = r.Err.Error()
+	}
+	s.log.Printf("slow request from %s (user %s): %s %s took %s (%s)\n", cname, user, r.Tag, r.Word, r.Elapsed, outcome)
+}
+
+// logDenied logs, and counts, the request r from the client of the connection cname, refused because the client
+// wasn't an admin.
+func (s *Server) logDenied(cname string, r controller.DeniedRequest) {
+	netMetrics.Add("denied_requests", 1)
+
+	user := "-"
+	if id := r.Err.Identity; id != nil {
+		user = id.User
+	}
+	s.log.Printf("denied request from %s (user %s): %s %s needs group %q\n", cname, user, r.Tag, r.Word, r.Err.Group)
+	if s.deniedHook != nil {
+		s.deniedHook(cname, r)
+	}
+}
+
+// SetDeniedRequestHook sets a function s calls, as well as logging, with the connection name and details of each
+// request refused because the client wasn't an admin; nil, the default, means it calls nothing.
+// The hook mustn't block for long, as the client's adapter waits for it.
+// It must be called before Run.
+func (s *Server) SetDeniedRequestHook(hook func(cname string, r controller.DeniedRequest)) {
+	s.deniedHook = hook
+}
+
+// SetAdmins sets the group whose members may make admin requests, such as listing clients; empty, the default, means
+// that anyone may.
+// It must be called before Run.
+func (s *Server) SetAdmins(group string) {
+	s.admins = group
+}
+
+// SetMotd sets the message of the day s greets clients with, and tells them about when it changes; nil, the default,
+// means there is none.
+// It must be called before Run.
+func (s *Server) SetMotd(m *controller.Motd) {
+	s.motd = m
+	if m != nil {
+		m.SetAnnouncer(s.Announce)
 	}
 }
 
 func (s *Server) shutdownController(ctx context.Context) {
 	s.log.Println("shutting down")
+	if s.rootClosed {
+		return
+	}
 	if err := s.rootClient.Shutdown(ctx); err != nil {
 		s.log.Println("couldn't shut down gracefully:", err)
 	}
 }
 
-// newConnection sets up the server s to handle incoming connection c.
+// newConnection sets up the server s to handle incoming connection c, whose client speaks dialect (nil for the
+// current protocol) and may only send the words words accepts.
+// If trusted is true, the client is one of ours, such as the hub, and is neither capped nor hung up on when idle.
 // It does not close c on error.
-func (s *Server) newConnection(ctx context.Context, c net.Conn) error {
+func (s *Server) newConnection(ctx context.Context, c net.Conn, trusted bool, dialect *controller.Dialect, words *controller.WordFilter) error {
 	cname := c.RemoteAddr().String()
 	s.log.Println("new connection:", cname)
 
@@ -89,6 +349,39 @@ func (s *Server) newConnection(ctx context.Context, c net.Conn) error {
 	}
 
 	conBifrost, conBifrostClient := controller.NewBifrost(conClient)
+	conBifrost.SetNormalise(s.normalise)
+	conBifrost.SetCoalesce(s.coalesce)
+	conBifrost.SetRegionThreshold(s.regions)
+	conBifrost.SetAuth(s.auth)
+	conBifrost.SetRequestTimeout(s.requestTimeout)
+	conBifrost.SetMotd(s.motd)
+	conBifrost.SetClientLister(s.listClients, s.admins)
+	conBifrost.SetTunables(s.tunables)
+	conBifrost.SetDialect(dialect)
+	conBifrost.SetWordFilter(words)
+	if 0 < s.slowRequest {
+		conBifrost.SetSlowRequestHook(s.slowRequest, func(r controller.SlowRequest) { s.logSlow(cname, conBifrost, r) })
+	}
+	conBifrost.SetDeniedRequestHook(func(r controller.DeniedRequest) { s.logDenied(cname, r) })
+	if !trusted {
+		conBifrost.SetSendBuffer(s.sendBuffer)
+		conBifrost.SetDroppedBroadcastHook(func() { netMetrics.Add("dropped_broadcasts", 1) })
+	}
+
+	t := &traffic{name: cname, bifrost: conBifrost}
+	mc := meteredConn{Conn: c, t: t}
+	if !trusted {
+		mc.in, mc.out = newLimiter(s.bandwidthCap), newLimiter(s.bandwidthCap)
+	}
+	c = mc
+	s.trackTraffic(t)
+
+	// Idle timeouts can be tuned at runtime, so every connection that might be hung up on for idling is watched.
+	var idle *idleState
+	if !trusted {
+		idle = newIdleState(s.clock)
+		c = activityConn{Conn: c, idle: idle}
+	}
 
 	ioClient := comm.IoEndpoint{
 		Io:       c,
@@ -99,7 +392,13 @@ func (s *Server) newConnection(ctx context.Context, c net.Conn) error {
 		name:      cname,
 		ioClient:  &ioClient,
 		conClient: conClient,
+		bifrost:   conBifrost,
 		log:       s.log,
+		idle:      idle,
+		since:     s.clock.Now(),
+	}
+	if s.duplicatePolicy != "" && s.duplicatePolicy != DuplicateAllow {
+		conBifrost.SetLoginHook(func(auth.Identity) { s.loggedIn(cli) })
 	}
 
 	s.clients[cli] = struct{}{}
@@ -107,12 +406,33 @@ func (s *Server) newConnection(ctx context.Context, c net.Conn) error {
 	s.wg.Add(1)
 	go func() {
 		cli.Run(ctx, conBifrost, s.clientHangUp)
+		if !trusted {
+			s.workers.release(connGoroutines)
+		}
 		s.wg.Done()
 	}()
 
 	return nil
 }
 
+// Announce sends m to every connected client, bypassing the controller.
+// It is safe to call from any goroutine, and does nothing once the server has stopped.
+func (s *Server) Announce(m message.Message) {
+	select {
+	case s.announce <- m:
+	case <-s.done:
+	}
+}
+
+// announceToClients sends m to every connected client.
+func (s *Server) announceToClients(m message.Message) {
+	for c := range s.clients {
+		if !c.bifrost.Announce(m) {
+			s.log.Println("dropped announcement to slow client:", c.name)
+		}
+	}
+}
+
 // hangUpAllClients gracefully closes all connected clients on s.
 func (s *Server) hangUpAllClients() {
 	for c := range s.clients {
@@ -120,74 +440,179 @@ func (s *Server) hangUpAllClients() {
 	}
 }
 
-// hangUpClient closes the client pointed to by c.
+// hangUpClient closes the client pointed to by c, if it hasn't been already.
 func (s *Server) hangUpClient(c *Client) {
+	// Clients the server hangs up on itself, such as idle ones, still report hanging up afterwards.
+	if _, ok := s.clients[*c]; !ok {
+		return
+	}
 	s.log.Println("hanging up:", c.name)
 	if err := c.Close(); err != nil {
 		s.log.Printf("couldn't gracefully close %s: %s\n", c.name, err.Error())
 	}
 	delete(s.clients, *c)
+	s.untrackTraffic(c.name)
 }
 
 // Run prepares and runs the net server main loop.
+// If the Server has neither a host nor a compatibility host (see SetCompat), it doesn't listen for connections, and
+// only serves its hub.
+// It stops when ctx is cancelled, or when the root client's controller shuts down.
 func (s *Server) Run(ctx context.Context) {
 	defer s.wg.Wait()
 	defer s.shutdownController(ctx)
-
-	ln, err := net.Listen("tcp", s.host)
-	if err != nil {
-		s.log.Println("couldn't open server:", err)
-		return
+	// Whatever stopped the main loop, everything the server started must stop with it.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	s.accepting = true
+	defer s.closeListeners()
+	if hs := s.serveHTTP(); hs != nil {
+		// Closing the listener doesn't close connections already being served, such as event streams.
+		defer func() { _ = hs.Close() }()
+	}
+	for _, l := range []struct {
+		host    string
+		dialect *controller.Dialect
+		words   *controller.WordFilter
+		addrs   *AddressFilter
+	}{{s.host, nil, s.words, s.addrs}, {s.compatHost, s.compatDialect, s.compatWords, s.compatAddrs}} {
+		if l.host == "" {
+			continue
+		}
+		ln, err := net.Listen("tcp", l.host)
+		if err != nil {
+			s.log.Println("couldn't open server:", err)
+			close(s.done)
+			return
+		}
+		s.listeners = append(s.listeners, ln)
+
+		s.log.Println("now listening on", l.host)
+		s.wg.Add(1)
+		go func(dialect *controller.Dialect, words *controller.WordFilter, addrs *AddressFilter) {
+			s.acceptClients(ln, dialect, words, addrs)
+			s.wg.Done()
+		}(l.dialect, l.words, l.addrs)
 	}
 
-	s.log.Println("now listening on", s.host)
-	s.wg.Add(1)
-	go func() {
-		s.acceptClients(ln)
-		s.wg.Done()
-	}()
+	if s.hub != "" {
+		var hctx context.Context
+		hctx, s.stopHub = context.WithCancel(ctx)
+		s.wg.Add(1)
+		go func() {
+			s.linkHub(hctx)
+			s.wg.Done()
+		}()
+	}
 
 	s.mainLoop(ctx)
 
 	close(s.done)
 	s.hangUpAllClients()
-	if err := ln.Close(); err != nil {
-		s.log.Println("error closing listener:", err)
+}
+
+// register sets up the server s to handle connection conn, whose client speaks dialect (nil for the current
+// protocol) and may only send the words words accepts, closing conn if it can't.
+// If trusted is true, the client is one of ours, such as the hub, and is neither capped nor hung up on when idle.
+func (s *Server) register(ctx context.Context, conn net.Conn, trusted bool, dialect *controller.Dialect, words *controller.WordFilter) {
+	if !trusted && !s.workers.acquire(connGoroutines) {
+		s.refuseBusy(conn)
+		return
+	}
+
+	cname := conn.RemoteAddr().String()
+	if err := s.newConnection(ctx, conn, trusted, dialect, words); err != nil {
+		if !trusted {
+			s.workers.release(connGoroutines)
+		}
+		s.log.Printf("error registering connection %s: %s\n", cname, err.Error())
+		if cerr := conn.Close(); cerr != nil {
+			s.log.Printf("further error closing connection %s: %s\n", cname, cerr.Error())
+		}
+	}
+}
+
+// registerIfAccepting registers conn as register does, unless s has stopped accepting clients, in which case it closes
+// conn.
+func (s *Server) registerIfAccepting(ctx context.Context, conn net.Conn, trusted bool, dialect *controller.Dialect, words *controller.WordFilter) {
+	if s.accepting {
+		s.register(ctx, conn, trusted, dialect, words)
+		return
+	}
+	if err := conn.Close(); err != nil {
+		s.log.Printf("error closing connection %s: %s\n", conn.RemoteAddr(), err.Error())
 	}
-	s.log.Println("closed listener")
 }
 
 // mainLoop is the server's main connection handling loop.
 func (s *Server) mainLoop(ctx context.Context) {
 	done := ctx.Done()
+
+	var tick <-chan time.Time
+	if 0 < s.timeInterval {
+		ticker := time.NewTicker(s.timeInterval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	idleTick, stopIdle := s.idleTick()
+	defer func() { stopIdle() }()
+
 	for {
 		select {
 		case err := <-s.accErr:
+			// Listeners closed by StopAccepting fail like any other.
+			if !s.accepting {
+				continue
+			}
 			s.log.Println("error accepting connections:", err)
 			return
-		case conn := <-s.accConn:
-			cname := conn.RemoteAddr().String()
-			if err := s.newConnection(ctx, conn); err != nil {
-				s.log.Printf("error registering connection %s: %s\n", cname, err.Error())
-				if cerr := conn.Close(); err != nil {
-					s.log.Printf("further error closing connection %s: %s\n", cname, cerr.Error())
-				}
-			}
+		case a := <-s.accConn:
+			s.registerIfAccepting(ctx, a.conn, false, a.dialect, a.words)
+		case conn := <-s.hubConn:
+			// The hub is ours to keep connected, not a client to reclaim or hold back.
+			s.registerIfAccepting(ctx, conn, true, nil, s.hubWords)
+		case reply := <-s.stopAccept:
+			s.stopAccepting()
+			close(reply)
+		case reply := <-s.drainClients:
+			reply <- s.drainAll()
 		case c := <-s.clientHangUp:
 			s.hangUpClient(c)
-		case <-s.rootClient.Rx:
-			// Drain any messages sent to the root client.
+		case c := <-s.clientLogin:
+			s.checkDuplicates(c)
+		case m := <-s.announce:
+			s.announceToClients(m)
+		case m := <-s.adminAnnounce:
+			s.announceToAdmins(m)
+		case f := <-s.tune:
+			f()
+			// The function may have changed the idle timeout.
+			stopIdle()
+			idleTick, stopIdle = s.idleTick()
+		case <-tick:
+			s.announceToClients(*controller.TimeMessage(message.TagBcast))
+		case now := <-idleTick:
+			s.checkIdle(now)
+		case _, ok := <-s.rootClient.Rx:
+			// Drain any messages sent to the root client, stopping once its controller has shut down.
+			if !ok {
+				s.log.Println("received controller shutdown")
+				s.rootClosed = true
+				return
+			}
 		case <-done:
-			s.log.Println("received controller shutdown")
+			s.log.Println("received context cancellation")
 			return
 		}
 	}
 }
 
-// acceptClients keeps spinning, accepting clients on ln and sending them to
-// connCh, until ln closes.
-// It then sends the error on errCh and closes both channels.
-func (s *Server) acceptClients(ln net.Listener) {
+// acceptClients keeps spinning, accepting clients, who speak dialect (nil for the current protocol) and may only send
+// the words words accepts, on ln and sending them to accConn, until ln closes.
+// It hangs up at once on clients from addresses addrs refuses.
+// It then sends the error on accErr.
+func (s *Server) acceptClients(ln net.Listener, dialect *controller.Dialect, words *controller.WordFilter, addrs *AddressFilter) {
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
@@ -196,14 +621,32 @@ func (s *Server) acceptClients(ln net.Listener) {
 			case s.accErr <- err:
 			case <-s.done:
 			}
-			close(s.accErr)
-			close(s.accConn)
 			return
 		}
+		if !addrs.Accepts(conn.RemoteAddr()) {
+			s.refuseAddress(ln, conn)
+			continue
+		}
+
+		a := accepted{conn: conn, dialect: dialect, words: words}
+		if s.httpListener != nil && dialect == nil {
+			if !s.workers.acquire(1) {
+				s.refuseBusy(conn)
+				continue
+			}
+			// Sniffing waits on the client, so it mustn't hold up accepting the next one.
+			s.wg.Add(1)
+			go func() {
+				s.sniff(conn, a)
+				s.workers.release(1)
+				s.wg.Done()
+			}()
+			continue
+		}
 
 		// Only forward connections if the main loop actually wants them
 		select {
-		case s.accConn <- conn:
+		case s.accConn <- a:
 		case <-s.done:
 			// TODO(@MattWindsor91): necessary?
 			_ = conn.Close()
@@ -0,0 +1,102 @@
+package netsrv
+
+// File shutdown.go contains the Server's part in an orderly shutdown, which goes:
+//
+//  1. stop accepting: close the listeners and stop dialling the hub, so that no new clients arrive;
+//  2. drain: have every client's adapter finish the requests it already sent the controller, refusing any more;
+//  3. shut down the controller, which whoever owns it does, not the Server;
+//  4. close: hang up on every client, which the Server does when the controller shuts down or its context ends.
+//
+// Each phase takes a context, so that whoever orchestrates the shutdown can bound how long it waits.
+
+import (
+	"context"
+	"fmt"
+)
+
+// StopAccepting stops s accepting new clients, closing its listeners and no longer dialling its hub.
+// Clients already connected stay connected.
+// It returns once s has stopped accepting, s has stopped altogether, or ctx ends.
+func (s *Server) StopAccepting(ctx context.Context) error {
+	reply := make(chan struct{})
+	select {
+	case s.stopAccept <- reply:
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-reply:
+		return nil
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Drain tells every client's adapter to drain (see controller.Bifrost.Drain), then waits for them all to finish.
+// It should follow StopAccepting, as clients arriving afterwards aren't drained.
+// It returns once every adapter has drained, s has stopped, or ctx ends.
+func (s *Server) Drain(ctx context.Context) error {
+	reply := make(chan []<-chan struct{}, 1)
+	select {
+	case s.drainClients <- reply:
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var drained []<-chan struct{}
+	select {
+	case drained = <-reply:
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	for i, d := range drained {
+		select {
+		case <-d:
+		case <-s.done:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("%d of %d clients still busy: %w", len(drained)-i, len(drained), ctx.Err())
+		}
+	}
+	return nil
+}
+
+// stopAccepting closes s's listeners, and stops it dialling its hub.
+func (s *Server) stopAccepting() {
+	s.log.Println("no longer accepting clients")
+	s.accepting = false
+	s.closeListeners()
+	if s.stopHub != nil {
+		s.stopHub()
+	}
+}
+
+// drainAll tells every connected client's adapter to drain, and gets the channels that close once they have.
+func (s *Server) drainAll() []<-chan struct{} {
+	s.log.Printf("draining %d clients\n", len(s.clients))
+	drained := make([]<-chan struct{}, 0, len(s.clients))
+	for c := range s.clients {
+		c.bifrost.Drain()
+		drained = append(drained, c.bifrost.Drained())
+	}
+	return drained
+}
+
+// closeListeners closes every listener s still has open.
+func (s *Server) closeListeners() {
+	for _, ln := range s.listeners {
+		if err := ln.Close(); err != nil {
+			s.log.Println("error closing listener:", err)
+		}
+		s.log.Println("closed listener on", ln.Addr())
+	}
+	s.listeners = nil
+}
@@ -0,0 +1,57 @@
+package netsrv_test
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/netsrv"
+)
+
+// TestServer_Shutdown tests that a Server shuts down in order: it stops accepting clients, drains the ones it has,
+// and hangs up on them once stopped.
+func TestServer_Shutdown(t *testing.T) {
+	var srv *netsrv.Server
+	address, stop := startServer(t, func(s *netsrv.Server) {
+		srv = s
+	})
+	defer stop()
+
+	conn, r := dialServer(t, address)
+	defer conn.Close()
+	readUntil(t, r, "IAMA")
+
+	pctx, pcancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer pcancel()
+	if err := srv.StopAccepting(pctx); err != nil {
+		t.Fatalf("StopAccepting failed: %v", err)
+	}
+	if extra, err := net.Dial("tcp", address); err == nil {
+		extra.Close()
+		t.Error("server accepted a client after StopAccepting")
+	}
+
+	if err := srv.Drain(pctx); err != nil {
+		t.Fatalf("Drain failed: %v", err)
+	}
+	if _, err := io.WriteString(conn, "d1 dump\nt1 time\n"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if got := readUntil(t, r, "ACK"); !strings.HasPrefix(got, "d1 ACK WHAT") {
+		t.Errorf("dump while draining got %q, want an error", got)
+	}
+	if got := readUntil(t, r, controller.RsTime); !strings.HasPrefix(got, "t1 ") {
+		t.Errorf("time while draining got %q, want an answer", got)
+	}
+
+	stop()
+	for {
+		if _, err := r.ReadString('\n'); err != nil {
+			break
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package netsrv
+
+// File sniff.go contains protocol sniffing, which lets the Server's main listener serve HTTP as well as Bifrost, so
+// that a small station needs only one port open for everything.
+//
+// Bifrost clients wait for the server's OHAI before saying anything, whereas HTTP clients speak first, so the Server
+// waits up to sniffTimeout for a connection's first line.
+// A connection whose first line is an HTTP request line goes to the HTTP handler, along with everything that follows
+// it, WebSocket upgrade requests included; anything else, including silence, is taken to be a Bifrost client.
+// This holds every Bifrost client's OHAI back by up to sniffTimeout, so the Server only sniffs when it has an HTTP
+// handler.
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sniffTimeout is how long the Server waits for a new connection's first line before taking it to be Bifrost.
+	sniffTimeout = 250 * time.Millisecond
+	// sniffLimit is the longest first line the Server reads while sniffing; any longer, and it isn't HTTP.
+	sniffLimit = 4096
+)
+
+// SetHTTP makes s serve h to the HTTP clients of its main listener, telling them apart from Bifrost clients by their
+// first line; a nil h, the default, means that s serves only Bifrost.
+// It must be called before Run.
+func (s *Server) SetHTTP(h http.Handler) {
+	s.httpHandler = h
+}
+
+// serveHTTP starts serving s's HTTP handler to the connections sent on s's HTTP listener, returning the HTTP server
+// so that Run can close it, or nil if s has no HTTP handler.
+func (s *Server) serveHTTP() *http.Server {
+	if s.httpHandler == nil || s.host == "" {
+		return nil
+	}
+	s.httpListener = &connListener{conns: make(chan net.Conn), done: make(chan struct{})}
+	s.listeners = append(s.listeners, s.httpListener)
+
+	hs := &http.Server{Handler: s.httpHandler, ErrorLog: s.log}
+	s.wg.Add(1)
+	go func() {
+		if err := hs.Serve(s.httpListener); err != nil && !errors.Is(err, net.ErrClosed) && !errors.Is(err, http.ErrServerClosed) {
+			s.log.Println("http error:", err)
+		}
+		s.wg.Done()
+	}()
+	return hs
+}
+
+// sniff works out whether conn, accepted by s's main listener, is an HTTP or Bifrost client, and sends it to the HTTP
+// listener or the main loop accordingly.
+func (s *Server) sniff(conn net.Conn, a accepted) {
+	sc, isHTTP, err := sniffConn(conn)
+	if err != nil {
+		s.log.Printf("error sniffing connection %s: %s\n", conn.RemoteAddr(), err.Error())
+		_ = conn.Close()
+		return
+	}
+
+	if isHTTP {
+		select {
+		case s.httpListener.conns <- sc:
+		case <-s.httpListener.done:
+			_ = sc.Close()
+		}
+		return
+	}
+
+	a.conn = sc
+	select {
+	case s.accConn <- a:
+	case <-s.done:
+		_ = sc.Close()
+	}
+}
+
+// sniffConn waits up to sniffTimeout for conn's first line, returning a connection that reads it again, and whether
+// it is an HTTP request line.
+func sniffConn(conn net.Conn) (net.Conn, bool, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(sniffTimeout)); err != nil {
+		return nil, false, err
+	}
+	r := bufio.NewReaderSize(conn, sniffLimit)
+	line, err := peekLine(r)
+	if err != nil && !isTimeout(err) {
+		return nil, false, err
+	}
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return nil, false, err
+	}
+	isHTTP := line != nil && isHTTPRequestLine(string(line))
+
+	// r may still hold the timeout, so reads carry on from conn itself once what r read is used up.
+	read, _ := r.Peek(r.Buffered())
+	return sniffedConn{Conn: conn, r: io.MultiReader(bytes.NewReader(read), conn)}, isHTTP, nil
+}
+
+// peekLine peeks at the first line r reads, without consuming it, returning nil if there isn't a whole line within
+// sniffLimit bytes.
+func peekLine(r *bufio.Reader) ([]byte, error) {
+	for n := 1; n <= sniffLimit; n = r.Buffered() + 1 {
+		buf, err := r.Peek(n)
+		if i := bytes.IndexByte(buf, '\n'); i != -1 {
+			return buf[:i+1], nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// isTimeout checks whether err is a read timing out.
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// isHTTPRequestLine checks whether line looks like the request line of HTTP/1, such as 'GET /nowplaying HTTP/1.1'.
+func isHTTPRequestLine(line string) bool {
+	fields := strings.Fields(line)
+	if len(fields) != 3 || !strings.HasPrefix(fields[2], "HTTP/1.") {
+		return false
+	}
+	for _, c := range fields[0] {
+		if c < 'A' || 'Z' < c {
+			return false
+		}
+	}
+	return true
+}
+
+// sniffedConn is a connection whose reads first return what was read while sniffing it.
+type sniffedConn struct {
+	net.Conn
+	// r reads from the connection, starting with what was read while sniffing.
+	r io.Reader
+}
+
+// Read reads from c, starting with what was read while sniffing it.
+func (c sniffedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// connListener is a net.Listener that accepts the connections sent to it, for handing sniffed connections to an
+// http.Server.
+type connListener struct {
+	// conns carries the connections to accept.
+	conns chan net.Conn
+	// done is closed when the listener closes.
+	done chan struct{}
+	// closeOnce makes sure done is closed only once.
+	closeOnce sync.Once
+}
+
+// Accept waits for the next connection sent to l.
+func (l *connListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes l.
+func (l *connListener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return nil
+}
+
+// Addr gets a placeholder address, as l doesn't listen on one of its own.
+func (l *connListener) Addr() net.Addr {
+	return sniffAddr{}
+}
+
+// sniffAddr is the address of a connListener.
+type sniffAddr struct{}
+
+// Network gets the name of a connListener's network.
+func (sniffAddr) Network() string {
+	return "sniffed"
+}
+
+// String gets the address of a connListener.
+func (sniffAddr) String() string {
+	return "sniffed"
+}
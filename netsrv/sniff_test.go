@@ -0,0 +1,50 @@
+package netsrv_test
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/netsrv"
+)
+
+// TestServer_SetHTTP tests that a Server with an HTTP handler serves HTTP and Bifrost clients on the same port, both
+// those that wait for the server and those that speak first.
+func TestServer_SetHTTP(t *testing.T) {
+	address, stop := startServer(t, func(srv *netsrv.Server) {
+		srv.SetHTTP(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "hello "+r.URL.Path)
+		}))
+	})
+	defer stop()
+
+	// A Bifrost client that waits for the server to speak first.
+	conn, r := dialServer(t, address)
+	readUntil(t, r, "IAMA")
+	conn.Close()
+
+	// A Bifrost client that speaks first.
+	conn, r = dialServer(t, address)
+	if _, err := io.WriteString(conn, "t1 time\n"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if got := readUntil(t, r, controller.RsTime); !strings.HasPrefix(got, "t1 ") {
+		t.Errorf("time got %q, want an answer", got)
+	}
+	conn.Close()
+
+	rs, err := http.Get("http://" + address + "/status")
+	if err != nil {
+		t.Fatalf("HTTP request failed: %v", err)
+	}
+	body, err := io.ReadAll(rs.Body)
+	rs.Body.Close()
+	if err != nil {
+		t.Fatalf("HTTP read failed: %v", err)
+	}
+	if got, want := string(body), "hello /status"; got != want {
+		t.Errorf("HTTP got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,223 @@
+package netsrv
+
+// File traffic.go contains the accounting of the traffic over each connection, and the bandwidth caps that keep any
+// one client, such as a script dumping the list in a loop, from hogging the server.
+//
+// Each connection counts the bytes and messages (lines) in each direction, and how often its cap held it back.
+// The counts are published through expvar, as 'yaps_net' for the totals over every connection, and
+// 'yaps_net_clients' for each open connection, keyed by '<name>.<counter>'; admins can also get them with 'clients'.
+
+import (
+	"bytes"
+	"expvar"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+var (
+	// netMetrics holds counters totalled over every connection: 'bytes_in', 'bytes_out', 'messages_in',
+	// 'messages_out', and 'throttled', and also 'slow_requests' (see Server.SetSlowRequest), 'denied_requests' (see
+	// Server.logDenied), 'dropped_broadcasts' (see Server.SetSendBuffer), 'busy' (see Server.SetMaxGoroutines), and
+	// 'refused' (see Server.SetAddressFilters).
+	netMetrics = expvar.NewMap("yaps_net")
+	// clientMetrics holds the same counters for each open connection, keyed by '<name>.<counter>', along with
+	// 'queued' and 'dropped' from its send buffer.
+	clientMetrics = expvar.NewMap("yaps_net_clients")
+)
+
+// SetSendBuffer sets how many messages may wait to be sent to each client before s drops broadcasts to it, counting
+// each as 'dropped_broadcasts'; 0, the default, means that s waits for slow clients, holding up every other client.
+// The hub is never dropped from.
+// It must be called before Run.
+func (s *Server) SetSendBuffer(size int) {
+	s.sendBuffer = size
+}
+
+// SetBandwidthCap sets how many bytes per second each client may send, and be sent; 0, the default, means there is
+// no limit.
+// It must be called before Run.
+func (s *Server) SetBandwidthCap(bytesPerSec int64) {
+	s.bandwidthCap = bytesPerSec
+}
+
+// traffic counts the traffic over one connection.
+type traffic struct {
+	// name names the connection.
+	name string
+	// bifrost is the connection's Bifrost adapter, which knows who the client is.
+	bifrost *controller.Bifrost
+
+	bytesIn, bytesOut       expvar.Int
+	messagesIn, messagesOut expvar.Int
+	throttled               expvar.Int
+}
+
+// counters gets each of t's counters, by name.
+func (t *traffic) counters() map[string]*expvar.Int {
+	return map[string]*expvar.Int{
+		"bytes_in":     &t.bytesIn,
+		"bytes_out":    &t.bytesOut,
+		"messages_in":  &t.messagesIn,
+		"messages_out": &t.messagesOut,
+		"throttled":    &t.throttled,
+	}
+}
+
+// gauges gets each of the values t publishes from its connection's send buffer, by name.
+func (t *traffic) gauges() map[string]expvar.Func {
+	return map[string]expvar.Func{
+		"queued":  func() any { return t.bifrost.Queued() },
+		"dropped": func() any { return t.bifrost.Dropped() },
+	}
+}
+
+// add adds delta to the counter of t called counter, and to the total.
+func (t *traffic) add(counter *expvar.Int, name string, delta int64) {
+	counter.Add(delta)
+	netMetrics.Add(name, delta)
+}
+
+// stats gets a snapshot of t.
+func (t *traffic) stats() controller.ClientStats {
+	id, _ := t.bifrost.Identity()
+	return controller.ClientStats{
+		Name:        t.name,
+		User:        id.User,
+		BytesIn:     t.bytesIn.Value(),
+		BytesOut:    t.bytesOut.Value(),
+		MessagesIn:  t.messagesIn.Value(),
+		MessagesOut: t.messagesOut.Value(),
+		Throttled:   t.throttled.Value(),
+		Queued:      int64(t.bifrost.Queued()),
+		Dropped:     t.bifrost.Dropped(),
+	}
+}
+
+// trackTraffic starts publishing t, as one of s's connections.
+func (s *Server) trackTraffic(t *traffic) {
+	s.trafficMu.Lock()
+	s.traffic[t.name] = t
+	s.trafficMu.Unlock()
+
+	for name, c := range t.counters() {
+		clientMetrics.Set(t.name+"."+name, c)
+	}
+	for name, g := range t.gauges() {
+		clientMetrics.Set(t.name+"."+name, g)
+	}
+}
+
+// untrackTraffic stops publishing the traffic of the connection called name.
+func (s *Server) untrackTraffic(name string) {
+	s.trafficMu.Lock()
+	t, ok := s.traffic[name]
+	delete(s.traffic, name)
+	s.trafficMu.Unlock()
+
+	if !ok {
+		return
+	}
+	for counter := range t.counters() {
+		clientMetrics.Delete(t.name + "." + counter)
+	}
+	for gauge := range t.gauges() {
+		clientMetrics.Delete(t.name + "." + gauge)
+	}
+}
+
+// listClients describes every connection to s, in name order.
+// It is safe to call from any goroutine.
+func (s *Server) listClients() []controller.ClientStats {
+	s.trafficMu.Lock()
+	stats := make([]controller.ClientStats, 0, len(s.traffic))
+	for _, t := range s.traffic {
+		stats = append(stats, t.stats())
+	}
+	s.trafficMu.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// meteredConn is a connection that counts its traffic, and holds it to a bandwidth cap.
+type meteredConn struct {
+	net.Conn
+
+	// t counts the connection's traffic.
+	t *traffic
+	// in and out cap the traffic in each direction, or are nil if it isn't capped.
+	in, out *limiter
+}
+
+// Read reads from the connection, counting the traffic, and waiting if the client is sending too much.
+func (c meteredConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.t.add(&c.t.bytesIn, "bytes_in", int64(n))
+	c.t.add(&c.t.messagesIn, "messages_in", int64(bytes.Count(p[:n], []byte{'\n'})))
+	if c.in.wait(n) {
+		c.t.add(&c.t.throttled, "throttled", 1)
+	}
+	return n, err
+}
+
+// Write writes to the connection, counting the traffic, and first waiting if the client is being sent too much.
+func (c meteredConn) Write(p []byte) (int, error) {
+	if c.out.wait(len(p)) {
+		c.t.add(&c.t.throttled, "throttled", 1)
+	}
+	n, err := c.Conn.Write(p)
+	c.t.add(&c.t.bytesOut, "bytes_out", int64(n))
+	c.t.add(&c.t.messagesOut, "messages_out", int64(bytes.Count(p[:n], []byte{'\n'})))
+	return n, err
+}
+
+// limiter is a token bucket that holds traffic to a rate, in bytes per second, allowing bursts of up to a second's
+// worth.
+type limiter struct {
+	// rate is the rate, in bytes per second.
+	rate float64
+
+	// mu guards avail and last.
+	mu sync.Mutex
+	// avail is the number of bytes that may pass without waiting; it goes negative when traffic is in debt.
+	avail float64
+	// last is when avail was last topped up.
+	last time.Time
+}
+
+// newLimiter makes a limiter holding traffic to rate bytes per second, or nil if rate is 0.
+func newLimiter(rate int64) *limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &limiter{rate: float64(rate), avail: float64(rate), last: time.Now()}
+}
+
+// wait takes n bytes from l, sleeping until the rate allows them; it returns whether it had to sleep.
+// A nil limiter never sleeps.
+func (l *limiter) wait(n int) bool {
+	if l == nil {
+		return false
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.avail += now.Sub(l.last).Seconds() * l.rate
+	if l.rate < l.avail {
+		l.avail = l.rate
+	}
+	l.last = now
+	l.avail -= float64(n)
+	debt := l.avail
+	l.mu.Unlock()
+
+	if 0 <= debt {
+		return false
+	}
+	time.Sleep(time.Duration(-debt / l.rate * float64(time.Second)))
+	return true
+}
@@ -0,0 +1,55 @@
+package netsrv_test
+
+import (
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/netsrv"
+)
+
+// TestServer_Clients tests that a Server counts each client's traffic, holds it to the bandwidth cap, and lists it
+// on request.
+func TestServer_Clients(t *testing.T) {
+	address, stop := startServer(t, func(srv *netsrv.Server) {
+		srv.SetBandwidthCap(1000)
+	})
+	defer stop()
+
+	conn, r := dialServer(t, address)
+	defer conn.Close()
+
+	// Twice the cap, in one go, must be held back; the server has no message of the day, so the reply is short.
+	big := "m1 motd " + strings.Repeat("x", 2000) + "\n"
+	if _, err := io.WriteString(conn, big+"c1 clients\n"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	got := strings.Fields(readUntil(t, r, controller.RsClient))
+	if len(got) != 11 {
+		t.Fatalf("got CLIENT %v, want 9 arguments", got)
+	}
+	if got[2] != conn.LocalAddr().String() || got[3] != "-" {
+		t.Errorf("got client %s, user %s; want %s, -", got[2], got[3], conn.LocalAddr())
+	}
+	counts := make([]int, 7)
+	for i := range counts {
+		var err error
+		if counts[i], err = strconv.Atoi(got[4+i]); err != nil {
+			t.Fatalf("count %q didn't parse: %v", got[4+i], err)
+		}
+	}
+	if in, msgs := counts[0], counts[2]; in < len(big) || msgs < 2 {
+		t.Errorf("got %d bytes, %d messages in; want at least %d, 2", in, msgs, len(big))
+	}
+	if out := counts[1]; out == 0 {
+		t.Error("got no bytes out")
+	}
+	if throttled := counts[4]; throttled == 0 {
+		t.Error("got no throttling")
+	}
+	if queued, dropped := counts[5], counts[6]; queued != 0 || dropped != 0 {
+		t.Errorf("got %d queued, %d dropped; want 0, 0 without a send buffer", queued, dropped)
+	}
+}
@@ -0,0 +1,125 @@
+package netsrv
+
+// File tune.go contains the net server's tunables (see controller.Tunables), which let admins change its coalescing
+// window, request timeout, bandwidth cap and idle timeout at runtime.
+//
+// The coalescing window, request timeout and bandwidth cap apply to connections made after the change; the idle timeout
+// and warning apply to every connection at once.
+// Changes are made on the main goroutine, so they never race with a connection being set up.
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+var (
+	// errNegative is the reason given for negative values of tunables that must not be negative.
+	errNegative = errors.New("must not be negative")
+	// errStopped is the reason given for changes to the tunables of a server that has stopped.
+	errStopped = errors.New("the net server has stopped")
+)
+
+// SetTunables adds s's tunables to ts, and sets s's connections to let admins get and change ts with 'tune',
+// announcing changes to admin clients; nil, the default, means that they can't.
+// It must be called before Run.
+func (s *Server) SetTunables(ts *controller.Tunables) {
+	s.tunables = ts
+	if ts == nil {
+		return
+	}
+	ts.Add(s.durationTunable("coalesce", "How long new connections hold back superseded broadcasts.", &s.coalesce))
+	ts.Add(s.durationTunable("requesttimeout", "How long requests on new connections may wait; 0 means forever.", &s.requestTimeout))
+	ts.Add(s.durationTunable("idletimeout", "How long clients may idle before being hung up on; 0 means forever.", &s.idleTimeout))
+	ts.Add(s.durationTunable("idlewarning", "How long before hanging up on an idle client it is warned.", &s.idleWarning))
+	ts.Add(controller.Tunable{
+		Name: "bandwidthcap",
+		Doc:  "How many bytes per second each new connection may send, and be sent; 0 means there is no limit.",
+		Get: func() string {
+			var v int64
+			s.onMain(func() { v = s.bandwidthCap })
+			return strconv.FormatInt(v, 10)
+		},
+		Set: func(v string) error {
+			x, err := strconv.ParseInt(v, 10, 64)
+			switch {
+			case err != nil:
+				return err
+			case x < 0:
+				return errNegative
+			case !s.onMain(func() { s.bandwidthCap = x }):
+				return errStopped
+			}
+			return nil
+		},
+	})
+	ts.SetAnnouncer(s.AnnounceAdmins)
+}
+
+// durationTunable makes a tunable, with the given name and doc, of the non-negative duration at d.
+func (s *Server) durationTunable(name, doc string, d *time.Duration) controller.Tunable {
+	return controller.Tunable{
+		Name: name,
+		Doc:  doc,
+		Get: func() string {
+			var v time.Duration
+			s.onMain(func() { v = *d })
+			return v.String()
+		},
+		Set: func(v string) error {
+			x, err := time.ParseDuration(v)
+			switch {
+			case err != nil:
+				return err
+			case x < 0:
+				return errNegative
+			case !s.onMain(func() { *d = x }):
+				return errStopped
+			}
+			return nil
+		},
+	}
+}
+
+// onMain runs f on s's main goroutine, waiting for it to finish, and returns whether it ran; it doesn't once s has
+// stopped.
+func (s *Server) onMain(f func()) bool {
+	done := make(chan struct{})
+	select {
+	case s.tune <- func() { f(); close(done) }:
+	case <-s.done:
+		return false
+	}
+	<-done
+	return true
+}
+
+// AnnounceAdmins sends m to every connected client in the admin group (see SetAdmins), bypassing the controller.
+// It is safe to call from any goroutine, and does nothing once the server has stopped.
+func (s *Server) AnnounceAdmins(m message.Message) {
+	select {
+	case s.adminAnnounce <- m:
+	case <-s.done:
+	}
+}
+
+// announceToAdmins sends m to every connected client in the admin group.
+func (s *Server) announceToAdmins(m message.Message) {
+	for c := range s.clients {
+		id, ok := c.bifrost.Identity()
+		idp := &id
+		if !ok {
+			idp = nil
+		}
+		if controller.CheckAdmin(idp, s.admins) != nil {
+			continue
+		}
+		if !c.bifrost.Announce(m) {
+			s.log.Println("dropped announcement to slow client:", c.name)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package netsrv_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/netsrv"
+)
+
+// TestServer_Tunables tests that tuning a running Server's idle timeout announces the change to clients, and applies to
+// clients that connected before it.
+func TestServer_Tunables(t *testing.T) {
+	ts := controller.NewTunables()
+	address, stop := startServer(t, func(srv *netsrv.Server) {
+		srv.SetTunables(ts)
+	})
+	defer stop()
+
+	idler, ir := dialServer(t, address)
+	defer idler.Close()
+	admin, ar := dialServer(t, address)
+	defer admin.Close()
+	readUntil(t, ir, "IAMA")
+	readUntil(t, ar, "IAMA")
+
+	if _, err := io.WriteString(admin, "t1 tune idletimeout -1s\n"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if line := readUntil(t, ar, "ACK"); !strings.Contains(line, "must not be negative") {
+		t.Errorf("negative timeout: got %q, want a refusal", line)
+	}
+	if _, err := io.WriteString(admin, "t2 tune idletimeout 300ms\n"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if line := readUntil(t, ar, controller.RsTune); !strings.HasPrefix(line, "t2 TUNE idletimeout 300ms ") {
+		t.Errorf("reply: got %q, want the new timeout", line)
+	}
+	if line := readUntil(t, ar, controller.RsTune); !strings.HasPrefix(line, "! TUNE idletimeout 300ms ") {
+		t.Errorf("announcement: got %q, want the new timeout", line)
+	}
+
+	for {
+		if _, err := ir.ReadString('\n'); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("idle client got %v, want hangup", err)
+		}
+	}
+	if got, err := ts.Get("idletimeout"); err != nil || got != "300ms" {
+		t.Errorf("idle timeout: got %q, %v; want 300ms", got, err)
+	}
+}
+
+// TestServer_Tunables_denied tests that a Server tells its denied-request hook about clients that aren't admins trying
+// to tune it.
+func TestServer_Tunables_denied(t *testing.T) {
+	ts := controller.NewTunables()
+	ts.SetAdmins("ops")
+	denied := make(chan controller.DeniedRequest, 1)
+	address, stop := startServer(t, func(srv *netsrv.Server) {
+		srv.SetTunables(ts)
+		srv.SetDeniedRequestHook(func(_ string, r controller.DeniedRequest) { denied <- r })
+	})
+	defer stop()
+
+	conn, r := dialServer(t, address)
+	defer conn.Close()
+	readUntil(t, r, "IAMA")
+	if _, err := io.WriteString(conn, "t1 tune idletimeout 1s\n"); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	readUntil(t, r, "ACK")
+
+	select {
+	case got := <-denied:
+		if got.Tag != "t1" || got.Word != "tune" || got.Err.Group != "ops" {
+			t.Errorf("denied request: got %+v, want t1 tune needing group ops", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("denied-request hook never called")
+	}
+}
@@ -0,0 +1,102 @@
+package nowplaying
+
+// File diff.go contains the JSON form of list diffs, for widgets that cache the whole list.
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/MattWindsor91/yaps/bifrost"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// Diff is the JSON document served to clients asking what changed since a version.
+type Diff struct {
+	// From is the version the diff starts from.
+	From uint64 `json:"from"`
+	// To is the version the diff brings the list to.
+	To uint64 `json:"to"`
+	// Ops holds the operations to apply, in order.
+	Ops []Op `json:"ops"`
+}
+
+// Op is the JSON representation of one operation in a Diff.
+//
+// Op is one of 'remove' (Hash), 'add' (Item), 'move' (Hash to Index), 'category' (Hash, at Index, to Category),
+// 'automode' (AutoMode), or 'select' (Index and Hash, or -1 and no hash).
+type Op struct {
+	Op       string `json:"op"`
+	Index    *int   `json:"index,omitempty"`
+	Hash     string `json:"hash,omitempty"`
+	Item     *Item  `json:"item,omitempty"`
+	Category string `json:"category,omitempty"`
+	AutoMode string `json:"automode,omitempty"`
+}
+
+// makeOp converts the list diff response rbody into an Op, if it has a JSON form.
+func makeOp(rbody interface{}) (Op, bool) {
+	switch r := rbody.(type) {
+	case list.ItemRemoveResponse:
+		return Op{Op: "remove", Hash: r.Hash}, true
+	case list.ItemResponse:
+		it := makeItem(r.Index, r.Item)
+		return Op{Op: "add", Item: &it}, true
+	case list.ItemMoveResponse:
+		return Op{Op: "move", Index: &r.Index, Hash: r.Hash}, true
+	case list.ItemCategoryResponse:
+		return Op{Op: "category", Index: &r.Index, Hash: r.Hash, Category: r.Category}, true
+	case list.AutoModeResponse:
+		return Op{Op: "automode", AutoMode: r.AutoMode.String()}, true
+	case list.SelectResponse:
+		op := Op{Op: "select", Index: &r.Index}
+		if 0 <= r.Index {
+			op.Hash = r.Hash
+		}
+		return op, true
+	default:
+		// Notes and timings don't appear in statuses, so aren't worth diffing.
+		return Op{}, false
+	}
+}
+
+// handleDiff serves the changes to the list since the version in the 'since' query parameter.
+// If the list no longer remembers that version, it answers 410 Gone, and the client should fetch the status again.
+func (s *Server) handleDiff(w http.ResponseWriter, r *http.Request) {
+	since, err := strconv.ParseUint(r.URL.Query().Get("since"), 10, 64)
+	if err != nil {
+		http.Error(w, "bad or missing 'since' version", http.StatusBadRequest)
+		return
+	}
+
+	d := Diff{Ops: []Op{}}
+	alive, err := s.client.SendAndProcessReplies(r.Context(), "", list.DiffRequest{Since: since}, func(rs controller.Response) error {
+		if dr, ok := rs.Body.(list.DiffResponse); ok {
+			d.From, d.To = dr.From, dr.To
+		} else if op, ok := makeOp(rs.Body); ok {
+			d.Ops = append(d.Ops, op)
+		}
+		return nil
+	})
+	if !alive {
+		http.Error(w, "list unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		if bifrost.CodeOf(err) == list.CodeStale {
+			http.Error(w, err.Error(), http.StatusGone)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	bs, err := json.Marshal(d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	setHeaders(w, "application/json")
+	_, _ = w.Write(bs)
+}
@@ -0,0 +1,192 @@
+// Package nowplaying provides a tiny read-only HTTP endpoint for website 'now playing' widgets.
+// It serves the current selection and upcoming items as JSON, and streams selection changes as server-sent events.
+package nowplaying
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// Server holds the internal state of a now-playing HTTP server.
+type Server struct {
+	// log is the Server's logger.
+	log *log.Logger
+
+	// host is the Server's host:port string, or empty if it is only served through Handler.
+	host string
+
+	// next is the number of upcoming items to include in each status.
+	next int
+
+	// client is the controller Client the Server uses to follow the list.
+	client *controller.Client
+
+	// mirror is the Server's view of the list; it is only touched by list.Follow.
+	mirror *list.Mirror
+
+	// mu guards status and subscribers.
+	mu sync.Mutex
+
+	// status is the most recently computed status, as JSON, or nil until the initial dump has arrived.
+	status []byte
+
+	// subscribers is the set of channels belonging to connected event-stream clients.
+	subscribers map[chan []byte]struct{}
+}
+
+// New creates a new now-playing server for a yaps list.
+func New(l *log.Logger, host string, next int, client *controller.Client) *Server {
+	return &Server{
+		log:         l,
+		host:        host,
+		next:        next,
+		client:      client,
+		mirror:      list.NewMirror(),
+		subscribers: make(map[chan []byte]struct{}),
+	}
+}
+
+// Handler gets the handler serving the Server's endpoints, for serving them somewhere other than its own host.
+// The endpoints only have a status to serve while Run is following the list.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/nowplaying", s.handleStatus)
+	mux.HandleFunc("/nowplaying/events", s.handleEvents)
+	mux.HandleFunc("/nowplaying/diff", s.handleDiff)
+	return mux
+}
+
+// Run follows the list, serving HTTP on the Server's host if it has one, until ctx is cancelled or the controller
+// shuts down.
+func (s *Server) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Don't start serving until the initial dump has arrived.
+	ready := make(chan struct{})
+	var readyOnce sync.Once
+	ferr := make(chan error, 1)
+	go func() {
+		ferr <- list.Follow(ctx, s.client, s.mirror, func(_ interface{}, selChanged bool) {
+			if err := s.update(selChanged); err != nil {
+				s.log.Println("couldn't update status:", err)
+			}
+			readyOnce.Do(func() { close(ready) })
+		})
+		cancel()
+	}()
+
+	select {
+	case <-ready:
+	case err := <-ferr:
+		return err
+	}
+
+	if s.host == "" {
+		return <-ferr
+	}
+
+	hs := http.Server{Addr: s.host, Handler: s.Handler()}
+	go func() {
+		<-ctx.Done()
+		_ = hs.Close()
+	}()
+
+	s.log.Println("now listening on", s.host)
+	if err := hs.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-ferr
+}
+
+// update recomputes the cached status, and pushes it to subscribers if notify is true.
+func (s *Server) update(notify bool) error {
+	st, err := json.Marshal(s.makeStatus())
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = st
+	if notify {
+		for sub := range s.subscribers {
+			// Drop events for subscribers that can't keep up, rather than stalling the list.
+			select {
+			case sub <- st:
+			default:
+			}
+		}
+	}
+	return nil
+}
+
+// handleStatus serves the current status as JSON.
+func (s *Server) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	s.mu.Lock()
+	st := s.status
+	s.mu.Unlock()
+	if st == nil {
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+
+	setHeaders(w, "application/json")
+	_, _ = w.Write(st)
+}
+
+// handleEvents serves selection changes as a server-sent event stream.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	fl, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	sub := make(chan []byte, 1)
+	s.mu.Lock()
+	st := s.status
+	if st == nil {
+		s.mu.Unlock()
+		http.Error(w, "not ready", http.StatusServiceUnavailable)
+		return
+	}
+	s.subscribers[sub] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.subscribers, sub)
+		s.mu.Unlock()
+	}()
+
+	setHeaders(w, "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	for {
+		if _, err := fmt.Fprintf(w, "event: select\ndata: %s\n\n", st); err != nil {
+			return
+		}
+		fl.Flush()
+
+		select {
+		case st = <-sub:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// setHeaders sets the headers common to all now-playing responses.
+func setHeaders(w http.ResponseWriter, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	// Widgets are usually embedded on other sites.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+}
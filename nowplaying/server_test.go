@@ -0,0 +1,156 @@
+package nowplaying_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/nowplaying"
+)
+
+// startServer starts a list holding tracks a, b and c, with a selected, and a now-playing Server following it.
+// It returns the list's client and the Server's base URL, once the Server is serving.
+func startServer(ctx context.Context, t *testing.T) (*controller.Client, string) {
+	t.Helper()
+
+	con, cli := controller.NewController(list.New())
+	go con.Run(ctx)
+	// The Controller broadcasts to cli too, so something has to listen.
+	go func() {
+		for range cli.Rx {
+		}
+	}()
+	for i, h := range []string{"a", "b", "c"} {
+		send(ctx, t, cli, list.AddItemRequest{Index: i, Item: *list.NewTrack(h, "/"+h+".mp3")})
+	}
+	send(ctx, t, cli, list.SetSelectRequest{Index: 0, Hash: "a"})
+
+	scli, err := cli.Copy(ctx)
+	if err != nil {
+		t.Fatalf("copy failed: %v", err)
+	}
+	host := freeAddress(t)
+	s := nowplaying.New(log.New(io.Discard, "", 0), host, 1, scli)
+	go func() { _ = s.Run(ctx) }()
+
+	base := "http://" + host
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if rs, err := http.Get(base + "/nowplaying"); err == nil {
+			rs.Body.Close()
+			if rs.StatusCode == http.StatusOK {
+				return cli, base
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("server never got ready")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// freeAddress gets an address on which nothing is listening, for a Server to listen on.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatalf("listen failed: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}
+
+// send sends the list request body through cli, failing t if it fails.
+func send(ctx context.Context, t *testing.T, cli *controller.Client, body interface{}) {
+	t.Helper()
+	if _, err := cli.SendAndProcessReplies(ctx, "", body, func(controller.Response) error { return nil }); err != nil {
+		t.Fatalf("request %#v failed: %v", body, err)
+	}
+}
+
+// get gets url, failing t if it can't, and returns the response status, headers and body.
+func get(t *testing.T, url string) (int, http.Header, []byte) {
+	t.Helper()
+	rs, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer rs.Body.Close()
+	body, err := io.ReadAll(rs.Body)
+	if err != nil {
+		t.Fatalf("GET %s: read failed: %v", url, err)
+	}
+	return rs.StatusCode, rs.Header, body
+}
+
+// getStatus gets and decodes the status from the Server at base.
+func getStatus(t *testing.T, base string) nowplaying.Status {
+	t.Helper()
+	_, _, body := get(t, base+"/nowplaying")
+	var st nowplaying.Status
+	if err := json.Unmarshal(body, &st); err != nil {
+		t.Fatalf("bad status %q: %v", body, err)
+	}
+	return st
+}
+
+// TestServer_status tests that the status shows the selection and as many following items as asked.
+func TestServer_status(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	_, base := startServer(ctx, t)
+
+	if _, h, _ := get(t, base+"/nowplaying"); h.Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("CORS header = %q, want *", h.Get("Access-Control-Allow-Origin"))
+	}
+	st := getStatus(t, base)
+	if st.Selection == nil || st.Selection.Hash != "a" || st.Selection.Payload != "/a.mp3" {
+		t.Errorf("selection = %+v, want track a", st.Selection)
+	}
+	if len(st.Next) != 1 || st.Next[0].Hash != "b" || st.Next[0].Index != 1 {
+		t.Errorf("next = %+v, want just track b", st.Next)
+	}
+}
+
+// TestServer_diff tests that diffs carry changes since a version, and refuse bad versions.
+func TestServer_diff(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cli, base := startServer(ctx, t)
+
+	since := getStatus(t, base).Version
+	send(ctx, t, cli, list.SetSelectRequest{Index: 1, Hash: "b"})
+
+	// The Server hears of the change asynchronously, so may need a moment to catch up.
+	deadline := time.Now().Add(5 * time.Second)
+	for getStatus(t, base).Version == since {
+		if time.Now().After(deadline) {
+			t.Fatal("server never saw the change")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	code, _, body := get(t, base+"/nowplaying/diff?since="+strconv.FormatUint(since, 10))
+	if code != http.StatusOK {
+		t.Fatalf("diff got %d: %s", code, body)
+	}
+	var d nowplaying.Diff
+	if err := json.Unmarshal(body, &d); err != nil {
+		t.Fatalf("bad diff %q: %v", body, err)
+	}
+	if d.From != since || len(d.Ops) != 1 || d.Ops[0].Op != "select" || d.Ops[0].Hash != "b" {
+		t.Errorf("diff = %+v, want a selection of b from version %d", d, since)
+	}
+
+	if code, _, _ := get(t, base+"/nowplaying/diff?since=soon"); code != http.StatusBadRequest {
+		t.Errorf("diff with bad version got %d, want %d", code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,58 @@
+package nowplaying
+
+// File status.go contains the JSON representation of the now-playing status.
+
+import "github.com/MattWindsor91/yaps/list"
+
+// Status is the JSON document served to now-playing clients.
+type Status struct {
+	// Version is the list version the status reflects, suitable for '/nowplaying/diff?since='.
+	Version uint64 `json:"version"`
+	// AutoMode is the name of the list's current autoselect mode.
+	AutoMode string `json:"automode"`
+	// Selection is the currently selected item, or nil if nothing is selected.
+	Selection *Item `json:"selection"`
+	// Next contains the items following the selection, in list order.
+	Next []Item `json:"next"`
+}
+
+// Item is the JSON representation of a list item.
+type Item struct {
+	// Index is the item's position in the list.
+	Index int `json:"index"`
+	// Hash is the item's unique hash.
+	Hash string `json:"hash"`
+	// Type is the name of the item's type.
+	Type string `json:"type"`
+	// Payload is the item's payload (a path for tracks, or text).
+	Payload string `json:"payload"`
+	// Category is the name of the item's category, if it has one.
+	Category string `json:"category,omitempty"`
+}
+
+// makeItem converts the list item i at index idx to its JSON representation.
+func makeItem(idx int, i list.Item) Item {
+	return Item{Index: idx, Hash: i.Hash(), Type: i.Type().String(), Payload: i.Payload(), Category: i.Category()}
+}
+
+// makeStatus computes the current status from the Server's mirror.
+func (s *Server) makeStatus() Status {
+	st := Status{
+		Version:  s.mirror.Version(),
+		AutoMode: s.mirror.AutoMode().String(),
+		Next:     []Item{},
+	}
+
+	idx, sel := s.mirror.Selection()
+	if sel == nil {
+		return st
+	}
+	si := makeItem(idx, *sel)
+	st.Selection = &si
+
+	items := s.mirror.Items()
+	for i := idx + 1; i < len(items) && len(st.Next) < s.next; i++ {
+		st.Next = append(st.Next, makeItem(i, items[i]))
+	}
+	return st
+}
@@ -0,0 +1,245 @@
+// Package replica lets a yaps instance act as a hot-standby replica of another yaps list server.
+// The replica follows the primary's dump and broadcasts over Bifrost, and can be promoted to primary, either by a
+// client sending 'promote' or automatically after losing the primary for long enough.
+package replica
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/clock"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+const (
+	// dialTimeout is how long the Replicator waits for the primary to accept a connection.
+	dialTimeout = 5 * time.Second
+	// minBackoff is the initial delay between reconnection attempts.
+	minBackoff = time.Second
+	// maxBackoff is the largest delay between reconnection attempts.
+	maxBackoff = 30 * time.Second
+	// heartbeatInterval is how often the Replicator asks the primary for the time, so that even an idle primary answers.
+	heartbeatInterval = 10 * time.Second
+	// readTimeout is how long the Replicator waits to hear anything from the primary before giving it up for dead.
+	readTimeout = 3 * heartbeatInterval
+	// heartbeatTag is the tag of the Replicator's heartbeat requests.
+	heartbeatTag = "heartbeat"
+)
+
+// Replicator keeps a local replica list in sync with a primary list server.
+type Replicator struct {
+	// log is the Replicator's logger.
+	log *log.Logger
+
+	// primary is the host:port string of the primary list server.
+	primary string
+
+	// promoteAfter is how long the primary must be unreachable before the replica promotes itself.
+	// If zero, the replica never promotes itself.
+	promoteAfter time.Duration
+
+	// client is the controller Client for the local replica list.
+	client *controller.Client
+
+	// clock is where the Replicator gets the time for backoffs, heartbeats, and promotion.
+	// Read deadlines stay on the system clock, as the network's do.
+	clock clock.Clock
+
+	// lastContact is the last time the Replicator knew the primary was reachable.
+	// Losing a connection counts, so the replica promotes itself only after redialling for promoteAfter.
+	lastContact time.Time
+}
+
+// New creates a Replicator that follows primary on behalf of the local list behind client.
+func New(l *log.Logger, primary string, promoteAfter time.Duration, client *controller.Client) *Replicator {
+	return &Replicator{log: l, primary: primary, promoteAfter: promoteAfter, client: client, clock: clock.Real}
+}
+
+// SetClock sets where r gets the time; the default is clock.Real.
+// It must be called before Run.
+func (r *Replicator) SetClock(clk clock.Clock) {
+	r.clock = clk
+}
+
+// Run replicates until ctx is cancelled, the local controller shuts down, or the replica promotes itself.
+func (r *Replicator) Run(ctx context.Context) error {
+	// Our own replicated changes get broadcast back to us, and must be drained.
+	go func() {
+		for range r.client.Rx {
+		}
+	}()
+
+	r.lastContact = r.clock.Now()
+	backoff := minBackoff
+	for {
+		err := r.session(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err == controller.ErrControllerShutDown {
+			return nil
+		}
+		r.log.Println("lost primary:", err)
+
+		if 0 < r.promoteAfter && r.promoteAfter <= r.clock.Now().Sub(r.lastContact) {
+			return r.promote(ctx)
+		}
+
+		if !r.wait(ctx, backoff) {
+			return nil
+		}
+		if backoff *= 2; maxBackoff < backoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// wait waits for d to pass by r's clock, returning false if ctx is cancelled first.
+func (r *Replicator) wait(ctx context.Context, d time.Duration) bool {
+	t := r.clock.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// promote promotes the local replica to a primary.
+func (r *Replicator) promote(ctx context.Context) error {
+	r.log.Printf("no contact with primary for %s; promoting\n", r.clock.Now().Sub(r.lastContact).Round(time.Second))
+	err := r.client.Call(ctx, list.PromoteRequest{})
+	if errors.Is(err, controller.ErrControllerShutDown) {
+		return nil
+	}
+	return err
+}
+
+// session connects to the primary and replicates until the connection fails.
+// Every session begins with a full dump, so the replica resynchronises after each reconnection.
+func (r *Replicator) session(ctx context.Context) error {
+	conn, err := net.DialTimeout("tcp", r.primary, dialTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	sctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-sctx.Done()
+		_ = conn.Close()
+	}()
+
+	rd := message.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+	if err := r.handshake(rd); err != nil {
+		return err
+	}
+	r.log.Println("replicating from", r.primary)
+	// The primary was there until now, however long it's been quiet.
+	defer func() { r.lastContact = r.clock.Now() }()
+	// The heartbeat stops before the session ends, so that it never outlives the session's connection.
+	hbDone := make(chan struct{})
+	go func() {
+		heartbeat(sctx, conn, r.clock)
+		close(hbDone)
+	}()
+	defer func() {
+		cancel()
+		<-hbDone
+	}()
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(readTimeout))
+		m, err := readMessage(rd)
+		if err != nil {
+			return err
+		}
+		r.lastContact = r.clock.Now()
+
+		if m.Tag() != message.TagBcast {
+			continue
+		}
+		if err := r.replicate(ctx, *m); err != nil {
+			// Something has diverged; reconnecting gets us a fresh dump.
+			return fmt.Errorf("couldn't replicate %s: %w", m.String(), err)
+		}
+	}
+}
+
+// handshake checks that the server on the other end of rd is a list server.
+func (r *Replicator) handshake(rd *message.Reader) error {
+	m, err := readMessage(rd)
+	if err != nil {
+		return err
+	}
+	if _, err := core.ParseOhaiResponse(m); err != nil {
+		return err
+	}
+
+	if m, err = readMessage(rd); err != nil {
+		return err
+	}
+	iama, err := core.ParseIamaResponse(m)
+	if err != nil {
+		return err
+	}
+	if iama.Role != "list" {
+		return fmt.Errorf("primary has role %s, not list", iama.Role)
+	}
+	r.lastContact = r.clock.Now()
+	return nil
+}
+
+// heartbeat sends a time request down conn every heartbeatInterval, by clk, until ctx is done.
+// The primary's replies keep the connection's reads from timing out while the list is idle.
+func heartbeat(ctx context.Context, conn net.Conn, clk clock.Clock) {
+	bs, err := message.New(heartbeatTag, controller.RqTime).Pack()
+	if err != nil {
+		return
+	}
+
+	tick := clk.NewTicker(heartbeatInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C():
+		case <-ctx.Done():
+			return
+		}
+		if _, err := conn.Write(bs); err != nil {
+			// The session's next read will fail too, and end it.
+			return
+		}
+	}
+}
+
+// replicate applies the primary's broadcast m to the local list.
+func (r *Replicator) replicate(ctx context.Context, m message.Message) error {
+	body, err := list.ParseBifrostResponse(m)
+	if err != nil {
+		// Not everything the primary says is list state.
+		return nil
+	}
+
+	return r.client.Call(ctx, list.ReplicateRequest{Response: body})
+}
+
+// readMessage reads and parses a single message from rd.
+func readMessage(rd *message.Reader) (*message.Message, error) {
+	line, err := rd.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	return message.NewFromLine(line)
+}
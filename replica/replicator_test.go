@@ -0,0 +1,256 @@
+package replica_test
+
+// File replicator_test.go tests the Replicator against a fake primary.
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/clock"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/replica"
+)
+
+// TestReplicator_resync checks that the replica takes the primary's dump afresh each time it reconnects, so that it
+// drops whatever it missed while disconnected.
+func TestReplicator_resync(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln, accepted := startPrimary(t)
+	defer ln.Close()
+	clk := clock.NewMock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	l, client, r := startReplica(ctx, t, ln.Addr().String(), 0, clk)
+
+	conn := accept(t, accepted)
+	serve(t, conn, list.CountResponse{Count: 2}, item(0, "a"), item(1, "b"))
+	r.awaitItem(t, "b")
+	checkHashes(ctx, t, client, "a", "b")
+
+	// The replica redials after backing off, and the primary has moved on in the meantime.
+	_ = conn.Close()
+	r.awaitLog(t, "lost primary")
+	clk.BlockUntil(1)
+	clk.Advance(time.Minute)
+	conn = accept(t, accepted)
+	defer conn.Close()
+	serve(t, conn, list.CountResponse{Count: 1}, item(0, "c"))
+	r.awaitItem(t, "c")
+	checkHashes(ctx, t, client, "c")
+
+	select {
+	case err := <-r.errc:
+		t.Fatalf("replicator stopped early: %v", err)
+	default:
+	}
+	if !l.IsReplica() {
+		t.Error("replica promoted itself with promotion off")
+	}
+}
+
+// TestReplicator_promote checks that the replica promotes itself once it has gone long enough without the primary.
+func TestReplicator_promote(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ln, accepted := startPrimary(t)
+	clk := clock.NewMock(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	l, _, r := startReplica(ctx, t, ln.Addr().String(), time.Minute, clk)
+
+	conn := accept(t, accepted)
+	serve(t, conn, list.CountResponse{Count: 1}, item(0, "a"))
+	r.awaitItem(t, "a")
+
+	// From now on, the primary refuses every redial.
+	_ = ln.Close()
+	_ = conn.Close()
+	for i := 0; i < 2; i++ {
+		r.awaitLog(t, "lost primary")
+		clk.BlockUntil(1)
+		select {
+		case err := <-r.errc:
+			t.Fatalf("replicator stopped after %d backoffs: %v", i, err)
+		default:
+		}
+		clk.Advance(30 * time.Second)
+	}
+
+	select {
+	case err := <-r.errc:
+		if err != nil {
+			t.Fatalf("unexpected error promoting: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("replica never promoted itself")
+	}
+	if l.IsReplica() {
+		t.Error("replica still a replica after promoting itself")
+	}
+}
+
+// startPrimary starts listening as a fake primary, returning the listener and a channel of the connections it accepts.
+func startPrimary(t *testing.T) (net.Listener, <-chan net.Conn) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("couldn't listen:", err)
+	}
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted <- conn
+		}
+	}()
+	return ln, accepted
+}
+
+// running is what a test can see of a running Replicator.
+type running struct {
+	// items receives the hash of each item the replica list broadcasts.
+	items chan string
+	// logs receives each line the Replicator logs.
+	logs chan string
+	// errc receives whatever the Replicator returns.
+	errc chan error
+}
+
+// Write sends each line logged into r.logs.
+func (r running) Write(p []byte) (int, error) {
+	r.logs <- string(p)
+	return len(p), nil
+}
+
+// startReplica starts a replica list, and a Replicator following primary on clk, until ctx ends.
+// It returns the list, a client of it, and what can be seen of the Replicator.
+func startReplica(ctx context.Context, t *testing.T, primary string, promoteAfter time.Duration, clk clock.Clock) (*list.List, *controller.Client, running) {
+	t.Helper()
+	l := list.New()
+	l.SetReplica(true)
+	ctl, client := controller.NewController(l)
+	go ctl.Run(ctx)
+
+	r := running{items: make(chan string, 16), logs: make(chan string, 64), errc: make(chan error, 1)}
+	go func() {
+		for rs := range client.Rx {
+			if rs, ok := rs.Body.(list.ItemResponse); ok {
+				r.items <- rs.Item.Hash()
+			}
+		}
+	}()
+
+	replClient, err := client.Copy(ctx)
+	if err != nil {
+		t.Fatal("couldn't copy client:", err)
+	}
+	rep := replica.New(log.New(r, "", 0), primary, promoteAfter, replClient)
+	rep.SetClock(clk)
+	go func() {
+		r.errc <- rep.Run(ctx)
+	}()
+	return l, client, r
+}
+
+// accept waits for the replica to connect to the fake primary.
+func accept(t *testing.T, accepted <-chan net.Conn) net.Conn {
+	t.Helper()
+	select {
+	case conn := <-accepted:
+		return conn
+	case <-time.After(5 * time.Second):
+		t.Fatal("replica never connected")
+		return nil
+	}
+}
+
+// serve greets the replica down conn as a list server, then broadcasts rbodies as its dump.
+func serve(t *testing.T, conn net.Conn, rbodies ...interface{}) {
+	t.Helper()
+	msgs := []message.Message{
+		*core.OhaiResponse{ProtocolVer: core.ThisProtocolVer, ServerVer: "test"}.Message(message.TagBcast),
+		*core.IamaResponse{Role: "list"}.Message(message.TagBcast),
+	}
+	msgTx := make(chan message.Message, 16)
+	for _, rbody := range rbodies {
+		if err := list.New().EmitBifrostResponse(message.TagBcast, rbody, msgTx); err != nil {
+			t.Fatalf("couldn't emit %v: %v", rbody, err)
+		}
+	}
+	close(msgTx)
+	for m := range msgTx {
+		msgs = append(msgs, m)
+	}
+
+	for _, m := range msgs {
+		bs, err := m.Pack()
+		if err != nil {
+			t.Fatalf("couldn't pack %v: %v", m, err)
+		}
+		if _, err := conn.Write(bs); err != nil {
+			t.Fatalf("couldn't send %v: %v", m, err)
+		}
+	}
+}
+
+// item gets the broadcast of a track with hash h at index i.
+func item(i int, h string) list.ItemResponse {
+	return list.ItemResponse{Index: i, Item: *list.NewTrack(h, h+".mp3")}
+}
+
+// awaitItem waits for the replica list to broadcast an item with hash h.
+func (r running) awaitItem(t *testing.T, h string) {
+	t.Helper()
+	for {
+		select {
+		case got := <-r.items:
+			if got == h {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("replica never got item %s", h)
+		}
+	}
+}
+
+// awaitLog waits for the Replicator to log a line starting with prefix.
+func (r running) awaitLog(t *testing.T, prefix string) {
+	t.Helper()
+	for {
+		select {
+		case got := <-r.logs:
+			if strings.HasPrefix(got, prefix) {
+				return
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("replicator never logged %q", prefix)
+		}
+	}
+}
+
+// checkHashes checks that the list behind client has items with hashes want, in order.
+func checkHashes(ctx context.Context, t *testing.T, client *controller.Client, want ...string) {
+	t.Helper()
+	m, err := list.DumpList(ctx, client)
+	if err != nil {
+		t.Fatal("couldn't dump list:", err)
+	}
+	var got []string
+	for _, it := range m.Items() {
+		got = append(got, it.Hash())
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("replica items: got %v, want %v", got, want)
+	}
+}
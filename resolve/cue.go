@@ -0,0 +1,141 @@
+package resolve
+
+// File cue.go contains Cuer, which loads each track selected on a list into the player.
+//
+// Resolving a payload can take a while, such as when it has to be downloaded, so the Cuer resolves and loads on a
+// goroutine of its own, leaving the list free to carry on.
+// If another track is selected first, the Cuer gives up on the old one and moves on to the new.
+// The track selected when the Cuer starts isn't loaded, as the player may be playing it already.
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// Loader is the type of functions that load the file at path into the player.
+type Loader func(ctx context.Context, path string) error
+
+// cue is a track waiting to be resolved and loaded.
+type cue struct {
+	// ctx ends when the track is no longer selected.
+	ctx context.Context
+	// payload is the track's payload.
+	payload string
+}
+
+// Cuer follows a list, and loads each track selected on it into the player, resolving its payload first.
+type Cuer struct {
+	// log is the Cuer's logger.
+	log *log.Logger
+
+	// resolver turns payloads into paths the player can load.
+	resolver Resolver
+
+	// load loads resolved paths into the player.
+	load Loader
+
+	// client is the controller Client the Cuer uses to follow the list.
+	client *controller.Client
+
+	// mirror is the Cuer's view of the list.
+	mirror *list.Mirror
+
+	// onCue, if non-nil, is called with the outcome of every cue.
+	onCue func(err error)
+}
+
+// NewCuer creates a new Cuer for a yaps list, resolving payloads with r and loading them with load.
+func NewCuer(l *log.Logger, r Resolver, load Loader, client *controller.Client) *Cuer {
+	return &Cuer{
+		log:      l,
+		resolver: r,
+		load:     load,
+		client:   client,
+		mirror:   list.NewMirror(),
+	}
+}
+
+// SetCueHook sets a function to be called, on the Cuer's loading goroutine, with the error from every cue, or nil if
+// the cue worked.
+// Cues given up on because another track was selected aren't reported.
+// It must be called before Run.
+func (c *Cuer) SetCueHook(f func(err error)) {
+	c.onCue = f
+}
+
+// Run loads selected tracks until ctx is cancelled or the controller shuts down.
+func (c *Cuer) Run(ctx context.Context) error {
+	ctx, cancelAll := context.WithCancel(ctx)
+	defer cancelAll()
+
+	var (
+		pending = make(chan cue, 1)
+		wg      sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		c.runLoads(ctx, pending)
+		wg.Done()
+	}()
+	defer wg.Wait()
+
+	cancel := func() {}
+	err := list.Follow(ctx, c.client, c.mirror, func(_ interface{}, selChanged bool) {
+		if !selChanged {
+			return
+		}
+		cancel()
+		// Only the newest selection is worth loading.
+		select {
+		case <-pending:
+		default:
+		}
+
+		_, item := c.mirror.Selection()
+		if item == nil || item.Type() != list.ItemTrack {
+			return
+		}
+		var cctx context.Context
+		cctx, cancel = context.WithCancel(ctx)
+		pending <- cue{ctx: cctx, payload: item.Payload()}
+	})
+	cancel()
+	return err
+}
+
+// runLoads resolves and loads each cue sent on pending, until ctx is cancelled.
+func (c *Cuer) runLoads(ctx context.Context, pending <-chan cue) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case cu := <-pending:
+			c.cue(cu)
+		}
+	}
+}
+
+// cue resolves and loads cu.
+func (c *Cuer) cue(cu cue) {
+	path, err := c.resolver.Resolve(cu.ctx, cu.payload)
+	if err == nil {
+		err = c.load(cu.ctx, path)
+	}
+	if cu.ctx.Err() != nil {
+		// Another track was selected, or the Cuer is stopping.
+		return
+	}
+
+	if err != nil {
+		c.log.Printf("couldn't load %q: %s\n", cu.payload, err)
+	} else {
+		c.log.Printf("loaded %q\n", path)
+	}
+	if c.onCue != nil {
+		c.onCue(err)
+	}
+}
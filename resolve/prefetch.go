@@ -0,0 +1,152 @@
+package resolve
+
+// File prefetch.go contains Prefetcher, which readies the tracks likely to be selected next on a list, so that
+// selecting them doesn't wait on slow sources.
+//
+// Whenever the selection, the automode, or the items change, the Prefetcher asks the list which tracks are upcoming
+// (see list.List.Upcoming) and resolves each it hasn't already readied, which downloads those named by URL into the
+// cache ahead of time; it then tells its hook, if any, where each now is, so that players that can preload do so.
+// As with Cuer, this happens on a goroutine of its own, and only the newest prediction is worth acting on.
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// Hook is the type of functions told the path of each track readied ahead of its selection.
+type Hook func(ctx context.Context, path string) error
+
+// Prefetcher follows a list, and readies the tracks likely to be selected next on it.
+type Prefetcher struct {
+	// log is the Prefetcher's logger.
+	log *log.Logger
+
+	// resolver turns payloads into paths the player can load.
+	resolver Resolver
+
+	// hook, if non-nil, is told the path of each readied track.
+	hook Hook
+
+	// count is the number of upcoming tracks to ready.
+	count int
+
+	// client is the controller Client the Prefetcher uses to follow and query the list.
+	client *controller.Client
+
+	// mirror is the Prefetcher's view of the list.
+	mirror *list.Mirror
+
+	// ready holds the payloads of the tracks readied in the last prediction, so they aren't readied again.
+	ready map[string]struct{}
+}
+
+// NewPrefetcher creates a new Prefetcher readying up to count tracks on a yaps list, resolving payloads with r.
+func NewPrefetcher(l *log.Logger, r Resolver, count int, client *controller.Client) *Prefetcher {
+	return &Prefetcher{
+		log:      l,
+		resolver: r,
+		count:    count,
+		client:   client,
+		mirror:   list.NewMirror(),
+		ready:    make(map[string]struct{}),
+	}
+}
+
+// SetHook sets a function to be told, on the Prefetcher's readying goroutine, the path of each track readied.
+// It must be called before Run.
+func (p *Prefetcher) SetHook(h Hook) {
+	p.hook = h
+}
+
+// Run readies upcoming tracks until ctx is cancelled or the controller shuts down.
+func (p *Prefetcher) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		// predict holds a token whenever the prediction may have changed since last acted on.
+		predict = make(chan struct{}, 1)
+		wg      sync.WaitGroup
+	)
+	wg.Add(1)
+	go func() {
+		p.runPredictions(ctx, predict)
+		wg.Done()
+	}()
+	defer wg.Wait()
+
+	return list.Follow(ctx, p.client, p.mirror, func(rbody interface{}, selChanged bool) {
+		switch rbody.(type) {
+		case nil, list.AutoModeResponse, list.ItemResponse, list.ItemRemoveResponse, list.ItemMoveResponse,
+			list.ItemValidityResponse:
+		default:
+			if !selChanged {
+				return
+			}
+		}
+		select {
+		case predict <- struct{}{}:
+		default:
+		}
+	})
+}
+
+// runPredictions readies the upcoming tracks each time predict receives, until ctx is cancelled.
+func (p *Prefetcher) runPredictions(ctx context.Context, predict <-chan struct{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-predict:
+			p.prefetch(ctx)
+		}
+	}
+}
+
+// prefetch readies the tracks upcoming now that p hasn't already readied.
+func (p *Prefetcher) prefetch(ctx context.Context) {
+	upcoming, err := list.Upcoming(ctx, p.client, p.count)
+	if err != nil {
+		if ctx.Err() == nil {
+			p.log.Println("couldn't predict upcoming tracks:", err)
+		}
+		return
+	}
+
+	ready := make(map[string]struct{}, len(upcoming))
+	for _, r := range upcoming {
+		payload := r.Item.Payload()
+		if _, ok := p.ready[payload]; ok {
+			ready[payload] = struct{}{}
+			continue
+		}
+		if err := p.prefetchOne(ctx, payload); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			p.log.Printf("couldn't prefetch %q: %s\n", payload, err)
+			continue
+		}
+		ready[payload] = struct{}{}
+	}
+	p.ready = ready
+}
+
+// prefetchOne resolves payload, and tells p's hook where it now is.
+func (p *Prefetcher) prefetchOne(ctx context.Context, payload string) error {
+	path, err := p.resolver.Resolve(ctx, payload)
+	if err != nil {
+		return err
+	}
+	if p.hook != nil {
+		if err := p.hook(ctx, path); err != nil {
+			return err
+		}
+	}
+	p.log.Printf("prefetched %q\n", path)
+	return nil
+}
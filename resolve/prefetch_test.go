@@ -0,0 +1,82 @@
+package resolve_test
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/resolve"
+)
+
+// TestPrefetcher tests that a Prefetcher readies the tracks after the selection as it moves, each once.
+func TestPrefetcher(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctl, client := controller.NewController(list.New())
+	go ctl.Run(ctx)
+	// The Controller waits for every client to take its broadcasts, including this one.
+	go func() {
+		for range client.Rx {
+		}
+	}()
+
+	for i, it := range []*list.Item{
+		list.NewTrack("a", "a.mp3"),
+		list.NewText("t", "text"),
+		list.NewTrack("b", "b.mp3"),
+		list.NewTrack("c", "c.mp3"),
+	} {
+		if err := list.AddItem(ctx, client, i, *it); err != nil {
+			t.Fatalf("adding %s: %v", it.Hash(), err)
+		}
+	}
+
+	pfClient, err := client.Copy(ctx)
+	if err != nil {
+		t.Fatalf("couldn't copy client: %v", err)
+	}
+	paths := make(chan string, 8)
+	pf := resolve.NewPrefetcher(log.New(io.Discard, "", 0), resolve.Path{Root: "/music"}, 1, pfClient)
+	pf.SetHook(func(_ context.Context, path string) error {
+		paths <- path
+		return nil
+	})
+	go func() { _ = pf.Run(ctx) }()
+
+	expect := func(want string) {
+		t.Helper()
+		select {
+		case got := <-paths:
+			if got != want {
+				t.Errorf("prefetched %q, want %q", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting to prefetch %q", want)
+		}
+	}
+
+	expect("/music/a.mp3")
+	if err := list.Select(ctx, client, 0, "a"); err != nil {
+		t.Fatalf("selecting: %v", err)
+	}
+	expect("/music/b.mp3")
+	if err := list.Select(ctx, client, 2, "b"); err != nil {
+		t.Fatalf("selecting: %v", err)
+	}
+	expect("/music/c.mp3")
+
+	// Adding a track after c leaves c next, and c is already readied, so nothing more should be prefetched.
+	if err := list.AddItem(ctx, client, 4, *list.NewTrack("d", "d.mp3")); err != nil {
+		t.Fatalf("adding d: %v", err)
+	}
+	select {
+	case got := <-paths:
+		t.Errorf("prefetched %q, want nothing", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,191 @@
+// Package resolve turns the payloads of list items into paths a player can load, so that items can name tracks by
+// library ID or by URL, as well as by path.
+//
+// Payloads are told apart by their scheme, the letters before the first colon: 'lib:<id>' names a track in the
+// station's library, 'http://...' and 'https://...' name tracks to download, and anything else, including Windows
+// paths such as 'C:\music\track.mp3', is a path.
+package resolve
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// LibraryScheme is the scheme of payloads naming tracks by library ID.
+	LibraryScheme = "lib"
+	// LibraryPlaceholder is what Library templates hold in place of the library ID.
+	LibraryPlaceholder = "{id}"
+
+	// DefaultTimeout is how long, by default, a URL resolver may take to download a track.
+	DefaultTimeout = time.Minute
+)
+
+// ErrUnsupported is the error returned when a payload's scheme has no resolver.
+var ErrUnsupported = errors.New("no resolver for this kind of payload")
+
+// Resolver is the interface of things that turn payloads into paths a player can load.
+type Resolver interface {
+	// Resolve gets the path the player should load for payload, doing whatever is needed, such as downloading it,
+	// to make that path loadable.
+	Resolve(ctx context.Context, payload string) (string, error)
+}
+
+// Schemes is a Resolver that passes each payload, whole, to the Resolver for its scheme.
+// The Resolver under the empty scheme gets payloads with no scheme, and those whose scheme isn't in the map.
+// A scheme mapped to nil refuses its payloads.
+type Schemes map[string]Resolver
+
+// Resolve resolves payload with the Resolver for its scheme.
+func (s Schemes) Resolve(ctx context.Context, payload string) (string, error) {
+	r, ok := s[Scheme(payload)]
+	if !ok {
+		r = s[""]
+	}
+	if r == nil {
+		return "", fmt.Errorf("%w: %q", ErrUnsupported, payload)
+	}
+	return r.Resolve(ctx, payload)
+}
+
+// Scheme gets the scheme of payload, in lower case, or the empty string if it has none.
+// Single letters before a colon are Windows drive letters, not schemes.
+func Scheme(payload string) string {
+	i := strings.IndexByte(payload, ':')
+	if i < 2 {
+		return ""
+	}
+	for j, c := range payload[:i] {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z':
+		case 0 < j && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return ""
+		}
+	}
+	return strings.ToLower(payload[:i])
+}
+
+// Path is a Resolver for payloads that are already paths.
+type Path struct {
+	// Root is the directory relative paths are taken from; if empty, they are passed on as they are.
+	Root string
+}
+
+// Resolve gets payload, relative to r's root.
+func (r Path) Resolve(_ context.Context, payload string) (string, error) {
+	if r.Root == "" || filepath.IsAbs(payload) {
+		return payload, nil
+	}
+	return filepath.Join(r.Root, payload), nil
+}
+
+// Library is a Resolver for payloads naming tracks by library ID, as 'lib:<id>'.
+type Library struct {
+	// template is the path of library tracks, with LibraryPlaceholder in place of the ID.
+	template string
+}
+
+// NewLibrary makes a Library finding tracks at template, which must hold LibraryPlaceholder in place of the ID.
+func NewLibrary(template string) (*Library, error) {
+	if !strings.Contains(template, LibraryPlaceholder) {
+		return nil, fmt.Errorf("library template %q doesn't contain %s", template, LibraryPlaceholder)
+	}
+	return &Library{template: template}, nil
+}
+
+// Resolve gets the path of the library track payload names.
+func (r *Library) Resolve(_ context.Context, payload string) (string, error) {
+	id := strings.TrimPrefix(payload, LibraryScheme+":")
+	// IDs go into a path, so mustn't be able to walk out of the library.
+	if id == "" || id == "." || id == ".." || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("bad library ID %q", id)
+	}
+	return strings.ReplaceAll(r.template, LibraryPlaceholder, id), nil
+}
+
+// URL is a Resolver for payloads naming tracks by http or https URL, which it downloads into a cache directory.
+// Each URL is downloaded once; later resolutions use the cached copy.
+type URL struct {
+	// cache is the directory downloads go into.
+	cache string
+	// http is the HTTP client used to download tracks.
+	http *http.Client
+}
+
+// NewURL makes a URL resolver downloading into the directory cache, creating it if needed, and taking up to timeout
+// over each download; a timeout of 0 means DefaultTimeout.
+func NewURL(cache string, timeout time.Duration) (*URL, error) {
+	if err := os.MkdirAll(cache, 0o755); err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &URL{cache: cache, http: &http.Client{Timeout: timeout}}, nil
+}
+
+// Resolve gets the path of the cached copy of the track at the URL payload, downloading it if it isn't cached.
+func (r *URL) Resolve(ctx context.Context, payload string) (string, error) {
+	u, err := url.Parse(payload)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("%w: %q", ErrUnsupported, payload)
+	}
+
+	// Keeping the extension lets players that go by it tell the track's format.
+	sum := sha256.Sum256([]byte(payload))
+	cached := filepath.Join(r.cache, hex.EncodeToString(sum[:16])+path.Ext(u.Path))
+	if _, err := os.Stat(cached); err == nil {
+		return cached, nil
+	}
+	return cached, r.download(ctx, payload, cached)
+}
+
+// download fetches the URL src into the file dst.
+// It downloads into a temporary file first, so that a download that fails part way is never taken to be cached.
+func (r *URL) download(ctx context.Context, src, dst string) error {
+	rq, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return err
+	}
+	rs, err := r.http.Do(rq)
+	if err != nil {
+		return err
+	}
+	defer rs.Body.Close()
+	if rs.StatusCode != http.StatusOK {
+		return fmt.Errorf("download of %q got status %s", src, rs.Status)
+	}
+
+	tmp, err := os.CreateTemp(r.cache, ".download-*")
+	if err != nil {
+		return err
+	}
+	if _, err = io.Copy(tmp, rs.Body); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err = os.Rename(tmp.Name(), dst); err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,113 @@
+package resolve_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/resolve"
+)
+
+// TestScheme tests that Scheme tells schemes apart from paths, including Windows ones.
+func TestScheme(t *testing.T) {
+	cases := map[string]string{
+		"lib:1234":               "lib",
+		"HTTPS://example.com/a":  "https",
+		"/music/track.mp3":       "",
+		`C:\music\track.mp3`:     "",
+		"music/a:b.mp3":          "",
+		"1lib:1234":              "",
+		"svn+ssh://example.com/": "svn+ssh",
+	}
+	for payload, want := range cases {
+		if got := resolve.Scheme(payload); got != want {
+			t.Errorf("Scheme(%q) = %q, want %q", payload, got, want)
+		}
+	}
+}
+
+// TestSchemes tests that Schemes sends payloads to the Resolver for their scheme, falling back to paths.
+func TestSchemes(t *testing.T) {
+	lib, err := resolve.NewLibrary("/library/{id}.mp3")
+	if err != nil {
+		t.Fatalf("couldn't make library: %s", err.Error())
+	}
+	r := resolve.Schemes{"": resolve.Path{Root: "/music"}, resolve.LibraryScheme: lib, "http": nil}
+
+	ctx := context.Background()
+	cases := map[string]string{
+		"lib:1234":       "/library/1234.mp3",
+		"jingles/id.mp3": filepath.Join("/music", "jingles/id.mp3"),
+		"/abs/track.mp3": "/abs/track.mp3",
+	}
+	for payload, want := range cases {
+		got, err := r.Resolve(ctx, payload)
+		if err != nil {
+			t.Errorf("unexpected error resolving %q: %s", payload, err.Error())
+		} else if got != want {
+			t.Errorf("resolving %q got %q, want %q", payload, got, want)
+		}
+	}
+
+	if _, err := r.Resolve(ctx, "http://example.com/a.mp3"); !errors.Is(err, resolve.ErrUnsupported) {
+		t.Errorf("resolving a refused scheme got error %v, want ErrUnsupported", err)
+	}
+	if _, err := r.Resolve(ctx, "lib:../../etc/passwd"); err == nil {
+		t.Error("resolving a library ID leaving the library should have failed")
+	}
+	if _, err := resolve.NewLibrary("/library/track.mp3"); err == nil {
+		t.Error("making a library without a placeholder should have failed")
+	}
+}
+
+// TestURL tests that a URL resolver downloads each track once, and keeps failed downloads out of its cache.
+func TestURL(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		if r.URL.Path != "/track.mp3" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("audio"))
+	}))
+	defer srv.Close()
+
+	cache := filepath.Join(t.TempDir(), "cache")
+	r, err := resolve.NewURL(cache, 0)
+	if err != nil {
+		t.Fatalf("couldn't make URL resolver: %s", err.Error())
+	}
+
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		path, err := r.Resolve(ctx, srv.URL+"/track.mp3")
+		if err != nil {
+			t.Fatalf("unexpected error resolving URL: %s", err.Error())
+		}
+		if filepath.Ext(path) != ".mp3" {
+			t.Errorf("cached path %q lost the track's extension", path)
+		}
+		if bs, err := os.ReadFile(path); err != nil || string(bs) != "audio" {
+			t.Errorf("cached track holds %q (error %v), want %q", bs, err, "audio")
+		}
+	}
+	if hits != 1 {
+		t.Errorf("server got %d requests, want 1", hits)
+	}
+
+	if _, err := r.Resolve(ctx, srv.URL+"/missing.mp3"); err == nil {
+		t.Error("resolving a missing track should have failed")
+	}
+	entries, err := os.ReadDir(cache)
+	if err != nil {
+		t.Fatalf("couldn't read cache: %s", err.Error())
+	}
+	if len(entries) != 1 {
+		t.Errorf("cache holds %d files, want 1", len(entries))
+	}
+}
@@ -0,0 +1,158 @@
+package rules
+
+// File engine.go contains Engine, which watches a list and fires matching rules.
+
+import (
+	"context"
+	"log"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// queueSize is the number of fired actions that can be waiting to be sent before new ones are dropped.
+const queueSize = 16
+
+// Engine watches a list's broadcasts and sends the actions of any rules they trigger.
+//
+// Rules whose actions trigger themselves (for example, 'when add then tloadl ...') will keep firing;
+// the Engine makes no attempt to detect this.
+type Engine struct {
+	// log is the Engine's logger.
+	log *log.Logger
+
+	// rules is the list of rules the Engine evaluates.
+	rules []Rule
+
+	// watch is the controller Client the Engine uses to follow the list.
+	watch *controller.Client
+
+	// act is the controller Client the Engine uses to send actions.
+	// It is separate from watch, as the Controller may block broadcasting to watch while handling an action.
+	act *controller.Client
+
+	// parser turns rule actions into request bodies.
+	parser controller.BifrostParser
+
+	// mirror is the Engine's view of the list.
+	mirror *list.Mirror
+
+	// items is the number of items the list had as of the last broadcast, used to spot it emptying.
+	items int
+}
+
+// New creates a new Engine evaluating rules on the list behind client.
+// The Engine copies client, so it needs to be able to talk to the Controller; parser parses rule actions.
+func New(ctx context.Context, l *log.Logger, rules []Rule, client *controller.Client, parser controller.BifrostParser) (*Engine, error) {
+	act, err := client.Copy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Engine{
+		log:    l,
+		rules:  rules,
+		watch:  client,
+		act:    act,
+		parser: parser,
+		mirror: list.NewMirror(),
+	}, nil
+}
+
+// Run evaluates rules until ctx is cancelled or the controller shuts down.
+func (e *Engine) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	queue := make(chan []string, queueSize)
+	done := make(chan struct{})
+	go func() {
+		e.runActions(ctx, queue)
+		close(done)
+	}()
+
+	err := list.Follow(ctx, e.watch, e.mirror, func(rbody interface{}, selChanged bool) {
+		for _, ev := range e.events(rbody, selChanged) {
+			e.fire(ev, queue)
+		}
+	})
+
+	close(queue)
+	<-done
+	return err
+}
+
+// events works out which events a broadcast rbody, having changed the selection if selChanged, represents.
+func (e *Engine) events(rbody interface{}, selChanged bool) []Event {
+	var evs []Event
+
+	if selChanged {
+		if _, item := e.mirror.Selection(); item != nil {
+			evs = append(evs, EventSelect)
+		} else {
+			evs = append(evs, EventDeselect)
+		}
+	}
+
+	switch rbody.(type) {
+	case list.ItemResponse:
+		evs = append(evs, EventAdd)
+	case list.AutoModeResponse:
+		evs = append(evs, EventAutoMode)
+	case list.ListNoteResponse:
+		evs = append(evs, EventNote)
+	case list.DriftResponse:
+		evs = append(evs, EventDrift)
+	}
+
+	// The list emptying is an event, but it staying empty through later changes isn't.
+	n := len(e.mirror.Items())
+	if 0 < e.items && n == 0 {
+		evs = append(evs, EventEmpty)
+	}
+	e.items = n
+	return evs
+}
+
+// fire queues the actions of every rule matching event ev.
+func (e *Engine) fire(ev Event, queue chan<- []string) {
+	for _, r := range e.rules {
+		if r.When != ev || !r.Holds(e.mirror) {
+			continue
+		}
+
+		select {
+		case queue <- r.Then:
+		default:
+			e.log.Printf("dropping action %v: too many actions pending\n", r.Then)
+		}
+	}
+}
+
+// runActions sends each queued action to the Controller, until queue closes.
+func (e *Engine) runActions(ctx context.Context, queue <-chan []string) {
+	// The action client receives broadcasts too, and must keep draining them.
+	go func() {
+		for range e.act.Rx {
+		}
+	}()
+	// Closing our request channel is how we hang up on the Controller.
+	defer close(e.act.Tx)
+
+	for action := range queue {
+		body, err := e.parser.ParseBifrostRequest(action[0], action[1:])
+		if err != nil {
+			e.log.Printf("bad action %v: %s\n", action, err.Error())
+			continue
+		}
+
+		ignore := func(controller.Response) error { return nil }
+		alive, err := e.act.SendAndProcessReplies(ctx, "", body, ignore)
+		if !alive {
+			return
+		}
+		if err != nil {
+			e.log.Printf("action %v failed: %s\n", action, err.Error())
+		}
+	}
+}
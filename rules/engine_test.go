@@ -0,0 +1,31 @@
+package rules
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// TestEngine_events_empty checks that only the change that empties the list fires EventEmpty.
+func TestEngine_events_empty(t *testing.T) {
+	e := &Engine{mirror: list.NewMirror()}
+	steps := []struct {
+		name  string
+		rbody interface{}
+		want  []Event
+	}{
+		{"dump", nil, nil},
+		{"note on an empty list", list.ListNoteResponse{Note: "hi"}, []Event{EventNote}},
+		{"add", list.ItemResponse{Index: 0, Item: *list.NewTrack("a", "a.mp3")}, []Event{EventAdd}},
+		{"remove", list.ItemRemoveResponse{Hash: "a"}, []Event{EventEmpty}},
+		{"version", list.VersionResponse{Version: 4}, nil},
+		{"note on an emptied list", list.ListNoteResponse{Note: "bye"}, []Event{EventNote}},
+	}
+	for _, s := range steps {
+		sel := e.mirror.Apply(s.rbody)
+		if got := e.events(s.rbody, sel); !reflect.DeepEqual(got, s.want) {
+			t.Errorf("%s: got events %v, want %v", s.name, got, s.want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+// Package rules provides a small automation engine that sends requests to a list when its broadcasts match rules.
+// Rules take the form 'when <event> [if <condition>] then <request>', and are configured in yaps.toml.
+package rules
+
+// File rule.go contains Rule, and the parsing and evaluation of rule events and conditions.
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// Event is the type of events on which rules can fire.
+type Event string
+
+const (
+	// EventSelect fires when a new item is selected.
+	EventSelect Event = "select"
+	// EventDeselect fires when the selection is cleared.
+	EventDeselect Event = "deselect"
+	// EventAdd fires when an item is added.
+	EventAdd Event = "add"
+	// EventEmpty fires when a change leaves a list that had items with none.
+	EventEmpty Event = "empty"
+	// EventAutoMode fires when the automode changes.
+	EventAutoMode Event = "automode"
+	// EventNote fires when the list note changes.
+	EventNote Event = "note"
+	// EventDrift fires when the running order's drift is announced.
+	EventDrift Event = "drift"
+)
+
+// ParseEvent tries to parse an Event from a string.
+func ParseEvent(s string) (Event, error) {
+	switch e := Event(s); e {
+	case EventSelect, EventDeselect, EventAdd, EventEmpty, EventAutoMode, EventNote, EventDrift:
+		return e, nil
+	default:
+		return "", fmt.Errorf("unknown rule event: %s", s)
+	}
+}
+
+// Rule is a single parsed automation rule.
+type Rule struct {
+	// When is the event on which the rule fires.
+	When Event
+	// If is the list of conditions, all of which must hold for the rule to fire.
+	// Values containing spaces, the word 'and', or operators must be quoted, as in "category = 'rock and roll'".
+	If []Condition
+	// Then is the tokenised Bifrost request line (word and arguments, no tag) to send when the rule fires.
+	Then []string
+}
+
+// Parse parses a rule from its event, condition, and action strings.
+// The condition may be empty; otherwise it is a list of conditions separated by the word 'and'.
+// The action is a Bifrost request line without a tag, for example "auto shuffle".
+func Parse(when, cond, then string) (Rule, error) {
+	var (
+		r   Rule
+		err error
+	)
+
+	if r.When, err = ParseEvent(when); err != nil {
+		return r, err
+	}
+
+	if r.If, err = parseConditions(cond); err != nil {
+		return r, err
+	}
+
+	tok := message.NewTokeniser()
+	_, ok, line := tok.TokeniseBytes([]byte(then + "\n"))
+	if !ok || len(line) == 0 {
+		return r, fmt.Errorf("bad rule action: %q", then)
+	}
+	r.Then = line
+
+	return r, nil
+}
+
+// Holds checks whether all of r's conditions hold on mirror m.
+func (r Rule) Holds(m *list.Mirror) bool {
+	for _, c := range r.If {
+		if !c.Holds(m) {
+			return false
+		}
+	}
+	return true
+}
+
+// Condition is a single comparison between a property of the list and a constant.
+type Condition struct {
+	// Key is the name of the list property: one of automode, count, selected, or category.
+	Key string
+	// Op is the comparison operator: one of =, !=, <, <=, >, or >=.
+	Op string
+	// Value is the constant against which the property is compared.
+	Value string
+}
+
+// conditionOps is the list of condition operators, longest first so that <= isn't mistaken for <.
+var conditionOps = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+// ParseCondition tries to parse a Condition from a string of the form 'key op value'.
+func ParseCondition(s string) (Condition, error) {
+	cs, err := parseConditions(s)
+	if err != nil {
+		return Condition{}, err
+	}
+	if len(cs) != 1 {
+		return Condition{}, fmt.Errorf("bad rule condition: %q", s)
+	}
+	return cs[0], nil
+}
+
+// parseConditions parses a list of conditions, separated by the word 'and', from s.
+// An empty s has no conditions.
+func parseConditions(s string) ([]Condition, error) {
+	toks, err := lexCondition(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var cs []Condition
+	for len(toks) != 0 {
+		if len(cs) != 0 {
+			if toks[0].kind != tokenWord || toks[0].text != "and" {
+				return nil, fmt.Errorf("bad rule condition: %q: expected 'and' before %q", s, toks[0].text)
+			}
+			toks = toks[1:]
+		}
+		if len(toks) < 3 || toks[0].kind != tokenWord || toks[1].kind != tokenOp || toks[2].kind == tokenOp {
+			return nil, fmt.Errorf("bad rule condition: %q", s)
+		}
+
+		c := Condition{Key: toks[0].text, Op: toks[1].text, Value: toks[2].text}
+		switch c.Key {
+		case "automode", "count", "selected", "category":
+		default:
+			return nil, fmt.Errorf("unknown rule condition key: %s", c.Key)
+		}
+		cs = append(cs, c)
+		toks = toks[3:]
+	}
+	return cs, nil
+}
+
+// tokenKind is the type of kinds of condition token.
+type tokenKind int
+
+const (
+	// tokenWord is a bare word, such as a key, an unquoted value, or 'and'.
+	tokenWord tokenKind = iota
+	// tokenQuoted is a quoted value.
+	tokenQuoted
+	// tokenOp is a comparison operator.
+	tokenOp
+)
+
+// token is a single token of a condition.
+type token struct {
+	// kind is the kind of token.
+	kind tokenKind
+	// text is the token's text, without any quotes.
+	text string
+}
+
+// lexCondition splits s into words, quoted values, and operators.
+// Words end at spaces, quotes, and operators, so 'count>=3' lexes the same as 'count >= 3'.
+func lexCondition(s string) ([]token, error) {
+	var toks []token
+	for {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			return toks, nil
+		}
+
+		if op := leadingOp(s); op != "" {
+			toks = append(toks, token{kind: tokenOp, text: op})
+			s = s[len(op):]
+			continue
+		}
+
+		if q := s[0]; q == '\'' || q == '"' {
+			end := strings.IndexByte(s[1:], q)
+			if end < 0 {
+				return nil, fmt.Errorf("bad rule condition: unterminated quote in %q", s)
+			}
+			toks = append(toks, token{kind: tokenQuoted, text: s[1 : end+1]})
+			s = s[end+2:]
+			continue
+		}
+
+		end := strings.IndexFunc(s, func(r rune) bool {
+			return r == ' ' || r == '\t' || r == '\'' || r == '"' || strings.ContainsRune("!<>=", r)
+		})
+		if end < 0 {
+			end = len(s)
+		}
+		if end == 0 {
+			// A lone '!' isn't an operator.
+			return nil, fmt.Errorf("bad rule condition: unexpected %q", s[:1])
+		}
+		toks = append(toks, token{kind: tokenWord, text: s[:end]})
+		s = s[end:]
+	}
+}
+
+// leadingOp gets the operator at the start of s, or "" if there isn't one.
+func leadingOp(s string) string {
+	for _, op := range conditionOps {
+		if strings.HasPrefix(s, op) {
+			return op
+		}
+	}
+	return ""
+}
+
+// Holds checks whether c holds on mirror m.
+func (c Condition) Holds(m *list.Mirror) bool {
+	got := c.property(m)
+
+	switch c.Op {
+	case "=":
+		return got == c.Value
+	case "!=":
+		return got != c.Value
+	}
+
+	// Ordering comparisons are only meaningful on numbers.
+	x, xerr := strconv.Atoi(got)
+	y, yerr := strconv.Atoi(c.Value)
+	if xerr != nil || yerr != nil {
+		return false
+	}
+	switch c.Op {
+	case "<":
+		return x < y
+	case "<=":
+		return x <= y
+	case ">=":
+		return x >= y
+	default:
+		return x > y
+	}
+}
+
+// property gets the current value of c's key on m, as a string.
+func (c Condition) property(m *list.Mirror) string {
+	switch c.Key {
+	case "automode":
+		return m.AutoMode().String()
+	case "count":
+		return strconv.Itoa(len(m.Items()))
+	case "selected":
+		if _, item := m.Selection(); item != nil {
+			return item.Hash()
+		}
+	case "category":
+		if _, item := m.Selection(); item != nil {
+			return item.Category()
+		}
+	}
+	return ""
+}
@@ -0,0 +1,123 @@
+package rules_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/rules"
+)
+
+// TestParse_Holds checks that parsed rule conditions evaluate against a mirrored list.
+func TestParse_Holds(t *testing.T) {
+	r, err := rules.Parse("deselect", "automode = off and count > 1", "auto 'shuffle'")
+	if err != nil {
+		t.Fatal("unexpected parse error:", err)
+	}
+	if r.When != rules.EventDeselect {
+		t.Errorf("event: got %s, want %s", r.When, rules.EventDeselect)
+	}
+	if len(r.Then) != 2 || r.Then[0] != "auto" || r.Then[1] != "shuffle" {
+		t.Errorf("action: got %v, want [auto shuffle]", r.Then)
+	}
+
+	m := list.NewMirror()
+	m.Apply(list.FreezeResponse{*list.NewTrack("abc", "foo.mp3")})
+	if r.Holds(m) {
+		t.Error("rule held with only one item")
+	}
+
+	m.Apply(list.ItemResponse{Index: 1, Item: *list.NewTrack("def", "bar.mp3")})
+	if !r.Holds(m) {
+		t.Error("rule didn't hold with two items and automode off")
+	}
+
+	m.Apply(list.AutoModeResponse{AutoMode: list.AutoNext})
+	if r.Holds(m) {
+		t.Error("rule held with automode next")
+	}
+}
+
+// TestParse_Invalid checks that malformed rules are rejected.
+func TestParse_Invalid(t *testing.T) {
+	cases := []struct{ when, cond, then string }{
+		{"never", "", "auto off"},
+		{"select", "volume = 11", "auto off"},
+		{"select", "automode", "auto off"},
+		{"select", "", ""},
+		{"select", "category = rock and roll", "auto off"},
+		{"select", "category = 'rock", "auto off"},
+		{"select", "count > 1 and", "auto off"},
+		{"select", "count > 1 count < 3", "auto off"},
+		{"select", "count =< 3", "auto off"},
+		{"select", "count ! 3", "auto off"},
+	}
+
+	for _, c := range cases {
+		if _, err := rules.Parse(c.when, c.cond, c.then); err == nil {
+			t.Errorf("rule %v parsed without error", c)
+		}
+	}
+}
+
+// TestParseCondition checks that conditions tokenise around their operators and quotes, whatever the spacing.
+func TestParseCondition(t *testing.T) {
+	cases := []struct {
+		in   string
+		want rules.Condition
+	}{
+		{"count >= 3", rules.Condition{Key: "count", Op: ">=", Value: "3"}},
+		{"count<=3", rules.Condition{Key: "count", Op: "<=", Value: "3"}},
+		{"automode!=off", rules.Condition{Key: "automode", Op: "!=", Value: "off"}},
+		{"category = 'rock and roll'", rules.Condition{Key: "category", Op: "=", Value: "rock and roll"}},
+		{`category="a<b"`, rules.Condition{Key: "category", Op: "=", Value: "a<b"}},
+	}
+	for _, c := range cases {
+		got, err := rules.ParseCondition(c.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.in, err)
+		} else if got != c.want {
+			t.Errorf("%q: got %+v, want %+v", c.in, got, c.want)
+		}
+	}
+
+	if _, err := rules.ParseCondition("count > 1 and count < 3"); err == nil {
+		t.Error("ParseCondition took two conditions")
+	}
+}
+
+// TestParse_HoldsOrdering checks the ordering operators, and that a quoted value may contain 'and'.
+func TestParse_HoldsOrdering(t *testing.T) {
+	m := list.NewMirror()
+	m.Apply(list.FreezeResponse{*list.NewTrack("abc", "foo.mp3"), *list.NewTrack("def", "bar.mp3")})
+
+	cases := []struct {
+		cond string
+		want bool
+	}{
+		{"count >= 2", true},
+		{"count >= 3", false},
+		{"count <= 2", true},
+		{"count <= 1", false},
+		{"count < 3 and count > 1", true},
+		{"selected = 'a and b' and count = 2", false},
+	}
+	for _, c := range cases {
+		r, err := rules.Parse("select", c.cond, "auto off")
+		if err != nil {
+			t.Errorf("%q: unexpected parse error: %v", c.cond, err)
+			continue
+		}
+		if got := r.Holds(m); got != c.want {
+			t.Errorf("%q: got %v, want %v", c.cond, got, c.want)
+		}
+	}
+
+	r, err := rules.Parse("select", "selected != 'a and b' and count = 2", "auto off")
+	if err != nil {
+		t.Fatal("unexpected parse error:", err)
+	}
+	if got := fmt.Sprint(r.If); got != "[{selected != a and b} {count = 2}]" {
+		t.Errorf("conditions: got %s, want [{selected != a and b} {count = 2}]", got)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+// File secrets.go contains the 'secrets-keygen' and 'seal-secret' subcommands.
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MattWindsor91/yaps/config"
+)
+
+// runSecretsKeygen prints a new secrets key.
+func runSecretsKeygen(args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: secrets-keygen > keyfile")
+	}
+	key, err := config.NewSecretsKey()
+	if err != nil {
+		return err
+	}
+	fmt.Println(config.FormatSecretsKey(key))
+	return nil
+}
+
+// runSealSecret seals the first line of stdin under the secrets key, printing it as a secrets file entry.
+func runSealSecret(args []string) error {
+	fs := flag.NewFlagSet("seal-secret", flag.ContinueOnError)
+	keyFile := fs.String("key", "", "file holding the secrets key (default: the "+config.DefaultSecretsKeyEnv+" environment variable)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: seal-secret [-key keyfile] name < value >> secrets.toml")
+	}
+
+	key, err := config.Secrets{KeyFile: *keyFile}.Key()
+	if err != nil {
+		return err
+	}
+
+	value, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && value == "" {
+		return fmt.Errorf("couldn't read the secret from stdin: %w", err)
+	}
+	sealed, err := config.SealSecret(key, strings.TrimRight(value, "\r\n"))
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%q = %q\n", fs.Arg(0), sealed)
+	return nil
+}
@@ -0,0 +1,299 @@
+// Package selftest checks that a yaps installation works, by starting a list controller and net server in-process
+// and running a scripted client through them.
+//
+// The client goes through the handshake, a dump, adding an item, selecting it, and shutting the server down; each
+// step either passes or fails, and the self-test stops at the first failure.
+package selftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/core"
+	"github.com/UniversityRadioYork/bifrost-go/message"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/netsrv"
+)
+
+const (
+	// DefaultTimeout is how long, by default, each step may take before it fails.
+	DefaultTimeout = 5 * time.Second
+
+	// testHash and testPath are the hash and path of the item the self-test adds.
+	testHash = "selftest"
+	testPath = "/selftest/track.mp3"
+)
+
+// step is one step of the self-test.
+type step struct {
+	// name names the step in the report.
+	name string
+	// run runs the step against the session s.
+	run func(s *session) error
+}
+
+// steps is the script of the self-test, in order.
+var steps = []step{
+	{"handshake", (*session).handshake},
+	{"dump", (*session).dump},
+	{"add", (*session).add},
+	{"select", (*session).sel},
+	{"shutdown", (*session).shutdown},
+}
+
+// session is the state of a running self-test.
+type session struct {
+	// conn is the scripted client's connection to the server.
+	conn net.Conn
+	// r reads Bifrost lines from conn.
+	r *message.Reader
+	// root is the controller client that the net server uses.
+	root *controller.Client
+	// done closes when both the list controller and net server have stopped.
+	done <-chan struct{}
+	// timeout is how long each step may take.
+	timeout time.Duration
+}
+
+// Run starts a yaps server in-process, runs the scripted client through it, and writes 'PASS <step>' or
+// 'FAIL <step>: <reason>' to out for each step; it returns an error if any step failed.
+// Each step may take up to timeout; if l is non-nil, the server logs to it.
+func Run(ctx context.Context, out io.Writer, timeout time.Duration, l *log.Logger) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if l == nil {
+		l = log.New(io.Discard, "", 0)
+	}
+
+	s, err := start(ctx, timeout, l)
+	if err != nil {
+		fmt.Fprintf(out, "FAIL start: %s\n", err)
+		return fmt.Errorf("couldn't start the server: %w", err)
+	}
+	defer s.conn.Close()
+	fmt.Fprintln(out, "PASS start")
+
+	for _, st := range steps {
+		if err := s.conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+		if err := st.run(s); err != nil {
+			fmt.Fprintf(out, "FAIL %s: %s\n", st.name, err)
+			return fmt.Errorf("step %s failed: %w", st.name, err)
+		}
+		fmt.Fprintf(out, "PASS %s\n", st.name)
+	}
+	return nil
+}
+
+// start starts a list controller and net server, and connects the scripted client to it.
+func start(ctx context.Context, timeout time.Duration, l *log.Logger) (*session, error) {
+	address, err := freeAddress()
+	if err != nil {
+		return nil, err
+	}
+
+	con, root := controller.NewController(list.New())
+	srv := netsrv.New(l, address, root)
+
+	conDone, srvDone := make(chan struct{}), make(chan struct{})
+	go func() {
+		con.Run(ctx)
+		close(conDone)
+	}()
+	go func() {
+		srv.Run(ctx)
+		close(srvDone)
+	}()
+	done := make(chan struct{})
+	go func() {
+		<-conDone
+		<-srvDone
+		close(done)
+	}()
+
+	conn, err := dial(address, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &session{conn: conn, r: message.NewReader(conn), root: root, done: done, timeout: timeout}, nil
+}
+
+// freeAddress gets a local address on which nothing is listening.
+func freeAddress() (string, error) {
+	ln, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return "", err
+	}
+	defer ln.Close()
+	return ln.Addr().String(), nil
+}
+
+// dial connects to the server at address, retrying for up to timeout while it starts up.
+func dial(address string, timeout time.Duration) (net.Conn, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		conn, err := net.Dial("tcp", address)
+		if err == nil || deadline.Before(time.Now()) {
+			return conn, err
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// send sends the request with tag tag, word word, and arguments args to the server.
+func (s *session) send(tag, word string, args ...string) error {
+	bs, err := message.New(tag, word).AddArgs(args...).Pack()
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Write(bs)
+	return err
+}
+
+// read reads the next message from the server.
+func (s *session) read() (*message.Message, error) {
+	line, err := s.r.ReadLine()
+	if err != nil {
+		return nil, err
+	}
+	return message.NewFromLine(line)
+}
+
+// expect reads messages from the server until one has word word, failing if an ACK for tag tag comes first.
+func (s *session) expect(tag, word string) (*message.Message, error) {
+	for {
+		m, err := s.read()
+		if err != nil {
+			return nil, fmt.Errorf("waiting for %s: %w", word, err)
+		}
+		if m.Word() == word {
+			return m, nil
+		}
+		if m.Tag() == tag && m.Word() == core.RsAck {
+			return nil, fmt.Errorf("got ACK %s before %s", strings.Join(m.Args(), " "), word)
+		}
+	}
+}
+
+// checkAck fails if the ACK m isn't successful.
+func checkAck(m *message.Message, word string) error {
+	if args := m.Args(); len(args) == 0 || args[0] != "OK" {
+		return fmt.Errorf("%s failed: %s", word, strings.Join(args, " "))
+	}
+	return nil
+}
+
+// request sends a request with tag tag, word word, and arguments args, then waits for a broadcast with word bcast
+// and the request's own successful ACK, in either order.
+func (s *session) request(bcast, tag, word string, args ...string) (*message.Message, error) {
+	if err := s.send(tag, word, args...); err != nil {
+		return nil, err
+	}
+
+	var got *message.Message
+	acked := false
+	for got == nil || !acked {
+		m, err := s.read()
+		if err != nil {
+			return nil, fmt.Errorf("waiting for %s: %w", word, err)
+		}
+		switch {
+		case m.Word() == bcast:
+			got = m
+		case m.Tag() == tag && m.Word() == core.RsAck:
+			if err := checkAck(m, word); err != nil {
+				return nil, err
+			}
+			acked = true
+		}
+	}
+	return got, nil
+}
+
+// handshake checks that the server greets the client with OHAI and IAMA.
+func (s *session) handshake() error {
+	if _, err := s.expect(message.TagBcast, core.RsOhai); err != nil {
+		return err
+	}
+	_, err := s.expect(message.TagBcast, core.RsIama)
+	return err
+}
+
+// dump checks that the server answers a dump, and that the list starts out empty.
+func (s *session) dump() error {
+	if err := s.send("st-dump", controller.RqDump); err != nil {
+		return err
+	}
+	for {
+		m, err := s.read()
+		if err != nil {
+			return fmt.Errorf("waiting for the dump: %w", err)
+		}
+		if m.Tag() != "st-dump" {
+			continue
+		}
+		switch m.Word() {
+		case core.RsAck:
+			return checkAck(m, controller.RqDump)
+		case list.RsFloadl, list.RsTloadl:
+			return fmt.Errorf("list isn't empty: got %s", strings.Join(m.Args(), " "))
+		}
+	}
+}
+
+// add checks that the server adds an item, and announces it.
+func (s *session) add() error {
+	m, err := s.request(list.RsFloadl, "st-add", list.RqFloadl, "0", testHash, testPath)
+	if err != nil {
+		return err
+	}
+	if args := m.Args(); len(args) < 3 || args[1] != testHash || args[2] != testPath {
+		return fmt.Errorf("announced the wrong item: %s", strings.Join(args, " "))
+	}
+	return nil
+}
+
+// sel checks that the server selects the item added earlier, and announces it.
+func (s *session) sel() error {
+	m, err := s.request(list.RsSel, "st-sel", list.RqSel, "0", testHash)
+	if err != nil {
+		return err
+	}
+	if args := m.Args(); len(args) < 2 || args[0] != "0" || args[1] != testHash {
+		return fmt.Errorf("announced the wrong selection: %s", strings.Join(args, " "))
+	}
+	return nil
+}
+
+// shutdown checks that the server shuts down cleanly, hanging up on the client.
+func (s *session) shutdown() error {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	if err := s.root.Shutdown(ctx); err != nil {
+		return err
+	}
+
+	for {
+		if _, err := s.read(); errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("waiting for hangup: %w", err)
+		}
+	}
+
+	select {
+	case <-s.done:
+		return nil
+	case <-ctx.Done():
+		return errors.New("server didn't stop")
+	}
+}
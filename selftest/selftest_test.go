@@ -0,0 +1,29 @@
+package selftest_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/selftest"
+)
+
+// TestRun checks that the self-test passes every step against a fresh server.
+func TestRun(t *testing.T) {
+	var out bytes.Buffer
+	if err := selftest.Run(context.Background(), &out, selftest.DefaultTimeout, nil); err != nil {
+		t.Fatalf("self-test failed: %v\n%s", err, out.String())
+	}
+
+	want := []string{"start", "handshake", "dump", "add", "select", "shutdown"}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(want) {
+		t.Fatalf("got report %q, want one line for each of %v", out.String(), want)
+	}
+	for i, w := range want {
+		if lines[i] != "PASS "+w {
+			t.Errorf("line %d: got %q, want %q", i+1, lines[i], "PASS "+w)
+		}
+	}
+}
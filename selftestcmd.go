@@ -0,0 +1,33 @@
+package main
+
+// File selftestcmd.go contains the 'selftest' subcommand, a one-command sanity check after installing or upgrading
+// yaps.
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+
+	"github.com/MattWindsor91/yaps/selftest"
+	"github.com/MattWindsor91/yaps/server"
+)
+
+// runSelftest runs the scripted self-test against a server started in-process, reporting each step to stdout.
+func runSelftest(args []string) error {
+	fs := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	timeout := fs.Duration("timeout", selftest.DefaultTimeout, "how long each step may take before it fails")
+	verbose := fs.Bool("v", false, "log the in-process server to stderr")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New("usage: selftest [flags]")
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	return selftest.Run(ctx, os.Stdout, *timeout, server.NewLogger("selftest", *verbose))
+}
@@ -0,0 +1,48 @@
+package server
+
+// File audit.go contains the Server's audit log, which it keeps in its storage alongside the list, so that tunable
+// changes and admin denials outlive the root log.
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/store"
+)
+
+// audit keeps e in s's audit log, logging, rather than returning, any error, as nothing waits on the audit log.
+func (s *Server) audit(e store.AuditEntry) {
+	if err := s.st.AppendAudit(listName(s.lstConf), e); err != nil {
+		s.log.Printf("couldn't keep audit entry: %v\n", err)
+	}
+}
+
+// auditTune keeps the tunable change c in s's audit log.
+func (s *Server) auditTune(c controller.TuneChange) {
+	var user string
+	if c.Identity != nil {
+		user = c.Identity.User
+	}
+	s.audit(store.AuditEntry{
+		At:     time.Now(),
+		User:   user,
+		Action: store.AuditTune,
+		Detail: fmt.Sprintf("%s: %s -> %s", c.Name, c.Old, c.New),
+	})
+}
+
+// auditDenied keeps the request r, refused because the client of the connection cname wasn't an admin, in s's audit
+// log.
+func (s *Server) auditDenied(cname string, r controller.DeniedRequest) {
+	var user string
+	if id := r.Err.Identity; id != nil {
+		user = id.User
+	}
+	s.audit(store.AuditEntry{
+		At:     time.Now(),
+		User:   user,
+		Action: store.AuditDenied,
+		Detail: fmt.Sprintf("%s: %s %s needs group %q", cname, r.Tag, r.Word, r.Err.Group),
+	})
+}
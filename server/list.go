@@ -0,0 +1,92 @@
+package server
+
+// File list.go contains the conversion of list configuration into the settings of the list a Server runs.
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/MattWindsor91/yaps/config"
+	"github.com/MattWindsor91/yaps/history"
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/store"
+)
+
+// listName gets the name under which the list configured by lcfg keeps its state.
+func listName(lcfg config.List) string {
+	if lcfg.Name == "" {
+		return "main"
+	}
+	return lcfg.Name
+}
+
+// makeCategories converts category definitions from the config into list categories.
+func makeCategories(ccfgs []config.Category) []list.Category {
+	cats := make([]list.Category, len(ccfgs))
+	for i, c := range ccfgs {
+		cats[i] = list.Category{Name: c.Name, Colour: c.Colour}
+	}
+	return cats
+}
+
+// makeMaintenanceWindows converts maintenance windows from the config into list maintenance windows.
+func makeMaintenanceWindows(mcfgs []config.Maintenance) ([]list.MaintenanceWindow, error) {
+	ws := make([]list.MaintenanceWindow, len(mcfgs))
+	for i, m := range mcfgs {
+		w, err := list.ParseMaintenanceWindow(m.Days, m.At, m.Duration, m.Reason)
+		if err != nil {
+			return nil, err
+		}
+		ws[i] = w
+	}
+	return ws, nil
+}
+
+// makeSeparators converts separator definitions from the config into list separators.
+func makeSeparators(scfgs []config.Separator) []list.Separator {
+	seps := make([]list.Separator, len(scfgs))
+	for i, s := range scfgs {
+		seps[i] = list.Separator{Name: s.Name, Text: s.Text, Note: s.Note, Category: s.Category}
+	}
+	return seps
+}
+
+// makeRecovery makes the function that rebuilds the list configured by lcfg, kept in st, from its play history when
+// its saved state is missing or unusable, or returns nil if lcfg doesn't ask for recovery.
+// The history comes from playLog if it isn't nil, and from st otherwise.
+func makeRecovery(lcfg config.List, st store.Storage, playLog *history.File, l *log.Logger) store.Recovery {
+	if lcfg.RecoverWindow <= 0 {
+		return nil
+	}
+	var plays list.PlayLog = store.PlayLog(st, listName(lcfg))
+	if playLog != nil {
+		plays = playLog
+	}
+	return func(cause error) (list.State, error) {
+		reason := "there is no saved list"
+		if cause != nil {
+			reason = cause.Error()
+		}
+		l.Printf("%s; rebuilding the list from the last %s of play history\n", reason, lcfg.RecoverWindow)
+		return list.RecoverState(plays, time.Now().Add(-lcfg.RecoverWindow))
+	}
+}
+
+// makeRepairReport makes the function that logs repairs to the saved list configured by lcfg, or nil if lcfg refuses
+// to repair it.
+func makeRepairReport(lcfg config.List, l *log.Logger) (store.RepairReport, error) {
+	switch lcfg.Integrity {
+	case "", "refuse":
+		return nil, nil
+	case "repair":
+		return func(repairs []string) {
+			l.Printf("the saved list was corrupt; made %d repair(s):\n", len(repairs))
+			for _, r := range repairs {
+				l.Printf("  %s\n", r)
+			}
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown integrity policy %q", lcfg.Integrity)
+	}
+}
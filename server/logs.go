@@ -0,0 +1,76 @@
+package server
+
+// File logs.go contains the loggers of each subsystem, which admins can turn on and off at runtime with
+// 'tune log.<section> <true|false>', whatever the config says.
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/MattWindsor91/yaps/controller"
+)
+
+// errNotRunning is the reason given for turning on the logging of a subsystem that isn't running.
+var errNotRunning = errors.New("the subsystem isn't running")
+
+// tunableLogs are the sections whose logging the config can turn on and off, and so can admins.
+var tunableLogs = []string{"automation", "icy", "net", "nowplaying", "replica", "snapshot", "watchdog"}
+
+var (
+	// loggersMu guards loggers.
+	loggersMu sync.Mutex
+	// loggers maps each section to the loggers made for it.
+	loggers = make(map[string][]*log.Logger)
+)
+
+// NewLogger makes a logger for the subsystem called section, which logs to stderr if enabled and nowhere otherwise.
+func NewLogger(section string, enabled bool) *log.Logger {
+	l := log.New(logWriter(enabled), "["+section+"] ", log.LstdFlags)
+
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+	loggers[section] = append(loggers[section], l)
+	return l
+}
+
+// logWriter gets where a logger logs if enabled, and otherwise.
+func logWriter(enabled bool) io.Writer {
+	if enabled {
+		return os.Stderr
+	}
+	return io.Discard
+}
+
+// logTunable makes a tunable turning the loggers of section on and off.
+// A section with no loggers, such as that of a subsystem the config turns off, is off, and can't be turned on.
+func logTunable(section string) controller.Tunable {
+	return controller.Tunable{
+		Name: "log." + section,
+		Doc:  "Whether the " + section + " subsystem logs: true or false.",
+		Get: func() string {
+			loggersMu.Lock()
+			defer loggersMu.Unlock()
+			ls := loggers[section]
+			return strconv.FormatBool(len(ls) != 0 && ls[len(ls)-1].Writer() != io.Discard)
+		},
+		Set: func(v string) error {
+			enabled, err := strconv.ParseBool(v)
+			if err != nil {
+				return err
+			}
+			loggersMu.Lock()
+			defer loggersMu.Unlock()
+			if len(loggers[section]) == 0 {
+				return errNotRunning
+			}
+			for _, l := range loggers[section] {
+				l.SetOutput(logWriter(enabled))
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,420 @@
+// Package server runs a whole yaps instance—the list controller and every subsystem its config turns on, such as the
+// net server, the player link, and the console—inside a Go program.
+//
+// The yaps command is a thin wrapper around this package; other programs can embed yaps the same way, by making a
+// Server from a config.Config and running it until they're done with it.
+// A program that wants yaps without its console (which reads stdin) should turn Console.Enabled off in the config.
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/MattWindsor91/yaps/config"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/crash"
+	"github.com/MattWindsor91/yaps/history"
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/netsrv"
+	"github.com/MattWindsor91/yaps/store"
+)
+
+// Server is a yaps instance, made from a config.
+type Server struct {
+	// conf is the config the Server was made from.
+	conf config.Config
+	// lstConf is the config of the Server's list, with any overrides kept in storage applied.
+	lstConf config.List
+
+	// log is the Server's root logger.
+	log *log.Logger
+	// crashes writes crash bundles if the Server panics.
+	crashes *crash.Reporter
+
+	// st is the storage holding the list.
+	st store.Storage
+	// playLog, if not nil, is the play log the list records its plays in.
+	playLog *history.File
+
+	// lst is the list.
+	lst *list.List
+	// lstCon is the controller running lst.
+	lstCon *controller.Controller
+	// rootClient is the client through which every subsystem reaches lstCon.
+	rootClient *controller.Client
+	// rootDone closes once lstCon has hung up on rootClient, and so shut down.
+	rootDone chan struct{}
+	// motd is the message of the day shared by the net server and the console.
+	motd *controller.Motd
+	// tunables are the runtime settings admins may change with 'tune'.
+	tunables *controller.Tunables
+	// netSrv is the net server, or nil if it isn't running.
+	netSrv *netsrv.Server
+}
+
+// New makes a Server from conf, opening the list's storage and restoring the list from it.
+// The Server holds the storage open until Run returns; if New fails, it closes anything it opened.
+func New(conf config.Config) (*Server, error) {
+	s := &Server{conf: conf, log: NewLogger("root", true)}
+
+	s.crashes = crash.New(conf.Crash.Dir)
+	if redacted, err := conf.Redacted(); err != nil {
+		s.log.Printf("couldn't redact config for crash bundles: %v\n", err)
+	} else {
+		s.crashes.SetConfig(redacted)
+	}
+
+	if len(conf.Lists) != 1 {
+		return nil, fmt.Errorf("FIXME: must have precisely one configured list, got %d", len(conf.Lists))
+	}
+	s.lstConf = conf.Lists[0]
+
+	var err error
+	if s.st, err = store.Open(string(s.lstConf.Store)); err != nil {
+		return nil, fmt.Errorf("couldn't open storage: %w", err)
+	}
+	if err := s.makeList(); err != nil {
+		s.close()
+		return nil, err
+	}
+
+	journal := controller.NewJournal(conf.Crash.JournalSize)
+	s.crashes.SetJournal(journal)
+	s.lstCon, s.rootClient = controller.NewController(s.lst)
+	s.lstCon.SetLogger(NewLogger("list", true))
+	s.lstCon.SetPanicLimit(s.lstConf.PanicLimit)
+	s.lstCon.SetFanIn(s.lstConf.FanIn)
+	s.lstCon.SetJournal(journal)
+
+	s.motd = makeMotd(conf.Net)
+	s.tunables = makeTunables(conf.Net, s.log, s.auditTune)
+	return s, nil
+}
+
+// makeList makes s's list, and attaches it to s's storage.
+func (s *Server) makeList() error {
+	overrides, err := s.st.LoadConfig(listName(s.lstConf))
+	if err != nil {
+		return fmt.Errorf("couldn't load list config overrides: %w", err)
+	}
+	if err := s.lstConf.Override(overrides); err != nil {
+		return fmt.Errorf("bad list config overrides: %w", err)
+	}
+	if err := s.conf.Secrets.Resolve(&s.lstConf); err != nil {
+		return fmt.Errorf("couldn't resolve secrets in list config overrides: %w", err)
+	}
+	lstConf := s.lstConf
+	if lstConf.Resolve.Enabled && lstConf.Player == "" {
+		return fmt.Errorf("bad list config: can't load tracks into the player without a player")
+	}
+	if lstConf.Prefetch.Enabled && lstConf.Player == "" {
+		return fmt.Errorf("bad list config: can't prefetch tracks for the player without a player")
+	}
+
+	lst := list.New()
+	lst.DefineCategories(makeCategories(lstConf.Categories))
+	lst.DefineSeparators(makeSeparators(lstConf.Separators))
+	lst.SetDriftThreshold(lstConf.DriftThreshold)
+	lst.SetDedupe(lstConf.Dedupe)
+	lst.SetAlertInterval(lstConf.AlertInterval)
+	lst.SetHandoverTimeout(lstConf.HandoverTimeout)
+	lst.SetFailsafe(lstConf.Failsafe)
+	if lstConf.ExpiryPolicy != "" {
+		policy, err := list.ParseExpiryPolicy(lstConf.ExpiryPolicy)
+		if err != nil {
+			return fmt.Errorf("bad list config: %w", err)
+		}
+		lst.SetExpiryPolicy(policy)
+	}
+	if lstConf.Templates != "" {
+		lst.SetTemplates(store.TemplateDir(lstConf.Templates))
+	}
+	lst.SetReplica(s.conf.Replica.Primary != "")
+	windows, err := makeMaintenanceWindows(lstConf.Maintenance)
+	if err != nil {
+		return fmt.Errorf("bad list config: %w", err)
+	}
+	lst.SetMaintenanceWindows(windows, lstConf.MaintenanceWarning)
+	lst.SetMaintenanceAdmins(s.conf.Net.Admins)
+	if lstConf.PlayLog != "" {
+		if s.playLog, err = history.Open(lstConf.PlayLog); err != nil {
+			return fmt.Errorf("couldn't open play log: %w", err)
+		}
+	}
+	report, err := makeRepairReport(lstConf, s.log)
+	if err != nil {
+		return fmt.Errorf("bad list config: %w", err)
+	}
+	if err := store.Attach(lst, s.st, listName(lstConf), makeRecovery(lstConf, s.st, s.playLog, s.log), report); err != nil {
+		return fmt.Errorf("couldn't attach storage: %w", err)
+	}
+	if lstConf.PlayCounts != "" {
+		counts, err := store.LoadPlayCounts(lstConf.PlayCounts)
+		if err != nil {
+			return fmt.Errorf("couldn't load play counts: %w", err)
+		}
+		lst.SetPlayCounts(counts)
+	}
+	if s.playLog != nil {
+		lst.SetPlayLog(s.playLog)
+	}
+	s.lst = lst
+	return nil
+}
+
+// close closes s's storage and play log.
+func (s *Server) close() {
+	if s.playLog != nil {
+		if err := s.playLog.Close(); err != nil {
+			s.log.Printf("couldn't close play log: %v\n", err)
+		}
+	}
+	if err := s.st.Close(); err != nil {
+		s.log.Printf("couldn't close storage: %v\n", err)
+	}
+}
+
+// Controller gets the controller running s's list, for instance to register observers on it.
+func (s *Server) Controller() *controller.Controller {
+	return s.lstCon
+}
+
+// NewClient makes a new client of the controller running s's list.
+// It waits for Run to start the controller, or for ctx to end.
+func (s *Server) NewClient(ctx context.Context) (*controller.Client, error) {
+	return s.rootClient.Copy(ctx)
+}
+
+// Run runs s until ctx ends, then shuts it down in an orderly fashion (see shutdown.go), returning once every
+// subsystem has stopped or the close timeout has run out.
+// It returns any error a subsystem stopped with.
+// A Server can only run once; its storage closes as Run returns.
+func (s *Server) Run(ctx context.Context) error {
+	defer s.close()
+	defer s.crashes.Guard()
+
+	// Subsystems have work to do while shutting down, such as draining net clients, so they only see the end of a
+	// context of their own, once the list controller has shut down.
+	sctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stopTracing, err := makeTracing(sctx, s.conf.Tracing)
+	if err != nil {
+		return fmt.Errorf("couldn't start tracing: %w", err)
+	}
+	defer func() {
+		tctx, tcancel := context.WithTimeout(context.Background(), tracingFlushTimeout)
+		defer tcancel()
+		if err := stopTracing(tctx); err != nil {
+			s.log.Printf("couldn't flush traces: %v\n", err)
+		}
+	}()
+
+	errg := s.crashes.Group()
+	s.start(sctx, errg)
+	s.wait(ctx)
+	cancel()
+
+	s.log.Println("Waiting for subsystems to shut down...")
+	err = waitForSubsystems(errg, s.conf.Shutdown, s.log)
+	s.log.Println("It's now safe to turn off your yaps.")
+	return err
+}
+
+// start starts s's list controller, and every subsystem s's config turns on, in errg.
+func (s *Server) start(ctx context.Context, errg *crash.Group) {
+	conf, lstConf, rootLog := s.conf, s.lstConf, s.log
+
+	errg.Go(func() error {
+		s.lstCon.Run(ctx)
+		rootLog.Println("list controller closing")
+		// The list is ours again now that its controller has stopped.
+		if lstConf.PlayCounts != "" {
+			if err := store.SavePlayCounts(lstConf.PlayCounts, s.lst.PlayCounts()); err != nil {
+				return fmt.Errorf("couldn't save play counts: %w", err)
+			}
+		}
+		return nil
+	})
+
+	// The controller broadcasts to the root client too, and would stop dead, mid-Copy, if nobody listened; subsystems
+	// copy the root client as they start, as can embedders through NewClient, so listen from the start.
+	s.rootDone = make(chan struct{})
+	go func() {
+		for range s.rootClient.Rx {
+		}
+		close(s.rootDone)
+	}()
+
+	alerter, err := makeAlerter(ctx, s.rootClient)
+	if err != nil {
+		rootLog.Printf("alerter error: %v\n", err)
+	} else {
+		errg.Go(func() error {
+			err := alerter.Run(ctx)
+			if err != nil {
+				err = fmt.Errorf("alerter error: %w", err)
+			}
+			rootLog.Println("alerter closing")
+			return err
+		})
+	}
+
+	if conf.Replica.Primary != "" {
+		errg.Go(func() error {
+			err := runReplica(ctx, s.rootClient, conf.Replica)
+			if err != nil {
+				err = fmt.Errorf("replica error: %w", err)
+			}
+			rootLog.Println("replica closing")
+			return err
+		})
+	}
+
+	// A replica may be promoted at any time, so it runs expiry too, which waits out the promotion.
+	if lstConf.ExpiryCheck > 0 {
+		errg.Go(func() error {
+			err := runExpiry(ctx, s.rootClient, lstConf.ExpiryCheck)
+			if err != nil {
+				err = fmt.Errorf("expiry error: %w", err)
+			}
+			rootLog.Println("expiry closing")
+			return err
+		})
+	}
+
+	errg.Go(func() error {
+		err := runMaintenance(ctx, s.rootClient)
+		if err != nil {
+			err = fmt.Errorf("maintenance error: %w", err)
+		}
+		rootLog.Println("maintenance closing")
+		return err
+	})
+
+	if lstConf.Snapshots.Dir != "" {
+		errg.Go(func() error {
+			err := runSnapshots(ctx, s.rootClient, listName(lstConf), lstConf.Snapshots, alerter)
+			if err != nil {
+				err = fmt.Errorf("snapshot error: %w", err)
+			}
+			rootLog.Println("snapshots closing")
+			return err
+		})
+	}
+
+	// As with expiry, a replica runs handovers in case of promotion.
+	if lstConf.HandoverTimeout > 0 {
+		errg.Go(func() error {
+			err := runHandover(ctx, s.rootClient)
+			if err != nil {
+				err = fmt.Errorf("handover error: %w", err)
+			}
+			rootLog.Println("handover closing")
+			return err
+		})
+	}
+
+	if lstConf.Player != "" {
+		errg.Go(func() error {
+			err := runPlayer(ctx, s.rootClient, lstConf, alerter)
+			if err != nil {
+				err = fmt.Errorf("player error: %w", err)
+			}
+			rootLog.Println("player closing")
+			return err
+		})
+	}
+
+	// The net server may serve the now-playing endpoint on its own port, so the endpoint comes first.
+	var web http.Handler
+	if conf.NowPlaying.Enabled {
+		if np, err := makeNowPlaying(ctx, s.rootClient, conf.NowPlaying); err != nil {
+			rootLog.Printf("nowplaying error: %v\n", err)
+		} else {
+			web = np.Handler()
+			errg.Go(func() error {
+				err := np.Run(ctx)
+				if err != nil {
+					err = fmt.Errorf("nowplaying error: %w", err)
+				}
+				rootLog.Println("nowplaying closing")
+				return err
+			})
+		}
+	}
+
+	if conf.Net.Enabled {
+		if netSrv, err := makeNet(ctx, s.rootClient, conf.Net, conf.Auth, s.motd, s.tunables, web); err != nil {
+			rootLog.Printf("netsrv error: %v\n", err)
+		} else {
+			s.netSrv = netSrv
+			netSrv.SetDeniedRequestHook(s.auditDenied)
+			errg.Go(func() error {
+				netSrv.Run(ctx)
+				rootLog.Println("netsrv closing")
+				return nil
+			})
+		}
+	}
+
+	if conf.Watchdog.Enabled {
+		errg.Go(func() error {
+			err := runWatchdog(ctx, s.rootClient, conf.Watchdog, s.netSrv)
+			if err != nil {
+				err = fmt.Errorf("watchdog error: %w", err)
+			}
+			rootLog.Println("watchdog closing")
+			return err
+		})
+	}
+
+	if conf.Icy.Enabled {
+		errg.Go(func() error {
+			err := runIcy(ctx, s.rootClient, conf.Icy, alerter)
+			if err != nil {
+				err = fmt.Errorf("icy error: %w", err)
+			}
+			rootLog.Println("icy closing")
+			return err
+		})
+	}
+
+	if len(conf.Automation.Rules) != 0 {
+		errg.Go(func() error {
+			err := runAutomation(ctx, s.rootClient, conf.Automation, s.lst)
+			if err != nil {
+				err = fmt.Errorf("automation error: %w", err)
+			}
+			rootLog.Println("automation closing")
+			return err
+		})
+	}
+
+	if conf.Console.Enabled {
+		errg.Go(func() error {
+			err := runConsole(ctx, s.rootClient, conf.Console, s.motd)
+			if err != nil {
+				err = fmt.Errorf("console error: %w", err)
+			}
+			rootLog.Println("console closing")
+			return err
+		})
+	}
+}
+
+// wait waits for s's list controller to shut down, starting an orderly shutdown once ctx ends.
+func (s *Server) wait(ctx context.Context) {
+	stop := ctx.Done()
+	for {
+		select {
+		case <-s.rootDone:
+			return
+		case <-stop:
+			stop = nil
+			go shutdown(s.netSrv, s.rootClient, s.conf.Shutdown, s.log)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package server_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/config"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/server"
+)
+
+// TestServer checks that an embedded server runs its list, tells observers of changes, and stops when its context
+// ends.
+func TestServer(t *testing.T) {
+	srv, err := server.New(config.Config{Lists: []config.List{{}}})
+	if err != nil {
+		t.Fatalf("couldn't make server: %v", err)
+	}
+
+	notes := make(chan string, 1)
+	o := srv.Controller().RegisterObserver(func(r controller.Response) {
+		if n, ok := r.Body.(list.ListNoteResponse); ok {
+			notes <- n.Note
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- srv.Run(ctx)
+	}()
+
+	cli, err := srv.NewClient(ctx)
+	if err != nil {
+		t.Fatalf("couldn't make client: %v", err)
+	}
+	go func() {
+		for range cli.Rx {
+		}
+	}()
+	if err := cli.Call(ctx, list.SetListNoteRequest{Note: "embedded"}); err != nil {
+		t.Fatalf("couldn't set note: %v", err)
+	}
+	if got := <-notes; got != "embedded" {
+		t.Errorf("observer got note %q, want %q", got, "embedded")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("server stopped with error: %v", err)
+	}
+	<-o.Done()
+}
+
+// TestNew_lists checks that New refuses configs without precisely one list.
+func TestNew_lists(t *testing.T) {
+	if _, err := server.New(config.Config{}); err == nil {
+		t.Error("made a server with no lists")
+	}
+}
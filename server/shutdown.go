@@ -0,0 +1,90 @@
+package server
+
+// File shutdown.go contains the orderly shutdown yaps goes through on an interrupt.
+//
+// Shutting the list controller down while net clients are mid-request leaves them without ACKs, so the phases go:
+// stop accepting net clients, let the ones already connected finish what they asked for, shut the list controller
+// down, and then wait for every subsystem to close.
+// Each phase has its own timeout (see config.Shutdown); one that runs out is logged and abandoned, so that a wedged
+// client or subsystem can't keep yaps from stopping.
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/MattWindsor91/yaps/config"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/crash"
+	"github.com/MattWindsor91/yaps/netsrv"
+)
+
+const (
+	// defaultAcceptTimeout, defaultDrainTimeout, defaultControllerTimeout, and defaultCloseTimeout are the timeouts
+	// of each shutdown phase when the config doesn't set them.
+	defaultAcceptTimeout     = 5 * time.Second
+	defaultDrainTimeout      = 30 * time.Second
+	defaultControllerTimeout = 10 * time.Second
+	defaultCloseTimeout      = 10 * time.Second
+)
+
+// shutdownPhase is one phase of shutting yaps down.
+type shutdownPhase struct {
+	// name names the phase in the log.
+	name string
+	// timeout is how long the phase may take.
+	timeout time.Duration
+	// run runs the phase.
+	run func(ctx context.Context) error
+}
+
+// shutdown stops netSrv (if not nil) accepting clients, drains them, and then shuts down the controller of
+// rootClient, taking as long over each phase as scfg allows.
+// The last phase, closing everything down, follows once the controller has shut down; see waitForSubsystems.
+func shutdown(netSrv *netsrv.Server, rootClient *controller.Client, scfg config.Shutdown, l *log.Logger) {
+	var phases []shutdownPhase
+	if netSrv != nil {
+		phases = append(phases,
+			shutdownPhase{"accept", orDefault(scfg.AcceptTimeout, defaultAcceptTimeout), netSrv.StopAccepting},
+			shutdownPhase{"drain", orDefault(scfg.DrainTimeout, defaultDrainTimeout), netSrv.Drain},
+		)
+	}
+	phases = append(phases,
+		shutdownPhase{"controller", orDefault(scfg.ControllerTimeout, defaultControllerTimeout), rootClient.Shutdown})
+
+	for _, p := range phases {
+		l.Printf("shutdown: %s (up to %s)\n", p.name, p.timeout)
+		ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+		err := p.run(ctx)
+		cancel()
+		if err != nil {
+			l.Printf("shutdown: %s didn't finish, carrying on: %v\n", p.name, err)
+		}
+	}
+}
+
+// waitForSubsystems waits up to scfg's close timeout for the subsystems in errg to stop, returning any error.
+func waitForSubsystems(errg *crash.Group, scfg config.Shutdown, l *log.Logger) error {
+	timeout := orDefault(scfg.CloseTimeout, defaultCloseTimeout)
+	l.Printf("shutdown: close (up to %s)\n", timeout)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- errg.Wait()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(timeout):
+		l.Println("shutdown: close didn't finish, giving up on the remaining subsystems")
+		return nil
+	}
+}
+
+// orDefault gets d, or def if d is zero.
+func orDefault(d, def time.Duration) time.Duration {
+	if d == 0 {
+		return def
+	}
+	return d
+}
@@ -0,0 +1,560 @@
+package server
+
+// File subsystems.go contains the setup of each subsystem a Server runs alongside its list controller, each talking to
+// the list through a copy of the Server's root client.
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/UniversityRadioYork/bifrost-go/message"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/MattWindsor91/yaps/auth"
+	"github.com/MattWindsor91/yaps/clock"
+	"github.com/MattWindsor91/yaps/config"
+	"github.com/MattWindsor91/yaps/console"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/external"
+	"github.com/MattWindsor91/yaps/icy"
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/netsrv"
+	"github.com/MattWindsor91/yaps/nowplaying"
+	"github.com/MattWindsor91/yaps/replica"
+	"github.com/MattWindsor91/yaps/resolve"
+	"github.com/MattWindsor91/yaps/rules"
+	"github.com/MattWindsor91/yaps/store"
+)
+
+func makeNet(ctx context.Context, rootClient *controller.Client, ncfg config.Net, acfg config.Auth, motd *controller.Motd, tunables *controller.Tunables, web http.Handler) (*netsrv.Server, error) {
+	provider, err := makeAuth(acfg)
+	if err != nil {
+		return nil, fmt.Errorf("auth: %w", err)
+	}
+
+	netClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	netLog := NewLogger("net", ncfg.Log)
+	netSrv := netsrv.New(netLog, ncfg.Host, netClient)
+	netSrv.SetNormalise(ncfg.Normalise)
+	netSrv.SetCoalesce(ncfg.Coalesce)
+	netSrv.SetRegionThreshold(ncfg.Regions)
+	netSrv.SetTimeInterval(ncfg.TimeInterval)
+	netSrv.SetAuth(provider)
+	netSrv.SetRequestTimeout(ncfg.RequestTimeout)
+	netSrv.SetSlowRequest(ncfg.SlowRequest)
+	netSrv.SetIdleTimeout(ncfg.IdleTimeout, ncfg.IdleWarning)
+	netSrv.SetSendBuffer(ncfg.SendBuffer)
+	netSrv.SetBandwidthCap(ncfg.BandwidthCap)
+	netSrv.SetMaxGoroutines(ncfg.MaxGoroutines)
+	netSrv.SetAdmins(ncfg.Admins)
+	netSrv.SetWordFilters(makeWordFilter(ncfg.Words), makeWordFilter(ncfg.CompatWords), makeWordFilter(ncfg.HubWords))
+	addrs, err := netsrv.NewAddressFilter(ncfg.Addresses.Allow, ncfg.Addresses.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("net addresses: %w", err)
+	}
+	compatAddrs, err := netsrv.NewAddressFilter(ncfg.CompatAddresses.Allow, ncfg.CompatAddresses.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("net compat addresses: %w", err)
+	}
+	netSrv.SetAddressFilters(addrs, compatAddrs)
+	dup, err := netsrv.ParseDuplicatePolicy(ncfg.DuplicateLogins)
+	if err != nil {
+		return nil, err
+	}
+	netSrv.SetDuplicatePolicy(dup)
+	netSrv.SetMotd(motd)
+	netSrv.SetTunables(tunables)
+	if ncfg.HTTP {
+		netSrv.SetHTTP(web)
+	}
+	if ncfg.Hub != "" {
+		opts, err := makeDialOptions(ncfg.HubDial)
+		if err != nil {
+			return nil, fmt.Errorf("hub: %w", err)
+		}
+		netSrv.SetHub(ncfg.Hub, opts.Dial)
+	}
+	if ncfg.CompatHost != "" {
+		dname := ncfg.CompatDialect
+		if dname == "" {
+			dname = controller.Baps3d.Name
+		}
+		dialect, err := controller.DialectByName(dname)
+		if err != nil {
+			return nil, fmt.Errorf("compat: %w", err)
+		}
+		netSrv.SetCompat(ncfg.CompatHost, dialect)
+	}
+	return netSrv, nil
+}
+
+// makeWordFilter makes the word filter wcfg sets up, or nil if it accepts every word.
+func makeWordFilter(wcfg config.Words) *controller.WordFilter {
+	return controller.NewWordFilter(wcfg.Allow, wcfg.Deny)
+}
+
+// makeMotd makes the message of the day ncfg sets up.
+func makeMotd(ncfg config.Net) *controller.Motd {
+	motd := controller.NewMotd(ncfg.Motd)
+	if ncfg.MotdAdmins != "" {
+		motd.SetAdmins(ncfg.MotdAdmins)
+	} else {
+		motd.SetAdmins(ncfg.Admins)
+	}
+	return motd
+}
+
+// makeTunables makes the runtime tunables ncfg sets up, starting with the logging of each subsystem; changes are
+// logged in rootLog, and passed on to audit.
+func makeTunables(ncfg config.Net, rootLog *log.Logger, audit func(controller.TuneChange)) *controller.Tunables {
+	ts := controller.NewTunables()
+	ts.SetAdmins(ncfg.Admins)
+	ts.SetAuditHook(func(c controller.TuneChange) {
+		user := "-"
+		if c.Identity != nil {
+			user = c.Identity.User
+		}
+		rootLog.Printf("tunable %s changed by user %s: %s -> %s\n", c.Name, user, c.Old, c.New)
+		audit(c)
+	})
+	for _, section := range tunableLogs {
+		ts.Add(logTunable(section))
+	}
+	return ts
+}
+
+// makeAuth makes the auth provider acfg selects, or nil if clients don't log in.
+func makeAuth(acfg config.Auth) (auth.Provider, error) {
+	switch acfg.Provider {
+	case "":
+		return nil, nil
+	case "static":
+		if len(acfg.Tokens) == 0 {
+			return nil, fmt.Errorf("the static provider needs at least one token")
+		}
+		p := make(auth.Static, len(acfg.Tokens))
+		for _, t := range acfg.Tokens {
+			if t.Token == "" || t.User == "" {
+				return nil, fmt.Errorf("static tokens need a token and a user")
+			}
+			p[string(t.Token)] = auth.Identity{User: t.User, Groups: t.Groups}
+		}
+		return p, nil
+	case "ldap":
+		p := auth.LDAP{
+			URL:         acfg.LDAP.URL,
+			StartTLS:    acfg.LDAP.StartTLS,
+			UserDN:      acfg.LDAP.UserDN,
+			GroupBase:   acfg.LDAP.GroupBase,
+			GroupFilter: acfg.LDAP.GroupFilter,
+			GroupAttr:   acfg.LDAP.GroupAttr,
+		}
+		if acfg.LDAP.CAFile != "" {
+			pool, err := loadCAFile(acfg.LDAP.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			p.TLS = &tls.Config{RootCAs: pool}
+		}
+		return p, p.Check()
+	case "oidc":
+		p := &auth.OIDC{
+			Issuer:      acfg.OIDC.Issuer,
+			Audience:    acfg.OIDC.Audience,
+			UserClaim:   acfg.OIDC.UserClaim,
+			GroupsClaim: acfg.OIDC.GroupsClaim,
+			Client:      &http.Client{Timeout: 10 * time.Second},
+		}
+		return p, p.Check()
+	default:
+		return nil, fmt.Errorf("unknown provider %q", acfg.Provider)
+	}
+}
+
+func runWatchdog(ctx context.Context, rootClient *controller.Client, wcfg config.Watchdog, netSrv *netsrv.Server) error {
+	wdClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return err
+	}
+
+	interval := wcfg.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	threshold := wcfg.Threshold
+	if threshold <= 0 {
+		threshold = 10 * time.Second
+	}
+
+	wdLog := NewLogger("watchdog", wcfg.Log)
+	wd := controller.NewWatchdog(wdLog, "list", wdClient, interval, threshold)
+	if wcfg.Broadcast && netSrv != nil {
+		wd.SetAlertHook(func(a controller.WatchdogAlert) {
+			netSrv.Announce(*a.Message(message.TagBcast))
+		})
+	}
+	return wd.Run(ctx)
+}
+
+// makeAlerter makes an Alerter for the list that rootClient talks to.
+func makeAlerter(ctx context.Context, rootClient *controller.Client) (*list.Alerter, error) {
+	alertClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return list.NewAlerter(alertClient), nil
+}
+
+func runExpiry(ctx context.Context, rootClient *controller.Client, interval time.Duration) error {
+	expClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return err
+	}
+	return list.RunExpiry(ctx, expClient, interval, clock.Real)
+}
+
+func runMaintenance(ctx context.Context, rootClient *controller.Client) error {
+	maintClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return err
+	}
+	return list.RunMaintenance(ctx, maintClient, clock.Real)
+}
+
+func runHandover(ctx context.Context, rootClient *controller.Client) error {
+	handoverClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return err
+	}
+	return list.RunHandover(ctx, handoverClient, clock.Real)
+}
+
+func runSnapshots(ctx context.Context, rootClient *controller.Client, name string, scfg config.Snapshots, alerter *list.Alerter) error {
+	sched, err := store.ParseSchedule(scfg.Days, scfg.At)
+	if err != nil {
+		return err
+	}
+	if len(sched.At) == 0 {
+		return fmt.Errorf("snapshots need at least one time of day in 'at'")
+	}
+
+	snapClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return err
+	}
+
+	snapLog := NewLogger("snapshot", scfg.Log)
+	policy := store.SnapshotPolicy{Dir: scfg.Dir, Schedule: sched, Keep: scfg.Keep}
+	return store.RunSnapshots(ctx, snapClient, name, policy, clock.Real, func(path string, deleted []string, err error) {
+		if err != nil {
+			snapLog.Printf("couldn't take snapshot: %v\n", err)
+			if alerter != nil {
+				alerter.Raise("snapshot", list.AlertWarning, "couldn't take a snapshot of the list: "+err.Error())
+			}
+			return
+		}
+		snapLog.Printf("took snapshot %s\n", path)
+		for _, d := range deleted {
+			snapLog.Printf("deleted old snapshot %s\n", d)
+		}
+		if alerter != nil {
+			alerter.Clear("snapshot")
+		}
+	})
+}
+
+func makeNowPlaying(ctx context.Context, rootClient *controller.Client, npcfg config.NowPlaying) (*nowplaying.Server, error) {
+	npClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	next := npcfg.Next
+	if next <= 0 {
+		next = 3
+	}
+
+	npLog := NewLogger("nowplaying", npcfg.Log)
+	return nowplaying.New(npLog, npcfg.Host, next, npClient), nil
+}
+
+func runIcy(ctx context.Context, rootClient *controller.Client, icfg config.Icy, alerter *list.Alerter) error {
+	flavour, err := icy.ParseFlavour(icfg.Flavour)
+	if err != nil {
+		return err
+	}
+
+	icyClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return err
+	}
+
+	target := icy.Target{
+		Flavour:  flavour,
+		URL:      icfg.URL,
+		Mount:    icfg.Mount,
+		User:     icfg.User,
+		Password: string(icfg.Password),
+	}
+	icyLog := NewLogger("icy", icfg.Log)
+	pusher := icy.New(icyLog, target, icyClient)
+	if alerter != nil {
+		pusher.SetPushHook(func(err error) {
+			if err != nil {
+				alerter.Raise("icy", list.AlertWarning, "couldn't push metadata to the streaming server: "+err.Error())
+			} else {
+				alerter.Clear("icy")
+			}
+		})
+	}
+	return pusher.Run(ctx)
+}
+
+func runAutomation(ctx context.Context, rootClient *controller.Client, acfg config.Automation, parser controller.BifrostParser) error {
+	rs := make([]rules.Rule, len(acfg.Rules))
+	for i, r := range acfg.Rules {
+		var err error
+		if rs[i], err = rules.Parse(r.When, r.If, r.Then); err != nil {
+			return fmt.Errorf("rule %d: %w", i, err)
+		}
+	}
+
+	autoClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return err
+	}
+
+	autoLog := NewLogger("automation", acfg.Log)
+	eng, err := rules.New(ctx, autoLog, rs, autoClient, parser)
+	if err != nil {
+		return err
+	}
+	return eng.Run(ctx)
+}
+
+func runReplica(ctx context.Context, rootClient *controller.Client, rcfg config.Replica) error {
+	replClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return err
+	}
+
+	replLog := NewLogger("replica", rcfg.Log)
+	return replica.New(replLog, rcfg.Primary, rcfg.PromoteAfter, replClient).Run(ctx)
+}
+
+// rqPlayerLoad is the word of the player's request to load a file.
+const rqPlayerLoad = "fload"
+
+func runPlayer(ctx context.Context, rootClient *controller.Client, lcfg config.List, alerter *list.Alerter) error {
+	opts, err := makeDialOptions(lcfg.Dial)
+	if err != nil {
+		return err
+	}
+
+	svc := external.NewService(lcfg.Player, opts)
+	svc.SetLogger(NewLogger("player", true))
+	if alerter != nil {
+		svc.SetLinkHook(func(err error) {
+			if err != nil {
+				alerter.Raise("player", list.AlertCritical, "lost the player at "+lcfg.Player+": "+err.Error())
+			} else {
+				alerter.Clear("player")
+			}
+		})
+	}
+	svcCon, svcClient := controller.NewController(svc)
+	svcCon.SetFanIn(lcfg.FanIn)
+
+	var errg errgroup.Group
+	errg.Go(func() error {
+		svcCon.Run(ctx)
+		return nil
+	})
+	errg.Go(func() error {
+		err := svc.Run(ctx, svcClient)
+		// The link holds the player controller's only client, so hanging it up stops the controller.
+		close(svcClient.Tx)
+		return err
+	})
+	if lcfg.Resolve.Enabled {
+		errg.Go(func() error {
+			return runCuer(ctx, rootClient, svcClient, lcfg.Resolve, alerter)
+		})
+	}
+	if lcfg.Prefetch.Enabled {
+		errg.Go(func() error {
+			return runPrefetcher(ctx, rootClient, svcClient, lcfg.Prefetch, lcfg.Resolve)
+		})
+	}
+	return errg.Wait()
+}
+
+// copyPlayer copies svcClient, the player controller's client, for a subsystem that only sends it requests.
+// The subsystem must close the copy's Tx when it stops, as the player controller stops once its last client hangs up.
+func copyPlayer(ctx context.Context, svcClient *controller.Client) (*controller.Client, error) {
+	playerClient, err := svcClient.Copy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		// The player's state is of no interest here, but its broadcasts must still be taken.
+		for range playerClient.Rx {
+		}
+	}()
+	return playerClient, nil
+}
+
+// runCuer loads the tracks selected on the list behind rootClient into the player behind svcClient.
+func runCuer(ctx context.Context, rootClient, svcClient *controller.Client, rcfg config.Resolve, alerter *list.Alerter) error {
+	resolver, err := makeResolver(rcfg)
+	if err != nil {
+		return err
+	}
+
+	cueClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return err
+	}
+	playerClient, err := copyPlayer(ctx, svcClient)
+	if err != nil {
+		return err
+	}
+	defer close(playerClient.Tx)
+
+	load := func(ctx context.Context, path string) error {
+		return playerClient.Call(ctx, external.ForwardRequest{Word: rqPlayerLoad, Args: []string{path}})
+	}
+	cuer := resolve.NewCuer(NewLogger("cue", true), resolver, load, cueClient)
+	if alerter != nil {
+		cuer.SetCueHook(func(err error) {
+			if err != nil {
+				alerter.Raise("cue", list.AlertWarning, "couldn't load the selected track into the player: "+err.Error())
+			} else {
+				alerter.Clear("cue")
+			}
+		})
+	}
+	return cuer.Run(ctx)
+}
+
+// runPrefetcher readies the tracks likely to be selected next on the list behind rootClient, resolving them according
+// to rcfg, and telling the player behind svcClient about them if pcfg says how.
+func runPrefetcher(ctx context.Context, rootClient, svcClient *controller.Client, pcfg config.Prefetch, rcfg config.Resolve) error {
+	resolver, err := makeResolver(rcfg)
+	if err != nil {
+		return err
+	}
+	count := pcfg.Count
+	if count <= 0 {
+		count = 1
+	}
+
+	prefetchClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return err
+	}
+	prefetcher := resolve.NewPrefetcher(NewLogger("prefetch", true), resolver, count, prefetchClient)
+	if pcfg.Word != "" {
+		playerClient, err := copyPlayer(ctx, svcClient)
+		if err != nil {
+			return err
+		}
+		defer close(playerClient.Tx)
+		prefetcher.SetHook(func(ctx context.Context, path string) error {
+			return playerClient.Call(ctx, external.ForwardRequest{Word: pcfg.Word, Args: []string{path}})
+		})
+	}
+	return prefetcher.Run(ctx)
+}
+
+// makeResolver makes the resolver for the payload schemes rcfg allows.
+func makeResolver(rcfg config.Resolve) (resolve.Resolver, error) {
+	// Library IDs and URLs are refused, rather than taken to be paths, unless configured.
+	r := resolve.Schemes{"": resolve.Path{Root: rcfg.Root}, resolve.LibraryScheme: nil, "http": nil, "https": nil}
+	if rcfg.Library != "" {
+		lib, err := resolve.NewLibrary(rcfg.Library)
+		if err != nil {
+			return nil, err
+		}
+		r[resolve.LibraryScheme] = lib
+	}
+	if rcfg.Cache != "" {
+		u, err := resolve.NewURL(rcfg.Cache, rcfg.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		r["http"] = u
+		r["https"] = u
+	}
+	return r, nil
+}
+
+func runConsole(ctx context.Context, rootClient *controller.Client, ccfg config.Console, motd *controller.Motd) error {
+	consoleClient, err := rootClient.Copy(ctx)
+	if err != nil {
+		return err
+	}
+
+	con, err := console.New(ctx, consoleClient)
+	if err != nil {
+		return err
+	}
+	con.SetMotd(motd)
+	con.SetDecoder(list.ParseBifrostResponse)
+	con.SetJSON(ccfg.JSON)
+	if err := con.SetKeys(ccfg.Keys); err != nil {
+		_ = con.Close()
+		return err
+	}
+	return con.Run(ctx)
+}
+
+// makeDialOptions converts a dial configuration into options for external services.
+func makeDialOptions(dcfg config.Dial) (external.DialOptions, error) {
+	opts := external.DialOptions{Timeout: dcfg.Timeout, KeepAlive: dcfg.KeepAlive}
+
+	if dcfg.Proxy != "" {
+		proxy, err := url.Parse(string(dcfg.Proxy))
+		if err != nil {
+			return opts, fmt.Errorf("bad proxy URL: %w", err)
+		}
+		opts.Proxy = proxy
+	}
+
+	if dcfg.TLS {
+		tcfg := &tls.Config{ServerName: dcfg.ServerName}
+		if dcfg.CAFile != "" {
+			var err error
+			if tcfg.RootCAs, err = loadCAFile(dcfg.CAFile); err != nil {
+				return opts, err
+			}
+		}
+		opts.TLS = tcfg
+	}
+
+	return opts, nil
+}
+
+// loadCAFile loads the PEM certificates in path into a pool of certificates to trust.
+func loadCAFile(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates in %s", path)
+	}
+	return pool, nil
+}
@@ -0,0 +1,71 @@
+package server
+
+// File tracing.go contains the setup of OpenTelemetry tracing, which follows requests through the server (see
+// controller/trace.go).
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+
+	"github.com/MattWindsor91/yaps/config"
+	"github.com/MattWindsor91/yaps/version"
+)
+
+// tracingFlushTimeout is how long yaps waits, on exit, for the last spans to go out.
+const tracingFlushTimeout = 5 * time.Second
+
+// makeTracing starts sending the spans of traced requests wherever tcfg says.
+// It returns the function that flushes and stops the tracing, which does nothing if tracing is off.
+func makeTracing(ctx context.Context, tcfg config.Tracing) (func(context.Context) error, error) {
+	exp, err := makeSpanExporter(ctx, tcfg)
+	if err != nil || exp == nil {
+		return func(context.Context) error { return nil }, err
+	}
+
+	name := tcfg.ServiceName
+	if name == "" {
+		name = "yaps"
+	}
+	ratio := tcfg.SampleRatio
+	if ratio == 0 {
+		ratio = 1
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(name), semconv.ServiceVersion(version.Get().Version))),
+	)
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// makeSpanExporter makes the exporter tcfg selects, or nil if tracing is off.
+func makeSpanExporter(ctx context.Context, tcfg config.Tracing) (sdktrace.SpanExporter, error) {
+	switch tcfg.Exporter {
+	case "":
+		return nil, nil
+	case "stdout":
+		return stdouttrace.New(stdouttrace.WithWriter(os.Stderr))
+	case "otlp":
+		opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(tcfg.Endpoint)}
+		if tcfg.Endpoint == "" {
+			opts = nil
+		}
+		if tcfg.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		return otlptracehttp.New(ctx, opts...)
+	default:
+		return nil, fmt.Errorf("unknown trace exporter: %q", tcfg.Exporter)
+	}
+}
@@ -0,0 +1,27 @@
+package store
+
+// File audit.go contains AuditEntry, the form in which a Storage keeps a list server's audit log.
+//
+// The audit log records what admins changed at runtime, and which requests were refused for want of being an admin,
+// so that both outlive the server's own logs.
+
+import "time"
+
+const (
+	// AuditTune is the action of audit entries for changes to tunables.
+	AuditTune = "tune"
+	// AuditDenied is the action of audit entries for requests refused because the client wasn't an admin.
+	AuditDenied = "denied"
+)
+
+// AuditEntry is one entry in an audit log.
+type AuditEntry struct {
+	// At is when the audited thing happened.
+	At time.Time
+	// User is who the client involved logged in as, or empty if it didn't.
+	User string
+	// Action is what happened, such as AuditTune or AuditDenied.
+	Action string
+	// Detail describes what happened, for whoever reads the log.
+	Detail string
+}
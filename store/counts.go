@@ -0,0 +1,45 @@
+package store
+
+// File counts.go contains support for keeping play counts in a file of their own, apart from any Storage.
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+)
+
+// LoadPlayCounts reads play counts saved by SavePlayCounts from the file at path.
+// A missing file holds no counts.
+func LoadPlayCounts(path string) (map[string]int, error) {
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]int{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var counts map[string]int
+	err = json.Unmarshal(bs, &counts)
+	return counts, err
+}
+
+// SavePlayCounts writes counts to the file at path, replacing it.
+func SavePlayCounts(path string, counts map[string]int) error {
+	bs, err := json.MarshalIndent(counts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAside(path, bs)
+}
+
+// writeAside replaces the file at path with bs.
+// It writes to the side first, so that a crash mid-write doesn't lose the old contents.
+func writeAside(path string, bs []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, bs, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
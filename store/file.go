@@ -0,0 +1,403 @@
+package store
+
+// File file.go contains File, a Storage kept in a directory of plain files.
+//
+// For each list called <name>, the directory holds:
+// - <name>.json, the list's state, replaced whole on each save;
+// - <name>.history, the list's play history, as a play log (see package 'history');
+// - <name>.audit, the audit log, one JSON object per line;
+// - <name>.toml, the list's config overrides, if any, which yaps only ever reads.
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MattWindsor91/yaps/history"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+func init() {
+	Register("file", func(dir string) (Storage, error) {
+		if dir == "" {
+			return nil, fmt.Errorf("file storage needs a directory, as 'file:<dir>'")
+		}
+		return OpenFile(dir)
+	})
+}
+
+// File is a Storage kept in a directory of plain files.
+type File struct {
+	// dir is the directory holding the files.
+	dir string
+
+	// mu guards logs.
+	mu sync.Mutex
+	// logs maps list names to their open play logs.
+	logs map[string]*history.File
+
+	// auditMu serialises appends to audit logs, so that entries never interleave.
+	auditMu sync.Mutex
+}
+
+// OpenFile opens the directory dir as a Storage, creating it if need be.
+func OpenFile(dir string) (*File, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &File{dir: dir, logs: make(map[string]*history.File)}, nil
+}
+
+// path gets the path of the file with extension ext for the list called name.
+func (f *File) path(name, ext string) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(f.dir, name+ext), nil
+}
+
+// checkName checks that a list called name can be kept in files named after it.
+func checkName(name string) error {
+	if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+		return fmt.Errorf("can't keep a list called %q in files", name)
+	}
+	return nil
+}
+
+// fileItem is the form in which File keeps an item.
+type fileItem struct {
+	Hash       string        `json:"hash"`
+	Type       string        `json:"type"`
+	Payload    string        `json:"payload"`
+	Note       string        `json:"note,omitempty"`
+	Category   string        `json:"category,omitempty"`
+	Planned    time.Time     `json:"planned"`
+	Duration   time.Duration `json:"duration,omitempty"`
+	ValidFrom  time.Time     `json:"validFrom"`
+	ValidUntil time.Time     `json:"validUntil"`
+	Display    *fileDisplay  `json:"display,omitempty"`
+	Block      string        `json:"block,omitempty"`
+}
+
+// fileDisplay is the form in which File keeps a text item's display hints.
+type fileDisplay struct {
+	Markup   string        `json:"markup"`
+	Severity string        `json:"severity"`
+	Colour   string        `json:"colour,omitempty"`
+	Hold     time.Duration `json:"hold,omitempty"`
+}
+
+// fileState is the form in which File keeps a list's state.
+type fileState struct {
+	Items      []fileItem     `json:"items"`
+	Selection  int            `json:"selection"`
+	SelectedAt *time.Time     `json:"selectedAt,omitempty"`
+	Note       string         `json:"note,omitempty"`
+	AutoMode   string         `json:"automode"`
+	Version    uint64         `json:"version"`
+	Plays      map[string]int `json:"plays,omitempty"`
+	Blocks     []fileBlock    `json:"blocks,omitempty"`
+}
+
+// fileBlock is the form in which File keeps a block's definition.
+type fileBlock struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Collapsed bool   `json:"collapsed,omitempty"`
+}
+
+// LoadList gets the state last saved for the list called name.
+func (f *File) LoadList(name string) (list.State, bool, error) {
+	path, err := f.path(name, ".json")
+	if err != nil {
+		return list.State{}, false, err
+	}
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return list.State{}, false, nil
+	}
+	if err != nil {
+		return list.State{}, false, err
+	}
+
+	var fst fileState
+	if err := json.Unmarshal(bs, &fst); err != nil {
+		return list.State{}, false, fmt.Errorf("%s: %w", path, err)
+	}
+	st := list.State{
+		Selection:  fst.Selection,
+		SelectedAt: fromFileTime(fst.SelectedAt),
+		Note:       fst.Note,
+		Version:    fst.Version,
+		Plays:      fst.Plays,
+		Blocks:     fromFileBlocks(fst.Blocks),
+	}
+	if st.AutoMode, err = list.ParseAutoMode(fst.AutoMode); err != nil {
+		return list.State{}, false, fmt.Errorf("%s: %w", path, err)
+	}
+	if st.Items, err = fromFileItems(fst.Items); err != nil {
+		return list.State{}, false, fmt.Errorf("%s: %w", path, err)
+	}
+	return st, true, nil
+}
+
+// fromFileItems converts items kept by File back into item states.
+func fromFileItems(items []fileItem) ([]list.ItemState, error) {
+	states := make([]list.ItemState, len(items))
+	for i, it := range items {
+		itype, err := list.ParseItemType(it.Type)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		states[i] = list.ItemState{
+			Hash:       it.Hash,
+			Type:       itype,
+			Payload:    it.Payload,
+			Note:       it.Note,
+			Category:   it.Category,
+			Planned:    it.Planned,
+			Duration:   it.Duration,
+			ValidFrom:  it.ValidFrom,
+			ValidUntil: it.ValidUntil,
+			Block:      it.Block,
+		}
+		if it.Display != nil {
+			if states[i].Display, err = it.Display.hints(); err != nil {
+				return nil, fmt.Errorf("item %d: %w", i, err)
+			}
+		}
+	}
+	return states, nil
+}
+
+// SaveList replaces the state saved for the list called name with st.
+func (f *File) SaveList(name string, st list.State) error {
+	path, err := f.path(name, ".json")
+	if err != nil {
+		return err
+	}
+
+	fst := fileState{
+		Items:      toFileItems(st.Items),
+		Selection:  st.Selection,
+		SelectedAt: toFileTime(st.SelectedAt),
+		Note:       st.Note,
+		AutoMode:   st.AutoMode.String(),
+		Version:    st.Version,
+		Plays:      st.Plays,
+		Blocks:     toFileBlocks(st.Blocks),
+	}
+	bs, err := json.MarshalIndent(fst, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeAside(path, bs)
+}
+
+// toFileItems converts item states into the form in which File keeps them.
+func toFileItems(states []list.ItemState) []fileItem {
+	items := make([]fileItem, len(states))
+	for i, it := range states {
+		items[i] = fileItem{
+			Hash:       it.Hash,
+			Type:       it.Type.String(),
+			Payload:    it.Payload,
+			Note:       it.Note,
+			Category:   it.Category,
+			Planned:    it.Planned,
+			Duration:   it.Duration,
+			ValidFrom:  it.ValidFrom,
+			ValidUntil: it.ValidUntil,
+			Block:      it.Block,
+		}
+		if it.Display != (list.DisplayHints{}) {
+			items[i].Display = &fileDisplay{
+				Markup:   it.Display.Markup.String(),
+				Severity: it.Display.Severity.String(),
+				Colour:   it.Display.Colour,
+				Hold:     it.Display.Hold,
+			}
+		}
+	}
+	return items
+}
+
+// fromFileBlocks converts block definitions kept by File back into Blocks.
+func fromFileBlocks(fbs []fileBlock) []list.Block {
+	var bs []list.Block
+	for _, fb := range fbs {
+		bs = append(bs, list.Block{ID: fb.ID, Title: fb.Title, Collapsed: fb.Collapsed})
+	}
+	return bs
+}
+
+// toFileBlocks converts block definitions into the form in which File keeps them.
+func toFileBlocks(bs []list.Block) []fileBlock {
+	var fbs []fileBlock
+	for _, b := range bs {
+		fbs = append(fbs, fileBlock{ID: b.ID, Title: b.Title, Collapsed: b.Collapsed})
+	}
+	return fbs
+}
+
+// hints converts display hints kept by File back into DisplayHints.
+func (d fileDisplay) hints() (list.DisplayHints, error) {
+	h := list.DisplayHints{Colour: d.Colour, Hold: d.Hold}
+	var err error
+	if h.Markup, err = list.ParseMarkup(d.Markup); err != nil {
+		return h, err
+	}
+	h.Severity, err = list.ParseAlertSeverity(d.Severity)
+	return h, err
+}
+
+// log gets the play log of the list called name, opening it if need be.
+func (f *File) log(name string) (*history.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if l, ok := f.logs[name]; ok {
+		return l, nil
+	}
+	path, err := f.path(name, ".history")
+	if err != nil {
+		return nil, err
+	}
+	l, err := history.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	f.logs[name] = l
+	return l, nil
+}
+
+// AppendHistory adds r to the play history of the list called name.
+func (f *File) AppendHistory(name string, r list.PlayRecord) error {
+	l, err := f.log(name)
+	if err != nil {
+		return err
+	}
+	return l.Append(r)
+}
+
+// QueryHistory gets part of the play history of the list called name.
+func (f *File) QueryHistory(name string, from, to time.Time) ([]list.PlayRecord, error) {
+	l, err := f.log(name)
+	if err != nil {
+		return nil, err
+	}
+	return l.Query(from, to)
+}
+
+// fileAudit is the form in which File keeps an audit entry.
+type fileAudit struct {
+	At     time.Time `json:"at"`
+	User   string    `json:"user,omitempty"`
+	Action string    `json:"action"`
+	Detail string    `json:"detail"`
+}
+
+// AppendAudit adds e to the audit log of the list called name, in its .audit file.
+func (f *File) AppendAudit(name string, e AuditEntry) error {
+	path, err := f.path(name, ".audit")
+	if err != nil {
+		return err
+	}
+	bs, err := json.Marshal(fileAudit(e))
+	if err != nil {
+		return err
+	}
+
+	f.auditMu.Lock()
+	defer f.auditMu.Unlock()
+	af, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := af.Write(append(bs, '\n')); err != nil {
+		_ = af.Close()
+		return err
+	}
+	return af.Close()
+}
+
+// QueryAudit gets part of the audit log of the list called name, from its .audit file.
+func (f *File) QueryAudit(name string, from, to time.Time) ([]AuditEntry, error) {
+	path, err := f.path(name, ".audit")
+	if err != nil {
+		return nil, err
+	}
+	af, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer af.Close()
+
+	var es []AuditEntry
+	sc := bufio.NewScanner(af)
+	for n := 1; sc.Scan(); n++ {
+		var fa fileAudit
+		if err := json.Unmarshal(sc.Bytes(), &fa); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if inRange(fa.At, from, to) {
+			es = append(es, AuditEntry(fa))
+		}
+	}
+	return es, sc.Err()
+}
+
+// LoadConfig gets the config overrides for the list called name, from its .toml file.
+func (f *File) LoadConfig(name string) (string, error) {
+	path, err := f.path(name, ".toml")
+	if err != nil {
+		return "", err
+	}
+	bs, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	return string(bs), err
+}
+
+// Close closes every play log f has open.
+func (f *File) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var errs []error
+	for name, l := range f.logs {
+		if err := l.Close(); err != nil {
+			errs = append(errs, err)
+		}
+		delete(f.logs, name)
+	}
+	return errors.Join(errs...)
+}
+
+// toFileTime converts t into the form in which File keeps optional times, where nil is the zero time.
+func toFileTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// fromFileTime converts an optional time kept by File back into a time.
+func fromFileTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
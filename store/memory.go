@@ -0,0 +1,123 @@
+package store
+
+// File memory.go contains Memory, the default Storage, which keeps nothing across restarts.
+
+import (
+	"sync"
+	"time"
+
+	"github.com/MattWindsor91/yaps/list"
+)
+
+func init() {
+	Register("memory", func(string) (Storage, error) { return NewMemory(), nil })
+}
+
+// Memory is a Storage that keeps everything in memory, and so forgets it when yaps stops.
+type Memory struct {
+	// mu guards the maps, in case several lists share the Memory.
+	mu sync.Mutex
+	// lists maps list names to their saved states.
+	lists map[string]list.State
+	// plays maps list names to their play histories.
+	plays map[string][]list.PlayRecord
+	// audits maps list names to their audit logs.
+	audits map[string][]AuditEntry
+	// configs maps list names to their config overrides.
+	configs map[string]string
+}
+
+// NewMemory creates an empty Memory.
+func NewMemory() *Memory {
+	return &Memory{
+		lists:   make(map[string]list.State),
+		plays:   make(map[string][]list.PlayRecord),
+		audits:  make(map[string][]AuditEntry),
+		configs: make(map[string]string),
+	}
+}
+
+// LoadList gets the state last saved for the list called name.
+func (m *Memory) LoadList(name string) (list.State, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.lists[name]
+	return s, ok, nil
+}
+
+// SaveList saves s as the state of the list called name.
+// States from List.State share nothing with the List, so it keeps s as is.
+func (m *Memory) SaveList(name string, s list.State) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lists[name] = s
+	return nil
+}
+
+// AppendHistory adds r to the play history of the list called name.
+func (m *Memory) AppendHistory(name string, r list.PlayRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.plays[name] = append(m.plays[name], r)
+	return nil
+}
+
+// QueryHistory gets part of the play history of the list called name.
+func (m *Memory) QueryHistory(name string, from, to time.Time) ([]list.PlayRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var rs []list.PlayRecord
+	for _, r := range m.plays[name] {
+		if inRange(r.At, from, to) {
+			rs = append(rs, r)
+		}
+	}
+	return rs, nil
+}
+
+// AppendAudit adds e to the audit log of the list called name.
+func (m *Memory) AppendAudit(name string, e AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.audits[name] = append(m.audits[name], e)
+	return nil
+}
+
+// QueryAudit gets part of the audit log of the list called name.
+func (m *Memory) QueryAudit(name string, from, to time.Time) ([]AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var es []AuditEntry
+	for _, e := range m.audits[name] {
+		if inRange(e.At, from, to) {
+			es = append(es, e)
+		}
+	}
+	return es, nil
+}
+
+// LoadConfig gets the config overrides set for the list called name.
+func (m *Memory) LoadConfig(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.configs[name], nil
+}
+
+// SetConfig sets the config overrides for the list called name, as a TOML fragment of list config.
+func (m *Memory) SetConfig(name, overrides string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.configs[name] = overrides
+}
+
+// Close does nothing.
+func (m *Memory) Close() error {
+	return nil
+}
+
+// inRange gets whether t is from time from (inclusive) to time to (exclusive), where zero times are open ends.
+func inRange(t, from, to time.Time) bool {
+	return (from.IsZero() || !t.Before(from)) && (to.IsZero() || t.Before(to))
+}
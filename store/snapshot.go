@@ -0,0 +1,297 @@
+package store
+
+// File snapshot.go contains snapshots: timestamped copies of a list's state, taken on a schedule and kept apart from
+// any Storage, so that operators can go back to the list as it was at some earlier point.
+//
+// Each snapshot of the list called <name> is a file <name>-<yyyymmdd>T<hhmmss>.json in the snapshot directory, named
+// for the local time at which it was taken.
+// It holds the state, play counts included, in the form File keeps it in, so that restoring one into a file store is a
+// matter of copying it over <name>.json while yaps is stopped; it also holds when it was taken, and a summary of the
+// list for checking at a glance that it is the snapshot wanted.
+// After each snapshot, all but the newest few are deleted.
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MattWindsor91/yaps/clock"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// snapshotLayout is the layout of the times in snapshot file names.
+const snapshotLayout = "20060102T150405"
+
+// Schedule is a set of times of day, recurring daily or on certain days of the week.
+type Schedule struct {
+	// Days are the days of the week on which the times come round; if empty, they come round every day.
+	Days []time.Weekday
+	// At are the times of day, in local time, as durations since midnight.
+	At []time.Duration
+}
+
+// ParseSchedule makes a Schedule at each of the local times of day at, such as "02:30", on the days of the week days,
+// such as "mon" or "Sunday" (every day, if empty).
+func ParseSchedule(days, at []string) (Schedule, error) {
+	var s Schedule
+	for _, a := range at {
+		t, err := time.Parse("15:04", a)
+		if err != nil {
+			return s, fmt.Errorf("schedule at %q: time must be HH:MM", a)
+		}
+		s.At = append(s.At, time.Duration(t.Hour())*time.Hour+time.Duration(t.Minute())*time.Minute)
+	}
+	for _, d := range days {
+		wd, err := list.ParseWeekday(d)
+		if err != nil {
+			return s, fmt.Errorf("schedule: %w", err)
+		}
+		s.Days = append(s.Days, wd)
+	}
+	return s, nil
+}
+
+// Next gets the earliest time in s after now, or the zero time if s has no times.
+func (s Schedule) Next(now time.Time) time.Time {
+	var next time.Time
+	y, m, d := now.Date()
+	for off := 0; off <= 7 && next.IsZero(); off++ {
+		day := time.Date(y, m, d+off, 0, 0, 0, 0, now.Location())
+		if !s.on(day.Weekday()) {
+			continue
+		}
+		for _, at := range s.At {
+			if t := day.Add(at); t.After(now) && (next.IsZero() || t.Before(next)) {
+				next = t
+			}
+		}
+	}
+	return next
+}
+
+// on checks whether s's times come round on day d.
+func (s Schedule) on(d time.Weekday) bool {
+	if len(s.Days) == 0 {
+		return true
+	}
+	for _, sd := range s.Days {
+		if sd == d {
+			return true
+		}
+	}
+	return false
+}
+
+// SnapshotPolicy says when to take snapshots of a list, where to keep them, and how many.
+type SnapshotPolicy struct {
+	// Dir is the directory holding the snapshots.
+	Dir string
+	// Schedule is when snapshots are taken.
+	Schedule Schedule
+	// Keep is how many of the newest snapshots are kept; 0 keeps them all.
+	Keep int
+}
+
+// SnapshotReport is the type of functions that RunSnapshots tells of each snapshot it took at path, the older ones it
+// deleted, and any error.
+type SnapshotReport func(path string, deleted []string, err error)
+
+// snapshotSummary is a summary of a list in a snapshot.
+type snapshotSummary struct {
+	Items    int    `json:"items"`
+	Selected string `json:"selected,omitempty"`
+	Plays    int    `json:"plays"`
+}
+
+// fileSnapshot is the form in which snapshots are kept.
+type fileSnapshot struct {
+	Taken   time.Time       `json:"taken"`
+	Summary snapshotSummary `json:"summary"`
+	fileState
+}
+
+// snapshotPath gets the path of the snapshot of the list called name taken at taken, in the directory dir.
+func snapshotPath(dir, name string, taken time.Time) (string, error) {
+	if err := checkName(name); err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, name+"-"+taken.Local().Format(snapshotLayout)+".json"), nil
+}
+
+// WriteSnapshot writes the state st of the list called name, taken at taken, as a snapshot in the directory dir,
+// creating it if need be.
+// It returns the snapshot's path.
+func WriteSnapshot(dir, name string, taken time.Time, st list.State) (string, error) {
+	path, err := snapshotPath(dir, name, taken)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+
+	fs := fileSnapshot{
+		Taken:   taken,
+		Summary: snapshotSummary{Items: len(st.Items)},
+		fileState: fileState{
+			Items:      toFileItems(st.Items),
+			Selection:  st.Selection,
+			SelectedAt: toFileTime(st.SelectedAt),
+			Note:       st.Note,
+			AutoMode:   st.AutoMode.String(),
+			Version:    st.Version,
+			Plays:      st.Plays,
+			Blocks:     toFileBlocks(st.Blocks),
+		},
+	}
+	if 0 <= st.Selection && st.Selection < len(st.Items) {
+		fs.Summary.Selected = st.Items[st.Selection].Hash
+	}
+	for _, n := range st.Plays {
+		fs.Summary.Plays += n
+	}
+
+	bs, err := json.MarshalIndent(fs, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, writeAside(path, bs)
+}
+
+// LoadSnapshot reads the snapshot at path, returning the state it holds and when it was taken.
+func LoadSnapshot(path string) (list.State, time.Time, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return list.State{}, time.Time{}, err
+	}
+
+	var fs fileSnapshot
+	if err := json.Unmarshal(bs, &fs); err != nil {
+		return list.State{}, time.Time{}, fmt.Errorf("%s: %w", path, err)
+	}
+	st := list.State{
+		Selection:  fs.Selection,
+		SelectedAt: fromFileTime(fs.SelectedAt),
+		Note:       fs.Note,
+		Version:    fs.Version,
+		Plays:      fs.Plays,
+		Blocks:     fromFileBlocks(fs.Blocks),
+	}
+	if st.AutoMode, err = list.ParseAutoMode(fs.AutoMode); err != nil {
+		return list.State{}, time.Time{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if st.Items, err = fromFileItems(fs.Items); err != nil {
+		return list.State{}, time.Time{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return st, fs.Taken, nil
+}
+
+// Snapshots gets the paths of the snapshots of the list called name in the directory dir, oldest first.
+// A missing directory holds no snapshots.
+func Snapshots(dir, name string) ([]string, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var paths []string
+	for _, e := range entries {
+		// Matching the time exactly keeps out the snapshots of lists whose names start with name and a dash.
+		stamp, ok := strings.CutPrefix(e.Name(), name+"-")
+		if !ok || e.IsDir() {
+			continue
+		}
+		stamp, ok = strings.CutSuffix(stamp, ".json")
+		if _, err := time.Parse(snapshotLayout, stamp); !ok || err != nil {
+			continue
+		}
+		paths = append(paths, filepath.Join(dir, e.Name()))
+	}
+	// The times in the names sort in the order the snapshots were taken.
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// RotateSnapshots deletes all but the newest keep snapshots of the list called name in the directory dir, returning
+// the paths of those it deleted; if keep is 0, it deletes none.
+func RotateSnapshots(dir, name string, keep int) ([]string, error) {
+	paths, err := Snapshots(dir, name)
+	if err != nil || keep <= 0 || len(paths) <= keep {
+		return nil, err
+	}
+
+	var deleted []string
+	for _, path := range paths[:len(paths)-keep] {
+		if err := os.Remove(path); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, path)
+	}
+	return deleted, nil
+}
+
+// RunSnapshots takes snapshots of the list behind client, under the name name, as policy p says, by clk, until ctx is
+// cancelled or the Controller hangs up.
+// It tells report, if it isn't nil, of each snapshot; failing to take one doesn't stop it taking the next.
+// It hangs up client when it returns.
+func RunSnapshots(ctx context.Context, client *controller.Client, name string, p SnapshotPolicy, clk clock.Clock, report SnapshotReport) error {
+	// The client receives broadcasts too, and must keep draining them.
+	go func() {
+		for range client.Rx {
+		}
+	}()
+	// Closing our request channel is how we hang up on the Controller.
+	defer close(client.Tx)
+
+	for {
+		now := clk.Now()
+		next := p.Schedule.Next(now)
+		if next.IsZero() {
+			return nil
+		}
+
+		t := clk.NewTimer(next.Sub(now))
+		select {
+		case <-t.C():
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		}
+
+		// Naming the snapshot for when it was due, rather than when the timer got round to firing, keeps names tidy.
+		path, deleted, err := snapshot(ctx, client, name, p, next)
+		if errors.Is(err, controller.ErrControllerShutDown) {
+			return nil
+		}
+		if report != nil {
+			report(path, deleted, err)
+		}
+	}
+}
+
+// snapshot takes one snapshot, at taken, of the list behind client, then rotates the snapshots as p says.
+func snapshot(ctx context.Context, client *controller.Client, name string, p SnapshotPolicy, taken time.Time) (string, []string, error) {
+	st, err := list.GetState(ctx, client)
+	if err != nil {
+		return "", nil, err
+	}
+	path, err := WriteSnapshot(p.Dir, name, taken, st)
+	if err != nil {
+		return path, nil, err
+	}
+	deleted, err := RotateSnapshots(p.Dir, name, p.Keep)
+	return path, deleted, err
+}
@@ -0,0 +1,465 @@
+package store
+
+// File sqlite.go contains SQLite, a Storage kept in a SQLite database.
+//
+// Each part of the state has its own table, so that the database can be queried directly, for example for reports:
+// 'lists' holds one row per list, 'items' one per item, 'blocks' one per block, 'plays' the play counts, 'history' the
+// play history, 'audit' the audit log, and 'config' the config overrides.
+// Times are stored as RFC 3339 text (empty for none), and durations as whole milliseconds.
+// Columns added since a table was first created are added to older databases when they are opened.
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	// Registers the 'sqlite3' driver.
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// sqliteSchema creates the tables a SQLite store needs, if they don't exist.
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS lists (
+	name      TEXT PRIMARY KEY,
+	selection   INTEGER NOT NULL,
+	note        TEXT NOT NULL,
+	automode    TEXT NOT NULL,
+	version     INTEGER NOT NULL,
+	selected_at TEXT NOT NULL DEFAULT ''
+);
+CREATE TABLE IF NOT EXISTS items (
+	list        TEXT NOT NULL,
+	idx         INTEGER NOT NULL,
+	hash        TEXT NOT NULL,
+	type        TEXT NOT NULL,
+	payload     TEXT NOT NULL,
+	note        TEXT NOT NULL,
+	category    TEXT NOT NULL,
+	planned     TEXT NOT NULL,
+	duration_ms INTEGER NOT NULL,
+	valid_from  TEXT NOT NULL,
+	valid_until TEXT NOT NULL,
+	markup      TEXT NOT NULL DEFAULT 'plain',
+	severity    TEXT NOT NULL DEFAULT 'info',
+	colour      TEXT NOT NULL DEFAULT '',
+	hold_ms     INTEGER NOT NULL DEFAULT 0,
+	block       TEXT NOT NULL DEFAULT '',
+	PRIMARY KEY (list, idx)
+);
+CREATE TABLE IF NOT EXISTS blocks (
+	list      TEXT NOT NULL,
+	id        TEXT NOT NULL,
+	title     TEXT NOT NULL,
+	collapsed INTEGER NOT NULL,
+	PRIMARY KEY (list, id)
+);
+CREATE TABLE IF NOT EXISTS plays (
+	list  TEXT NOT NULL,
+	hash  TEXT NOT NULL,
+	count INTEGER NOT NULL,
+	PRIMARY KEY (list, hash)
+);
+CREATE TABLE IF NOT EXISTS history (
+	list    TEXT NOT NULL,
+	at      TEXT NOT NULL,
+	hash    TEXT NOT NULL,
+	payload TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS history_at ON history (list, at);
+CREATE TABLE IF NOT EXISTS audit (
+	list   TEXT NOT NULL,
+	at     TEXT NOT NULL,
+	user   TEXT NOT NULL,
+	action TEXT NOT NULL,
+	detail TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_at ON audit (list, at);
+CREATE TABLE IF NOT EXISTS config (
+	list      TEXT PRIMARY KEY,
+	overrides TEXT NOT NULL
+);
+`
+
+// sqliteAddedColumns maps tables to the definitions of the columns added to them since they were first created.
+var sqliteAddedColumns = map[string][]string{
+	"lists": {
+		"selected_at TEXT NOT NULL DEFAULT ''",
+	},
+	"items": {
+		"markup TEXT NOT NULL DEFAULT 'plain'",
+		"severity TEXT NOT NULL DEFAULT 'info'",
+		"colour TEXT NOT NULL DEFAULT ''",
+		"hold_ms INTEGER NOT NULL DEFAULT 0",
+		"block TEXT NOT NULL DEFAULT ''",
+	},
+}
+
+func init() {
+	Register("sqlite", func(path string) (Storage, error) {
+		if path == "" {
+			return nil, fmt.Errorf("sqlite storage needs a path, as 'sqlite:<path>'")
+		}
+		return OpenSQLite(path)
+	})
+}
+
+// SQLite is a Storage kept in a SQLite database.
+type SQLite struct {
+	db *sql.DB
+}
+
+// OpenSQLite opens the SQLite database at path as a Storage, creating it if need be.
+func OpenSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite only allows one writer anyway, and this keeps in-memory databases from splitting per connection.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := addColumns(db); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &SQLite{db: db}, nil
+}
+
+// addColumns adds any of sqliteAddedColumns missing from the tables in db, which were created by an older yaps.
+func addColumns(db *sql.DB) error {
+	for table, defs := range sqliteAddedColumns {
+		have, err := columns(db, table)
+		if err != nil {
+			return err
+		}
+		for _, def := range defs {
+			if _, ok := have[strings.Fields(def)[0]]; ok {
+				continue
+			}
+			if _, err := db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + def); err != nil {
+				return fmt.Errorf("adding column to %s: %w", table, err)
+			}
+		}
+	}
+	return nil
+}
+
+// columns gets the names of the columns of table in db.
+func columns(db *sql.DB, table string) (map[string]struct{}, error) {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols := make(map[string]struct{})
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		cols[name] = struct{}{}
+	}
+	return cols, rows.Err()
+}
+
+// Close closes the database.
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+// LoadList gets the state last saved for the list called name.
+func (s *SQLite) LoadList(name string) (list.State, bool, error) {
+	var (
+		st               list.State
+		auto, selectedAt string
+	)
+	err := s.db.QueryRow(`SELECT selection, note, automode, version, selected_at FROM lists WHERE name = ?`, name).
+		Scan(&st.Selection, &st.Note, &auto, &st.Version, &selectedAt)
+	if err == sql.ErrNoRows {
+		return st, false, nil
+	}
+	if err != nil {
+		return st, false, err
+	}
+	if st.AutoMode, err = list.ParseAutoMode(auto); err != nil {
+		return st, false, err
+	}
+	if st.SelectedAt, err = parseTime(selectedAt); err != nil {
+		return st, false, err
+	}
+
+	if st.Items, err = s.loadItems(name); err != nil {
+		return st, false, err
+	}
+	if st.Blocks, err = s.loadBlocks(name); err != nil {
+		return st, false, err
+	}
+	if st.Plays, err = s.loadPlays(name); err != nil {
+		return st, false, err
+	}
+	return st, true, nil
+}
+
+// loadItems loads the items saved for the list called name.
+func (s *SQLite) loadItems(name string) ([]list.ItemState, error) {
+	rows, err := s.db.Query(`SELECT hash, type, payload, note, category, planned, duration_ms, valid_from, valid_until,
+		markup, severity, colour, hold_ms, block
+		FROM items WHERE list = ? ORDER BY idx`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []list.ItemState
+	for rows.Next() {
+		var (
+			it                   list.ItemState
+			itype                string
+			planned, from, until string
+			durationMs, holdMs   int64
+			markup, severity     string
+		)
+		if err := rows.Scan(&it.Hash, &itype, &it.Payload, &it.Note, &it.Category, &planned, &durationMs, &from, &until,
+			&markup, &severity, &it.Display.Colour, &holdMs, &it.Block); err != nil {
+			return nil, err
+		}
+		if it.Type, err = list.ParseItemType(itype); err != nil {
+			return nil, err
+		}
+		if it.Display.Markup, err = list.ParseMarkup(markup); err != nil {
+			return nil, err
+		}
+		if it.Display.Severity, err = list.ParseAlertSeverity(severity); err != nil {
+			return nil, err
+		}
+		it.Display.Hold = time.Duration(holdMs) * time.Millisecond
+		for _, t := range []struct {
+			dst *time.Time
+			s   string
+		}{{&it.Planned, planned}, {&it.ValidFrom, from}, {&it.ValidUntil, until}} {
+			if *t.dst, err = parseTime(t.s); err != nil {
+				return nil, err
+			}
+		}
+		it.Duration = time.Duration(durationMs) * time.Millisecond
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// loadBlocks loads the block definitions saved for the list called name, in ID order.
+func (s *SQLite) loadBlocks(name string) ([]list.Block, error) {
+	rows, err := s.db.Query(`SELECT id, title, collapsed FROM blocks WHERE list = ? ORDER BY id`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blocks []list.Block
+	for rows.Next() {
+		var b list.Block
+		if err := rows.Scan(&b.ID, &b.Title, &b.Collapsed); err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, b)
+	}
+	return blocks, rows.Err()
+}
+
+// loadPlays loads the play counts saved for the list called name.
+func (s *SQLite) loadPlays(name string) (map[string]int, error) {
+	rows, err := s.db.Query(`SELECT hash, count FROM plays WHERE list = ?`, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	plays := make(map[string]int)
+	for rows.Next() {
+		var (
+			h string
+			n int
+		)
+		if err := rows.Scan(&h, &n); err != nil {
+			return nil, err
+		}
+		plays[h] = n
+	}
+	return plays, rows.Err()
+}
+
+// SaveList replaces the state saved for the list called name with st, all at once.
+func (s *SQLite) SaveList(name string, st list.State) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.Exec(`INSERT OR REPLACE INTO lists (name, selection, note, automode, version, selected_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		name, st.Selection, st.Note, st.AutoMode.String(), st.Version, formatTime(st.SelectedAt)); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM items WHERE list = ?`, name); err != nil {
+		return err
+	}
+	for i, it := range st.Items {
+		if _, err = tx.Exec(`INSERT INTO items
+			(list, idx, hash, type, payload, note, category, planned, duration_ms, valid_from, valid_until,
+			markup, severity, colour, hold_ms, block)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			name, i, it.Hash, it.Type.String(), it.Payload, it.Note, it.Category,
+			formatTime(it.Planned), it.Duration.Milliseconds(), formatTime(it.ValidFrom), formatTime(it.ValidUntil),
+			it.Display.Markup.String(), it.Display.Severity.String(), it.Display.Colour, it.Display.Hold.Milliseconds(), it.Block); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(`DELETE FROM blocks WHERE list = ?`, name); err != nil {
+		return err
+	}
+	for _, b := range st.Blocks {
+		if _, err = tx.Exec(`INSERT INTO blocks (list, id, title, collapsed) VALUES (?, ?, ?, ?)`,
+			name, b.ID, b.Title, b.Collapsed); err != nil {
+			return err
+		}
+	}
+
+	if _, err = tx.Exec(`DELETE FROM plays WHERE list = ?`, name); err != nil {
+		return err
+	}
+	for h, n := range st.Plays {
+		if _, err = tx.Exec(`INSERT INTO plays (list, hash, count) VALUES (?, ?, ?)`, name, h, n); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// AppendHistory adds r to the play history of the list called name.
+func (s *SQLite) AppendHistory(name string, r list.PlayRecord) error {
+	_, err := s.db.Exec(`INSERT INTO history (list, at, hash, payload) VALUES (?, ?, ?, ?)`,
+		name, formatTime(r.At), r.Hash, r.Payload)
+	return err
+}
+
+// QueryHistory gets part of the play history of the list called name.
+func (s *SQLite) QueryHistory(name string, from, to time.Time) ([]list.PlayRecord, error) {
+	// RFC 3339 times in UTC with fixed-width fractions sort as text in time order, so the range can be done in SQL.
+	q := `SELECT at, hash, payload FROM history WHERE list = ?`
+	args := []interface{}{name}
+	if !from.IsZero() {
+		q += ` AND at >= ?`
+		args = append(args, formatTime(from))
+	}
+	if !to.IsZero() {
+		q += ` AND at < ?`
+		args = append(args, formatTime(to))
+	}
+	rows, err := s.db.Query(q+` ORDER BY at, rowid`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rs []list.PlayRecord
+	for rows.Next() {
+		var (
+			r  list.PlayRecord
+			at string
+		)
+		if err := rows.Scan(&at, &r.Hash, &r.Payload); err != nil {
+			return nil, err
+		}
+		if r.At, err = parseTime(at); err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	return rs, rows.Err()
+}
+
+// AppendAudit adds e to the audit log of the list called name.
+func (s *SQLite) AppendAudit(name string, e AuditEntry) error {
+	_, err := s.db.Exec(`INSERT INTO audit (list, at, user, action, detail) VALUES (?, ?, ?, ?, ?)`,
+		name, formatTime(e.At), e.User, e.Action, e.Detail)
+	return err
+}
+
+// QueryAudit gets part of the audit log of the list called name.
+func (s *SQLite) QueryAudit(name string, from, to time.Time) ([]AuditEntry, error) {
+	q, args := `SELECT at, user, action, detail FROM audit WHERE list = ?`, []interface{}{name}
+	if !from.IsZero() {
+		q += ` AND at >= ?`
+		args = append(args, formatTime(from))
+	}
+	if !to.IsZero() {
+		q += ` AND at < ?`
+		args = append(args, formatTime(to))
+	}
+	rows, err := s.db.Query(q+` ORDER BY at, rowid`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var es []AuditEntry
+	for rows.Next() {
+		var (
+			e  AuditEntry
+			at string
+		)
+		if err := rows.Scan(&at, &e.User, &e.Action, &e.Detail); err != nil {
+			return nil, err
+		}
+		if e.At, err = parseTime(at); err != nil {
+			return nil, err
+		}
+		es = append(es, e)
+	}
+	return es, rows.Err()
+}
+
+// LoadConfig gets the config overrides for the list called name, from the 'config' table.
+// yaps never writes that table itself; it is there for whoever manages the database.
+func (s *SQLite) LoadConfig(name string) (string, error) {
+	var overrides string
+	err := s.db.QueryRow(`SELECT overrides FROM config WHERE list = ?`, name).Scan(&overrides)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return overrides, err
+}
+
+// sqliteTimeFormat is RFC 3339 with a fixed-width fraction, so that times in UTC sort as text.
+const sqliteTimeFormat = "2006-01-02T15:04:05.000000000Z07:00"
+
+// formatTime formats t for the database, as the empty string if it is zero.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(sqliteTimeFormat)
+}
+
+// parseTime parses a time from the database, where the empty string means the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
@@ -0,0 +1,182 @@
+// Package store keeps list state, play history, audit logs and config overrides somewhere that can outlive yaps.
+//
+// A Storage holds any number of lists, each under its own name, and comes from a driver registered under a kind.
+// yaps ships 'memory', which keeps nothing across restarts; 'file', which keeps each list in files in a directory;
+// and 'sqlite', which keeps everything in one database file.
+// Other drivers need only implement Storage and call Register, much like database/sql drivers.
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// Storage is the interface of places yaps keeps list state, play history, audit logs and config overrides.
+type Storage interface {
+	// LoadList gets the state last saved for the list called name, and whether there was one.
+	LoadList(name string) (list.State, bool, error)
+	// SaveList replaces the state saved for the list called name with s.
+	SaveList(name string, s list.State) error
+	// AppendHistory adds r to the end of the play history of the list called name.
+	AppendHistory(name string, r list.PlayRecord) error
+	// QueryHistory gets the play history of the list called name from time from (inclusive) to time to (exclusive),
+	// oldest first.
+	// A zero time leaves that end of the range open.
+	QueryHistory(name string, from, to time.Time) ([]list.PlayRecord, error)
+	// AppendAudit adds e to the end of the audit log of the server of the list called name.
+	AppendAudit(name string, e AuditEntry) error
+	// QueryAudit gets the audit log of the server of the list called name from time from (inclusive) to time to
+	// (exclusive), oldest first.
+	// A zero time leaves that end of the range open.
+	QueryAudit(name string, from, to time.Time) ([]AuditEntry, error)
+	// LoadConfig gets the config overrides for the list called name, as a TOML fragment of list config.
+	// If there are none, it is empty.
+	LoadConfig(name string) (string, error)
+	// Close releases anything the Storage holds open.
+	Close() error
+}
+
+// Driver is the type of functions that open a Storage of some kind, given the part of its spec after the colon.
+type Driver func(arg string) (Storage, error)
+
+var (
+	// driversMu guards drivers.
+	driversMu sync.RWMutex
+	// drivers maps storage kinds to their drivers.
+	drivers = make(map[string]Driver)
+)
+
+// Register makes driver open storage specs of the given kind.
+// It panics if kind already has a driver, as that is a programming error.
+func Register(kind string, driver Driver) {
+	driversMu.Lock()
+	defer driversMu.Unlock()
+	if _, ok := drivers[kind]; ok {
+		panic("store: driver registered twice for kind " + kind)
+	}
+	drivers[kind] = driver
+}
+
+// Kinds gets the kinds of storage that have drivers, in order.
+func Kinds() []string {
+	driversMu.RLock()
+	defer driversMu.RUnlock()
+	kinds := make([]string, 0, len(drivers))
+	for k := range drivers {
+		kinds = append(kinds, k)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// Open opens the Storage described by spec, which has the form '<kind>' or '<kind>:<arg>'.
+// An empty spec is 'memory'.
+func Open(spec string) (Storage, error) {
+	kind, arg, _ := strings.Cut(spec, ":")
+	if kind == "" {
+		kind = "memory"
+	}
+
+	driversMu.RLock()
+	driver, ok := drivers[kind]
+	driversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown storage kind %q (have: %s)", kind, strings.Join(Kinds(), ", "))
+	}
+	return driver(arg)
+}
+
+// Recovery is the type of functions that rebuild a list's state when Attach can't restore it.
+// cause is why the saved state couldn't be restored, or nil if there wasn't one.
+type Recovery func(cause error) (list.State, error)
+
+// RepairReport is the type of functions that Attach tells of the repairs it made to a saved state that broke the
+// list's invariants; see list.State.Repair.
+type RepairReport func(repairs []string)
+
+// Attach makes l save its state to, and log its plays in, the list called name in s.
+// It first restores l to the state last saved there, if any.
+// If the saved state breaks the list's invariants and report isn't nil, Attach repairs it, tells report what it did,
+// and saves the repaired state in place of the old one.
+// If there is no saved state, or it can't be restored, and recovery isn't nil, Attach instead restores l to the state
+// recovery rebuilds, and saves that in place of the old one; otherwise, a missing state leaves l as it is, and one that
+// can't be restored is an error.
+func Attach(l *list.List, s Storage, name string, recovery Recovery, report RepairReport) error {
+	st, ok, err := s.LoadList(name)
+	if err != nil {
+		err = fmt.Errorf("couldn't load list %q: %w", name, err)
+	} else if ok {
+		if err = l.Restore(st); err != nil {
+			err = fmt.Errorf("couldn't restore list %q: %w", name, err)
+		}
+		var ie list.IntegrityError
+		if errors.As(err, &ie) && report != nil {
+			err = attachRepaired(l, s, name, st, report)
+		}
+	}
+
+	switch {
+	case (err != nil || !ok) && recovery != nil:
+		if err := attachRecovered(l, s, name, recovery, err); err != nil {
+			return err
+		}
+	case err != nil:
+		return err
+	}
+
+	l.SetStateSaver(func(st list.State) error {
+		return s.SaveList(name, st)
+	})
+	l.SetPlayLog(PlayLog(s, name))
+	return nil
+}
+
+// attachRepaired restores l to a repair of the state st, which breaks the list's invariants, telling report what it
+// did, and saves the repaired state as the list called name in s.
+func attachRepaired(l *list.List, s Storage, name string, st list.State, report RepairReport) error {
+	rst, repairs := st.Repair()
+	if err := l.Restore(rst); err != nil {
+		return fmt.Errorf("couldn't restore repaired list %q: %w", name, err)
+	}
+	report(repairs)
+	return s.SaveList(name, rst)
+}
+
+// attachRecovered restores l to the state recovery rebuilds, given cause, and saves it as the list called name in s.
+func attachRecovered(l *list.List, s Storage, name string, recovery Recovery, cause error) error {
+	st, err := recovery(cause)
+	if err != nil {
+		return fmt.Errorf("couldn't recover list %q: %w", name, err)
+	}
+	if err := l.Restore(st); err != nil {
+		return fmt.Errorf("couldn't restore recovered list %q: %w", name, err)
+	}
+	return s.SaveList(name, st)
+}
+
+// PlayLog gets the play history of the list called name in s.
+func PlayLog(s Storage, name string) list.PlayLog {
+	return playLog{s: s, name: name}
+}
+
+// playLog adapts the play history of one list in a Storage into a list.PlayLog.
+type playLog struct {
+	s    Storage
+	name string
+}
+
+// Append appends r to the list's play history.
+func (p playLog) Append(r list.PlayRecord) error {
+	return p.s.AppendHistory(p.name, r)
+}
+
+// Query queries the list's play history.
+func (p playLog) Query(from, to time.Time) ([]list.PlayRecord, error) {
+	return p.s.QueryHistory(p.name, from, to)
+}
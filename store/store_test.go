@@ -0,0 +1,467 @@
+package store_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/clock"
+	"github.com/MattWindsor91/yaps/controller"
+	"github.com/MattWindsor91/yaps/list"
+	"github.com/MattWindsor91/yaps/store"
+)
+
+// TestAttach checks that lists attached to each kind of storage save their changes and plays there, and that lists
+// attached later get them back.
+func TestAttach(t *testing.T) {
+	forEachStorage(t, testAttach)
+}
+
+// forEachStorage runs test on a fresh Storage of each kind yaps ships.
+func forEachStorage(t *testing.T, test func(*testing.T, store.Storage)) {
+	stores := map[string]func(t *testing.T) store.Storage{
+		"memory": func(*testing.T) store.Storage { return store.NewMemory() },
+		"file": func(t *testing.T) store.Storage {
+			s, err := store.Open("file:" + t.TempDir())
+			if err != nil {
+				t.Fatal("couldn't open storage:", err)
+			}
+			return s
+		},
+		"sqlite": func(t *testing.T) store.Storage {
+			s, err := store.Open("sqlite:" + filepath.Join(t.TempDir(), "yaps.db"))
+			if err != nil {
+				t.Fatal("couldn't open storage:", err)
+			}
+			return s
+		},
+	}
+
+	for name, open := range stores {
+		t.Run(name, func(t *testing.T) {
+			s := open(t)
+			defer s.Close()
+			test(t, s)
+		})
+	}
+}
+
+func testAttach(t *testing.T, s store.Storage) {
+	ignore := func(interface{}) {}
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	l := list.New()
+	if err := store.Attach(l, s, "main", nil, nil); err != nil {
+		t.Fatal("couldn't attach empty store:", err)
+	}
+	for i, h := range []string{"a", "b"} {
+		add := list.AddItemRequest{Index: i, Item: *list.NewTrack(h, h+".mp3")}
+		if err := l.HandleRequest(context.Background(), ignore, ignore, add); err != nil {
+			t.Fatal("unexpected error adding:", err)
+		}
+	}
+	if _, err := l.SetItemValidity(1, "b", time.Time{}, start.Add(time.Hour)); err != nil {
+		t.Fatal("unexpected error setting validity:", err)
+	}
+	if err := l.Add(list.NewText("t", "*Stand by*"), 2); err != nil {
+		t.Fatal("unexpected error adding text:", err)
+	}
+	hints := list.DisplayHints{Markup: list.MarkupMarkdown, Severity: list.AlertWarning, Colour: "#ff8800", Hold: 10 * time.Second}
+	if _, err := l.SetItemDisplay(2, "t", hints); err != nil {
+		t.Fatal("unexpected error setting display hints:", err)
+	}
+	if err := l.NewBlock("ads", 1, 2, "Ad break"); err != nil {
+		t.Fatal("unexpected error making block:", err)
+	}
+	for _, r := range []interface{}{
+		list.SetListNoteRequest{Note: "hello"},
+		list.SetSelectRequest{Index: 0, Hash: "a"},
+	} {
+		if err := l.HandleRequest(context.Background(), ignore, ignore, r); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	// A list under another name shouldn't see any of this.
+	if _, ok, err := s.LoadList("other"); err != nil || ok {
+		t.Errorf("other list: got ok=%v err=%v, want nothing", ok, err)
+	}
+
+	l2 := list.New()
+	if err := store.Attach(l2, s, "main", nil, nil); err != nil {
+		t.Fatal("couldn't attach full store:", err)
+	}
+	if got, want := fmt.Sprint(l2.State()), fmt.Sprint(l.State()); got != want {
+		t.Errorf("restored state:\ngot  %s\nwant %s", got, want)
+	}
+
+	rs, err := s.QueryHistory("main", time.Time{}, time.Time{})
+	if err != nil {
+		t.Fatal("couldn't query plays:", err)
+	}
+	if len(rs) != 1 || rs[0].Hash != "a" || rs[0].Payload != "a.mp3" {
+		t.Fatalf("plays: got %v, want one play of a", rs)
+	}
+	if rs, err := s.QueryHistory("main", time.Time{}, rs[0].At); err != nil || len(rs) != 0 {
+		t.Errorf("plays before the first: got %v (err %v), want none", rs, err)
+	}
+}
+
+// TestStorage_audit checks that each kind of storage keeps audit entries apart by list, in order, and queries them by
+// time.
+func TestStorage_audit(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, s store.Storage) {
+		start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+		es := []store.AuditEntry{
+			{At: start, User: "root", Action: store.AuditTune, Detail: "log.net: false -> true"},
+			{At: start.Add(time.Minute), Action: store.AuditDenied, Detail: "a1 tune needs group \"ops\""},
+			{At: start.Add(2 * time.Minute), User: "root", Action: store.AuditTune, Detail: "log.net: true -> false"},
+		}
+		for _, e := range es {
+			if err := s.AppendAudit("main", e); err != nil {
+				t.Fatal("couldn't append audit entry:", err)
+			}
+		}
+		if err := s.AppendAudit("other", store.AuditEntry{At: start, Action: store.AuditTune}); err != nil {
+			t.Fatal("couldn't append audit entry:", err)
+		}
+
+		check := func(from, to time.Time, want ...store.AuditEntry) {
+			t.Helper()
+			got, err := s.QueryAudit("main", from, to)
+			if err != nil {
+				t.Fatal("couldn't query audit log:", err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("audit from %v to %v: got %v, want %v", from, to, got, want)
+			}
+			for i := range got {
+				if !got[i].At.Equal(want[i].At) || got[i].User != want[i].User || got[i].Action != want[i].Action || got[i].Detail != want[i].Detail {
+					t.Errorf("audit entry %d from %v to %v: got %+v, want %+v", i, from, to, got[i], want[i])
+				}
+			}
+		}
+		check(time.Time{}, time.Time{}, es...)
+		check(start.Add(time.Minute), time.Time{}, es[1:]...)
+		check(time.Time{}, start.Add(time.Minute), es[0])
+		if got, err := s.QueryAudit("none", time.Time{}, time.Time{}); err != nil || len(got) != 0 {
+			t.Errorf("audit of a list without one: got %v (err %v), want none", got, err)
+		}
+	})
+}
+
+// TestAttach_recover checks that a list whose saved state is corrupt is rebuilt from its play history, when asked, and
+// that the rebuilt state replaces the corrupt one.
+func TestAttach_recover(t *testing.T) {
+	dir := t.TempDir()
+	s, err := store.Open("file:" + dir)
+	if err != nil {
+		t.Fatal("couldn't open storage:", err)
+	}
+	defer s.Close()
+
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, h := range []string{"a", "b", "a"} {
+		r := list.PlayRecord{At: start.Add(time.Duration(i) * time.Minute), Hash: h, Payload: h + ".mp3"}
+		if err := s.AppendHistory("main", r); err != nil {
+			t.Fatal("couldn't append play:", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.json"), []byte("{not json"), 0o644); err != nil {
+		t.Fatal("couldn't corrupt state:", err)
+	}
+
+	if err := store.Attach(list.New(), s, "main", nil, nil); err == nil {
+		t.Fatal("attaching a corrupt store without recovery: no error")
+	}
+
+	var cause error
+	recovery := func(c error) (list.State, error) {
+		cause = c
+		return list.RecoverState(store.PlayLog(s, "main"), start)
+	}
+	l := list.New()
+	if err := store.Attach(l, s, "main", recovery, nil); err != nil {
+		t.Fatal("couldn't attach with recovery:", err)
+	}
+	if cause == nil {
+		t.Error("recovery wasn't told why")
+	}
+
+	st := l.State()
+	if len(st.Items) != 2 || st.Items[0].Hash != "a" || st.Items[1].Hash != "b" || st.Items[0].Payload != "a.mp3" {
+		t.Errorf("recovered items: got %v, want a then b", st.Items)
+	}
+	if st.Selection != 0 {
+		t.Errorf("recovered selection: got %d, want 0 (the last played)", st.Selection)
+	}
+	if st.Plays["a"] != 2 || st.Plays["b"] != 1 {
+		t.Errorf("recovered play counts: got %v, want a=2 b=1", st.Plays)
+	}
+
+	if _, ok, err := s.LoadList("main"); err != nil || !ok {
+		t.Errorf("recovered state wasn't saved: ok=%v err=%v", ok, err)
+	}
+}
+
+// TestAttach_repair checks that a list whose saved state breaks the list's invariants is refused, unless repairs are
+// allowed, in which case the repaired state is reported and replaces the corrupt one.
+func TestAttach_repair(t *testing.T) {
+	s := store.NewMemory()
+	corrupt := list.State{
+		Items: []list.ItemState{
+			{Hash: "a", Type: list.ItemTrack, Payload: "a.mp3"},
+			{Hash: "a", Type: list.ItemTrack, Payload: "again.mp3"},
+			{Hash: "news", Type: list.ItemText, Payload: "NEWS"},
+		},
+		Selection: 2,
+		Plays:     map[string]int{"a": -1},
+	}
+	if err := s.SaveList("main", corrupt); err != nil {
+		t.Fatal("couldn't save corrupt state:", err)
+	}
+
+	var ie list.IntegrityError
+	if err := store.Attach(list.New(), s, "main", nil, nil); !errors.As(err, &ie) {
+		t.Fatalf("attaching a corrupt store without repair: got %v, want an IntegrityError", err)
+	}
+	if len(ie.Problems) != 3 {
+		t.Errorf("problems: got %q, want 3", ie.Problems)
+	}
+
+	var repairs []string
+	l := list.New()
+	if err := store.Attach(l, s, "main", nil, func(rs []string) { repairs = rs }); err != nil {
+		t.Fatal("couldn't attach with repair:", err)
+	}
+	if len(repairs) != 3 {
+		t.Errorf("repairs: got %q, want 3", repairs)
+	}
+
+	st := l.State()
+	if got := fmt.Sprint(st.Items); len(st.Items) != 2 || st.Items[0].Payload != "a.mp3" || st.Items[1].Hash != "news" {
+		t.Errorf("repaired items: got %s, want a.mp3 then news", got)
+	}
+	if st.Selection != -1 {
+		t.Errorf("repaired selection: got %d, want -1", st.Selection)
+	}
+	if len(st.Plays) != 0 {
+		t.Errorf("repaired play counts: got %v, want none", st.Plays)
+	}
+
+	saved, _, err := s.LoadList("main")
+	if err != nil {
+		t.Fatal("couldn't load repaired state:", err)
+	}
+	if problems := saved.Check(); len(problems) != 0 {
+		t.Errorf("saved state still corrupt: %q", problems)
+	}
+}
+
+// TestFile_LoadConfig checks that file storage reads config overrides from each list's .toml file, if it has one.
+func TestFile_LoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.toml"), []byte("dedupe = true\n"), 0o644); err != nil {
+		t.Fatal("couldn't write overrides:", err)
+	}
+	s, err := store.Open("file:" + dir)
+	if err != nil {
+		t.Fatal("couldn't open storage:", err)
+	}
+	defer s.Close()
+
+	for name, want := range map[string]string{"main": "dedupe = true\n", "other": ""} {
+		if got, err := s.LoadConfig(name); err != nil || got != want {
+			t.Errorf("%s: got %q (err %v), want %q", name, got, err, want)
+		}
+	}
+	if _, err := s.LoadConfig("../main"); err == nil {
+		t.Error("loading a list name with a path separator: no error")
+	}
+}
+
+// TestTemplateDir checks that a saved template loads back by name from its directory, and that names can't escape it.
+func TestTemplateDir(t *testing.T) {
+	dir := t.TempDir()
+	want := list.Template{Note: "Weekly show", AutoMode: list.AutoNext, Items: []list.ItemState{
+		{Hash: "x", Type: list.ItemTrack, Payload: "theme.mp3", Category: "jingle"},
+	}}
+	if err := store.SaveTemplate(filepath.Join(dir, "weekly.json"), want); err != nil {
+		t.Fatal("unexpected error saving:", err)
+	}
+
+	load := store.TemplateDir(dir)
+	got, err := load("weekly")
+	if err != nil {
+		t.Fatal("unexpected error loading:", err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	for _, name := range []string{"", "..", "../weekly", "sub/weekly"} {
+		if _, err := load(name); err == nil {
+			t.Errorf("loading %q: no error", name)
+		}
+	}
+}
+
+// TestOpen_unknown checks that opening storage of a kind without a driver fails.
+func TestOpen_unknown(t *testing.T) {
+	if _, err := store.Open("redis:localhost"); err == nil {
+		t.Error("opening redis storage: no error")
+	}
+}
+
+// TestOpenSQLite_oldSchema checks that opening a database made before items had display hints adds their columns,
+// keeping the items already saved.
+func TestOpenSQLite_oldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "yaps.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal("couldn't open database:", err)
+	}
+	for _, q := range []string{
+		`CREATE TABLE lists (name TEXT PRIMARY KEY, selection INTEGER NOT NULL, note TEXT NOT NULL,
+			automode TEXT NOT NULL, version INTEGER NOT NULL)`,
+		`CREATE TABLE items (list TEXT NOT NULL, idx INTEGER NOT NULL, hash TEXT NOT NULL, type TEXT NOT NULL,
+			payload TEXT NOT NULL, note TEXT NOT NULL, category TEXT NOT NULL, planned TEXT NOT NULL,
+			duration_ms INTEGER NOT NULL, valid_from TEXT NOT NULL, valid_until TEXT NOT NULL, PRIMARY KEY (list, idx))`,
+		`INSERT INTO lists VALUES ('main', -1, '', 'off', 1)`,
+		`INSERT INTO items VALUES ('main', 0, 't', 'text', 'Stand by', '', '', '', 0, '', '')`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatal("couldn't set up old database:", err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal("couldn't close database:", err)
+	}
+
+	s, err := store.OpenSQLite(path)
+	if err != nil {
+		t.Fatal("couldn't open old database:", err)
+	}
+	defer s.Close()
+	st, ok, err := s.LoadList("main")
+	if err != nil || !ok {
+		t.Fatalf("loading: got ok=%v err=%v, want the list", ok, err)
+	}
+	if len(st.Items) != 1 || st.Items[0].Payload != "Stand by" || st.Items[0].Display != (list.DisplayHints{}) {
+		t.Errorf("items: got %v, want one text item with no hints", st.Items)
+	}
+}
+
+// TestSchedule_Next checks that schedules come round at the earliest of their times, on their days only.
+func TestSchedule_Next(t *testing.T) {
+	s, err := store.ParseSchedule([]string{"sat", "Sunday"}, []string{"14:30", "02:30"})
+	if err != nil {
+		t.Fatal("unexpected error parsing:", err)
+	}
+	// 2020-01-04 is a Saturday.
+	sat := time.Date(2020, 1, 4, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		now, want time.Time
+	}{
+		{sat.Add(-time.Hour), sat.Add(2*time.Hour + 30*time.Minute)},
+		{sat.Add(2*time.Hour + 30*time.Minute), sat.Add(14*time.Hour + 30*time.Minute)},
+		{sat.Add(20 * time.Hour), sat.Add(26*time.Hour + 30*time.Minute)},
+		{sat.Add(40 * time.Hour), sat.Add(7*24*time.Hour + 2*time.Hour + 30*time.Minute)},
+	}
+	for _, c := range cases {
+		if got := s.Next(c.now); !got.Equal(c.want) {
+			t.Errorf("after %v: got %v, want %v", c.now, got, c.want)
+		}
+	}
+
+	if got := (store.Schedule{}).Next(sat); !got.IsZero() {
+		t.Errorf("empty schedule: got %v, want the zero time", got)
+	}
+	for _, bad := range [][2][]string{{nil, {"25:00"}}, {{"someday"}, {"02:30"}}} {
+		if _, err := store.ParseSchedule(bad[0], bad[1]); err == nil {
+			t.Errorf("parsing %q at %q: no error", bad[0], bad[1])
+		}
+	}
+}
+
+// TestRunSnapshots checks that snapshots are taken on schedule, hold the list's state, and are rotated.
+func TestRunSnapshots(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	l := list.New()
+	if err := l.Add(list.NewTrack("a", "a.mp3"), 0); err != nil {
+		t.Fatal("unexpected error adding:", err)
+	}
+	if _, err := l.Select(0, "a"); err != nil {
+		t.Fatal("unexpected error selecting:", err)
+	}
+	ctl, client := controller.NewController(l)
+	go ctl.Run(ctx)
+	go func() {
+		for range client.Rx {
+		}
+	}()
+	snapClient, err := client.Copy(ctx)
+	if err != nil {
+		t.Fatal("couldn't copy client:", err)
+	}
+
+	dir := t.TempDir()
+	// Another list's snapshots, and other files, must survive rotation.
+	other, err := store.WriteSnapshot(dir, "main-2", time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC), list.State{Selection: -1})
+	if err != nil {
+		t.Fatal("unexpected error writing other snapshot:", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main-notes.json"), nil, 0o644); err != nil {
+		t.Fatal("unexpected error writing other file:", err)
+	}
+
+	sched, err := store.ParseSchedule(nil, []string{"03:00"})
+	if err != nil {
+		t.Fatal("unexpected error parsing:", err)
+	}
+	start := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	clk := clock.NewMock(start)
+	taken := make(chan string)
+	go store.RunSnapshots(ctx, snapClient, "main", store.SnapshotPolicy{Dir: dir, Schedule: sched, Keep: 2}, clk,
+		func(path string, _ []string, err error) {
+			if err != nil {
+				t.Error("unexpected error taking snapshot:", err)
+			}
+			taken <- path
+		})
+
+	var paths []string
+	for i := 0; i < 3; i++ {
+		clk.BlockUntil(1)
+		clk.Advance(24 * time.Hour)
+		paths = append(paths, <-taken)
+	}
+
+	got, err := store.Snapshots(dir, "main")
+	if err != nil {
+		t.Fatal("unexpected error listing snapshots:", err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(paths[1:]) {
+		t.Errorf("snapshots: got %v, want %v", got, paths[1:])
+	}
+	if _, err := os.Stat(other); err != nil {
+		t.Errorf("other list's snapshot: %v", err)
+	}
+
+	st, at, err := store.LoadSnapshot(paths[2])
+	if err != nil {
+		t.Fatal("unexpected error loading snapshot:", err)
+	}
+	if want := start.Add(2*24*time.Hour + 15*time.Hour); !at.Equal(want) {
+		t.Errorf("taken at %v, want %v", at, want)
+	}
+	if want := l.State(); fmt.Sprint(st) != fmt.Sprint(want) {
+		t.Errorf("state: got %v, want %v", st, want)
+	}
+}
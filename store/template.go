@@ -0,0 +1,66 @@
+package store
+
+// File template.go contains support for keeping list templates in files, apart from any Storage.
+// Template files look like the list files File keeps, without the selection, version or plays.
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MattWindsor91/yaps/list"
+)
+
+// templateExt is the extension of template files in a template directory.
+const templateExt = ".json"
+
+// fileTemplate is the form in which template files keep a template: much like a list's state in File.
+type fileTemplate struct {
+	Note     string     `json:"note,omitempty"`
+	AutoMode string     `json:"automode"`
+	Items    []fileItem `json:"items"`
+}
+
+// LoadTemplate reads a template saved by SaveTemplate from the file at path.
+func LoadTemplate(path string) (list.Template, error) {
+	bs, err := os.ReadFile(path)
+	if err != nil {
+		return list.Template{}, err
+	}
+
+	var ft fileTemplate
+	if err := json.Unmarshal(bs, &ft); err != nil {
+		return list.Template{}, fmt.Errorf("%s: %w", path, err)
+	}
+	t := list.Template{Note: ft.Note}
+	if t.AutoMode, err = list.ParseAutoMode(ft.AutoMode); err != nil {
+		return list.Template{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if t.Items, err = fromFileItems(ft.Items); err != nil {
+		return list.Template{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return t, nil
+}
+
+// SaveTemplate writes t to the file at path, replacing it.
+func SaveTemplate(path string, t list.Template) error {
+	ft := fileTemplate{Note: t.Note, AutoMode: t.AutoMode.String(), Items: toFileItems(t.Items)}
+	bs, err := json.MarshalIndent(ft, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeAside(path, bs)
+}
+
+// TemplateDir gets a TemplateLoader that loads the template called name from the file 'name.json' in dir.
+// Names that would reach outside dir are refused.
+func TemplateDir(dir string) list.TemplateLoader {
+	return func(name string) (list.Template, error) {
+		if name == "" || strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+			return list.Template{}, fmt.Errorf("bad template name %q", name)
+		}
+		return LoadTemplate(filepath.Join(dir, name+templateExt))
+	}
+}
@@ -0,0 +1,93 @@
+// Package version holds the version of this build of yaps, so that operators and remote clients can tell exactly
+// which build is running.
+//
+// Release builds stamp the version, commit and build date in with the linker:
+//
+//	go build -ldflags "-X github.com/MattWindsor91/yaps/version.Version=1.4.0 \
+//		-X github.com/MattWindsor91/yaps/version.Commit=$(git rev-parse HEAD) \
+//		-X github.com/MattWindsor91/yaps/version.Date=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+//
+// Builds that aren't stamped fall back on what the Go toolchain recorded from version control, if anything.
+package version
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// unknown stands in for anything the build doesn't know about itself.
+const unknown = "unknown"
+
+// These are set at build time with -ldflags "-X ..."; they are variables only so that the linker can set them.
+var (
+	// Version is the semantic version of yaps.
+	Version = "0.0.0"
+	// Commit is the version control commit yaps was built from.
+	Commit = ""
+	// Date is when yaps was built, in RFC 3339 format.
+	Date = ""
+)
+
+// Info describes a build of yaps.
+type Info struct {
+	// Version is the semantic version of yaps.
+	Version string
+	// Commit is the commit yaps was built from, or "unknown".
+	Commit string
+	// Date is when yaps was built, or when its commit was made if the build wasn't stamped, or "unknown".
+	Date string
+	// Modified is true if the build was from a working tree with uncommitted changes, as far as the toolchain knows.
+	Modified bool
+}
+
+// Get describes this build of yaps.
+func Get() Info {
+	i := Info{Version: Version, Commit: Commit, Date: Date}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range bi.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				if i.Commit == "" {
+					i.Commit = s.Value
+				}
+			case "vcs.time":
+				if i.Date == "" {
+					i.Date = s.Value
+				}
+			case "vcs.modified":
+				i.Modified = s.Value == "true"
+			}
+		}
+	}
+	if i.Commit == "" {
+		i.Commit = unknown
+	}
+	if i.Date == "" {
+		i.Date = unknown
+	}
+	return i
+}
+
+// Server gets the server version yaps gives in OHAI: 'yaps-<version>', with the first 12 characters of the commit
+// as build metadata if known, for example 'yaps-1.4.0+0123456789ab'.
+func (i Info) Server() string {
+	s := "yaps-" + i.Version
+	if i.Commit == unknown {
+		return s
+	}
+	commit := i.Commit
+	if 12 < len(commit) {
+		commit = commit[:12]
+	}
+	return s + "+" + commit
+}
+
+// String describes i on one line, for example
+// 'yaps 1.4.0 (commit 0123456789abcdef0123456789abcdef01234567, built 2024-01-01T00:00:00Z)'.
+func (i Info) String() string {
+	commit := i.Commit
+	if i.Modified {
+		commit += ", modified"
+	}
+	return fmt.Sprintf("yaps %s (commit %s, built %s)", i.Version, commit, i.Date)
+}
@@ -0,0 +1,32 @@
+package version_test
+
+import (
+	"testing"
+
+	"github.com/MattWindsor91/yaps/version"
+)
+
+// TestInfo_Server tests the server versions builds give in OHAI.
+func TestInfo_Server(t *testing.T) {
+	cases := map[string]version.Info{
+		"yaps-1.4.0":              {Version: "1.4.0", Commit: "unknown", Date: "unknown"},
+		"yaps-1.4.0+0123456789ab": {Version: "1.4.0", Commit: "0123456789abcdef0123456789abcdef01234567"},
+		"yaps-1.4.0+abc":          {Version: "1.4.0", Commit: "abc"},
+	}
+	for want, i := range cases {
+		if got := i.Server(); got != want {
+			t.Errorf("%+v: got %q, want %q", i, got, want)
+		}
+	}
+}
+
+// TestGet tests that builds always know their version, and at least admit to not knowing anything else.
+func TestGet(t *testing.T) {
+	i := version.Get()
+	if i.Version != version.Version {
+		t.Errorf("got version %q, want %q", i.Version, version.Version)
+	}
+	if i.Commit == "" || i.Date == "" {
+		t.Errorf("got %+v, want every field filled in", i)
+	}
+}
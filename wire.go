@@ -0,0 +1,78 @@
+package main
+
+// File wire.go contains the 'record' and 'replay-wire' subcommands.
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/MattWindsor91/yaps/server"
+	"github.com/MattWindsor91/yaps/wire"
+)
+
+// runRecord runs a capturing proxy in front of a yaps server until interrupted.
+func runRecord(args []string) error {
+	fs := flag.NewFlagSet("record", flag.ContinueOnError)
+	listen := fs.String("listen", "localhost:1351", "host:port on which to accept clients")
+	target := fs.String("server", "localhost:1350", "host:port of the server to record")
+	out := fs.String("out", "yaps.capture", "file to which the capture is written")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w, err := wire.NewWriter(f)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	return wire.NewRecorder(server.NewLogger("record", true), *listen, *target, w).Run(ctx)
+}
+
+// runReplayWire replays the client traffic in a capture file against a yaps server.
+func runReplayWire(args []string) error {
+	fs := flag.NewFlagSet("replay-wire", flag.ContinueOnError)
+	server := fs.String("server", "localhost:1350", "host:port of the server to replay against")
+	scale := fs.Float64("scale", 1, "multiplier for delays between lines (0 replays as fast as possible)")
+	grace := fs.Duration("grace", 2*time.Second, "how long to wait for the server's replies after the last line")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: replay-wire [flags] capture-file")
+	}
+	if *scale < 0 {
+		return errors.New("scale must not be negative")
+	}
+	if *grace < 0 {
+		return errors.New("grace must not be negative")
+	}
+
+	f, err := os.Open(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	entries, err := wire.ReadCapture(f)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	return wire.NewReplayer(*server, *scale, *grace, os.Stdout).Replay(ctx, entries)
+}
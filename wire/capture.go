@@ -0,0 +1,139 @@
+package wire
+
+// File capture.go contains the capture file format, and readers and writers for it.
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// captureHeader is the first line of every capture file.
+const captureHeader = "# yaps wire capture v1"
+
+// Direction is the type of traffic directions in a capture.
+type Direction byte
+
+const (
+	// ToServer marks traffic sent from a client to the server.
+	ToServer Direction = '>'
+	// ToClient marks traffic sent from the server to a client.
+	ToClient Direction = '<'
+)
+
+// Entry is a single captured line of Bifrost traffic.
+type Entry struct {
+	// Offset is the time since the start of the capture at which the line was seen.
+	Offset time.Duration
+	// Conn is the capture-local identifier of the connection carrying the line.
+	Conn int
+	// Dir is the direction in which the line travelled.
+	Dir Direction
+	// Line is the raw line, including its trailing newline.
+	Line []byte
+}
+
+// Writer writes timestamped entries to a capture file.
+// It is safe to use from multiple goroutines.
+type Writer struct {
+	mu    sync.Mutex
+	w     io.Writer
+	start time.Time
+}
+
+// NewWriter creates a Writer over w, writing the capture header immediately.
+// Offsets are measured from the time NewWriter is called.
+func NewWriter(w io.Writer) (*Writer, error) {
+	start := time.Now()
+	if _, err := fmt.Fprintf(w, "%s %s\n", captureHeader, start.Format(time.RFC3339Nano)); err != nil {
+		return nil, err
+	}
+	return &Writer{w: w, start: start}, nil
+}
+
+// Write records line as travelling in direction dir on connection conn.
+// line should contain exactly one Bifrost line; a newline is added if missing.
+func (w *Writer) Write(conn int, dir Direction, line []byte) error {
+	offset := time.Since(w.start)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, err := fmt.Fprintf(w.w, "%d %d %c ", offset.Microseconds(), conn, dir); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(line); err != nil {
+		return err
+	}
+	if !bytes.HasSuffix(line, []byte{'\n'}) {
+		_, err := w.w.Write([]byte{'\n'})
+		return err
+	}
+	return nil
+}
+
+// ReadCapture reads every entry from the capture file in r.
+func ReadCapture(r io.Reader) ([]Entry, error) {
+	br := bufio.NewReader(r)
+
+	header, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read capture header: %w", err)
+	}
+	if !bytes.HasPrefix([]byte(header), []byte(captureHeader)) {
+		return nil, fmt.Errorf("not a capture file: bad header %q", header)
+	}
+
+	var entries []Entry
+	for lineno := 2; ; lineno++ {
+		raw, err := br.ReadBytes('\n')
+		if len(raw) != 0 {
+			e, perr := parseEntry(raw)
+			if perr != nil {
+				return nil, fmt.Errorf("capture line %d: %w", lineno, perr)
+			}
+			entries = append(entries, e)
+		}
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseEntry parses a single capture line raw.
+func parseEntry(raw []byte) (Entry, error) {
+	fields := bytes.SplitN(raw, []byte{' '}, 4)
+	if len(fields) != 4 {
+		return Entry{}, fmt.Errorf("malformed entry")
+	}
+
+	us, err := strconv.ParseInt(string(fields[0]), 10, 64)
+	if err != nil {
+		return Entry{}, fmt.Errorf("bad offset: %w", err)
+	}
+	conn, err := strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return Entry{}, fmt.Errorf("bad connection: %w", err)
+	}
+	if len(fields[2]) != 1 {
+		return Entry{}, fmt.Errorf("bad direction %q", fields[2])
+	}
+	dir := Direction(fields[2][0])
+	if dir != ToServer && dir != ToClient {
+		return Entry{}, fmt.Errorf("bad direction %q", fields[2])
+	}
+
+	return Entry{
+		Offset: time.Duration(us) * time.Microsecond,
+		Conn:   conn,
+		Dir:    dir,
+		Line:   fields[3],
+	}, nil
+}
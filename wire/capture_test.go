@@ -0,0 +1,65 @@
+package wire_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/MattWindsor91/yaps/wire"
+)
+
+// TestWriter_ReadCapture_RoundTrip checks that entries written by a Writer come back out of ReadCapture.
+func TestWriter_ReadCapture_RoundTrip(t *testing.T) {
+	cases := []struct {
+		conn int
+		dir  wire.Direction
+		line string
+	}{
+		{0, wire.ToClient, "! OHAI bifrost-0.0.0 yaps-0.0.0\n"},
+		{0, wire.ToServer, "a1 sel 0 abc\n"},
+		{1, wire.ToServer, "b2 tloadl 0 def 'some text'"},
+		{0, wire.ToClient, "a1 ACK OK success\n"},
+	}
+
+	var buf bytes.Buffer
+	w, err := wire.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("couldn't create writer: %v", err)
+	}
+	for _, c := range cases {
+		if err := w.Write(c.conn, c.dir, []byte(c.line)); err != nil {
+			t.Fatalf("couldn't write entry: %v", err)
+		}
+	}
+
+	entries, err := wire.ReadCapture(&buf)
+	if err != nil {
+		t.Fatalf("couldn't read capture: %v", err)
+	}
+	if len(entries) != len(cases) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(cases))
+	}
+
+	for i, c := range cases {
+		e := entries[i]
+		if e.Conn != c.conn || e.Dir != c.dir {
+			t.Errorf("entry %d: got conn %d dir %c, want conn %d dir %c", i, e.Conn, e.Dir, c.conn, c.dir)
+		}
+		want := c.line
+		if want[len(want)-1] != '\n' {
+			want += "\n"
+		}
+		if string(e.Line) != want {
+			t.Errorf("entry %d: got line %q, want %q", i, e.Line, want)
+		}
+		if 0 < i && e.Offset < entries[i-1].Offset {
+			t.Errorf("entry %d: offset went backwards", i)
+		}
+	}
+}
+
+// TestReadCapture_BadHeader checks that ReadCapture rejects files without a capture header.
+func TestReadCapture_BadHeader(t *testing.T) {
+	if _, err := wire.ReadCapture(bytes.NewBufferString("0 0 > a1 dump\n")); err == nil {
+		t.Error("expected error reading headerless capture")
+	}
+}
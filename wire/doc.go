@@ -0,0 +1,4 @@
+// Package wire provides tools for capturing and replaying raw Bifrost traffic.
+// Captures are line-oriented, timestamped text files that can be attached to bug reports and replayed against a
+// server later.
+package wire
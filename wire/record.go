@@ -0,0 +1,115 @@
+package wire
+
+// File record.go contains Recorder, a capturing proxy that sits in front of a Bifrost listener.
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"log"
+	"net"
+	"sync"
+)
+
+// Recorder is a TCP proxy that records all traffic passing between clients and a Bifrost server.
+type Recorder struct {
+	// log is the Recorder's logger.
+	log *log.Logger
+
+	// listen is the host:port string on which the Recorder accepts clients.
+	listen string
+
+	// server is the host:port string of the server being recorded.
+	server string
+
+	// out is the capture being written.
+	out *Writer
+
+	// wg tracks all proxying goroutines.
+	wg sync.WaitGroup
+}
+
+// NewRecorder creates a Recorder that accepts clients on listen, forwards them to server, and captures to out.
+func NewRecorder(l *log.Logger, listen, server string, out *Writer) *Recorder {
+	return &Recorder{log: l, listen: listen, server: server, out: out}
+}
+
+// Run accepts and proxies connections until ctx is cancelled.
+func (r *Recorder) Run(ctx context.Context) error {
+	ln, err := net.Listen("tcp", r.listen)
+	if err != nil {
+		return err
+	}
+	r.log.Printf("recording %s -> %s\n", r.listen, r.server)
+
+	go func() {
+		<-ctx.Done()
+		_ = ln.Close()
+	}()
+
+	for conn := 0; ; conn++ {
+		c, err := ln.Accept()
+		if err != nil {
+			r.wg.Wait()
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+
+		r.wg.Add(1)
+		go func(conn int) {
+			r.proxy(ctx, conn, c)
+			r.wg.Done()
+		}(conn)
+	}
+}
+
+// proxy forwards traffic between client connection c, with capture identifier conn, and the server.
+func (r *Recorder) proxy(ctx context.Context, conn int, c net.Conn) {
+	defer c.Close()
+
+	s, err := net.Dial("tcp", r.server)
+	if err != nil {
+		r.log.Printf("couldn't dial server for connection %d: %s\n", conn, err.Error())
+		return
+	}
+	defer s.Close()
+	r.log.Printf("connection %d from %s\n", conn, c.RemoteAddr())
+
+	done := make(chan struct{}, 2)
+	go func() {
+		r.pipe(conn, ToServer, c, s)
+		done <- struct{}{}
+	}()
+	go func() {
+		r.pipe(conn, ToClient, s, c)
+		done <- struct{}{}
+	}()
+
+	// Either side hanging up closes the whole proxied connection.
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+	r.log.Printf("connection %d closed\n", conn)
+}
+
+// pipe copies lines from src to dst, recording each one in direction dir.
+func (r *Recorder) pipe(conn int, dir Direction, src io.Reader, dst io.Writer) {
+	br := bufio.NewReader(src)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) != 0 {
+			if werr := r.out.Write(conn, dir, line); werr != nil {
+				r.log.Println("couldn't write capture:", werr)
+			}
+			if _, werr := dst.Write(line); werr != nil {
+				return
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package wire
+
+// File replay.go contains Replayer, which plays a capture's client traffic back against a server.
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Replayer replays the client side of a capture against a Bifrost server.
+type Replayer struct {
+	// server is the host:port string of the server to replay against.
+	server string
+
+	// scale multiplies every inter-line delay in the capture.
+	// 1 replays in real time, 0.5 at double speed, and 0 as fast as possible.
+	scale float64
+
+	// grace is how long the Replayer waits, once it has sent the last line, for the server to finish replying.
+	// Servers tend to keep connections open, so the Replayer hangs up itself once it runs out.
+	grace time.Duration
+
+	// out, if non-nil, receives every server line seen during the replay, prefixed with its connection.
+	out io.Writer
+	// outMu guards out.
+	outMu sync.Mutex
+}
+
+// NewReplayer creates a Replayer targeting server, scaling delays by scale, waiting grace for the server's last replies,
+// and echoing server traffic to out.
+func NewReplayer(server string, scale float64, grace time.Duration, out io.Writer) *Replayer {
+	return &Replayer{server: server, scale: scale, grace: grace, out: out}
+}
+
+// Replay sends every ToServer entry in entries to the server, opening one connection per captured connection.
+// It returns once every line has been sent and the server has hung up every connection, or the grace period has run
+// out; or on the first error.
+func (r *Replayer) Replay(ctx context.Context, entries []Entry) error {
+	conns := map[int]net.Conn{}
+	var wg sync.WaitGroup
+	defer func() {
+		for _, c := range conns {
+			_ = c.Close()
+		}
+		wg.Wait()
+	}()
+
+	start := time.Now()
+	for _, e := range entries {
+		if e.Dir != ToServer {
+			continue
+		}
+
+		if err := r.waitUntil(ctx, start.Add(r.scaled(e.Offset))); err != nil {
+			return err
+		}
+
+		c, ok := conns[e.Conn]
+		if !ok {
+			var err error
+			if c, err = net.Dial("tcp", r.server); err != nil {
+				return fmt.Errorf("couldn't open connection %d: %w", e.Conn, err)
+			}
+			conns[e.Conn] = c
+
+			wg.Add(1)
+			go func(conn int, c net.Conn) {
+				r.echo(conn, c)
+				wg.Done()
+			}(e.Conn, c)
+		}
+
+		if _, err := c.Write(e.Line); err != nil {
+			return fmt.Errorf("couldn't replay to connection %d: %w", e.Conn, err)
+		}
+	}
+
+	r.awaitReplies(ctx, &wg)
+	return nil
+}
+
+// awaitReplies waits for every echo in wg to see the server hang up, for the grace period to run out, or for ctx to
+// be cancelled, whichever comes first.
+func (r *Replayer) awaitReplies(ctx context.Context, wg *sync.WaitGroup) {
+	echoed := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(echoed)
+	}()
+
+	timer := time.NewTimer(r.grace)
+	defer timer.Stop()
+	select {
+	case <-echoed:
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// scaled applies the Replayer's time scaling to offset d.
+func (r *Replayer) scaled(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * r.scale)
+}
+
+// waitUntil sleeps until t, or until ctx is cancelled.
+func (r *Replayer) waitUntil(ctx context.Context, t time.Time) error {
+	d := time.Until(t)
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// echo copies server lines from connection c, with capture identifier conn, to the Replayer's output.
+func (r *Replayer) echo(conn int, c net.Conn) {
+	br := bufio.NewReader(c)
+	for {
+		line, err := br.ReadBytes('\n')
+		if len(line) != 0 && r.out != nil {
+			r.outMu.Lock()
+			_, _ = fmt.Fprintf(r.out, "%d %c %s", conn, ToClient, line)
+			r.outMu.Unlock()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package wire_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MattWindsor91/yaps/wire"
+)
+
+// TestRecorder_Replayer_RoundTrip checks that a capture recorded through a Recorder replays against the same server,
+// and that the replay waits for the server's replies to its last lines.
+func TestRecorder_Replayer_RoundTrip(t *testing.T) {
+	srv := startAckServer(t)
+	defer srv.Close()
+
+	var buf bytes.Buffer
+	w, err := wire.NewWriter(&buf)
+	if err != nil {
+		t.Fatalf("couldn't create writer: %v", err)
+	}
+	listen := freeAddress(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	recorded := make(chan error, 1)
+	go func() {
+		recorded <- wire.NewRecorder(log.New(io.Discard, "", 0), listen, srv.Addr().String(), w).Run(ctx)
+	}()
+
+	lines := []string{"a1 hello\n", "a2 bye\n"}
+	replies := converse(t, listen, lines)
+	cancel()
+	if err := <-recorded; err != nil {
+		t.Fatalf("recorder error: %v", err)
+	}
+
+	entries, err := wire.ReadCapture(&buf)
+	if err != nil {
+		t.Fatalf("couldn't read capture: %v", err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, fmt.Sprintf("%c %s", e.Dir, e.Line))
+	}
+	var want []string
+	for i, l := range lines {
+		want = append(want, fmt.Sprintf("%c %s", wire.ToServer, l), fmt.Sprintf("%c %s", wire.ToClient, replies[i]))
+	}
+	if strings.Join(got, "") != strings.Join(want, "") {
+		t.Errorf("capture: got %q, want %q", got, want)
+	}
+
+	var out bytes.Buffer
+	if err := wire.NewReplayer(srv.Addr().String(), 0, 5*time.Second, &out).Replay(context.Background(), entries); err != nil {
+		t.Fatalf("replay error: %v", err)
+	}
+	var wantOut string
+	for _, r := range replies {
+		wantOut += fmt.Sprintf("0 %c %s", wire.ToClient, r)
+	}
+	if out.String() != wantOut {
+		t.Errorf("replay output: got %q, want %q", out.String(), wantOut)
+	}
+}
+
+// startAckServer starts a server that acknowledges each line it gets, slowly, and hangs up after acknowledging 'bye'.
+func startAckServer(t *testing.T) net.Listener {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("couldn't listen: %v", err)
+	}
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				br := bufio.NewReader(c)
+				for {
+					line, err := br.ReadString('\n')
+					if err != nil {
+						return
+					}
+					// The replies come late enough that a replay that doesn't wait for them misses them.
+					time.Sleep(50 * time.Millisecond)
+					if _, err := fmt.Fprintf(c, "ACK %s", line); err != nil {
+						return
+					}
+					if strings.HasSuffix(line, " bye\n") {
+						return
+					}
+				}
+			}()
+		}
+	}()
+	return ln
+}
+
+// converse dials addr, once something is listening on it, and sends each of lines in turn, returning the reply to each.
+func converse(t *testing.T, addr string, lines []string) []string {
+	t.Helper()
+	var (
+		c   net.Conn
+		err error
+	)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if c, err = net.Dial("tcp", addr); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("couldn't dial recorder: %v", err)
+	}
+	defer c.Close()
+
+	br := bufio.NewReader(c)
+	var replies []string
+	for _, l := range lines {
+		if _, err := io.WriteString(c, l); err != nil {
+			t.Fatalf("couldn't send %q: %v", l, err)
+		}
+		r, err := br.ReadString('\n')
+		if err != nil {
+			t.Fatalf("couldn't read reply to %q: %v", l, err)
+		}
+		replies = append(replies, r)
+	}
+	// The server hangs up after the last line, and the recorder with it.
+	if _, err := br.ReadString('\n'); err != io.EOF {
+		t.Fatalf("after the last reply: got %v, want EOF", err)
+	}
+	return replies
+}
+
+// freeAddress gets a loopback address that nothing was listening on a moment ago.
+func freeAddress(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("couldn't listen: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().String()
+}